@@ -0,0 +1,261 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package backup takes encrypted snapshots of the database, keeps them in the backup
+// targets, and restores the database from them
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+// snapshotTimeFormat is the format of the time in the names of the snapshots, which
+// sorts the names by time
+const snapshotTimeFormat = "20060102T150405Z"
+
+// sqliteHeader is the start of every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// snapshotNameRegex matches the names of the snapshots, such as
+// dnote-20200314T211500Z.db.age, or dnote-20200314T211500Z-migration.db for the local
+// backups that are named after their reason
+var snapshotNameRegex = regexp.MustCompile(`^dnote-\d{8}T\d{6}Z(-[a-z-]+)?\.db(\.[a-z]+)?$`)
+
+// SnapshotName returns the name of the snapshot taken at the given time and encrypted
+// with the given provider
+func SnapshotName(t time.Time, provider string) string {
+	return fmt.Sprintf("dnote-%s.db.%s", t.UTC().Format(snapshotTimeFormat), provider)
+}
+
+// SnapshotTime returns the time at which the snapshot with the given name was taken
+func SnapshotTime(name string) (time.Time, error) {
+	if !snapshotNameRegex.MatchString(name) {
+		return time.Time{}, errors.Errorf("'%s' is not the name of a snapshot", name)
+	}
+
+	ts := strings.TrimPrefix(name, "dnote-")[:len(snapshotTimeFormat)]
+
+	return time.Parse(snapshotTimeFormat, ts)
+}
+
+// Snapshots returns the names of the snapshots in the target, oldest first
+func Snapshots(t Target) ([]string, error) {
+	names, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, name := range names {
+		if snapshotNameRegex.MatchString(name) {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+// Prune removes the snapshots in the target but the newest keep ones, and returns the
+// names of the removed ones. It removes nothing if keep is 0.
+func Prune(t Target, keep int) ([]string, error) {
+	if keep <= 0 {
+		return []string{}, nil
+	}
+
+	names, err := Snapshots(t)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing the snapshots")
+	}
+	if len(names) <= keep {
+		return []string{}, nil
+	}
+
+	removed := names[:len(names)-keep]
+	for _, name := range removed {
+		if err := t.Delete(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, nil
+}
+
+// snapshot writes a consistent copy of the database to the given path
+func snapshot(db *database.DB, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing the previous snapshot")
+	}
+
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return errors.Wrap(err, "copying the database")
+	}
+
+	return nil
+}
+
+// Create takes a snapshot of the database, encrypts it with the provider and stores it
+// in the target. It returns the name of the snapshot.
+func Create(ctx context.DnoteCtx, t Target, p crypt.Provider) (string, error) {
+	tmpPath := ctx.DBPath + ".snapshot"
+	defer os.Remove(tmpPath)
+
+	if err := snapshot(ctx.DB, tmpPath); err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return "", errors.Wrap(err, "opening the snapshot")
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if err := p.Encrypt(&buf, f); err != nil {
+		return "", errors.Wrapf(err, "encrypting with %s", p.Name())
+	}
+
+	name := SnapshotName(ctx.Clock.Now(), p.Name())
+	if err := t.Put(name, buf.Bytes()); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// checkDatabase tells if the file at the given path is a sound SQLite database
+func checkDatabase(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "reading the database")
+	}
+	if !bytes.HasPrefix(b, sqliteHeader) {
+		return errors.New("the snapshot is not a dnote database")
+	}
+
+	db, err := database.Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return errors.Wrap(err, "checking the integrity")
+	}
+	if result != "ok" {
+		return errors.Errorf("the snapshot is corrupt: %s", result)
+	}
+
+	return nil
+}
+
+// replaceDatabase closes the database and moves the file at the given path in its place.
+// The replaced database is kept next to it with the .before-restore suffix.
+func replaceDatabase(ctx context.DnoteCtx, path string) error {
+	// move the recent changes into the database file so that the write-ahead log, which
+	// belongs to the replaced database, can be removed
+	if _, err := ctx.DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return errors.Wrap(err, "checkpointing the database")
+	}
+	if err := ctx.DB.Close(); err != nil {
+		return errors.Wrap(err, "closing the database")
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(ctx.DBPath + suffix); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "removing %s", ctx.DBPath+suffix)
+		}
+	}
+
+	if err := os.Rename(ctx.DBPath, ctx.DBPath+".before-restore"); err != nil {
+		return errors.Wrap(err, "keeping the replaced database")
+	}
+	if err := os.Rename(path, ctx.DBPath); err != nil {
+		return errors.Wrap(err, "moving the snapshot into place")
+	}
+
+	return nil
+}
+
+// Restore replaces the database with the snapshot of the given name in the target, or
+// with the newest snapshot if the name is empty. The encrypted snapshots are decrypted
+// with the given age identities, or with the GPG keyring. It returns the name of the
+// restored snapshot.
+func Restore(ctx context.DnoteCtx, t Target, name string, identities []string) (string, error) {
+	if name == "" {
+		names, err := Snapshots(t)
+		if err != nil {
+			return "", errors.Wrap(err, "listing the snapshots")
+		}
+		if len(names) == 0 {
+			return "", errors.Errorf("there is no snapshot in %s", t.String())
+		}
+
+		name = names[len(names)-1]
+	}
+
+	data, err := t.Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	tmpPath := ctx.DBPath + ".restore"
+	defer os.Remove(tmpPath)
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", errors.Wrap(err, "creating the restored database")
+	}
+	defer f.Close()
+
+	if encryption := crypt.Detect(data); encryption != "" {
+		p, err := crypt.NewProvider(encryption, nil, identities)
+		if err != nil {
+			return "", err
+		}
+		if err := p.Decrypt(f, bytes.NewReader(data)); err != nil {
+			return "", errors.Wrapf(err, "decrypting with %s", p.Name())
+		}
+	} else if _, err := f.Write(data); err != nil {
+		return "", errors.Wrap(err, "writing the restored database")
+	}
+	if err := f.Close(); err != nil {
+		return "", errors.Wrap(err, "writing the restored database")
+	}
+
+	if err := checkDatabase(tmpPath); err != nil {
+		return "", err
+	}
+	if err := replaceDatabase(ctx, tmpPath); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
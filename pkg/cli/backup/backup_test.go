@@ -0,0 +1,224 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../tmp",
+	Cache:  "../tmp",
+	Config: "../tmp",
+	Data:   "../tmp",
+}
+
+// memTarget is a target that keeps the snapshots in memory
+type memTarget map[string][]byte
+
+func (t memTarget) String() string {
+	return "mem://"
+}
+
+func (t memTarget) Put(name string, data []byte) error {
+	t[name] = data
+	return nil
+}
+
+func (t memTarget) Get(name string) ([]byte, error) {
+	data, ok := t[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return data, nil
+}
+
+func (t memTarget) List() ([]string, error) {
+	ret := []string{}
+	for name := range t {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+func (t memTarget) Delete(name string) error {
+	delete(t, name)
+	return nil
+}
+
+// prefixProvider is a provider that marks the data with a prefix instead of encrypting it
+type prefixProvider struct{}
+
+func (p prefixProvider) Name() string {
+	return "test"
+}
+
+func (p prefixProvider) Encrypt(dst io.Writer, src io.Reader) error {
+	if _, err := dst.Write([]byte("encrypted:")); err != nil {
+		return err
+	}
+	_, err := io.Copy(dst, src)
+
+	return err
+}
+
+func (p prefixProvider) Decrypt(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(dst, src)
+
+	return err
+}
+
+func TestSnapshots(t *testing.T) {
+	target := memTarget{
+		"dnote-20200315T090000Z.db.age": nil,
+		"dnote-20200314T211500Z.db.gpg": nil,
+		"notes.txt":                     nil,
+		"dnote-latest.db.age":           nil,
+	}
+
+	got, err := Snapshots(target)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "listing").Error())
+	}
+
+	assert.DeepEqual(t, got, []string{"dnote-20200314T211500Z.db.gpg", "dnote-20200315T090000Z.db.age"}, "snapshots mismatch")
+}
+
+func TestPrune(t *testing.T) {
+	testCases := []struct {
+		keep            int
+		expectedRemoved []string
+	}{
+		{keep: 0, expectedRemoved: []string{}},
+		{keep: 2, expectedRemoved: []string{"dnote-20200313T000000Z.db.age"}},
+		{keep: 3, expectedRemoved: []string{}},
+		{keep: 1, expectedRemoved: []string{"dnote-20200313T000000Z.db.age", "dnote-20200314T000000Z.db.age"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("keep %d", tc.keep), func(t *testing.T) {
+			target := memTarget{
+				"dnote-20200313T000000Z.db.age": nil,
+				"dnote-20200314T000000Z.db.age": nil,
+				"dnote-20200315T000000Z.db.age": nil,
+				"notes.txt":                     nil,
+			}
+
+			removed, err := Prune(target, tc.keep)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "pruning").Error())
+			}
+
+			assert.DeepEqual(t, removed, tc.expectedRemoved, "removed mismatch")
+			assert.Equal(t, len(target), 4-len(tc.expectedRemoved), "remaining count mismatch")
+		})
+	}
+}
+
+func TestCreateRestore(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	ctx.DBPath = ctx.DB.Filepath
+
+	c := clock.NewMock()
+	c.SetNow(time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC))
+	ctx.Clock = c
+
+	database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+	target := memTarget{}
+
+	// execute
+	name, err := Create(ctx, target, prefixProvider{})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating").Error())
+	}
+
+	// test
+	assert.Equal(t, name, "dnote-20200314T211500Z.db.test", "name mismatch")
+	assert.Equal(t, bytes.HasPrefix(target[name], []byte("encrypted:")), true, "the snapshot should be encrypted")
+
+	t.Run("restore", func(t *testing.T) {
+		// store the snapshot as the plain database, as only age and gpg can decrypt
+		target["dnote-20200315T000000Z.db"] = bytes.TrimPrefix(target[name], []byte("encrypted:"))
+		database.MustExec(t, "inserting b2", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+
+		restored, err := Restore(ctx, target, "", nil)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "restoring").Error())
+		}
+		assert.Equal(t, restored, "dnote-20200315T000000Z.db", "restored mismatch")
+
+		db, err := database.Open(ctx.DBPath)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "opening the restored database").Error())
+		}
+		defer db.Close()
+
+		var labels []string
+		rows, err := db.Query("SELECT label FROM books ORDER BY label")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "querying books").Error())
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var label string
+			if err := rows.Scan(&label); err != nil {
+				t.Fatal(errors.Wrap(err, "scanning").Error())
+			}
+			labels = append(labels, label)
+		}
+		assert.DeepEqual(t, labels, []string{"js"}, "books mismatch")
+
+		b, err := ioutil.ReadFile(ctx.DBPath + ".before-restore")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the replaced database").Error())
+		}
+		assert.Equal(t, bytes.HasPrefix(b, sqliteHeader), true, "the replaced database should be kept")
+	})
+
+	t.Run("not a database", func(t *testing.T) {
+		target["dnote-20200316T000000Z.db"] = []byte("not a database")
+
+		if _, err := Restore(ctx, target, "dnote-20200316T000000Z.db", nil); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := Restore(ctx, target, "dnote-20200101T000000Z.db", nil)
+		assert.Equal(t, err, ErrNotFound, "error mismatch")
+	})
+}
@@ -0,0 +1,138 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReasonMigration is the reason of the backups taken before the migrations
+	ReasonMigration = "migration"
+	// ReasonFullSync is the reason of the backups taken before the full syncs
+	ReasonFullSync = "full-sync"
+)
+
+// dirTarget keeps the snapshots in a local directory
+type dirTarget struct {
+	dir string
+}
+
+func (t dirTarget) String() string {
+	return t.dir
+}
+
+func (t dirTarget) Put(name string, data []byte) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return errors.Wrap(err, "creating the directory")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(t.dir, name), data, 0600); err != nil {
+		return errors.Wrapf(err, "writing %s", name)
+	}
+
+	return nil
+}
+
+func (t dirTarget) Get(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(t.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", name)
+	}
+
+	return b, nil
+}
+
+func (t dirTarget) List() ([]string, error) {
+	entries, err := ioutil.ReadDir(t.dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading the directory")
+	}
+
+	ret := []string{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			ret = append(ret, e.Name())
+		}
+	}
+
+	return ret, nil
+}
+
+func (t dirTarget) Delete(name string) error {
+	if err := os.Remove(filepath.Join(t.dir, name)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "removing %s", name)
+	}
+
+	return nil
+}
+
+// localTarget returns the directory next to the database in which the local backups
+// are kept
+func localTarget(ctx context.DnoteCtx) dirTarget {
+	return dirTarget{dir: filepath.Join(filepath.Dir(ctx.DBPath), consts.BackupsDirName)}
+}
+
+// LocalTarget returns the target for the local backups
+func LocalTarget(ctx context.DnoteCtx) Target {
+	return localTarget(ctx)
+}
+
+// Auto takes a local backup of the database before an operation that may go wrong, such
+// as a migration, and removes the old backups but the newest ctx.BackupKeep ones. The
+// backups are not encrypted, as they sit next to the database. It does nothing and
+// returns an empty name if the local backups are turned off.
+func Auto(ctx context.DnoteCtx, reason string) (string, error) {
+	if ctx.BackupKeep <= 0 {
+		return "", nil
+	}
+
+	t := localTarget(ctx)
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return "", errors.Wrap(err, "creating the backups directory")
+	}
+
+	name := fmt.Sprintf("dnote-%s-%s.db", ctx.Clock.Now().UTC().Format(snapshotTimeFormat), reason)
+	if err := snapshot(ctx.DB, filepath.Join(t.dir, name)); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(filepath.Join(t.dir, name), 0600); err != nil {
+		return "", errors.Wrap(err, "restricting the permission of the backup")
+	}
+
+	if _, err := Prune(t, ctx.BackupKeep); err != nil {
+		return "", errors.Wrap(err, "removing the old backups")
+	}
+
+	log.Debug("backed up the database to %s\n", name)
+
+	return name, nil
+}
@@ -0,0 +1,94 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+func TestAuto(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	ctx.DBPath = ctx.DB.Filepath
+	ctx.BackupKeep = 2
+
+	c := clock.NewMock()
+	ctx.Clock = c
+
+	// execute
+	for i, reason := range []string{ReasonMigration, ReasonFullSync, ReasonMigration} {
+		c.SetNow(time.Date(2020, time.March, 14+i, 21, 15, 0, 0, time.UTC))
+
+		if _, err := Auto(ctx, reason); err != nil {
+			t.Fatal(errors.Wrap(err, "backing up").Error())
+		}
+	}
+
+	// test
+	names, err := Snapshots(LocalTarget(ctx))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "listing").Error())
+	}
+	assert.DeepEqual(t, names, []string{"dnote-20200315T211500Z-full-sync.db", "dnote-20200316T211500Z-migration.db"}, "backups mismatch")
+
+	info, err := os.Stat(filepath.Join(filepath.Dir(ctx.DBPath), consts.BackupsDirName, names[0]))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "checking the backup").Error())
+	}
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600), "permission mismatch")
+
+	t.Run("turned off", func(t *testing.T) {
+		ctx.BackupKeep = 0
+		c.SetNow(time.Date(2020, time.March, 20, 0, 0, 0, 0, time.UTC))
+
+		name, err := Auto(ctx, ReasonMigration)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "backing up").Error())
+		}
+		assert.Equal(t, name, "", "name mismatch")
+
+		names, err := Snapshots(LocalTarget(ctx))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "listing").Error())
+		}
+		assert.Equal(t, len(names), 2, "backup count mismatch")
+	})
+}
+
+func TestSnapshotTime(t *testing.T) {
+	got, err := SnapshotTime("dnote-20200314T211500Z-migration.db")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing").Error())
+	}
+	assert.Equal(t, got, time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC), "time mismatch")
+
+	if _, err := SnapshotTime("notes.db"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
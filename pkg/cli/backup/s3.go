@@ -0,0 +1,341 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// s3DefaultRegion is the region used if none is configured in the environment
+const s3DefaultRegion = "us-east-1"
+
+// s3Timeout is how long a request to S3 may take
+const s3Timeout = 5 * time.Minute
+
+// s3Target keeps the snapshots in an S3 bucket, or in a storage with the S3 API. The
+// requests are signed with the AWS Signature Version 4.
+type s3Target struct {
+	client http.Client
+	// endpoint is the URL of the bucket
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+
+	now func() time.Time
+}
+
+// newS3Target returns the target for s3://bucket/path. The credentials and the region
+// are read from the same environment variables as the AWS CLI. AWS_ENDPOINT_URL points
+// it to a storage with the S3 API, such as MinIO, which is then addressed by path.
+func newS3Target(u *url.URL) (*s3Target, error) {
+	if u.Host == "" {
+		return nil, errors.New("the S3 location has no bucket. Use s3://bucket/path")
+	}
+
+	ret := &s3Target{
+		client:       http.Client{Timeout: s3Timeout},
+		bucket:       u.Host,
+		prefix:       joinPrefix(u.Path),
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		now:          time.Now,
+	}
+	if ret.region == "" {
+		ret.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if ret.region == "" {
+		ret.region = s3DefaultRegion
+	}
+	if ret.accessKey == "" || ret.secretKey == "" {
+		return nil, errors.New("the S3 credentials are not set. Set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	var err error
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		ret.endpoint, err = url.Parse(strings.TrimSuffix(endpoint, "/") + "/" + ret.bucket)
+	} else {
+		ret.endpoint, err = url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com", ret.bucket, ret.region))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the S3 endpoint")
+	}
+
+	return ret, nil
+}
+
+func (t *s3Target) String() string {
+	return fmt.Sprintf("s3://%s/%s", t.bucket, t.prefix)
+}
+
+// awsEscape encodes the string as the AWS signature requires, in which only the
+// unreserved characters are left as they are
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// sign adds the AWS Signature Version 4 to the request. All headers set on the request
+// are signed, along with the host.
+func (t *s3Target) sign(req *http.Request, payloadHash string) {
+	now := t.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if t.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", t.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, vals := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, t.region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), date)
+	key = hmacSHA256(key, t.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.accessKey, scope, signedHeaders, signature))
+}
+
+// newRequest returns a signed request for the object with the given key, or for the
+// bucket if the key is empty. The query is encoded in the canonical order.
+func (t *s3Target) newRequest(method, key string, query url.Values, body []byte) (*http.Request, error) {
+	u := *t.endpoint
+	p := strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.Path = p
+	u.RawPath = awsEscape(p, false)
+
+	var params []string
+	for k, vals := range query {
+		for _, v := range vals {
+			params = append(params, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	sort.Strings(params)
+	u.RawQuery = strings.Join(params, "&")
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "making the request")
+	}
+
+	t.sign(req, sha256Hex(body))
+
+	return req, nil
+}
+
+// s3Error is the error returned by S3
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends the request and returns the body of the response. It returns ErrNotFound if
+// the object does not exist.
+func (t *s3Target) do(req *http.Request) ([]byte, error) {
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "sending the request")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the response")
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode >= 300 {
+		var e s3Error
+		if err := xml.Unmarshal(body, &e); err == nil && e.Code != "" {
+			return nil, errors.Errorf("S3 responded with %s: %s", e.Code, e.Message)
+		}
+
+		return nil, errors.Errorf("S3 responded with %s", res.Status)
+	}
+
+	return body, nil
+}
+
+func (t *s3Target) Put(name string, data []byte) error {
+	req, err := t.newRequest(http.MethodPut, t.prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.do(req); err != nil {
+		return errors.Wrapf(err, "uploading %s", name)
+	}
+
+	return nil
+}
+
+func (t *s3Target) Get(name string) ([]byte, error) {
+	req, err := t.newRequest(http.MethodGet, t.prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := t.do(req)
+	if err == ErrNotFound {
+		return nil, err
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "downloading %s", name)
+	}
+
+	return body, nil
+}
+
+func (t *s3Target) Delete(name string) error {
+	req, err := t.newRequest(http.MethodDelete, t.prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.do(req); err != nil && err != ErrNotFound {
+		return errors.Wrapf(err, "deleting %s", name)
+	}
+
+	return nil
+}
+
+// s3ListResult is a page of the objects in the bucket
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (t *s3Target) List() ([]string, error) {
+	ret := []string{}
+
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {t.prefix}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := t.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := t.do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "listing the objects")
+		}
+
+		var result s3ListResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, errors.Wrap(err, "decoding the objects")
+		}
+		for _, c := range result.Contents {
+			ret = append(ret, strings.TrimPrefix(c.Key, t.prefix))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,72 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when a snapshot does not exist in the target
+var ErrNotFound = errors.New("the snapshot was not found")
+
+// Target is a place that keeps the snapshots, such as an S3 bucket or a WebDAV server
+type Target interface {
+	// String returns the location of the target without the credentials, to be shown
+	String() string
+	// Put stores the snapshot with the given name, replacing any with the same name
+	Put(name string, data []byte) error
+	// Get returns the snapshot with the given name, or ErrNotFound
+	Get(name string) ([]byte, error)
+	// List returns the names of all files in the target
+	List() ([]string, error)
+	// Delete removes the snapshot with the given name. It does nothing if there is none.
+	Delete(name string) error
+}
+
+// NewTarget returns the target at the given location, which is s3://bucket/path, or
+// webdav://host/path or webdavs://host/path for WebDAV over https
+func NewTarget(location string) (Target, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the location")
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return newS3Target(u)
+	case "webdav", "webdavs":
+		return newWebDAVTarget(u)
+	}
+
+	return nil, errors.Errorf("unsupported backup location '%s'. Use s3://bucket/path, webdav://host/path or webdavs://host/path", location)
+}
+
+// joinPrefix returns the path under which the snapshots are kept, with a trailing slash,
+// or an empty string if they are kept at the root
+func joinPrefix(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+
+	return p + "/"
+}
@@ -0,0 +1,243 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// webdavTimeout is how long a request to the WebDAV server may take
+const webdavTimeout = 5 * time.Minute
+
+// webdavPropfind asks only for the type of the resources, as the names are all that
+// is needed
+const webdavPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+
+// webdavTarget keeps the snapshots in a collection on a WebDAV server
+type webdavTarget struct {
+	client http.Client
+	// base is the URL of the collection, with a trailing slash
+	base     *url.URL
+	username string
+	password string
+}
+
+// newWebDAVTarget returns the target for webdav://host/path, or webdavs://host/path for
+// https. The credentials are taken from the location or, if it has none, from the
+// DNOTE_WEBDAV_USERNAME and DNOTE_WEBDAV_PASSWORD environment variables.
+func newWebDAVTarget(u *url.URL) (*webdavTarget, error) {
+	if u.Host == "" {
+		return nil, errors.Errorf("the WebDAV location has no host. Use %s://host/path", u.Scheme)
+	}
+
+	base := *u
+	base.Scheme = "http"
+	if u.Scheme == "webdavs" {
+		base.Scheme = "https"
+	}
+	base.User = nil
+	base.Path = "/" + joinPrefix(u.Path)
+	base.RawPath = ""
+
+	ret := &webdavTarget{
+		client:   http.Client{Timeout: webdavTimeout},
+		base:     &base,
+		username: os.Getenv("DNOTE_WEBDAV_USERNAME"),
+		password: os.Getenv("DNOTE_WEBDAV_PASSWORD"),
+	}
+	if u.User != nil {
+		ret.username = u.User.Username()
+		ret.password, _ = u.User.Password()
+	}
+
+	return ret, nil
+}
+
+func (t *webdavTarget) String() string {
+	return t.base.String()
+}
+
+// newRequest returns a request for the file with the given name in the collection, or
+// for the collection itself if the name is empty
+func (t *webdavTarget) newRequest(method, name string, body []byte) (*http.Request, error) {
+	u := *t.base
+	u.Path += name
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "making the request")
+	}
+	if t.username != "" {
+		req.SetBasicAuth(t.username, t.password)
+	}
+
+	return req, nil
+}
+
+// do sends the request and returns the response with its body read
+func (t *webdavTarget) do(req *http.Request) (*http.Response, []byte, error) {
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "sending the request")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "reading the response")
+	}
+
+	return res, body, nil
+}
+
+// ensureCollection creates the collection if it does not exist
+func (t *webdavTarget) ensureCollection() error {
+	req, err := t.newRequest("MKCOL", "", nil)
+	if err != nil {
+		return err
+	}
+
+	res, _, err := t.do(req)
+	if err != nil {
+		return err
+	}
+
+	// 405 Method Not Allowed is returned if the collection already exists
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusMethodNotAllowed {
+		return errors.Errorf("creating the collection: the server responded with %s", res.Status)
+	}
+
+	return nil
+}
+
+func (t *webdavTarget) Put(name string, data []byte) error {
+	if err := t.ensureCollection(); err != nil {
+		return err
+	}
+
+	req, err := t.newRequest(http.MethodPut, name, data)
+	if err != nil {
+		return err
+	}
+	res, _, err := t.do(req)
+	if err != nil {
+		return errors.Wrapf(err, "uploading %s", name)
+	}
+	if res.StatusCode >= 300 {
+		return errors.Errorf("uploading %s: the server responded with %s", name, res.Status)
+	}
+
+	return nil
+}
+
+func (t *webdavTarget) Get(name string) ([]byte, error) {
+	req, err := t.newRequest(http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, body, err := t.do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "downloading %s", name)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode >= 300 {
+		return nil, errors.Errorf("downloading %s: the server responded with %s", name, res.Status)
+	}
+
+	return body, nil
+}
+
+func (t *webdavTarget) Delete(name string) error {
+	req, err := t.newRequest(http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	res, _, err := t.do(req)
+	if err != nil {
+		return errors.Wrapf(err, "deleting %s", name)
+	}
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusNotFound {
+		return errors.Errorf("deleting %s: the server responded with %s", name, res.Status)
+	}
+
+	return nil
+}
+
+// webdavMultistatus is the response to a PROPFIND request
+type webdavMultistatus struct {
+	Responses []struct {
+		Href string `xml:"DAV: href"`
+	} `xml:"DAV: response"`
+}
+
+func (t *webdavTarget) List() ([]string, error) {
+	req, err := t.newRequest("PROPFIND", "", []byte(webdavPropfind))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml")
+
+	res, body, err := t.do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing the files")
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	}
+	if res.StatusCode != http.StatusMultiStatus {
+		return nil, errors.Errorf("listing the files: the server responded with %s", res.Status)
+	}
+
+	var ms webdavMultistatus
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, errors.Wrap(err, "decoding the files")
+	}
+
+	ret := []string{}
+	for _, r := range ms.Responses {
+		// the href is either a path or a full URL
+		u, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", r.Href)
+		}
+
+		// the collection itself and its sub collections end with a slash
+		if strings.HasSuffix(u.Path, "/") || path.Dir(u.Path)+"/" != t.base.Path {
+			continue
+		}
+
+		ret = append(ret, path.Base(u.Path))
+	}
+
+	return ret, nil
+}
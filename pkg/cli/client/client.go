@@ -21,9 +21,13 @@
 package client
 
 import (
+	stdcontext "context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -31,16 +35,30 @@ import (
 	"time"
 
 	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/dnote/dnote/pkg/cli/validate"
 	"github.com/pkg/errors"
 )
 
 // ErrInvalidLogin is an error for invalid credentials for login
 var ErrInvalidLogin = errors.New("wrong credentials")
 
+// ErrInvalidMFACode is an error for a wrong second factor code for login
+var ErrInvalidMFACode = errors.New("wrong authentication code")
+
+// ErrMFAUnsupported is an error for a server that asks for a second factor but cannot
+// verify one
+var ErrMFAUnsupported = errors.New("the server does not support logging in with a second factor")
+
 // ErrContentTypeMismatch is an error for invalid credentials for login
 var ErrContentTypeMismatch = errors.New("content type mismatch")
 
+// requestIDHeader is the header carrying the id of the request, with which the operators
+// of the server can find the request in the server logs
+var requestIDHeader = "X-Request-ID"
+
 var contentTypeApplicationJSON = "application/json"
 var contentTypeNone = ""
 
@@ -55,14 +73,19 @@ var defaultRequestOptions = requestOptions{
 	ExpectedContentType: &contentTypeApplicationJSON,
 }
 
-func getReq(ctx context.DnoteCtx, path, method, body string) (*http.Request, error) {
-	endpoint := fmt.Sprintf("%s%s", ctx.APIEndpoint, path)
+func getReq(ctx context.DnoteCtx, path, method, body, requestID string) (*http.Request, error) {
+	if err := validate.APIEndpoint(ctx.APIEndpoint); err != nil {
+		return nil, errors.Wrapf(err, "invalid apiEndpoint '%s' in the configuration file", ctx.APIEndpoint)
+	}
+
+	endpoint := fmt.Sprintf("%s%s", strings.TrimSuffix(ctx.APIEndpoint, "/"), path)
 	req, err := http.NewRequest(method, endpoint, strings.NewReader(body))
 	if err != nil {
 		return nil, errors.Wrap(err, "constructing http request")
 	}
 
 	req.Header.Set("CLI-Version", ctx.Version)
+	req.Header.Set(requestIDHeader, requestID)
 
 	if ctx.SessionKey != "" {
 		credential := fmt.Sprintf("Bearer %s", ctx.SessionKey)
@@ -72,12 +95,33 @@ func getReq(ctx context.DnoteCtx, path, method, body string) (*http.Request, err
 	return req, nil
 }
 
-func getHTTPClient(options *requestOptions) http.Client {
+func getHTTPClient(ctx context.DnoteCtx, options *requestOptions) http.Client {
 	if options != nil && options.HTTPClient != nil {
 		return *options.HTTPClient
 	}
 
-	return http.Client{}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	// connect to the given address, while keeping the host of the endpoint for the
+	// Host header and the TLS verification
+	if ctx.APIDialAddr != "" {
+		return http.Client{
+			Transport: &http.Transport{
+				DialContext: throttleDial(ctx, func(c stdcontext.Context, network, addr string) (net.Conn, error) {
+					return dialer.DialContext(c, network, ctx.APIDialAddr)
+				}),
+				TLSHandshakeTimeout: dialTimeout,
+			},
+		}
+	}
+
+	return http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         throttleDial(ctx, dialer.DialContext),
+			TLSHandshakeTimeout: dialTimeout,
+		},
+	}
 }
 
 func getExpectedContentType(options *requestOptions) string {
@@ -88,20 +132,13 @@ func getExpectedContentType(options *requestOptions) string {
 	return contentTypeApplicationJSON
 }
 
-// checkRespErr checks if the given http response indicates an error. It returns a boolean indicating
-// if the response is an error, and a decoded error message.
+// checkRespErr returns an *Error if the given http response indicates an error
 func checkRespErr(res *http.Response) error {
 	if res.StatusCode < 400 {
 		return nil
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return errors.Wrapf(err, "server responded with %d but client could not read the response body", res.StatusCode)
-	}
-
-	bodyStr := string(body)
-	return errors.Errorf(`response %d "%s"`, res.StatusCode, strings.TrimRight(bodyStr, "\n"))
+	return newError(res)
 }
 
 func checkContentType(res *http.Response, options *requestOptions) error {
@@ -115,16 +152,53 @@ func checkContentType(res *http.Response, options *requestOptions) error {
 	return nil
 }
 
-// doReq does a http request to the given path in the api endpoint
+// doReq does a http request to the given path in the api endpoint. The request is
+// retried with an exponential backoff if it fails due to the network or the server.
+// All attempts carry the same request id, which is included in the error, if any.
 func doReq(ctx context.DnoteCtx, method, path, body string, options *requestOptions) (*http.Response, error) {
-	req, err := getReq(ctx, path, method, body)
+	requestID, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, errors.Wrap(err, "generating a request id")
+	}
+
+	log.Debug("request %s: %s %s\n", requestID, method, path)
+
+	for attempt := 0; ; attempt++ {
+		res, err := doReqOnce(ctx, method, path, body, requestID, options)
+
+		if attempt+1 >= maxAttempts || !shouldRetry(method, res, err) || !takeRetryBudget() {
+			if err != nil {
+				return res, errors.Wrapf(err, "request %s", requestID)
+			}
+
+			return res, nil
+		}
+
+		delay := getRetryDelay(attempt, res)
+		log.Debug("retrying %s %s in %s after: %v\n", method, path, delay, err)
+
+		if res != nil {
+			res.Body.Close()
+		}
+
+		sleep(delay)
+	}
+}
+
+// doReqOnce does a http request to the given path in the api endpoint without retrying
+func doReqOnce(ctx context.DnoteCtx, method, path, body, requestID string, options *requestOptions) (*http.Response, error) {
+	req, err := getReq(ctx, path, method, body, requestID)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting request")
 	}
 
 	log.Debug("HTTP request: %+v\n", req)
 
-	hc := getHTTPClient(options)
+	if err := waitRequest(ctx); err != nil {
+		return nil, errors.Wrap(err, "waiting for the request rate limit")
+	}
+
+	hc := getHTTPClient(ctx, options)
 	res, err := hc.Do(req)
 	if err != nil {
 		return res, errors.Wrap(err, "making http request")
@@ -145,11 +219,29 @@ func doReq(ctx context.DnoteCtx, method, path, body string, options *requestOpti
 
 // doAuthorizedReq does a http request to the given path in the api endpoint as a user,
 // with the appropriate headers. The given path should include the preceding slash.
+//
+// If the session has expired, it is renewed with the refresh token, if any, and the
+// request is made again.
 func doAuthorizedReq(ctx context.DnoteCtx, method, path, body string, options *requestOptions) (*http.Response, error) {
 	if ctx.SessionKey == "" {
 		return nil, errors.New("no session key found")
 	}
 
+	ctx.SessionKey = getSessionKey(ctx.SessionKey)
+
+	res, err := doReq(ctx, method, path, body, options)
+	if GetErrorCode(err) != ErrorCodeAuthExpired || ctx.RefreshToken == "" {
+		return res, err
+	}
+
+	key, refreshErr := refreshSession(ctx)
+	if refreshErr != nil {
+		log.Debug("could not renew the session: %s\n", refreshErr.Error())
+		return res, err
+	}
+
+	ctx.SessionKey = key
+
 	return doReq(ctx, method, path, body, options)
 }
 
@@ -187,13 +279,30 @@ type SyncFragNote struct {
 	UUID      string    `json:"uuid"`
 	BookUUID  string    `json:"book_uuid"`
 	USN       int       `json:"usn"`
+	Title     string    `json:"title"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	AddedOn   int64     `json:"added_on"`
 	EditedOn  int64     `json:"edited_on"`
 	Body      string    `json:"content"`
 	Public    bool      `json:"public"`
-	Deleted   bool      `json:"deleted"`
+	// Visibility is empty if the server predates it, in which case Public is to be used
+	Visibility string `json:"visibility"`
+	Deleted    bool   `json:"deleted"`
+	// Checksum is the checksum of the body. It is empty if the server does not have it.
+	Checksum string `json:"checksum"`
+	// Author is the email of the user who wrote a note in a team book. It is empty otherwise.
+	Author string `json:"author"`
+	// Metadata is the key-value metadata of the note encrypted by a client. It is empty if
+	// the metadata is not synced.
+	Metadata string `json:"metadata"`
+}
+
+// Checksum returns the checksum of the given note content, as computed by the server
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+
+	return hex.EncodeToString(sum[:])
 }
 
 // SyncFragBook represents a book in a sync fragment and contains only the necessary information
@@ -206,6 +315,8 @@ type SyncFragBook struct {
 	AddedOn   int64     `json:"added_on"`
 	Label     string    `json:"label"`
 	Deleted   bool      `json:"deleted"`
+	// Owner is the email of the owner of a team book owned by another user. It is empty otherwise.
+	Owner string `json:"owner"`
 }
 
 // SyncFragment contains a piece of information about the server's state.
@@ -217,6 +328,25 @@ type SyncFragment struct {
 	Books         []SyncFragBook `json:"books"`
 	ExpungedNotes []string       `json:"expunged_notes"`
 	ExpungedBooks []string       `json:"expunged_books"`
+	// Limit is the number of books and notes the server used as the size of the fragment.
+	// The servers that predate the pagination hints do not send it.
+	Limit int `json:"limit"`
+	// HasMore is whether there are more fragments after this one. It is nil if the server
+	// predates the pagination hints, in which case the last fragment is empty.
+	HasMore *bool `json:"has_more"`
+}
+
+// MaxSyncPageSize is the largest number of books and notes the server sends in a sync fragment
+const MaxSyncPageSize = 100
+
+// CheckSyncPageSize returns an error if the server does not accept the page size. A page
+// size of 0 lets the server decide.
+func CheckSyncPageSize(n int) error {
+	if n < 0 || n > MaxSyncPageSize {
+		return errors.Errorf("the page size must be between 0 and %d", MaxSyncPageSize)
+	}
+
+	return nil
 }
 
 // GetSyncFragmentResp is the response from the get sync fragment endpoint
@@ -226,12 +356,24 @@ type GetSyncFragmentResp struct {
 
 // GetSyncFragment gets a sync fragment response from the server
 func GetSyncFragment(ctx context.DnoteCtx, afterUSN int) (GetSyncFragmentResp, error) {
+	return GetSyncFragmentPage(ctx, afterUSN, 0)
+}
+
+// GetSyncFragmentPage gets a sync fragment with at most the given number of books and
+// notes. If limit is 0, the server decides the size of the fragment.
+func GetSyncFragmentPage(ctx context.DnoteCtx, afterUSN, limit int) (GetSyncFragmentResp, error) {
 	v := url.Values{}
 	v.Set("after_usn", strconv.Itoa(afterUSN))
+	if limit > 0 {
+		v.Set("limit", strconv.Itoa(limit))
+	}
 	queryStr := v.Encode()
 
 	path := fmt.Sprintf("/v3/sync/fragment?%s", queryStr)
 	res, err := doAuthorizedReq(ctx, "GET", path, "", nil)
+	if err != nil {
+		return GetSyncFragmentResp{}, errors.Wrap(err, "making http request")
+	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -344,10 +486,71 @@ func DeleteBook(ctx context.DnoteCtx, uuid string) (DeleteBookResp, error) {
 	return resp, nil
 }
 
+// BookMember is a user who can write to a team book
+type BookMember struct {
+	Email string `json:"email"`
+	Owner bool   `json:"owner"`
+}
+
+// GetBookMembersResp is the response from get book members api
+type GetBookMembersResp struct {
+	Members []BookMember `json:"members"`
+}
+
+// GetBookMembers gets the owner and the members of a book in the server
+func GetBookMembers(ctx context.DnoteCtx, uuid string) (GetBookMembersResp, error) {
+	endpoint := fmt.Sprintf("/v3/books/%s/members", uuid)
+	res, err := doAuthorizedReq(ctx, "GET", endpoint, "", nil)
+	if err != nil {
+		return GetBookMembersResp{}, errors.Wrap(err, "getting the book members from the server")
+	}
+
+	var resp GetBookMembersResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return resp, errors.Wrap(err, "decoding the response")
+	}
+
+	return resp, nil
+}
+
+type addBookMemberPayload struct {
+	Email string `json:"email"`
+}
+
+// AddBookMember lets the user with the given email write to a book in the server
+func AddBookMember(ctx context.DnoteCtx, uuid, email string) error {
+	b, err := json.Marshal(addBookMemberPayload{Email: email})
+	if err != nil {
+		return errors.Wrap(err, "marshaling payload")
+	}
+
+	endpoint := fmt.Sprintf("/v3/books/%s/members", uuid)
+	if _, err := doAuthorizedReq(ctx, "POST", endpoint, string(b), nil); err != nil {
+		return errors.Wrap(err, "adding a book member in the server")
+	}
+
+	return nil
+}
+
+// RemoveBookMember stops the user with the given email from writing to a book in the server
+func RemoveBookMember(ctx context.DnoteCtx, uuid, email string) error {
+	endpoint := fmt.Sprintf("/v3/books/%s/members/%s", uuid, url.PathEscape(email))
+	if _, err := doAuthorizedReq(ctx, "DELETE", endpoint, "", nil); err != nil {
+		return errors.Wrap(err, "removing a book member in the server")
+	}
+
+	return nil
+}
+
 // CreateNotePayload is a payload for creating a note
 type CreateNotePayload struct {
 	BookUUID string `json:"book_uuid"`
+	Title    string `json:"title"`
 	Body     string `json:"content"`
+	// Checksum lets the server reject the content corrupted on the way
+	Checksum string `json:"checksum"`
+	// Metadata is the encrypted metadata of the note. It is nil if the metadata is not synced.
+	Metadata *string `json:"metadata,omitempty"`
 }
 
 // CreateNoteResp is the response from create note endpoint
@@ -369,6 +572,7 @@ type RespNote struct {
 	UUID      string       `json:"uuid"`
 	CreatedAt time.Time    `json:"created_at"`
 	UpdatedAt time.Time    `json:"updated_at"`
+	Title     string       `json:"title"`
 	Body      string       `json:"content"`
 	AddedOn   int64        `json:"added_on"`
 	Public    bool         `json:"public"`
@@ -377,11 +581,14 @@ type RespNote struct {
 	User      respNoteUser `json:"user"`
 }
 
-// CreateNote creates a note in the server
-func CreateNote(ctx context.DnoteCtx, bookUUID, content string) (CreateNoteResp, error) {
+// CreateNote creates a note in the server. The metadata is nil if it is not synced.
+func CreateNote(ctx context.DnoteCtx, bookUUID, title, content string, metadata *string) (CreateNoteResp, error) {
 	payload := CreateNotePayload{
 		BookUUID: bookUUID,
+		Title:    title,
 		Body:     content,
+		Checksum: Checksum(content),
+		Metadata: metadata,
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -403,8 +610,13 @@ func CreateNote(ctx context.DnoteCtx, bookUUID, content string) (CreateNoteResp,
 
 type updateNotePayload struct {
 	BookUUID *string `json:"book_uuid"`
+	Title    *string `json:"title"`
 	Body     *string `json:"content"`
 	Public   *bool   `json:"public"`
+	// Visibility takes precedence over Public for the servers that support it
+	Visibility *string `json:"visibility"`
+	Checksum   *string `json:"checksum"`
+	Metadata   *string `json:"metadata,omitempty"`
 }
 
 // UpdateNoteResp is the response from create book api
@@ -413,12 +625,18 @@ type UpdateNoteResp struct {
 	Result RespNote `json:"result"`
 }
 
-// UpdateNote updates a note in the server
-func UpdateNote(ctx context.DnoteCtx, uuid, bookUUID, content string, public bool) (UpdateNoteResp, error) {
+// UpdateNote updates a note in the server. The metadata is nil if it is not synced.
+func UpdateNote(ctx context.DnoteCtx, uuid, bookUUID, title, content, visibility string, metadata *string) (UpdateNoteResp, error) {
+	checksum := Checksum(content)
+	public := visibility != database.NoteVisibilityPrivate
 	payload := updateNotePayload{
-		BookUUID: &bookUUID,
-		Body:     &content,
-		Public:   &public,
+		BookUUID:   &bookUUID,
+		Title:      &title,
+		Body:       &content,
+		Public:     &public,
+		Visibility: &visibility,
+		Checksum:   &checksum,
+		Metadata:   metadata,
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -467,6 +685,31 @@ type GetBooksResp []struct {
 	Label string `json:"label"`
 }
 
+// GetNoteResp is the response from get note endpoint
+type GetNoteResp struct {
+	UUID    string `json:"uuid"`
+	Body    string `json:"content"`
+	AddedOn int64  `json:"added_on"`
+	Public  bool   `json:"public"`
+	USN     int    `json:"usn"`
+}
+
+// GetNote gets the note with the given uuid from the server
+func GetNote(ctx context.DnoteCtx, uuid string) (GetNoteResp, error) {
+	var ret GetNoteResp
+
+	res, err := doAuthorizedReq(ctx, "GET", fmt.Sprintf("/notes/%s", uuid), "", nil)
+	if err != nil {
+		return ret, errors.Wrap(err, "making http request")
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&ret); err != nil {
+		return ret, errors.Wrap(err, "decoding payload")
+	}
+
+	return ret, nil
+}
+
 // GetBooks gets books from the server
 func GetBooks(ctx context.DnoteCtx, sessionKey string) (GetBooksResp, error) {
 	res, err := doAuthorizedReq(ctx, "GET", "/v3/books", "", nil)
@@ -512,6 +755,13 @@ type SigninPayload struct {
 type SigninResponse struct {
 	Key       string `json:"key"`
 	ExpiresAt int64  `json:"expires_at"`
+	// MFARequired is true if the account has a second factor enabled, in which case the
+	// session is given by SigninMFA in exchange for MFAToken and a code
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	// RefreshToken renews the session when it expires. The servers that do not support
+	// renewing the sessions do not send it.
+	RefreshToken string `json:"refresh_token"`
 }
 
 // Signin requests a session token
@@ -526,7 +776,7 @@ func Signin(ctx context.DnoteCtx, email, password string) (SigninResponse, error
 	}
 	res, err := doReq(ctx, "POST", "/v3/signin", string(b), nil)
 
-	if res.StatusCode == http.StatusUnauthorized {
+	if res != nil && res.StatusCode == http.StatusUnauthorized {
 		return SigninResponse{}, ErrInvalidLogin
 	} else if err != nil {
 		return SigninResponse{}, errors.Wrap(err, "making http request")
@@ -540,13 +790,47 @@ func Signin(ctx context.DnoteCtx, email, password string) (SigninResponse, error
 	return resp, nil
 }
 
+// SigninMFAPayload is a payload for /v3/signin/mfa
+type SigninMFAPayload struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// SigninMFA completes the signin of an account with a second factor, exchanging the token
+// from Signin and a TOTP code or a backup code for a session token
+func SigninMFA(ctx context.DnoteCtx, mfaToken, code string) (SigninResponse, error) {
+	payload := SigninMFAPayload{
+		MFAToken: mfaToken,
+		Code:     code,
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return SigninResponse{}, errors.Wrap(err, "marshaling payload")
+	}
+	res, err := doReq(ctx, "POST", "/v3/signin/mfa", string(b), nil)
+
+	if res != nil && res.StatusCode == http.StatusUnauthorized {
+		return SigninResponse{}, ErrInvalidMFACode
+	} else if res != nil && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed) {
+		return SigninResponse{}, ErrMFAUnsupported
+	} else if err != nil {
+		return SigninResponse{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp SigninResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return SigninResponse{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
 // Signout deletes a user session on the server side
 func Signout(ctx context.DnoteCtx, sessionKey string) error {
-	hc := http.Client{
-		// No need to follow redirect
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	hc := getHTTPClient(ctx, nil)
+	// No need to follow redirect
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
 
 	opts := requestOptions{
@@ -558,5 +842,8 @@ func Signout(ctx context.DnoteCtx, sessionKey string) error {
 		return errors.Wrap(err, "making http request")
 	}
 
+	// the session renewed to sign out is not to be saved
+	forgetSession()
+
 	return nil
 }
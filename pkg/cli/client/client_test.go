@@ -3,9 +3,13 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dnote/dnote/pkg/assert"
 	"github.com/dnote/dnote/pkg/cli/context"
@@ -139,3 +143,358 @@ func TestSignOut(t *testing.T) {
 		assert.Equal(t, errors.Cause(err), ErrContentTypeMismatch, "error cause mismatch")
 	})
 }
+
+func TestShouldRetry(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+
+	testCases := []struct {
+		method   string
+		status   int
+		err      error
+		expected bool
+	}{
+		{method: "GET", status: http.StatusOK, expected: false},
+		{method: "GET", status: http.StatusInternalServerError, expected: true},
+		{method: "GET", status: http.StatusBadGateway, expected: true},
+		{method: "GET", status: http.StatusServiceUnavailable, expected: true},
+		{method: "GET", status: http.StatusTooManyRequests, expected: true},
+		{method: "GET", status: http.StatusUnauthorized, expected: false},
+		{method: "PATCH", status: http.StatusUnprocessableEntity, expected: false},
+		{method: "POST", status: http.StatusInternalServerError, expected: false},
+		{method: "POST", status: http.StatusServiceUnavailable, expected: true},
+		{method: "GET", err: errors.Wrap(readErr, "making http request"), expected: true},
+		{method: "POST", err: errors.Wrap(readErr, "making http request"), expected: false},
+		{method: "POST", err: errors.Wrap(dialErr, "making http request"), expected: true},
+		{method: "GET", err: errors.New("invalid apiEndpoint"), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s %d %v", tc.method, tc.status, tc.err), func(t *testing.T) {
+			var res *http.Response
+			if tc.status != 0 {
+				res = &http.Response{StatusCode: tc.status}
+			}
+
+			assert.Equal(t, shouldRetry(tc.method, res, tc.err), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestGetRetryDelay(t *testing.T) {
+	for attempt := 0; attempt < 6; attempt++ {
+		d := getRetryDelay(attempt, nil)
+
+		max := baseRetryDelay << uint(attempt)
+		if max > maxRetryDelay {
+			max = maxRetryDelay
+		}
+		if d < max/2 || d > max {
+			t.Errorf("delay %s for attempt %d is out of range", d, attempt)
+		}
+	}
+
+	res := &http.Response{Header: http.Header{}}
+	res.Header.Set("Retry-After", "3")
+	assert.Equal(t, getRetryDelay(0, res), 3*time.Second, "Retry-After mismatch")
+
+	res.Header.Set("Retry-After", "3600")
+	assert.Equal(t, getRetryDelay(0, res), maxRetryDelay, "Retry-After should be capped")
+}
+
+func TestDoReq_retry(t *testing.T) {
+	sleep = func(time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	resetBudget := func(n int) {
+		budget.Lock()
+		budget.left = n
+		budget.Unlock()
+	}
+	defer resetBudget(retryBudget)
+
+	newServer := func(failures int, status int) (*httptest.Server, *int) {
+		var count int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			if count <= failures {
+				w.WriteHeader(status)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}))
+
+		return ts, &count
+	}
+
+	t.Run("recovers from server errors", func(t *testing.T) {
+		resetBudget(retryBudget)
+		ts, count := newServer(2, http.StatusBadGateway)
+		defer ts.Close()
+
+		_, err := doReq(context.DnoteCtx{APIEndpoint: ts.URL}, "GET", "/v3/sync/state", "", nil)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+		assert.Equal(t, *count, 3, "request count mismatch")
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		resetBudget(retryBudget)
+		ts, count := newServer(100, http.StatusServiceUnavailable)
+		defer ts.Close()
+
+		_, err := doReq(context.DnoteCtx{APIEndpoint: ts.URL}, "GET", "/v3/sync/state", "", nil)
+		if err == nil {
+			t.Error("expected an error")
+		}
+		assert.Equal(t, *count, maxAttempts, "request count mismatch")
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		resetBudget(retryBudget)
+		ts, count := newServer(100, http.StatusUnauthorized)
+		defer ts.Close()
+
+		_, err := doReq(context.DnoteCtx{APIEndpoint: ts.URL}, "GET", "/v3/sync/state", "", nil)
+		if err == nil {
+			t.Error("expected an error")
+		}
+		assert.Equal(t, *count, 1, "request count mismatch")
+	})
+
+	t.Run("stops when the budget runs out", func(t *testing.T) {
+		resetBudget(1)
+		ts, count := newServer(100, http.StatusServiceUnavailable)
+		defer ts.Close()
+
+		_, err := doReq(context.DnoteCtx{APIEndpoint: ts.URL}, "GET", "/v3/sync/state", "", nil)
+		if err == nil {
+			t.Error("expected an error")
+		}
+		assert.Equal(t, *count, 2, "request count mismatch")
+	})
+}
+
+func TestDoReq_requestID(t *testing.T) {
+	sleep = func(time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	budget.Lock()
+	budget.left = retryBudget
+	budget.Unlock()
+
+	var ids []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(requestIDHeader))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	_, err := doReq(context.DnoteCtx{APIEndpoint: ts.URL}, "GET", "/v3/sync/state", "", nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assert.Equal(t, len(ids), maxAttempts, "request count mismatch")
+	assert.NotEqual(t, ids[0], "", "request id is empty")
+	for _, id := range ids {
+		assert.Equal(t, id, ids[0], "request id changed between attempts")
+	}
+	assert.Equal(t, strings.Contains(err.Error(), fmt.Sprintf("request %s", ids[0])), true, "error does not include the request id")
+
+	firstID := ids[0]
+	ids = nil
+	if _, err := doReq(context.DnoteCtx{APIEndpoint: ts.URL}, "GET", "/v3/sync/state", "", nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	assert.NotEqual(t, ids[0], firstID, "request id is reused by another call")
+}
+
+func TestDoReq_errorCode(t *testing.T) {
+	testCases := []struct {
+		statusCode int
+		header     string
+		expected   ErrorCode
+	}{
+		{
+			statusCode: http.StatusUnauthorized,
+			header:     "auth_expired",
+			expected:   ErrorCodeAuthExpired,
+		},
+		{
+			statusCode: http.StatusBadRequest,
+			header:     "quota_exceeded",
+			expected:   ErrorCodeQuotaExceeded,
+		},
+		// the servers that do not send the header
+		{
+			statusCode: http.StatusConflict,
+			expected:   ErrorCodeConflict,
+		},
+		{
+			statusCode: http.StatusBadRequest,
+			expected:   ErrorCodeValidation,
+		},
+		{
+			statusCode: http.StatusNotFound,
+			expected:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("status %d header %s", tc.statusCode, tc.header), func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.header != "" {
+					w.Header().Set(errorCodeHeader, tc.header)
+				}
+
+				http.Error(w, "some error", tc.statusCode)
+			}))
+			defer ts.Close()
+
+			_, err := doReq(context.DnoteCtx{APIEndpoint: ts.URL}, "GET", "/v3/sync/state", "", nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			assert.Equal(t, GetErrorCode(errors.Wrap(err, "syncing")), tc.expected, "error code mismatch")
+			assert.Equal(t, GetErrorHint(err), errorHints[tc.expected], "hint mismatch")
+			assert.Equal(t, errors.Cause(err).Error(), fmt.Sprintf(`response %d "some error"`, tc.statusCode), "message mismatch")
+		})
+	}
+
+	assert.Equal(t, GetErrorCode(errors.New("some error")), ErrorCode(""), "error code mismatch for another error")
+}
+
+func TestGetServerAddr(t *testing.T) {
+	testCases := []struct {
+		endpoint string
+		expected string
+	}{
+		{endpoint: "https://api.getdnote.com", expected: "api.getdnote.com:443"},
+		{endpoint: "http://localhost/api", expected: "localhost:80"},
+		{endpoint: "http://127.0.0.1:3000/api", expected: "127.0.0.1:3000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			got, err := getServerAddr(tc.endpoint)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			assert.Equal(t, got, tc.expected, "address mismatch")
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if err := Probe(context.DnoteCtx{APIEndpoint: ts.URL + "/api"}); err != nil {
+		t.Errorf("expected the server to be reachable but got %s", err.Error())
+	}
+
+	ts.Close()
+
+	err := Probe(context.DnoteCtx{APIEndpoint: ts.URL + "/api"})
+	assert.Equal(t, IsOffline(err), true, "the closed server should be offline")
+}
+
+func TestDoReq_dialAddr(t *testing.T) {
+	var host string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	ctx := context.DnoteCtx{
+		APIEndpoint: "http://dnote.invalid/api",
+		APIDialAddr: ts.Listener.Addr().String(),
+	}
+
+	if _, err := doReq(ctx, "GET", "/v3/sync/state", "", nil); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+	assert.Equal(t, host, "dnote.invalid", "host mismatch")
+
+	if err := Probe(ctx); err != nil {
+		t.Errorf("expected the server to be reachable through the dial address but got %s", err.Error())
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected int
+		ok       bool
+	}{
+		{input: "500", expected: 500, ok: true},
+		{input: "256K", expected: 256 * 1024, ok: true},
+		{input: "2m", expected: 2 * 1024 * 1024, ok: true},
+		{input: "1GB/s", expected: 1024 * 1024 * 1024, ok: true},
+		{input: "fast", ok: false},
+		{input: "-1K", ok: false},
+		{input: "", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseBandwidth(tc.input)
+			assert.Equal(t, err == nil, tc.ok, "ok mismatch")
+			assert.Equal(t, got, tc.expected, "bandwidth mismatch")
+		})
+	}
+}
+
+func TestDoReq_throttle(t *testing.T) {
+	body := strings.Repeat("a", 8192)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	t.Run("requests", func(t *testing.T) {
+		ctx := context.DnoteCtx{APIEndpoint: ts.URL, Throttle: context.Throttle{MaxRPS: 20}}
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if _, err := doReq(ctx, "GET", "/v3/sync/state", "", nil); err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+		}
+
+		// the first request is made at once, and the others 50ms apart
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Errorf("expected the requests to be throttled but they took %s", elapsed)
+		}
+	})
+
+	t.Run("bandwidth", func(t *testing.T) {
+		ctx := context.DnoteCtx{APIEndpoint: ts.URL, Throttle: context.Throttle{MaxBandwidth: 4096}}
+
+		start := time.Now()
+		res, err := doReq(ctx, "GET", "/v3/sync/state", "", nil)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the body"))
+		}
+		res.Body.Close()
+
+		assert.Equal(t, string(b), body, "body mismatch")
+
+		// a second of transfer is allowed at once, and the rest takes another second
+		if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+			t.Errorf("expected the transfer to be throttled but it took %s", elapsed)
+		}
+	})
+}
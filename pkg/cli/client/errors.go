@@ -0,0 +1,111 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errorCodeHeader is the header of an error response carrying the code of the error
+const errorCodeHeader = "X-Error-Code"
+
+// ErrorCode identifies the kind of an error response from the server
+type ErrorCode string
+
+// The error codes that the server responds with
+const (
+	// ErrorCodeAuthExpired means that the session is missing, expired or revoked
+	ErrorCodeAuthExpired ErrorCode = "auth_expired"
+	// ErrorCodeQuotaExceeded means that the request would exceed a limit on the data of the user
+	ErrorCodeQuotaExceeded ErrorCode = "quota_exceeded"
+	// ErrorCodeConflict means that the request conflicts with the data on the server
+	ErrorCodeConflict ErrorCode = "conflict"
+	// ErrorCodeValidation means that the server rejected the data as invalid
+	ErrorCodeValidation ErrorCode = "validation"
+)
+
+// statusErrorCodes are the error codes of the responses from the servers that do not
+// send the error code header
+var statusErrorCodes = map[int]ErrorCode{
+	http.StatusUnauthorized:          ErrorCodeAuthExpired,
+	http.StatusRequestEntityTooLarge: ErrorCodeQuotaExceeded,
+	http.StatusInsufficientStorage:   ErrorCodeQuotaExceeded,
+	http.StatusConflict:              ErrorCodeConflict,
+	http.StatusBadRequest:            ErrorCodeValidation,
+	http.StatusUnprocessableEntity:   ErrorCodeValidation,
+}
+
+// errorHints tell the user how to resolve the errors with the given codes
+var errorHints = map[ErrorCode]string{
+	ErrorCodeAuthExpired:   "Your session has expired. Run `dnote login` to log in again.",
+	ErrorCodeQuotaExceeded: "Your account has reached a limit on its data. Remove some notes, or ask the operators of your server to raise the limit.",
+	ErrorCodeConflict:      "The server has conflicting data. Run `dnote sync --full` to reconcile the local notes with it, then try again.",
+	ErrorCodeValidation:    "The server rejected the data as invalid. Run `dnote doctor` to check the local notes for problems.",
+}
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int
+	// Code is empty if the kind of the error is unknown
+	Code    ErrorCode
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(`response %d "%s"`, e.StatusCode, e.Message)
+}
+
+// newError reads the error response
+func newError(res *http.Response) error {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrapf(err, "server responded with %d but client could not read the response body", res.StatusCode)
+	}
+
+	code := ErrorCode(res.Header.Get(errorCodeHeader))
+	if code == "" {
+		code = statusErrorCodes[res.StatusCode]
+	}
+
+	return &Error{
+		StatusCode: res.StatusCode,
+		Code:       code,
+		Message:    strings.TrimRight(string(body), "\n"),
+	}
+}
+
+// GetErrorCode returns the code of the error response from the server that caused the
+// error, or an empty string if the error was not caused by an error response
+func GetErrorCode(err error) ErrorCode {
+	if e, ok := errors.Cause(err).(*Error); ok {
+		return e.Code
+	}
+
+	return ""
+}
+
+// GetErrorHint returns how to resolve the error, or an empty string if there is no advice
+func GetErrorHint(err error) string {
+	return errorHints[GetErrorCode(err)]
+}
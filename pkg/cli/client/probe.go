@@ -0,0 +1,95 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// ErrOffline is an error for when the server cannot be reached over the network
+var ErrOffline = errors.New("the server cannot be reached. Check your network connection")
+
+const (
+	// probeTimeout is how long the connectivity probe waits for a connection
+	probeTimeout = 3 * time.Second
+	// dialTimeout is how long a request waits for a connection
+	dialTimeout = 10 * time.Second
+)
+
+// getServerAddr returns the host and port to connect to for the API endpoint, which
+// is the proxy if one is configured in the environment
+func getServerAddr(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing the endpoint")
+	}
+
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u})
+	if err != nil {
+		return "", errors.Wrap(err, "getting the proxy")
+	}
+	if proxy != nil {
+		u = proxy
+	}
+
+	port := u.Port()
+	if port == "" {
+		if u.Scheme == "http" {
+			port = "80"
+		} else {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// Probe checks that a connection can be made to the server, failing quickly with
+// ErrOffline if it cannot, rather than waiting for the requests to time out
+func Probe(ctx context.DnoteCtx) error {
+	addr := ctx.APIDialAddr
+	if addr == "" {
+		var err error
+		addr, err = getServerAddr(ctx.APIEndpoint)
+		if err != nil {
+			return errors.Wrap(err, "getting the server address")
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, probeTimeout)
+	if err != nil {
+		log.Debug("probing %s: %s\n", addr, err.Error())
+		return ErrOffline
+	}
+	conn.Close()
+
+	return nil
+}
+
+// IsOffline returns true if the error is due to the server being unreachable
+func IsOffline(err error) bool {
+	return errors.Cause(err) == ErrOffline || isDialError(err)
+}
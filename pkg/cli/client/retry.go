@@ -0,0 +1,140 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxAttempts is the maximum number of times a request is made
+	maxAttempts = 4
+	// baseRetryDelay is the delay before the first retry. It doubles with each retry.
+	baseRetryDelay = 500 * time.Millisecond
+	// maxRetryDelay is the maximum delay before a retry
+	maxRetryDelay = 8 * time.Second
+	// retryBudget is the maximum number of retries in a process, so that a command
+	// making many requests to a failing server gives up early
+	retryBudget = 10
+)
+
+// sleep pauses before a retry. It is replaced in tests.
+var sleep = time.Sleep
+
+// budget is the number of retries left in this process
+var budget = struct {
+	sync.Mutex
+	left int
+}{left: retryBudget}
+
+// takeRetryBudget uses up one retry from the budget. It returns false if the budget
+// has run out.
+func takeRetryBudget() bool {
+	budget.Lock()
+	defer budget.Unlock()
+
+	if budget.left <= 0 {
+		return false
+	}
+
+	budget.left--
+	return true
+}
+
+// isIdempotent returns true if making the request with the given method more than once
+// has the same effect as making it once
+func isIdempotent(method string) bool {
+	return method != http.MethodPost
+}
+
+// isDialError returns true if the error occurred while connecting to the server,
+// in which case the request has not been sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial"
+	}
+
+	return false
+}
+
+// isNetworkError returns true if the error is a failure of the network, such as
+// a timeout or a reset connection, rather than a problem with the request
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// shouldRetry returns true if the request can be retried after the given response or
+// error. Timeouts and server errors are retried, but client errors such as 401 and 422
+// are not. A request that is not idempotent is retried only if the server did not
+// process it.
+func shouldRetry(method string, res *http.Response, err error) bool {
+	if res == nil {
+		if err == nil {
+			return false
+		}
+		if isDialError(err) {
+			return true
+		}
+
+		return isIdempotent(method) && isNetworkError(err)
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return isIdempotent(method)
+	}
+
+	return false
+}
+
+// getRetryDelay returns how long to wait before the retry following the given attempt,
+// which is zero-based. The delay grows exponentially with a random jitter, unless the
+// server asks for a delay with the Retry-After header.
+func getRetryDelay(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			d := time.Duration(secs) * time.Second
+			if d > maxRetryDelay {
+				return maxRetryDelay
+			}
+
+			return d
+		}
+	}
+
+	d := baseRetryDelay << uint(attempt)
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+
+	// use a half of the delay plus a random jitter so that the clients do not retry in unison
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
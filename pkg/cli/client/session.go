@@ -0,0 +1,185 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// ErrRefreshFailed is an error for a refresh token that the server did not accept
+var ErrRefreshFailed = errors.New("the session could not be renewed")
+
+// session is the session renewed during this run. The context is passed by value, so
+// the expired key in it is replaced by the renewed one on every request, until the
+// renewed session is saved by SaveSession.
+var session = struct {
+	sync.Mutex
+	// expired are the keys that have been renewed
+	expired map[string]bool
+	current SigninResponse
+	saved   bool
+}{
+	expired: map[string]bool{},
+}
+
+// getSessionKey returns the key to make the requests with in place of the given one
+func getSessionKey(key string) string {
+	session.Lock()
+	defer session.Unlock()
+
+	if session.expired[key] {
+		return session.current.Key
+	}
+
+	return key
+}
+
+// RefreshPayload is a payload for /v3/refresh
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh exchanges the refresh token for a new session
+func Refresh(ctx context.DnoteCtx, refreshToken string) (SigninResponse, error) {
+	b, err := json.Marshal(RefreshPayload{RefreshToken: refreshToken})
+	if err != nil {
+		return SigninResponse{}, errors.Wrap(err, "marshaling payload")
+	}
+
+	// the expired session is not sent
+	ctx.SessionKey = ""
+	res, err := doReq(ctx, "POST", "/v3/refresh", string(b), nil)
+
+	if res != nil && res.StatusCode == http.StatusUnauthorized {
+		return SigninResponse{}, ErrRefreshFailed
+	} else if err != nil {
+		return SigninResponse{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp SigninResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return SigninResponse{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+// refreshSession renews the expired session in the context and returns the new key. The
+// session is renewed only once however many requests find it expired at the same time.
+func refreshSession(ctx context.DnoteCtx) (string, error) {
+	session.Lock()
+	defer session.Unlock()
+
+	if session.expired[ctx.SessionKey] {
+		return session.current.Key, nil
+	}
+
+	// the refresh token may have been rotated by an earlier renewal
+	refreshToken := ctx.RefreshToken
+	if session.current.RefreshToken != "" {
+		refreshToken = session.current.RefreshToken
+	}
+
+	log.Debug("renewing the expired session\n")
+
+	resp, err := Refresh(ctx, refreshToken)
+	if err != nil {
+		return "", err
+	}
+	if resp.RefreshToken == "" {
+		resp.RefreshToken = refreshToken
+	}
+
+	session.expired[ctx.SessionKey] = true
+	if session.current.Key != "" {
+		session.expired[session.current.Key] = true
+	}
+	session.current = resp
+	session.saved = false
+
+	return resp.Key, nil
+}
+
+// forgetSession drops the session renewed during this run
+func forgetSession() {
+	session.Lock()
+	defer session.Unlock()
+
+	session.expired = map[string]bool{}
+	session.current = SigninResponse{}
+	session.saved = false
+}
+
+// SaveSession saves the session renewed during this run, if any. It is to be called
+// when no transaction is open on the database, as the requests are made in one.
+func SaveSession(db *database.DB) error {
+	session.Lock()
+	defer session.Unlock()
+
+	if session.current.Key == "" || session.saved {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := SaveSessionTx(tx, session.current); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	session.saved = true
+
+	return nil
+}
+
+// SaveSessionTx saves the given session in the system table
+func SaveSessionTx(tx *database.DB, s SigninResponse) error {
+	if err := database.UpsertSystem(tx, consts.SystemSessionKey, s.Key); err != nil {
+		return errors.Wrap(err, "saving session key")
+	}
+	if err := database.UpsertSystem(tx, consts.SystemSessionKeyExpiry, strconv.FormatInt(s.ExpiresAt, 10)); err != nil {
+		return errors.Wrap(err, "saving session key expiry")
+	}
+
+	if s.RefreshToken != "" {
+		if err := database.UpsertSystem(tx, consts.SystemRefreshToken, s.RefreshToken); err != nil {
+			return errors.Wrap(err, "saving refresh token")
+		}
+	} else if err := database.DeleteSystem(tx, consts.SystemRefreshToken); err != nil {
+		return errors.Wrap(err, "deleting refresh token")
+	}
+
+	return nil
+}
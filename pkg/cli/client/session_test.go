@@ -0,0 +1,157 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../tmp",
+	Cache:  "../tmp",
+	Config: "../tmp",
+	Data:   "../tmp",
+}
+
+// startSessionTestServer starts a test server accepting only the session 'new-key', which
+// the refresh token 'refresh-token' renews
+func startSessionTestServer(t *testing.T, refreshes *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/refresh":
+			*refreshes++
+
+			var payload RefreshPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload in the test server"))
+			}
+			if r.Header.Get("Authorization") != "" {
+				t.Error("the expired session should not be sent")
+			}
+			if payload.RefreshToken != "refresh-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"key": "new-key", "expires_at": 1596439890, "refresh_token": "new-refresh-token"}`))
+		case "/v3/sync/state":
+			if r.Header.Get("Authorization") != "Bearer new-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"max_usn": 3}`))
+		default:
+			t.Fatalf("unrecognized endpoint reached Method: %s URL: %s", r.Method, r.URL.String())
+		}
+	}))
+}
+
+func TestDoAuthorizedReq_refresh(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	defer forgetSession()
+
+	var refreshes int
+	ts := startSessionTestServer(t, &refreshes)
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+	ctx.SessionKey = "old-key"
+	ctx.RefreshToken = "refresh-token"
+
+	// execute
+	for i := 0; i < 2; i++ {
+		resp, err := GetSyncState(ctx)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+		assert.Equal(t, resp.MaxUSN, 3, "max usn mismatch")
+	}
+
+	if err := SaveSession(ctx.DB); err != nil {
+		t.Fatal(errors.Wrap(err, "saving the session"))
+	}
+
+	// test
+	assert.Equal(t, refreshes, 1, "the session should be renewed once")
+
+	var key, expiry, refreshToken string
+	database.MustScan(t, "getting session key", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSessionKey), &key)
+	database.MustScan(t, "getting session key expiry", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSessionKeyExpiry), &expiry)
+	database.MustScan(t, "getting refresh token", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemRefreshToken), &refreshToken)
+	assert.Equal(t, key, "new-key", "session key mismatch")
+	assert.Equal(t, expiry, "1596439890", "session key expiry mismatch")
+	assert.Equal(t, refreshToken, "new-refresh-token", "refresh token mismatch")
+}
+
+func TestDoAuthorizedReq_refresh_failure(t *testing.T) {
+	testCases := []struct {
+		name              string
+		refreshToken      string
+		expectedRefreshes int
+	}{
+		{name: "revoked refresh token", refreshToken: "revoked-token", expectedRefreshes: 1},
+		{name: "no refresh token", refreshToken: "", expectedRefreshes: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+			defer forgetSession()
+
+			var refreshes int
+			ts := startSessionTestServer(t, &refreshes)
+			defer ts.Close()
+
+			ctx.APIEndpoint = ts.URL
+			ctx.SessionKey = "old-key"
+			ctx.RefreshToken = tc.refreshToken
+
+			// execute
+			_, err := GetSyncState(ctx)
+
+			// test
+			assert.Equal(t, GetErrorCode(err), ErrorCodeAuthExpired, "error code mismatch")
+			assert.Equal(t, refreshes, tc.expectedRefreshes, "refreshes mismatch")
+
+			if err := SaveSession(ctx.DB); err != nil {
+				t.Fatal(errors.Wrap(err, "saving the session"))
+			}
+
+			var count int
+			database.MustScan(t, "counting session keys", ctx.DB.QueryRow("SELECT count(*) FROM system WHERE key = ?", consts.SystemSessionKey), &count)
+			assert.Equal(t, count, 0, "no session should be saved")
+		})
+	}
+}
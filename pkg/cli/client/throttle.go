@@ -0,0 +1,169 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	stdcontext "context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// limiters are the rate limiters for the throttle settings in use. They are shared by
+// all requests in a process, so that the limits apply across the requests.
+var limiters = struct {
+	sync.Mutex
+	settings  context.Throttle
+	requests  *rate.Limiter
+	bandwidth *rate.Limiter
+}{}
+
+// getLimiters returns the limiters for the requests and the bytes transferred under the
+// given settings. A limiter is nil if there is no limit.
+func getLimiters(t context.Throttle) (*rate.Limiter, *rate.Limiter) {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	if t != limiters.settings {
+		limiters.settings = t
+		limiters.requests = nil
+		limiters.bandwidth = nil
+
+		if t.MaxRPS > 0 {
+			limiters.requests = rate.NewLimiter(rate.Limit(t.MaxRPS), 1)
+		}
+		if t.MaxBandwidth > 0 {
+			// allow a second of transfer at once
+			limiters.bandwidth = rate.NewLimiter(rate.Limit(t.MaxBandwidth), t.MaxBandwidth)
+		}
+	}
+
+	return limiters.requests, limiters.bandwidth
+}
+
+// waitRequest blocks until a request can be made under the throttle settings
+func waitRequest(ctx context.DnoteCtx) error {
+	l, _ := getLimiters(ctx.Throttle)
+	if l == nil {
+		return nil
+	}
+
+	return l.Wait(stdcontext.Background())
+}
+
+// dialFunc connects to the given address
+type dialFunc func(c stdcontext.Context, network, addr string) (net.Conn, error)
+
+// throttleDial wraps the dial so that the connections do not transfer faster than the
+// bandwidth in the throttle settings
+func throttleDial(ctx context.DnoteCtx, dial dialFunc) dialFunc {
+	_, l := getLimiters(ctx.Throttle)
+	if l == nil {
+		return dial
+	}
+
+	return func(c stdcontext.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(c, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &throttledConn{Conn: conn, limiter: l}, nil
+	}
+}
+
+// throttledConn is a connection whose reads and writes wait for the bandwidth limiter
+type throttledConn struct {
+	net.Conn
+	limiter *rate.Limiter
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if burst := c.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if e := c.limiter.WaitN(stdcontext.Background(), n); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	var written int
+
+	for len(p) > 0 {
+		chunk := p
+		if burst := c.limiter.Burst(); len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+
+		if err := c.limiter.WaitN(stdcontext.Background(), len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// ParseBandwidth parses a bandwidth in bytes per second, such as '500', '256K' or '2M'.
+// The suffixes are in the powers of 1024.
+func ParseBandwidth(s string) (int, error) {
+	val := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S")
+	val = strings.TrimSuffix(val, "B")
+
+	multiplier := 1
+	if n := len(val); n > 0 {
+		switch val[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			val = val[:n-1]
+		}
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("'%s' is not a bandwidth such as 500K or 2M", s)
+	}
+
+	return n * multiplier, nil
+}
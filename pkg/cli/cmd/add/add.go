@@ -20,8 +20,13 @@ package add
 
 import (
 	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/dnote/dnote/pkg/cli/completion"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/infra"
@@ -36,18 +41,72 @@ import (
 )
 
 var contentFlag string
+var fileFlag string
+var titleFlag string
+var languageFlag string
+var typeFlag string
+var sourceFlag string
+var pageFlag int
+var anchorFlag string
 
 var example = `
  * Open an editor to write content
  dnote add git
 
  * Skip the editor by providing content directly
- dnote add git -c "time is a part of the commit hash"`
+ dnote add git -c "time is a part of the commit hash"
+
+ * Read the content from the standard input
+ cat notes.md | dnote add git
+
+ * Read the content from a file
+ dnote add git -f notes.md
+
+ * Give the note a title
+ dnote add git --title "Amending commits" -c "git commit --amend"
+
+ * Specify the language of the note
+ dnote add french -l fr -c "bonjour"
+
+ * Add a code note
+ dnote add go -t code -c "func main() {}"
+
+ * Add a note clipped from the page 12 of a PDF
+ dnote add rust --source ~/books/rust.pdf --page 12 -c "ownership rules"
+
+ * Add a note clipped from a section of a web page
+ dnote add go --source https://go.dev/doc/effective_go --anchor slices -c "slices wrap arrays"
+
+ * Pick the book from the suggestions based on the similar notes
+ dnote add -c "git rebase --onto main topic"`
 
 func preRun(cmd *cobra.Command, args []string) error {
-	if len(args) != 1 {
+	if len(args) > 1 {
 		return errors.New("Incorrect number of argument")
 	}
+	if contentFlag != "" && fileFlag != "" {
+		return errors.New("--content and --file cannot be used together")
+	}
+	if sourceFlag == "" && (pageFlag != 0 || anchorFlag != "") {
+		return errors.New("--page and --anchor require --source")
+	}
+	if pageFlag < 0 {
+		return errors.New("--page must be a positive number")
+	}
+	if err := validate.NoteTitle(titleFlag); err != nil {
+		return errors.Wrap(err, "invalid title")
+	}
+
+	if languageFlag != "" {
+		if err := validate.Language(languageFlag); err != nil {
+			return errors.Wrap(err, "invalid language")
+		}
+	}
+	if typeFlag != "" {
+		if err := validate.ContentType(typeFlag); err != nil {
+			return errors.Wrap(err, "invalid type")
+		}
+	}
 
 	return nil
 }
@@ -55,28 +114,76 @@ func preRun(cmd *cobra.Command, args []string) error {
 // NewCmd returns a new add command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "add <book>",
-		Short:   "Add a new note",
-		Aliases: []string{"a", "n", "new"},
-		Example: example,
-		PreRunE: preRun,
-		RunE:    newRun(ctx),
+		Use:               "add [book]",
+		Short:             "Add a new note",
+		Aliases:           []string{"a", "n", "new"},
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
 	}
 
 	f := cmd.Flags()
 	f.StringVarP(&contentFlag, "content", "c", "", "The new content for the note")
+	f.StringVarP(&fileFlag, "file", "f", "", "The path to a file to read the content from, or '-' for the standard input")
+	f.StringVarP(&titleFlag, "title", "", "", "The title of the note. Defaults to the first line of the content")
+	f.StringVarP(&languageFlag, "language", "l", "", "The language of the note, such as 'en' or 'en-US'")
+	f.StringVarP(&typeFlag, "type", "t", "", "The content type of the note: markdown, plaintext or code. Defaults to markdown")
+	f.StringVarP(&sourceFlag, "source", "", "", "The URL or the path of the document the note is clipped from")
+	f.IntVarP(&pageFlag, "page", "", 0, "The page of the source the note is clipped from")
+	f.StringVarP(&anchorFlag, "anchor", "", "", "The URL fragment of the location in the source the note is clipped from")
 
 	return cmd
 }
 
-func getContent(ctx context.DnoteCtx) (string, error) {
+// getSource returns the source of the note from the flags. A local path is made
+// absolute, so that the source can be opened from any directory.
+func getSource() (database.NoteSource, error) {
+	ret := database.NoteSource{
+		URL:      sourceFlag,
+		Page:     pageFlag,
+		Fragment: strings.TrimPrefix(anchorFlag, "#"),
+	}
+
+	if ret.URL != "" && !strings.Contains(ret.URL, "://") {
+		p, err := filepath.Abs(ret.URL)
+		if err != nil {
+			return ret, errors.Wrapf(err, "getting the absolute path of %s", ret.URL)
+		}
+
+		ret.URL = p
+	}
+
+	return ret, nil
+}
+
+// getContent returns the content from the flags, from the standard input if it is
+// piped, or from the editor otherwise
+func getContent(ctx context.DnoteCtx, stdin *os.File) (string, error) {
 	if contentFlag != "" {
 		return contentFlag, nil
 	}
 
-	fpath, err := ui.GetTmpContentPath(ctx)
+	if fileFlag == "-" || (fileFlag == "" && ui.IsPiped(stdin)) {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", errors.Wrap(err, "reading the standard input")
+		}
+
+		return string(b), nil
+	}
+	if fileFlag != "" {
+		b, err := ioutil.ReadFile(fileFlag)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading %s", fileFlag)
+		}
+
+		return string(b), nil
+	}
+
+	fpath, err := ui.CreateTmpContentFile(ctx, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "getting temporarily content file path")
+		return "", errors.Wrap(err, "preparing tmp content file")
 	}
 
 	c, err := ui.GetEditorInput(ctx, fpath)
@@ -89,28 +196,58 @@ func getContent(ctx context.DnoteCtx) (string, error) {
 
 func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
-		bookName := args[0]
-		if err := validate.BookName(bookName); err != nil {
-			return errors.Wrap(err, "invalid book name")
+		var bookName string
+		if len(args) == 1 {
+			if err := validate.BookName(args[0]); err != nil {
+				return errors.Wrap(err, "invalid book name")
+			}
+
+			label, err := database.ResolveBookLabel(ctx.DB, args[0], ctx.CaseSensitiveBooks)
+			if err != nil {
+				return errors.Wrap(err, "resolving the book")
+			}
+			bookName = label
 		}
 
-		content, err := getContent(ctx)
+		content, err := getContent(ctx, os.Stdin)
 		if err != nil {
 			return errors.Wrap(err, "getting content")
 		}
-		if content == "" {
+		if strings.TrimSpace(content) == "" {
 			return errors.New("Empty content")
 		}
 
+		// without a book, suggest the books of the similar notes
+		if bookName == "" {
+			bookName, err = pickSuggestedBook(ctx, content)
+			if err == errCancelled {
+				log.Warnf("cancelled. The note was not added\n")
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		source, err := getSource()
+		if err != nil {
+			return errors.Wrap(err, "getting the source")
+		}
+
 		ts := time.Now().UnixNano()
-		noteRowID, err := writeNote(ctx, bookName, content, ts)
+		noteRowID, err := WriteNote(ctx, bookName, titleFlag, content, languageFlag, typeFlag, ts)
 		if err != nil {
 			return errors.Wrap(err, "Failed to write note")
 		}
 
+		db := ctx.DB
+		if sourceFlag != "" {
+			if err := database.UpdateNoteSource(db, noteRowID, source); err != nil {
+				return errors.Wrap(err, "setting the source")
+			}
+		}
+
 		log.Successf("added to %s\n", bookName)
 
-		db := ctx.DB
 		info, err := database.GetNoteInfo(db, noteRowID)
 		if err != nil {
 			return err
@@ -126,7 +263,10 @@ func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 	}
 }
 
-func writeNote(ctx context.DnoteCtx, bookLabel string, content string, ts int64) (int, error) {
+// WriteNote adds a note with the given content to the book with the given label, creating
+// the book if it does not exist. An empty title is inferred from the content, and an empty
+// language or content type leaves the default. It returns the rowid of the note.
+func WriteNote(ctx context.DnoteCtx, bookLabel string, title, content, language, contentType string, ts int64) (int, error) {
 	tx, err := ctx.DB.Begin()
 	if err != nil {
 		return 0, errors.Wrap(err, "beginning a transaction")
@@ -155,7 +295,11 @@ func writeNote(ctx context.DnoteCtx, bookLabel string, content string, ts int64)
 		return 0, errors.Wrap(err, "generating uuid")
 	}
 
-	n := database.NewNote(noteUUID, bookUUID, content, ts, 0, 0, false, false, true)
+	if title == "" {
+		title = database.InferTitle(content)
+	}
+
+	n := database.NewNote(noteUUID, bookUUID, title, content, ts, 0, 0, false, false, true)
 
 	err = n.Insert(tx)
 	if err != nil {
@@ -173,6 +317,19 @@ func writeNote(ctx context.DnoteCtx, bookLabel string, content string, ts int64)
 		return noteRowID, errors.Wrap(err, "getting the note rowid")
 	}
 
+	if language != "" {
+		if err := database.UpdateNoteLanguage(tx, noteRowID, language); err != nil {
+			tx.Rollback()
+			return noteRowID, errors.Wrap(err, "setting the language")
+		}
+	}
+	if contentType != "" {
+		if err := database.UpdateNoteContentType(tx, noteRowID, contentType); err != nil {
+			tx.Rollback()
+			return noteRowID, errors.Wrap(err, "setting the content type")
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		tx.Rollback()
@@ -0,0 +1,158 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package add
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+)
+
+const (
+	// suggestionCount is the number of the books suggested for a note
+	suggestionCount = 3
+	// maxSuggestionTerms is the maximum number of the terms of a note that are searched
+	// for the similar notes
+	maxSuggestionTerms = 32
+	// maxSimilarNotes is the number of the most similar notes whose books are suggested
+	maxSimilarNotes = 50
+)
+
+// getSuggestionQuery returns a full text search query matching the notes that share any
+// of the words of the given content. The words shorter than three characters are left
+// out as they are rarely telling of the topic.
+func getSuggestionQuery(content string) string {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := map[string]bool{}
+	var terms []string
+	for _, w := range words {
+		if len([]rune(w)) < 3 || seen[w] {
+			continue
+		}
+
+		seen[w] = true
+		terms = append(terms, fmt.Sprintf("\"%s\"", w))
+		if len(terms) == maxSuggestionTerms {
+			break
+		}
+	}
+
+	return strings.Join(terms, " OR ")
+}
+
+// suggestBooks returns the labels of the books that a note with the given content most
+// likely belongs to, best first. A book scores higher the more of its notes are similar
+// to the content, and the more similar they are.
+func suggestBooks(db *database.DB, content string) ([]string, error) {
+	query := getSuggestionQuery(content)
+	if query == "" {
+		return []string{}, nil
+	}
+
+	rows, err := db.Query(`SELECT books.label, bm25(note_fts)
+		FROM note_fts
+		INNER JOIN notes ON notes.rowid = note_fts.rowid
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE note_fts MATCH ? AND notes.deleted = ? AND books.deleted = ?
+		ORDER BY rank
+		LIMIT ?`, query, false, false, maxSimilarNotes)
+	if err != nil {
+		return nil, errors.Wrap(err, "searching the similar notes")
+	}
+	defer rows.Close()
+
+	scores := map[string]float64{}
+	for rows.Next() {
+		var label string
+		var score float64
+		if err := rows.Scan(&label, &score); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		// bm25 scores are negative, and the lower the better
+		scores[label] -= score
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "iterating the similar notes")
+	}
+
+	ret := []string{}
+	for label := range scores {
+		ret = append(ret, label)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if scores[ret[i]] != scores[ret[j]] {
+			return scores[ret[i]] > scores[ret[j]]
+		}
+
+		return ret[i] < ret[j]
+	})
+
+	if len(ret) > suggestionCount {
+		ret = ret[:suggestionCount]
+	}
+
+	return ret, nil
+}
+
+// errCancelled is an error for when the user picks none of the suggested books
+var errCancelled = errors.New("cancelled")
+
+// pickSuggestedBook suggests the books for a note with the given content, and returns
+// the one the user picks with a single keypress
+func pickSuggestedBook(ctx context.DnoteCtx, content string) (string, error) {
+	labels, err := suggestBooks(ctx.DB, content)
+	if err != nil {
+		return "", errors.Wrap(err, "suggesting the books")
+	}
+	if len(labels) == 0 {
+		return "", errors.New("no book is similar to the note. Give the book with 'dnote add <book>'")
+	}
+
+	log.Infof("suggested books:\n")
+	for i, label := range labels {
+		log.Plainf("  %s %s\n", log.ColorYellow.Sprintf("(%d)", i+1), label)
+	}
+
+	key, err := ui.PromptKey(fmt.Sprintf("add to which book? (1-%d, enter for %s, any other key to cancel)", len(labels), labels[0]))
+	if err == ui.ErrNotTerminal {
+		return "", errors.Errorf("no book is given, and the suggestions cannot be confirmed without a terminal. Give the book with 'dnote add <book>'. The suggested books are: %s", strings.Join(labels, ", "))
+	} else if err != nil {
+		return "", errors.Wrap(err, "getting the choice")
+	}
+
+	if key == '\r' || key == '\n' {
+		return labels[0], nil
+	}
+	if idx := int(key - '1'); idx >= 0 && idx < len(labels) {
+		return labels[idx], nil
+	}
+
+	return "", errCancelled
+}
@@ -0,0 +1,103 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package add
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestGetSuggestionQuery(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected string
+	}{
+		{
+			content:  "git rebase --onto main topic",
+			expected: `"git" OR "rebase" OR "onto" OR "main" OR "topic"`,
+		},
+		{
+			// short and repeated words are left out
+			content:  "a Go map is a hash map",
+			expected: `"map" OR "hash"`,
+		},
+		{
+			content:  `say "hi" to 'me'`,
+			expected: `"say"`,
+		},
+		{
+			content:  "a b",
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.content, func(t *testing.T) {
+			assert.Equal(t, getSuggestionQuery(tc.content), tc.expected, "query mismatch")
+		})
+	}
+}
+
+func TestSuggestBooks(t *testing.T) {
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "git")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "js")
+	database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b3-uuid", "go")
+	database.MustExec(t, "inserting b4", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b4-uuid", "css")
+	database.MustExec(t, "inserting b5", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b5-uuid", "rust")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "git rebase rewrites the commits of a branch", 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "git commit --amend changes the last commit", 2)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n3-uuid", "b2-uuid", "promises chain the callbacks", 3)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n4-uuid", "b3-uuid", "a branch of a select statement", 4)
+	database.MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n5-uuid", "b4-uuid", "a commit of the grid layout", 5)
+	database.MustExec(t, "inserting n6", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", "n6-uuid", "b5-uuid", "commit commit commit", 6, true)
+
+	t.Run("similar", func(t *testing.T) {
+		labels, err := suggestBooks(db, "squash the commits on a branch with git rebase")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "suggesting the books"))
+		}
+
+		assert.Equal(t, len(labels), 3, "label count mismatch")
+		assert.Equal(t, labels[0], "git", "first suggestion mismatch")
+	})
+
+	t.Run("nothing similar", func(t *testing.T) {
+		labels, err := suggestBooks(db, "flexbox alignment")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "suggesting the books"))
+		}
+
+		assert.DeepEqual(t, labels, []string{}, "labels mismatch")
+	})
+}
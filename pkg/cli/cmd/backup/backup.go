@@ -0,0 +1,131 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"github.com/dnote/dnote/pkg/cli/backup"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var toFlag string
+var encryptFlag string
+var recipientsFlag []string
+var keepFlag int
+
+var example = `
+ * Back up the database to an S3 bucket, encrypted for an age recipient
+ dnote backup --to s3://my-bucket/dnote --encrypt age -r age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+
+ * Back up the database to a WebDAV server over https, encrypted for a GPG key
+ dnote backup --to webdavs://dav.example.com/backups/dnote --encrypt gpg -r alice@example.com
+
+ * Back up the database and keep only the newest 7 snapshots
+ dnote backup --to s3://my-bucket/dnote --encrypt age -r age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p --keep 7
+
+ * List the local backups
+ dnote backup ls
+
+ * Restore the database from the newest snapshot
+ dnote backup restore --from s3://my-bucket/dnote --identity ~/.config/age/key.txt`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+	if toFlag == "" {
+		return errors.New("Please provide the backup location with --to")
+	}
+	if encryptFlag == "" {
+		return errors.New("Please provide the encryption with --encrypt, as the snapshots are always encrypted")
+	}
+	if len(recipientsFlag) == 0 {
+		return errors.New("Please provide at least one recipient with --recipient")
+	}
+	if keepFlag < 0 {
+		return errors.New("--keep must not be negative")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new backup command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "backup",
+		Short:   "Back up the database to S3 or WebDAV, and list or restore the backups",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&toFlag, "to", "", "", "The backup location: s3://bucket/path, webdav://host/path or webdavs://host/path")
+	f.StringVarP(&encryptFlag, "encrypt", "", "", "Encrypt the snapshot with a provider: age or gpg")
+	f.StringSliceVarP(&recipientsFlag, "recipient", "r", []string{}, "An age recipient, or a GPG key id or email, to encrypt the snapshot for. Can be given multiple times")
+	f.IntVarP(&keepFlag, "keep", "", 0, "Remove the snapshots but the newest ones of the given number. 0 keeps all")
+
+	cmd.AddCommand(newLsCmd(ctx))
+	cmd.AddCommand(newRestoreCmd(ctx))
+
+	return cmd
+}
+
+// getTarget returns the target at the given location, or the local backups if the
+// location is empty
+func getTarget(ctx context.DnoteCtx, location string) (backup.Target, error) {
+	if location == "" {
+		return backup.LocalTarget(ctx), nil
+	}
+
+	return backup.NewTarget(location)
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		t, err := backup.NewTarget(toFlag)
+		if err != nil {
+			return err
+		}
+		p, err := crypt.NewProvider(encryptFlag, recipientsFlag, nil)
+		if err != nil {
+			return err
+		}
+
+		name, err := backup.Create(ctx, t, p)
+		if err != nil {
+			return errors.Wrap(err, "backing up the database")
+		}
+		log.Successf("backed up the database to %s%s\n", t.String(), name)
+
+		removed, err := backup.Prune(t, keepFlag)
+		if err != nil {
+			return errors.Wrap(err, "removing the old snapshots")
+		}
+		if len(removed) > 0 {
+			log.Infof("removed %d old snapshots\n", len(removed))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"github.com/dnote/dnote/pkg/cli/backup"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var lsFromFlag string
+
+var lsExample = `
+ * List the local backups
+ dnote backup ls
+
+ * List the snapshots in S3
+ dnote backup ls --from s3://my-bucket/dnote`
+
+func lsPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newLsCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "ls",
+		Short:   "List the local backups or the snapshots in a location, newest first",
+		Example: lsExample,
+		PreRunE: lsPreRun,
+		RunE:    newLsRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&lsFromFlag, "from", "", "", "The backup location: s3://bucket/path, webdav://host/path or webdavs://host/path. Defaults to the local backups")
+
+	return cmd
+}
+
+func newLsRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		t, err := getTarget(ctx, lsFromFlag)
+		if err != nil {
+			return err
+		}
+
+		names, err := backup.Snapshots(t)
+		if err != nil {
+			return errors.Wrap(err, "listing the snapshots")
+		}
+
+		if len(names) == 0 {
+			log.Infof("no backups in %s\n", t.String())
+			return nil
+		}
+
+		for i := len(names) - 1; i >= 0; i-- {
+			takenAt, err := backup.SnapshotTime(names[i])
+			if err != nil {
+				return err
+			}
+
+			log.Printf("%s %s\n", names[i], log.ColorYellow.Sprintf("(%s)", takenAt.Local().Format("Jan 2, 2006 3:04pm (MST)")))
+		}
+
+		return nil
+	}
+}
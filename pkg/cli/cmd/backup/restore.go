@@ -0,0 +1,115 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package backup
+
+import (
+	"fmt"
+
+	"github.com/dnote/dnote/pkg/cli/backup"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var fromFlag string
+var identitiesFlag []string
+var yesFlag bool
+
+var restoreExample = `
+ * Restore the database from the newest local backup
+ dnote backup restore
+
+ * Restore the database from the local backup taken before a migration
+ dnote backup restore dnote-20200314T211500Z-migration.db
+
+ * Restore the database from the newest snapshot in S3
+ dnote backup restore --from s3://my-bucket/dnote --identity ~/.config/age/key.txt
+
+ * Restore the database from the given snapshot
+ dnote backup restore dnote-20200314T211500Z.db.gpg --from webdavs://dav.example.com/backups/dnote`
+
+func restorePreRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newRestoreCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore [snapshot name]",
+		Short:   "Replace the database with a local backup or a snapshot",
+		Example: restoreExample,
+		PreRunE: restorePreRun,
+		RunE:    newRestoreRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&fromFlag, "from", "", "", "The backup location: s3://bucket/path, webdav://host/path or webdavs://host/path. Defaults to the local backups")
+	f.StringSliceVarP(&identitiesFlag, "identity", "i", []string{}, "An age identity file to decrypt the snapshot with. Can be given multiple times")
+	f.BoolVarP(&yesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+func newRestoreRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		var name string
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		t, err := getTarget(ctx, fromFlag)
+		if err != nil {
+			return err
+		}
+
+		if !yesFlag {
+			snapshot := name
+			if snapshot == "" {
+				snapshot = "the newest snapshot"
+			}
+
+			question := fmt.Sprintf("replace the database with %s in %s? The changes since the snapshot will be lost", snapshot, t.String())
+			ok, err := ui.Confirm(question, false)
+			if err != nil {
+				return errors.Wrap(err, "getting confirmation")
+			}
+			if !ok {
+				log.Warnf("aborted by user\n")
+				return nil
+			}
+		}
+
+		restored, err := backup.Restore(ctx, t, name, identitiesFlag)
+		if err == backup.ErrNotFound {
+			return errors.Errorf("the snapshot %s was not found in %s", name, t.String())
+		} else if err != nil {
+			return errors.Wrap(err, "restoring the database")
+		}
+
+		log.Successf("restored the database from %s. The replaced database is kept in %s.before-restore\n", restored, ctx.DBPath)
+
+		return nil
+	}
+}
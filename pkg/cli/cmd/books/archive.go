@@ -0,0 +1,106 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var archiveExample = `
+ * Hide the book 'archive-2019' from 'dnote ls' and 'dnote find'
+ dnote books archive archive-2019
+
+ * List the archived books too
+ dnote ls --archived`
+
+var unarchiveExample = `
+ * Show the book 'archive-2019' in 'dnote ls' and 'dnote find' again
+ dnote books unarchive archive-2019`
+
+func archivePreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newArchiveCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "archive <book name>",
+		Short:             "Hide a book from the default listings without deleting it",
+		Example:           archiveExample,
+		PreRunE:           archivePreRun,
+		RunE:              newArchiveRun(ctx, true),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	return cmd
+}
+
+func newUnarchiveCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "unarchive <book name>",
+		Short:             "Show an archived book in the default listings again",
+		Example:           unarchiveExample,
+		PreRunE:           archivePreRun,
+		RunE:              newArchiveRun(ctx, false),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	return cmd
+}
+
+// setArchived archives or unarchives the book with the given name. Archiving is
+// local to this device and is not synced, so the book is not marked dirty.
+func setArchived(ctx context.DnoteCtx, name string, archived bool) error {
+	uuid, err := getBookUUID(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ctx.DB.Exec("UPDATE books SET archived = ? WHERE uuid = ?", archived, uuid); err != nil {
+		return errors.Wrap(err, "updating the book")
+	}
+
+	return nil
+}
+
+func newArchiveRun(ctx context.DnoteCtx, archived bool) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		if err := setArchived(ctx, name, archived); err != nil {
+			return err
+		}
+
+		if archived {
+			log.Successf("archived the book '%s'. Use --archived to list it\n", name)
+		} else {
+			log.Successf("unarchived the book '%s'\n", name)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewCmd returns a new books command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "books",
+		Aliases: []string{"b"},
+		Short:   "Manage books",
+	}
+
+	cmd.AddCommand(newArchiveCmd(ctx))
+	cmd.AddCommand(newDedupeCmd(ctx))
+	cmd.AddCommand(newMembersCmd(ctx))
+	cmd.AddCommand(newMergeCmd(ctx))
+	cmd.AddCommand(newRenameCmd(ctx))
+	cmd.AddCommand(newReorderCmd(ctx))
+	cmd.AddCommand(newSnapshotCmd(ctx))
+	cmd.AddCommand(newSortCmd(ctx))
+	cmd.AddCommand(newTokenizerCmd(ctx))
+	cmd.AddCommand(newUnarchiveCmd(ctx))
+
+	return cmd
+}
+
+// getBookUUID returns the uuid of the book with the given name
+func getBookUUID(ctx context.DnoteCtx, name string) (string, error) {
+	label, err := database.ResolveBookLabel(ctx.DB, name, ctx.CaseSensitiveBooks)
+	if err != nil {
+		return "", errors.Wrap(err, "resolving the book")
+	}
+
+	return database.GetBookUUID(ctx.DB, label)
+}
+
+// mergeBook moves all notes in the source book to the destination book, and deletes
+// the source book. Everything that changed is marked dirty so that the server converges.
+func mergeBook(ctx context.DnoteCtx, tx *database.DB, srcUUID, dstUUID string) error {
+	ts := ctx.Clock.Now().UnixNano()
+
+	if _, err := tx.Exec("UPDATE notes SET book_uuid = ?, edited_on = ?, dirty = ? WHERE book_uuid = ? AND deleted = ?", dstUUID, ts, true, srcUUID, false); err != nil {
+		return errors.Wrap(err, "moving notes")
+	}
+
+	// override the label with a random string
+	uniqLabel, err := utils.GenerateUUID()
+	if err != nil {
+		return errors.Wrap(err, "generating uuid to override with")
+	}
+
+	if _, err := tx.Exec("UPDATE books SET deleted = ?, dirty = ?, label = ? WHERE uuid = ?", true, true, uniqLabel, srcUUID); err != nil {
+		return errors.Wrap(err, "removing the book")
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestDedupe(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "JS", 1, false)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b2-uuid", "js", 2, false)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 3, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b2-uuid", "n2 body", 2, 4, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3 body", 3, 5, false)
+
+	candidates, err := getDedupeCandidates(db, []string{"JS", "js"})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting candidates"))
+	}
+
+	// execute
+	if err := dedupeGroup(ctx, candidates, 0); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.DeepEqual(t, candidates, []dedupeCandidate{
+		{UUID: "b2-uuid", Label: "js", NoteCount: 2},
+		{UUID: "b1-uuid", Label: "JS", NoteCount: 1},
+	}, "candidates mismatch")
+
+	var b1Label string
+	var b1Deleted, b1Dirty bool
+	database.MustScan(t, "getting b1", db.QueryRow("SELECT label, deleted, dirty FROM books WHERE uuid = ?", "b1-uuid"), &b1Label, &b1Deleted, &b1Dirty)
+	assert.NotEqual(t, b1Label, "JS", "b1 label mismatch")
+	assert.Equal(t, b1Deleted, true, "b1 deleted mismatch")
+	assert.Equal(t, b1Dirty, true, "b1 dirty mismatch")
+
+	var b2Deleted, b2Dirty bool
+	database.MustScan(t, "getting b2", db.QueryRow("SELECT deleted, dirty FROM books WHERE uuid = ?", "b2-uuid"), &b2Deleted, &b2Dirty)
+	assert.Equal(t, b2Deleted, false, "b2 deleted mismatch")
+	assert.Equal(t, b2Dirty, false, "b2 dirty mismatch")
+
+	var n1BookUUID string
+	var n1Dirty bool
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT book_uuid, dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1BookUUID, &n1Dirty)
+	assert.Equal(t, n1BookUUID, "b2-uuid", "n1 book_uuid mismatch")
+	assert.Equal(t, n1Dirty, true, "n1 dirty mismatch")
+
+	var n2Dirty bool
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2Dirty)
+	assert.Equal(t, n2Dirty, false, "n2 dirty mismatch")
+}
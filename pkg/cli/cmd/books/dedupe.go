@@ -0,0 +1,187 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var dedupeYesFlag bool
+
+var dedupeExample = `
+ * Merge books whose names differ only in case, such as 'JS' and 'js'
+ dnote books dedupe
+
+ * Merge them without prompts, keeping the name of the book with the most notes
+ dnote books dedupe -y`
+
+func newDedupeCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "dedupe",
+		Short:   "Merge books whose names differ only in case",
+		Example: dedupeExample,
+		RunE:    newDedupeRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&dedupeYesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+// dedupeCandidate is a book in a group of books whose labels differ only in case
+type dedupeCandidate struct {
+	UUID      string
+	Label     string
+	NoteCount int
+}
+
+// getDedupeCandidates returns the books with the given labels, ordered by the number
+// of notes in a descending order
+func getDedupeCandidates(db *database.DB, labels []string) ([]dedupeCandidate, error) {
+	ret := []dedupeCandidate{}
+
+	for _, label := range labels {
+		var c dedupeCandidate
+		err := db.QueryRow(`SELECT books.uuid, books.label, count(notes.uuid)
+			FROM books
+			LEFT JOIN notes ON notes.book_uuid = books.uuid AND notes.deleted = false
+			WHERE books.label = ?
+			GROUP BY books.uuid`, label).Scan(&c.UUID, &c.Label, &c.NoteCount)
+		if err != nil {
+			return nil, errors.Wrapf(err, "querying the book %s", label)
+		}
+
+		ret = append(ret, c)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].NoteCount > ret[j].NoteCount
+	})
+
+	return ret, nil
+}
+
+// promptTarget asks which of the candidates to merge the others into. It returns -1
+// if the user chooses to skip.
+func promptTarget(candidates []dedupeCandidate) (int, error) {
+	for idx, c := range candidates {
+		log.Plainf("  %d. %s %s\n", idx+1, c.Label, log.ColorYellow.Sprintf("(%d)", c.NoteCount))
+	}
+
+	if dedupeYesFlag {
+		return 0, nil
+	}
+
+	for {
+		var input string
+		if err := ui.PromptInput(fmt.Sprintf("merge into which book? (1-%d, s to skip) [1]", len(candidates)), &input); err != nil {
+			return 0, errors.Wrap(err, "getting user input")
+		}
+
+		if input == "" {
+			return 0, nil
+		}
+		if input == "s" {
+			return -1, nil
+		}
+
+		n, err := strconv.Atoi(input)
+		if err == nil && n >= 1 && n <= len(candidates) {
+			return n - 1, nil
+		}
+
+		log.Warnf("invalid choice '%s'\n", input)
+	}
+}
+
+func dedupeGroup(ctx context.DnoteCtx, candidates []dedupeCandidate, targetIdx int) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	target := candidates[targetIdx]
+	for idx, c := range candidates {
+		if idx == targetIdx {
+			continue
+		}
+
+		if err := mergeBook(ctx, tx, c.UUID, target.UUID); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "merging %s into %s", c.Label, target.Label)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func newDedupeRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		groups, err := database.GetBookLabelCollisions(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "finding books whose names differ only in case")
+		}
+
+		if len(groups) == 0 {
+			log.Success("no books to merge\n")
+			return nil
+		}
+
+		for _, labels := range groups {
+			candidates, err := getDedupeCandidates(ctx.DB, labels)
+			if err != nil {
+				return errors.Wrap(err, "getting the books")
+			}
+
+			log.Infof("these books have names that differ only in case:\n")
+			targetIdx, err := promptTarget(candidates)
+			if err != nil {
+				return errors.Wrap(err, "choosing the book to merge into")
+			}
+			if targetIdx == -1 {
+				log.Warnf("skipped\n")
+				continue
+			}
+
+			if err := dedupeGroup(ctx, candidates, targetIdx); err != nil {
+				return errors.Wrap(err, "merging books")
+			}
+
+			log.Successf("merged into %s\n", candidates[targetIdx].Label)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"database/sql"
+
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var membersExample = `
+ * List the users who can write to the book 'team'
+ dnote books members list team
+
+ * Let a user write to the book 'team'
+ dnote books members add team alice@example.com
+
+ * Stop a user from writing to the book 'team'
+ dnote books members remove team alice@example.com`
+
+func newMembersCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "members",
+		Short:   "Manage the users who can write to a team book",
+		Example: membersExample,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "list <book name>",
+		Short:             "List the owner and the members of a book",
+		Args:              cobra.ExactArgs(1),
+		RunE:              newMembersListRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:               "add <book name> <email>",
+		Short:             "Let a user write to a book",
+		Args:              cobra.ExactArgs(2),
+		RunE:              newMembersAddRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:               "remove <book name> <email>",
+		Short:             "Stop a user from writing to a book",
+		Args:              cobra.ExactArgs(2),
+		RunE:              newMembersRemoveRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	})
+
+	return cmd
+}
+
+// getSyncedBookUUID returns the uuid of the book with the given name, which must have been
+// uploaded to the server for its members to be managed
+func getSyncedBookUUID(ctx context.DnoteCtx, name string) (string, error) {
+	if ctx.SessionKey == "" {
+		return "", errors.New("not logged in")
+	}
+
+	uuid, err := getBookUUID(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	var usn int
+	err = ctx.DB.QueryRow("SELECT usn FROM books WHERE uuid = ?", uuid).Scan(&usn)
+	if err == sql.ErrNoRows {
+		return "", errors.Errorf("book '%s' not found", name)
+	} else if err != nil {
+		return "", errors.Wrap(err, "querying the book")
+	}
+	if usn == 0 {
+		return "", errors.Errorf("book '%s' has not been synced yet. Run `dnote sync` first", name)
+	}
+
+	return uuid, nil
+}
+
+func newMembersListRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		uuid, err := getSyncedBookUUID(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.GetBookMembers(ctx, uuid)
+		if err != nil {
+			return errors.Wrap(err, "getting the members")
+		}
+
+		if output.IsJSON() {
+			return output.JSON(resp.Members)
+		}
+
+		for _, m := range resp.Members {
+			if m.Owner {
+				log.Plainf("%s %s\n", m.Email, log.ColorGray.Sprint("(owner)"))
+			} else {
+				log.Plainf("%s\n", m.Email)
+			}
+		}
+
+		return nil
+	}
+}
+
+func newMembersAddRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name, email := args[0], args[1]
+
+		uuid, err := getSyncedBookUUID(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if err := client.AddBookMember(ctx, uuid, email); err != nil {
+			return errors.Wrap(err, "adding the member")
+		}
+
+		log.Successf("%s can now write to the book '%s'\n", email, name)
+		log.Infof("the book and its notes will be downloaded by %s on the next sync\n", email)
+
+		return nil
+	}
+}
+
+func newMembersRemoveRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name, email := args[0], args[1]
+
+		uuid, err := getSyncedBookUUID(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if err := client.RemoveBookMember(ctx, uuid, email); err != nil {
+			return errors.Wrap(err, "removing the member")
+		}
+
+		log.Successf("%s can no longer write to the book '%s'\n", email, name)
+
+		return nil
+	}
+}
@@ -0,0 +1,166 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"fmt"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var mergeYesFlag bool
+
+var mergeExample = `
+ * Move all notes in the book 'javascript' to 'js' and remove 'javascript'
+ dnote books merge javascript js
+
+ * Merge without a prompt
+ dnote books merge javascript js -y`
+
+func mergePreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newMergeCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "merge <source book> <destination book>",
+		Short:             "Move all notes in a book to another and remove it",
+		Example:           mergeExample,
+		PreRunE:           mergePreRun,
+		RunE:              newMergeRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 2),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&mergeYesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+// mergeSource is the information about the book to be merged into another
+type mergeSource struct {
+	UUID string
+	// NoteCount is the number of the notes to be moved
+	NoteCount int
+	// UnsyncedCount is the number of the notes to be moved that have never been uploaded
+	UnsyncedCount int
+	// Uploaded is true if the book has been uploaded
+	Uploaded bool
+}
+
+func getMergeSource(db *database.DB, uuid string) (mergeSource, error) {
+	ret := mergeSource{UUID: uuid}
+
+	var usn int
+	if err := db.QueryRow("SELECT usn FROM books WHERE uuid = ?", uuid).Scan(&usn); err != nil {
+		return ret, errors.Wrap(err, "getting the book")
+	}
+	ret.Uploaded = usn > 0
+
+	if err := db.QueryRow(`SELECT count(*), count(CASE WHEN usn = 0 THEN 1 END)
+		FROM notes WHERE book_uuid = ? AND deleted = ?`, uuid, false).Scan(&ret.NoteCount, &ret.UnsyncedCount); err != nil {
+		return ret, errors.Wrap(err, "counting the notes")
+	}
+
+	return ret, nil
+}
+
+// runMerge merges the book with the source uuid into the one with the destination uuid
+func runMerge(ctx context.DnoteCtx, srcUUID, dstUUID string) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := mergeBook(ctx, tx, srcUUID, dstUUID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func newMergeRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		srcName, dstName := args[0], args[1]
+
+		srcUUID, err := getBookUUID(ctx, srcName)
+		if err != nil {
+			return errors.Wrap(err, "finding the source book")
+		}
+		dstUUID, err := getBookUUID(ctx, dstName)
+		if err != nil {
+			return errors.Wrap(err, "finding the destination book")
+		}
+		if srcUUID == dstUUID {
+			return errors.New("cannot merge a book into itself")
+		}
+		if err := database.CheckBookOwner(ctx.DB, srcUUID); err != nil {
+			return err
+		}
+
+		src, err := getMergeSource(ctx.DB, srcUUID)
+		if err != nil {
+			return err
+		}
+
+		if src.UnsyncedCount > 0 {
+			log.Infof("%d of the notes have not been synced yet. They will be uploaded to '%s' on the next sync.\n", src.UnsyncedCount, dstName)
+		}
+		if !src.Uploaded {
+			log.Infof("'%s' has not been synced yet, so it will only be removed locally.\n", srcName)
+		}
+
+		if !mergeYesFlag {
+			question := fmt.Sprintf("move %d notes from '%s' to '%s' and remove '%s'?", src.NoteCount, srcName, dstName, srcName)
+			ok, err := ui.Confirm(question, false)
+			if err != nil {
+				return errors.Wrap(err, "getting confirmation")
+			}
+			if !ok {
+				log.Warnf("aborted by user\n")
+				return nil
+			}
+		}
+
+		if err := runMerge(ctx, srcUUID, dstUUID); err != nil {
+			return errors.Wrap(err, "merging the books")
+		}
+
+		log.Successf("merged '%s' into '%s'\n", srcName, dstName)
+
+		return nil
+	}
+}
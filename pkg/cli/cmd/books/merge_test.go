@@ -0,0 +1,73 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestMerge(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "javascript", 1, true)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b2-uuid", "js", 2, false)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 3, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 0, true)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "", 3, 4, true, true)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n4-uuid", "b2-uuid", "n4 body", 4, 5, false)
+
+	src, err := getMergeSource(db, "b1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the source"))
+	}
+	assert.DeepEqual(t, src, mergeSource{UUID: "b1-uuid", NoteCount: 2, UnsyncedCount: 1, Uploaded: true}, "source mismatch")
+
+	// execute
+	if err := runMerge(ctx, "b1-uuid", "b2-uuid"); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var b1Label string
+	var b1Deleted, b1Dirty bool
+	database.MustScan(t, "getting b1", db.QueryRow("SELECT label, deleted, dirty FROM books WHERE uuid = ?", "b1-uuid"), &b1Label, &b1Deleted, &b1Dirty)
+	assert.NotEqual(t, b1Label, "javascript", "b1 label should be freed")
+	assert.Equal(t, b1Deleted, true, "b1 deleted mismatch")
+	assert.Equal(t, b1Dirty, true, "b1 dirty mismatch")
+
+	var movedCount int
+	database.MustScan(t, "counting moved notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ? AND dirty = ? AND uuid IN (?, ?)", "b2-uuid", true, "n1-uuid", "n2-uuid"), &movedCount)
+	assert.Equal(t, movedCount, 2, "moved note count mismatch")
+
+	var n3BookUUID string
+	database.MustScan(t, "getting n3", db.QueryRow("SELECT book_uuid FROM notes WHERE uuid = ?", "n3-uuid"), &n3BookUUID)
+	assert.Equal(t, n3BookUUID, "b1-uuid", "the removed note should stay")
+
+	var n4Dirty bool
+	database.MustScan(t, "getting n4", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n4-uuid"), &n4Dirty)
+	assert.Equal(t, n4Dirty, false, "n4 dirty mismatch")
+}
@@ -0,0 +1,139 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"database/sql"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var renameExample = `
+ * Rename the book 'js' to 'javascript'
+ dnote books rename js javascript`
+
+func renamePreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newRenameCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "rename <book name> <new name>",
+		Short:             "Rename a book",
+		Example:           renameExample,
+		PreRunE:           renamePreRun,
+		RunE:              newRenameRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	return cmd
+}
+
+// checkLabelCollision returns an error if a book other than the one with the given uuid
+// has the label, including the deleted books that the server may still have. Unless
+// caseSensitive is true, the labels differing only in case collide as well.
+func checkLabelCollision(db *database.DB, uuid, label string, caseSensitive bool) error {
+	query := "SELECT label, deleted FROM books WHERE uuid <> ? AND label = ?"
+	if !caseSensitive {
+		query += " COLLATE NOCASE"
+	}
+
+	var existing string
+	var deleted bool
+	err := db.QueryRow(query+" ORDER BY deleted ASC LIMIT 1", uuid, label).Scan(&existing, &deleted)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "checking for a book with the same name")
+	}
+
+	if deleted {
+		return errors.Errorf("a removed book named '%s' has not been synced yet. Run `dnote sync` first", existing)
+	}
+
+	// suggest the name that the sync would give to the book in case of a conflict
+	available, err := database.ResolveLabelConflict(db, label, caseSensitive)
+	if err != nil {
+		return errors.Wrap(err, "finding an available name")
+	}
+
+	return errors.Errorf("book '%s' already exists. Try another name such as '%s'", existing, available)
+}
+
+// renameBook renames the book with the given name and marks it dirty
+func renameBook(ctx context.DnoteCtx, name, newName string) error {
+	if err := validate.BookName(newName); err != nil {
+		return errors.Wrap(err, "validating the new name")
+	}
+
+	uuid, err := getBookUUID(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := database.CheckBookOwner(ctx.DB, uuid); err != nil {
+		return err
+	}
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := checkLabelCollision(tx, uuid, newName, ctx.CaseSensitiveBooks); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := database.UpdateBookName(tx, uuid, newName); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "updating the book name")
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func newRenameRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name, newName := args[0], args[1]
+
+		if err := renameBook(ctx, name, newName); err != nil {
+			return err
+		}
+
+		log.Successf("renamed the book '%s' to '%s'\n", name, newName)
+
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestRenameBook(t *testing.T) {
+	setup := func(t *testing.T) context.DnoteCtx {
+		ctx := context.InitTestCtx(t, paths, nil)
+
+		db := ctx.DB
+		database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "js", 1, false)
+		database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b2-uuid", "css", 2, false)
+		database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b3-uuid", "go", 3, true, true)
+
+		return ctx
+	}
+
+	t.Run("success", func(t *testing.T) {
+		ctx := setup(t)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if err := renameBook(ctx, "JS", "javascript"); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		var label string
+		var dirty bool
+		database.MustScan(t, "getting b1", ctx.DB.QueryRow("SELECT label, dirty FROM books WHERE uuid = ?", "b1-uuid"), &label, &dirty)
+		assert.Equal(t, label, "javascript", "label mismatch")
+		assert.Equal(t, dirty, true, "dirty mismatch")
+	})
+
+	t.Run("change case", func(t *testing.T) {
+		ctx := setup(t)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if err := renameBook(ctx, "js", "JS"); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		var label string
+		database.MustScan(t, "getting b1", ctx.DB.QueryRow("SELECT label FROM books WHERE uuid = ?", "b1-uuid"), &label)
+		assert.Equal(t, label, "JS", "label mismatch")
+	})
+
+	t.Run("team book owned by another user", func(t *testing.T) {
+		ctx := setup(t)
+		defer context.TeardownTestCtx(t, ctx)
+
+		database.MustExec(t, "making b1 a team book", ctx.DB, "UPDATE books SET owner = ? WHERE uuid = ?", "alice@example.com", "b1-uuid")
+
+		err := renameBook(ctx, "js", "javascript")
+		if err == nil || !strings.Contains(err.Error(), "owned by alice@example.com") {
+			t.Fatalf("expected an error about the owner but got %v", err)
+		}
+
+		var label string
+		database.MustScan(t, "getting b1", ctx.DB.QueryRow("SELECT label FROM books WHERE uuid = ?", "b1-uuid"), &label)
+		assert.Equal(t, label, "js", "label mismatch")
+	})
+
+	testCases := []struct {
+		name     string
+		newName  string
+		expected string
+	}{
+		{name: "existing book", newName: "css", expected: "Try another name such as 'css_2'"},
+		{name: "existing book in another case", newName: "CSS", expected: "book 'css' already exists"},
+		{name: "removed book", newName: "go", expected: "has not been synced yet"},
+		{name: "reserved name", newName: "trash", expected: "reserved"},
+		{name: "invalid name", newName: "java script", expected: "spaces"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := setup(t)
+			defer context.TeardownTestCtx(t, ctx)
+
+			err := renameBook(ctx, "js", tc.newName)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			assert.Equal(t, strings.Contains(err.Error(), tc.expected), true, "error mismatch: "+err.Error())
+
+			var label string
+			var dirty bool
+			database.MustScan(t, "getting b1", ctx.DB.QueryRow("SELECT label, dirty FROM books WHERE uuid = ?", "b1-uuid"), &label, &dirty)
+			assert.Equal(t, label, "js", "label mismatch")
+			assert.Equal(t, dirty, false, "dirty mismatch")
+		})
+	}
+
+	t.Run("existing book in another case with case sensitive books", func(t *testing.T) {
+		ctx := setup(t)
+		defer context.TeardownTestCtx(t, ctx)
+		ctx.CaseSensitiveBooks = true
+
+		if err := renameBook(ctx, "js", "CSS"); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+	})
+}
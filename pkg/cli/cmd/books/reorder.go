@@ -0,0 +1,415 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var reorderExample = `
+ * Reorder, group, merge or remove the notes in the book 'linux' in the editor
+ dnote books reorder linux`
+
+func reorderPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newReorderCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "reorder <book name>",
+		Short:             "Reorder the notes in a book in the editor",
+		Example:           reorderExample,
+		PreRunE:           reorderPreRun,
+		RunE:              newReorderRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	return cmd
+}
+
+const (
+	// reorderPick keeps the note at its place in the plan
+	reorderPick = "pick"
+	// reorderSquash merges the note into the note above it
+	reorderSquash = "squash"
+	// reorderDrop removes the note
+	reorderDrop = "drop"
+	// reorderHeading groups the notes below it under a heading
+	reorderHeading = "heading"
+)
+
+// reorderActions maps the actions and their abbreviations in a plan to the actions
+var reorderActions = map[string]string{
+	"pick":    reorderPick,
+	"p":       reorderPick,
+	"squash":  reorderSquash,
+	"s":       reorderSquash,
+	"drop":    reorderDrop,
+	"d":       reorderDrop,
+	"heading": reorderHeading,
+	"h":       reorderHeading,
+}
+
+var reorderHelp = `
+# Reorder the notes in '%s' by moving the lines. Lines starting with '#' are ignored.
+#
+# Commands:
+# p, pick <id> = keep the note
+# s, squash <id> = merge the note into the note above it
+# d, drop <id> = remove the note
+# h, heading <text> = group the notes below under a heading
+#
+# Notes whose lines are removed are kept at the end of the book.
+# If you remove everything, nothing is changed.
+`
+
+// reorderNote is a note in the book being reordered
+type reorderNote struct {
+	RowID   int
+	UUID    string
+	Title   string
+	Body    string
+	Heading string
+}
+
+// reorderStep is a line in the reordering plan
+type reorderStep struct {
+	Action string
+	// RowID is the rowid of the note for the actions other than heading
+	RowID int
+	// Heading is the text of the heading for the heading action
+	Heading string
+}
+
+// getReorderNotes returns the notes in the book in the order shown by `dnote view`
+func getReorderNotes(db *database.DB, bookUUID string) ([]reorderNote, error) {
+	rows, err := db.Query(`SELECT rowid, uuid, title, body, heading FROM notes
+	WHERE book_uuid = ? AND deleted = ?
+	ORDER BY position = 0 ASC, position ASC, added_on ASC`, bookUUID, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []reorderNote{}
+	for rows.Next() {
+		var n reorderNote
+		if err := rows.Scan(&n.RowID, &n.UUID, &n.Title, &n.Body, &n.Heading); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// getNoteTitle returns the title of the note, shortened to fit a line
+func getNoteTitle(n reorderNote) string {
+	title := database.NoteTitle(n.Title, n.Body)
+
+	runes := []rune(title)
+	if len(runes) > 60 {
+		return string(runes[:60]) + "..."
+	}
+
+	return title
+}
+
+// buildReorderPlan returns the plan for the notes to be edited by the user
+func buildReorderPlan(label string, notes []reorderNote) string {
+	var b strings.Builder
+
+	var heading string
+	for _, n := range notes {
+		if n.Heading != heading {
+			if n.Heading != "" {
+				fmt.Fprintf(&b, "%s %s\n", reorderHeading, n.Heading)
+			}
+			heading = n.Heading
+		}
+
+		fmt.Fprintf(&b, "%s %d %s\n", reorderPick, n.RowID, getNoteTitle(n))
+	}
+
+	fmt.Fprintf(&b, reorderHelp, label)
+
+	return b.String()
+}
+
+// parseReorderPlan parses the plan edited by the user. The notes missing from the plan
+// are picked at the end. It returns nil if the plan is empty.
+func parseReorderPlan(content string, notes []reorderNote) ([]reorderStep, error) {
+	inBook := map[int]bool{}
+	for _, n := range notes {
+		inBook[n.RowID] = true
+	}
+
+	steps := []reorderStep{}
+	seen := map[int]bool{}
+	hasNote := false
+
+	for idx, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		action, ok := reorderActions[fields[0]]
+		if !ok {
+			return nil, errors.Errorf("line %d: unknown command '%s'", idx+1, fields[0])
+		}
+
+		if action == reorderHeading {
+			heading := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+			if heading == "" {
+				return nil, errors.Errorf("line %d: the heading is empty", idx+1)
+			}
+
+			steps = append(steps, reorderStep{Action: action, Heading: heading})
+			continue
+		}
+
+		if len(fields) < 2 {
+			return nil, errors.Errorf("line %d: missing the note id", idx+1)
+		}
+		rowID, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, errors.Errorf("line %d: invalid note id '%s'", idx+1, fields[1])
+		}
+		if !inBook[rowID] {
+			return nil, errors.Errorf("line %d: the note %d is not in the book", idx+1, rowID)
+		}
+		if seen[rowID] {
+			return nil, errors.Errorf("line %d: the note %d appears more than once", idx+1, rowID)
+		}
+		if action == reorderSquash && !hasNote {
+			return nil, errors.Errorf("line %d: cannot squash the note %d because there is no note above it", idx+1, rowID)
+		}
+
+		seen[rowID] = true
+		if action != reorderDrop {
+			hasNote = true
+		}
+
+		steps = append(steps, reorderStep{Action: action, RowID: rowID})
+	}
+
+	if len(steps) == 0 {
+		return nil, nil
+	}
+
+	for _, n := range notes {
+		if !seen[n.RowID] {
+			steps = append(steps, reorderStep{Action: reorderPick, RowID: n.RowID})
+		}
+	}
+
+	return steps, nil
+}
+
+// reorderResult is the summary of the applied plan
+type reorderResult struct {
+	Squashed int
+	Dropped  int
+}
+
+// applyReorderPlan applies the steps in a transaction. The order and the headings are
+// kept only on this device, while the merged and the removed notes are synced.
+func applyReorderPlan(ctx context.DnoteCtx, steps []reorderStep, notes []reorderNote) (reorderResult, error) {
+	var ret reorderResult
+
+	uuids := map[int]string{}
+	for _, n := range notes {
+		uuids[n.RowID] = n.UUID
+	}
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return ret, errors.Wrap(err, "beginning a transaction")
+	}
+
+	var position int
+	var heading, target string
+	for _, step := range steps {
+		uuid := uuids[step.RowID]
+
+		switch step.Action {
+		case reorderHeading:
+			heading = step.Heading
+		case reorderPick:
+			position++
+			target = uuid
+
+			if _, err := tx.Exec("UPDATE notes SET position = ?, heading = ? WHERE uuid = ?", position, heading, uuid); err != nil {
+				tx.Rollback()
+				return ret, errors.Wrapf(err, "reordering the note %d", step.RowID)
+			}
+		case reorderSquash:
+			if err := squashNote(ctx, tx, uuid, target); err != nil {
+				tx.Rollback()
+				return ret, errors.Wrapf(err, "squashing the note %d", step.RowID)
+			}
+			ret.Squashed++
+		case reorderDrop:
+			if err := dropNote(ctx, tx, uuid); err != nil {
+				tx.Rollback()
+				return ret, errors.Wrapf(err, "removing the note %d", step.RowID)
+			}
+			ret.Dropped++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return ret, errors.Wrap(err, "committing a transaction")
+	}
+
+	return ret, nil
+}
+
+// squashNote appends the body of the note to the body of the target note, and removes it
+func squashNote(ctx context.DnoteCtx, tx *database.DB, uuid, targetUUID string) error {
+	var body, targetBody string
+	if err := tx.QueryRow("SELECT body FROM notes WHERE uuid = ?", uuid).Scan(&body); err != nil {
+		return errors.Wrap(err, "getting the note")
+	}
+	if err := tx.QueryRow("SELECT body FROM notes WHERE uuid = ?", targetUUID).Scan(&targetBody); err != nil {
+		return errors.Wrap(err, "getting the target note")
+	}
+
+	if err := database.SaveNoteVersion(tx, ctx.Clock, targetUUID, database.NoteVersionEdit, ctx.HistoryRetention); err != nil {
+		return errors.Wrap(err, "saving a version")
+	}
+
+	merged := strings.TrimRight(targetBody, "\n") + "\n\n" + body
+	ts := ctx.Clock.Now().UnixNano()
+	if _, err := tx.Exec("UPDATE notes SET body = ?, edited_on = ?, dirty = ? WHERE uuid = ?", merged, ts, true, targetUUID); err != nil {
+		return errors.Wrap(err, "updating the target note")
+	}
+
+	return dropNote(ctx, tx, uuid)
+}
+
+// dropNote removes the note in the same way as `dnote remove`
+func dropNote(ctx context.DnoteCtx, tx *database.DB, uuid string) error {
+	if err := database.SaveNoteVersion(tx, ctx.Clock, uuid, database.NoteVersionRemove, ctx.HistoryRetention); err != nil {
+		return errors.Wrap(err, "saving a version")
+	}
+
+	if err := database.TrashNote(tx, ctx.Clock, uuid, ctx.TrashRetention); err != nil {
+		return errors.Wrap(err, "removing the note")
+	}
+
+	return nil
+}
+
+// ensureSquashBodies fetches the evicted bodies of the notes to be merged
+func ensureSquashBodies(ctx context.DnoteCtx, steps []reorderStep) error {
+	var target int
+	for _, step := range steps {
+		switch step.Action {
+		case reorderPick:
+			target = step.RowID
+		case reorderSquash:
+			if err := thin.EnsureBody(ctx, target); err != nil {
+				return err
+			}
+			if err := thin.EnsureBody(ctx, step.RowID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func newReorderRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		bookUUID, err := getBookUUID(ctx, name)
+		if err != nil {
+			return errors.Wrap(err, "finding the book")
+		}
+
+		notes, err := getReorderNotes(ctx.DB, bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "getting the notes")
+		}
+		if len(notes) == 0 {
+			return errors.Errorf("the book '%s' has no notes", name)
+		}
+
+		fpath, err := ui.CreateTmpContentFile(ctx, []byte(buildReorderPlan(name, notes)))
+		if err != nil {
+			return errors.Wrap(err, "preparing tmp content file")
+		}
+
+		content, err := ui.GetEditorInput(ctx, fpath)
+		if err != nil {
+			return errors.Wrap(err, "getting editor input")
+		}
+
+		steps, err := parseReorderPlan(content, notes)
+		if err != nil {
+			return errors.Wrap(err, "reading the plan")
+		}
+		if steps == nil {
+			log.Warnf("the plan is empty. Nothing was changed\n")
+			return nil
+		}
+
+		if err := ensureSquashBodies(ctx, steps); err != nil {
+			return errors.Wrap(err, "fetching the notes to merge")
+		}
+
+		result, err := applyReorderPlan(ctx, steps, notes)
+		if err != nil {
+			return errors.Wrap(err, "applying the plan")
+		}
+
+		log.Successf("reordered '%s'\n", name)
+		if result.Squashed > 0 {
+			log.Infof("merged %d notes\n", result.Squashed)
+		}
+		if result.Dropped > 0 {
+			log.Infof("removed %d notes\n", result.Dropped)
+		}
+
+		return nil
+	}
+}
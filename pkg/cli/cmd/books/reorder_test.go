@@ -0,0 +1,182 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestBuildReorderPlan(t *testing.T) {
+	notes := []reorderNote{
+		{RowID: 1, Body: "\n  first note\nmore"},
+		{RowID: 2, Body: "second note", Heading: "Basics"},
+		{RowID: 3, Body: "third note", Heading: "Basics"},
+		{RowID: 4, Title: "fourth title", Body: "fourth note"},
+	}
+
+	plan := buildReorderPlan("linux", notes)
+
+	expected := "pick 1 first note\nheading Basics\npick 2 second note\npick 3 third note\npick 4 fourth title\n" + fmt.Sprintf(reorderHelp, "linux")
+	assert.Equal(t, plan, expected, "plan mismatch")
+}
+
+func TestParseReorderPlan(t *testing.T) {
+	notes := []reorderNote{{RowID: 1}, {RowID: 2}, {RowID: 3}}
+
+	testCases := []struct {
+		content     string
+		expected    []reorderStep
+		expectedErr bool
+	}{
+		{
+			content: "pick 3 third\n# comment\n\nh  Group  one \np 1\ns 2 second",
+			expected: []reorderStep{
+				{Action: reorderPick, RowID: 3},
+				{Action: reorderHeading, Heading: "Group  one"},
+				{Action: reorderPick, RowID: 1},
+				{Action: reorderSquash, RowID: 2},
+			},
+		},
+		{
+			// the notes missing from the plan are kept at the end
+			content: "d 2\npick 3",
+			expected: []reorderStep{
+				{Action: reorderDrop, RowID: 2},
+				{Action: reorderPick, RowID: 3},
+				{Action: reorderPick, RowID: 1},
+			},
+		},
+		{
+			content:  "# everything removed\n",
+			expected: nil,
+		},
+		{
+			content:     "edit 1",
+			expectedErr: true,
+		},
+		{
+			content:     "pick 4",
+			expectedErr: true,
+		},
+		{
+			content:     "pick one",
+			expectedErr: true,
+		},
+		{
+			content:     "pick 1\npick 1",
+			expectedErr: true,
+		},
+		{
+			content:     "drop 1\nsquash 2",
+			expectedErr: true,
+		},
+		{
+			content:     "heading\npick 1",
+			expectedErr: true,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			steps, err := parseReorderPlan(tc.content, notes)
+			if tc.expectedErr {
+				assert.NotEqual(t, err, nil, "error mismatch")
+				return
+			}
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			assert.DeepEqual(t, steps, tc.expected, "steps mismatch")
+		})
+	}
+}
+
+func TestApplyReorderPlan(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "linux")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body\n", 1, 1, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 2, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 body", 3, 3, false)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4 body", 4, 4, false)
+
+	notes, err := getReorderNotes(db, "b1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the notes"))
+	}
+	rowIDs := map[string]int{}
+	for _, n := range notes {
+		rowIDs[n.UUID] = n.RowID
+	}
+
+	steps := []reorderStep{
+		{Action: reorderHeading, Heading: "Files"},
+		{Action: reorderPick, RowID: rowIDs["n3-uuid"]},
+		{Action: reorderPick, RowID: rowIDs["n1-uuid"]},
+		{Action: reorderSquash, RowID: rowIDs["n2-uuid"]},
+		{Action: reorderDrop, RowID: rowIDs["n4-uuid"]},
+	}
+
+	// execute
+	result, err := applyReorderPlan(ctx, steps, notes)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, result.Squashed, 1, "squashed count mismatch")
+	assert.Equal(t, result.Dropped, 1, "dropped count mismatch")
+
+	reordered, err := getReorderNotes(db, "b1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the reordered notes"))
+	}
+	assert.Equal(t, len(reordered), 2, "note count mismatch")
+	assert.Equal(t, reordered[0].UUID, "n3-uuid", "first note mismatch")
+	assert.Equal(t, reordered[0].Heading, "Files", "first note heading mismatch")
+	assert.Equal(t, reordered[1].UUID, "n1-uuid", "second note mismatch")
+	assert.Equal(t, reordered[1].Body, "n1 body\n\nn2 body", "merged body mismatch")
+
+	var n1Dirty, n3Dirty bool
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1Dirty)
+	database.MustScan(t, "getting n3", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n3-uuid"), &n3Dirty)
+	assert.Equal(t, n1Dirty, true, "n1 should be synced")
+	assert.Equal(t, n3Dirty, false, "the order should not be synced")
+
+	for _, uuid := range []string{"n2-uuid", "n4-uuid"} {
+		var deleted, dirty bool
+		database.MustScan(t, "getting "+uuid, db.QueryRow("SELECT deleted, dirty FROM notes WHERE uuid = ?", uuid), &deleted, &dirty)
+		assert.Equal(t, deleted, true, uuid+" deleted mismatch")
+		assert.Equal(t, dirty, true, uuid+" dirty mismatch")
+	}
+
+	var versionCount int
+	database.MustScan(t, "counting versions", db.QueryRow("SELECT count(*) FROM note_versions"), &versionCount)
+	assert.Equal(t, versionCount, 3, "version count mismatch")
+}
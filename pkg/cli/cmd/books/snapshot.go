@@ -0,0 +1,475 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/secrets"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var snapshotListFlag bool
+var snapshotRestoreFlag bool
+var snapshotYesFlag bool
+var snapshotForceFlag bool
+
+var snapshotExample = `
+ * Take a snapshot of the notes in the book 'js'
+ dnote books snapshot js "before cleanup"
+
+ * List the snapshots of the book
+ dnote books snapshot js --list
+
+ * Restore the notes in the book to the snapshot
+ dnote books snapshot js "before cleanup" --restore`
+
+func snapshotPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Incorrect number of argument")
+	}
+	if snapshotListFlag && snapshotRestoreFlag {
+		return errors.New("--list and --restore cannot be used together")
+	}
+	if snapshotListFlag && len(args) != 1 {
+		return errors.New("--list does not take a snapshot name")
+	}
+	if snapshotRestoreFlag && len(args) != 2 {
+		return errors.New("--restore requires a snapshot name")
+	}
+
+	return nil
+}
+
+func newSnapshotCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "snapshot <book name> [snapshot name]",
+		Short:             "Take, list or restore snapshots of a book",
+		Example:           snapshotExample,
+		PreRunE:           snapshotPreRun,
+		RunE:              newSnapshotRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&snapshotListFlag, "list", "l", false, "List the snapshots of the book")
+	f.BoolVarP(&snapshotRestoreFlag, "restore", "r", false, "Restore the notes in the book to the snapshot")
+	f.BoolVarP(&snapshotYesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+	f.BoolVarP(&snapshotForceFlag, "force", "", false, "Restore the public notes even if they seem to contain secrets, without confirmation")
+
+	return cmd
+}
+
+// snapshotInfo is an information about a snapshot of a book
+type snapshotInfo struct {
+	UUID      string
+	Name      string
+	CreatedAt int64
+	NoteCount int
+}
+
+// snapshotNote is a note in a snapshot
+type snapshotNote struct {
+	UUID     string
+	Body     string
+	AddedOn  int64
+	EditedOn int64
+	Public   bool
+	// RowID is the id of the note, and 0 if the note has been expunged. It is only set for the
+	// notes to be shared.
+	RowID int
+}
+
+// createSnapshot saves the current state of the notes in the book with the given uuid
+// under the given name, and returns the number of the notes saved.
+func createSnapshot(ctx context.DnoteCtx, bookUUID, name string) (int, error) {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning a transaction")
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT count(*) FROM book_snapshots WHERE book_uuid = ? AND name = ?", bookUUID, name).Scan(&count); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "checking for a duplicate snapshot")
+	}
+	if count > 0 {
+		tx.Rollback()
+		return 0, errors.Errorf("snapshot '%s' already exists", name)
+	}
+
+	uuid, err := utils.GenerateUUID()
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "generating uuid")
+	}
+
+	if _, err := tx.Exec("INSERT INTO book_snapshots (uuid, book_uuid, name, created_at) VALUES (?, ?, ?, ?)",
+		uuid, bookUUID, name, ctx.Clock.Now().UnixNano()); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "inserting the snapshot")
+	}
+
+	res, err := tx.Exec(`INSERT INTO book_snapshot_notes (snapshot_uuid, note_uuid, body, added_on, edited_on, public)
+		SELECT ?, uuid, body, added_on, edited_on, public FROM notes WHERE book_uuid = ? AND deleted = ?`, uuid, bookUUID, false)
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "saving the notes")
+	}
+
+	noteCount, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "counting the saved notes")
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "committing a transaction")
+	}
+
+	return int(noteCount), nil
+}
+
+// listSnapshots returns the snapshots of the book with the given uuid, from the oldest to the newest
+func listSnapshots(db *database.DB, bookUUID string) ([]snapshotInfo, error) {
+	rows, err := db.Query(`SELECT book_snapshots.uuid, book_snapshots.name, book_snapshots.created_at, count(book_snapshot_notes.note_uuid)
+		FROM book_snapshots
+		LEFT JOIN book_snapshot_notes ON book_snapshot_notes.snapshot_uuid = book_snapshots.uuid
+		WHERE book_snapshots.book_uuid = ?
+		GROUP BY book_snapshots.uuid
+		ORDER BY book_snapshots.created_at ASC`, bookUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying snapshots")
+	}
+	defer rows.Close()
+
+	ret := []snapshotInfo{}
+	for rows.Next() {
+		var s snapshotInfo
+		if err := rows.Scan(&s.UUID, &s.Name, &s.CreatedAt, &s.NoteCount); err != nil {
+			return nil, errors.Wrap(err, "scanning a snapshot")
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+func getSnapshotNotes(tx *database.DB, snapshotUUID string) ([]snapshotNote, error) {
+	rows, err := tx.Query("SELECT note_uuid, body, added_on, edited_on, public FROM book_snapshot_notes WHERE snapshot_uuid = ?", snapshotUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the notes in the snapshot")
+	}
+	defer rows.Close()
+
+	ret := []snapshotNote{}
+	for rows.Next() {
+		var n snapshotNote
+		if err := rows.Scan(&n.UUID, &n.Body, &n.AddedOn, &n.EditedOn, &n.Public); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// getSharedSnapshotNotes returns the public notes in the snapshot that restoring it would share
+// again, or share with another content. The notes already shared as they are are left out.
+func getSharedSnapshotNotes(db *database.DB, snapshotUUID string) ([]snapshotNote, error) {
+	rows, err := db.Query(`SELECT s.note_uuid, s.body, s.added_on, s.edited_on, s.public, coalesce(notes.rowid, 0)
+		FROM book_snapshot_notes AS s
+		LEFT JOIN notes ON notes.uuid = s.note_uuid
+		WHERE s.snapshot_uuid = ? AND s.public = ? AND (notes.uuid IS NULL OR notes.public = ? OR notes.deleted = ? OR notes.body != s.body)`,
+		snapshotUUID, true, false, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the shared notes in the snapshot")
+	}
+	defer rows.Close()
+
+	ret := []snapshotNote{}
+	for rows.Next() {
+		var n snapshotNote
+		if err := rows.Scan(&n.UUID, &n.Body, &n.AddedOn, &n.EditedOn, &n.Public, &n.RowID); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// checkSnapshotSecrets scans the notes that restoring the snapshot would share for likely
+// secrets, and asks for a confirmation if any is found
+func checkSnapshotSecrets(notes []snapshotNote) error {
+	var found bool
+	for _, n := range notes {
+		findings := secrets.Scan(n.Body)
+		if len(findings) == 0 {
+			continue
+		}
+
+		if !found {
+			log.Warnf("some notes to be shared seem to contain secrets\n")
+			found = true
+		}
+		label := "(expunged)"
+		if n.RowID != 0 {
+			label = fmt.Sprintf("(%d)", n.RowID)
+		}
+		for _, f := range findings {
+			log.Plainf("  %s %s %s\n", log.ColorYellow.Sprintf("%s line %d:", label, f.Line), f.Kind, log.ColorGray.Sprintf("(%s)", f.Excerpt))
+		}
+	}
+
+	if !found || snapshotForceFlag {
+		return nil
+	}
+
+	ok, err := ui.Confirm("restore and share them anyway?", false)
+	if err != nil {
+		return errors.Wrap(err, "getting confirmation")
+	}
+	if !ok {
+		return errors.New("Aborted. Use --force to restore the snapshot regardless")
+	}
+
+	return nil
+}
+
+// restoreNote brings back the note in the snapshot into the book. It returns false if the
+// note was already in the same state.
+func restoreNote(ctx context.DnoteCtx, tx *database.DB, bookUUID string, n snapshotNote) (bool, error) {
+	ts := ctx.Clock.Now().UnixNano()
+
+	var local database.Note
+	err := tx.QueryRow("SELECT book_uuid, body, public, deleted, trashed_on FROM notes WHERE uuid = ?", n.UUID).
+		Scan(&local.BookUUID, &local.Body, &local.Public, &local.Deleted, &local.TrashedOn)
+
+	// if the note has been expunged, add it again as a new note
+	if err == sql.ErrNoRows {
+		uuid, err := utils.GenerateUUID()
+		if err != nil {
+			return false, errors.Wrap(err, "generating uuid")
+		}
+
+		note := database.NewNote(uuid, bookUUID, database.InferTitle(n.Body), n.Body, n.AddedOn, ts, 0, n.Public, false, true)
+		if err := note.Insert(tx); err != nil {
+			return false, errors.Wrapf(err, "inserting the note %s", n.UUID)
+		}
+
+		// point the snapshots to the new note so that restoring again does not duplicate it
+		if _, err := tx.Exec("UPDATE book_snapshot_notes SET note_uuid = ? WHERE note_uuid = ?", uuid, n.UUID); err != nil {
+			return false, errors.Wrapf(err, "updating the snapshots of the note %s", n.UUID)
+		}
+
+		return true, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "getting the note %s", n.UUID)
+	}
+
+	if local.BookUUID == bookUUID && local.Body == n.Body && local.Public == n.Public && !local.Deleted && local.TrashedOn == 0 {
+		return false, nil
+	}
+
+	// take the note out of the trash so that emptying the trash does not remove it
+	if _, err := tx.Exec("UPDATE notes SET book_uuid = ?, body = ?, public = ?, deleted = ?, edited_on = ?, dirty = ?, trashed_on = ? WHERE uuid = ?",
+		bookUUID, n.Body, n.Public, false, ts, true, 0, n.UUID); err != nil {
+		return false, errors.Wrapf(err, "updating the note %s", n.UUID)
+	}
+	if err := database.ReconcileNoteVisibility(tx, n.UUID); err != nil {
+		return false, errors.Wrapf(err, "updating the visibility of the note %s", n.UUID)
+	}
+
+	return true, nil
+}
+
+// restoreSnapshot makes the notes in the book with the given uuid the same as the ones in the
+// snapshot. Notes that are not in the snapshot are removed. It returns the numbers of the notes
+// restored and removed.
+func restoreSnapshot(ctx context.DnoteCtx, bookUUID, snapshotUUID string) (int, int, error) {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "beginning a transaction")
+	}
+
+	notes, err := getSnapshotNotes(tx, snapshotUUID)
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, errors.Wrap(err, "getting the notes")
+	}
+
+	// remove first so that the notes added again with new uuids are not removed
+	res, err := tx.Exec(`UPDATE notes SET deleted = ?, dirty = ?, body = ?
+		WHERE book_uuid = ? AND deleted = ? AND uuid NOT IN (SELECT note_uuid FROM book_snapshot_notes WHERE snapshot_uuid = ?)`,
+		true, true, "", bookUUID, false, snapshotUUID)
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, errors.Wrap(err, "removing the notes not in the snapshot")
+	}
+
+	removed, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, errors.Wrap(err, "counting the removed notes")
+	}
+
+	var restored int
+	for _, n := range notes {
+		ok, err := restoreNote(ctx, tx, bookUUID, n)
+		if err != nil {
+			tx.Rollback()
+			return 0, 0, errors.Wrap(err, "restoring a note")
+		}
+		if ok {
+			restored++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, 0, errors.Wrap(err, "committing a transaction")
+	}
+
+	return restored, int(removed), nil
+}
+
+func getSnapshot(db *database.DB, bookUUID, name string) (snapshotInfo, error) {
+	var ret snapshotInfo
+
+	err := db.QueryRow("SELECT uuid, name, created_at FROM book_snapshots WHERE book_uuid = ? AND name = ?", bookUUID, name).
+		Scan(&ret.UUID, &ret.Name, &ret.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ret, errors.Errorf("snapshot '%s' not found", name)
+	} else if err != nil {
+		return ret, errors.Wrap(err, "querying the snapshot")
+	}
+
+	return ret, nil
+}
+
+func formatSnapshotTime(ts int64) string {
+	return time.Unix(0, ts).Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+func printSnapshots(ctx context.DnoteCtx, bookName, bookUUID string) error {
+	snapshots, err := listSnapshots(ctx.DB, bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "listing snapshots")
+	}
+
+	if len(snapshots) == 0 {
+		log.Infof("no snapshots of %s\n", bookName)
+		return nil
+	}
+
+	for _, s := range snapshots {
+		log.Printf("%s %s\n", s.Name, log.ColorYellow.Sprintf("(%d notes, %s)", s.NoteCount, formatSnapshotTime(s.CreatedAt)))
+	}
+
+	return nil
+}
+
+func runRestore(ctx context.DnoteCtx, bookName, bookUUID, name string) error {
+	s, err := getSnapshot(ctx.DB, bookUUID, name)
+	if err != nil {
+		return err
+	}
+
+	if !snapshotYesFlag {
+		question := fmt.Sprintf("restore %s to the snapshot taken on %s? Notes not in the snapshot will be removed", bookName, formatSnapshotTime(s.CreatedAt))
+		ok, err := ui.Confirm(question, false)
+		if err != nil {
+			return errors.Wrap(err, "getting confirmation")
+		}
+		if !ok {
+			log.Warnf("aborted by user\n")
+			return nil
+		}
+	}
+
+	shared, err := getSharedSnapshotNotes(ctx.DB, s.UUID)
+	if err != nil {
+		return errors.Wrap(err, "getting the notes to be shared")
+	}
+	if err := checkSnapshotSecrets(shared); err != nil {
+		return err
+	}
+
+	restored, removed, err := restoreSnapshot(ctx, bookUUID, s.UUID)
+	if err != nil {
+		return errors.Wrap(err, "restoring the snapshot")
+	}
+
+	log.Successf("restored %s to '%s' (%d notes restored, %d notes removed)\n", bookName, s.Name, restored, removed)
+
+	return nil
+}
+
+func newSnapshotRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		bookName := args[0]
+		bookUUID, err := getBookUUID(ctx, bookName)
+		if err != nil {
+			return err
+		}
+
+		if snapshotListFlag {
+			return printSnapshots(ctx, bookName, bookUUID)
+		}
+		if snapshotRestoreFlag {
+			return runRestore(ctx, bookName, bookUUID, args[1])
+		}
+
+		var name string
+		if len(args) == 2 {
+			name = args[1]
+		} else {
+			name = ctx.Clock.Now().Format("2006-01-02 15:04:05")
+		}
+
+		if _, err := thin.EnsureBodies(ctx, bookUUID); err != nil {
+			return errors.Wrap(err, "getting the note bodies")
+		}
+
+		count, err := createSnapshot(ctx, bookUUID, name)
+		if err != nil {
+			return errors.Wrap(err, "taking a snapshot")
+		}
+
+		log.Successf("took a snapshot '%s' of %s with %d notes\n", name, bookName, count)
+
+		return nil
+	}
+}
@@ -0,0 +1,174 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestSnapshot(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "js", 1)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b2-uuid", "css", 2)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 3)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 4)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 body", 3, 5)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4 body", 4, 6)
+	database.MustExec(t, "inserting n6", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n6-uuid", "b1-uuid", "n6 body", 6, 8)
+
+	count, err := createSnapshot(ctx, "b1-uuid", "s1")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a snapshot"))
+	}
+	assert.Equal(t, count, 5, "snapshot note count mismatch")
+
+	if _, err := createSnapshot(ctx, "b1-uuid", "s1"); err == nil {
+		t.Error("expected an error for a duplicate snapshot name")
+	}
+
+	// change the book after the snapshot
+	database.MustExec(t, "editing n1", db, "UPDATE notes SET body = ?, dirty = ? WHERE uuid = ?", "n1 body edited", true, "n1-uuid")
+	database.MustExec(t, "expunging n2", db, "DELETE FROM notes WHERE uuid = ?", "n2-uuid")
+	database.MustExec(t, "moving n3", db, "UPDATE notes SET book_uuid = ?, dirty = ? WHERE uuid = ?", "b2-uuid", true, "n3-uuid")
+	database.MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n5-uuid", "b1-uuid", "n5 body", 5, 7)
+	database.MustExec(t, "trashing n6", db, "UPDATE notes SET deleted = ?, dirty = ?, trashed_on = ? WHERE uuid = ?", true, false, 1541232119, "n6-uuid")
+
+	snapshots, err := listSnapshots(db, "b1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "listing snapshots"))
+	}
+	assert.Equal(t, len(snapshots), 1, "snapshot count mismatch")
+	assert.Equal(t, snapshots[0].Name, "s1", "snapshot name mismatch")
+	assert.Equal(t, snapshots[0].NoteCount, 5, "snapshot note count mismatch")
+
+	// execute
+	restored, removed, err := restoreSnapshot(ctx, "b1-uuid", snapshots[0].UUID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "restoring the snapshot"))
+	}
+
+	// test
+	assert.Equal(t, restored, 4, "restored count mismatch")
+	assert.Equal(t, removed, 1, "removed count mismatch")
+
+	var n1Body string
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT body FROM notes WHERE uuid = ?", "n1-uuid"), &n1Body)
+	assert.Equal(t, n1Body, "n1 body", "n1 body mismatch")
+
+	var n2UUID string
+	var n2USN int
+	var n2Dirty bool
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT uuid, usn, dirty FROM notes WHERE body = ?", "n2 body"), &n2UUID, &n2USN, &n2Dirty)
+	assert.NotEqual(t, n2UUID, "n2-uuid", "n2 should be added again with a new uuid")
+	assert.Equal(t, n2USN, 0, "n2 usn mismatch")
+	assert.Equal(t, n2Dirty, true, "n2 dirty mismatch")
+
+	var n3BookUUID string
+	database.MustScan(t, "getting n3", db.QueryRow("SELECT book_uuid FROM notes WHERE uuid = ?", "n3-uuid"), &n3BookUUID)
+	assert.Equal(t, n3BookUUID, "b1-uuid", "n3 book_uuid mismatch")
+
+	var n4Dirty bool
+	database.MustScan(t, "getting n4", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n4-uuid"), &n4Dirty)
+	assert.Equal(t, n4Dirty, false, "n4 should not change")
+
+	var n5Deleted, n5Dirty bool
+	database.MustScan(t, "getting n5", db.QueryRow("SELECT deleted, dirty FROM notes WHERE uuid = ?", "n5-uuid"), &n5Deleted, &n5Dirty)
+	assert.Equal(t, n5Deleted, true, "n5 deleted mismatch")
+	assert.Equal(t, n5Dirty, true, "n5 dirty mismatch")
+
+	var n6Deleted bool
+	var n6TrashedOn int64
+	database.MustScan(t, "getting n6", db.QueryRow("SELECT deleted, trashed_on FROM notes WHERE uuid = ?", "n6-uuid"), &n6Deleted, &n6TrashedOn)
+	assert.Equal(t, n6Deleted, false, "n6 deleted mismatch")
+	assert.Equal(t, n6TrashedOn, int64(0), "n6 should be out of the trash")
+
+	// restoring again changes nothing
+	restored, removed, err = restoreSnapshot(ctx, "b1-uuid", snapshots[0].UUID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "restoring the snapshot again"))
+	}
+	assert.Equal(t, restored, 0, "restored count mismatch on the second restore")
+	assert.Equal(t, removed, 0, "removed count mismatch on the second restore")
+}
+
+func TestGetSharedSnapshotNotes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	for _, uuid := range []string{"n1-uuid", "n2-uuid", "n3-uuid", "n4-uuid", "n5-uuid"} {
+		database.MustExec(t, fmt.Sprintf("inserting %s", uuid), db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public) VALUES (?, ?, ?, ?, ?)", uuid, "b1-uuid", uuid+" body", 1, true)
+	}
+	database.MustExec(t, "inserting n6", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public) VALUES (?, ?, ?, ?, ?)", "n6-uuid", "b1-uuid", "n6 body", 1, false)
+
+	if _, err := createSnapshot(ctx, "b1-uuid", "s1"); err != nil {
+		t.Fatal(errors.Wrap(err, "creating a snapshot"))
+	}
+	snapshot, err := getSnapshot(db, "b1-uuid", "s1")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the snapshot"))
+	}
+
+	// n1 is unchanged, and n6 is private in the snapshot
+	database.MustExec(t, "making n2 private", db, "UPDATE notes SET public = ? WHERE uuid = ?", false, "n2-uuid")
+	database.MustExec(t, "editing n3", db, "UPDATE notes SET body = ? WHERE uuid = ?", "n3 body edited", "n3-uuid")
+	database.MustExec(t, "expunging n4", db, "DELETE FROM notes WHERE uuid = ?", "n4-uuid")
+	database.MustExec(t, "trashing n5", db, "UPDATE notes SET deleted = ?, trashed_on = ? WHERE uuid = ?", true, 1, "n5-uuid")
+	database.MustExec(t, "editing n6", db, "UPDATE notes SET body = ? WHERE uuid = ?", "n6 body edited", "n6-uuid")
+
+	// execute
+	notes, err := getSharedSnapshotNotes(db, snapshot.UUID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var got []string
+	for _, n := range notes {
+		got = append(got, n.UUID)
+	}
+	sort.Strings(got)
+	assert.DeepEqual(t, got, []string{"n2-uuid", "n3-uuid", "n4-uuid", "n5-uuid"}, "shared notes mismatch")
+}
+
+func TestCheckSnapshotSecrets(t *testing.T) {
+	defer func() { snapshotForceFlag = false }()
+
+	if err := checkSnapshotSecrets([]snapshotNote{{UUID: "n1-uuid", Body: "no secrets here", Public: true}}); err != nil {
+		t.Fatal(errors.Wrap(err, "checking notes without secrets"))
+	}
+
+	snapshotForceFlag = true
+	if err := checkSnapshotSecrets([]snapshotNote{{UUID: "n1-uuid", Body: "password: hunter22", Public: true}}); err != nil {
+		t.Fatal(errors.Wrap(err, "checking notes with secrets and --force"))
+	}
+}
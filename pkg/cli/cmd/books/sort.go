@@ -0,0 +1,114 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var sortExample = `
+ * Show the order in which the notes in the book 'linux' are listed
+ dnote books sort linux
+
+ * List the notes in the book 'linux' alphabetically by default
+ dnote books sort linux alphabetical
+
+ * Go back to the order arranged by 'dnote books reorder'
+ dnote books sort linux manual`
+
+func sortPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newSortCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "sort <book name> [manual|added|edited|alphabetical|last-viewed]",
+		Short:             "Show or set the order in which the notes in a book are listed",
+		Example:           sortExample,
+		PreRunE:           sortPreRun,
+		RunE:              newSortRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	return cmd
+}
+
+// setNoteSort sets the default order of the notes in the book with the given name.
+// The order is local to this device and is not synced.
+func setNoteSort(ctx context.DnoteCtx, name, sort string) error {
+	if err := validate.NoteSort(sort); err != nil {
+		return err
+	}
+
+	uuid, err := getBookUUID(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ctx.DB.Exec("UPDATE books SET note_sort = ? WHERE uuid = ?", sort, uuid); err != nil {
+		return errors.Wrap(err, "updating the sort")
+	}
+
+	return nil
+}
+
+func newSortRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		if len(args) == 1 {
+			uuid, err := getBookUUID(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			var sort string
+			if err := ctx.DB.QueryRow("SELECT note_sort FROM books WHERE uuid = ?", uuid).Scan(&sort); err != nil {
+				return errors.Wrap(err, "getting the sort")
+			}
+			if sort == "" {
+				sort = database.NoteSortManual
+			}
+
+			log.Plainf("%s\n", sort)
+
+			return nil
+		}
+
+		sort := args[1]
+		if err := setNoteSort(ctx, name, sort); err != nil {
+			return err
+		}
+
+		log.Successf("the notes in the book '%s' are now listed in the %s order\n", name, sort)
+
+		return nil
+	}
+}
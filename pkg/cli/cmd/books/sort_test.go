@@ -0,0 +1,65 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+)
+
+func TestSetNoteSort(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "linux", 1, false)
+
+		// execute
+		if err := setNoteSort(ctx, "Linux", database.NoteSortAlphabetical); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		var sort string
+		var dirty bool
+		database.MustScan(t, "getting b1", ctx.DB.QueryRow("SELECT note_sort, dirty FROM books WHERE uuid = ?", "b1-uuid"), &sort, &dirty)
+		assert.Equal(t, sort, database.NoteSortAlphabetical, "sort mismatch")
+		assert.Equal(t, dirty, false, "dirty mismatch")
+	})
+
+	t.Run("unknown sort", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "linux")
+
+		// execute
+		err := setNoteSort(ctx, "linux", "random")
+
+		// test
+		assert.Equal(t, err, validate.ErrNoteSortInvalid, "error mismatch")
+	})
+}
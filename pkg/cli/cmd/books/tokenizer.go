@@ -0,0 +1,123 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var tokenizerExample = `
+ * Show the tokenizer that the search uses for the book 'japanese'
+ dnote books tokenizer japanese
+
+ * Search the notes in the book 'japanese' by any part of three or more characters
+ dnote books tokenizer japanese trigram
+
+ * Search the notes in the book 'french' by the words without stemming them in English
+ dnote books tokenizer french unicode61`
+
+func tokenizerPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newTokenizerCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "tokenizer <book name> [porter|unicode61|trigram]",
+		Short:             "Show or set the tokenizer that the search uses for a book",
+		Example:           tokenizerExample,
+		PreRunE:           tokenizerPreRun,
+		RunE:              newTokenizerRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	return cmd
+}
+
+// getTokenizerNames returns the names of the tokenizers that a book can use
+func getTokenizerNames() []string {
+	ret := []string{}
+	for _, r := range database.FTSRoutes {
+		ret = append(ret, r.Tokenizer)
+	}
+
+	return ret
+}
+
+// setTokenizer sets the tokenizer of the book with the given name. The triggers move
+// the notes in the book to the search index for the tokenizer. The tokenizer is local
+// to this device and is not synced.
+func setTokenizer(ctx context.DnoteCtx, name, tokenizer string) error {
+	if !database.IsTokenizer(tokenizer) {
+		return errors.Errorf("unknown tokenizer '%s'. Use one of %s", tokenizer, strings.Join(getTokenizerNames(), ", "))
+	}
+
+	uuid, err := getBookUUID(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ctx.DB.Exec("UPDATE books SET tokenizer = ? WHERE uuid = ?", tokenizer, uuid); err != nil {
+		return errors.Wrap(err, "updating the tokenizer")
+	}
+
+	return nil
+}
+
+func newTokenizerRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		if len(args) == 1 {
+			uuid, err := getBookUUID(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			var tokenizer string
+			if err := ctx.DB.QueryRow("SELECT tokenizer FROM books WHERE uuid = ?", uuid).Scan(&tokenizer); err != nil {
+				return errors.Wrap(err, "getting the tokenizer")
+			}
+
+			log.Plainf("%s\n", tokenizer)
+
+			return nil
+		}
+
+		tokenizer := args[1]
+		if err := setTokenizer(ctx, name, tokenizer); err != nil {
+			return err
+		}
+
+		log.Successf("the search now uses %s for the book '%s'\n", tokenizer, name)
+
+		return nil
+	}
+}
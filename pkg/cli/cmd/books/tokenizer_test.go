@@ -0,0 +1,81 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package books
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestSetTokenizer(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		db := ctx.DB
+		database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "japanese", 1, false)
+		database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "東京タワーに行った", 1)
+
+		// execute
+		if err := setTokenizer(ctx, "japanese", database.TokenizerTrigram); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		var tokenizer string
+		var dirty bool
+		database.MustScan(t, "getting b1", db.QueryRow("SELECT tokenizer, dirty FROM books WHERE uuid = ?", "b1-uuid"), &tokenizer, &dirty)
+		assert.Equal(t, tokenizer, database.TokenizerTrigram, "tokenizer mismatch")
+		assert.Equal(t, dirty, false, "dirty mismatch")
+
+		var count int
+		database.MustScan(t, "searching", db.QueryRow("SELECT count(*) FROM note_fts_trigram WHERE note_fts_trigram MATCH ?", "タワー"), &count)
+		assert.Equal(t, count, 1, "search result count mismatch")
+
+		// the notes added later are routed as well
+		database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "タワーの高さ", 2)
+		database.MustScan(t, "searching again", db.QueryRow("SELECT count(*) FROM note_fts_trigram WHERE note_fts_trigram MATCH ?", "タワー"), &count)
+		assert.Equal(t, count, 2, "search result count mismatch after insert")
+
+		problems, err := database.CheckFTS(db)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "checking the search index"))
+		}
+		assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+	})
+
+	t.Run("unknown tokenizer", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "japanese")
+
+		// execute
+		err := setTokenizer(ctx, "japanese", "icu")
+
+		// test
+		assert.Equal(t, err.Error(), "unknown tokenizer 'icu'. Use one of porter, unicode61, trigram", "error mismatch")
+	})
+}
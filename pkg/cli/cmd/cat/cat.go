@@ -21,11 +21,13 @@ package cat
 import (
 	"strconv"
 
+	"github.com/dnote/dnote/pkg/cli/completion"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/deprecation"
 	"github.com/dnote/dnote/pkg/cli/infra"
-	"github.com/dnote/dnote/pkg/cli/log"
 	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/thin"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -35,10 +37,8 @@ var example = `
  dnote cat javascript 2
  `
 
-var deprecationWarning = `and "view" will replace it in the future version.
-
- Run "dnote view --help" for more information.
-`
+// bookNameUsage is the deprecated usage of passing the book name along with the note id
+var bookNameUsage = deprecation.Usage("dnote view <book name> <note id>", `"dnote view <note id>"`, "1.0.0")
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) != 2 {
@@ -51,15 +51,17 @@ func preRun(cmd *cobra.Command, args []string) error {
 // NewCmd returns a new cat command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:        "cat <book name> <note index>",
-		Aliases:    []string{"c"},
-		Short:      "See a note",
-		Example:    example,
-		RunE:       NewRun(ctx, false),
-		PreRunE:    preRun,
-		Deprecated: deprecationWarning,
+		Use:               "cat <book name> <note index>",
+		Aliases:           []string{"c"},
+		Short:             "See a note",
+		Example:           example,
+		RunE:              NewRun(ctx, false),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+		PreRunE:           preRun,
 	}
 
+	deprecation.Command(cmd, `"dnote view"`, "1.0.0")
+
 	return cmd
 }
 
@@ -69,7 +71,7 @@ func NewRun(ctx context.DnoteCtx, contentOnly bool) infra.RunEFunc {
 		var noteRowIDArg string
 
 		if len(args) == 2 {
-			log.Plain(log.ColorYellow.Sprintf("DEPRECATED: you no longer need to pass book name to the view command. e.g. `dnote view 123`.\n\n"))
+			deprecation.Warn(bookNameUsage)
 
 			noteRowIDArg = args[1]
 		} else {
@@ -81,13 +83,23 @@ func NewRun(ctx context.DnoteCtx, contentOnly bool) infra.RunEFunc {
 			return errors.Wrap(err, "invalid rowid")
 		}
 
+		if err := thin.EnsureBody(ctx, noteRowID); err != nil {
+			return errors.Wrap(err, "getting the note body")
+		}
+
 		db := ctx.DB
 		info, err := database.GetNoteInfo(db, noteRowID)
 		if err != nil {
 			return err
 		}
 
-		if contentOnly {
+		if err := database.MarkNoteViewed(db, ctx.Clock, noteRowID); err != nil {
+			return errors.Wrap(err, "recording the view")
+		}
+
+		if output.IsJSON() {
+			return output.JSON(output.NewNote(info))
+		} else if contentOnly {
 			output.NoteContent(info)
 		} else {
 			output.NoteInfo(info)
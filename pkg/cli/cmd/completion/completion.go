@@ -0,0 +1,84 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package completion
+
+import (
+	"io"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Load the bash completions in the current shell
+ source <(dnote completion bash)
+
+ * Install the zsh completions
+ dnote completion zsh > "${fpath[1]}/_dnote"
+
+ * Install the fish completions
+ dnote completion fish > ~/.config/fish/completions/dnote.fish
+
+ * Load the PowerShell completions in the current session
+ dnote completion powershell | Out-String | Invoke-Expression`
+
+// shells are the shells for which the completion scripts can be generated
+var shells = []string{"bash", "zsh", "fish", "powershell"}
+
+// NewCmd returns a new completion command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "completion <bash|zsh|fish|powershell>",
+		Short:     "Generate the shell completion script",
+		Example:   example,
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: shells,
+		RunE:      newRun(ctx),
+	}
+
+	return cmd
+}
+
+// generate writes the completion script of the root command for the given shell
+func generate(root *cobra.Command, shell string, w io.Writer) error {
+	switch shell {
+	case "bash":
+		return root.GenBashCompletion(w)
+	case "zsh":
+		return root.GenZshCompletion(w)
+	case "fish":
+		return root.GenFishCompletion(w, true)
+	case "powershell":
+		return root.GenPowerShellCompletion(w)
+	}
+
+	return errors.Errorf("unsupported shell '%s'", shell)
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := generate(cmd.Root(), args[0], cmd.OutOrStdout()); err != nil {
+			return errors.Wrap(err, "generating the completion script")
+		}
+
+		return nil
+	}
+}
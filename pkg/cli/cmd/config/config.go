@@ -0,0 +1,180 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/dnote/dnote/pkg/cli/config"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * List the settings and their values
+ dnote config list
+
+ * Show the editor
+ dnote config get editor
+
+ * Keep the removed notes in the trash for a week
+ dnote config set trash.retentionDays 7
+
+ * Go back to the default retention
+ dnote config set trash.retentionDays ""`
+
+// NewCmd returns a new config command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "config",
+		Short:   "Read and write the settings in the config file",
+		Example: example,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get <setting>",
+		Short: "Print the value of a setting",
+		Args:  cobra.ExactArgs(1),
+		RunE:  newGetRun(ctx),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set <setting> <value>",
+		Short: "Set a setting. An empty value restores the default",
+		Args:  cobra.ExactArgs(2),
+		RunE:  newSetRun(ctx),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the settings and their values",
+		Args:  cobra.NoArgs,
+		RunE:  newListRun(ctx),
+	})
+
+	return cmd
+}
+
+// setting is a setting along with its value in effect
+type setting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Configured is false if the value is the default
+	Configured bool   `json:"configured"`
+	Usage      string `json:"usage"`
+}
+
+// newSetting returns the setting with its value in effect
+func newSetting(cf config.Config, k config.Key) setting {
+	ret := setting{Name: k.Name, Usage: k.Usage}
+
+	ret.Value, ret.Configured = k.Get(cf)
+	if !ret.Configured {
+		ret.Value = k.Default
+	}
+
+	return ret
+}
+
+// setValue sets a setting in the config file
+func setValue(ctx context.DnoteCtx, name, val string) error {
+	cf, err := config.Read(ctx)
+	if err != nil {
+		return errors.Wrap(err, "reading the config")
+	}
+
+	if err := config.Set(&cf, name, val); err != nil {
+		return err
+	}
+
+	if err := config.Write(ctx, cf); err != nil {
+		return errors.Wrap(err, "writing the config")
+	}
+
+	return nil
+}
+
+func newGetRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		cf, err := config.Read(ctx)
+		if err != nil {
+			return errors.Wrap(err, "reading the config")
+		}
+
+		k, err := config.FindKey(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(newSetting(cf, k).Value)
+
+		return nil
+	}
+}
+
+func newSetRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name, val := args[0], args[1]
+
+		if err := setValue(ctx, name, val); err != nil {
+			return err
+		}
+
+		if val == "" {
+			log.Successf("restored the default of %s\n", name)
+		} else {
+			log.Successf("set %s to %s\n", name, val)
+		}
+
+		return nil
+	}
+}
+
+func newListRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		cf, err := config.Read(ctx)
+		if err != nil {
+			return errors.Wrap(err, "reading the config")
+		}
+
+		settings := []setting{}
+		for _, k := range config.Keys {
+			settings = append(settings, newSetting(cf, k))
+		}
+
+		if output.IsJSON() {
+			return output.JSON(settings)
+		}
+
+		for _, s := range settings {
+			line := fmt.Sprintf("%s = %s", s.Name, s.Value)
+			if !s.Configured {
+				line = fmt.Sprintf("%s %s", line, log.ColorGray.Sprint("(default)"))
+			}
+
+			log.Plainf("%s\n", line)
+		}
+
+		log.Plainf("\n%s\n", log.ColorGray.Sprintf("config file: %s", config.GetPath(ctx)))
+
+		return nil
+	}
+}
@@ -0,0 +1,232 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package demo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/dnote/dnote/pkg/cli/cmd/add"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var resetFlag bool
+var yesFlag bool
+
+var example = `
+ * Try dnote in a sandbox with example notes
+ dnote demo
+
+ * Remove the sandbox
+ dnote demo --reset`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+	if infra.IsDemo() {
+		return errors.New("already in the demo. Type `exit` to leave it")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new demo command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "demo",
+		Short:   "Try dnote in a sandbox with example notes",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&resetFlag, "reset", "", false, "Remove the sandbox")
+	f.BoolVarP(&yesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+func maybeConfirm(message string, defaultValue bool) (bool, error) {
+	if yesFlag {
+		return true, nil
+	}
+
+	return ui.Confirm(message, defaultValue)
+}
+
+// sampleNote is an example note written to the sandbox
+type sampleNote struct {
+	book    string
+	content string
+}
+
+// sampleNotes are the notes in the sandbox. The first one has the id 1, as used in the tasks.
+var sampleNotes = []sampleNote{
+	{"welcome", "Welcome to the dnote demo. Nothing you do here touches your notes, so feel free to edit or remove anything."},
+	{"javascript", "A closure is a function that remembers the variables of the scope in which it was created."},
+	{"javascript", "Array.prototype.flatMap maps each element and flattens the result by one level."},
+	{"javascript", "Promises are eager: the executor runs as soon as the promise is created."},
+	{"linux", "`lsof -i :8080` lists the processes listening on the port 8080."},
+	{"linux", "`tar -xzf archive.tar.gz -C dir` extracts a gzipped archive into dir."},
+	{"git", "`git commit --fixup <commit>` creates a commit to be squashed by `git rebase -i --autosquash`."},
+}
+
+// tasks are the suggested commands to try in the sandbox
+var tasks = []struct {
+	command     string
+	description string
+}{
+	{"dnote view", "list the books"},
+	{"dnote view javascript", "list the notes in a book"},
+	{"dnote find closure", "search the notes"},
+	{"dnote edit 1", "edit a note in your editor"},
+	{"dnote add linux -c \"df -h shows the disk usage\"", "add a note"},
+	{"dnote status", "see what the next sync would upload"},
+}
+
+// createSandbox creates the sandbox with the example notes if it does not exist.
+// It returns true if the sandbox was created.
+func createSandbox(ctx context.DnoteCtx) (bool, error) {
+	ok, err := utils.FileExists(infra.GetDemoDir(ctx.Paths))
+	if err != nil {
+		return false, errors.Wrap(err, "checking the sandbox")
+	}
+	if ok {
+		return false, nil
+	}
+
+	demoCtx, err := infra.InitPaths(infra.GetDemoPaths(ctx.Paths), ctx.APIEndpoint, ctx.Version)
+	if err != nil {
+		return false, errors.Wrap(err, "initializing the sandbox")
+	}
+	defer demoCtx.DB.Close()
+
+	ts := ctx.Clock.Now().UnixNano()
+	for i, n := range sampleNotes {
+		// keep the notes in the order in which they are listed
+		if _, err := add.WriteNote(*demoCtx, n.book, "", n.content, "", "", ts+int64(i)); err != nil {
+			return false, errors.Wrap(err, "writing an example note")
+		}
+	}
+
+	return true, nil
+}
+
+// resetSandbox removes the sandbox
+func resetSandbox(ctx context.DnoteCtx) error {
+	if err := os.RemoveAll(infra.GetDemoDir(ctx.Paths)); err != nil {
+		return errors.Wrap(err, "removing the sandbox")
+	}
+
+	return nil
+}
+
+func printTasks() {
+	log.Plain("Try these commands. They only change the notes in the sandbox.\n\n")
+	for i, t := range tasks {
+		log.Plainf("%d. %s\n", i+1, t.description)
+		log.Plainf("   %s\n", log.ColorYellow.Sprint(t.command))
+	}
+	log.Plain("\n")
+	log.Plainf("Type `exit` to leave the demo. To run a single command in the sandbox instead, set %s=1.\n", infra.DemoEnv)
+}
+
+// getShell returns the command to start the shell of the user
+func getShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+
+		return "cmd.exe"
+	}
+
+	return "/bin/sh"
+}
+
+// runShell starts the shell of the user in the sandbox and waits for it to exit
+func runShell() error {
+	cmd := exec.Command(getShell())
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=1", infra.DemoEnv))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		// the exit status of the last command in the shell is not an error of the demo
+		if _, ok := err.(*exec.ExitError); !ok {
+			return errors.Wrap(err, "running the shell")
+		}
+	}
+
+	return nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if resetFlag {
+			ok, err := maybeConfirm("remove the sandbox of the demo?", false)
+			if err != nil {
+				return errors.Wrap(err, "getting confirmation")
+			}
+			if !ok {
+				log.Warnf("aborted by user\n")
+				return nil
+			}
+
+			if err := resetSandbox(ctx); err != nil {
+				return err
+			}
+
+			log.Success("removed the sandbox\n")
+			return nil
+		}
+
+		created, err := createSandbox(ctx)
+		if err != nil {
+			return err
+		}
+		if created {
+			log.Successf("created a sandbox with %d example notes\n", len(sampleNotes))
+		}
+
+		printTasks()
+
+		if err := runShell(); err != nil {
+			return err
+		}
+
+		log.Info("left the demo. Your notes are as they were. Run `dnote demo --reset` to start over.\n")
+
+		return nil
+	}
+}
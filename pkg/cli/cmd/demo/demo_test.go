@@ -0,0 +1,95 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package demo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestSandbox(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "real")
+
+	// execute
+	created, err := createSandbox(ctx)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating the sandbox"))
+	}
+
+	// test
+	assert.Equal(t, created, true, "created mismatch")
+
+	demoPaths := infra.GetDemoPaths(ctx.Paths)
+	db, err := database.Open(filepath.Join(demoPaths.Data, consts.DnoteDirName, consts.DnoteDBFileName))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the sandbox database"))
+	}
+
+	var noteCount, bookCount, matchCount int
+	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	database.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books WHERE label = ?", "real"), &bookCount)
+	database.MustScan(t, "searching notes", db.QueryRow("SELECT count(*) FROM note_fts WHERE note_fts MATCH ?", "closure"), &matchCount)
+	assert.Equal(t, noteCount, len(sampleNotes), "note count mismatch")
+	assert.Equal(t, bookCount, 0, "the sandbox should not have the books of the user")
+	assert.Equal(t, matchCount, 1, "match count mismatch")
+
+	var body string
+	database.MustScan(t, "getting the first note", db.QueryRow("SELECT body FROM notes WHERE rowid = 1"), &body)
+	assert.Equal(t, body, sampleNotes[0].content, "first note mismatch")
+	db.Close()
+
+	created, err = createSandbox(ctx)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating the sandbox again"))
+	}
+	assert.Equal(t, created, false, "created mismatch for the existing sandbox")
+
+	if err := resetSandbox(ctx); err != nil {
+		t.Fatal(errors.Wrap(err, "resetting"))
+	}
+
+	ok, err := utils.FileExists(infra.GetDemoDir(ctx.Paths))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "checking the sandbox"))
+	}
+	assert.Equal(t, ok, false, "the sandbox should be removed")
+
+	var userBookCount int
+	database.MustScan(t, "counting the books of the user", ctx.DB.QueryRow("SELECT count(*) FROM books"), &userBookCount)
+	assert.Equal(t, userBookCount, 1, "the books of the user should be kept")
+}
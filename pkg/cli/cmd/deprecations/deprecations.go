@@ -0,0 +1,74 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package deprecations
+
+import (
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/deprecation"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * List the deprecated commands, flags and usages
+ dnote deprecations`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new deprecations command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "deprecations",
+		Short:   "List the deprecated commands, flags and usages",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		deprecations := deprecation.List()
+		if len(deprecations) == 0 {
+			log.Info("nothing is deprecated\n")
+			return nil
+		}
+
+		for _, d := range deprecations {
+			var overdue string
+			if d.IsOverdue(ctx.Version) {
+				overdue = log.ColorRed.Sprintf(" (overdue for removal)")
+			}
+
+			log.Printf("%s %s: %s%s\n", log.ColorYellow.Sprintf("[%s]", d.Kind), d.Name, d.Message(), overdue)
+		}
+
+		return nil
+	}
+}
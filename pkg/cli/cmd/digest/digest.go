@@ -0,0 +1,305 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package digest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/cmd/add"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/progress"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// digestBookLabel is the label of the book into which the digests are saved
+const digestBookLabel = "digests"
+
+const (
+	formatTerminal = "terminal"
+	formatMarkdown = "markdown"
+)
+
+var example = `
+ * See the notes added or edited in the last 7 days
+ dnote digest
+
+ * See the notes added or edited today
+ dnote digest --since 1d
+
+ * Mail the digest of the last week in Markdown
+ dnote digest --since 1w --format markdown | mail -s "Weekly notes" me@example.com
+
+ * Save the digest as a note in the "digests" book
+ dnote digest --save`
+
+var sinceFlag string
+var formatFlag string
+var saveFlag bool
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	if formatFlag != "" && formatFlag != formatTerminal && formatFlag != formatMarkdown {
+		return errors.Errorf("invalid format '%s'. Use 'terminal' or 'markdown'", formatFlag)
+	}
+
+	return nil
+}
+
+// NewCmd returns a new digest command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "digest",
+		Short:   "See a digest of the recently added and edited notes",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&sinceFlag, "since", "s", "7d", "include the notes added or edited since the given duration such as 12h, 7d or 2w, date or RFC3339 time")
+	f.StringVarP(&formatFlag, "format", "f", "", "the format of the digest: terminal or markdown. Defaults to markdown if the output is not a terminal")
+	f.BoolVarP(&saveFlag, "save", "", false, fmt.Sprintf("save the digest in Markdown as a note in the '%s' book", digestBookLabel))
+
+	return cmd
+}
+
+// entry is a note in a digest
+type entry struct {
+	RowID    int
+	Title    string
+	AddedOn  int64
+	EditedOn int64
+	// Added is true if the note was added, rather than only edited, in the period
+	Added bool
+}
+
+// time returns the time of the change that included the entry in the digest
+func (e entry) time() int64 {
+	if e.Added {
+		return e.AddedOn
+	}
+
+	return e.EditedOn
+}
+
+// section is the entries of a book in a digest
+type section struct {
+	BookLabel string
+	Entries   []entry
+}
+
+// digest is the notes added and edited in a period, grouped by book
+type digest struct {
+	Since    time.Time
+	Until    time.Time
+	Sections []section
+}
+
+// counts returns the number of the notes added and edited in the digest
+func (d digest) counts() (int, int) {
+	var added, edited int
+	for _, s := range d.Sections {
+		for _, e := range s.Entries {
+			if e.Added {
+				added++
+			} else {
+				edited++
+			}
+		}
+	}
+
+	return added, edited
+}
+
+// getDigest returns the notes added or edited between the given times, grouped by book
+// in the order of the labels. The notes in the digests book are left out.
+func getDigest(db *database.DB, since, until time.Time) (digest, error) {
+	ret := digest{Since: since, Until: until}
+
+	rows, err := db.Query(`SELECT notes.rowid, books.label, notes.title, notes.body, notes.added_on, notes.edited_on
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.deleted = ? AND books.label != ? AND (notes.added_on >= ? OR notes.edited_on >= ?)
+		ORDER BY books.label ASC`, false, digestBookLabel, since.UnixNano(), since.UnixNano())
+	if err != nil {
+		return ret, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e entry
+		var label, body string
+		if err := rows.Scan(&e.RowID, &label, &e.Title, &body, &e.AddedOn, &e.EditedOn); err != nil {
+			return ret, errors.Wrap(err, "scanning a note")
+		}
+
+		if e.Title == "" {
+			e.Title = database.InferTitle(body)
+		}
+		e.Added = e.AddedOn >= since.UnixNano()
+
+		n := len(ret.Sections)
+		if n == 0 || ret.Sections[n-1].BookLabel != label {
+			ret.Sections = append(ret.Sections, section{BookLabel: label})
+			n++
+		}
+		ret.Sections[n-1].Entries = append(ret.Sections[n-1].Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "iterating notes")
+	}
+
+	for _, s := range ret.Sections {
+		entries := s.Entries
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].time() > entries[j].time()
+		})
+	}
+
+	return ret, nil
+}
+
+// formatDate formats the given time in unix nanoseconds as a date in the local time zone
+func formatDate(ts int64) string {
+	return time.Unix(0, ts).Local().Format("2006-01-02")
+}
+
+func getSummary(d digest) string {
+	added, edited := d.counts()
+
+	return fmt.Sprintf("%d added and %d edited since %s", added, edited, d.Since.Local().Format("2006-01-02 15:04"))
+}
+
+func getTitle(d digest) string {
+	return fmt.Sprintf("Digest %s", d.Until.Local().Format("2006-01-02"))
+}
+
+// renderMarkdown writes the given digest in Markdown
+func renderMarkdown(w io.Writer, d digest) {
+	fmt.Fprintf(w, "# %s\n\n", getTitle(d))
+	fmt.Fprintf(w, "%s.\n", getSummary(d))
+
+	for _, s := range d.Sections {
+		fmt.Fprintf(w, "\n## %s\n\n", s.BookLabel)
+
+		for _, e := range s.Entries {
+			verb := "edited"
+			if e.Added {
+				verb = "added"
+			}
+
+			fmt.Fprintf(w, "- %s _(%s %s)_\n", e.Title, verb, formatDate(e.time()))
+		}
+	}
+}
+
+// renderTerminal writes the given digest for reading in a terminal
+func renderTerminal(w io.Writer, d digest) {
+	if len(d.Sections) == 0 {
+		fmt.Fprintf(w, "no notes added or edited since %s\n", d.Since.Local().Format("2006-01-02 15:04"))
+		return
+	}
+
+	for i, s := range d.Sections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\n", log.ColorBlue.Sprint(s.BookLabel))
+
+		for _, e := range s.Entries {
+			mark := log.ColorGreen.Sprint("+")
+			if !e.Added {
+				mark = log.ColorYellow.Sprint("~")
+			}
+
+			fmt.Fprintf(w, "  %s %s %s %s\n", mark, log.ColorYellow.Sprintf("(%d)", e.RowID), strings.TrimSpace(e.Title), log.ColorGray.Sprint(formatDate(e.time())))
+		}
+	}
+
+	fmt.Fprintf(w, "\n%s\n", log.ColorGray.Sprint(getSummary(d)))
+}
+
+// saveDigest writes the given digest in Markdown as a note in the digests book, and
+// returns the rowid of the note
+func saveDigest(ctx context.DnoteCtx, d digest) (int, error) {
+	var b strings.Builder
+	renderMarkdown(&b, d)
+
+	rowID, err := add.WriteNote(ctx, digestBookLabel, getTitle(d), b.String(), "", "markdown", ctx.Clock.Now().UnixNano())
+	if err != nil {
+		return 0, errors.Wrap(err, "writing the note")
+	}
+
+	return rowID, nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		now := ctx.Clock.Now()
+
+		since, err := utils.ParseSince(sinceFlag, now)
+		if err != nil {
+			return errors.Errorf("invalid since '%s'. Use a duration such as 12h, 7d or 2w, a date such as 2020-03-14, or a time in RFC3339", sinceFlag)
+		}
+
+		d, err := getDigest(ctx.DB, since, now)
+		if err != nil {
+			return errors.Wrap(err, "getting the digest")
+		}
+
+		if saveFlag {
+			rowID, err := saveDigest(ctx, d)
+			if err != nil {
+				return errors.Wrap(err, "saving the digest")
+			}
+
+			log.Successf("saved the digest as note %d in '%s'\n", rowID, digestBookLabel)
+			return nil
+		}
+
+		format := formatFlag
+		if format == "" {
+			format = formatTerminal
+			if !progress.IsTerminal(os.Stdout) {
+				format = formatMarkdown
+			}
+		}
+
+		if format == formatMarkdown {
+			renderMarkdown(os.Stdout, d)
+		} else {
+			renderTerminal(os.Stdout, d)
+		}
+
+		return nil
+	}
+}
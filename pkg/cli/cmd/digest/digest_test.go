@@ -0,0 +1,160 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func setupNotes(t *testing.T, db *database.DB, now time.Time) {
+	day := int64(24 * time.Hour)
+	ts := now.UnixNano()
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b3-uuid", digestBookLabel)
+
+	// added recently
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "# closures\nbody", ts-2*day, 0)
+	// added and edited recently
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, title, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "promises", "body", ts-day, ts-day/2)
+	// edited recently
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "flexbox", ts-30*day, ts-3*day)
+	// old
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n4-uuid", "b2-uuid", "grid", ts-30*day, ts-20*day)
+	// removed
+	database.MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n5-uuid", "b2-uuid", "float", ts-day, 0, true)
+	// digest
+	database.MustExec(t, "inserting n6", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n6-uuid", "b3-uuid", "# Digest", ts-day, 0)
+}
+
+func TestGetDigest(t *testing.T) {
+	now := time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	setupNotes(t, ctx.DB, now)
+
+	since, err := utils.ParseSince("7d", now)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing since"))
+	}
+
+	d, err := getDigest(ctx.DB, since, now)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the digest"))
+	}
+
+	assert.Equal(t, len(d.Sections), 2, "section count mismatch")
+	assert.Equal(t, d.Sections[0].BookLabel, "css", "section 0 label mismatch")
+	assert.Equal(t, len(d.Sections[0].Entries), 1, "section 0 entry count mismatch")
+	assert.Equal(t, d.Sections[0].Entries[0].Title, "flexbox", "section 0 entry 0 title mismatch")
+	assert.Equal(t, d.Sections[0].Entries[0].Added, false, "section 0 entry 0 added mismatch")
+	assert.Equal(t, d.Sections[1].BookLabel, "js", "section 1 label mismatch")
+	assert.Equal(t, len(d.Sections[1].Entries), 2, "section 1 entry count mismatch")
+	assert.Equal(t, d.Sections[1].Entries[0].Title, "promises", "section 1 entry 0 title mismatch")
+	assert.Equal(t, d.Sections[1].Entries[0].Added, true, "section 1 entry 0 added mismatch")
+	assert.Equal(t, d.Sections[1].Entries[1].Title, "closures", "section 1 entry 1 title mismatch")
+
+	added, edited := d.counts()
+	assert.Equal(t, added, 2, "added count mismatch")
+	assert.Equal(t, edited, 1, "edited count mismatch")
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	since := time.Date(2020, 3, 8, 10, 0, 0, 0, time.Local)
+	until := time.Date(2020, 3, 15, 10, 0, 0, 0, time.Local)
+	d := digest{
+		Since: since,
+		Until: until,
+		Sections: []section{
+			{
+				BookLabel: "css",
+				Entries:   []entry{{RowID: 3, Title: "flexbox", AddedOn: 1, EditedOn: time.Date(2020, 3, 12, 0, 0, 0, 0, time.Local).UnixNano()}},
+			},
+			{
+				BookLabel: "js",
+				Entries:   []entry{{RowID: 1, Title: "closures", AddedOn: time.Date(2020, 3, 13, 0, 0, 0, 0, time.Local).UnixNano(), Added: true}},
+			},
+		},
+	}
+
+	var b strings.Builder
+	renderMarkdown(&b, d)
+
+	expected := `# Digest 2020-03-15
+
+1 added and 1 edited since 2020-03-08 10:00.
+
+## css
+
+- flexbox _(edited 2020-03-12)_
+
+## js
+
+- closures _(added 2020-03-13)_
+`
+	assert.Equal(t, b.String(), expected, "digest mismatch")
+}
+
+func TestSaveDigest(t *testing.T) {
+	now := time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	c := clock.NewMock()
+	c.SetNow(now)
+	ctx.Clock = c
+
+	setupNotes(t, ctx.DB, now)
+
+	d, err := getDigest(ctx.DB, now.AddDate(0, 0, -7), now)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the digest"))
+	}
+
+	rowID, err := saveDigest(ctx, d)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "saving the digest"))
+	}
+
+	var title, body, contentType, bookUUID string
+	database.MustScan(t, "getting the digest note", ctx.DB.QueryRow("SELECT title, body, content_type, book_uuid FROM notes WHERE rowid = ?", rowID), &title, &body, &contentType, &bookUUID)
+	assert.Equal(t, title, "Digest 2020-03-15", "title mismatch")
+	assert.Equal(t, bookUUID, "b3-uuid", "book mismatch")
+	assert.Equal(t, contentType, "markdown", "content type mismatch")
+	assert.Equal(t, strings.Contains(body, "## js\n"), true, "body should contain the js section")
+	assert.Equal(t, strings.Contains(body, "Digest\n"), false, "body should not contain the previous digest")
+}
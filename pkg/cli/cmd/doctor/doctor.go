@@ -0,0 +1,667 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package doctor
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/migrate"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// orphanBookLabel is the label of the book into which the notes without a book are moved
+const orphanBookLabel = "orphaned"
+
+var fixFlag bool
+var systemFlag bool
+
+var example = `
+ * Check the local database for problems
+ dnote doctor
+
+ * Check and repair the problems that can be repaired safely
+ dnote doctor --fix
+
+ * Check the keys in the system table and remove the obsolete and stale ones
+ dnote doctor --system --fix`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new doctor command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "doctor",
+		Short:   "Check the local database for problems",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&fixFlag, "fix", false, "repair the problems that can be repaired safely")
+	f.BoolVar(&systemFlag, "system", false, "check the keys in the system table instead")
+
+	return cmd
+}
+
+// check is a diagnosis of the local database
+type check struct {
+	name string
+	// find returns the descriptions of the problems found
+	find func(ctx context.DnoteCtx) ([]string, error)
+	// fix repairs the problems. It is nil if they cannot be repaired safely.
+	fix func(ctx context.DnoteCtx) error
+	// hint tells how to resolve the problems that are not repaired by fix
+	hint string
+}
+
+var checks = []check{
+	{
+		name: "notes without a book",
+		find: findOrphanedNotes,
+		fix:  fixOrphanedNotes,
+	},
+	{
+		name: "invalid usn",
+		find: findInvalidUSNs,
+		fix:  fixInvalidUSNs,
+		hint: "run `dnote sync --full` to reconcile them with the server",
+	},
+	{
+		name: "full text search index",
+		find: findBrokenIndex,
+		fix:  fixBrokenIndex,
+	},
+	{
+		name: "duplicate book names",
+		find: findDuplicateBooks,
+		hint: "run `dnote books dedupe` to merge them",
+	},
+	{
+		name: "schema",
+		find: findSchemaDrift,
+		fix:  fixSchemaDrift,
+		hint: "upgrade dnote to the latest version",
+	},
+	{
+		name: "indexes",
+		find: findMissingIndexes,
+		fix:  fixMissingIndexes,
+	},
+	{
+		name: "connection settings",
+		find: findSettingsProblems,
+		hint: "WAL mode needs a local file system. Keep the database off network drives, using --db if needed",
+	},
+}
+
+// systemCheck finds the keys in the system table that are not registered in consts.SystemKeys,
+// or whose values are invalid or stale
+var systemCheck = check{
+	name: "system keys",
+	find: findSystemProblems,
+	fix:  fixSystemProblems,
+	hint: "unknown keys may have been written by a newer version of dnote, and are left as they are",
+}
+
+// queryStrings returns the first column of the rows returned by the query
+func queryStrings(db *database.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying")
+	}
+	defer rows.Close()
+
+	ret := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+func findOrphanedNotes(ctx context.DnoteCtx) ([]string, error) {
+	uuids, err := queryStrings(ctx.DB, `SELECT uuid FROM notes
+		WHERE deleted = ? AND book_uuid NOT IN (SELECT uuid FROM books WHERE deleted = ?)`, false, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding notes without a book")
+	}
+
+	ret := []string{}
+	for _, uuid := range uuids {
+		ret = append(ret, fmt.Sprintf("note %s belongs to a book that does not exist", uuid))
+	}
+
+	return ret, nil
+}
+
+// getOrphanBookUUID returns the uuid of the book for the notes without a book, creating it if needed
+func getOrphanBookUUID(tx *database.DB) (string, error) {
+	var ret string
+	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ? AND deleted = ?", orphanBookLabel, false).Scan(&ret)
+	if err == nil {
+		return ret, nil
+	} else if err != sql.ErrNoRows {
+		return "", errors.Wrap(err, "finding the book")
+	}
+
+	ret, err = utils.GenerateUUID()
+	if err != nil {
+		return "", errors.Wrap(err, "generating uuid")
+	}
+
+	b := database.NewBook(ret, orphanBookLabel, 0, false, true)
+	if err := b.Insert(tx); err != nil {
+		return "", errors.Wrap(err, "creating the book")
+	}
+
+	return ret, nil
+}
+
+// fixOrphanedNotes moves the notes without a book into a book, and marks them dirty so
+// that they are uploaded in the book on the next sync
+func fixOrphanedNotes(ctx context.DnoteCtx) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	bookUUID, err := getOrphanBookUUID(tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "getting the book '%s'", orphanBookLabel)
+	}
+
+	if _, err := tx.Exec(`UPDATE notes SET book_uuid = ?, dirty = ?
+		WHERE deleted = ? AND book_uuid NOT IN (SELECT uuid FROM books WHERE deleted = ?)`, bookUUID, true, false, false); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "moving the notes")
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+// getLastMaxUSN returns the max_usn of the server at the last sync
+func getLastMaxUSN(db *database.DB) (int, error) {
+	var ret int
+	err := db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastMaxUSN).Scan(&ret)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, errors.Wrap(err, "querying the last max_usn")
+	}
+
+	return ret, nil
+}
+
+func findInvalidUSNs(ctx context.DnoteCtx) ([]string, error) {
+	lastMaxUSN, err := getLastMaxUSN(ctx.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, table := range []string{"books", "notes"} {
+		kind := strings.TrimSuffix(table, "s")
+
+		// the server assigns the usn, which is never negative or beyond the max_usn at the last sync
+		invalid, err := queryStrings(ctx.DB, fmt.Sprintf("SELECT uuid FROM %s WHERE dirty = ? AND (usn < 0 OR usn > ?)", table), true, lastMaxUSN)
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding %s with invalid usn", table)
+		}
+		for _, uuid := range invalid {
+			ret = append(ret, fmt.Sprintf("%s %s has a usn that the server cannot have assigned", kind, uuid))
+		}
+
+		// items never uploaded must be dirty, or they are never uploaded
+		unsent, err := queryStrings(ctx.DB, fmt.Sprintf("SELECT uuid FROM %s WHERE usn = 0 AND dirty = ? AND deleted = ?", table), false, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding %s that are not uploaded", table)
+		}
+		for _, uuid := range unsent {
+			ret = append(ret, fmt.Sprintf("%s %s has never been uploaded and is not marked to be uploaded", kind, uuid))
+		}
+	}
+
+	return ret, nil
+}
+
+// fixInvalidUSNs marks the items that have never been uploaded to be uploaded, and resets the
+// negative usn so that the items are uploaded as new. The usn beyond the last max_usn is left
+// for the full sync to reconcile, because the item may exist on the server.
+func fixInvalidUSNs(ctx context.DnoteCtx) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	for _, table := range []string{"books", "notes"} {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET usn = 0 WHERE dirty = ? AND usn < 0", table), true); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "resetting the negative usn of %s", table)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET dirty = ? WHERE usn = 0 AND dirty = ? AND deleted = ?", table), true, false, false); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "marking %s to be uploaded", table)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func findBrokenIndex(ctx context.DnoteCtx) ([]string, error) {
+	return database.CheckFTS(ctx.DB)
+}
+
+func fixBrokenIndex(ctx context.DnoteCtx) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := database.RebuildFTS(tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "rebuilding the search index")
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func findDuplicateBooks(ctx context.DnoteCtx) ([]string, error) {
+	ret := []string{}
+
+	// duplicates are possible only if the unique index on the labels is missing
+	labels, err := queryStrings(ctx.DB, "SELECT label FROM books WHERE deleted = ? GROUP BY label HAVING count(*) > 1", false)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding duplicate book names")
+	}
+	for _, label := range labels {
+		ret = append(ret, fmt.Sprintf("more than one book is named '%s'", label))
+	}
+
+	if !ctx.CaseSensitiveBooks {
+		groups, err := database.GetBookLabelCollisions(ctx.DB)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding books whose names differ only in case")
+		}
+		for _, g := range groups {
+			ret = append(ret, fmt.Sprintf("books %s have names that differ only in case", strings.Join(g, ", ")))
+		}
+	}
+
+	return ret, nil
+}
+
+// requiredObjects are the tables, indices and triggers that the migrations create
+var requiredObjects = []string{
+	"books",
+	"notes",
+	"system",
+	"note_fts",
+	"notes_after_insert",
+	"notes_after_delete",
+	"notes_after_update",
+	"note_fts_unicode61",
+	"note_fts_trigram",
+}
+
+// getSchema returns the version of the schema with the given key
+func getSchema(db *database.DB, key string) (int, error) {
+	var ret int
+	err := db.QueryRow("SELECT value FROM system WHERE key = ?", key).Scan(&ret)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, errors.Wrapf(err, "querying %s", key)
+	}
+
+	return ret, nil
+}
+
+func findSchemaDrift(ctx context.DnoteCtx) ([]string, error) {
+	ret := []string{}
+
+	schema, err := getSchema(ctx.DB, consts.SystemSchema)
+	if err != nil {
+		return nil, err
+	}
+	if schema < len(migrate.LocalSequence) {
+		ret = append(ret, fmt.Sprintf("%d migrations have not been run", len(migrate.LocalSequence)-schema))
+	} else if schema > len(migrate.LocalSequence) {
+		ret = append(ret, fmt.Sprintf("the schema version %d is newer than this version of dnote supports (%d)", schema, len(migrate.LocalSequence)))
+	}
+
+	remoteSchema, err := getSchema(ctx.DB, consts.SystemRemoteSchema)
+	if err != nil {
+		return nil, err
+	}
+	if remoteSchema > len(migrate.RemoteSequence) {
+		ret = append(ret, fmt.Sprintf("the remote schema version %d is newer than this version of dnote supports (%d)", remoteSchema, len(migrate.RemoteSequence)))
+	}
+
+	for _, name := range requiredObjects {
+		var count int
+		if err := ctx.DB.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = ?", name).Scan(&count); err != nil {
+			return nil, errors.Wrapf(err, "finding %s", name)
+		}
+		if count == 0 {
+			ret = append(ret, fmt.Sprintf("%s is missing", name))
+		}
+	}
+
+	return ret, nil
+}
+
+// fixSchemaDrift runs the migrations that have not been run
+func fixSchemaDrift(ctx context.DnoteCtx) error {
+	if err := migrate.Run(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+		return errors.Wrap(err, "running the migrations")
+	}
+
+	return nil
+}
+
+func findMissingIndexes(ctx context.DnoteCtx) ([]string, error) {
+	missing, err := database.FindMissingIndexes(ctx.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, idx := range missing {
+		ret = append(ret, fmt.Sprintf("%s is missing", idx.Name))
+	}
+
+	return ret, nil
+}
+
+// fixMissingIndexes creates the missing indexes
+func fixMissingIndexes(ctx context.DnoteCtx) error {
+	missing, err := database.FindMissingIndexes(ctx.DB)
+	if err != nil {
+		return err
+	}
+
+	return database.CreateIndexes(ctx.DB, missing)
+}
+
+// getSettingsProblems returns the descriptions of the connection settings that differ
+// from the ones with which the database is opened
+func getSettingsProblems(settings database.Settings) []string {
+	ret := []string{}
+
+	if settings.JournalMode != database.JournalModeWAL {
+		ret = append(ret, fmt.Sprintf("the journal mode is %s instead of %s", settings.JournalMode, database.JournalModeWAL))
+	}
+	if settings.Synchronous != database.SynchronousNormal {
+		ret = append(ret, fmt.Sprintf("synchronous is %d instead of %d (NORMAL)", settings.Synchronous, database.SynchronousNormal))
+	}
+	if !settings.ForeignKeys {
+		ret = append(ret, "foreign keys are not enforced")
+	}
+	if settings.BusyTimeout == 0 {
+		ret = append(ret, "there is no busy timeout")
+	}
+
+	return ret
+}
+
+func findSettingsProblems(ctx context.DnoteCtx) ([]string, error) {
+	settings, err := database.GetSettings(ctx.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	return getSettingsProblems(settings), nil
+}
+
+// systemProblem is a problem with a key in the system table
+type systemProblem struct {
+	key         string
+	description string
+	// remove is true if the key can be removed safely
+	remove bool
+	// reset is the value to which the key is reset. Empty if it cannot be reset.
+	reset string
+}
+
+// isObsoleteSystemKey returns true if the key was written by an older version and is no longer read
+func isObsoleteSystemKey(key string) bool {
+	for _, k := range consts.ObsoleteSystemKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSystemProblems returns the problems with the keys in the system table
+func getSystemProblems(db *database.DB) ([]systemProblem, error) {
+	rows, err := db.Query("SELECT key, value FROM system ORDER BY key ASC")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the system table")
+	}
+	defer rows.Close()
+
+	values := map[string]string{}
+	keys := []string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		values[key] = value
+		keys = append(keys, key)
+	}
+
+	ret := []systemProblem{}
+	for _, key := range keys {
+		value := values[key]
+
+		if isObsoleteSystemKey(key) {
+			ret = append(ret, systemProblem{key: key, description: fmt.Sprintf("%s is no longer used", key), remove: true})
+			continue
+		}
+
+		k, ok := consts.GetSystemKey(key)
+		if !ok {
+			ret = append(ret, systemProblem{key: key, description: fmt.Sprintf("%s is unknown", key)})
+			continue
+		}
+
+		if _, ok := values[k.Requires]; k.Requires != "" && !ok {
+			ret = append(ret, systemProblem{key: key, description: fmt.Sprintf("%s is stale without %s", key, k.Requires), remove: true})
+			continue
+		}
+
+		if _, err := strconv.ParseInt(value, 10, 64); k.Integer && err != nil {
+			ret = append(ret, systemProblem{
+				key:         key,
+				description: fmt.Sprintf("%s has an invalid value '%s'", key, value),
+				remove:      k.Default == "" && k.Optional,
+				reset:       k.Default,
+			})
+		}
+	}
+
+	return ret, nil
+}
+
+func findSystemProblems(ctx context.DnoteCtx) ([]string, error) {
+	problems, err := getSystemProblems(ctx.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, p := range problems {
+		ret = append(ret, p.description)
+	}
+
+	return ret, nil
+}
+
+// fixSystemProblems removes the obsolete and stale keys and resets or removes the invalid
+// values. The unknown keys are left, because a newer version of dnote may rely on them.
+func fixSystemProblems(ctx context.DnoteCtx) error {
+	problems, err := getSystemProblems(ctx.DB)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	for _, p := range problems {
+		if p.reset != "" {
+			if err := database.UpdateSystem(tx, p.key, p.reset); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "resetting %s", p.key)
+			}
+		} else if p.remove {
+			if err := database.DeleteSystem(tx, p.key); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "removing %s", p.key)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+// getFixCommand returns the command that repairs the problems found by the current run
+func getFixCommand() string {
+	if systemFlag {
+		return "dnote doctor --system --fix"
+	}
+
+	return "dnote doctor --fix"
+}
+
+// runCheck runs the check, repairing the problems if requested. It returns the number of
+// the problems that remain.
+func runCheck(ctx context.DnoteCtx, c check) (int, error) {
+	problems, err := c.find(ctx)
+	if err != nil {
+		return 0, errors.Wrapf(err, "checking %s", c.name)
+	}
+
+	if len(problems) == 0 {
+		log.Successf("%s\n", c.name)
+		return 0, nil
+	}
+
+	log.Warnf("%s: %d problems\n", c.name, len(problems))
+	for _, p := range problems {
+		log.Plainf("  %s\n", p)
+	}
+
+	if fixFlag && c.fix != nil {
+		if err := c.fix(ctx); err != nil {
+			return 0, errors.Wrapf(err, "fixing %s", c.name)
+		}
+
+		problems, err = c.find(ctx)
+		if err != nil {
+			return 0, errors.Wrapf(err, "checking %s again", c.name)
+		}
+
+		if len(problems) == 0 {
+			log.Successf("fixed\n")
+			return 0, nil
+		}
+
+		log.Warnf("%d problems could not be fixed\n", len(problems))
+	} else if c.fix != nil {
+		log.Plainf("  run `%s` to repair them\n", getFixCommand())
+		return len(problems), nil
+	}
+
+	if c.hint != "" {
+		log.Plainf("  %s\n", c.hint)
+	}
+
+	return len(problems), nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		cs := checks
+		if systemFlag {
+			cs = []check{systemCheck}
+		}
+
+		var total int
+		for _, c := range cs {
+			count, err := runCheck(ctx, c)
+			if err != nil {
+				return err
+			}
+
+			total += count
+		}
+
+		if total > 0 {
+			return errors.Errorf("found %d problems", total)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,316 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package doctor
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestOrphanedNotes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "js", 1)
+	database.MustExec(t, "inserting n1", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 2, false)
+	database.MustExec(t, "inserting n2", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "missing-uuid", "n2 body", 1, 3, false)
+	database.MustExec(t, "inserting n3", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", "missing-uuid", "", 1, 4, true)
+
+	// execute
+	problems, err := findOrphanedNotes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(problems), 1, "problem count mismatch")
+
+	if err := fixOrphanedNotes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	problems, err = findOrphanedNotes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(problems), 0, "problem count mismatch after fix")
+
+	var bookUUID, bookLabel string
+	var bookDirty, noteDirty bool
+	database.MustScan(t, "getting n2", ctx.DB.QueryRow("SELECT book_uuid, dirty FROM notes WHERE uuid = ?", "n2-uuid"), &bookUUID, &noteDirty)
+	database.MustScan(t, "getting the book", ctx.DB.QueryRow("SELECT label, dirty FROM books WHERE uuid = ?", bookUUID), &bookLabel, &bookDirty)
+	assert.Equal(t, bookLabel, orphanBookLabel, "book label mismatch")
+	assert.Equal(t, bookDirty, true, "book dirty mismatch")
+	assert.Equal(t, noteDirty, true, "note dirty mismatch")
+
+	var n1BookUUID, n3BookUUID string
+	database.MustScan(t, "getting n1", ctx.DB.QueryRow("SELECT book_uuid FROM notes WHERE uuid = ?", "n1-uuid"), &n1BookUUID)
+	database.MustScan(t, "getting n3", ctx.DB.QueryRow("SELECT book_uuid FROM notes WHERE uuid = ?", "n3-uuid"), &n3BookUUID)
+	assert.Equal(t, n1BookUUID, "b1-uuid", "n1 book_uuid mismatch")
+	assert.Equal(t, n3BookUUID, "missing-uuid", "n3 book_uuid mismatch")
+}
+
+func TestInvalidUSNs(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting last max usn", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 10)
+	database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "js", 0, false)
+	database.MustExec(t, "inserting n1", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 5, true)
+	database.MustExec(t, "inserting n2", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 1, -1, true)
+	database.MustExec(t, "inserting n3", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 body", 1, 11, true)
+
+	// execute
+	problems, err := findInvalidUSNs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(problems), 3, "problem count mismatch")
+
+	if err := fixInvalidUSNs(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	problems, err = findInvalidUSNs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{"note n3-uuid has a usn that the server cannot have assigned"}, "problems mismatch after fix")
+
+	var b1Dirty bool
+	var n2USN int
+	database.MustScan(t, "getting b1", ctx.DB.QueryRow("SELECT dirty FROM books WHERE uuid = ?", "b1-uuid"), &b1Dirty)
+	database.MustScan(t, "getting n2", ctx.DB.QueryRow("SELECT usn FROM notes WHERE uuid = ?", "n2-uuid"), &n2USN)
+	assert.Equal(t, b1Dirty, true, "b1 dirty mismatch")
+	assert.Equal(t, n2USN, 0, "n2 usn mismatch")
+}
+
+func TestBrokenIndex(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting n1", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "foo bar", 1)
+
+	problems, err := findBrokenIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(problems), 0, "problem count mismatch before breaking the index")
+
+	database.MustExec(t, "removing n1 from the index", ctx.DB, "INSERT INTO note_fts(note_fts, rowid, body) VALUES ('delete', 1, 'foo bar')")
+
+	// execute
+	problems, err = findBrokenIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(problems), 1, "problem count mismatch")
+
+	if err := fixBrokenIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	problems, err = findBrokenIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(problems), 0, "problem count mismatch after fix")
+
+	var count int
+	database.MustScan(t, "searching", ctx.DB.QueryRow("SELECT count(*) FROM note_fts WHERE note_fts MATCH ?", "foo"), &count)
+	assert.Equal(t, count, 1, "search result count mismatch")
+}
+
+func TestDuplicateBooks(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "JS")
+	database.MustExec(t, "inserting b3", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b3-uuid", "css")
+
+	t.Run("case insensitive", func(t *testing.T) {
+		problems, err := findDuplicateBooks(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.DeepEqual(t, problems, []string{"books js, JS have names that differ only in case"}, "problems mismatch")
+	})
+
+	t.Run("case sensitive", func(t *testing.T) {
+		c := ctx
+		c.CaseSensitiveBooks = true
+
+		problems, err := findDuplicateBooks(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+	})
+}
+
+func TestSchemaDrift(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MarkMigrationComplete(t, ctx.DB)
+
+	problems, err := findSchemaDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+
+	// execute
+	database.MustExec(t, "updating the schema", ctx.DB, "UPDATE system SET value = value + 1 WHERE key = ?", consts.SystemSchema)
+	database.MustExec(t, "dropping a trigger", ctx.DB, "DROP TRIGGER notes_after_insert")
+
+	problems, err = findSchemaDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	assert.Equal(t, len(problems), 2, "problem count mismatch")
+	assert.Equal(t, problems[1], "notes_after_insert is missing", "problem mismatch")
+}
+
+func TestMissingIndexes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	problems, err := findMissingIndexes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{}, "problems mismatch before dropping")
+
+	database.MustExec(t, "dropping an index", ctx.DB, "DROP INDEX idx_notes_dirty")
+
+	// execute
+	problems, err = findMissingIndexes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{"idx_notes_dirty is missing"}, "problems mismatch")
+
+	if err := fixMissingIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	problems, err = findMissingIndexes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{}, "problems mismatch after fix")
+}
+
+func TestSettingsProblems(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	// execute
+	problems, err := findSettingsProblems(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+
+	got := getSettingsProblems(database.Settings{JournalMode: "delete", Synchronous: 2})
+	expected := []string{
+		"the journal mode is delete instead of wal",
+		"synchronous is 2 instead of 1 (NORMAL)",
+		"foreign keys are not enforced",
+		"there is no busy timeout",
+	}
+	assert.DeepEqual(t, got, expected, "problems mismatch for other settings")
+}
+
+func TestSystemProblems(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting last max usn", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, "12")
+	database.MustExec(t, "inserting last sync at", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastSyncAt, "invalid")
+	database.MustExec(t, "inserting last export at", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastExportAt, "invalid")
+	database.MustExec(t, "inserting session key expiry", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSessionKeyExpiry, 123)
+	database.MustExec(t, "inserting bookmark", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", "bookmark", 3)
+	database.MustExec(t, "inserting an unknown key", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", "from_the_future", "x")
+
+	// execute
+	problems, err := findSystemProblems(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{
+		"bookmark is no longer used",
+		"from_the_future is unknown",
+		"last_export_at has an invalid value 'invalid'",
+		"last_sync_time has an invalid value 'invalid'",
+		"session_token_expiry is stale without session_token",
+	}, "problems mismatch")
+
+	if err := fixSystemProblems(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	problems, err = findSystemProblems(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{"from_the_future is unknown"}, "problems mismatch after fix")
+
+	for _, key := range []string{"bookmark", consts.SystemLastExportAt, consts.SystemSessionKeyExpiry} {
+		var count int
+		database.MustScan(t, "counting "+key, ctx.DB.QueryRow("SELECT count(*) FROM system WHERE key = ?", key), &count)
+		assert.Equal(t, count, 0, key+" should have been removed")
+	}
+
+	var lastMaxUSN, lastSyncAt string
+	database.MustScan(t, "getting last max usn", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastMaxUSN), &lastMaxUSN)
+	database.MustScan(t, "getting last sync at", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastSyncAt), &lastSyncAt)
+	assert.Equal(t, lastMaxUSN, "12", "last max usn mismatch")
+	assert.Equal(t, lastSyncAt, "0", "last sync at mismatch")
+}
@@ -34,17 +34,32 @@ func validateRunBookFlags() error {
 	if contentFlag != "" {
 		return errors.New("--content is invalid for editing a book")
 	}
+	if fileFlag != "" {
+		return errors.New("--file is invalid for editing a book")
+	}
 	if bookFlag != "" {
 		return errors.New("--book is invalid for editing a book")
 	}
+	if titleFlag != "" {
+		return errors.New("--title is invalid for editing a book")
+	}
+	if languageFlag != "" {
+		return errors.New("--language is invalid for editing a book")
+	}
+	if typeFlag != "" {
+		return errors.New("--type is invalid for editing a book")
+	}
+	if publicFlag || unlistedFlag || privateFlag {
+		return errors.New("--public, --unlisted and --private are invalid for editing a book")
+	}
 
 	return nil
 }
 
 func waitEditorBookName(ctx context.DnoteCtx) (string, error) {
-	fpath, err := ui.GetTmpContentPath(ctx)
+	fpath, err := ui.CreateTmpContentFile(ctx, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "getting temporarily content file path")
+		return "", errors.Wrap(err, "preparing tmp content file")
 	}
 
 	c, err := ui.GetEditorInput(ctx, fpath)
@@ -79,6 +94,11 @@ func runBook(ctx context.DnoteCtx, bookName string) error {
 	}
 
 	db := ctx.DB
+	bookName, err = database.ResolveBookLabel(db, bookName, ctx.CaseSensitiveBooks)
+	if err != nil {
+		return errors.Wrap(err, "resolving the book")
+	}
+
 	uuid, err := database.GetBookUUID(db, bookName)
 	if err != nil {
 		return errors.Wrap(err, "getting book uuid")
@@ -94,6 +114,15 @@ func runBook(ctx context.DnoteCtx, bookName string) error {
 		return errors.Wrap(err, "validating book name")
 	}
 
+	// Allow changing the case of the label, but not colliding with another book
+	existing, err := database.ResolveBookLabel(db, name, ctx.CaseSensitiveBooks)
+	if err != nil {
+		return errors.Wrap(err, "resolving the new name")
+	}
+	if existing != name && existing != bookName {
+		return errors.Errorf("book '%s' already exists", existing)
+	}
+
 	tx, err := ctx.DB.Begin()
 	if err != nil {
 		return errors.Wrap(err, "beginning a transaction")
@@ -0,0 +1,117 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package edit
+
+import (
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/frontmatter"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// noteMeta is the metadata of a note edited in the frontmatter of the editor buffer
+type noteMeta struct {
+	Book string `yaml:"book"`
+	// Title is empty if the title is the first line of the content
+	Title string `yaml:"title"`
+	// Visibility is one of private, unlisted and public
+	Visibility string `yaml:"visibility"`
+}
+
+// noteEdit is the change made to a note in the editor. The fields are empty or nil
+// if they are unchanged.
+type noteEdit struct {
+	content    string
+	book       string
+	title      string
+	visibility string
+}
+
+// getNoteMeta returns the metadata of the note in the book with the given label
+func getNoteMeta(note database.Note, bookLabel string) noteMeta {
+	ret := noteMeta{
+		Book:       bookLabel,
+		Visibility: note.Visibility,
+	}
+	if ret.Visibility == "" {
+		ret.Visibility = database.VisibilityFromPublic(note.Public)
+	}
+
+	// an inferred title is left empty so that it keeps following the content
+	if note.Title != database.InferTitle(note.Body) {
+		ret.Title = note.Title
+	}
+
+	return ret
+}
+
+// renderBuffer returns the editor buffer for the note in the book with the given label
+func renderBuffer(note database.Note, bookLabel string) ([]byte, error) {
+	return frontmatter.Render(getNoteMeta(note, bookLabel), note.Body)
+}
+
+// parseBuffer returns the change made to the note in the book with the given label from
+// the editor buffer. If the frontmatter has been removed, only the content is changed.
+func parseBuffer(s string, note database.Note, bookLabel string) (noteEdit, error) {
+	var ret noteEdit
+
+	fmStr, body := frontmatter.Split(s)
+	if body != note.Body {
+		ret.content = body
+	}
+	if fmStr == "" {
+		return ret, nil
+	}
+
+	var meta noteMeta
+	if err := yaml.Unmarshal([]byte(fmStr), &meta); err != nil {
+		return ret, errors.Wrap(err, "parsing the frontmatter")
+	}
+
+	old := getNoteMeta(note, bookLabel)
+
+	if meta.Book != "" && meta.Book != old.Book {
+		if err := validate.BookName(meta.Book); err != nil {
+			return ret, errors.Wrap(err, "invalid book name")
+		}
+
+		ret.book = meta.Book
+	}
+	if meta.Title != old.Title {
+		if err := validate.NoteTitle(meta.Title); err != nil {
+			return ret, errors.Wrap(err, "invalid title")
+		}
+
+		ret.title = meta.Title
+		// an empty title goes back to the first line of the content
+		if ret.title == "" {
+			ret.title = database.InferTitle(body)
+		}
+	}
+	if meta.Visibility != "" && meta.Visibility != old.Visibility {
+		if err := validate.NoteVisibility(meta.Visibility); err != nil {
+			return ret, errors.Wrap(err, "invalid visibility")
+		}
+
+		ret.visibility = meta.Visibility
+	}
+
+	return ret, nil
+}
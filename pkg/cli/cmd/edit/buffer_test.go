@@ -0,0 +1,124 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package edit
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/database"
+)
+
+func TestRenderBuffer(t *testing.T) {
+	testCases := []struct {
+		note     database.Note
+		expected string
+	}{
+		{
+			note:     database.Note{Title: "closures", Body: "closures\nfunctions with their scope", Public: true, Visibility: "unlisted"},
+			expected: "---\nbook: js\ntitle: \"\"\nvisibility: unlisted\n---\n\nclosures\nfunctions with their scope",
+		},
+		{
+			note:     database.Note{Title: "scope", Body: "closures\nfunctions with their scope"},
+			expected: "---\nbook: js\ntitle: scope\nvisibility: private\n---\n\nclosures\nfunctions with their scope",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.note.Title, func(t *testing.T) {
+			b, err := renderBuffer(tc.note, "js")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, string(b), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestParseBuffer(t *testing.T) {
+	note := database.Note{Title: "closures", Body: "closures\nbody"}
+	explicit := database.Note{Title: "scope", Body: "closures\nbody"}
+
+	testCases := []struct {
+		name     string
+		note     database.Note
+		input    string
+		expected noteEdit
+	}{
+		{
+			name:     "unchanged",
+			note:     note,
+			input:    "---\nbook: js\ntitle: \"\"\nvisibility: private\n---\n\nclosures\nbody",
+			expected: noteEdit{},
+		},
+		{
+			name:     "content",
+			note:     note,
+			input:    "---\nbook: js\ntitle: \"\"\nvisibility: private\n---\n\nclosures\nnew body",
+			expected: noteEdit{content: "closures\nnew body"},
+		},
+		{
+			name:     "metadata",
+			note:     note,
+			input:    "---\nbook: css\ntitle: new title\nvisibility: public\n---\n\nclosures\nbody",
+			expected: noteEdit{book: "css", title: "new title", visibility: "public"},
+		},
+		{
+			name:     "title cleared",
+			note:     explicit,
+			input:    "---\nbook: js\ntitle: \"\"\nvisibility: private\n---\n\nlambdas\nbody",
+			expected: noteEdit{content: "lambdas\nbody", title: "lambdas"},
+		},
+		{
+			name:     "frontmatter removed",
+			note:     note,
+			input:    "closures\nnew body",
+			expected: noteEdit{content: "closures\nnew body"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseBuffer(tc.input, tc.note, "js")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, got.content, tc.expected.content, "content mismatch")
+			assert.Equal(t, got.book, tc.expected.book, "book mismatch")
+			assert.Equal(t, got.title, tc.expected.title, "title mismatch")
+			assert.Equal(t, got.visibility, tc.expected.visibility, "visibility mismatch")
+		})
+	}
+
+	t.Run("invalid visibility", func(t *testing.T) {
+		_, err := parseBuffer("---\nbook: js\ntitle: \"\"\nvisibility: listed\n---\n\nclosures\nbody", note, "js")
+		if err == nil {
+			t.Fatal("error should have been returned")
+		}
+	})
+
+	t.Run("multiline title", func(t *testing.T) {
+		_, err := parseBuffer("---\ntitle: |\n  line 1\n  line 2\n---\n\nbody", note, "js")
+		if err == nil {
+			t.Fatal("error should have been returned")
+		}
+	})
+}
@@ -19,28 +19,68 @@
 package edit
 
 import (
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
 	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/deprecation"
 	"github.com/dnote/dnote/pkg/cli/infra"
-	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/picker"
 	"github.com/dnote/dnote/pkg/cli/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var contentFlag string
+var fileFlag string
 var bookFlag string
+var titleFlag string
 var nameFlag string
+var languageFlag string
+var typeFlag string
+var publicFlag bool
+var unlistedFlag bool
+var privateFlag bool
+var forceFlag bool
+var interactiveFlag bool
+
+// bookNameUsage is the deprecated usage of passing the book name along with the note id
+var bookNameUsage = deprecation.Usage("dnote edit <book name> <note id>", `"dnote edit <note id>"`, "1.0.0")
 
 var example = `
   * Edit a note by id
   dnote edit 3
 
+  * Pick a note to edit from a list
+  dnote edit
+
   * Edit a note without launching an editor
   dnote edit 3 -c "new content"
 
+  * Replace the content of a note with the standard input
+  echo "new content" | dnote edit 3
+
+  * Replace the content of a note with a file
+  dnote edit 3 -f note.md
+
   * Move a note to another book
   dnote edit 3 -b javascript
 
+  * Set the title of a note
+  dnote edit 3 --title "Closures"
+
+  * Set the language of a note
+  dnote edit 3 -l en-US
+
+  * Mark a note as code
+  dnote edit 3 -t code
+
+  * Make a note public and list it on your profile
+  dnote edit 3 --public
+
+  * Share a note only with those who have its link
+  dnote edit 3 --unlisted
+
   * Rename a book
   dnote edit javascript
 
@@ -51,35 +91,64 @@ var example = `
 // NewCmd returns a new edit command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "edit <note id|book name>",
-		Short:   "Edit a note or a book",
-		Aliases: []string{"e"},
-		Example: example,
-		PreRunE: preRun,
-		RunE:    newRun(ctx),
+		Use:               "edit <note id|book name?>",
+		Short:             "Edit a note or a book",
+		Aliases:           []string{"e"},
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.NoteOrBookArgs(ctx),
 	}
 
 	f := cmd.Flags()
 	f.StringVarP(&contentFlag, "content", "c", "", "a new content for the note")
+	f.StringVarP(&fileFlag, "file", "f", "", "the path to a file to read a new content from, or '-' for the standard input")
 	f.StringVarP(&bookFlag, "book", "b", "", "the name of the book to move the note to")
+	f.StringVarP(&titleFlag, "title", "", "", "a new title for the note")
 	f.StringVarP(&nameFlag, "name", "n", "", "a new name for a book")
+	f.StringVarP(&languageFlag, "language", "l", "", "the language of the note, such as 'en' or 'en-US'")
+	f.StringVarP(&typeFlag, "type", "t", "", "the content type of the note: markdown, plaintext or code")
+	f.BoolVarP(&publicFlag, "public", "", false, "make the note public and list it on your profile")
+	f.BoolVarP(&unlistedFlag, "unlisted", "", false, "make the note visible only to those with its link")
+	f.BoolVarP(&privateFlag, "private", "", false, "make the note private")
+	f.BoolVarP(&forceFlag, "force", "", false, "share the note even if it seems to contain secrets, without confirmation")
+	f.BoolVarP(&interactiveFlag, "interactive", "i", false, "pick a note to edit from a list. This is the default if no argument is given")
+
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
 
 	return cmd
 }
 
 func preRun(cmd *cobra.Command, args []string) error {
-	if len(args) != 1 && len(args) != 2 {
+	if len(args) > 2 {
 		return errors.New("Incorrect number of argument")
 	}
+	if interactiveFlag && len(args) > 0 {
+		return errors.New("--interactive flag is only valid without arguments")
+	}
 
 	return nil
 }
 
 func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
-		// DEPRECATED: Remove in 1.0.0
+		if len(args) == 0 {
+			rowID, err := picker.PickNote(ctx)
+			if err == picker.ErrCancelled {
+				return nil
+			} else if err != nil {
+				return errors.Wrap(err, "picking a note")
+			}
+
+			if err := runNote(ctx, strconv.Itoa(rowID)); err != nil {
+				return errors.Wrap(err, "editing note")
+			}
+
+			return nil
+		}
+
 		if len(args) == 2 {
-			log.Plain(log.ColorYellow.Sprintf("DEPRECATED: you no longer need to pass book name to the view command. e.g. `dnote view 123`.\n\n"))
+			deprecation.Warn(bookNameUsage)
 
 			target := args[1]
 
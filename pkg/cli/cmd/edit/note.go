@@ -21,13 +21,18 @@ package edit
 import (
 	"database/sql"
 	"io/ioutil"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/log"
 	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/secrets"
+	"github.com/dnote/dnote/pkg/cli/thin"
 	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/dnote/dnote/pkg/cli/validate"
 	"github.com/pkg/errors"
 )
 
@@ -35,17 +40,32 @@ func validateRunNoteFlags() error {
 	if nameFlag != "" {
 		return errors.New("--name is invalid for editing a book")
 	}
+	if contentFlag != "" && fileFlag != "" {
+		return errors.New("--content and --file cannot be used together")
+	}
+	if err := validate.NoteTitle(titleFlag); err != nil {
+		return errors.Wrap(err, "invalid title")
+	}
+	if languageFlag != "" {
+		if err := validate.Language(languageFlag); err != nil {
+			return errors.Wrap(err, "invalid language")
+		}
+	}
+	if typeFlag != "" {
+		if err := validate.ContentType(typeFlag); err != nil {
+			return errors.Wrap(err, "invalid type")
+		}
+	}
+	if countTrue(publicFlag, unlistedFlag, privateFlag) > 1 {
+		return errors.New("only one of --public, --unlisted and --private can be used")
+	}
 
 	return nil
 }
 
-func waitEditorNoteContent(ctx context.DnoteCtx, note database.Note) (string, error) {
-	fpath, err := ui.GetTmpContentPath(ctx)
+func waitEditorNoteContent(ctx context.DnoteCtx, buf []byte) (string, error) {
+	fpath, err := ui.CreateTmpContentFile(ctx, buf)
 	if err != nil {
-		return "", errors.Wrap(err, "getting temporarily content file path")
-	}
-
-	if err := ioutil.WriteFile(fpath, []byte(note.Body), 0644); err != nil {
 		return "", errors.Wrap(err, "preparing tmp content file")
 	}
 
@@ -57,17 +77,50 @@ func waitEditorNoteContent(ctx context.DnoteCtx, note database.Note) (string, er
 	return c, nil
 }
 
-func getContent(ctx context.DnoteCtx, note database.Note) (string, error) {
-	if contentFlag != "" {
-		return contentFlag, nil
+// readContent reads a new content from the file, or from the standard input if the path is '-'
+func readContent(path string, stdin *os.File) (string, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		if b, err = ioutil.ReadAll(stdin); err != nil {
+			return "", errors.Wrap(err, "reading the standard input")
+		}
+	} else {
+		if b, err = ioutil.ReadFile(path); err != nil {
+			return "", errors.Wrapf(err, "reading %s", path)
+		}
+	}
+
+	if strings.TrimSpace(string(b)) == "" {
+		return "", errors.New("Empty content")
+	}
+
+	return string(b), nil
+}
+
+// getEditorEdit launches an editor to edit the note, with its book, title and visibility
+// in a frontmatter unless it is turned off in the config, and returns the change made.
+func getEditorEdit(ctx context.DnoteCtx, note database.Note, bookLabel string) (noteEdit, error) {
+	if !ctx.EditorOptions.Frontmatter {
+		c, err := waitEditorNoteContent(ctx, []byte(note.Body))
+		if err != nil {
+			return noteEdit{}, err
+		}
+
+		return noteEdit{content: c}, nil
 	}
 
-	c, err := waitEditorNoteContent(ctx, note)
+	buf, err := renderBuffer(note, bookLabel)
 	if err != nil {
-		return "", errors.Wrap(err, "getting content from editor")
+		return noteEdit{}, errors.Wrap(err, "rendering the editor buffer")
 	}
 
-	return c, nil
+	c, err := waitEditorNoteContent(ctx, buf)
+	if err != nil {
+		return noteEdit{}, err
+	}
+
+	return parseBuffer(c, note, bookLabel)
 }
 
 func changeContent(ctx context.DnoteCtx, tx *database.DB, note database.Note, content string) error {
@@ -83,6 +136,11 @@ func changeContent(ctx context.DnoteCtx, tx *database.DB, note database.Note, co
 }
 
 func moveBook(ctx context.DnoteCtx, tx *database.DB, note database.Note, bookName string) error {
+	bookName, err := database.ResolveBookLabel(tx, bookName, ctx.CaseSensitiveBooks)
+	if err != nil {
+		return errors.Wrap(err, "resolving the book")
+	}
+
 	targetBookUUID, err := database.GetBookUUID(tx, bookName)
 	if err != nil {
 		return errors.Wrap(err, "finding book uuid")
@@ -99,7 +157,75 @@ func moveBook(ctx context.DnoteCtx, tx *database.DB, note database.Note, bookNam
 	return nil
 }
 
-func updateNote(ctx context.DnoteCtx, tx *database.DB, note database.Note, bookName, content string) error {
+// countTrue returns the number of the given values that are true
+func countTrue(vals ...bool) int {
+	var ret int
+	for _, v := range vals {
+		if v {
+			ret++
+		}
+	}
+
+	return ret
+}
+
+// getVisibility returns the visibility requested by the flags, or an empty string if it
+// is not to be changed
+func getVisibility() string {
+	if publicFlag {
+		return database.NoteVisibilityPublic
+	}
+	if unlistedFlag {
+		return database.NoteVisibilityUnlisted
+	}
+	if privateFlag {
+		return database.NoteVisibilityPrivate
+	}
+
+	return ""
+}
+
+// checkSecrets scans the content that is about to be shared for likely secrets, and
+// asks for a confirmation if any is found
+func checkSecrets(content string) error {
+	findings := secrets.Scan(content)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	log.Warnf("the note seems to contain secrets\n")
+	for _, f := range findings {
+		log.Plainf("  %s %s %s\n", log.ColorYellow.Sprintf("line %d:", f.Line), f.Kind, log.ColorGray.Sprintf("(%s)", f.Excerpt))
+	}
+
+	if forceFlag {
+		return nil
+	}
+
+	ok, err := ui.Confirm("share it anyway?", false)
+	if err != nil {
+		return errors.Wrap(err, "getting confirmation")
+	}
+	if !ok {
+		return errors.New("Aborted. Use --force to share the note regardless")
+	}
+
+	return nil
+}
+
+func changeTitle(ctx context.DnoteCtx, tx *database.DB, note database.Note, title string) error {
+	if note.Title == title {
+		return errors.New("Nothing changed")
+	}
+
+	if err := database.UpdateNoteTitle(tx, ctx.Clock, note.RowID, title); err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+func updateNote(ctx context.DnoteCtx, tx *database.DB, note database.Note, bookName, title, content, language, contentType, visibility string) error {
 	if bookName != "" {
 		if err := moveBook(ctx, tx, note, bookName); err != nil {
 			return errors.Wrap(err, "moving book")
@@ -110,6 +236,27 @@ func updateNote(ctx context.DnoteCtx, tx *database.DB, note database.Note, bookN
 			return errors.Wrap(err, "changing content")
 		}
 	}
+	// the title is set after the content, which may have changed the inferred title
+	if title != "" {
+		if err := changeTitle(ctx, tx, note, title); err != nil {
+			return errors.Wrap(err, "changing title")
+		}
+	}
+	if language != "" {
+		if err := database.UpdateNoteLanguage(tx, note.RowID, language); err != nil {
+			return errors.Wrap(err, "changing language")
+		}
+	}
+	if contentType != "" {
+		if err := database.UpdateNoteContentType(tx, note.RowID, contentType); err != nil {
+			return errors.Wrap(err, "changing content type")
+		}
+	}
+	if visibility != "" {
+		if err := database.UpdateNoteVisibility(tx, ctx.Clock, note.RowID, visibility); err != nil {
+			return errors.Wrap(err, "changing visibility")
+		}
+	}
 
 	return nil
 }
@@ -125,6 +272,10 @@ func runNote(ctx context.DnoteCtx, rowIDArg string) error {
 		return errors.Wrap(err, "invalid rowid")
 	}
 
+	if err := thin.EnsureBody(ctx, rowID); err != nil {
+		return errors.Wrap(err, "getting the note body")
+	}
+
 	db := ctx.DB
 	note, err := database.GetActiveNote(db, rowID)
 	if err == sql.ErrNoRows {
@@ -133,24 +284,78 @@ func runNote(ctx context.DnoteCtx, rowIDArg string) error {
 		return errors.Wrap(err, "querying the book")
 	}
 
+	bookName := bookFlag
+	title := titleFlag
 	content := contentFlag
+	visibility := getVisibility()
 
-	// If no flag was provided, launch an editor to get the content
-	if bookFlag == "" && contentFlag == "" {
-		c, err := getContent(ctx, note)
+	if fileFlag != "" {
+		c, err := readContent(fileFlag, os.Stdin)
 		if err != nil {
-			return errors.Wrap(err, "getting content from editor")
+			return errors.Wrap(err, "getting content")
 		}
 
 		content = c
 	}
 
+	noFlags := bookFlag == "" && titleFlag == "" && contentFlag == "" && fileFlag == "" && languageFlag == "" && typeFlag == "" && visibility == ""
+
+	// If no flag was provided, read the content from the standard input if it is piped,
+	// or launch an editor to get the changes
+	if noFlags && ui.IsPiped(os.Stdin) {
+		c, err := readContent("-", os.Stdin)
+		if err != nil {
+			return errors.Wrap(err, "getting content")
+		}
+
+		content = c
+	} else if noFlags {
+		bookLabel, err := database.GetBookLabel(db, note.BookUUID)
+		if err != nil {
+			return errors.Wrap(err, "getting the book label")
+		}
+
+		e, err := getEditorEdit(ctx, note, bookLabel)
+		if err != nil {
+			return errors.Wrap(err, "getting changes from editor")
+		}
+		if e.content == "" && e.book == "" && e.title == "" && e.visibility == "" {
+			return errors.New("Nothing changed")
+		}
+
+		bookName = e.book
+		title = e.title
+		content = e.content
+		visibility = e.visibility
+	}
+
+	// Check for secrets if new content is about to be shared
+	willBePublic := note.Public
+	if visibility != "" {
+		willBePublic = visibility != database.NoteVisibilityPrivate
+	}
+	if willBePublic && (!note.Public || content != "") {
+		body := note.Body
+		if content != "" {
+			body = content
+		}
+
+		if err := checkSecrets(body); err != nil {
+			return err
+		}
+	}
+
 	tx, err := ctx.DB.Begin()
 	if err != nil {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	err = updateNote(ctx, tx, note, bookFlag, content)
+	if err := database.SaveNoteVersion(tx, ctx.Clock, note.UUID, database.NoteVersionEdit, ctx.HistoryRetention); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving a version")
+	}
+
+	err = updateNote(ctx, tx, note, bookName, title, content, languageFlag, typeFlag, visibility)
 	if err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "updating note fields")
@@ -0,0 +1,87 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+)
+
+func TestReadContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnote-edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	}
+
+	open := func(p string) *os.File {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return f
+	}
+
+	t.Run("file", func(t *testing.T) {
+		got, err := readContent(write("note.md", "new content\n"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, got, "new content\n", "content mismatch")
+	})
+
+	t.Run("standard input", func(t *testing.T) {
+		stdin := open(write("stdin", "piped content"))
+		defer stdin.Close()
+
+		got, err := readContent("-", stdin)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, got, "piped content", "content mismatch")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if _, err := readContent(write("empty.md", " \n"), nil); err == nil {
+			t.Fatal("error should have been returned")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := readContent(filepath.Join(dir, "missing.md"), nil); err == nil {
+			t.Fatal("error should have been returned")
+		}
+	})
+}
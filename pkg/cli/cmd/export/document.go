@@ -0,0 +1,312 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+const (
+	// changeTypeBook is the type of the local changes to books
+	changeTypeBook = "book"
+	// changeTypeNote is the type of the local changes to notes
+	changeTypeNote = "note"
+)
+
+// documentVersion is the version of the format of the exported document
+const documentVersion = 1
+
+// document is the exported representation of all books and notes
+type document struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exported_at"`
+	Since      *time.Time `json:"since,omitempty"`
+	Books      []book     `json:"books"`
+	// Deleted lists what was deleted since the previous export in an incremental export
+	Deleted  *deleted `json:"deleted,omitempty"`
+	Manifest manifest `json:"manifest"`
+}
+
+// deleted is the list of the uuids of the books and notes that were deleted, or moved
+// to the trash, since the time of an incremental export
+type deleted struct {
+	Books []string `json:"books"`
+	Notes []string `json:"notes"`
+}
+
+// manifest describes the contents of the document so that a backup can be verified
+type manifest struct {
+	BookCount int `json:"book_count"`
+	NoteCount int `json:"note_count"`
+	// Hashes maps the uuid of each note to the SHA-256 of its content
+	Hashes map[string]string `json:"hashes"`
+}
+
+// book is the exported representation of a book
+type book struct {
+	UUID  string `json:"uuid"`
+	Label string `json:"label"`
+	Notes []note `json:"notes"`
+}
+
+// note is the exported representation of a note
+type note struct {
+	UUID        string     `json:"uuid"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	AddedOn     time.Time  `json:"added_on"`
+	EditedOn    *time.Time `json:"edited_on,omitempty"`
+	Public      bool       `json:"public"`
+	Visibility  string     `json:"visibility"`
+	ContentType string     `json:"content_type"`
+	Language    string     `json:"language,omitempty"`
+	// Metadata is the key-value metadata of the note
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// fromUnixNano converts a timestamp in unix nanoseconds as stored in the
+// database to a time in UTC
+func fromUnixNano(ts int64) time.Time {
+	return time.Unix(0, ts).UTC()
+}
+
+// hashContent returns the hex encoded SHA-256 of the content of a note
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// newManifest returns the manifest of the given books
+func newManifest(books []book) manifest {
+	ret := manifest{
+		BookCount: len(books),
+		Hashes:    map[string]string{},
+	}
+
+	for _, b := range books {
+		for _, n := range b.Notes {
+			ret.NoteCount++
+			ret.Hashes[n.UUID] = hashContent(n.Content)
+		}
+	}
+
+	return ret
+}
+
+// load reads books and notes that are not deleted from the database. If since is
+// not zero, only the notes changed on this device after it, and the books renamed
+// after it together with all of their notes, are read, and the books and notes
+// deleted after it are listed.
+func load(ctx context.DnoteCtx, since int64) (document, error) {
+	db := ctx.DB
+
+	ret := document{
+		Version:    documentVersion,
+		ExportedAt: ctx.Clock.Now().UTC(),
+		Books:      []book{},
+	}
+	if since != 0 {
+		t := fromUnixNano(since)
+		ret.Since = &t
+	}
+
+	changedBooks, err := loadChangedBooks(db, since)
+	if err != nil {
+		return ret, errors.Wrap(err, "loading the changed books")
+	}
+
+	bookRows, err := db.Query("SELECT uuid, label FROM books WHERE deleted = ? ORDER BY label ASC", false)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying books")
+	}
+	defer bookRows.Close()
+
+	bookIdx := map[string]int{}
+	for bookRows.Next() {
+		b := book{Notes: []note{}}
+		if err := bookRows.Scan(&b.UUID, &b.Label); err != nil {
+			return ret, errors.Wrap(err, "scanning a book")
+		}
+
+		bookIdx[b.UUID] = len(ret.Books)
+		ret.Books = append(ret.Books, b)
+	}
+
+	metadata, err := loadMetadata(db)
+	if err != nil {
+		return ret, errors.Wrap(err, "loading the metadata")
+	}
+
+	noteRows, err := db.Query(`SELECT uuid, book_uuid, title, body, added_on, edited_on, public, visibility, content_type, language
+	FROM notes
+	WHERE deleted = ? AND (? = 0
+		OR uuid IN (SELECT uuid FROM local_changes WHERE type = ? AND changed_on > ?)
+		OR book_uuid IN (SELECT uuid FROM local_changes WHERE type = ? AND changed_on > ?))
+	ORDER BY added_on ASC`, false, since, changeTypeNote, since, changeTypeBook, since)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying notes")
+	}
+	defer noteRows.Close()
+
+	for noteRows.Next() {
+		var n note
+		var bookUUID string
+		var addedOn, editedOn int64
+		if err := noteRows.Scan(&n.UUID, &bookUUID, &n.Title, &n.Content, &addedOn, &editedOn, &n.Public, &n.Visibility, &n.ContentType, &n.Language); err != nil {
+			return ret, errors.Wrap(err, "scanning a note")
+		}
+
+		n.AddedOn = fromUnixNano(addedOn)
+		if editedOn != 0 {
+			t := fromUnixNano(editedOn)
+			n.EditedOn = &t
+		}
+
+		idx, ok := bookIdx[bookUUID]
+		if !ok {
+			return ret, errors.Errorf("book %s not found for note %s", bookUUID, n.UUID)
+		}
+
+		n.Metadata = metadata[n.UUID]
+
+		ret.Books[idx].Notes = append(ret.Books[idx].Notes, n)
+	}
+
+	if since != 0 {
+		ret.Books = filterChangedBooks(ret.Books, changedBooks)
+
+		ret.Deleted, err = loadDeleted(db, since)
+		if err != nil {
+			return ret, errors.Wrap(err, "loading the deleted books and notes")
+		}
+	}
+
+	ret.Manifest = newManifest(ret.Books)
+
+	return ret, nil
+}
+
+// loadMetadata returns the key-value metadata of all notes by their uuids
+func loadMetadata(db *database.DB) (map[string]map[string]string, error) {
+	rows, err := db.Query("SELECT note_uuid, key, value FROM note_metadata")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the metadata")
+	}
+	defer rows.Close()
+
+	ret := map[string]map[string]string{}
+	for rows.Next() {
+		var noteUUID, key, value string
+		if err := rows.Scan(&noteUUID, &key, &value); err != nil {
+			return nil, errors.Wrap(err, "scanning the metadata")
+		}
+
+		if ret[noteUUID] == nil {
+			ret[noteUUID] = map[string]string{}
+		}
+		ret[noteUUID][key] = value
+	}
+
+	return ret, rows.Err()
+}
+
+// loadChangedBooks returns the uuids of the books that were changed on this device
+// after the given time
+func loadChangedBooks(db *database.DB, since int64) (map[string]bool, error) {
+	rows, err := db.Query("SELECT uuid FROM local_changes WHERE type = ? AND changed_on > ?", changeTypeBook, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the local changes")
+	}
+	defer rows.Close()
+
+	ret := map[string]bool{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, errors.Wrap(err, "scanning a local change")
+		}
+
+		ret[uuid] = true
+	}
+
+	return ret, rows.Err()
+}
+
+// loadDeleted returns the books and notes that were changed on this device after the
+// given time and are no longer exported because they were deleted or moved to the trash
+func loadDeleted(db *database.DB, since int64) (*deleted, error) {
+	ret := &deleted{}
+
+	var err error
+	ret.Books, err = loadDeletedUUIDs(db, changeTypeBook, "books", since)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading the books")
+	}
+	ret.Notes, err = loadDeletedUUIDs(db, changeTypeNote, "notes", since)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading the notes")
+	}
+
+	return ret, nil
+}
+
+// loadDeletedUUIDs returns the uuids of the changes of the given type after the given
+// time that are not in the given table, or are deleted in it
+func loadDeletedUUIDs(db *database.DB, changeType, table string, since int64) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT uuid FROM local_changes
+	WHERE type = ? AND changed_on > ? AND uuid NOT IN (SELECT uuid FROM %s WHERE deleted = ?)
+	ORDER BY uuid ASC`, table), changeType, since, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the local changes")
+	}
+	defer rows.Close()
+
+	ret := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, errors.Wrap(err, "scanning a local change")
+		}
+
+		ret = append(ret, uuid)
+	}
+
+	return ret, rows.Err()
+}
+
+// filterChangedBooks returns the books that have any notes or were changed
+func filterChangedBooks(books []book, changedBooks map[string]bool) []book {
+	ret := []book{}
+
+	for _, b := range books {
+		if len(b.Notes) > 0 || changedBooks[b.UUID] {
+			ret = append(ret, b)
+		}
+	}
+
+	return ret
+}
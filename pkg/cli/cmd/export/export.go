@@ -0,0 +1,264 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// formatJSON is the format for exporting into a single JSON document
+	formatJSON = "json"
+	// formatMarkdown is the format for exporting into a directory of Markdown files
+	formatMarkdown = "markdown"
+)
+
+// sinceLast is the value for the since flag to export the changes since the last export
+const sinceLast = "last"
+
+var formatFlag string
+var outputFlag string
+var sinceFlag string
+var encryptFlag string
+var recipientsFlag []string
+
+var example = `
+ * Export all notes as a JSON document to the standard output
+ dnote export
+
+ * Export all notes as a JSON document to a file
+ dnote export -o backup.json
+
+ * Export all notes as Markdown files into a directory
+ dnote export --format markdown -o ./notes
+
+ * Export the notes changed since the given time
+ dnote export --since 2020-03-14 -o delta.json
+
+ * Export the notes changed since the last export
+ dnote export --since last -o delta.json
+
+ * Export all notes encrypted for an age recipient
+ dnote export --encrypt age -r age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p -o backup.json.age
+
+ * Export all notes encrypted for GPG keys
+ dnote export --encrypt gpg -r alice@example.com -r bob@example.com -o backup.json.asc`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	if formatFlag != formatJSON && formatFlag != formatMarkdown {
+		return errors.Errorf("Unsupported format '%s'. Use either '%s' or '%s'", formatFlag, formatJSON, formatMarkdown)
+	}
+	if formatFlag == formatMarkdown && outputFlag == "" {
+		return errors.New("Please provide the output directory with --output")
+	}
+	if encryptFlag != "" {
+		if formatFlag != formatJSON {
+			return errors.Errorf("Only the '%s' format can be encrypted", formatJSON)
+		}
+		if len(recipientsFlag) == 0 {
+			return errors.New("Please provide at least one recipient with --recipient")
+		}
+	} else if len(recipientsFlag) > 0 {
+		return errors.New("--recipient requires --encrypt")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new export command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "export",
+		Short:   "Export all books and notes",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&formatFlag, "format", "f", formatJSON, "The export format: json or markdown")
+	f.StringVarP(&outputFlag, "output", "o", "", "The output file for json, or the output directory for markdown")
+	f.StringVarP(&sinceFlag, "since", "s", "", "Only export the notes changed since the given date, time in RFC3339, or 'last' for the last export")
+	f.StringVarP(&encryptFlag, "encrypt", "", "", "Encrypt the json export with a provider: age or gpg")
+	f.StringSliceVarP(&recipientsFlag, "recipient", "r", []string{}, "An age recipient, or a GPG key id or email, to encrypt the export for. Can be given multiple times")
+
+	return cmd
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		since, err := getSince(ctx, sinceFlag)
+		if err != nil {
+			return errors.Wrap(err, "parsing since")
+		}
+
+		if _, err := thin.EnsureBodies(ctx, ""); err != nil {
+			return errors.Wrap(err, "getting the note bodies")
+		}
+
+		doc, err := load(ctx, since)
+		if err != nil {
+			return errors.Wrap(err, "loading books and notes")
+		}
+
+		var p crypt.Provider
+		if encryptFlag != "" {
+			p, err = crypt.NewProvider(encryptFlag, recipientsFlag, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		if formatFlag == formatMarkdown {
+			err = writeMarkdown(doc, outputFlag)
+		} else if outputFlag == "" {
+			err = writeJSON(doc, os.Stdout, p)
+		} else {
+			err = writeJSONFile(doc, outputFlag, p)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "writing %s", formatFlag)
+		}
+
+		if err := saveLastExportAt(ctx, doc.ExportedAt); err != nil {
+			return errors.Wrap(err, "saving the last export time")
+		}
+
+		if outputFlag != "" {
+			log.Successf("exported %s to %s\n", getSummary(doc), outputFlag)
+		}
+
+		return nil
+	}
+}
+
+// getSince parses the value of the since flag and returns a timestamp in unix nanoseconds.
+// It returns 0 if all notes should be exported.
+func getSince(ctx context.DnoteCtx, val string) (int64, error) {
+	if val == "" {
+		return 0, nil
+	}
+
+	if val == sinceLast {
+		var ts int64
+		err := ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastExportAt).Scan(&ts)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		} else if err != nil {
+			return 0, errors.Wrap(err, "getting the last export time")
+		}
+
+		return ts, nil
+	}
+
+	if t, _, err := utils.ParseTime(val); err == nil {
+		return t.UnixNano(), nil
+	}
+
+	return 0, errors.Errorf("invalid time '%s'. Use a date such as 2020-03-14, a time in RFC3339, or '%s'", val, sinceLast)
+}
+
+// saveLastExportAt records the time of the export so that the next export can
+// contain only the changes since then
+func saveLastExportAt(ctx context.DnoteCtx, t time.Time) error {
+	val := strconv.FormatInt(t.UnixNano(), 10)
+
+	if err := database.UpsertSystem(ctx.DB, consts.SystemLastExportAt, val); err != nil {
+		return errors.Wrap(err, "upserting the system record")
+	}
+
+	return nil
+}
+
+// getSummary returns a human readable summary of the number of books and notes in the document
+func getSummary(doc document) string {
+	var noteCount int
+	for _, book := range doc.Books {
+		noteCount += len(book.Notes)
+	}
+
+	return fmt.Sprintf("%d books and %d notes", len(doc.Books), noteCount)
+}
+
+func writeJSONFile(doc document, path string, p crypt.Provider) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating the file")
+	}
+	defer f.Close()
+
+	if err := writeJSON(doc, f, p); err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "flushing the file to disk")
+	}
+
+	return nil
+}
+
+// writeJSON encodes the document as JSON and writes it to the given writer, encrypted
+// with the provider if it is not nil
+func writeJSON(doc document, w io.Writer, p crypt.Provider) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(doc); err != nil {
+		return errors.Wrap(err, "encoding json")
+	}
+
+	if p == nil {
+		if _, err := buf.WriteTo(w); err != nil {
+			return errors.Wrap(err, "writing json")
+		}
+
+		return nil
+	}
+
+	if err := p.Encrypt(w, &buf); err != nil {
+		return errors.Wrapf(err, "encrypting with %s", p.Name())
+	}
+
+	return nil
+}
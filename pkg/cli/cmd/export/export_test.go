@@ -0,0 +1,538 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestLoad(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	now := time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC)
+	c := clock.NewMock()
+	c.SetNow(now)
+	ctx.Clock = c
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b3-uuid", "", true)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, public) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1542058875, 0, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, title, body, added_on, edited_on, public, visibility, content_type) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 title", "n2 body", 1542058876, 1542058877, true, "unlisted", "code")
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "", 1542058878, true)
+	database.MustExec(t, "inserting n2 metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?), (?, ?, ?)", "n2-uuid", "project", "atlas", "n2-uuid", "status", "draft")
+
+	// execute
+	got, err := load(ctx, 0)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	n2EditedOn := time.Unix(0, 1542058877).UTC()
+	expected := document{
+		Version:    documentVersion,
+		ExportedAt: now,
+		Books: []book{
+			{
+				UUID:  "b2-uuid",
+				Label: "css",
+				Notes: []note{},
+			},
+			{
+				UUID:  "b1-uuid",
+				Label: "js",
+				Notes: []note{
+					{
+						UUID:        "n1-uuid",
+						Content:     "n1 body",
+						AddedOn:     time.Unix(0, 1542058875).UTC(),
+						Public:      false,
+						Visibility:  "private",
+						ContentType: "markdown",
+					},
+					{
+						UUID:        "n2-uuid",
+						Title:       "n2 title",
+						Content:     "n2 body",
+						AddedOn:     time.Unix(0, 1542058876).UTC(),
+						EditedOn:    &n2EditedOn,
+						Public:      true,
+						Visibility:  "unlisted",
+						ContentType: "code",
+						Metadata:    map[string]string{"project": "atlas", "status": "draft"},
+					},
+				},
+			},
+		},
+		Manifest: manifest{
+			BookCount: 2,
+			NoteCount: 2,
+			Hashes: map[string]string{
+				"n1-uuid": hashContent("n1 body"),
+				"n2-uuid": hashContent("n2 body"),
+			},
+		},
+	}
+
+	assert.DeepEqual(t, got, expected, "document mismatch")
+}
+
+// setChangedOn sets the time of the last local change to the book or note
+func setChangedOn(t *testing.T, db *database.DB, uuid, changeType string, ts int64) {
+	database.MustExec(t, fmt.Sprintf("setting the change of %s", uuid), db, "UPDATE local_changes SET changed_on = ? WHERE uuid = ? AND type = ?", ts, uuid, changeType)
+}
+
+func TestLoad_since(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 100, 0)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 100, 300)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3 body", 150, 0)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4 body", 250, 0)
+	setChangedOn(t, db, "b1-uuid", changeTypeBook, 50)
+	setChangedOn(t, db, "b2-uuid", changeTypeBook, 50)
+	setChangedOn(t, db, "n1-uuid", changeTypeNote, 100)
+	setChangedOn(t, db, "n2-uuid", changeTypeNote, 300)
+	setChangedOn(t, db, "n3-uuid", changeTypeNote, 150)
+	setChangedOn(t, db, "n4-uuid", changeTypeNote, 250)
+
+	// execute
+	got, err := load(ctx, 200)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var noteUUIDs []string
+	for _, b := range got.Books {
+		assert.Equal(t, b.UUID, "b1-uuid", "book uuid mismatch")
+
+		for _, n := range b.Notes {
+			noteUUIDs = append(noteUUIDs, n.UUID)
+		}
+	}
+
+	assert.Equal(t, len(got.Books), 1, "book count mismatch")
+	assert.DeepEqual(t, noteUUIDs, []string{"n2-uuid", "n4-uuid"}, "note uuids mismatch")
+	assert.DeepEqual(t, got.Deleted, &deleted{Books: []string{}, Notes: []string{}}, "deleted mismatch")
+	assert.Equal(t, got.Since.UnixNano(), int64(200), "since mismatch")
+	assert.Equal(t, got.Manifest.BookCount, 1, "manifest book count mismatch")
+	assert.Equal(t, got.Manifest.NoteCount, 2, "manifest note count mismatch")
+}
+
+func TestLoad_sinceLocalChanges(t *testing.T) {
+	testCases := []struct {
+		name            string
+		change          func(t *testing.T, db *database.DB)
+		expectedBooks   []string
+		expectedNotes   []string
+		expectedDeleted deleted
+	}{
+		{
+			name: "no change",
+			change: func(t *testing.T, db *database.DB) {
+				// updates that change nothing, or only evict the body, are not changes
+				database.MustExec(t, "updating n1", db, "UPDATE notes SET body = ?, usn = ? WHERE uuid = ?", "n1 body", 9, "n1-uuid")
+				database.MustExec(t, "evicting n2", db, "UPDATE notes SET body = ?, evicted = ? WHERE uuid = ?", "", true, "n2-uuid")
+			},
+			expectedBooks:   []string{},
+			expectedNotes:   []string{},
+			expectedDeleted: deleted{Books: []string{}, Notes: []string{}},
+		},
+		{
+			name: "content type, language and metadata",
+			change: func(t *testing.T, db *database.DB) {
+				if err := database.UpdateNoteContentType(db, 1, "plaintext"); err != nil {
+					t.Fatal(errors.Wrap(err, "updating the content type"))
+				}
+				if err := database.UpdateNoteLanguage(db, 2, "go"); err != nil {
+					t.Fatal(errors.Wrap(err, "updating the language"))
+				}
+				if err := database.SetNoteMetadata(db, "n3-uuid", "status", "draft"); err != nil {
+					t.Fatal(errors.Wrap(err, "setting the metadata"))
+				}
+			},
+			expectedBooks:   []string{"b2-uuid", "b1-uuid"},
+			expectedNotes:   []string{"n3-uuid", "n1-uuid", "n2-uuid"},
+			expectedDeleted: deleted{Books: []string{}, Notes: []string{}},
+		},
+		{
+			name: "pulled by sync",
+			change: func(t *testing.T, db *database.DB) {
+				// the note keeps the times from the server, which are older than since
+				n := database.NewNote("n4-uuid", "b2-uuid", "", "n4 body", 10, 20, 7, false, false, false)
+				if err := n.Insert(db); err != nil {
+					t.Fatal(errors.Wrap(err, "inserting n4"))
+				}
+			},
+			expectedBooks:   []string{"b2-uuid"},
+			expectedNotes:   []string{"n4-uuid"},
+			expectedDeleted: deleted{Books: []string{}, Notes: []string{}},
+		},
+		{
+			name: "renamed book",
+			change: func(t *testing.T, db *database.DB) {
+				if err := database.UpdateBookName(db, "b2-uuid", "html"); err != nil {
+					t.Fatal(errors.Wrap(err, "renaming b2"))
+				}
+			},
+			expectedBooks:   []string{"b2-uuid"},
+			expectedNotes:   []string{"n3-uuid"},
+			expectedDeleted: deleted{Books: []string{}, Notes: []string{}},
+		},
+		{
+			name: "deleted, trashed and expunged",
+			change: func(t *testing.T, db *database.DB) {
+				if err := database.TrashNote(db, clock.NewMock(), "n1-uuid", time.Hour); err != nil {
+					t.Fatal(errors.Wrap(err, "trashing n1"))
+				}
+				database.MustExec(t, "expunging n2", db, "DELETE FROM notes WHERE uuid = ?", "n2-uuid")
+				database.MustExec(t, "deleting n3", db, "UPDATE notes SET deleted = ?, body = ? WHERE uuid = ?", true, "", "n3-uuid")
+				database.MustExec(t, "deleting b2", db, "UPDATE books SET deleted = ? WHERE uuid = ?", true, "b2-uuid")
+			},
+			expectedBooks:   []string{},
+			expectedNotes:   []string{},
+			expectedDeleted: deleted{Books: []string{"b2-uuid"}, Notes: []string{"n1-uuid", "n2-uuid", "n3-uuid"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			db := ctx.DB
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+			database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?, ?)", 1, "n1-uuid", "b1-uuid", "n1 body", 100, 1)
+			database.MustExec(t, "inserting n2", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?, ?)", 2, "n2-uuid", "b1-uuid", "n2 body", 100, 2)
+			database.MustExec(t, "inserting n3", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?, ?)", 3, "n3-uuid", "b2-uuid", "n3 body", 50, 3)
+			database.MustExec(t, "resetting the local changes", db, "UPDATE local_changes SET changed_on = ?", 100)
+
+			since := time.Now().Add(-time.Second).UnixNano()
+			tc.change(t, db)
+
+			// execute
+			got, err := load(ctx, since)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			bookUUIDs := []string{}
+			noteUUIDs := []string{}
+			for _, b := range got.Books {
+				bookUUIDs = append(bookUUIDs, b.UUID)
+
+				for _, n := range b.Notes {
+					noteUUIDs = append(noteUUIDs, n.UUID)
+				}
+			}
+
+			assert.DeepEqual(t, bookUUIDs, tc.expectedBooks, "book uuids mismatch")
+			assert.DeepEqual(t, noteUUIDs, tc.expectedNotes, "note uuids mismatch")
+			assert.DeepEqual(t, *got.Deleted, tc.expectedDeleted, "deleted mismatch")
+		})
+	}
+}
+
+func TestGetSince(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		got, err := getSince(ctx, "")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.Equal(t, got, int64(0), "result mismatch")
+	})
+
+	t.Run("RFC3339", func(t *testing.T) {
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		got, err := getSince(ctx, "2020-03-14T21:15:00Z")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		expected := time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC).UnixNano()
+		assert.Equal(t, got, expected, "result mismatch")
+	})
+
+	t.Run("last without previous export", func(t *testing.T) {
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		got, err := getSince(ctx, "last")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.Equal(t, got, int64(0), "result mismatch")
+	})
+
+	t.Run("last", func(t *testing.T) {
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		exportedAt := time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC)
+		if err := saveLastExportAt(ctx, exportedAt); err != nil {
+			t.Fatal(errors.Wrap(err, "saving the last export time"))
+		}
+
+		got, err := getSince(ctx, "last")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.Equal(t, got, exportedAt.UnixNano(), "result mismatch")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if _, err := getSince(ctx, "yesterday"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestGetBookDirName(t *testing.T) {
+	testCases := []struct {
+		label    string
+		expected string
+	}{
+		{label: "js", expected: "js"},
+		{label: "linux/bash", expected: "linux%2Fbash"},
+		{label: "linux\\bash", expected: "linux%5Cbash"},
+		{label: "linux_bash", expected: "linux_bash"},
+		{label: "100%", expected: "100%25"},
+		{label: "100%2F", expected: "100%252F"},
+		{label: ".", expected: "%2E"},
+		{label: "..", expected: "%2E."},
+		{label: ".git", expected: "%2Egit"},
+		{label: "../js", expected: "%2E.%2Fjs"},
+		{label: "v1.0", expected: "v1.0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			assert.Equal(t, getBookDirName(tc.label), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	// set up
+	dir := "../../tmp/export"
+	defer func() {
+		if err := os.RemoveAll("../../tmp"); err != nil {
+			t.Fatal(errors.Wrap(err, "cleaning up"))
+		}
+	}()
+
+	editedOn := time.Date(2020, time.March, 15, 9, 0, 0, 0, time.UTC)
+	doc := document{
+		Version: documentVersion,
+		Books: []book{
+			{
+				UUID:  "b1-uuid",
+				Label: "linux/bash",
+				Notes: []note{
+					{
+						UUID:        "n1-uuid",
+						Title:       "Listing files",
+						Content:     "n1 body",
+						AddedOn:     time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC),
+						EditedOn:    &editedOn,
+						Public:      true,
+						Visibility:  "public",
+						ContentType: "plaintext",
+						Metadata:    map[string]string{"project": "atlas"},
+					},
+				},
+			},
+		},
+	}
+
+	// execute
+	if err := writeMarkdown(doc, dir); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	b, err := ioutil.ReadFile(filepath.Join(dir, "linux%2Fbash", "n1-uuid.md"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the note file"))
+	}
+
+	expected := `---
+uuid: n1-uuid
+title: Listing files
+book: linux/bash
+added_on: "2020-03-14T21:15:00Z"
+edited_on: "2020-03-15T09:00:00Z"
+public: true
+visibility: public
+content_type: plaintext
+metadata:
+  project: atlas
+---
+
+n1 body
+`
+	assert.Equal(t, string(b), expected, "content mismatch")
+}
+
+func TestWriteMarkdown_bookDirs(t *testing.T) {
+	// set up
+	dir := "../../tmp/export"
+	defer func() {
+		if err := os.RemoveAll("../../tmp"); err != nil {
+			t.Fatal(errors.Wrap(err, "cleaning up"))
+		}
+	}()
+
+	var books []book
+	for i, label := range []string{".", "..", "a/b", "a_b"} {
+		books = append(books, book{
+			UUID:  fmt.Sprintf("b%d-uuid", i+1),
+			Label: label,
+			Notes: []note{
+				{
+					UUID:        fmt.Sprintf("n%d-uuid", i+1),
+					Content:     fmt.Sprintf("n%d body", i+1),
+					AddedOn:     time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC),
+					Visibility:  "private",
+					ContentType: "plaintext",
+				},
+			},
+		})
+	}
+	doc := document{
+		Version: documentVersion,
+		Books:   books,
+	}
+
+	// execute
+	if err := writeMarkdown(doc, dir); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	for _, p := range []string{"%2E/n1-uuid.md", "%2E./n2-uuid.md", "a%2Fb/n3-uuid.md", "a_b/n4-uuid.md"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); err != nil {
+			t.Errorf("%s should exist: %s", p, err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir("../../tmp")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the parent directory"))
+	}
+	assert.Equal(t, len(entries), 1, "the parent directory should have only the export")
+}
+
+func TestWriteMarkdown_staleFiles(t *testing.T) {
+	// set up
+	dir := "../../tmp/export"
+	defer func() {
+		if err := os.RemoveAll("../../tmp"); err != nil {
+			t.Fatal(errors.Wrap(err, "cleaning up"))
+		}
+	}()
+
+	for _, p := range []string{"css/n1-uuid.md", "css/n2-uuid.md", "css/n3-uuid.md"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(p)), 0755); err != nil {
+			t.Fatal(errors.Wrap(err, "creating the book directory"))
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, p), []byte("old"), 0644); err != nil {
+			t.Fatal(errors.Wrapf(err, "writing %s", p))
+		}
+	}
+
+	doc := document{
+		Version: documentVersion,
+		Books: []book{
+			{
+				UUID:  "b1-uuid",
+				Label: "html",
+				Notes: []note{
+					{
+						UUID:        "n1-uuid",
+						Content:     "n1 body",
+						AddedOn:     time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC),
+						Visibility:  "private",
+						ContentType: "markdown",
+					},
+				},
+			},
+		},
+		Deleted: &deleted{Books: []string{}, Notes: []string{"n2-uuid"}},
+	}
+
+	// execute
+	if err := writeMarkdown(doc, dir); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	for _, p := range []string{"html/n1-uuid.md", "css/n3-uuid.md"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); err != nil {
+			t.Errorf("%s should exist: %s", p, err)
+		}
+	}
+	for _, p := range []string{"css/n1-uuid.md", "css/n2-uuid.md"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", p)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/frontmatter"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/pkg/errors"
+)
+
+// markdownMeta is the metadata of a note written in the frontmatter of a Markdown file
+type markdownMeta struct {
+	UUID        string `yaml:"uuid"`
+	Title       string `yaml:"title"`
+	Book        string `yaml:"book"`
+	AddedOn     string `yaml:"added_on"`
+	EditedOn    string `yaml:"edited_on,omitempty"`
+	Public      bool   `yaml:"public"`
+	Visibility  string `yaml:"visibility"`
+	ContentType string `yaml:"content_type"`
+	Language    string `yaml:"language,omitempty"`
+	// Metadata is the key-value metadata of the note
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+}
+
+// bookDirNameReplacer percent-encodes the characters of a book label that cannot be in the name
+// of a directory. The percent sign itself is encoded so that no two labels share a directory.
+var bookDirNameReplacer = strings.NewReplacer("%", "%25", "/", "%2F", "\\", "%5C")
+
+// getBookDirName returns the name of the directory for the book with the given label. A
+// leading dot is encoded as well so that labels such as "..", or ".git" in a mirror,
+// cannot point outside of the book directory or at a hidden one.
+func getBookDirName(label string) string {
+	ret := bookDirNameReplacer.Replace(label)
+	if strings.HasPrefix(ret, ".") {
+		ret = "%2E" + ret[1:]
+	}
+
+	return ret
+}
+
+// renderNote returns the content of the Markdown file for the note
+func renderNote(bookLabel string, n note) ([]byte, error) {
+	fm := markdownMeta{
+		UUID:        n.UUID,
+		Title:       n.Title,
+		Book:        bookLabel,
+		AddedOn:     n.AddedOn.Format(time.RFC3339Nano),
+		Public:      n.Public,
+		Visibility:  n.Visibility,
+		ContentType: n.ContentType,
+		Language:    n.Language,
+		Metadata:    n.Metadata,
+	}
+	if n.EditedOn != nil {
+		fm.EditedOn = n.EditedOn.Format(time.RFC3339Nano)
+	}
+
+	body := n.Content
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+
+	return frontmatter.Render(fm, body)
+}
+
+// markdownFiles returns the Markdown files of the document by their paths relative to
+// the output directory, one directory per book and one file per note
+func markdownFiles(doc document) (map[string][]byte, error) {
+	ret := map[string][]byte{}
+
+	for _, b := range doc.Books {
+		for _, n := range b.Notes {
+			content, err := renderNote(b.Label, n)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rendering note %s", n.UUID)
+			}
+
+			p := filepath.Join(getBookDirName(b.Label), fmt.Sprintf("%s.md", n.UUID))
+			ret[p] = content
+		}
+	}
+
+	return ret, nil
+}
+
+// MarkdownFiles returns the Markdown export of all notes by the paths of the files
+// relative to the output directory. The contents of the notes removed from the device
+// in the thin mode are downloaded first.
+func MarkdownFiles(ctx context.DnoteCtx) (map[string][]byte, error) {
+	if _, err := thin.EnsureBodies(ctx, ""); err != nil {
+		return nil, errors.Wrap(err, "getting the note bodies")
+	}
+
+	doc, err := load(ctx, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading books and notes")
+	}
+
+	return markdownFiles(doc)
+}
+
+// writeMarkdown writes the document into the given directory, one directory per
+// book and one Markdown file per note
+func writeMarkdown(doc document, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "creating the output directory")
+	}
+
+	// the books without notes get a directory too
+	for _, b := range doc.Books {
+		bookDir := filepath.Join(dir, getBookDirName(b.Label))
+		if err := os.MkdirAll(bookDir, 0755); err != nil {
+			return errors.Wrapf(err, "creating the directory for book %s", b.Label)
+		}
+	}
+
+	files, err := markdownFiles(doc)
+	if err != nil {
+		return err
+	}
+	if err := removeStaleFiles(dir, files, doc.Deleted); err != nil {
+		return errors.Wrap(err, "removing the stale files")
+	}
+	for p, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, p), content, 0644); err != nil {
+			return errors.Wrapf(err, "writing %s", p)
+		}
+	}
+
+	return nil
+}
+
+// removeStaleFiles removes the files of the deleted notes from the output directory, and
+// the files of the notes that are now written into the directory of another book
+// because they were moved or their book was renamed
+func removeStaleFiles(dir string, files map[string][]byte, d *deleted) error {
+	existing, err := filepath.Glob(filepath.Join(dir, "*", "*.md"))
+	if err != nil {
+		return errors.Wrap(err, "listing the existing files")
+	}
+
+	stale := map[string]bool{}
+	if d != nil {
+		for _, uuid := range d.Notes {
+			stale[fmt.Sprintf("%s.md", uuid)] = true
+		}
+	}
+	for p := range files {
+		stale[filepath.Base(p)] = true
+	}
+
+	for _, p := range existing {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return errors.Wrapf(err, "getting the relative path of %s", p)
+		}
+
+		if _, ok := files[rel]; ok || !stale[filepath.Base(p)] {
+			continue
+		}
+
+		if err := os.Remove(p); err != nil {
+			return errors.Wrapf(err, "removing %s", rel)
+		}
+	}
+
+	return nil
+}
@@ -22,10 +22,16 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/dnote/dnote/pkg/cli/completion"
 	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/infra"
 	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/dnote/dnote/pkg/cli/validate"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -39,14 +45,41 @@ var example = `
 
 	# find notes within a book
 	dnote find "merge sort" -b algorithm
+
+	# find notes added or edited in March 2020
+	dnote find "merge sort" --since 2020-03-01 --until 2020-03-31
+
+	# find code notes
+	dnote find "heap" --type code
+
+	# find notes that have never been viewed
+	dnote find "heap" --never-viewed
+
+	# find notes in the archived books too
+	dnote find "heap" --archived
+
+	# find notes by their metadata, with or without keywords
+	dnote find "meta:project=atlas"
+	dnote find "deadline meta:project=atlas meta:status"
 	`
 
 var bookName string
+var sinceFlag string
+var untilFlag string
+var deletedFlag bool
+var typeFlag string
+var neverViewedFlag bool
+var archivedFlag bool
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) != 1 {
 		return errors.New("Incorrect number of argument")
 	}
+	if typeFlag != "" {
+		if err := validate.ContentType(typeFlag); err != nil {
+			return errors.Wrap(err, "invalid type")
+		}
+	}
 
 	return nil
 }
@@ -64,15 +97,35 @@ func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 
 	f := cmd.Flags()
 	f.StringVarP(&bookName, "book", "b", "", "book name to find notes in")
+	f.StringVarP(&sinceFlag, "since", "s", "", "find only the notes added or edited on or after the given date or RFC3339 time")
+	f.StringVarP(&untilFlag, "until", "u", "", "find only the notes added or edited on or before the given date or RFC3339 time")
+	f.BoolVarP(&deletedFlag, "deleted", "d", false, "find the deleted notes instead")
+	f.StringVarP(&typeFlag, "type", "t", "", "find only the notes of the given content type: markdown, plaintext or code")
+	f.BoolVarP(&neverViewedFlag, "never-viewed", "", false, "find only the notes that have never been viewed")
+	f.BoolVarP(&archivedFlag, "archived", "", false, "find the notes in the archived books too")
+
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
 
 	return cmd
 }
 
-// noteInfo is an information about the note to be printed on screen
-type noteInfo struct {
-	RowID     int
-	BookLabel string
-	Body      string
+// Result is a note matching the search query
+type Result struct {
+	RowID     int    `json:"id"`
+	BookLabel string `json:"book"`
+	Title     string `json:"title"`
+	Body      string `json:"snippet"`
+}
+
+// snippetMarkerReplacer removes the highlight markers from a matched snippet
+var snippetMarkerReplacer = strings.NewReplacer("<dnotehl>", "", "</dnotehl>", "")
+
+// plainFTSSnippet turns the matched snippet from a full text search into a
+// plain text without highlights
+func plainFTSSnippet(s string) string {
+	body := newLineReg.ReplaceAllString(s, " ")
+
+	return snippetMarkerReplacer.Replace(body)
 }
 
 // formatFTSSnippet turns the matched snippet from a full text search
@@ -130,67 +183,342 @@ func escapePhrase(s string) (string, error) {
 	return b.String(), nil
 }
 
-func doQuery(ctx context.DnoteCtx, query, bookName string) (*sql.Rows, error) {
+const (
+	// recencyHalfLife is the age, in nanoseconds, at which the recency signal
+	// of a note decays to a half
+	recencyHalfLife = float64(30 * 24 * time.Hour)
+	// frequencySaturation is the number of views at which the frequency signal
+	// of a note reaches a half of its maximum
+	frequencySaturation = 5.0
+)
+
+// getRankScore returns an expression and its arguments for the score by which the
+// search results in the given index are ranked. The relevance score from the full text
+// search is boosted by how recently the note was added, edited or viewed, and how often
+// it was viewed.
+func getRankScore(ctx context.DnoteCtx, table string) (string, []interface{}) {
+	now := float64(ctx.Clock.Now().UnixNano())
+
+	// bm25 scores are negative, and the lower the better. Therefore, multiplying
+	// them by a boost greater than 1 moves the notes towards the top.
+	expr := fmt.Sprintf(`%s.rank * (1.0
+		+ ? * (1.0 / (1.0 + max(0, ? - max(notes.added_on, notes.edited_on, notes.last_viewed_on)) / ?))
+		+ ? * (notes.view_count * 1.0 / (notes.view_count + ?)))`, table)
+	args := []interface{}{
+		ctx.SearchWeights.Recency, now, recencyHalfLife,
+		ctx.SearchWeights.Frequency, frequencySaturation,
+	}
+
+	return expr, args
+}
+
+// filter narrows down the notes matching the search query
+type filter struct {
+	BookName string
+	// Since and Until are the bounds, in unix nanoseconds, of the time at which the notes
+	// were last added or edited. Zero means no bound.
+	Since       int64
+	Until       int64
+	Deleted     bool
+	ContentType string
+	NeverViewed bool
+	// Archived includes the notes in the archived books. The notes in a book given
+	// by BookName are included regardless.
+	Archived bool
+	// Meta are the conditions on the metadata that the notes must all meet
+	Meta []metaCondition
+}
+
+// metaTermPrefix is the prefix of a search term that matches the metadata of the notes
+const metaTermPrefix = "meta:"
+
+// metaCondition is a condition on the metadata of the notes, written as 'meta:key=value',
+// or as 'meta:key' to match the notes having the key with any value
+type metaCondition struct {
+	Key      string
+	Value    string
+	AnyValue bool
+}
+
+// parseMetaTerms separates the terms matching the metadata from the keywords
+func parseMetaTerms(s string) (string, []metaCondition) {
+	var keywords []string
+	var conds []metaCondition
+
+	for _, term := range strings.Fields(s) {
+		kv := strings.TrimPrefix(term, metaTermPrefix)
+		if kv == term || kv == "" {
+			keywords = append(keywords, term)
+			continue
+		}
+
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 1 {
+			conds = append(conds, metaCondition{Key: parts[0], AnyValue: true})
+		} else {
+			conds = append(conds, metaCondition{Key: parts[0], Value: parts[1]})
+		}
+	}
+
+	return strings.Join(keywords, " "), conds
+}
+
+// getFilter builds a filter from the flags
+func getFilter() (filter, error) {
+	ret := filter{
+		BookName:    bookName,
+		Deleted:     deletedFlag,
+		ContentType: typeFlag,
+		NeverViewed: neverViewedFlag,
+		Archived:    archivedFlag,
+	}
+
+	if sinceFlag != "" {
+		t, _, err := utils.ParseTime(sinceFlag)
+		if err != nil {
+			return ret, errors.Errorf("invalid since '%s'. Use a date such as 2020-03-14, or a time in RFC3339", sinceFlag)
+		}
+
+		ret.Since = t.UnixNano()
+	}
+	if untilFlag != "" {
+		t, isDate, err := utils.ParseTime(untilFlag)
+		if err != nil {
+			return ret, errors.Errorf("invalid until '%s'. Use a date such as 2020-03-14, or a time in RFC3339", untilFlag)
+		}
+
+		// include the whole day
+		if isDate {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+
+		ret.Until = t.UnixNano()
+	}
+
+	return ret, nil
+}
+
+// getFTSRoutes returns the full text search indices for the tokenizers used by the books
+func getFTSRoutes(db *database.DB) ([]database.FTSRoute, error) {
+	rows, err := db.Query("SELECT DISTINCT tokenizer FROM books")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the tokenizers")
+	}
+	defer rows.Close()
+
+	used := map[string]bool{}
+	for rows.Next() {
+		var tokenizer string
+		if err := rows.Scan(&tokenizer); err != nil {
+			return nil, errors.Wrap(err, "scanning a tokenizer")
+		}
+
+		used[tokenizer] = true
+	}
+
+	ret := []database.FTSRoute{}
+	for _, r := range database.FTSRoutes {
+		if used[r.Tokenizer] {
+			ret = append(ret, r)
+		}
+	}
+
+	// search the default index even if there is no book, so that the query is valid
+	if len(ret) == 0 {
+		ret = append(ret, database.FTSRoutes[0])
+	}
+
+	return ret, nil
+}
+
+// getConditions returns the SQL conditions, and their arguments, for the notes matching the filter
+func getConditions(ctx context.DnoteCtx, f filter) (string, []interface{}, error) {
 	db := ctx.DB
 
-	sql := `SELECT
-		notes.rowid,
-		books.label AS book_label,
-		snippet(note_fts, 0, '<dnotehl>', '</dnotehl>', '...', 28)
-	FROM note_fts
-	INNER JOIN notes ON notes.rowid = note_fts.rowid
-	INNER JOIN books ON notes.book_uuid = books.uuid
-	WHERE note_fts MATCH ?`
-	args := []interface{}{query}
+	conds := "notes.deleted = ?"
+	condArgs := []interface{}{f.Deleted}
 
-	if bookName != "" {
-		sql = fmt.Sprintf("%s AND books.label = ?", sql)
-		args = append(args, bookName)
+	if f.BookName != "" {
+		label, err := database.ResolveBookLabel(db, f.BookName, ctx.CaseSensitiveBooks)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "resolving the book")
+		}
+
+		conds = fmt.Sprintf("%s AND books.label = ?", conds)
+		condArgs = append(condArgs, label)
+	} else if !f.Archived {
+		conds = fmt.Sprintf("%s AND books.archived = false", conds)
+	}
+	if f.Since != 0 {
+		conds = fmt.Sprintf("%s AND max(notes.added_on, notes.edited_on) >= ?", conds)
+		condArgs = append(condArgs, f.Since)
+	}
+	if f.Until != 0 {
+		conds = fmt.Sprintf("%s AND max(notes.added_on, notes.edited_on) <= ?", conds)
+		condArgs = append(condArgs, f.Until)
+	}
+	if f.ContentType != "" {
+		conds = fmt.Sprintf("%s AND notes.content_type = ?", conds)
+		condArgs = append(condArgs, f.ContentType)
+	}
+	if f.NeverViewed {
+		conds = fmt.Sprintf("%s AND notes.view_count = 0", conds)
+	}
+	for _, m := range f.Meta {
+		if m.AnyValue {
+			conds = fmt.Sprintf("%s AND EXISTS (SELECT 1 FROM note_metadata WHERE note_metadata.note_uuid = notes.uuid AND note_metadata.key = ?)", conds)
+			condArgs = append(condArgs, m.Key)
+		} else {
+			conds = fmt.Sprintf("%s AND EXISTS (SELECT 1 FROM note_metadata WHERE note_metadata.note_uuid = notes.uuid AND note_metadata.key = ? AND note_metadata.value = ?)", conds)
+			condArgs = append(condArgs, m.Key, m.Value)
+		}
+	}
+
+	return conds, condArgs, nil
+}
+
+// doListQuery lists the notes matching the filter without keywords, the most recently
+// added or edited first
+func doListQuery(ctx context.DnoteCtx, f filter) (*sql.Rows, error) {
+	conds, condArgs, err := getConditions(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctx.DB.Query(fmt.Sprintf(`SELECT
+			notes.rowid,
+			books.label,
+			CASE WHEN notes.title = '' THEN notes.body ELSE notes.title END,
+			substr(notes.body, 1, 160)
+		FROM notes
+		INNER JOIN books ON notes.book_uuid = books.uuid
+		WHERE %s
+		ORDER BY max(notes.added_on, notes.edited_on) DESC`, conds), condArgs...)
+}
+
+// doQuery searches the notes in each book in the index for the tokenizer of the book,
+// and ranks the results from all indices together
+func doQuery(ctx context.DnoteCtx, query string, f filter) (*sql.Rows, error) {
+	db := ctx.DB
+
+	conds, condArgs, err := getConditions(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := getFTSRoutes(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the search indices")
+	}
+
+	var parts []string
+	var args []interface{}
+	for _, r := range routes {
+		score, scoreArgs := getRankScore(ctx, r.Table)
+
+		parts = append(parts, fmt.Sprintf(`SELECT
+			notes.rowid AS rowid,
+			books.label AS book_label,
+			CASE WHEN notes.title = '' THEN notes.body ELSE notes.title END AS title,
+			snippet(%[1]s, 0, '<dnotehl>', '</dnotehl>', '...', 28) AS snippet,
+			%[2]s AS score
+		FROM %[1]s
+		INNER JOIN notes ON notes.rowid = %[1]s.rowid
+		INNER JOIN books ON notes.book_uuid = books.uuid
+		WHERE %[1]s MATCH ? AND books.tokenizer = ? AND %[3]s`, r.Table, score, conds))
+		args = append(args, scoreArgs...)
+		args = append(args, query, r.Tokenizer)
+		args = append(args, condArgs...)
 	}
 
+	sql := fmt.Sprintf("SELECT rowid, book_label, title, snippet FROM (%s) ORDER BY score", strings.Join(parts, " UNION ALL "))
+
 	rows, err := db.Query(sql, args...)
 
 	return rows, err
 }
 
-func newRun(ctx context.DnoteCtx) infra.RunEFunc {
-	return func(cmd *cobra.Command, args []string) error {
-		phrase, err := escapePhrase(args[0])
-		if err != nil {
-			return errors.Wrap(err, "escaping phrase")
-		}
+// search finds the notes matching the keywords. If plain is true, the matches are not
+// highlighted in the snippets.
+func search(ctx context.DnoteCtx, keywords string, f filter, plain bool) ([]Result, error) {
+	keywords, meta := parseMetaTerms(keywords)
+	f.Meta = append(f.Meta, meta...)
+
+	phrase, err := escapePhrase(keywords)
+	if err != nil {
+		return nil, errors.Wrap(err, "escaping phrase")
+	}
 
-		rows, err := doQuery(ctx, phrase, bookName)
+	var rows *sql.Rows
+	if phrase == "" && len(f.Meta) > 0 {
+		rows, err = doListQuery(ctx, f)
+	} else {
+		rows, err = doQuery(ctx, phrase, f)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []Result{}
+	for rows.Next() {
+		var r Result
+
+		var title, body string
+		err = rows.Scan(&r.RowID, &r.BookLabel, &title, &body)
 		if err != nil {
-			return errors.Wrap(err, "querying notes")
+			return nil, errors.Wrap(err, "scanning a row")
 		}
-		defer rows.Close()
 
-		infos := []noteInfo{}
-		for rows.Next() {
-			var info noteInfo
+		// the content is selected in place of an empty title, so that the title can be inferred from it
+		r.Title = database.InferTitle(title)
 
-			var body string
-			err = rows.Scan(&info.RowID, &info.BookLabel, &body)
+		if plain {
+			r.Body = plainFTSSnippet(body)
+		} else {
+			r.Body, err = formatFTSSnippet(body)
 			if err != nil {
-				return errors.Wrap(err, "scanning a row")
+				return nil, errors.Wrap(err, "formatting a body")
 			}
+		}
 
-			body, err := formatFTSSnippet(body)
-			if err != nil {
-				return errors.Wrap(err, "formatting a body")
-			}
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
+
+// Search finds the notes matching the keywords in the book with the given name, or in
+// all books if the name is empty. The snippets in the results are in plain text.
+func Search(ctx context.DnoteCtx, keywords, bookName string) ([]Result, error) {
+	return search(ctx, keywords, filter{BookName: bookName}, true)
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		f, err := getFilter()
+		if err != nil {
+			return err
+		}
 
-			info.Body = body
+		results, err := search(ctx, args[0], f, output.IsJSON())
+		if err != nil {
+			return errors.Wrap(err, "searching notes")
+		}
 
-			infos = append(infos, info)
+		if output.IsJSON() {
+			return output.JSON(results)
 		}
 
-		for _, info := range infos {
-			bookLabel := log.ColorYellow.Sprintf("(%s)", info.BookLabel)
-			rowid := log.ColorYellow.Sprintf("(%d)", info.RowID)
+		for _, r := range results {
+			bookLabel := log.ColorYellow.Sprintf("(%s)", r.BookLabel)
+			rowid := log.ColorYellow.Sprintf("(%d)", r.RowID)
 
-			log.Plainf("%s %s %s\n", bookLabel, rowid, info.Body)
+			if r.Title == "" {
+				log.Plainf("%s %s %s\n", bookLabel, rowid, r.Body)
+			} else {
+				log.Plainf("%s %s %s %s\n", bookLabel, rowid, log.ColorBlue.Sprintf("%s:", r.Title), r.Body)
+			}
 		}
 
 		return nil
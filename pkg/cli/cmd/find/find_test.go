@@ -0,0 +1,375 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package find
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestDoQuery_rank(t *testing.T) {
+	testCases := []struct {
+		name     string
+		weights  context.SearchWeights
+		expected []string
+	}{
+		{
+			name:     "no boost",
+			weights:  context.SearchWeights{Recency: 0, Frequency: 0},
+			expected: []string{"n1-uuid", "n2-uuid"},
+		},
+		{
+			name:     "recency boost",
+			weights:  context.SearchWeights{Recency: 1, Frequency: 0},
+			expected: []string{"n2-uuid", "n1-uuid"},
+		},
+		{
+			name:     "frequency boost",
+			weights:  context.SearchWeights{Recency: 0, Frequency: 1},
+			expected: []string{"n2-uuid", "n1-uuid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			now := time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC)
+			c := clock.NewMock()
+			c.SetNow(now)
+			ctx.Clock = c
+			ctx.SearchWeights = tc.weights
+
+			db := ctx.DB
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+
+			// n1 is more relevant to the query than n2, but it has neither been recently edited nor viewed
+			fiveYearsAgo := now.AddDate(-5, 0, 0).UnixNano()
+			yesterday := now.Add(-24 * time.Hour).UnixNano()
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, last_viewed_on, view_count) VALUES (?, ?, ?, ?, ?, ?)",
+				"n1-uuid", "b1-uuid", "sort sort", fiveYearsAgo, 0, 0)
+			database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, last_viewed_on, view_count) VALUES (?, ?, ?, ?, ?, ?)",
+				"n2-uuid", "b1-uuid", "sort lines", fiveYearsAgo, yesterday, 20)
+
+			// execute
+			rows, err := doQuery(ctx, `"sort"`, filter{})
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+			defer rows.Close()
+
+			// test
+			var got []string
+			for rows.Next() {
+				var rowid int
+				var label, title, body string
+				if err := rows.Scan(&rowid, &label, &title, &body); err != nil {
+					t.Fatal(errors.Wrap(err, "scanning a row"))
+				}
+
+				var uuid string
+				database.MustScan(t, "getting uuid", db.QueryRow("SELECT uuid FROM notes WHERE rowid = ?", rowid), &uuid)
+
+				got = append(got, uuid)
+			}
+
+			assert.DeepEqual(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestDoQuery_filter(t *testing.T) {
+	march := func(day int) int64 {
+		return time.Date(2020, time.March, day, 12, 0, 0, 0, time.UTC).UnixNano()
+	}
+
+	testCases := []struct {
+		name     string
+		filter   filter
+		expected []string
+	}{
+		{
+			name:     "no filter",
+			filter:   filter{},
+			expected: []string{"n1-uuid", "n2-uuid", "n3-uuid"},
+		},
+		{
+			name:     "book",
+			filter:   filter{BookName: "b1"},
+			expected: []string{"n1-uuid", "n3-uuid"},
+		},
+		{
+			name:     "since",
+			filter:   filter{Since: march(10)},
+			expected: []string{"n2-uuid", "n3-uuid"},
+		},
+		{
+			name:     "until",
+			filter:   filter{Until: march(10)},
+			expected: []string{"n1-uuid", "n2-uuid"},
+		},
+		{
+			name:     "since and until",
+			filter:   filter{Since: march(5), Until: march(15)},
+			expected: []string{"n2-uuid"},
+		},
+		{
+			name:     "deleted",
+			filter:   filter{Deleted: true},
+			expected: []string{"n4-uuid"},
+		},
+		{
+			name:     "book and since",
+			filter:   filter{BookName: "b1", Since: march(5)},
+			expected: []string{"n3-uuid"},
+		},
+		{
+			name:     "content type",
+			filter:   filter{ContentType: "code"},
+			expected: []string{"n2-uuid"},
+		},
+		{
+			name:     "never viewed",
+			filter:   filter{NeverViewed: true},
+			expected: []string{"n2-uuid", "n3-uuid"},
+		},
+		{
+			name:     "archived",
+			filter:   filter{Archived: true},
+			expected: []string{"n1-uuid", "n2-uuid", "n3-uuid", "n5-uuid"},
+		},
+		{
+			name:     "archived book",
+			filter:   filter{BookName: "b3"},
+			expected: []string{"n5-uuid"},
+		},
+		{
+			name:     "metadata value",
+			filter:   filter{Meta: []metaCondition{{Key: "project", Value: "atlas"}}},
+			expected: []string{"n1-uuid", "n3-uuid"},
+		},
+		{
+			name:     "metadata key",
+			filter:   filter{Meta: []metaCondition{{Key: "project", AnyValue: true}}},
+			expected: []string{"n1-uuid", "n2-uuid", "n3-uuid"},
+		},
+		{
+			name:     "multiple metadata",
+			filter:   filter{Meta: []metaCondition{{Key: "project", Value: "atlas"}, {Key: "status", AnyValue: true}}},
+			expected: []string{"n3-uuid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			db := ctx.DB
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+			database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "b2")
+			database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label, archived) VALUES (?, ?, ?)", "b3-uuid", "b3", true)
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)",
+				"n1-uuid", "b1-uuid", "sort", march(1), 0, false)
+			database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)",
+				"n2-uuid", "b2-uuid", "sort", march(10), 0, false)
+			database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)",
+				"n3-uuid", "b1-uuid", "sort", march(1), march(20), false)
+			database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)",
+				"n4-uuid", "b1-uuid", "sort", march(1), 0, true)
+			database.MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)",
+				"n5-uuid", "b3-uuid", "sort", march(1), 0, false)
+			database.MustExec(t, "setting n2 content type", db, "UPDATE notes SET content_type = ? WHERE uuid = ?", "code", "n2-uuid")
+			database.MustExec(t, "viewing n1", db, "UPDATE notes SET view_count = ?, last_viewed_on = ? WHERE uuid = ?", 2, march(21), "n1-uuid")
+			database.MustExec(t, "inserting n1 metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)", "n1-uuid", "project", "atlas")
+			database.MustExec(t, "inserting n2 metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)", "n2-uuid", "project", "zephyr")
+			database.MustExec(t, "inserting n3 metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?), (?, ?, ?)", "n3-uuid", "project", "atlas", "n3-uuid", "status", "draft")
+
+			// execute
+			rows, err := doQuery(ctx, `"sort"`, tc.filter)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+			defer rows.Close()
+
+			// test
+			got := []string{}
+			for rows.Next() {
+				var rowid int
+				var label, title, body string
+				if err := rows.Scan(&rowid, &label, &title, &body); err != nil {
+					t.Fatal(errors.Wrap(err, "scanning a row"))
+				}
+
+				var uuid string
+				database.MustScan(t, "getting uuid", db.QueryRow("SELECT uuid FROM notes WHERE rowid = ?", rowid), &uuid)
+
+				got = append(got, uuid)
+			}
+			sort.Strings(got)
+
+			assert.DeepEqual(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestDoQuery_tokenizer(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{
+			query:    `"sort"`,
+			expected: []string{"n1-uuid"},
+		},
+		{
+			query:    `"タワー"`,
+			expected: []string{"n2-uuid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			db := ctx.DB
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+			database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, tokenizer) VALUES (?, ?, ?)", "b2-uuid", "b2", database.TokenizerTrigram)
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "sorting 東京タワー", 1)
+			database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b2-uuid", "東京タワー", 1)
+
+			// execute
+			rows, err := doQuery(ctx, tc.query, filter{})
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+			defer rows.Close()
+
+			// test
+			got := []string{}
+			for rows.Next() {
+				var rowid int
+				var label, title, body string
+				if err := rows.Scan(&rowid, &label, &title, &body); err != nil {
+					t.Fatal(errors.Wrap(err, "scanning a row"))
+				}
+
+				var uuid string
+				database.MustScan(t, "getting uuid", db.QueryRow("SELECT uuid FROM notes WHERE rowid = ?", rowid), &uuid)
+
+				got = append(got, uuid)
+			}
+
+			assert.DeepEqual(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestParseMetaTerms(t *testing.T) {
+	testCases := []struct {
+		input            string
+		expectedKeywords string
+		expectedConds    []metaCondition
+	}{
+		{
+			input:            "merge sort",
+			expectedKeywords: "merge sort",
+		},
+		{
+			input:            "meta:project=atlas",
+			expectedKeywords: "",
+			expectedConds:    []metaCondition{{Key: "project", Value: "atlas"}},
+		},
+		{
+			input:            "deadline meta:status meta:project=atlas",
+			expectedKeywords: "deadline",
+			expectedConds:    []metaCondition{{Key: "status", AnyValue: true}, {Key: "project", Value: "atlas"}},
+		},
+		{
+			input:            "meta:query=a=b",
+			expectedKeywords: "",
+			expectedConds:    []metaCondition{{Key: "query", Value: "a=b"}},
+		},
+		{
+			input:            "meta: tags",
+			expectedKeywords: "meta: tags",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			keywords, conds := parseMetaTerms(tc.input)
+
+			assert.Equal(t, keywords, tc.expectedKeywords, "keywords mismatch")
+			assert.DeepEqual(t, conds, tc.expectedConds, "conditions mismatch")
+		})
+	}
+}
+
+func TestSearch_metadataOnly(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "first note", 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "second note", 2)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n3-uuid", "b1-uuid", "third note", 3)
+	database.MustExec(t, "inserting metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?), (?, ?, ?)", "n1-uuid", "project", "atlas", "n3-uuid", "project", "atlas")
+
+	// execute
+	results, err := search(ctx, "meta:project=atlas", filter{}, true)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	bodies := []string{}
+	for _, r := range results {
+		bodies = append(bodies, r.Body)
+	}
+
+	assert.DeepEqual(t, bodies, []string{"third note", "first note"}, "result mismatch")
+}
+
+func TestPlainFTSSnippet(t *testing.T) {
+	got := plainFTSSnippet("<dnotehl>merge</dnotehl> sort\nis <dnotehl>stable</dnotehl>")
+
+	assert.Equal(t, got, "merge sort is stable", "result mismatch")
+}
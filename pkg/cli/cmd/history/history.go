@@ -0,0 +1,150 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var versionFlag int
+
+var example = `
+ * List the past versions of the note with id 3
+ dnote history 3
+
+ * See the content of the version 2 of the note
+ dnote history 3 --version 2`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new history command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "history <note id>",
+		Short:             "List the past versions of a note",
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.NoteArgs(ctx),
+	}
+
+	f := cmd.Flags()
+	f.IntVarP(&versionFlag, "version", "v", 0, "Print the content of the given version")
+
+	return cmd
+}
+
+// excerptLength is the maximum number of characters of a version shown in the list
+const excerptLength = 50
+
+func getExcerpt(body string) string {
+	lines := strings.SplitN(strings.TrimSpace(body), "\n", 2)
+	excerpt := []rune(lines[0])
+
+	if len(excerpt) > excerptLength {
+		return string(excerpt[:excerptLength]) + "..."
+	}
+	if len(lines) > 1 {
+		return string(excerpt) + "..."
+	}
+
+	return string(excerpt)
+}
+
+func formatTime(ts int64) string {
+	return time.Unix(0, ts).Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+func printVersions(versions []database.NoteVersion) {
+	for _, v := range versions {
+		log.Printf("%s %s %s\n", log.ColorYellow.Sprintf("version %d", v.Version), getExcerpt(v.Body),
+			log.ColorGray.Sprintf("(before %s on %s)", v.Action, formatTime(v.CreatedAt)))
+	}
+}
+
+func printVersion(versions []database.NoteVersion, version int) error {
+	for _, v := range versions {
+		if v.Version != version {
+			continue
+		}
+
+		log.Infof("version: %d\n", v.Version)
+		log.Infof("saved at: %s, before %s\n", formatTime(v.CreatedAt), v.Action)
+
+		fmt.Printf("\n------------------------content------------------------\n")
+		fmt.Printf("%s", v.Body)
+		fmt.Printf("\n-------------------------------------------------------\n")
+
+		return nil
+	}
+
+	return errors.Errorf("version %d not found", version)
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		rowID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid rowid")
+		}
+
+		note, err := database.GetNote(ctx.DB, rowID)
+		if err == sql.ErrNoRows {
+			return errors.Errorf("note %d not found", rowID)
+		} else if err != nil {
+			return errors.Wrap(err, "querying the note")
+		}
+
+		versions, err := database.GetNoteVersions(ctx.DB, note.UUID)
+		if err != nil {
+			return errors.Wrap(err, "getting the versions")
+		}
+
+		if versionFlag != 0 {
+			return printVersion(versions, versionFlag)
+		}
+
+		if len(versions) == 0 {
+			log.Infof("no past versions of the note %d\n", rowID)
+			return nil
+		}
+
+		printVersions(versions)
+
+		return nil
+	}
+}
@@ -0,0 +1,150 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// enexTimeLayout is the layout of the times in Evernote exports
+const enexTimeLayout = "20060102T150405Z"
+
+// enexExport is an Evernote export
+type enexExport struct {
+	Notes []enexNote `xml:"note"`
+}
+
+// enexNote is a note in an Evernote export
+type enexNote struct {
+	Title   string `xml:"title"`
+	Content string `xml:"content"`
+	Created string `xml:"created"`
+	Updated string `xml:"updated"`
+}
+
+// enmlBlockElements are the ENML elements after which a line break is rendered
+var enmlBlockElements = map[string]bool{
+	"div": true, "p": true, "br": true, "li": true, "tr": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+var regexBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// enmlToText converts the ENML content of an Evernote note into plain text
+func enmlToText(enml string) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(enml))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var b strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", errors.Wrap(err, "decoding the content")
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.EndElement:
+			if enmlBlockElements[t.Name.Local] {
+				b.WriteString("\n")
+			}
+		}
+	}
+
+	ret := regexBlankLines.ReplaceAllString(b.String(), "\n\n")
+
+	return strings.TrimSpace(ret), nil
+}
+
+// parseENEXTime parses a time in an Evernote export and returns a timestamp in unix nanoseconds
+func parseENEXTime(val string) (int64, error) {
+	if val == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse(enexTimeLayout, val)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing '%s'", val)
+	}
+
+	return t.UnixNano(), nil
+}
+
+// readENEX reads notes from an Evernote export. Because the export does not contain
+// the notebook name, the notes belong to the book named after the file.
+func readENEX(path string) ([]noteInput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	var export enexExport
+	if err := xml.NewDecoder(f).Decode(&export); err != nil {
+		return nil, errors.Wrap(err, "decoding the export")
+	}
+
+	base := filepath.Base(path)
+	bookLabel := toBookLabel(strings.TrimSuffix(base, filepath.Ext(base)))
+
+	ret := []noteInput{}
+	for _, n := range export.Notes {
+		text, err := enmlToText(n.Content)
+		if err != nil {
+			return nil, errors.Wrapf(err, "converting the note '%s'", n.Title)
+		}
+
+		content := text
+		if n.Title != "" {
+			content = strings.TrimSpace(n.Title + "\n\n" + text)
+		}
+
+		addedOn, err := parseENEXTime(n.Created)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing the creation time of the note '%s'", n.Title)
+		}
+		editedOn, err := parseENEXTime(n.Updated)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing the update time of the note '%s'", n.Title)
+		}
+
+		ret = append(ret, noteInput{
+			BookLabel: bookLabel,
+			Title:     n.Title,
+			Content:   content,
+			AddedOn:   addedOn,
+			EditedOn:  editedOn,
+		})
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,287 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var bookFlag string
+var dryRunFlag bool
+var forceFlag bool
+var identitiesFlag []string
+var onDuplicateFlag string
+
+var example = `
+ * Import a JSON document created by 'dnote export'
+ dnote import backup.json
+
+ * Import a directory of Markdown files
+ dnote import ./notes
+
+ * Import an Evernote export into a book
+ dnote import recipes.enex --book cooking
+
+ * Preview what would be imported without making any changes
+ dnote import backup.json --dry-run
+
+ * Import a JSON document encrypted for an age recipient
+ dnote import backup.json.age --identity ~/.config/age/key.txt
+
+ * Overwrite the existing notes with the imported ones, instead of skipping them
+ dnote import backup.json --on-duplicate update`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	if bookFlag != "" {
+		if err := validate.BookName(bookFlag); err != nil {
+			return errors.Wrap(err, "invalid book name")
+		}
+	}
+
+	if err := validateDuplicatePolicy(onDuplicateFlag); err != nil {
+		return errors.Wrap(err, "invalid --on-duplicate")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new import command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "import <path>",
+		Short:   "Import notes from JSON, Markdown files, or Evernote",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&bookFlag, "book", "b", "", "The book to import all notes into, instead of the books in the source")
+	f.BoolVarP(&dryRunFlag, "dry-run", "", false, "Show what would be imported without making any changes")
+	f.BoolVarP(&forceFlag, "force", "", false, "Import the public notes even if they seem to contain secrets, without confirmation")
+	f.StringSliceVarP(&identitiesFlag, "identity", "i", []string{}, "An age identity file to decrypt an encrypted export with. Can be given multiple times")
+	f.StringVarP(&onDuplicateFlag, "on-duplicate", "", duplicateSkip, "What to do with a note that already exists, having the same uuid or content: skip, update or duplicate")
+
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
+
+	return cmd
+}
+
+// getEncryption returns the name of the provider that encrypted the file at the given path,
+// or an empty string if the file is not encrypted
+func getEncryption(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	header := make([]byte, 64)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", errors.Wrap(err, "reading the file")
+	}
+
+	return crypt.Detect(header[:n]), nil
+}
+
+// readEncryptedJSON decrypts the JSON document created by the export command with the provider
+func readEncryptedJSON(path string, p crypt.Provider) ([]noteInput, error) {
+	doc, err := readEncryptedJSONDocument(path, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.inputs(), nil
+}
+
+// readEncryptedJSONDocument decrypts and decodes the JSON document created by the export
+// command with the provider
+func readEncryptedJSONDocument(path string, p crypt.Provider) (jsonDocument, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return jsonDocument{}, errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if err := p.Decrypt(&buf, f); err != nil {
+		return jsonDocument{}, errors.Wrapf(err, "decrypting with %s", p.Name())
+	}
+
+	return decodeJSONDocument(&buf)
+}
+
+// readSource reads the notes from the file or directory at the given path. The format
+// is determined by whether the path is a directory, and by the file extension. An
+// encrypted file is decrypted as a JSON document.
+func readSource(path string, identities []string) ([]noteInput, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the file info")
+	}
+
+	if fi.IsDir() {
+		return readMarkdownDir(path)
+	}
+
+	encryption, err := getEncryption(path)
+	if err != nil {
+		return nil, err
+	}
+	if encryption != "" {
+		p, err := crypt.NewProvider(encryption, nil, identities)
+		if err != nil {
+			return nil, err
+		}
+
+		return readEncryptedJSON(path, p)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return readJSON(path)
+	case ".enex":
+		return readENEX(path)
+	case ".md", ".markdown":
+		return readMarkdownFile(path)
+	}
+
+	return nil, errors.Errorf("unsupported file '%s'. Import a .json, .enex, or .md file, or a directory of Markdown files", path)
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+
+		inputs, err := readSource(path, identitiesFlag)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", path)
+		}
+
+		if bookFlag != "" {
+			for i := range inputs {
+				inputs[i].BookLabel = bookFlag
+			}
+		}
+
+		p, err := newPlan(ctx, inputs, onDuplicateFlag)
+		if err != nil {
+			return errors.Wrap(err, "planning the import")
+		}
+
+		printPlan(p)
+
+		if dryRunFlag {
+			log.Infof("dry run. nothing was imported\n")
+			return nil
+		}
+
+		if err := checkSecrets(p); err != nil {
+			return err
+		}
+
+		j, err := loadJournal(ctx, inputs)
+		if err != nil {
+			return errors.Wrap(err, "loading the journal")
+		}
+		if j.Done > 0 {
+			log.Infof("resuming the interrupted import after %d of %d notes\n", j.Done, p.noteCount())
+		}
+
+		res, err := p.run(ctx, j)
+		if err != nil {
+			return errors.Wrap(err, "importing. Run the same import again to resume it")
+		}
+
+		log.Successf("imported %d notes, updated %d, skipped %d duplicates\n", res.imported, res.updated, res.skipped)
+
+		return nil
+	}
+}
+
+// checkSecrets scans the notes that are about to be shared for likely secrets, and
+// asks for a confirmation if any is found
+func checkSecrets(p plan) error {
+	found := p.findSecrets()
+	if len(found) == 0 {
+		return nil
+	}
+
+	log.Warnf("some notes to be shared seem to contain secrets\n")
+	for _, s := range found {
+		name := s.entry.input.Title
+		if name == "" {
+			name = database.InferTitle(s.entry.input.Content)
+		}
+
+		for _, f := range s.findings {
+			log.Plainf("  %s %s %s\n", log.ColorYellow.Sprintf("%s/%s line %d:", s.entry.book.label, name, f.Line), f.Kind, log.ColorGray.Sprintf("(%s)", f.Excerpt))
+		}
+	}
+
+	if forceFlag {
+		return nil
+	}
+
+	ok, err := ui.Confirm("import and share them anyway?", false)
+	if err != nil {
+		return errors.Wrap(err, "getting confirmation")
+	}
+	if !ok {
+		return errors.New("Aborted. Use --force to import the notes regardless")
+	}
+
+	return nil
+}
+
+// printPlan prints the books into which the notes will be imported, and how many of the
+// notes already exist
+func printPlan(p plan) {
+	for _, b := range p.books {
+		if b.uuid == "" {
+			log.Infof("%s %s\n", b.label, log.ColorYellow.Sprintf("(%d notes, new book)", len(b.notes)))
+		} else {
+			log.Infof("%s %s\n", b.label, log.ColorYellow.Sprintf("(%d notes)", len(b.notes)))
+		}
+	}
+
+	if n := p.duplicateCount(); n > 0 {
+		log.Infof("%d notes already exist and will be handled by the '%s' policy\n", n, p.policy)
+	}
+}
@@ -0,0 +1,117 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/pkg/errors"
+)
+
+// journalFilename is the name of the file in the data directory in which the progress
+// of an import is recorded
+const journalFilename = "import-journal.json"
+
+// journal records how many notes of an import have been committed, so that an
+// interrupted import can be resumed from where it stopped
+type journal struct {
+	path string
+	// Digest identifies the notes being imported
+	Digest string `json:"digest"`
+	// Done is the number of notes, in the order of the plan, that have been committed
+	Done int `json:"done"`
+}
+
+// digestInputs returns a digest identifying the given notes and their order
+func digestInputs(inputs []noteInput) (string, error) {
+	b, err := json.Marshal(inputs)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling the notes")
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadJournal returns the journal for importing the given notes. If the previous import
+// of the same notes was interrupted, the journal resumes from its progress.
+func loadJournal(ctx context.DnoteCtx, inputs []noteInput) (*journal, error) {
+	digest, err := digestInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &journal{
+		path:   filepath.Join(ctx.Paths.Data, consts.DnoteDirName, journalFilename),
+		Digest: digest,
+	}
+
+	b, err := ioutil.ReadFile(ret.path)
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading the journal")
+	}
+
+	var prev journal
+	// a corrupt journal is ignored, and the import starts over
+	if err := json.Unmarshal(b, &prev); err == nil && prev.Digest == digest {
+		ret.Done = prev.Done
+	}
+
+	return ret, nil
+}
+
+// save records the number of committed notes. The file is replaced atomically so that
+// an interruption never leaves a partially written journal.
+func (j *journal) save(done int) error {
+	j.Done = done
+
+	b, err := json.Marshal(j)
+	if err != nil {
+		return errors.Wrap(err, "marshalling the journal")
+	}
+
+	tmpPath := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, 0600); err != nil {
+		return errors.Wrap(err, "writing the journal")
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return errors.Wrap(err, "replacing the journal")
+	}
+
+	return nil
+}
+
+// remove deletes the journal after the import is complete
+func (j *journal) remove() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing the journal")
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// jsonManifest describes the contents of a JSON document created by the export command.
+// The documents exported by older versions of dnote do not have one.
+type jsonManifest struct {
+	BookCount int `json:"book_count"`
+	NoteCount int `json:"note_count"`
+	// Hashes maps the uuid of each note to the SHA-256 of its content
+	Hashes map[string]string `json:"hashes"`
+}
+
+// jsonDocument is the JSON document created by the export command
+type jsonDocument struct {
+	Version  int           `json:"version"`
+	Manifest *jsonManifest `json:"manifest"`
+	Books    []struct {
+		Label string `json:"label"`
+		Notes []struct {
+			UUID        string            `json:"uuid"`
+			Title       string            `json:"title"`
+			Content     string            `json:"content"`
+			AddedOn     time.Time         `json:"added_on"`
+			EditedOn    *time.Time        `json:"edited_on"`
+			Public      bool              `json:"public"`
+			Visibility  string            `json:"visibility"`
+			ContentType string            `json:"content_type"`
+			Metadata    map[string]string `json:"metadata"`
+		} `json:"notes"`
+	} `json:"books"`
+}
+
+// readJSON reads the notes from a JSON document created by the export command
+func readJSON(path string) ([]noteInput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	return decodeJSON(f)
+}
+
+// decodeJSON reads the notes from a JSON document created by the export command
+func decodeJSON(r io.Reader) ([]noteInput, error) {
+	doc, err := decodeJSONDocument(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.inputs(), nil
+}
+
+// decodeJSONDocument decodes a JSON document created by the export command
+func decodeJSONDocument(r io.Reader) (jsonDocument, error) {
+	var doc jsonDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return doc, errors.Wrap(err, "decoding json")
+	}
+
+	return doc, nil
+}
+
+// inputs returns the notes in the document
+func (doc jsonDocument) inputs() []noteInput {
+	ret := []noteInput{}
+	for _, b := range doc.Books {
+		for _, n := range b.Notes {
+			input := noteInput{
+				UUID:        n.UUID,
+				BookLabel:   b.Label,
+				Title:       n.Title,
+				Content:     n.Content,
+				AddedOn:     n.AddedOn.UnixNano(),
+				Public:      n.Public,
+				Visibility:  n.Visibility,
+				ContentType: n.ContentType,
+				Metadata:    n.Metadata,
+			}
+			if n.EditedOn != nil {
+				input.EditedOn = n.EditedOn.UnixNano()
+			}
+
+			ret = append(ret, input)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,166 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/frontmatter"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// markdownMeta is the metadata of a note in the frontmatter of a Markdown file
+type markdownMeta struct {
+	UUID        string `yaml:"uuid"`
+	Title       string `yaml:"title"`
+	Book        string `yaml:"book"`
+	AddedOn     string `yaml:"added_on"`
+	EditedOn    string `yaml:"edited_on"`
+	Public      bool   `yaml:"public"`
+	Visibility  string `yaml:"visibility"`
+	ContentType string `yaml:"content_type"`
+}
+
+// toBookLabel converts the given name of a directory or a file into a valid book label
+func toBookLabel(name string) string {
+	return strings.Join(strings.Fields(name), "-")
+}
+
+// parseTime parses a time in the frontmatter and returns a timestamp in unix nanoseconds
+func parseTime(val string) (int64, error) {
+	if val == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, val)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing '%s'", val)
+	}
+
+	return t.UnixNano(), nil
+}
+
+// parseMarkdown parses a Markdown document into a note. If the document does not
+// have a frontmatter, the defaults are used for the book and the time the note was added.
+func parseMarkdown(content, defaultBook string, defaultAddedOn int64) (noteInput, error) {
+	ret := noteInput{
+		BookLabel: defaultBook,
+		AddedOn:   defaultAddedOn,
+	}
+
+	fmStr, body := frontmatter.Split(content)
+	ret.Content = body
+
+	if fmStr == "" {
+		return ret, nil
+	}
+
+	var fm markdownMeta
+	if err := yaml.Unmarshal([]byte(fmStr), &fm); err != nil {
+		return ret, errors.Wrap(err, "parsing the frontmatter")
+	}
+
+	if fm.Book != "" {
+		ret.BookLabel = fm.Book
+	}
+	ret.UUID = fm.UUID
+	ret.Title = fm.Title
+	ret.Public = fm.Public
+	ret.Visibility = fm.Visibility
+	ret.ContentType = fm.ContentType
+
+	addedOn, err := parseTime(fm.AddedOn)
+	if err != nil {
+		return ret, errors.Wrap(err, "parsing added_on")
+	}
+	if addedOn != 0 {
+		ret.AddedOn = addedOn
+	}
+
+	ret.EditedOn, err = parseTime(fm.EditedOn)
+	if err != nil {
+		return ret, errors.Wrap(err, "parsing edited_on")
+	}
+
+	return ret, nil
+}
+
+// readMarkdownFile reads a note from a Markdown file. Without a frontmatter, the note
+// belongs to the book named after the directory of the file.
+func readMarkdownFile(path string) ([]noteInput, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the file")
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the file info")
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the absolute path")
+	}
+
+	n, err := parseMarkdown(string(b), toBookLabel(filepath.Base(dir)), fi.ModTime().UnixNano())
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+
+	return []noteInput{n}, nil
+}
+
+// readMarkdownDir reads notes from all Markdown files in the directory, recursively
+func readMarkdownDir(root string) ([]noteInput, error) {
+	ret := []noteInput{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".md" && ext != ".markdown" {
+			return nil
+		}
+
+		notes, err := readMarkdownFile(path)
+		if err != nil {
+			return err
+		}
+
+		ret = append(ret, notes...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walking the directory")
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,467 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/secrets"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+)
+
+const (
+	// duplicateSkip leaves the existing note as it is, and does not import the duplicate
+	duplicateSkip = "skip"
+	// duplicateUpdate overwrites the existing note with the imported one
+	duplicateUpdate = "update"
+	// duplicateKeep imports the duplicate as a new note alongside the existing one
+	duplicateKeep = "duplicate"
+)
+
+// importBatchSize is the number of notes imported in a single transaction
+const importBatchSize = 500
+
+// validateDuplicatePolicy validates the policy for the notes that already exist
+func validateDuplicatePolicy(policy string) error {
+	if policy != duplicateSkip && policy != duplicateUpdate && policy != duplicateKeep {
+		return errors.Errorf("unknown policy '%s'. Use skip, update or duplicate", policy)
+	}
+
+	return nil
+}
+
+// noteInput is a note read from the import source
+type noteInput struct {
+	// UUID is the uuid of the note in the source, if the source was exported from dnote
+	UUID      string
+	BookLabel string
+	// Title is empty if the source does not specify it, in which case it is inferred from the content
+	Title    string
+	Content  string
+	AddedOn  int64
+	EditedOn int64
+	Public   bool
+	// Visibility is empty if the source does not specify it, in which case it follows Public
+	Visibility string
+	// ContentType is empty if the source does not specify it
+	ContentType string
+	// Metadata is nil if the source does not specify it
+	Metadata map[string]string
+}
+
+// bookPlan is a book into which notes will be imported. uuid is empty if the
+// book does not exist yet.
+type bookPlan struct {
+	uuid  string
+	label string
+	notes []noteInput
+	// existing holds, for each note, the uuid of the existing note that it duplicates, or
+	// an empty string
+	existing []string
+	// existingShared holds, for each note, whether the existing note that it duplicates
+	// is public or unlisted
+	existingShared []bool
+}
+
+// plan is a set of books and notes to be imported
+type plan struct {
+	books []*bookPlan
+	// policy is how the notes that already exist are handled
+	policy string
+}
+
+func (p plan) noteCount() int {
+	var ret int
+	for _, b := range p.books {
+		ret += len(b.notes)
+	}
+
+	return ret
+}
+
+func (p plan) duplicateCount() int {
+	var ret int
+	for _, b := range p.books {
+		for _, uuid := range b.existing {
+			if uuid != "" {
+				ret++
+			}
+		}
+	}
+
+	return ret
+}
+
+// result is the outcome of running a plan
+type result struct {
+	imported int
+	updated  int
+	skipped  int
+}
+
+// hashBody returns the hash of the content of a note
+func hashBody(body string) string {
+	sum := sha256.Sum256([]byte(body))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// noteIndex finds the existing notes that the imported notes duplicate
+type noteIndex struct {
+	uuids map[string]bool
+	// shared holds the uuids of the notes that are public or unlisted
+	shared map[string]bool
+	// hashes maps the hashes of the contents to the uuids of the notes
+	hashes map[string]string
+}
+
+// loadNoteIndex indexes the uuids and the contents of the notes that are not deleted
+func loadNoteIndex(db *database.DB) (noteIndex, error) {
+	ret := noteIndex{uuids: map[string]bool{}, shared: map[string]bool{}, hashes: map[string]string{}}
+
+	rows, err := db.Query("SELECT uuid, body, public FROM notes WHERE deleted = ?", false)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uuid, body string
+		var public bool
+		if err := rows.Scan(&uuid, &body, &public); err != nil {
+			return ret, errors.Wrap(err, "scanning a note")
+		}
+
+		ret.uuids[uuid] = true
+		ret.shared[uuid] = public
+		ret.hashes[hashBody(body)] = uuid
+	}
+
+	return ret, nil
+}
+
+// find returns the uuid of the existing note that has the same uuid as the given note,
+// or the same content, or an empty string if there is none
+func (i noteIndex) find(input noteInput) string {
+	if input.UUID != "" && i.uuids[input.UUID] {
+		return input.UUID
+	}
+
+	return i.hashes[hashBody(input.Content)]
+}
+
+// newPlan groups the notes by book, looks up the existing books, and finds the existing
+// notes that the notes duplicate
+func newPlan(ctx context.DnoteCtx, inputs []noteInput, policy string) (plan, error) {
+	ret := plan{policy: policy}
+	bookMap := map[string]*bookPlan{}
+
+	if err := validateDuplicatePolicy(policy); err != nil {
+		return ret, err
+	}
+
+	index, err := loadNoteIndex(ctx.DB)
+	if err != nil {
+		return ret, errors.Wrap(err, "indexing the existing notes")
+	}
+
+	for _, input := range inputs {
+		if input.ContentType != "" {
+			if err := validate.ContentType(input.ContentType); err != nil {
+				return ret, errors.Wrapf(err, "invalid content type '%s'", input.ContentType)
+			}
+		}
+		if input.Visibility != "" {
+			if err := validate.NoteVisibility(input.Visibility); err != nil {
+				return ret, errors.Wrapf(err, "invalid visibility '%s'", input.Visibility)
+			}
+		}
+		for k := range input.Metadata {
+			if err := validate.MetadataKey(k); err != nil {
+				return ret, errors.Wrapf(err, "invalid metadata key '%s'", k)
+			}
+		}
+
+		key := input.BookLabel
+		if !ctx.CaseSensitiveBooks {
+			key = strings.ToLower(key)
+		}
+
+		b, ok := bookMap[key]
+		if !ok {
+			if err := validate.BookName(input.BookLabel); err != nil {
+				return ret, errors.Wrapf(err, "invalid book name '%s'", input.BookLabel)
+			}
+
+			label, err := database.ResolveBookLabel(ctx.DB, input.BookLabel, ctx.CaseSensitiveBooks)
+			if err != nil {
+				return ret, errors.Wrapf(err, "resolving the book %s", input.BookLabel)
+			}
+
+			var uuid string
+			err = ctx.DB.QueryRow("SELECT uuid FROM books WHERE label = ?", label).Scan(&uuid)
+			if err != nil && err != sql.ErrNoRows {
+				return ret, errors.Wrapf(err, "finding the book %s", label)
+			}
+
+			b = &bookPlan{uuid: uuid, label: label}
+			bookMap[key] = b
+			ret.books = append(ret.books, b)
+		}
+
+		b.notes = append(b.notes, input)
+		existing := index.find(input)
+		b.existing = append(b.existing, existing)
+		b.existingShared = append(b.existingShared, index.shared[existing])
+	}
+
+	return ret, nil
+}
+
+// planEntry is a note in a plan, along with the book into which it is imported
+type planEntry struct {
+	book           *bookPlan
+	input          noteInput
+	existing       string
+	existingShared bool
+}
+
+func (p plan) entries() []planEntry {
+	ret := []planEntry{}
+	for _, b := range p.books {
+		for idx, input := range b.notes {
+			ret = append(ret, planEntry{book: b, input: input, existing: b.existing[idx], existingShared: b.existingShared[idx]})
+		}
+	}
+
+	return ret
+}
+
+// isShared returns true if the note is public or unlisted once the plan runs. A note
+// that updates an existing one keeps its visibility if the source does not specify it.
+func (p plan) isShared(e planEntry) bool {
+	if e.existing != "" && p.policy == duplicateSkip {
+		return false
+	}
+
+	if e.input.Visibility != "" {
+		return e.input.Visibility != database.NoteVisibilityPrivate
+	}
+	if e.existing != "" && p.policy == duplicateUpdate {
+		return e.existingShared
+	}
+
+	return e.input.Public
+}
+
+// noteSecrets is a note that the plan shares, and the likely secrets found in it
+type noteSecrets struct {
+	entry    planEntry
+	findings []secrets.Finding
+}
+
+// findSecrets scans the notes that the plan shares for likely secrets
+func (p plan) findSecrets() []noteSecrets {
+	ret := []noteSecrets{}
+	for _, e := range p.entries() {
+		if !p.isShared(e) {
+			continue
+		}
+
+		findings := secrets.Scan(e.input.Content)
+		if len(findings) > 0 {
+			ret = append(ret, noteSecrets{entry: e, findings: findings})
+		}
+	}
+
+	return ret
+}
+
+// run imports the notes in batches, each in a transaction, starting after the notes that
+// the journal records as done. The journal is saved after each batch so that an interrupted
+// import can be resumed, and is removed once all notes are imported. The books and notes
+// are marked dirty so that the next sync uploads them.
+func (p plan) run(ctx context.DnoteCtx, j *journal) (result, error) {
+	var ret result
+
+	entries := p.entries()
+	for start := j.Done; start < len(entries); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return ret, errors.Wrap(err, "beginning a transaction")
+		}
+
+		var batch result
+		for _, e := range entries[start:end] {
+			if err := p.write(ctx, tx, e, &batch); err != nil {
+				tx.Rollback()
+				return ret, err
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			tx.Rollback()
+			return ret, errors.Wrap(err, "committing a transaction")
+		}
+
+		ret.imported += batch.imported
+		ret.updated += batch.updated
+		ret.skipped += batch.skipped
+
+		if err := j.save(end); err != nil {
+			return ret, err
+		}
+	}
+
+	if err := j.remove(); err != nil {
+		return ret, err
+	}
+
+	return ret, nil
+}
+
+// getBookUUID returns the uuid of the book, creating it if it does not exist yet
+func (b *bookPlan) getBookUUID(tx *database.DB) (string, error) {
+	if b.uuid != "" {
+		return b.uuid, nil
+	}
+
+	uuid, err := utils.GenerateUUID()
+	if err != nil {
+		return "", errors.Wrap(err, "generating uuid")
+	}
+
+	book := database.NewBook(uuid, b.label, 0, false, true)
+	if err := book.Insert(tx); err != nil {
+		return "", errors.Wrapf(err, "creating the book %s", b.label)
+	}
+
+	b.uuid = uuid
+
+	return uuid, nil
+}
+
+// write imports a note according to the policy, and counts the outcome in the result
+func (p plan) write(ctx context.DnoteCtx, tx *database.DB, e planEntry, res *result) error {
+	if e.existing != "" && p.policy == duplicateSkip {
+		res.skipped++
+		return nil
+	}
+
+	bookUUID, err := e.book.getBookUUID(tx)
+	if err != nil {
+		return err
+	}
+
+	input := e.input
+
+	title := input.Title
+	if title == "" {
+		title = database.InferTitle(input.Content)
+	}
+
+	if e.existing != "" && p.policy == duplicateUpdate {
+		if err := updateNote(ctx, tx, e.existing, bookUUID, title, input); err != nil {
+			return errors.Wrapf(err, "updating the note %s", e.existing)
+		}
+
+		res.updated++
+		return nil
+	}
+
+	noteUUID, err := utils.GenerateUUID()
+	if err != nil {
+		return errors.Wrap(err, "generating uuid")
+	}
+
+	addedOn := input.AddedOn
+	if addedOn == 0 {
+		addedOn = ctx.Clock.Now().UnixNano()
+	}
+
+	n := database.NewNote(noteUUID, bookUUID, title, input.Content, addedOn, input.EditedOn, 0, input.Public, false, true)
+	if input.Visibility != "" {
+		n.Visibility = input.Visibility
+		n.Public = input.Visibility != database.NoteVisibilityPrivate
+	}
+	if err := n.Insert(tx); err != nil {
+		return errors.Wrap(err, "creating the note")
+	}
+	if input.ContentType != "" {
+		if _, err := tx.Exec("UPDATE notes SET content_type = ? WHERE uuid = ?", input.ContentType, noteUUID); err != nil {
+			return errors.Wrap(err, "setting the content type")
+		}
+	}
+	for k, v := range input.Metadata {
+		if err := database.SetNoteMetadata(tx, noteUUID, k, v); err != nil {
+			return err
+		}
+	}
+
+	res.imported++
+
+	return nil
+}
+
+// updateNote overwrites the existing note with the imported one, saving its current state
+// as a version first. The visibility, the content type and the metadata are changed only if
+// the source specifies them.
+func updateNote(ctx context.DnoteCtx, tx *database.DB, uuid, bookUUID, title string, input noteInput) error {
+	if err := database.SaveNoteVersion(tx, ctx.Clock, uuid, database.NoteVersionEdit, ctx.HistoryRetention); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec("UPDATE notes SET book_uuid = ?, title = ?, body = ?, edited_on = ?, dirty = ? WHERE uuid = ?",
+		bookUUID, title, input.Content, ctx.Clock.Now().UnixNano(), true, uuid)
+	if err != nil {
+		return errors.Wrap(err, "updating the content")
+	}
+
+	if input.Visibility != "" {
+		_, err := tx.Exec("UPDATE notes SET visibility = ?, public = ? WHERE uuid = ?",
+			input.Visibility, input.Visibility != database.NoteVisibilityPrivate, uuid)
+		if err != nil {
+			return errors.Wrap(err, "updating the visibility")
+		}
+	}
+	if input.ContentType != "" {
+		if _, err := tx.Exec("UPDATE notes SET content_type = ? WHERE uuid = ?", input.ContentType, uuid); err != nil {
+			return errors.Wrap(err, "updating the content type")
+		}
+	}
+	if input.Metadata != nil {
+		if err := database.ReplaceNoteMetadata(tx, uuid, input.Metadata); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
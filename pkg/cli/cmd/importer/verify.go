@@ -0,0 +1,297 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var verifyIdentitiesFlag []string
+var sampleFlag int
+
+var verifyExample = `
+ * Check a backup created by 'dnote export'
+ dnote verify-backup backup.json
+
+ * Check a backup encrypted for an age recipient
+ dnote verify-backup backup.json.age --identity ~/.config/age/key.txt
+
+ * Restore 50 notes of the backup on trial, instead of 5
+ dnote verify-backup backup.json --sample 50`
+
+func verifyPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+	if sampleFlag < 0 {
+		return errors.New("--sample must not be negative")
+	}
+
+	return nil
+}
+
+// NewVerifyCmd returns a new verify-backup command
+func NewVerifyCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "verify-backup <path>",
+		Short:   "Check that a backup can be restored",
+		Example: verifyExample,
+		PreRunE: verifyPreRun,
+		RunE:    newVerifyRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&verifyIdentitiesFlag, "identity", "i", []string{}, "An age identity file to decrypt an encrypted backup with. Can be given multiple times")
+	f.IntVarP(&sampleFlag, "sample", "", 5, "The number of notes to restore into a temporary database on trial")
+
+	return cmd
+}
+
+// readBackup decrypts the backup at the given path if it is encrypted, and decodes it. It
+// returns the name of the provider that encrypted it, or an empty string.
+func readBackup(path string, identities []string) (jsonDocument, string, error) {
+	encryption, err := getEncryption(path)
+	if err != nil {
+		return jsonDocument{}, "", err
+	}
+
+	if encryption != "" {
+		p, err := crypt.NewProvider(encryption, nil, identities)
+		if err != nil {
+			return jsonDocument{}, "", err
+		}
+
+		doc, err := readEncryptedJSONDocument(path, p)
+		return doc, encryption, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return jsonDocument{}, "", errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	doc, err := decodeJSONDocument(f)
+	return doc, "", err
+}
+
+// checkManifest returns the descriptions of the differences between the document and
+// its manifest
+func checkManifest(doc jsonDocument) []string {
+	m := doc.Manifest
+	ret := []string{}
+
+	if len(doc.Books) != m.BookCount {
+		ret = append(ret, fmt.Sprintf("has %d books, but the manifest lists %d", len(doc.Books), m.BookCount))
+	}
+
+	inputs := doc.inputs()
+	if len(inputs) != m.NoteCount {
+		ret = append(ret, fmt.Sprintf("has %d notes, but the manifest lists %d", len(inputs), m.NoteCount))
+	}
+
+	seen := map[string]bool{}
+	for _, input := range inputs {
+		seen[input.UUID] = true
+
+		hash, ok := m.Hashes[input.UUID]
+		if !ok {
+			ret = append(ret, fmt.Sprintf("note %s is not in the manifest", input.UUID))
+		} else if hash != hashBody(input.Content) {
+			ret = append(ret, fmt.Sprintf("note %s does not match its hash", input.UUID))
+		}
+	}
+
+	missing := []string{}
+	for uuid := range m.Hashes {
+		if !seen[uuid] {
+			missing = append(missing, uuid)
+		}
+	}
+	sort.Strings(missing)
+
+	for _, uuid := range missing {
+		ret = append(ret, fmt.Sprintf("note %s is in the manifest, but missing", uuid))
+	}
+
+	return ret
+}
+
+// sampleInputs returns n of the notes, picked at random, in their original order. It
+// returns all notes if there are no more than n.
+func sampleInputs(inputs []noteInput, n int, rng *rand.Rand) []noteInput {
+	if n >= len(inputs) {
+		return inputs
+	}
+
+	idxs := rng.Perm(len(inputs))[:n]
+	sort.Ints(idxs)
+
+	ret := []noteInput{}
+	for _, idx := range idxs {
+		ret = append(ret, inputs[idx])
+	}
+
+	return ret
+}
+
+// restoreKey identifies a restored note by its book and the hash of its content
+func restoreKey(bookLabel, content string) string {
+	return bookLabel + "\x00" + hashBody(content)
+}
+
+// restoreSample imports the notes into a temporary database as the import command would,
+// and returns the descriptions of the notes that did not come out intact
+func restoreSample(ctx context.DnoteCtx, inputs []noteInput) ([]string, error) {
+	dir, err := ioutil.TempDir("", "dnote-verify")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating a temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	paths := context.Paths{
+		Home:        dir,
+		Config:      filepath.Join(dir, "config"),
+		Data:        filepath.Join(dir, "data"),
+		Cache:       filepath.Join(dir, "cache"),
+		LegacyDnote: filepath.Join(dir, consts.LegacyDnoteDirName),
+		DB:          filepath.Join(dir, consts.DnoteDBFileName),
+	}
+
+	restoreCtx, err := infra.InitPaths(paths, ctx.APIEndpoint, ctx.Version)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing the temporary database")
+	}
+	defer restoreCtx.DB.Close()
+
+	p, err := newPlan(*restoreCtx, inputs, duplicateKeep)
+	if err != nil {
+		return nil, errors.Wrap(err, "planning the restore")
+	}
+	j, err := loadJournal(*restoreCtx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.run(*restoreCtx, j); err != nil {
+		return nil, errors.Wrap(err, "restoring")
+	}
+
+	rows, err := restoreCtx.DB.Query(`SELECT books.label, notes.body
+	FROM notes
+	INNER JOIN books ON books.uuid = notes.book_uuid`)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the restored notes")
+	}
+	defer rows.Close()
+
+	restored := map[string]int{}
+	for rows.Next() {
+		var label, body string
+		if err := rows.Scan(&label, &body); err != nil {
+			return nil, errors.Wrap(err, "scanning a restored note")
+		}
+
+		restored[restoreKey(label, body)]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading the restored notes")
+	}
+
+	ret := []string{}
+	for _, input := range inputs {
+		key := restoreKey(input.BookLabel, input.Content)
+		if restored[key] == 0 {
+			ret = append(ret, fmt.Sprintf("note %s was not restored intact", input.UUID))
+			continue
+		}
+
+		restored[key]--
+	}
+
+	return ret, nil
+}
+
+// reportProblems prints the outcome of a check and returns the number of problems
+func reportProblems(name string, problems []string) int {
+	if len(problems) == 0 {
+		log.Successf("%s\n", name)
+		return 0
+	}
+
+	log.Warnf("%s: %d problems\n", name, len(problems))
+	for _, p := range problems {
+		log.Plainf("  %s\n", p)
+	}
+
+	return len(problems)
+}
+
+func newVerifyRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+
+		doc, encryption, err := readBackup(path, verifyIdentitiesFlag)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", path)
+		}
+		if encryption != "" {
+			log.Successf("decrypted with %s\n", encryption)
+		}
+
+		inputs := doc.inputs()
+		log.Successf("read %d books and %d notes\n", len(doc.Books), len(inputs))
+
+		var total int
+		if doc.Manifest == nil {
+			log.Warnf("no manifest. The backups exported by older versions of dnote do not have one\n")
+		} else {
+			total += reportProblems("manifest", checkManifest(doc))
+		}
+
+		sample := sampleInputs(inputs, sampleFlag, rand.New(rand.NewSource(time.Now().UnixNano())))
+		if len(sample) > 0 {
+			problems, err := restoreSample(ctx, sample)
+			if err != nil {
+				return errors.Wrap(err, "restoring the sample")
+			}
+
+			total += reportProblems(fmt.Sprintf("restored %d sample notes", len(sample)), problems)
+		}
+
+		if total > 0 {
+			return errors.Errorf("found %d problems", total)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/pkg/errors"
+)
+
+// testBackup is a backup with a manifest, as exported by the export command
+const testBackup = `{
+  "version": 1,
+  "books": [
+    {
+      "uuid": "b1-uuid",
+      "label": "js",
+      "notes": [
+        {"uuid": "n1-uuid", "content": "n1 body", "added_on": "2020-03-14T00:00:00Z"},
+        {"uuid": "n2-uuid", "content": "n2 body", "added_on": "2020-03-15T00:00:00Z"}
+      ]
+    }
+  ],
+  "manifest": {
+    "book_count": 1,
+    "note_count": 2,
+    "hashes": {
+      "n1-uuid": "042fe7098474ac5eb8b03f6e71083a5fc643ae7c64c133915c74c2c103ac2154",
+      "n2-uuid": "f5614f2b4beb1dc1023a09938c6ad60bcee3af39b7a7b217556230e762e94f29"
+    }
+  }
+}`
+
+func TestReadBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnote-verify-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.json")
+	if err := ioutil.WriteFile(path, []byte(testBackup), 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the backup"))
+	}
+
+	doc, encryption, err := readBackup(path, nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	assert.Equal(t, encryption, "", "encryption mismatch")
+	assert.Equal(t, len(doc.inputs()), 2, "note count mismatch")
+	assert.Equal(t, doc.Manifest.NoteCount, 2, "manifest note count mismatch")
+	assert.DeepEqual(t, checkManifest(doc), []string{}, "problems mismatch")
+}
+
+func TestCheckManifest(t *testing.T) {
+	testCases := []struct {
+		name     string
+		backup   string
+		expected []string
+	}{
+		{
+			name:     "intact",
+			backup:   testBackup,
+			expected: []string{},
+		},
+		{
+			name:   "changed note",
+			backup: strings.Replace(testBackup, `"n1 body"`, `"n1 edited"`, 1),
+			expected: []string{
+				"note n1-uuid does not match its hash",
+			},
+		},
+		{
+			name: "missing note",
+			backup: strings.Replace(testBackup, `,
+        {"uuid": "n2-uuid", "content": "n2 body", "added_on": "2020-03-15T00:00:00Z"}`, "", 1),
+			expected: []string{
+				"has 1 notes, but the manifest lists 2",
+				"note n2-uuid is in the manifest, but missing",
+			},
+		},
+		{
+			name:   "note not in the manifest",
+			backup: strings.Replace(testBackup, `"n2-uuid": "f5614f2b`, `"n3-uuid": "f5614f2b`, 1),
+			expected: []string{
+				"note n2-uuid is not in the manifest",
+				"note n3-uuid is in the manifest, but missing",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := decodeJSONDocument(strings.NewReader(tc.backup))
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "decoding"))
+			}
+
+			assert.DeepEqual(t, checkManifest(doc), tc.expected, "problems mismatch")
+		})
+	}
+}
+
+func TestSampleInputs(t *testing.T) {
+	inputs := []noteInput{{UUID: "n1"}, {UUID: "n2"}, {UUID: "n3"}, {UUID: "n4"}}
+	rng := rand.New(rand.NewSource(1))
+
+	assert.DeepEqual(t, sampleInputs(inputs, 5, rng), inputs, "all notes mismatch")
+	assert.Equal(t, len(sampleInputs(inputs, 0, rng)), 0, "no notes mismatch")
+
+	got := sampleInputs(inputs, 2, rng)
+	assert.Equal(t, len(got), 2, "sample size mismatch")
+
+	// the sample keeps the original order
+	idx := map[string]int{"n1": 0, "n2": 1, "n3": 2, "n4": 3}
+	if idx[got[0].UUID] >= idx[got[1].UUID] {
+		t.Errorf("sample out of order: %s, %s", got[0].UUID, got[1].UUID)
+	}
+}
+
+func TestRestoreSample(t *testing.T) {
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	inputs := []noteInput{
+		{UUID: "n1-uuid", BookLabel: "js", Content: "n1 body", AddedOn: 1},
+		{UUID: "n2-uuid", BookLabel: "css", Content: "n2 body", AddedOn: 2},
+		{UUID: "n3-uuid", BookLabel: "css", Content: "n2 body", AddedOn: 3},
+	}
+
+	problems, err := restoreSample(ctx, inputs)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+}
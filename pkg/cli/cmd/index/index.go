@@ -0,0 +1,112 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package index
+
+import (
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var rebuildExample = `
+ * Rebuild the search index if the search results are out of date
+ dnote index rebuild`
+
+// NewCmd returns a new index command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Manage the search index",
+	}
+
+	cmd.AddCommand(newRebuildCmd(ctx))
+
+	return cmd
+}
+
+func newRebuildCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rebuild",
+		Short:   "Rebuild the search index from the notes",
+		Example: rebuildExample,
+		RunE:    newRebuildRun(ctx),
+	}
+
+	return cmd
+}
+
+// rebuild recreates the search index and its triggers in a transaction
+func rebuild(db *database.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := database.RebuildFTS(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func newRebuildRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		problems, err := database.CheckFTS(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "checking the search index")
+		}
+		for _, p := range problems {
+			log.Warnf("%s\n", p)
+		}
+
+		if err := rebuild(ctx.DB); err != nil {
+			return errors.Wrap(err, "rebuilding the search index")
+		}
+
+		problems, err = database.CheckFTS(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "verifying the search index")
+		}
+		if len(problems) > 0 {
+			for _, p := range problems {
+				log.Errorf("%s\n", p)
+			}
+
+			return errors.New("the search index is still inconsistent after rebuilding")
+		}
+
+		var count int
+		if err := ctx.DB.QueryRow("SELECT count(*) FROM notes WHERE deleted = ?", false).Scan(&count); err != nil {
+			return errors.Wrap(err, "counting the notes")
+		}
+
+		log.Successf("rebuilt the search index of %d notes\n", count)
+
+		return nil
+	}
+}
@@ -21,23 +21,45 @@ package login
 import (
 	"fmt"
 	"net/url"
-	"strconv"
+	"strings"
 
 	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/config"
 	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/infra"
 	"github.com/dnote/dnote/pkg/cli/log"
 	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/dnote/dnote/pkg/cli/validate"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var example = `
-  dnote login`
+  dnote login
 
-var usernameFlag, passwordFlag string
+  * Log in to a self-hosted server
+  dnote login --server https://dnote.example.com/api
+
+  * Log in to an account with a second factor, giving the code without a prompt
+  dnote login -u alice@example.com --code 123456`
+
+var usernameFlag, passwordFlag, serverFlag, codeFlag string
+
+// maxMFAAttempts is the number of the times a second factor code is asked for before
+// the login fails
+const maxMFAAttempts = 3
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if serverFlag != "" {
+		if err := validate.APIEndpoint(serverFlag); err != nil {
+			return errors.Wrap(err, "invalid server")
+		}
+	}
+
+	return nil
+}
 
 // NewCmd returns a new login command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
@@ -45,12 +67,15 @@ func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 		Use:     "login",
 		Short:   "Login to dnote server",
 		Example: example,
+		PreRunE: preRun,
 		RunE:    newRun(ctx),
 	}
 
 	f := cmd.Flags()
 	f.StringVarP(&usernameFlag, "username", "u", "", "email address for authentication")
 	f.StringVarP(&passwordFlag, "password", "p", "", "password for authentication")
+	f.StringVarP(&serverFlag, "server", "s", "", "API endpoint of the server to log in to, which is saved in the configuration file")
+	f.StringVarP(&codeFlag, "code", "", "", "TOTP code or backup code for the accounts with a second factor")
 
 	return cmd
 }
@@ -61,6 +86,20 @@ func Do(ctx context.DnoteCtx, email, password string) error {
 	if err != nil {
 		return errors.Wrap(err, "requesting session")
 	}
+	// the second factor is asked for only when the server requires it, as the servers
+	// without the support for it never do
+	if signinResp.MFARequired {
+		if signinResp.MFAToken == "" {
+			return client.ErrMFAUnsupported
+		}
+
+		signinResp, err = signinMFA(ctx, signinResp.MFAToken)
+		if err != nil {
+			return errors.Wrap(err, "verifying the second factor")
+		}
+	} else if codeFlag != "" {
+		log.Warnf("the server did not ask for a second factor. --code was not used\n")
+	}
 
 	db := ctx.DB
 	tx, err := db.Begin()
@@ -68,11 +107,9 @@ func Do(ctx context.DnoteCtx, email, password string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	if err := database.UpsertSystem(tx, consts.SystemSessionKey, signinResp.Key); err != nil {
-		return errors.Wrap(err, "saving session key")
-	}
-	if err := database.UpsertSystem(tx, consts.SystemSessionKeyExpiry, strconv.FormatInt(signinResp.ExpiresAt, 10)); err != nil {
-		return errors.Wrap(err, "saving session key")
+	if err := client.SaveSessionTx(tx, signinResp); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving the session")
 	}
 
 	tx.Commit()
@@ -80,6 +117,44 @@ func Do(ctx context.DnoteCtx, email, password string) error {
 	return nil
 }
 
+// signinMFA asks for a second factor code and exchanges it for a session, asking again
+// if the code is wrong unless it was given by the flag
+func signinMFA(ctx context.DnoteCtx, mfaToken string) (client.SigninResponse, error) {
+	for attempt := 1; ; attempt++ {
+		code, err := getCode()
+		if err != nil {
+			return client.SigninResponse{}, errors.Wrap(err, "getting code input")
+		}
+
+		resp, err := client.SigninMFA(ctx, mfaToken, code)
+		if errors.Cause(err) == client.ErrInvalidMFACode && codeFlag == "" && attempt < maxMFAAttempts {
+			log.Error("wrong code. Please try again\n")
+			continue
+		}
+
+		return resp, err
+	}
+}
+
+func getCode() (string, error) {
+	if codeFlag != "" {
+		return codeFlag, nil
+	}
+
+	var code string
+	if err := ui.PromptInput("authentication code, or a backup code", &code); err != nil {
+		return "", errors.Wrap(err, "getting code input")
+	}
+
+	// the codes are often copied with the space in the middle, such as '123 456'
+	code = strings.Join(strings.Fields(code), "")
+	if code == "" {
+		return "", errors.New("Code is empty")
+	}
+
+	return code, nil
+}
+
 func getUsername() (string, error) {
 	if usernameFlag != "" {
 		return usernameFlag, nil
@@ -149,8 +224,85 @@ func getGreeting(ctx context.DnoteCtx) string {
 	return fmt.Sprintf("%s (%s)\n", base, serverURL)
 }
 
+// resetSyncState makes the next sync upload all books and notes as if they were new,
+// so that they can be synced with another server
+func resetSyncState(tx *database.DB) error {
+	if _, err := tx.Exec("UPDATE books SET usn = 0, dirty = true"); err != nil {
+		return errors.Wrap(err, "resetting books")
+	}
+	if _, err := tx.Exec("UPDATE notes SET usn = 0, dirty = true"); err != nil {
+		return errors.Wrap(err, "resetting notes")
+	}
+	if err := database.UpdateSystem(tx, consts.SystemLastMaxUSN, 0); err != nil {
+		return errors.Wrap(err, "resetting the last max usn")
+	}
+	if err := database.UpdateSystem(tx, consts.SystemLastSyncAt, 0); err != nil {
+		return errors.Wrap(err, "resetting the last sync time")
+	}
+
+	return nil
+}
+
+// confirmServerChange asks if the books and notes synced with the current server
+// should be synced with the new one. It returns false if the user declines.
+func confirmServerChange(ctx context.DnoteCtx) (bool, error) {
+	var lastMaxUSN int
+	if err := database.GetSystem(ctx.DB, consts.SystemLastMaxUSN, &lastMaxUSN); err != nil {
+		return false, errors.Wrap(err, "getting the last max usn")
+	}
+	if lastMaxUSN == 0 {
+		return true, nil
+	}
+
+	var evictedCount int
+	if err := ctx.DB.QueryRow("SELECT count(*) FROM notes WHERE evicted = true").Scan(&evictedCount); err != nil {
+		return false, errors.Wrap(err, "counting evicted notes")
+	}
+	if evictedCount > 0 {
+		return false, errors.Errorf("%d notes are only on %s. Turn off the thin mode and sync before changing the server", evictedCount, ctx.APIEndpoint)
+	}
+
+	log.Warnf("this device has been synced with %s. All books and notes will be uploaded to the new server on the next sync.\n", ctx.APIEndpoint)
+
+	return ui.Confirm("continue?", false)
+}
+
+// saveServer saves the API endpoint in the configuration file
+func saveServer(ctx context.DnoteCtx, endpoint string) error {
+	cf, err := config.Read(ctx)
+	if err != nil {
+		return errors.Wrap(err, "reading the config")
+	}
+
+	cf.APIEndpoint = endpoint
+
+	if err := config.Write(ctx, cf); err != nil {
+		return errors.Wrap(err, "writing the config")
+	}
+
+	return nil
+}
+
 func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
+		server := strings.TrimSuffix(serverFlag, "/")
+		serverChanged := server != "" && server != strings.TrimSuffix(ctx.APIEndpoint, "/")
+		if serverChanged {
+			ok, err := confirmServerChange(ctx)
+			if err != nil {
+				return errors.Wrap(err, "checking the sync state")
+			}
+			if !ok {
+				return nil
+			}
+
+			ctx.APIEndpoint = server
+		}
+
+		if err := client.Probe(ctx); err != nil {
+			return errors.Wrap(err, "connecting to the server")
+		}
+
 		greeting := getGreeting(ctx)
 		log.Plain(greeting)
 
@@ -173,10 +325,35 @@ func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 		if errors.Cause(err) == client.ErrInvalidLogin {
 			log.Error("wrong login\n")
 			return nil
+		} else if errors.Cause(err) == client.ErrInvalidMFACode {
+			log.Error("wrong authentication code\n")
+			return nil
+		} else if errors.Cause(err) == client.ErrMFAUnsupported {
+			log.Error("the account requires a second factor, which the server cannot verify\n")
+			return nil
 		} else if err != nil {
 			return errors.Wrap(err, "logging in")
 		}
 
+		if serverChanged {
+			if err := saveServer(ctx, server); err != nil {
+				return errors.Wrap(err, "saving the server")
+			}
+
+			tx, err := ctx.DB.Begin()
+			if err != nil {
+				return errors.Wrap(err, "beginning a transaction")
+			}
+			if err := resetSyncState(tx); err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "resetting the sync state")
+			}
+			if err := tx.Commit(); err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "committing a transaction")
+			}
+		}
+
 		log.Success("logged in\n")
 
 		return nil
@@ -1,13 +1,27 @@
 package login
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
 )
 
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
 func TestGetServerDisplayURL(t *testing.T) {
 	testCases := []struct {
 		apiEndpoint string
@@ -54,3 +68,170 @@ func TestGetServerDisplayURL(t *testing.T) {
 		})
 	}
 }
+
+func TestResetSyncState(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 12)
+	database.MustExec(t, "inserting last sync at", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastSyncAt, 1542058875)
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "js", 3, false)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 12, false)
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := resetSyncState(tx); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+	tx.Commit()
+
+	// test
+	var lastMaxUSN, lastSyncAt int
+	database.MustScan(t, "getting last max usn", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastMaxUSN), &lastMaxUSN)
+	database.MustScan(t, "getting last sync at", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastSyncAt), &lastSyncAt)
+	assert.Equal(t, lastMaxUSN, 0, "last max usn mismatch")
+	assert.Equal(t, lastSyncAt, 0, "last sync at mismatch")
+
+	var b1USN, n1USN int
+	var b1Dirty, n1Dirty bool
+	database.MustScan(t, "getting b1", db.QueryRow("SELECT usn, dirty FROM books WHERE uuid = ?", "b1-uuid"), &b1USN, &b1Dirty)
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT usn, dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1USN, &n1Dirty)
+	assert.Equal(t, b1USN, 0, "b1 usn mismatch")
+	assert.Equal(t, b1Dirty, true, "b1 dirty mismatch")
+	assert.Equal(t, n1USN, 0, "n1 usn mismatch")
+	assert.Equal(t, n1Dirty, true, "n1 dirty mismatch")
+}
+
+func TestDo_mfa(t *testing.T) {
+	var codes []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v3/signin":
+			w.Write([]byte(`{"mfa_required": true, "mfa_token": "mfa-token"}`))
+		case "/v3/signin/mfa":
+			var payload client.SigninMFAPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload in the test server"))
+			}
+			codes = append(codes, payload.Code)
+
+			if payload.MFAToken != "mfa-token" || payload.Code != "123456" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"message": "wrong code"}`))
+				return
+			}
+
+			w.Write([]byte(`{"key": "session-key", "expires_at": 1596439890}`))
+		default:
+			t.Fatalf("unrecognized endpoint reached Method: %s URL: %s", r.Method, r.URL.String())
+		}
+	}))
+	defer ts.Close()
+
+	t.Run("valid code", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+		ctx.APIEndpoint = ts.URL
+
+		codes = nil
+		codeFlag = "123456"
+		defer func() { codeFlag = "" }()
+
+		// execute
+		if err := Do(ctx, "alice@example.com", "pass1234"); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		var sessionKey string
+		database.MustScan(t, "getting session key", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSessionKey), &sessionKey)
+		assert.Equal(t, sessionKey, "session-key", "session key mismatch")
+		assert.DeepEqual(t, codes, []string{"123456"}, "codes mismatch")
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+		ctx.APIEndpoint = ts.URL
+
+		codes = nil
+		codeFlag = "654321"
+		defer func() { codeFlag = "" }()
+
+		// execute
+		err := Do(ctx, "alice@example.com", "pass1234")
+
+		// test
+		assert.Equal(t, errors.Cause(err), client.ErrInvalidMFACode, "error mismatch")
+		assert.DeepEqual(t, codes, []string{"654321"}, "the code from the flag should not be retried")
+
+		var count int
+		database.MustScan(t, "counting session keys", ctx.DB.QueryRow("SELECT count(*) FROM system WHERE key = ?", consts.SystemSessionKey), &count)
+		assert.Equal(t, count, 0, "no session should be saved")
+	})
+}
+
+func TestDo_mfaUnsupported(t *testing.T) {
+	testCases := []struct {
+		name        string
+		signinResp  string
+		expectedErr error
+	}{
+		{
+			name:        "not required",
+			signinResp:  `{"key": "session-key", "expires_at": 1596439890}`,
+			expectedErr: nil,
+		},
+		{
+			name:        "required without the endpoint",
+			signinResp:  `{"mfa_required": true, "mfa_token": "mfa-token"}`,
+			expectedErr: client.ErrMFAUnsupported,
+		},
+		{
+			name:        "required without a token",
+			signinResp:  `{"mfa_required": true}`,
+			expectedErr: client.ErrMFAUnsupported,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// a server without /v3/signin/mfa
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v3/signin" {
+					http.NotFound(w, r)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tc.signinResp))
+			}))
+			defer ts.Close()
+
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+			ctx.APIEndpoint = ts.URL
+
+			codeFlag = "123456"
+			defer func() { codeFlag = "" }()
+
+			// execute
+			err := Do(ctx, "alice@example.com", "pass1234")
+
+			// test
+			assert.Equal(t, errors.Cause(err), tc.expectedErr, "error mismatch")
+		})
+	}
+}
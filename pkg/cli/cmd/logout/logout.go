@@ -76,6 +76,9 @@ func Do(ctx context.DnoteCtx) error {
 	if err := database.DeleteSystem(tx, consts.SystemSessionKeyExpiry); err != nil {
 		return errors.Wrap(err, "deleting session key expiry")
 	}
+	if err := database.DeleteSystem(tx, consts.SystemRefreshToken); err != nil {
+		return errors.Wrap(err, "deleting refresh token")
+	}
 
 	tx.Commit()
 
@@ -23,9 +23,14 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/dnote/dnote/pkg/cli/completion"
 	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/deprecation"
 	"github.com/dnote/dnote/pkg/cli/infra"
 	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/validate"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -36,17 +41,26 @@ var example = `
 
  * List notes in a book
  dnote ls javascript
- `
 
-var deprecationWarning = `and "view" will replace it in the future version.
+ * List notes in a book, most recently viewed first
+ dnote ls javascript --sort last-viewed
+
+ * List all books, including the archived ones
+ dnote ls --archived
+ `
 
-Run "dnote view --help" for more information.
-`
+var sortFlag string
+var archivedFlag bool
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) > 1 {
 		return errors.New("Incorrect number of argument")
 	}
+	if sortFlag != "" {
+		if err := validate.NoteSort(sortFlag); err != nil {
+			return errors.Wrap(err, "invalid sort")
+		}
+	}
 
 	return nil
 }
@@ -54,31 +68,49 @@ func preRun(cmd *cobra.Command, args []string) error {
 // NewCmd returns a new ls command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:        "ls <book name?>",
-		Aliases:    []string{"l", "notes"},
-		Short:      "List all notes",
-		Example:    example,
-		RunE:       NewRun(ctx, false),
-		PreRunE:    preRun,
-		Deprecated: deprecationWarning,
+		Use:               "ls <book name?>",
+		Aliases:           []string{"l", "notes"},
+		Short:             "List all notes",
+		Example:           example,
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+		PreRunE:           preRun,
 	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && sortFlag != "" {
+			return errors.New("--sort flag is only valid when listing notes in a book")
+		}
+
+		return NewRun(ctx, false, sortFlag, archivedFlag)(cmd, args)
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&sortFlag, "sort", "s", "", "the order of the notes in a book: manual, added, edited, alphabetical or last-viewed. Defaults to the sort set for the book")
+	f.BoolVarP(&archivedFlag, "archived", "", false, "include the archived books when listing books")
+
+	deprecation.Command(cmd, `"dnote view"`, "1.0.0")
 
 	return cmd
 }
 
-// NewRun returns a new run function for ls
-func NewRun(ctx context.DnoteCtx, nameOnly bool) infra.RunEFunc {
+// NewRun returns a new run function for ls. The notes in a book are listed in the given
+// sort, or in the sort set for the book if it is empty. The archived books are listed
+// only if archived is true.
+func NewRun(ctx context.DnoteCtx, nameOnly bool, sort string, archived bool) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			if err := printBooks(ctx, nameOnly); err != nil {
+			if err := printBooks(ctx, nameOnly, archived); err != nil {
 				return errors.Wrap(err, "viewing books")
 			}
 
 			return nil
 		}
 
-		bookName := args[0]
-		if err := printNotes(ctx, bookName); err != nil {
+		bookName, err := database.ResolveBookLabel(ctx.DB, args[0], ctx.CaseSensitiveBooks)
+		if err != nil {
+			return errors.Wrap(err, "resolving the book")
+		}
+
+		if err := printNotes(ctx, bookName, sort); err != nil {
 			return errors.Wrapf(err, "viewing book '%s'", bookName)
 		}
 
@@ -88,14 +120,11 @@ func NewRun(ctx context.DnoteCtx, nameOnly bool) infra.RunEFunc {
 
 // bookInfo is an information about the book to be printed on screen
 type bookInfo struct {
-	BookLabel string
-	NoteCount int
-}
-
-// noteInfo is an information about the note to be printed on screen
-type noteInfo struct {
-	RowID int
-	Body  string
+	BookLabel string `json:"label"`
+	NoteCount int    `json:"note_count"`
+	// Owner is the email of the owner of a team book owned by another user, or empty
+	Owner    string `json:"owner,omitempty"`
+	Archived bool   `json:"archived,omitempty"`
 }
 
 // getNewlineIdx returns the index of newline character in a string
@@ -130,35 +159,75 @@ func printBookLine(info bookInfo, nameOnly bool) {
 	if nameOnly {
 		fmt.Println(info.BookLabel)
 	} else {
-		log.Printf("%s %s\n", info.BookLabel, log.ColorYellow.Sprintf("(%d)", info.NoteCount))
+		line := fmt.Sprintf("%s %s", info.BookLabel, log.ColorYellow.Sprintf("(%d)", info.NoteCount))
+		if info.Owner != "" {
+			line = fmt.Sprintf("%s %s", line, log.ColorGray.Sprintf("[owned by %s]", info.Owner))
+		}
+		if info.Archived {
+			line = fmt.Sprintf("%s %s", line, log.ColorGray.Sprint("[archived]"))
+		}
+
+		log.Printf("%s\n", line)
 	}
 }
 
-func printBooks(ctx context.DnoteCtx, nameOnly bool) error {
-	db := ctx.DB
+// printBookNames prints the book labels from the completion cache, which is faster
+// than querying the database for the shell completions
+func printBookNames(ctx context.DnoteCtx) error {
+	d, err := completion.Load(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading the completion data")
+	}
+
+	for _, label := range d.Books {
+		fmt.Println(label)
+	}
+
+	return nil
+}
 
-	rows, err := db.Query(`SELECT books.label, count(notes.uuid) note_count
+// getBooks returns the books along with their note counts. The archived books are
+// included only if archived is true.
+func getBooks(db *database.DB, archived bool) ([]bookInfo, error) {
+	rows, err := db.Query(`SELECT books.label, count(notes.uuid) note_count, books.owner, books.archived
 	FROM books
 	LEFT JOIN notes ON notes.book_uuid = books.uuid AND notes.deleted = false
-	WHERE books.deleted = false
+	WHERE books.deleted = false AND (books.archived = false OR ?)
 	GROUP BY books.uuid
-	ORDER BY books.label ASC;`)
+	ORDER BY books.label ASC;`, archived)
 	if err != nil {
-		return errors.Wrap(err, "querying books")
+		return nil, errors.Wrap(err, "querying books")
 	}
 	defer rows.Close()
 
 	infos := []bookInfo{}
 	for rows.Next() {
 		var info bookInfo
-		err = rows.Scan(&info.BookLabel, &info.NoteCount)
+		err = rows.Scan(&info.BookLabel, &info.NoteCount, &info.Owner, &info.Archived)
 		if err != nil {
-			return errors.Wrap(err, "scanning a row")
+			return nil, errors.Wrap(err, "scanning a row")
 		}
 
 		infos = append(infos, info)
 	}
 
+	return infos, nil
+}
+
+func printBooks(ctx context.DnoteCtx, nameOnly, archived bool) error {
+	if nameOnly && !output.IsJSON() {
+		return printBookNames(ctx)
+	}
+
+	infos, err := getBooks(ctx.DB, archived)
+	if err != nil {
+		return err
+	}
+
+	if output.IsJSON() {
+		return output.JSON(infos)
+	}
+
 	for _, info := range infos {
 		printBookLine(info, nameOnly)
 	}
@@ -166,44 +235,107 @@ func printBooks(ctx context.DnoteCtx, nameOnly bool) error {
 	return nil
 }
 
-func printNotes(ctx context.DnoteCtx, bookName string) error {
+// noteSortClauses are the ORDER BY clauses for the sorts of the notes. The notes without
+// a title are sorted alphabetically by their contents, from which the titles would be inferred.
+var noteSortClauses = map[string]string{
+	// notes reordered by `dnote books reorder` come first, and the rest follow in the order they were added
+	database.NoteSortManual:       "position = 0 ASC, position ASC, added_on ASC",
+	database.NoteSortAdded:        "added_on ASC",
+	database.NoteSortEdited:       "max(added_on, edited_on) DESC",
+	database.NoteSortAlphabetical: "(CASE WHEN title = '' THEN body ELSE title END) COLLATE NOCASE ASC, added_on ASC",
+	database.NoteSortLastViewed:   "coalesce(last_viewed_on, 0) DESC, added_on ASC",
+}
+
+// getNotes returns the notes in the book in the given sort, along with their headings. The
+// pinned notes come first.
+func getNotes(db *database.DB, bookName, bookUUID, sort string) ([]database.NoteInfo, []string, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT rowid, uuid, title, body, added_on, edited_on, language, content_type, heading, author, pinned_on > 0 FROM notes
+	WHERE book_uuid = ? AND deleted = ?
+	ORDER BY pinned_on = 0 ASC, %s;`, noteSortClauses[sort]), bookUUID, false)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	infos := []database.NoteInfo{}
+	headings := []string{}
+	for rows.Next() {
+		info := database.NoteInfo{BookLabel: bookName}
+		var heading string
+		err = rows.Scan(&info.RowID, &info.UUID, &info.Title, &info.Content, &info.AddedOn, &info.EditedOn, &info.Language, &info.ContentType, &heading, &info.Author, &info.Pinned)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "scanning a row")
+		}
+
+		infos = append(infos, info)
+		headings = append(headings, heading)
+	}
+
+	return infos, headings, nil
+}
+
+func printNotes(ctx context.DnoteCtx, bookName, sort string) error {
 	db := ctx.DB
 
-	var bookUUID string
-	err := db.QueryRow("SELECT uuid FROM books WHERE label = ?", bookName).Scan(&bookUUID)
+	var bookUUID, bookSort string
+	err := db.QueryRow("SELECT uuid, note_sort FROM books WHERE label = ?", bookName).Scan(&bookUUID, &bookSort)
 	if err == sql.ErrNoRows {
 		return errors.New("book not found")
 	} else if err != nil {
 		return errors.Wrap(err, "querying the book")
 	}
 
-	rows, err := db.Query(`SELECT rowid, body FROM notes WHERE book_uuid = ? AND deleted = ? ORDER BY added_on ASC;`, bookUUID, false)
+	if sort == "" {
+		sort = bookSort
+	}
+	if sort == "" {
+		sort = database.NoteSortManual
+	}
+	if err := validate.NoteSort(sort); err != nil {
+		return err
+	}
+
+	infos, headings, err := getNotes(db, bookName, bookUUID, sort)
 	if err != nil {
-		return errors.Wrap(err, "querying notes")
+		return err
 	}
-	defer rows.Close()
 
-	infos := []noteInfo{}
-	for rows.Next() {
-		var info noteInfo
-		err = rows.Scan(&info.RowID, &info.Body)
-		if err != nil {
-			return errors.Wrap(err, "scanning a row")
+	if output.IsJSON() {
+		notes := []output.Note{}
+		for _, info := range infos {
+			notes = append(notes, output.NewNote(info))
 		}
 
-		infos = append(infos, info)
+		return output.JSON(notes)
 	}
 
 	log.Infof("on book %s\n", bookName)
 
-	for _, info := range infos {
-		body, isExcerpt := formatBody(info.Body)
+	for idx, info := range infos {
+		// the headings group the notes only in the order they were arranged in, below the pinned notes
+		if sort == database.NoteSortManual && !info.Pinned && headings[idx] != "" && (idx == 0 || infos[idx-1].Pinned || headings[idx] != headings[idx-1]) {
+			log.Plainf("\n%s\n", log.ColorBlue.Sprint(headings[idx]))
+		}
+
+		body, isExcerpt := formatBody(info.Content)
+		// a title that is not the first line of the content is shown in place of it
+		if title := database.NoteTitle(info.Title, info.Content); title != database.InferTitle(info.Content) {
+			body = title
+			isExcerpt = true
+		}
 
 		rowid := log.ColorYellow.Sprintf("(%d)", info.RowID)
 		if isExcerpt {
 			body = fmt.Sprintf("%s %s", body, log.ColorYellow.Sprintf("[---More---]"))
 		}
 
+		if info.Author != "" {
+			body = fmt.Sprintf("%s %s", body, log.ColorGray.Sprintf("by %s", info.Author))
+		}
+		if info.Pinned {
+			body = fmt.Sprintf("%s %s", body, log.ColorBlue.Sprint("[pinned]"))
+		}
+
 		log.Plainf("%s %s\n", rowid, body)
 	}
 
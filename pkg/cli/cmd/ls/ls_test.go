@@ -0,0 +1,148 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ls
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestGetNotes(t *testing.T) {
+	testCases := []struct {
+		sort     string
+		expected []string
+	}{
+		{
+			sort:     database.NoteSortManual,
+			expected: []string{"n3-uuid", "n1-uuid", "n2-uuid"},
+		},
+		{
+			sort:     database.NoteSortAdded,
+			expected: []string{"n1-uuid", "n2-uuid", "n3-uuid"},
+		},
+		{
+			sort:     database.NoteSortEdited,
+			expected: []string{"n1-uuid", "n3-uuid", "n2-uuid"},
+		},
+		{
+			sort:     database.NoteSortAlphabetical,
+			expected: []string{"n2-uuid", "n1-uuid", "n3-uuid"},
+		},
+		{
+			sort:     database.NoteSortLastViewed,
+			expected: []string{"n2-uuid", "n1-uuid", "n3-uuid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.sort, func(t *testing.T) {
+			// set up
+			db := database.InitTestDB(t, "../../tmp/dnote-test.db", nil)
+			defer database.TeardownTestDB(t, db)
+
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, title, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "Avocado", "zebra", 1, 10)
+			database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "apple", 2, 0)
+			database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, position) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "Mango", 3, 0, 1)
+			database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "", 4, true)
+			database.MustExec(t, "viewing n1", db, "UPDATE notes SET view_count = ?, last_viewed_on = ? WHERE uuid = ?", 3, 20, "n1-uuid")
+			database.MustExec(t, "viewing n2", db, "UPDATE notes SET view_count = ?, last_viewed_on = ? WHERE uuid = ?", 1, 30, "n2-uuid")
+
+			// execute
+			infos, headings, err := getNotes(db, "b1", "b1-uuid", tc.sort)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			got := []string{}
+			for _, info := range infos {
+				got = append(got, info.UUID)
+			}
+
+			assert.DeepEqual(t, got, tc.expected, "order mismatch")
+			assert.Equal(t, len(headings), len(infos), "heading count mismatch")
+		})
+	}
+}
+
+func TestGetNotes_pinned(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, pinned_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 10)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 body", 3)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, pinned_on) VALUES (?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4 body", 4, 5)
+
+	// execute
+	infos, _, err := getNotes(db, "b1", "b1-uuid", database.NoteSortAdded)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	got := []string{}
+	pinned := []bool{}
+	for _, info := range infos {
+		got = append(got, info.UUID)
+		pinned = append(pinned, info.Pinned)
+	}
+
+	assert.DeepEqual(t, got, []string{"n2-uuid", "n4-uuid", "n1-uuid", "n3-uuid"}, "order mismatch")
+	assert.DeepEqual(t, pinned, []bool{true, true, false, false}, "pinned mismatch")
+}
+
+func TestGetBooks(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, archived) VALUES (?, ?, ?)", "b2-uuid", "css", true)
+	database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b3-uuid", "go", true)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b2-uuid", "n1", 1)
+
+	t.Run("without archived", func(t *testing.T) {
+		// execute
+		infos, err := getBooks(db, false)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		assert.DeepEqual(t, infos, []bookInfo{{BookLabel: "js"}}, "books mismatch")
+	})
+
+	t.Run("with archived", func(t *testing.T) {
+		// execute
+		infos, err := getBooks(db, true)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		assert.DeepEqual(t, infos, []bookInfo{{BookLabel: "css", NoteCount: 1, Archived: true}, {BookLabel: "js"}}, "books mismatch")
+	})
+}
@@ -0,0 +1,224 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * List the metadata of a note
+ dnote meta 12
+
+ * Set the metadata of a note
+ dnote meta 12 --set project=atlas --set status=draft
+
+ * Remove a key from the metadata of a note
+ dnote meta 12 --unset status
+
+ * Find the notes by their metadata
+ dnote find "meta:project=atlas"`
+
+var setFlag []string
+var unsetFlag []string
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new meta command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "meta <note id>",
+		Short:             "List or change the key-value metadata of a note",
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.NoteArgs(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringArrayVarP(&setFlag, "set", "", []string{}, "set a key to a value, written as key=value. Can be given multiple times")
+	f.StringArrayVarP(&unsetFlag, "unset", "", []string{}, "remove a key. Can be given multiple times")
+
+	return cmd
+}
+
+// change is a change to the metadata of a note. Unset removes the key.
+type change struct {
+	Key   string
+	Value string
+	Unset bool
+}
+
+// parseChanges parses the keys to set and unset
+func parseChanges(sets, unsets []string) ([]change, error) {
+	ret := []change{}
+
+	for _, s := range sets {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid metadata '%s'. Write it as key=value", s)
+		}
+		if err := validate.MetadataKey(parts[0]); err != nil {
+			return nil, errors.Wrapf(err, "invalid key '%s'", parts[0])
+		}
+
+		ret = append(ret, change{Key: parts[0], Value: parts[1]})
+	}
+	for _, key := range unsets {
+		if err := validate.MetadataKey(key); err != nil {
+			return nil, errors.Wrapf(err, "invalid key '%s'", key)
+		}
+
+		ret = append(ret, change{Key: key, Unset: true})
+	}
+
+	return ret, nil
+}
+
+// apply makes the changes to the metadata of the note. It returns the number of the
+// changes that took effect. If sync is true, the note is marked dirty so that the
+// metadata is synced.
+func apply(db *database.DB, noteUUID string, changes []change, sync bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning a transaction")
+	}
+
+	var count int
+	for _, c := range changes {
+		if c.Unset {
+			ok, err := database.UnsetNoteMetadata(tx, noteUUID, c.Key)
+			if err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+			if ok {
+				count++
+			}
+
+			continue
+		}
+
+		if err := database.SetNoteMetadata(tx, noteUUID, c.Key, c.Value); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		count++
+	}
+
+	if count > 0 && sync {
+		if _, err := tx.Exec("UPDATE notes SET dirty = ? WHERE uuid = ?", true, noteUUID); err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "marking the note dirty")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "committing a transaction")
+	}
+
+	return count, nil
+}
+
+// printMetadata prints the metadata sorted by the keys
+func printMetadata(metadata map[string]string) {
+	if len(metadata) == 0 {
+		log.Infof("no metadata\n")
+		return
+	}
+
+	keys := []string{}
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		log.Plainf("%s=%s\n", log.ColorYellow.Sprintf("%s", key), metadata[key])
+	}
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		rowID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "invalid rowid '%s'", args[0])
+		}
+
+		info, err := database.GetNoteInfo(ctx.DB, rowID)
+		if err != nil {
+			return err
+		}
+
+		changes, err := parseChanges(setFlag, unsetFlag)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) > 0 {
+			// the metadata is synced only if it can be encrypted
+			count, err := apply(ctx.DB, info.UUID, changes, ctx.Metadata.Encryption != "")
+			if err != nil {
+				return err
+			}
+
+			if !output.IsJSON() {
+				if count == 0 {
+					log.Infof("the metadata is already up to date\n")
+				} else {
+					log.Successf("updated the metadata of note %d\n", rowID)
+				}
+
+				return nil
+			}
+		}
+
+		metadata, err := database.GetNoteMetadata(ctx.DB, info.UUID)
+		if err != nil {
+			return err
+		}
+
+		if output.IsJSON() {
+			return output.JSON(metadata)
+		}
+
+		printMetadata(metadata)
+
+		return nil
+	}
+}
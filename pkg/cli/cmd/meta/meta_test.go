@@ -0,0 +1,120 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package meta
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestParseChanges(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		got, err := parseChanges([]string{"project=atlas", "query=a=b", "empty="}, []string{"status"})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		expected := []change{
+			{Key: "project", Value: "atlas"},
+			{Key: "query", Value: "a=b"},
+			{Key: "empty", Value: ""},
+			{Key: "status", Unset: true},
+		}
+		assert.DeepEqual(t, got, expected, "changes mismatch")
+	})
+
+	t.Run("missing value", func(t *testing.T) {
+		_, err := parseChanges([]string{"project"}, nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := parseChanges(nil, []string{"due date"})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 3, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 4, false)
+
+	t.Run("local", func(t *testing.T) {
+		count, err := apply(db, "n1-uuid", []change{{Key: "project", Value: "atlas"}, {Key: "status", Unset: true}}, false)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+		assert.Equal(t, count, 1, "count mismatch")
+
+		metadata, err := database.GetNoteMetadata(db, "n1-uuid")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the metadata"))
+		}
+		assert.DeepEqual(t, metadata, map[string]string{"project": "atlas"}, "metadata mismatch")
+
+		var dirty bool
+		database.MustScan(t, "getting n1", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n1-uuid"), &dirty)
+		assert.Equal(t, dirty, false, "dirty mismatch")
+	})
+
+	t.Run("synced", func(t *testing.T) {
+		count, err := apply(db, "n2-uuid", []change{{Key: "project", Value: "zephyr"}}, true)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+		assert.Equal(t, count, 1, "count mismatch")
+
+		var dirty bool
+		database.MustScan(t, "getting n2", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n2-uuid"), &dirty)
+		assert.Equal(t, dirty, true, "dirty mismatch")
+	})
+
+	t.Run("no change", func(t *testing.T) {
+		database.MustExec(t, "resetting n2", db, "UPDATE notes SET dirty = ? WHERE uuid = ?", false, "n2-uuid")
+
+		count, err := apply(db, "n2-uuid", []change{{Key: "missing", Unset: true}}, true)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+		assert.Equal(t, count, 0, "count mismatch")
+
+		var dirty bool
+		database.MustScan(t, "getting n2", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n2-uuid"), &dirty)
+		assert.Equal(t, dirty, false, "dirty mismatch")
+	})
+}
@@ -0,0 +1,94 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/backup"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/migrate"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var yesFlag bool
+
+func downPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newDownCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "down <schema version>",
+		Short:   "Reverse the local migrations until the database is at the given schema version",
+		PreRunE: downPreRun,
+		RunE:    newDownRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&yesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+func newDownRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		target, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Errorf("invalid schema version '%s'", args[0])
+		}
+
+		if !yesFlag {
+			question := fmt.Sprintf("reverse the migrations until the schema version is %d? The data in the dropped tables will be lost", target)
+			ok, err := ui.Confirm(question, false)
+			if err != nil {
+				return errors.Wrap(err, "getting confirmation")
+			}
+			if !ok {
+				log.Warnf("aborted by user\n")
+				return nil
+			}
+		}
+
+		name, err := backup.Auto(ctx, backup.ReasonMigration)
+		if err != nil {
+			return errors.Wrap(err, "backing up the database")
+		}
+
+		if err := migrate.Down(ctx, migrate.LocalSequence, migrate.LocalMode, target); err != nil {
+			return errors.Wrap(err, "reversing the migrations")
+		}
+
+		log.Successf("the database is at the schema version %d\n", target)
+		if name != "" {
+			log.Infof("the database before the change is backed up as %s\n", name)
+		}
+
+		return nil
+	}
+}
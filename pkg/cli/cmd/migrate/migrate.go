@@ -0,0 +1,175 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migrate
+
+import (
+	"github.com/dnote/dnote/pkg/cli/backup"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/migrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var dryRunFlag bool
+var forceFlag bool
+
+var example = `
+ * Run the pending migrations
+ dnote migrate
+
+ * Run the pending migrations against a copy of the database, without changing it
+ dnote migrate --dry-run
+
+ * See which migrations have run
+ dnote migrate status
+
+ * Reverse the migrations until the schema version is 31
+ dnote migrate down 31
+
+ * Use a database migrated by a newer version of dnote
+ dnote migrate --force`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new migrate command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "migrate",
+		Short:   "Run, inspect and reverse the migrations of the database",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&dryRunFlag, "dry-run", "", false, "Run the pending migrations against a temporary copy of the database and report the result")
+	f.BoolVarP(&forceFlag, "force", "", false, "Set the schema version of a database migrated by a newer version of dnote to the latest one this version supports")
+
+	cmd.AddCommand(newStatusCmd(ctx))
+	cmd.AddCommand(newDownCmd(ctx))
+
+	return cmd
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if forceFlag {
+			return force(ctx)
+		}
+		if dryRunFlag {
+			return dryRun(ctx)
+		}
+
+		if err := migrate.CheckSchema(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+			return err
+		}
+
+		statuses, err := migrate.GetStatus(ctx, migrate.LocalSequence, migrate.LocalMode)
+		if err != nil {
+			return errors.Wrap(err, "getting the status of the migrations")
+		}
+		pending := countPending(statuses)
+		if pending == 0 {
+			log.Infof("the database is up to date\n")
+			return nil
+		}
+
+		if err := infra.BackupBeforeMigration(ctx); err != nil {
+			return errors.Wrap(err, "backing up the database before the migration")
+		}
+		if err := migrate.Run(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+			return errors.Wrap(err, "running migration")
+		}
+
+		log.Successf("ran %d migrations\n", pending)
+
+		return nil
+	}
+}
+
+func dryRun(ctx context.DnoteCtx) error {
+	if err := migrate.CheckSchema(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+		return err
+	}
+
+	ran, err := migrate.DryRun(ctx, migrate.LocalSequence, migrate.LocalMode)
+	for _, name := range ran {
+		log.Printf("ran %s\n", name)
+	}
+	if err != nil {
+		return errors.Wrap(err, "the dry run failed. The database was not changed")
+	}
+
+	if len(ran) == 0 {
+		log.Infof("the database is up to date\n")
+		return nil
+	}
+
+	log.Successf("%d migrations would run. The database was not changed\n", len(ran))
+
+	return nil
+}
+
+func force(ctx context.DnoteCtx) error {
+	local := migrate.CheckSchema(ctx, migrate.LocalSequence, migrate.LocalMode)
+	remote := migrate.CheckSchema(ctx, migrate.RemoteSequence, migrate.RemoteMode)
+	if local == nil && remote == nil {
+		log.Infof("the database is not from a newer version of dnote. Nothing to force\n")
+		return nil
+	}
+
+	name, err := backup.Auto(ctx, backup.ReasonMigration)
+	if err != nil {
+		return errors.Wrap(err, "backing up the database")
+	}
+
+	if _, err := migrate.Force(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+		return errors.Wrap(err, "forcing the local schema")
+	}
+	if _, err := migrate.Force(ctx, migrate.RemoteSequence, migrate.RemoteMode); err != nil {
+		return errors.Wrap(err, "forcing the remote schema")
+	}
+
+	log.Successf("the database can be used with this version of dnote\n")
+	log.Warnf("the tables and columns added by the newer version are left as they are. The newer version runs its migrations again, and may fail to, when it opens the database\n")
+	if name != "" {
+		log.Infof("the database before the change is backed up as %s. Restore it before going back to the newer version\n", name)
+	}
+
+	return nil
+}
+
+func countPending(statuses []migrate.Status) int {
+	var ret int
+	for _, s := range statuses {
+		if !s.Applied {
+			ret++
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,94 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migrate
+
+import (
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/migrate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func statusPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newStatusCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status",
+		Short:   "List the migrations and whether they have run",
+		PreRunE: statusPreRun,
+		RunE:    newStatusRun(ctx),
+	}
+
+	return cmd
+}
+
+func printStatus(label string, statuses []migrate.Status) {
+	log.Plainf("%s schema: %d of %d\n", label, len(statuses)-countPending(statuses), len(statuses))
+
+	for _, s := range statuses {
+		state := log.ColorGreen.Sprint("applied")
+		if !s.Applied {
+			state = log.ColorYellow.Sprint("pending")
+		}
+
+		var reversible string
+		if s.Reversible {
+			reversible = log.ColorGray.Sprint(" (reversible)")
+		}
+
+		log.Plainf("%4d %s %s%s\n", s.Version, s.Name, state, reversible)
+	}
+}
+
+func newStatusRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		local, err := migrate.GetStatus(ctx, migrate.LocalSequence, migrate.LocalMode)
+		if err != nil {
+			return errors.Wrap(err, "getting the status of the local migrations")
+		}
+		remote, err := migrate.GetStatus(ctx, migrate.RemoteSequence, migrate.RemoteMode)
+		if err != nil {
+			return errors.Wrap(err, "getting the status of the remote migrations")
+		}
+
+		printStatus("local", local)
+		log.Plain("\n")
+		printStatus("remote", remote)
+
+		if err := migrate.CheckSchema(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+			log.Plain("\n")
+			log.Warnf("%s\n", err.Error())
+		}
+
+		if countPending(remote) > 0 {
+			log.Plain("\n")
+			log.Infof("the remote migrations run on the next dnote sync\n")
+		}
+
+		return nil
+	}
+}
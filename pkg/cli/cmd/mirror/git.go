@@ -0,0 +1,240 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mirror
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/cmd/export"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// gitCommand is the git client that commits the mirror
+var gitCommand = "git"
+
+var messageFlag string
+
+var gitExample = `
+ * Mirror the notes into a git repository, which is created if it does not exist
+ dnote mirror git ~/notes-mirror
+
+ * Mirror the notes with a commit message
+ dnote mirror git ~/notes-mirror -m "before the cleanup"
+
+ * Mirror the notes after each sync
+ dnote config set sync.gitMirror ~/notes-mirror`
+
+func gitPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func newGitCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "git <repo path>",
+		Short:   "Export the notes as Markdown into a git repository and commit them",
+		Example: gitExample,
+		PreRunE: gitPreRun,
+		RunE:    newGitRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&messageFlag, "message", "m", "", "The commit message. Defaults to one with the current time")
+
+	return cmd
+}
+
+func newGitRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+
+		committed, err := Git(ctx, dir, messageFlag)
+		if err != nil {
+			return errors.Wrapf(err, "mirroring to %s", dir)
+		}
+
+		if committed {
+			log.Successf("mirrored the notes to %s\n", dir)
+		} else {
+			log.Infof("the mirror at %s is up to date\n", dir)
+		}
+
+		return nil
+	}
+}
+
+// runGit runs git in the given directory and returns its output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command(gitCommand, append([]string{"-C", dir}, args...)...)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "running git %s: %s", args[0], strings.TrimSpace(out.String()))
+	}
+
+	return out.String(), nil
+}
+
+// ensureRepo creates a git repository in the directory if it does not exist or is empty.
+// A directory with other files must already be a git repository, so that the files of
+// the user are never committed by mistake.
+func ensureRepo(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "checking the git repository")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "creating the directory")
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "reading the directory")
+	}
+	if len(entries) > 0 {
+		return errors.Errorf("%s is not a git repository. Give a git repository, or an empty or a new directory", dir)
+	}
+
+	if _, err := runGit(dir, "init", "-q"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// isNoteFile tells if the path relative to the mirror is a note written by the mirror,
+// which is a Markdown file in the directory of a book
+func isNoteFile(rel string) bool {
+	return filepath.Ext(rel) == ".md" && filepath.Dir(rel) != "." && filepath.Dir(filepath.Dir(rel)) == "."
+}
+
+// writeFiles makes the note files in the directory the same as the given files. The
+// files of the removed notes, and the directories of the books left empty, are removed.
+// Other files, such as a README, are left as they are.
+func writeFiles(dir string, files map[string][]byte) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "reading the directory")
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		bookDir := filepath.Join(dir, e.Name())
+		noteEntries, err := ioutil.ReadDir(bookDir)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", e.Name())
+		}
+
+		var kept int
+		for _, ne := range noteEntries {
+			rel := filepath.Join(e.Name(), ne.Name())
+			if _, ok := files[rel]; ok || ne.IsDir() || !isNoteFile(rel) {
+				kept++
+				continue
+			}
+
+			if err := os.Remove(filepath.Join(dir, rel)); err != nil {
+				return errors.Wrapf(err, "removing %s", rel)
+			}
+		}
+		if kept == 0 {
+			if err := os.Remove(bookDir); err != nil {
+				return errors.Wrapf(err, "removing %s", e.Name())
+			}
+		}
+	}
+
+	for rel, content := range files {
+		// the note files must stay out of the hidden directories, such as the one of the repository
+		if !isNoteFile(rel) || strings.HasPrefix(rel, ".") {
+			return errors.Errorf("invalid path of a note file %s", rel)
+		}
+
+		p := filepath.Join(dir, rel)
+
+		if old, err := ioutil.ReadFile(p); err == nil && bytes.Equal(old, content) {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return errors.Wrapf(err, "creating the directory for %s", rel)
+		}
+		if err := ioutil.WriteFile(p, content, 0644); err != nil {
+			return errors.Wrapf(err, "writing %s", rel)
+		}
+	}
+
+	return nil
+}
+
+// Git exports the notes as Markdown into the git repository in the directory and commits
+// the changes with the message, or with one with the current time if it is empty. It
+// returns false if there was nothing to commit.
+func Git(ctx context.DnoteCtx, dir, message string) (bool, error) {
+	if err := ensureRepo(dir); err != nil {
+		return false, err
+	}
+
+	files, err := export.MarkdownFiles(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "exporting the notes")
+	}
+	if err := writeFiles(dir, files); err != nil {
+		return false, errors.Wrap(err, "writing the notes")
+	}
+
+	if _, err := runGit(dir, "add", "-A", "."); err != nil {
+		return false, err
+	}
+	status, err := runGit(dir, "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(status) == "" {
+		return false, nil
+	}
+
+	if message == "" {
+		message = "Mirror the notes at " + ctx.Clock.Now().Format(time.RFC3339)
+	}
+	if _, err := runGit(dir, "commit", "-q", "-m", message); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
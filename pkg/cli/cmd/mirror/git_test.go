@@ -0,0 +1,253 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mirror
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+// setGitIdentity sets the author of the commits made by the tests
+func setGitIdentity(t *testing.T) {
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		os.Setenv(key, "dnote")
+	}
+	for _, key := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		os.Setenv(key, "dnote@example.com")
+	}
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	out, err := runGit(dir, args...)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "running git").Error())
+	}
+
+	return out
+}
+
+func TestIsNoteFile(t *testing.T) {
+	testCases := []struct {
+		rel      string
+		expected bool
+	}{
+		{rel: "js/n1-uuid.md", expected: true},
+		{rel: "README.md", expected: false},
+		{rel: "js/notes.txt", expected: false},
+		{rel: "js/drafts/n1-uuid.md", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.rel, func(t *testing.T) {
+			assert.Equal(t, isNoteFile(tc.rel), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestGit(t *testing.T) {
+	// set up
+	setGitIdentity(t)
+
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	c := clock.NewMock()
+	c.SetNow(time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC))
+	ctx.Clock = c
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1542058875)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b2-uuid", "n2 body", 1542058876)
+
+	dir := "../../tmp/mirror"
+
+	// execute
+	committed, err := Git(ctx, dir, "")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "mirroring").Error())
+	}
+
+	// test
+	assert.Equal(t, committed, true, "committed mismatch")
+	assert.Equal(t, strings.TrimSpace(mustGit(t, dir, "log", "--format=%s")), "Mirror the notes at 2020-03-14T21:15:00Z", "log mismatch")
+	assert.Equal(t, strings.TrimSpace(mustGit(t, dir, "ls-files")), "css/n2-uuid.md\njs/n1-uuid.md", "files mismatch")
+
+	t.Run("no changes", func(t *testing.T) {
+		committed, err := Git(ctx, dir, "")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "mirroring").Error())
+		}
+
+		assert.Equal(t, committed, false, "committed mismatch")
+		assert.Equal(t, strings.Count(mustGit(t, dir, "log", "--format=%s"), "\n"), 1, "commit count mismatch")
+	})
+
+	t.Run("removed note", func(t *testing.T) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("my notes\n"), 0644); err != nil {
+			t.Fatal(errors.Wrap(err, "writing the readme").Error())
+		}
+		database.MustExec(t, "deleting n2", db, "UPDATE notes SET deleted = ?, body = ? WHERE uuid = ?", true, "", "n2-uuid")
+		database.MustExec(t, "updating n1", db, "UPDATE notes SET body = ?, edited_on = ? WHERE uuid = ?", "n1 body edited", 1542058877, "n1-uuid")
+
+		committed, err := Git(ctx, dir, "after the edit")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "mirroring").Error())
+		}
+
+		assert.Equal(t, committed, true, "committed mismatch")
+		assert.Equal(t, strings.TrimSpace(mustGit(t, dir, "log", "-1", "--format=%s")), "after the edit", "message mismatch")
+		assert.Equal(t, strings.TrimSpace(mustGit(t, dir, "ls-files")), "README.md\njs/n1-uuid.md", "files mismatch")
+
+		ok, err := utils.FileExists(filepath.Join(dir, "css"))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "checking the book directory").Error())
+		}
+		assert.Equal(t, ok, false, "the empty book directory should be removed")
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "js", "n1-uuid.md"))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the note").Error())
+		}
+		assert.Equal(t, strings.HasSuffix(string(b), "n1 body edited\n"), true, "content mismatch")
+	})
+}
+
+func TestGit_reservedLabels(t *testing.T) {
+	// set up
+	setGitIdentity(t)
+
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "..")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", ".git")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1542058875)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b2-uuid", "n2 body", 1542058876)
+
+	dir := "../../tmp/mirror"
+
+	// execute
+	if _, err := Git(ctx, dir, ""); err != nil {
+		t.Fatal(errors.Wrap(err, "mirroring").Error())
+	}
+
+	// test
+	assert.Equal(t, strings.TrimSpace(mustGit(t, dir, "ls-files")), "%2E./n1-uuid.md\n%2Egit/n2-uuid.md", "files mismatch")
+
+	for _, p := range []string{"../../tmp/n1-uuid.md", filepath.Join(dir, ".git", "n2-uuid.md")} {
+		ok, err := utils.FileExists(p)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "checking the file").Error())
+		}
+		assert.Equal(t, ok, false, fmt.Sprintf("%s should not be written", p))
+	}
+
+	t.Run("removed books", func(t *testing.T) {
+		database.MustExec(t, "deleting n1", db, "UPDATE notes SET deleted = ?, body = ? WHERE uuid = ?", true, "", "n1-uuid")
+		database.MustExec(t, "deleting n2", db, "UPDATE notes SET deleted = ?, body = ? WHERE uuid = ?", true, "", "n2-uuid")
+
+		if _, err := Git(ctx, dir, ""); err != nil {
+			t.Fatal(errors.Wrap(err, "mirroring").Error())
+		}
+
+		assert.Equal(t, strings.TrimSpace(mustGit(t, dir, "ls-files")), "", "files mismatch")
+		for _, name := range []string{"%2E.", "%2Egit"} {
+			ok, err := utils.FileExists(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "checking the book directory").Error())
+			}
+			assert.Equal(t, ok, false, fmt.Sprintf("the empty book directory %s should be removed", name))
+		}
+	})
+}
+
+func TestWriteFiles_invalidPath(t *testing.T) {
+	// set up
+	dir := "../../tmp/mirror"
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the directory").Error())
+	}
+	defer func() {
+		if err := os.RemoveAll("../../tmp"); err != nil {
+			t.Fatal(errors.Wrap(err, "cleaning up").Error())
+		}
+	}()
+
+	for _, rel := range []string{".git/n1-uuid.md", "../n1-uuid.md", "n1-uuid.md"} {
+		t.Run(rel, func(t *testing.T) {
+			// execute
+			err := writeFiles(dir, map[string][]byte{rel: []byte("n1 body\n")})
+
+			// test
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestGit_notRepo(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	dir := "../../tmp/notes"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the directory").Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "todo.txt"), []byte("todo\n"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing a file").Error())
+	}
+
+	// execute
+	_, err := Git(ctx, dir, "")
+
+	// test
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	ok, err := utils.FileExists(filepath.Join(dir, ".git"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "checking the repository").Error())
+	}
+	assert.Equal(t, ok, false, "the repository should not be created")
+}
@@ -0,0 +1,279 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package move
+
+import (
+	"github.com/dnote/dnote/pkg/cli/cmd/find"
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Move all notes in a book to another book
+ dnote move js javascript
+
+ * Move the notes matching a search query
+ dnote move js react --query "useEffect"
+
+ * Move the notes with the given ids without confirmation
+ dnote move js react --ids 12,15,21 -y`
+
+var queryFlag string
+var idsFlag []int
+var yesFlag bool
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new move command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "move <book name> <target book name>",
+		Aliases:           []string{"mv"},
+		Short:             "Move notes from a book to another",
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 2),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&queryFlag, "query", "q", "", "move only the notes matching the search query")
+	f.IntSliceVar(&idsFlag, "ids", []int{}, "move only the notes with the given ids, separated by commas")
+	f.BoolVarP(&yesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+func maybeConfirm(message string, defaultValue bool) (bool, error) {
+	if yesFlag {
+		return true, nil
+	}
+
+	return ui.Confirm(message, defaultValue)
+}
+
+// getExcerpt returns the title of the note
+func getExcerpt(n database.Note) string {
+	line := database.NoteTitle(n.Title, n.Body)
+
+	r := []rune(line)
+	if len(r) > 60 {
+		return string(r[:60]) + "..."
+	}
+
+	return line
+}
+
+// getBook returns the label and the uuid of the book with the given name
+func getBook(ctx context.DnoteCtx, name string) (string, string, error) {
+	label, err := database.ResolveBookLabel(ctx.DB, name, ctx.CaseSensitiveBooks)
+	if err != nil {
+		return "", "", errors.Wrap(err, "resolving the book")
+	}
+
+	uuid, err := database.GetBookUUID(ctx.DB, label)
+	if err != nil {
+		return "", "", err
+	}
+
+	return label, uuid, nil
+}
+
+// getTargets returns the notes in the book to be moved. If rowIDs is not nil, only the
+// notes with the given rowids are included.
+func getTargets(db *database.DB, bookUUID string, rowIDs map[int]bool) ([]database.Note, error) {
+	rows, err := db.Query(`SELECT rowid, uuid, title, body
+		FROM notes
+		WHERE book_uuid = ? AND deleted = ?
+		ORDER BY added_on ASC`, bookUUID, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []database.Note{}
+	for rows.Next() {
+		var n database.Note
+		if err := rows.Scan(&n.RowID, &n.UUID, &n.Title, &n.Body); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		if rowIDs != nil && !rowIDs[n.RowID] {
+			continue
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// checkIDs returns an error if any of the given ids is not among the notes
+func checkIDs(notes []database.Note, ids []int) error {
+	found := map[int]bool{}
+	for _, n := range notes {
+		found[n.RowID] = true
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			return errors.Errorf("note %d is not in the book", id)
+		}
+	}
+
+	return nil
+}
+
+// getRowIDs returns the rowids of the notes to be moved, or nil to move all notes in the book
+func getRowIDs(ctx context.DnoteCtx, label string) (map[int]bool, error) {
+	if queryFlag == "" && len(idsFlag) == 0 {
+		return nil, nil
+	}
+
+	var ret map[int]bool
+	if len(idsFlag) > 0 {
+		ret = map[int]bool{}
+		for _, id := range idsFlag {
+			ret[id] = true
+		}
+	}
+
+	if queryFlag != "" {
+		results, err := find.Search(ctx, queryFlag, label)
+		if err != nil {
+			return nil, errors.Wrap(err, "searching notes")
+		}
+
+		matches := map[int]bool{}
+		for _, r := range results {
+			// with both flags, only the given notes matching the query are moved
+			if ret == nil || ret[r.RowID] {
+				matches[r.RowID] = true
+			}
+		}
+
+		ret = matches
+	}
+
+	return ret, nil
+}
+
+// moveNotes moves the notes to the book and marks them dirty, saving their current states as versions
+func moveNotes(ctx context.DnoteCtx, notes []database.Note, bookUUID string) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	for _, n := range notes {
+		if err := database.SaveNoteVersion(tx, ctx.Clock, n.UUID, database.NoteVersionEdit, ctx.HistoryRetention); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "saving a version")
+		}
+		if err := database.UpdateNoteBook(tx, ctx.Clock, n.RowID, bookUUID); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "moving the note %d", n.RowID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		srcLabel, srcUUID, err := getBook(ctx, args[0])
+		if err != nil {
+			return errors.Wrap(err, "finding the book")
+		}
+		dstLabel, dstUUID, err := getBook(ctx, args[1])
+		if err != nil {
+			return errors.Wrap(err, "finding the target book")
+		}
+		if srcUUID == dstUUID {
+			return errors.New("the book and the target book are the same")
+		}
+
+		if queryFlag != "" {
+			// the contents are needed to search the notes
+			if _, err := thin.EnsureBodies(ctx, srcUUID); err != nil {
+				return errors.Wrap(err, "getting the note bodies")
+			}
+		}
+
+		rowIDs, err := getRowIDs(ctx, srcLabel)
+		if err != nil {
+			return err
+		}
+
+		notes, err := getTargets(ctx.DB, srcUUID, rowIDs)
+		if err != nil {
+			return errors.Wrap(err, "getting the notes")
+		}
+		// with a query, the given notes not matching it are skipped rather than rejected
+		if queryFlag == "" {
+			if err := checkIDs(notes, idsFlag); err != nil {
+				return err
+			}
+		}
+		if len(notes) == 0 {
+			log.Infof("no notes to move\n")
+			return nil
+		}
+
+		log.Infof("the following notes will be moved from %s to %s\n", srcLabel, dstLabel)
+		for _, n := range notes {
+			log.Plainf("%s %s\n", log.ColorYellow.Sprintf("(%d)", n.RowID), getExcerpt(n))
+		}
+
+		ok, err := maybeConfirm("proceed?", false)
+		if err != nil {
+			return errors.Wrap(err, "getting confirmation")
+		}
+		if !ok {
+			log.Warnf("aborted by user\n")
+			return nil
+		}
+
+		if err := moveNotes(ctx, notes, dstUUID); err != nil {
+			return errors.Wrap(err, "moving the notes")
+		}
+
+		log.Successf("moved %d notes to %s\n", len(notes), dstLabel)
+
+		return nil
+	}
+}
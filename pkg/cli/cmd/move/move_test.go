@@ -0,0 +1,172 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package move
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func setupNotes(t *testing.T, db *database.DB) {
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "react")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", 1, "n1-uuid", "b1-uuid", "react hooks", 1, 10, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", 2, "n2-uuid", "b1-uuid", "closures", 2, 11, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", 3, "n3-uuid", "b1-uuid", "react context", 3, 12, false)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", 4, "n4-uuid", "b1-uuid", "", 4, true)
+	database.MustExec(t, "inserting n5", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?, ?)", 5, "n5-uuid", "b2-uuid", "react router", 5)
+}
+
+func getUUIDs(notes []database.Note) []string {
+	ret := []string{}
+	for _, n := range notes {
+		ret = append(ret, n.UUID)
+	}
+
+	return ret
+}
+
+func TestGetTargets(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		ids      []int
+		expected []string
+	}{
+		{
+			name:     "all",
+			expected: []string{"n1-uuid", "n2-uuid", "n3-uuid"},
+		},
+		{
+			name:     "query",
+			query:    "react",
+			expected: []string{"n1-uuid", "n3-uuid"},
+		},
+		{
+			name:     "ids",
+			ids:      []int{2, 3},
+			expected: []string{"n2-uuid", "n3-uuid"},
+		},
+		{
+			name:     "query and ids",
+			query:    "react",
+			ids:      []int{2, 3},
+			expected: []string{"n3-uuid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			setupNotes(t, ctx.DB)
+
+			queryFlag = tc.query
+			idsFlag = tc.ids
+			defer func() {
+				queryFlag = ""
+				idsFlag = []int{}
+			}()
+
+			// execute
+			rowIDs, err := getRowIDs(ctx, "js")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting rowids"))
+			}
+			notes, err := getTargets(ctx.DB, "b1-uuid", rowIDs)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting targets"))
+			}
+
+			// test
+			assert.DeepEqual(t, getUUIDs(notes), tc.expected, "targets mismatch")
+		})
+	}
+}
+
+func TestCheckIDs(t *testing.T) {
+	notes := []database.Note{{RowID: 1}, {RowID: 2}}
+
+	assert.Equal(t, checkIDs(notes, []int{1, 2}), nil, "error mismatch for the ids in the book")
+	assert.Equal(t, checkIDs(notes, []int{}), nil, "error mismatch for no ids")
+
+	err := checkIDs(notes, []int{2, 5})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assert.Equal(t, err.Error(), "note 5 is not in the book", "error mismatch")
+}
+
+func TestMoveNotes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	c := clock.NewMock()
+	c.SetNow(time.Unix(0, 1542058875))
+	ctx.Clock = c
+
+	setupNotes(t, ctx.DB)
+
+	notes, err := getTargets(ctx.DB, "b1-uuid", map[int]bool{1: true, 3: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting targets"))
+	}
+
+	// execute
+	if err := moveNotes(ctx, notes, "b2-uuid"); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	for _, uuid := range []string{"n1-uuid", "n3-uuid"} {
+		var bookUUID string
+		var dirty bool
+		var editedOn int64
+		database.MustScan(t, "getting "+uuid, ctx.DB.QueryRow("SELECT book_uuid, dirty, edited_on FROM notes WHERE uuid = ?", uuid), &bookUUID, &dirty, &editedOn)
+		assert.Equal(t, bookUUID, "b2-uuid", uuid+" book_uuid mismatch")
+		assert.Equal(t, dirty, true, uuid+" dirty mismatch")
+		assert.Equal(t, editedOn, int64(1542058875), uuid+" edited_on mismatch")
+	}
+
+	var n2BookUUID string
+	var n2Dirty bool
+	database.MustScan(t, "getting n2", ctx.DB.QueryRow("SELECT book_uuid, dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2BookUUID, &n2Dirty)
+	assert.Equal(t, n2BookUUID, "b1-uuid", "n2 book_uuid mismatch")
+	assert.Equal(t, n2Dirty, false, "n2 dirty mismatch")
+
+	var versionCount int
+	database.MustScan(t, "counting versions", ctx.DB.QueryRow("SELECT count(*) FROM note_versions"), &versionCount)
+	assert.Equal(t, versionCount, 2, "version count mismatch")
+}
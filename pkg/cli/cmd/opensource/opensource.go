@@ -0,0 +1,121 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package opensource
+
+import (
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Open the source of the note 3 at the location it was clipped from
+ dnote open-source 3
+
+ * Print the location without opening it
+ dnote open-source 3 --print`
+
+var printFlag bool
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new open-source command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "open-source <note id>",
+		Short:             "Open the source of a clipped note at its location",
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.NoteArgs(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&printFlag, "print", "p", false, "print the location instead of opening it")
+
+	return cmd
+}
+
+// getLocation returns the location of the source of the note with the given rowid
+func getLocation(db *database.DB, rowID int) (string, error) {
+	info, err := database.GetNoteInfo(db, rowID)
+	if err != nil {
+		return "", err
+	}
+
+	if info.Source.URL == "" {
+		return "", errors.Errorf("note %d has no source. Use `dnote add --source` to clip a note from a source", rowID)
+	}
+
+	return info.Source.Location(), nil
+}
+
+// newOpenCmd returns a command that opens the location in the default application
+// for it, such as the browser or the PDF reader
+func newOpenCmd(location string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", location)
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", location)
+	default:
+		return exec.Command("xdg-open", location)
+	}
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		rowID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid rowid")
+		}
+
+		location, err := getLocation(ctx.DB, rowID)
+		if err != nil {
+			return err
+		}
+
+		if printFlag {
+			log.Plainf("%s\n", location)
+			return nil
+		}
+
+		if err := newOpenCmd(location).Run(); err != nil {
+			return errors.Wrapf(err, "opening %s", location)
+		}
+
+		log.Successf("opened %s\n", location)
+
+		return nil
+	}
+}
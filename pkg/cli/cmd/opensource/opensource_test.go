@@ -0,0 +1,103 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package opensource
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/database"
+)
+
+func TestGetLocation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		source   database.NoteSource
+		expected string
+	}{
+		{
+			name:     "url",
+			source:   database.NoteSource{URL: "https://go.dev/doc/effective_go"},
+			expected: "https://go.dev/doc/effective_go",
+		},
+		{
+			name:     "url with a fragment",
+			source:   database.NoteSource{URL: "https://go.dev/doc/effective_go#names", Fragment: "slices"},
+			expected: "https://go.dev/doc/effective_go#slices",
+		},
+		{
+			name:     "url with a text fragment",
+			source:   database.NoteSource{URL: "https://go.dev/doc/effective_go", Fragment: ":~:text=slices"},
+			expected: "https://go.dev/doc/effective_go#:~:text=slices",
+		},
+		{
+			name:     "pdf url with a page",
+			source:   database.NoteSource{URL: "https://example.com/rust.pdf", Page: 12},
+			expected: "https://example.com/rust.pdf#page=12",
+		},
+		{
+			name:     "local path with a page",
+			source:   database.NoteSource{URL: "/home/alice/books/rust book.pdf", Page: 12},
+			expected: "file:///home/alice/books/rust%20book.pdf#page=12",
+		},
+		{
+			name:     "page and fragment",
+			source:   database.NoteSource{URL: "/home/alice/books/rust.pdf", Page: 12, Fragment: "zoom=200"},
+			expected: "file:///home/alice/books/rust.pdf#page=12&zoom=200",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			db := database.InitTestDB(t, "../../tmp/dnote-test.db", nil)
+			defer database.TeardownTestDB(t, db)
+
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+			if err := database.UpdateNoteSource(db, 1, tc.source); err != nil {
+				t.Fatal(err)
+			}
+
+			// execute
+			got, err := getLocation(db, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// test
+			assert.Equal(t, got, tc.expected, "location mismatch")
+		})
+	}
+}
+
+func TestGetLocation_noSource(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+
+	// execute
+	_, err := getLocation(db, 1)
+
+	// test
+	assert.Equal(t, err.Error(), "note 1 has no source. Use `dnote add --source` to clip a note from a source", "error mismatch")
+}
@@ -0,0 +1,247 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package pin
+
+import (
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var bookFlag string
+
+var pinExample = `
+ * Pin a note
+ dnote pin 3
+
+ * Pin several notes at once
+ dnote pin 3 7 12`
+
+var unpinExample = `
+ * Unpin a note
+ dnote unpin 3`
+
+var pinnedExample = `
+ * List the pinned notes
+ dnote pinned
+
+ * List the pinned notes in a book
+ dnote pinned -b golang`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Missing argument")
+	}
+
+	return nil
+}
+
+func pinnedPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new pin command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "pin <note id...>",
+		Short:             "Pin notes to the top of their books",
+		Example:           pinExample,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx, true),
+		ValidArgsFunction: completion.NoteArgs(ctx),
+	}
+
+	return cmd
+}
+
+// NewUnpinCmd returns a new unpin command
+func NewUnpinCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "unpin <note id...>",
+		Short:             "Unpin notes",
+		Example:           unpinExample,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx, false),
+		ValidArgsFunction: completion.NoteArgs(ctx),
+	}
+
+	return cmd
+}
+
+// NewPinnedCmd returns a new pinned command
+func NewPinnedCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "pinned",
+		Short:   "List the pinned notes",
+		Example: pinnedExample,
+		PreRunE: pinnedPreRun,
+		RunE:    newPinnedRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&bookFlag, "book", "b", "", "only list the pinned notes in the given book")
+
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
+
+	return cmd
+}
+
+// setPinned pins or unpins the notes with the given ids. It returns the number of the
+// notes that were changed.
+func setPinned(ctx context.DnoteCtx, rowIDs []int, pinned bool) (int, error) {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning a transaction")
+	}
+
+	var count int
+	for _, rowID := range rowIDs {
+		info, err := database.GetNoteInfo(tx, rowID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if info.Pinned == pinned {
+			continue
+		}
+
+		if err := database.SetNotePinned(tx, ctx.Clock, rowID, pinned); err != nil {
+			tx.Rollback()
+			return 0, errors.Wrapf(err, "updating the note %d", rowID)
+		}
+
+		count++
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "committing a transaction")
+	}
+
+	return count, nil
+}
+
+func newRun(ctx context.DnoteCtx, pinned bool) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		rowIDs := []int{}
+		for _, arg := range args {
+			rowID, err := strconv.Atoi(arg)
+			if err != nil {
+				return errors.Wrapf(err, "invalid rowid '%s'", arg)
+			}
+
+			rowIDs = append(rowIDs, rowID)
+		}
+
+		count, err := setPinned(ctx, rowIDs, pinned)
+		if err != nil {
+			return err
+		}
+
+		verb := "pinned"
+		if !pinned {
+			verb = "unpinned"
+		}
+
+		if count == 0 {
+			log.Infof("the notes are already %s\n", verb)
+			return nil
+		}
+
+		log.Successf("%s %d notes\n", verb, count)
+
+		return nil
+	}
+}
+
+// getPinnedNotes returns the pinned notes, the most recently pinned first. If bookLabel is
+// not empty, only the notes in the book are returned.
+func getPinnedNotes(db *database.DB, bookLabel string) ([]database.NoteInfo, error) {
+	rows, err := db.Query(`SELECT notes.rowid, books.label, notes.uuid, notes.title, notes.body, notes.added_on, notes.edited_on, notes.language, notes.content_type, notes.author
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.pinned_on > 0 AND notes.deleted = ? AND (? = '' OR books.label = ?)
+		ORDER BY notes.pinned_on DESC`, false, bookLabel, bookLabel)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the pinned notes")
+	}
+	defer rows.Close()
+
+	ret := []database.NoteInfo{}
+	for rows.Next() {
+		info := database.NoteInfo{Pinned: true}
+		if err := rows.Scan(&info.RowID, &info.BookLabel, &info.UUID, &info.Title, &info.Content, &info.AddedOn, &info.EditedOn, &info.Language, &info.ContentType, &info.Author); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, info)
+	}
+
+	return ret, nil
+}
+
+func newPinnedRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		var label string
+		if bookFlag != "" {
+			l, err := database.ResolveBookLabel(ctx.DB, bookFlag, ctx.CaseSensitiveBooks)
+			if err != nil {
+				return errors.Wrap(err, "resolving the book")
+			}
+
+			label = l
+		}
+
+		infos, err := getPinnedNotes(ctx.DB, label)
+		if err != nil {
+			return err
+		}
+
+		if output.IsJSON() {
+			notes := []output.Note{}
+			for _, info := range infos {
+				notes = append(notes, output.NewNote(info))
+			}
+
+			return output.JSON(notes)
+		}
+
+		if len(infos) == 0 {
+			log.Infof("no pinned notes\n")
+			return nil
+		}
+
+		for _, info := range infos {
+			log.Plainf("%s %s %s\n", log.ColorYellow.Sprintf("(%d)", info.RowID), database.NoteTitle(info.Title, info.Content), log.ColorGray.Sprintf("(%s)", info.BookLabel))
+		}
+
+		return nil
+	}
+}
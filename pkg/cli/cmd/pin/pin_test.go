@@ -0,0 +1,132 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package pin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestSetPinned(t *testing.T) {
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	c := clock.NewMock()
+	c.SetNow(time.Unix(0, 1542058875))
+	ctx.Clock = c
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, pinned_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 10)
+
+	t.Run("pin", func(t *testing.T) {
+		count, err := setPinned(ctx, []int{1, 2}, true)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		var n1PinnedOn, n2PinnedOn int64
+		var n1Dirty bool
+		database.MustScan(t, "getting n1", db.QueryRow("SELECT pinned_on, dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1PinnedOn, &n1Dirty)
+		database.MustScan(t, "getting n2", db.QueryRow("SELECT pinned_on FROM notes WHERE uuid = ?", "n2-uuid"), &n2PinnedOn)
+		assert.Equal(t, count, 1, "count mismatch")
+		assert.Equal(t, n1PinnedOn, int64(1542058875), "n1 pinned_on mismatch")
+		assert.Equal(t, n1Dirty, false, "n1 dirty mismatch")
+		assert.Equal(t, n2PinnedOn, int64(10), "already pinned n2 should not be changed")
+	})
+
+	t.Run("unpin", func(t *testing.T) {
+		count, err := setPinned(ctx, []int{2}, false)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		var n2PinnedOn int64
+		database.MustScan(t, "getting n2", db.QueryRow("SELECT pinned_on FROM notes WHERE uuid = ?", "n2-uuid"), &n2PinnedOn)
+		assert.Equal(t, count, 1, "count mismatch")
+		assert.Equal(t, n2PinnedOn, int64(0), "n2 pinned_on mismatch")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := setPinned(ctx, []int{1, 99}, false); err == nil {
+			t.Fatal("error should have been returned")
+		}
+
+		var n1PinnedOn int64
+		database.MustScan(t, "getting n1", db.QueryRow("SELECT pinned_on FROM notes WHERE uuid = ?", "n1-uuid"), &n1PinnedOn)
+		assert.Equal(t, n1PinnedOn, int64(1542058875), "n1 should not be changed")
+	})
+}
+
+func TestGetPinnedNotes(t *testing.T) {
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, pinned_on) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 10)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, pinned_on) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3 body", 3, 20)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, pinned_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "", 4, 30, true)
+
+	testCases := []struct {
+		book     string
+		expected []string
+	}{
+		{
+			book:     "",
+			expected: []string{"n3-uuid", "n1-uuid"},
+		},
+		{
+			book:     "js",
+			expected: []string{"n1-uuid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.book, func(t *testing.T) {
+			infos, err := getPinnedNotes(db, tc.book)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			got := []string{}
+			for _, info := range infos {
+				got = append(got, info.UUID)
+			}
+
+			assert.DeepEqual(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
@@ -0,0 +1,227 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package random
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var countFlag int
+var bookFlag string
+var weightedFlag bool
+
+var example = `
+ * See a random note
+ dnote random
+
+ * See 3 random notes from a book
+ dnote random -n 3 -b golang
+
+ * Prefer the notes that have not been viewed for a long time
+ dnote random -n 3 --weighted`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+	if countFlag <= 0 {
+		return errors.New("--count must be positive")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new random command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "random",
+		Short:   "See random notes to recall them",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.IntVarP(&countFlag, "count", "n", 1, "the number of the notes to see")
+	f.StringVarP(&bookFlag, "book", "b", "", "only pick the notes in the given book")
+	f.BoolVarP(&weightedFlag, "weighted", "w", false, "prefer the notes that have not been viewed for a long time")
+
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
+
+	return cmd
+}
+
+// candidate is a note that can be picked
+type candidate struct {
+	RowID int
+	// SeenOn is the time at which the note was last viewed, or added if it has never
+	// been viewed, in unix nanoseconds
+	SeenOn int64
+}
+
+func getCandidates(db *database.DB, bookLabel string) ([]candidate, error) {
+	query := `SELECT notes.rowid, max(coalesce(notes.last_viewed_on, 0), notes.added_on)
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.deleted = ?`
+	args := []interface{}{false}
+	if bookLabel != "" {
+		query += " AND books.label = ?"
+		args = append(args, bookLabel)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []candidate{}
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.RowID, &c.SeenOn); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, c)
+	}
+
+	return ret, rows.Err()
+}
+
+// getWeight returns the weight of the given candidate in the weighted mode, which grows
+// with the number of days since the note was last seen
+func getWeight(c candidate, now time.Time) float64 {
+	days := float64(now.UnixNano()-c.SeenOn) / float64(24*time.Hour)
+	if days < 0 {
+		days = 0
+	}
+
+	return 1 + days
+}
+
+// pick returns the rowids of up to the given number of the candidates picked at random
+// without replacement. If weighted is true, the chance of a candidate being picked is
+// proportional to its weight.
+func pick(candidates []candidate, n int, weighted bool, now time.Time, rng *rand.Rand) []int {
+	type keyed struct {
+		rowID int
+		key   float64
+	}
+
+	// each candidate is given a key of u^(1/w) for a uniform random u, and the candidates
+	// with the largest keys are picked, as in the algorithm by Efraimidis and Spirakis
+	items := make([]keyed, len(candidates))
+	for i, c := range candidates {
+		w := 1.0
+		if weighted {
+			w = getWeight(c, now)
+		}
+
+		items[i] = keyed{rowID: c.RowID, key: math.Pow(rng.Float64(), 1/w)}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key > items[j].key
+	})
+
+	if n > len(items) {
+		n = len(items)
+	}
+
+	ret := make([]int, n)
+	for i := 0; i < n; i++ {
+		ret[i] = items[i].rowID
+	}
+
+	return ret
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		db := ctx.DB
+
+		var bookLabel string
+		if bookFlag != "" {
+			label, err := database.ResolveBookLabel(db, bookFlag, ctx.CaseSensitiveBooks)
+			if err != nil {
+				return errors.Wrap(err, "resolving the book")
+			}
+			bookLabel = label
+		}
+
+		candidates, err := getCandidates(db, bookLabel)
+		if err != nil {
+			return errors.Wrap(err, "getting the notes")
+		}
+
+		now := ctx.Clock.Now()
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		rowIDs := pick(candidates, countFlag, weightedFlag, now, rng)
+
+		if len(rowIDs) == 0 && !output.IsJSON() {
+			log.Plainf("no notes to pick from\n")
+			return nil
+		}
+
+		notes := []output.Note{}
+		for i, rowID := range rowIDs {
+			if err := thin.EnsureBody(ctx, rowID); err != nil {
+				return errors.Wrap(err, "getting the note body")
+			}
+
+			info, err := database.GetNoteInfo(db, rowID)
+			if err != nil {
+				return err
+			}
+
+			if err := database.MarkNoteViewed(db, ctx.Clock, rowID); err != nil {
+				return errors.Wrap(err, "recording the view")
+			}
+
+			if output.IsJSON() {
+				notes = append(notes, output.NewNote(info))
+				continue
+			}
+
+			if i > 0 {
+				log.Plainf("\n")
+			}
+			output.NoteInfo(info)
+		}
+
+		if output.IsJSON() {
+			return output.JSON(notes)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,116 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package random
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestGetCandidates(t *testing.T) {
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, last_viewed_on) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1", 10, 0)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, last_viewed_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2", 20, 50)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, last_viewed_on) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3", 30, 0)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4", 40, true)
+
+	t.Run("all books", func(t *testing.T) {
+		got, err := getCandidates(db, "")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the candidates"))
+		}
+
+		assert.DeepEqual(t, got, []candidate{{RowID: 1, SeenOn: 10}, {RowID: 2, SeenOn: 50}, {RowID: 3, SeenOn: 30}}, "candidates mismatch")
+	})
+
+	t.Run("book", func(t *testing.T) {
+		got, err := getCandidates(db, "js")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the candidates"))
+		}
+
+		assert.DeepEqual(t, got, []candidate{{RowID: 1, SeenOn: 10}, {RowID: 2, SeenOn: 50}}, "candidates mismatch")
+	})
+}
+
+func TestPick(t *testing.T) {
+	now := time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+	candidates := []candidate{
+		{RowID: 1, SeenOn: now.UnixNano()},
+		{RowID: 2, SeenOn: now.AddDate(0, 0, -1).UnixNano()},
+		{RowID: 3, SeenOn: now.AddDate(0, 0, -99).UnixNano()},
+	}
+
+	t.Run("without replacement", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+
+		for i := 0; i < 50; i++ {
+			got := pick(candidates, 2, false, now, rng)
+			assert.Equal(t, len(got), 2, "count mismatch")
+			if got[0] == got[1] {
+				t.Fatalf("picked %d twice", got[0])
+			}
+		}
+	})
+
+	t.Run("more than the candidates", func(t *testing.T) {
+		got := pick(candidates, 5, false, now, rand.New(rand.NewSource(1)))
+		assert.Equal(t, len(got), 3, "count mismatch")
+	})
+
+	t.Run("no candidates", func(t *testing.T) {
+		got := pick([]candidate{}, 1, true, now, rand.New(rand.NewSource(1)))
+		assert.Equal(t, len(got), 0, "count mismatch")
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+
+		counts := map[int]int{}
+		for i := 0; i < 1000; i++ {
+			counts[pick(candidates, 1, true, now, rng)[0]]++
+		}
+
+		// the weights are 1, 2 and 100
+		if counts[3] < 900 {
+			t.Errorf("expected the note not viewed for the longest time to be picked most of the time. counts: %v", counts)
+		}
+		if counts[2] <= counts[1] {
+			t.Errorf("expected the note viewed a day ago to be picked more often than the one viewed now. counts: %v", counts)
+		}
+	})
+}
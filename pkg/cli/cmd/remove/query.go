@@ -0,0 +1,127 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package remove
+
+import (
+	"github.com/dnote/dnote/pkg/cli/cmd/find"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/pkg/errors"
+)
+
+// getQueryTargets returns the notes matching the search query, in the book with the given
+// name, or in all books if the name is empty
+func getQueryTargets(ctx context.DnoteCtx, query, bookName string) ([]find.Result, error) {
+	var label, bookUUID string
+	if bookName != "" {
+		var err error
+		label, err = database.ResolveBookLabel(ctx.DB, bookName, ctx.CaseSensitiveBooks)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolving the book")
+		}
+
+		bookUUID, err = database.GetBookUUID(ctx.DB, label)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the contents are needed to search the notes
+	if _, err := thin.EnsureBodies(ctx, bookUUID); err != nil {
+		return nil, errors.Wrap(err, "getting the note bodies")
+	}
+
+	results, err := find.Search(ctx, query, label)
+	if err != nil {
+		return nil, errors.Wrap(err, "searching notes")
+	}
+
+	return results, nil
+}
+
+// removeNotes moves the notes with the given rowids to the trash and marks them dirty
+// so that the removals are uploaded on the next sync
+func removeNotes(ctx context.DnoteCtx, rowIDs []int) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	for _, rowID := range rowIDs {
+		var uuid string
+		if err := tx.QueryRow("SELECT uuid FROM notes WHERE rowid = ?", rowID).Scan(&uuid); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "finding the note %d", rowID)
+		}
+
+		if err := database.SaveNoteVersion(tx, ctx.Clock, uuid, database.NoteVersionRemove, ctx.HistoryRetention); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "saving a version")
+		}
+		if err := database.TrashNote(tx, ctx.Clock, uuid, ctx.TrashRetention); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "removing the note %d", rowID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func runQuery(ctx context.DnoteCtx, query, bookName string) error {
+	results, err := getQueryTargets(ctx, query, bookName)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		log.Infof("no notes match the query\n")
+		return nil
+	}
+
+	log.Infof("the following notes will be removed\n")
+	rowIDs := []int{}
+	for _, r := range results {
+		log.Plainf("%s %s %s\n", log.ColorYellow.Sprintf("(%d)", r.RowID), log.ColorGray.Sprintf("[%s]", r.BookLabel), r.Title)
+		rowIDs = append(rowIDs, r.RowID)
+	}
+
+	ok, err := maybeConfirm("proceed?", false)
+	if err != nil {
+		return errors.Wrap(err, "getting confirmation")
+	}
+	if !ok {
+		log.Warnf("aborted by user\n")
+		return nil
+	}
+
+	if err := removeNotes(ctx, rowIDs); err != nil {
+		return errors.Wrap(err, "removing the notes")
+	}
+
+	log.Successf("moved %d notes to the trash\n", len(rowIDs))
+	log.Infof("run `dnote trash` to see them and `dnote restore` to bring them back\n")
+
+	return nil
+}
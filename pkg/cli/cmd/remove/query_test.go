@@ -0,0 +1,134 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package remove
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func setupNotes(t *testing.T, db *database.DB) {
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "react")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", 1, "n1-uuid", "b1-uuid", "react hooks", 1, 10, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", 2, "n2-uuid", "b1-uuid", "closures", 2, 11, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", 3, "n3-uuid", "b1-uuid", "", 3, true)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (rowid, uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?, ?)", 4, "n4-uuid", "b2-uuid", "react router", 4)
+}
+
+func TestGetQueryTargets(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		book     string
+		expected []int
+	}{
+		{
+			name:     "all books",
+			query:    "react",
+			expected: []int{1, 4},
+		},
+		{
+			name:     "book",
+			query:    "react",
+			book:     "JS",
+			expected: []int{1},
+		},
+		{
+			name:     "no match",
+			query:    "generics",
+			expected: []int{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			setupNotes(t, ctx.DB)
+
+			// execute
+			results, err := getQueryTargets(ctx, tc.query, tc.book)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			got := []int{}
+			for _, r := range results {
+				got = append(got, r.RowID)
+			}
+			sort.Ints(got)
+
+			assert.DeepEqual(t, got, tc.expected, "targets mismatch")
+		})
+	}
+}
+
+func TestRemoveNotes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	c := clock.NewMock()
+	c.SetNow(time.Unix(0, 1542058875))
+	ctx.Clock = c
+
+	setupNotes(t, ctx.DB)
+
+	// execute
+	if err := removeNotes(ctx, []int{1, 4}); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	for _, uuid := range []string{"n1-uuid", "n4-uuid"} {
+		var deleted, dirty bool
+		var trashedOn int64
+		database.MustScan(t, "getting "+uuid, ctx.DB.QueryRow("SELECT deleted, dirty, trashed_on FROM notes WHERE uuid = ?", uuid), &deleted, &dirty, &trashedOn)
+		assert.Equal(t, deleted, true, uuid+" deleted mismatch")
+		assert.Equal(t, dirty, true, uuid+" dirty mismatch")
+		assert.Equal(t, trashedOn, int64(1542058875), uuid+" trashed_on mismatch")
+	}
+
+	var n2Deleted, n2Dirty bool
+	database.MustScan(t, "getting n2", ctx.DB.QueryRow("SELECT deleted, dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2Deleted, &n2Dirty)
+	assert.Equal(t, n2Deleted, false, "n2 deleted mismatch")
+	assert.Equal(t, n2Dirty, false, "n2 dirty mismatch")
+
+	var versionCount int
+	database.MustScan(t, "counting versions", ctx.DB.QueryRow("SELECT count(*) FROM note_versions"), &versionCount)
+	assert.Equal(t, versionCount, 2, "version count mismatch")
+}
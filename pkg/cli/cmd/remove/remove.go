@@ -22,11 +22,15 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/dnote/dnote/pkg/cli/completion"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/deprecation"
 	"github.com/dnote/dnote/pkg/cli/infra"
 	"github.com/dnote/dnote/pkg/cli/log"
 	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/picker"
+	"github.com/dnote/dnote/pkg/cli/thin"
 	"github.com/dnote/dnote/pkg/cli/ui"
 	"github.com/dnote/dnote/pkg/cli/utils"
 	"github.com/pkg/errors"
@@ -35,6 +39,15 @@ import (
 
 var bookFlag string
 var yesFlag bool
+var interactiveFlag bool
+var queryFlag string
+
+// bookNameUsage is the deprecated usage of passing the book name along with the note id
+var bookNameUsage = deprecation.Usage("dnote remove <book name> <note id>", `"dnote remove <note id>"`, "1.0.0")
+
+// bookFlagUsage is the deprecated usage of passing the book to remove as a flag. The flag
+// itself is still used to narrow down the search with --query.
+var bookFlagUsage = deprecation.Usage("dnote remove --book", "the book name as an argument", "1.0.0")
 
 var example = `
   * Delete a note by id
@@ -42,32 +55,47 @@ var example = `
 
   * Delete a book by name
   dnote delete js
+
+  * Pick a note to delete from a list
+  dnote delete
+
+  * Delete the notes matching a search query in a book
+  dnote delete --query "deprecated api" --book js
 `
 
 // NewCmd returns a new remove command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "remove <note id|book name>",
-		Short:   "Remove a note or a book",
-		Aliases: []string{"rm", "d", "delete"},
-		Example: example,
-		PreRunE: preRun,
-		RunE:    newRun(ctx),
+		Use:               "remove <note id|book name?>",
+		Short:             "Remove a note or a book",
+		Aliases:           []string{"rm", "d", "delete"},
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.NoteOrBookArgs(ctx),
 	}
 
 	f := cmd.Flags()
-	f.StringVarP(&bookFlag, "book", "b", "", "The book name to delete")
+	f.StringVarP(&bookFlag, "book", "b", "", "The book name to delete, or the book to search in with --query")
+	f.StringVarP(&queryFlag, "query", "q", "", "Remove the notes matching the search query")
 	f.BoolVarP(&yesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+	f.BoolVarP(&interactiveFlag, "interactive", "i", false, "Pick a note to remove from a list. This is the default if no argument is given")
 
-	f.MarkDeprecated("book", "Pass the book name as an argument. e.g. `dnote rm book_name`")
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
 
 	return cmd
 }
 
 func preRun(cmd *cobra.Command, args []string) error {
-	if len(args) != 1 && len(args) != 2 {
+	if len(args) > 2 {
 		return errors.New("Incorrect number of argument")
 	}
+	if interactiveFlag && len(args) > 0 {
+		return errors.New("--interactive flag is only valid without arguments")
+	}
+	if queryFlag != "" && (len(args) > 0 || interactiveFlag) {
+		return errors.New("--query flag is only valid without arguments and --interactive")
+	}
 
 	return nil
 }
@@ -82,8 +110,17 @@ func maybeConfirm(message string, defaultValue bool) (bool, error) {
 
 func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
-		// DEPRECATED: Remove in 1.0.0
+		if queryFlag != "" {
+			if err := runQuery(ctx, queryFlag, bookFlag); err != nil {
+				return errors.Wrap(err, "removing the notes")
+			}
+
+			return nil
+		}
+
 		if bookFlag != "" {
+			deprecation.Warn(bookFlagUsage)
+
 			if err := runBook(ctx, bookFlag); err != nil {
 				return errors.Wrap(err, "removing the book")
 			}
@@ -91,9 +128,23 @@ func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 			return nil
 		}
 
-		// DEPRECATED: Remove in 1.0.0
+		if len(args) == 0 {
+			rowID, err := picker.PickNote(ctx)
+			if err == picker.ErrCancelled {
+				return nil
+			} else if err != nil {
+				return errors.Wrap(err, "picking a note")
+			}
+
+			if err := runNote(ctx, strconv.Itoa(rowID)); err != nil {
+				return errors.Wrap(err, "removing the note")
+			}
+
+			return nil
+		}
+
 		if len(args) == 2 {
-			log.Plain(log.ColorYellow.Sprintf("DEPRECATED: you no longer need to pass book name to the remove command. e.g. `dnote remove 123`.\n\n"))
+			deprecation.Warn(bookNameUsage)
 
 			target := args[1]
 			if err := runNote(ctx, target); err != nil {
@@ -127,6 +178,10 @@ func runNote(ctx context.DnoteCtx, rowIDArg string) error {
 		return errors.Wrap(err, "invalid rowid")
 	}
 
+	if err := thin.EnsureBody(ctx, noteRowID); err != nil {
+		return errors.Wrap(err, "getting the note body")
+	}
+
 	noteInfo, err := database.GetNoteInfo(db, noteRowID)
 	if err != nil {
 		return err
@@ -148,7 +203,12 @@ func runNote(ctx context.DnoteCtx, rowIDArg string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	if _, err = tx.Exec("UPDATE notes SET deleted = ?, dirty = ?, body = ? WHERE uuid = ?", true, true, "", noteInfo.UUID); err != nil {
+	if err := database.SaveNoteVersion(tx, ctx.Clock, noteInfo.UUID, database.NoteVersionRemove, ctx.HistoryRetention); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving a version")
+	}
+
+	if err := database.TrashNote(tx, ctx.Clock, noteInfo.UUID, ctx.TrashRetention); err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "removing the note")
 	}
@@ -159,7 +219,36 @@ func runNote(ctx context.DnoteCtx, rowIDArg string) error {
 		return errors.Wrap(err, "comitting transaction")
 	}
 
-	log.Successf("removed from %s\n", noteInfo.BookLabel)
+	log.Successf("moved to the trash from %s\n", noteInfo.BookLabel)
+	log.Infof("run `dnote restore %d` to bring it back\n", noteInfo.RowID)
+
+	return nil
+}
+
+// saveBookNoteVersions saves the current state of the notes in the book as new versions
+func saveBookNoteVersions(ctx context.DnoteCtx, tx *database.DB, bookUUID string) error {
+	rows, err := tx.Query("SELECT uuid FROM notes WHERE book_uuid = ? AND deleted = ?", bookUUID, false)
+	if err != nil {
+		return errors.Wrap(err, "querying notes")
+	}
+
+	uuids := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "scanning a note uuid")
+		}
+
+		uuids = append(uuids, uuid)
+	}
+	rows.Close()
+
+	for _, uuid := range uuids {
+		if err := database.SaveNoteVersion(tx, ctx.Clock, uuid, database.NoteVersionRemove, ctx.HistoryRetention); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -167,10 +256,18 @@ func runNote(ctx context.DnoteCtx, rowIDArg string) error {
 func runBook(ctx context.DnoteCtx, bookLabel string) error {
 	db := ctx.DB
 
+	bookLabel, err := database.ResolveBookLabel(db, bookLabel, ctx.CaseSensitiveBooks)
+	if err != nil {
+		return errors.Wrap(err, "resolving the book")
+	}
+
 	bookUUID, err := database.GetBookUUID(db, bookLabel)
 	if err != nil {
 		return errors.Wrap(err, "finding book uuid")
 	}
+	if err := database.CheckBookOwner(db, bookUUID); err != nil {
+		return err
+	}
 
 	ok, err := maybeConfirm(fmt.Sprintf("delete book '%s' and all its notes?", bookLabel), false)
 	if err != nil {
@@ -186,7 +283,12 @@ func runBook(ctx context.DnoteCtx, bookLabel string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	if _, err = tx.Exec("UPDATE notes SET deleted = ?, dirty = ?, body = ? WHERE book_uuid = ?", true, true, "", bookUUID); err != nil {
+	if err := saveBookNoteVersions(ctx, tx, bookUUID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving versions of the notes in the book")
+	}
+
+	if _, err = tx.Exec("UPDATE notes SET deleted = ?, dirty = ?, body = ?, trashed_on = ? WHERE book_uuid = ?", true, true, "", 0, bookUUID); err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "removing notes in the book")
 	}
@@ -0,0 +1,237 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package restore
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/secrets"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var versionFlag int
+var forceFlag bool
+
+var example = `
+ * Restore the note with id 3 from the trash
+ dnote restore 3
+
+ * Restore the note with id 3 to its version 2
+ dnote restore 3 --version 2`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+	if versionFlag < 0 {
+		return errors.New("invalid --version")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new restore command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore <note id>",
+		Short:   "Restore a note from the trash or to one of its past versions",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.IntVarP(&versionFlag, "version", "v", 0, "The version to restore. Run 'dnote history <note id>' to see the versions")
+	f.BoolVarP(&forceFlag, "force", "", false, "restore a public version even if it seems to contain secrets, without confirmation")
+
+	return cmd
+}
+
+// checkBookExists returns true if the book with the given uuid exists and has not been removed
+func checkBookExists(tx *database.DB, bookUUID string) (bool, error) {
+	var bookCount int
+	if err := tx.QueryRow("SELECT count(*) FROM books WHERE uuid = ? AND deleted = ?", bookUUID, false).Scan(&bookCount); err != nil {
+		return false, errors.Wrap(err, "checking the book")
+	}
+
+	return bookCount > 0, nil
+}
+
+// restoreFromTrash moves the note out of the trash
+func restoreFromTrash(ctx context.DnoteCtx, tx *database.DB, note database.Note) error {
+	if note.TrashedOn == 0 {
+		return errors.New("the note is not in the trash. Pass --version to restore one of its past versions")
+	}
+
+	ok, err := checkBookExists(tx, note.BookUUID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the book of the note has been removed")
+	}
+
+	return database.RestoreTrashedNote(tx, ctx.Clock, note.UUID)
+}
+
+// getVersion returns the given version of the note
+func getVersion(db *database.DB, noteUUID string, version int) (database.NoteVersion, error) {
+	v, err := database.GetNoteVersion(db, noteUUID, version)
+	if err == sql.ErrNoRows {
+		return v, errors.Errorf("version %d not found", version)
+	} else if err != nil {
+		return v, errors.Wrap(err, "querying the version")
+	}
+
+	return v, nil
+}
+
+// checkSecrets scans the content that is about to be shared again for likely secrets, and
+// asks for a confirmation if any is found
+func checkSecrets(content string) error {
+	findings := secrets.Scan(content)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	log.Warnf("the version seems to contain secrets\n")
+	for _, f := range findings {
+		log.Plainf("  %s %s %s\n", log.ColorYellow.Sprintf("line %d:", f.Line), f.Kind, log.ColorGray.Sprintf("(%s)", f.Excerpt))
+	}
+
+	if forceFlag {
+		return nil
+	}
+
+	ok, err := ui.Confirm("share it anyway?", false)
+	if err != nil {
+		return errors.Wrap(err, "getting confirmation")
+	}
+	if !ok {
+		return errors.New("Aborted. Use --force to restore the version regardless")
+	}
+
+	return nil
+}
+
+// restoreVersion restores the note to the given version. The current state of the note
+// is saved as a new version first, unless the note has been removed. The title and the
+// content type are kept if the version did not record them.
+func restoreVersion(ctx context.DnoteCtx, tx *database.DB, note database.Note, v database.NoteVersion) error {
+	ok, err := checkBookExists(tx, v.BookUUID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf("the book of the version %d has been removed", v.Version)
+	}
+
+	if !note.Deleted {
+		if err := database.SaveNoteVersion(tx, ctx.Clock, note.UUID, database.NoteVersionRestore, ctx.HistoryRetention); err != nil {
+			return errors.Wrap(err, "saving a version")
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE notes SET book_uuid = ?, body = ?, public = ?, language = ?, title = coalesce(?, title), content_type = coalesce(?, content_type),
+			deleted = ?, edited_on = ?, dirty = ?, trashed_on = ? WHERE uuid = ?`,
+		v.BookUUID, v.Body, v.Public, v.Language, v.Title, v.ContentType, false, ctx.Clock.Now().UnixNano(), true, 0, note.UUID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+	if err := database.ReconcileNoteVisibility(tx, note.UUID); err != nil {
+		return errors.Wrap(err, "updating the visibility of the note")
+	}
+
+	return nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		rowID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid rowid")
+		}
+
+		db := ctx.DB
+		note, err := database.GetNote(db, rowID)
+		if err == sql.ErrNoRows {
+			return errors.Errorf("note %d not found", rowID)
+		} else if err != nil {
+			return errors.Wrap(err, "querying the note")
+		}
+
+		var version database.NoteVersion
+		if versionFlag != 0 {
+			version, err = getVersion(db, note.UUID, versionFlag)
+			if err != nil {
+				return err
+			}
+
+			// a public version is scanned unless it is what the note already shares
+			if version.Public && (!note.Public || version.Body != note.Body) {
+				if err := checkSecrets(version.Body); err != nil {
+					return err
+				}
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+
+		if versionFlag == 0 {
+			err = restoreFromTrash(ctx, tx, note)
+		} else {
+			err = restoreVersion(ctx, tx, note, version)
+		}
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "restoring the note")
+		}
+
+		noteInfo, err := database.GetNoteInfo(tx, rowID)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "getting note info")
+		}
+
+		if err := tx.Commit(); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "committing a transaction")
+		}
+
+		if versionFlag == 0 {
+			log.Successf("restored the note from the trash\n")
+		} else {
+			log.Successf("restored the note to the version %d\n", versionFlag)
+		}
+		output.NoteInfo(noteInfo)
+
+		return nil
+	}
+}
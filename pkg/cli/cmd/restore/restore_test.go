@@ -0,0 +1,234 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package restore
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestRestoreVersion(t *testing.T) {
+	t.Run("edited note", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		db := ctx.DB
+		database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+		database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+		database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+		if err := database.SaveNoteVersion(db, ctx.Clock, "n1-uuid", database.NoteVersionEdit, 0); err != nil {
+			t.Fatal(errors.Wrap(err, "saving a version"))
+		}
+		database.MustExec(t, "editing n1", db, "UPDATE notes SET body = ?, book_uuid = ? WHERE uuid = ?", "n1 body edited", "b2-uuid", "n1-uuid")
+
+		var rowID int
+		database.MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", "n1-uuid"), &rowID)
+		note, err := database.GetNote(db, rowID)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the note"))
+		}
+
+		// execute
+		v, err := getVersion(db, note.UUID, 1)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the version"))
+		}
+		if err := restoreVersion(ctx, db, note, v); err != nil {
+			t.Fatal(errors.Wrap(err, "restoring"))
+		}
+
+		// test
+		var body, bookUUID string
+		var dirty bool
+		database.MustScan(t, "getting n1", db.QueryRow("SELECT body, book_uuid, dirty FROM notes WHERE uuid = ?", "n1-uuid"), &body, &bookUUID, &dirty)
+		assert.Equal(t, body, "n1 body", "body mismatch")
+		assert.Equal(t, bookUUID, "b1-uuid", "book_uuid mismatch")
+		assert.Equal(t, dirty, true, "dirty mismatch")
+
+		versions, err := database.GetNoteVersions(db, "n1-uuid")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting versions"))
+		}
+		assert.Equal(t, len(versions), 2, "version count mismatch")
+		assert.Equal(t, versions[1].Body, "n1 body edited", "saved version body mismatch")
+		assert.Equal(t, versions[1].Action, database.NoteVersionRestore, "saved version action mismatch")
+	})
+
+	t.Run("removed note", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		db := ctx.DB
+		database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+		database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+		if err := database.SaveNoteVersion(db, ctx.Clock, "n1-uuid", database.NoteVersionRemove, 0); err != nil {
+			t.Fatal(errors.Wrap(err, "saving a version"))
+		}
+		database.MustExec(t, "removing n1", db, "UPDATE notes SET body = ?, deleted = ? WHERE uuid = ?", "", true, "n1-uuid")
+
+		var rowID int
+		database.MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", "n1-uuid"), &rowID)
+		note, err := database.GetNote(db, rowID)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the note"))
+		}
+
+		// execute
+		v, err := getVersion(db, note.UUID, 1)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the version"))
+		}
+		if err := restoreVersion(ctx, db, note, v); err != nil {
+			t.Fatal(errors.Wrap(err, "restoring"))
+		}
+
+		// test
+		var body string
+		var deleted bool
+		database.MustScan(t, "getting n1", db.QueryRow("SELECT body, deleted FROM notes WHERE uuid = ?", "n1-uuid"), &body, &deleted)
+		assert.Equal(t, body, "n1 body", "body mismatch")
+		assert.Equal(t, deleted, false, "deleted mismatch")
+
+		var versionCount int
+		database.MustScan(t, "counting versions", db.QueryRow("SELECT count(*) FROM note_versions WHERE note_uuid = ?", "n1-uuid"), &versionCount)
+		assert.Equal(t, versionCount, 1, "version count mismatch")
+
+		if _, err := getVersion(db, note.UUID, 2); err == nil {
+			t.Error("expected an error for a nonexistent version")
+		}
+	})
+
+	t.Run("title and content type", func(t *testing.T) {
+		// set up
+		ctx := context.InitTestCtx(t, paths, nil)
+		defer context.TeardownTestCtx(t, ctx)
+
+		db := ctx.DB
+		database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+		database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, title, body, content_type, added_on) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 title", "n1 body", "markdown", 1)
+		if err := database.SaveNoteVersion(db, ctx.Clock, "n1-uuid", database.NoteVersionEdit, 0); err != nil {
+			t.Fatal(errors.Wrap(err, "saving a version"))
+		}
+		database.MustExec(t, "inserting a version without title and content type", db,
+			"INSERT INTO note_versions (note_uuid, version, book_uuid, body, public, language, action, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			"n1-uuid", 2, "b1-uuid", "n1 body legacy", false, "", database.NoteVersionEdit, 2)
+		database.MustExec(t, "editing n1", db, "UPDATE notes SET title = ?, body = ?, content_type = ? WHERE uuid = ?", "n1 title edited", "n1 body edited", "plaintext", "n1-uuid")
+
+		var rowID int
+		database.MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", "n1-uuid"), &rowID)
+		getTitleAndContentType := func() (string, string) {
+			var title, contentType string
+			database.MustScan(t, "getting n1", db.QueryRow("SELECT title, content_type FROM notes WHERE uuid = ?", "n1-uuid"), &title, &contentType)
+			return title, contentType
+		}
+		restore := func(version int) {
+			note, err := database.GetNote(db, rowID)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting the note"))
+			}
+			v, err := getVersion(db, note.UUID, version)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting the version"))
+			}
+			if err := restoreVersion(ctx, db, note, v); err != nil {
+				t.Fatal(errors.Wrap(err, "restoring"))
+			}
+		}
+
+		// execute and test
+		restore(2)
+		title, contentType := getTitleAndContentType()
+		assert.Equal(t, title, "n1 title edited", "the title should be kept for a version without it")
+		assert.Equal(t, contentType, "plaintext", "the content type should be kept for a version without it")
+
+		restore(1)
+		title, contentType = getTitleAndContentType()
+		assert.Equal(t, title, "n1 title", "title mismatch")
+		assert.Equal(t, contentType, "markdown", "content type mismatch")
+	})
+}
+
+func TestCheckSecrets(t *testing.T) {
+	defer func() { forceFlag = false }()
+
+	if err := checkSecrets("no secrets here"); err != nil {
+		t.Fatal(errors.Wrap(err, "checking a content without secrets"))
+	}
+
+	forceFlag = true
+	if err := checkSecrets("password: hunter22"); err != nil {
+		t.Fatal(errors.Wrap(err, "checking a content with secrets and --force"))
+	}
+}
+
+func TestRestoreFromTrash(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b2-uuid", "css", true)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 1, true, false, 2)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 1)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3 body", 1, true, true, 2)
+
+	getNote := func(uuid string) database.Note {
+		var rowID int
+		database.MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowID)
+		note, err := database.GetNote(db, rowID)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the note"))
+		}
+
+		return note
+	}
+
+	// execute
+	if err := restoreFromTrash(ctx, db, getNote("n1-uuid")); err != nil {
+		t.Fatal(errors.Wrap(err, "restoring"))
+	}
+
+	// test
+	n1 := getNote("n1-uuid")
+	assert.Equal(t, n1.Body, "n1 body", "n1 body mismatch")
+	assert.Equal(t, n1.Deleted, false, "n1 deleted mismatch")
+	assert.Equal(t, n1.Dirty, true, "n1 dirty mismatch")
+	assert.Equal(t, n1.TrashedOn, int64(0), "n1 trashed_on mismatch")
+
+	if err := restoreFromTrash(ctx, db, getNote("n2-uuid")); err == nil {
+		t.Error("expected an error for a note not in the trash")
+	}
+	if err := restoreFromTrash(ctx, db, getNote("n3-uuid")); err == nil {
+		t.Error("expected an error for a note in a removed book")
+	}
+}
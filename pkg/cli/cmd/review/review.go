@@ -0,0 +1,369 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package review
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var bookFlag string
+var limitFlag int
+
+var example = `
+ * Review the notes that are due
+ dnote review
+
+ * Review at most 5 notes from the book 'js'
+ dnote review --book js --limit 5
+
+ * List the notes whose reviews are snoozed
+ dnote review snoozed`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errors.New("Incorrect number of argument")
+	}
+	if limitFlag < 0 {
+		return errors.New("--limit must not be negative")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new review command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "review",
+		Short:   "Review the notes that are due, using spaced repetition",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&bookFlag, "book", "b", "", "Only review the notes in the given book")
+	f.IntVarP(&limitFlag, "limit", "l", 20, "The maximum number of notes to review. 0 means no limit")
+
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
+
+	cmd.AddCommand(newSnoozeCmd(ctx))
+	cmd.AddCommand(newSnoozedCmd(ctx))
+
+	return cmd
+}
+
+const (
+	// defaultEaseFactor is the ease factor of a note that has never been reviewed
+	defaultEaseFactor = 2.5
+	// minEaseFactor is the lowest ease factor a note can have
+	minEaseFactor = 1.3
+	// maxGrade is the grade for a perfect recall
+	maxGrade = 5
+	// passingGrade is the lowest grade that counts as a successful recall
+	passingGrade = 3
+)
+
+// state is the review state of a note
+type state struct {
+	EaseFactor  float64
+	Interval    int
+	Repetitions int
+	DueOn       int64
+}
+
+// newState returns the state of a note that has never been reviewed
+func newState() state {
+	return state{
+		EaseFactor: defaultEaseFactor,
+	}
+}
+
+// schedule returns the state of a note after a review with the given grade,
+// following the SM-2 algorithm. The interval is in days.
+func schedule(s state, grade int, now time.Time) state {
+	ret := s
+
+	if grade < passingGrade {
+		ret.Repetitions = 0
+		ret.Interval = 1
+	} else {
+		switch s.Repetitions {
+		case 0:
+			ret.Interval = 1
+		case 1:
+			ret.Interval = 6
+		default:
+			ret.Interval = int(math.Round(float64(s.Interval) * s.EaseFactor))
+		}
+
+		ret.Repetitions = s.Repetitions + 1
+	}
+
+	q := float64(maxGrade - grade)
+	ret.EaseFactor = s.EaseFactor + (0.1 - q*(0.08+q*0.02))
+	if ret.EaseFactor < minEaseFactor {
+		ret.EaseFactor = minEaseFactor
+	}
+
+	ret.DueOn = now.AddDate(0, 0, ret.Interval).UnixNano()
+
+	return ret
+}
+
+// dueNote is a note that is due for a review
+type dueNote struct {
+	RowID int
+	UUID  string
+	State state
+}
+
+// getDueNotes returns the notes that have never been reviewed or whose review is due,
+// starting from the most overdue ones. Notes that have never been reviewed come last.
+// Notes that are snoozed are left out until the snooze ends.
+func getDueNotes(db *database.DB, now time.Time, bookName string, limit int) ([]dueNote, error) {
+	query := `SELECT notes.rowid, notes.uuid, review_state.ease_factor, review_state.interval, review_state.repetitions, review_state.due_on
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		LEFT JOIN review_state ON review_state.note_uuid = notes.uuid
+		LEFT JOIN review_snoozes ON review_snoozes.note_uuid = notes.uuid
+		WHERE notes.deleted = ? AND (review_state.due_on IS NULL OR review_state.due_on <= ?)
+		AND (review_snoozes.snoozed_until IS NULL OR review_snoozes.snoozed_until <= ?)`
+	args := []interface{}{false, now.UnixNano(), now.UnixNano()}
+
+	if bookName != "" {
+		query += " AND books.label = ?"
+		args = append(args, bookName)
+	}
+
+	query += " ORDER BY review_state.due_on IS NULL, review_state.due_on ASC, notes.added_on ASC"
+
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying due notes")
+	}
+	defer rows.Close()
+
+	ret := []dueNote{}
+	for rows.Next() {
+		var n dueNote
+		var easeFactor sql.NullFloat64
+		var interval, repetitions, dueOn sql.NullInt64
+
+		if err := rows.Scan(&n.RowID, &n.UUID, &easeFactor, &interval, &repetitions, &dueOn); err != nil {
+			return nil, errors.Wrap(err, "scanning a due note")
+		}
+
+		if easeFactor.Valid {
+			n.State = state{
+				EaseFactor:  easeFactor.Float64,
+				Interval:    int(interval.Int64),
+				Repetitions: int(repetitions.Int64),
+				DueOn:       dueOn.Int64,
+			}
+		} else {
+			n.State = newState()
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// saveState upserts the review state of the note with the given uuid. Reviewing a
+// snoozed note ends the snooze.
+func saveState(db *database.DB, noteUUID string, s state, now time.Time) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO review_state (note_uuid, ease_factor, interval, repetitions, due_on, last_reviewed_on)
+		VALUES (?, ?, ?, ?, ?, ?)`, noteUUID, s.EaseFactor, s.Interval, s.Repetitions, s.DueOn, now.UnixNano())
+	if err != nil {
+		return errors.Wrapf(err, "saving the review state of the note %s", noteUUID)
+	}
+
+	if _, err := db.Exec("DELETE FROM review_snoozes WHERE note_uuid = ?", noteUUID); err != nil {
+		return errors.Wrapf(err, "ending the snooze of the note %s", noteUUID)
+	}
+
+	return nil
+}
+
+var errQuit = errors.New("quit")
+var errSkip = errors.New("skip")
+var errSnooze = errors.New("snooze")
+
+// promptGrade asks the user how well the note was recalled. It returns errSkip, errSnooze
+// or errQuit if the user chose to skip the note, to snooze it or to stop the review.
+func promptGrade() (int, error) {
+	for {
+		var input string
+		if err := ui.PromptInput("how well did you recall it? (0-5, n to skip, s to snooze, q to quit)", &input); err != nil {
+			return 0, errors.Wrap(err, "getting the grade")
+		}
+
+		input = strings.TrimSpace(strings.ToLower(input))
+		switch input {
+		case "q":
+			return 0, errQuit
+		case "n":
+			return 0, errSkip
+		case "s":
+			return 0, errSnooze
+		}
+
+		grade, err := strconv.Atoi(input)
+		if err == nil && grade >= 0 && grade <= maxGrade {
+			return grade, nil
+		}
+
+		log.Warnf("invalid grade '%s'\n", input)
+	}
+}
+
+// promptSnooze asks the user how long to snooze the note for
+func promptSnooze(now time.Time) (time.Time, error) {
+	for {
+		var input string
+		if err := ui.PromptInput(fmt.Sprintf("snooze for how long? (such as 12h, 3d or 2w. defaults to %s)", defaultSnooze), &input); err != nil {
+			return time.Time{}, errors.Wrap(err, "getting the duration")
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			input = defaultSnooze
+		}
+
+		until, err := parseSnooze(input, now)
+		if err == nil {
+			return until, nil
+		}
+
+		log.Warnf("%s\n", err.Error())
+	}
+}
+
+func formatInterval(days int) string {
+	if days == 1 {
+		return "1 day"
+	}
+
+	return strconv.Itoa(days) + " days"
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		db := ctx.DB
+
+		var bookName string
+		if bookFlag != "" {
+			var err error
+			bookName, err = database.ResolveBookLabel(db, bookFlag, ctx.CaseSensitiveBooks)
+			if err != nil {
+				return errors.Wrap(err, "resolving the book")
+			}
+		}
+
+		notes, err := getDueNotes(db, ctx.Clock.Now(), bookName, limitFlag)
+		if err != nil {
+			return errors.Wrap(err, "getting due notes")
+		}
+
+		if len(notes) == 0 {
+			log.Success("no notes are due for a review\n")
+
+			snoozed, err := getSnoozedNotes(db, ctx.Clock.Now())
+			if err != nil {
+				return errors.Wrap(err, "getting snoozed notes")
+			}
+			if len(snoozed) > 0 {
+				log.Infof("%d snoozed notes. Run 'dnote review snoozed' to see them\n", len(snoozed))
+			}
+
+			return nil
+		}
+
+		var reviewed int
+		for i, n := range notes {
+			if err := thin.EnsureBody(ctx, n.RowID); err != nil {
+				return errors.Wrap(err, "getting the note body")
+			}
+
+			info, err := database.GetNoteInfo(db, n.RowID)
+			if err != nil {
+				return errors.Wrap(err, "getting the note")
+			}
+
+			log.Plainf("\n")
+			log.Infof("reviewing %d of %d\n", i+1, len(notes))
+			output.NoteInfo(info)
+
+			grade, err := promptGrade()
+			if err == errQuit {
+				break
+			} else if err == errSkip {
+				continue
+			} else if err == errSnooze {
+				until, err := promptSnooze(ctx.Clock.Now())
+				if err != nil {
+					return err
+				}
+				if err := snoozeNote(db, n.UUID, until); err != nil {
+					return err
+				}
+
+				log.Infof("snoozed until %s\n", formatSnoozedUntil(until))
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			now := ctx.Clock.Now()
+			s := schedule(n.State, grade, now)
+			if err := saveState(db, n.UUID, s, now); err != nil {
+				return err
+			}
+
+			reviewed++
+			log.Infof("next review in %s\n", formatInterval(s.Interval))
+		}
+
+		log.Successf("reviewed %d notes\n", reviewed)
+
+		return nil
+	}
+}
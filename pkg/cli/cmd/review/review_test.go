@@ -0,0 +1,249 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package review
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		state               state
+		grade               int
+		expectedInterval    int
+		expectedRepetitions int
+		expectedEaseFactor  float64
+	}{
+		{
+			state:               newState(),
+			grade:               5,
+			expectedInterval:    1,
+			expectedRepetitions: 1,
+			expectedEaseFactor:  2.6,
+		},
+		{
+			state:               newState(),
+			grade:               3,
+			expectedInterval:    1,
+			expectedRepetitions: 1,
+			expectedEaseFactor:  2.36,
+		},
+		{
+			state:               state{EaseFactor: 2.5, Interval: 1, Repetitions: 1},
+			grade:               4,
+			expectedInterval:    6,
+			expectedRepetitions: 2,
+			expectedEaseFactor:  2.5,
+		},
+		{
+			state:               state{EaseFactor: 2.5, Interval: 6, Repetitions: 2},
+			grade:               4,
+			expectedInterval:    15,
+			expectedRepetitions: 3,
+			expectedEaseFactor:  2.5,
+		},
+		{
+			// forgetting resets the repetitions
+			state:               state{EaseFactor: 2.5, Interval: 15, Repetitions: 3},
+			grade:               2,
+			expectedInterval:    1,
+			expectedRepetitions: 0,
+			expectedEaseFactor:  2.18,
+		},
+		{
+			// the ease factor does not go below the minimum
+			state:               state{EaseFactor: 1.3, Interval: 6, Repetitions: 2},
+			grade:               0,
+			expectedInterval:    1,
+			expectedRepetitions: 0,
+			expectedEaseFactor:  1.3,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			got := schedule(tc.state, tc.grade, now)
+
+			assert.Equal(t, got.Interval, tc.expectedInterval, "interval mismatch")
+			assert.Equal(t, got.Repetitions, tc.expectedRepetitions, "repetitions mismatch")
+			assert.Equal(t, got.DueOn, now.AddDate(0, 0, tc.expectedInterval).UnixNano(), "due_on mismatch")
+			if math.Abs(got.EaseFactor-tc.expectedEaseFactor) > 1e-9 {
+				t.Errorf("ease factor mismatch. got %f, expected %f", got.EaseFactor, tc.expectedEaseFactor)
+			}
+		})
+	}
+}
+
+func TestGetDueNotes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "js", 1)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b2-uuid", "css", 2)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 body", 3)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n4-uuid", "b2-uuid", "n4 body", 4)
+	database.MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", "n5-uuid", "b1-uuid", "", 5, true)
+
+	// n1 is not due yet, n2 is overdue and n3 has never been reviewed
+	if err := saveState(db, "n1-uuid", state{EaseFactor: 2.5, Interval: 6, Repetitions: 2, DueOn: now.Add(time.Hour).UnixNano()}, now); err != nil {
+		t.Fatal(errors.Wrap(err, "saving n1 state"))
+	}
+	if err := saveState(db, "n2-uuid", state{EaseFactor: 2.36, Interval: 1, Repetitions: 1, DueOn: now.Add(-time.Hour).UnixNano()}, now); err != nil {
+		t.Fatal(errors.Wrap(err, "saving n2 state"))
+	}
+
+	t.Run("all books", func(t *testing.T) {
+		// execute
+		got, err := getDueNotes(db, now, "", 0)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting due notes"))
+		}
+
+		// test
+		assert.Equal(t, len(got), 3, "due note count mismatch")
+		assert.Equal(t, got[0].UUID, "n2-uuid", "got[0] uuid mismatch")
+		assert.Equal(t, got[0].State.EaseFactor, 2.36, "got[0] ease factor mismatch")
+		assert.Equal(t, got[0].State.Repetitions, 1, "got[0] repetitions mismatch")
+		assert.Equal(t, got[1].UUID, "n3-uuid", "got[1] uuid mismatch")
+		assert.Equal(t, got[1].State, newState(), "got[1] state mismatch")
+		assert.Equal(t, got[2].UUID, "n4-uuid", "got[2] uuid mismatch")
+	})
+
+	t.Run("book and limit", func(t *testing.T) {
+		// execute
+		got, err := getDueNotes(db, now, "js", 1)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting due notes"))
+		}
+
+		// test
+		assert.Equal(t, len(got), 1, "due note count mismatch")
+		assert.Equal(t, got[0].UUID, "n2-uuid", "got[0] uuid mismatch")
+	})
+
+	t.Run("save state", func(t *testing.T) {
+		// execute
+		s := schedule(newState(), 4, now)
+		if err := saveState(db, "n3-uuid", s, now); err != nil {
+			t.Fatal(errors.Wrap(err, "saving n3 state"))
+		}
+
+		// test
+		got, err := getDueNotes(db, now, "js", 0)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting due notes"))
+		}
+		assert.Equal(t, len(got), 1, "due note count mismatch")
+		assert.Equal(t, got[0].UUID, "n2-uuid", "got[0] uuid mismatch")
+
+		var interval int
+		var lastReviewedOn int64
+		database.MustScan(t, "getting n3 state", db.QueryRow("SELECT interval, last_reviewed_on FROM review_state WHERE note_uuid = ?", "n3-uuid"), &interval, &lastReviewedOn)
+		assert.Equal(t, interval, 1, "interval mismatch")
+		assert.Equal(t, lastReviewedOn, now.UnixNano(), "last_reviewed_on mismatch")
+	})
+}
+
+func TestSnoozeNote(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2)
+
+	n1State := state{EaseFactor: 2.5, Interval: 6, Repetitions: 2, DueOn: now.Add(-time.Hour).UnixNano()}
+	if err := saveState(db, "n1-uuid", n1State, now); err != nil {
+		t.Fatal(errors.Wrap(err, "saving n1 state"))
+	}
+
+	// execute
+	until, err := parseSnooze("3d", now)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing the snooze"))
+	}
+	if err := snoozeNote(db, "n1-uuid", until); err != nil {
+		t.Fatal(errors.Wrap(err, "snoozing n1"))
+	}
+
+	// test
+	due, err := getDueNotes(db, now, "", 0)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting due notes"))
+	}
+	assert.Equal(t, len(due), 1, "due note count mismatch")
+	assert.Equal(t, due[0].UUID, "n2-uuid", "due note mismatch")
+
+	snoozed, err := getSnoozedNotes(db, now)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting snoozed notes"))
+	}
+	assert.Equal(t, len(snoozed), 1, "snoozed note count mismatch")
+	assert.Equal(t, snoozed[0].Title, "n1 body", "snoozed note title mismatch")
+	assert.Equal(t, snoozed[0].SnoozedUntil.UnixNano(), now.AddDate(0, 0, 3).UnixNano(), "snoozed until mismatch")
+
+	// the schedule is left as it is, so the note is due again once the snooze ends
+	later := now.AddDate(0, 0, 3)
+	due, err = getDueNotes(db, later, "", 0)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting due notes later"))
+	}
+	assert.Equal(t, len(due), 2, "due note count mismatch later")
+	assert.Equal(t, due[0].UUID, "n1-uuid", "due note mismatch later")
+	assert.Equal(t, due[0].State, n1State, "state mismatch")
+
+	snoozed, err = getSnoozedNotes(db, later)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting snoozed notes later"))
+	}
+	assert.Equal(t, len(snoozed), 0, "snoozed note count mismatch later")
+}
+
+func TestParseSnooze_invalid(t *testing.T) {
+	if _, err := parseSnooze("soon", time.Now()); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,208 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package review
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// defaultSnooze is how long a note is snoozed for if no duration is given
+const defaultSnooze = "1d"
+
+var snoozeExample = `
+ * Put off the review of the note 12 by a day
+ dnote review snooze 12
+
+ * Put it off by 3 days
+ dnote review snooze 12 3d
+
+ * Make it due again
+ dnote review snooze 12 0h`
+
+func snoozePreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("Incorrect number of argument")
+	}
+	if !utils.IsNumber(args[0]) {
+		return errors.Errorf("invalid note id '%s'", args[0])
+	}
+
+	return nil
+}
+
+func newSnoozeCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "snooze <note id> [duration]",
+		Short:             "Put off the review of a note without changing its schedule",
+		Example:           snoozeExample,
+		PreRunE:           snoozePreRun,
+		RunE:              newSnoozeRun(ctx),
+		ValidArgsFunction: completion.NoteArgs(ctx),
+	}
+
+	return cmd
+}
+
+func newSnoozedCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snoozed",
+		Short: "List the notes whose reviews are snoozed",
+		Args:  cobra.NoArgs,
+		RunE:  newSnoozedRun(ctx),
+	}
+
+	return cmd
+}
+
+// parseSnooze parses how long a note is snoozed for, given as a duration such as 12h, 3d
+// or 2w, or as a date or a time until which it is snoozed
+func parseSnooze(val string, now time.Time) (time.Time, error) {
+	t, err := utils.ParseUntil(val, now)
+	if err != nil {
+		return t, errors.Errorf("invalid duration '%s'. Use a duration such as 12h, 3d or 2w, or a date such as 2020-03-14", val)
+	}
+
+	return t, nil
+}
+
+// snoozeNote keeps the note with the given uuid from being due for a review until the
+// given time. The review state is left as it is, so that the note goes back to its
+// schedule afterwards.
+func snoozeNote(db *database.DB, noteUUID string, until time.Time) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO review_snoozes (note_uuid, snoozed_until) VALUES (?, ?)", noteUUID, until.UnixNano())
+	if err != nil {
+		return errors.Wrapf(err, "snoozing the note %s", noteUUID)
+	}
+
+	return nil
+}
+
+// snoozedNote is a note whose review is snoozed
+type snoozedNote struct {
+	RowID        int       `json:"id"`
+	BookLabel    string    `json:"book"`
+	Title        string    `json:"title"`
+	SnoozedUntil time.Time `json:"snoozed_until"`
+}
+
+// getSnoozedNotes returns the notes that are snoozed at the given time, starting from
+// the ones that are due the soonest
+func getSnoozedNotes(db *database.DB, now time.Time) ([]snoozedNote, error) {
+	rows, err := db.Query(`SELECT notes.rowid, books.label, notes.title, notes.body, review_snoozes.snoozed_until
+		FROM review_snoozes
+		INNER JOIN notes ON notes.uuid = review_snoozes.note_uuid
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.deleted = ? AND review_snoozes.snoozed_until > ?
+		ORDER BY review_snoozes.snoozed_until ASC`, false, now.UnixNano())
+	if err != nil {
+		return nil, errors.Wrap(err, "querying snoozed notes")
+	}
+	defer rows.Close()
+
+	ret := []snoozedNote{}
+	for rows.Next() {
+		var n snoozedNote
+		var title, body string
+		var until int64
+		if err := rows.Scan(&n.RowID, &n.BookLabel, &title, &body, &until); err != nil {
+			return nil, errors.Wrap(err, "scanning a snoozed note")
+		}
+
+		n.Title = database.NoteTitle(title, body)
+		n.SnoozedUntil = time.Unix(0, until)
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+func formatSnoozedUntil(t time.Time) string {
+	return t.Local().Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+func newSnoozeRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		rowID, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Wrap(err, "parsing the note id")
+		}
+
+		val := defaultSnooze
+		if len(args) == 2 {
+			val = args[1]
+		}
+
+		until, err := parseSnooze(val, ctx.Clock.Now())
+		if err != nil {
+			return err
+		}
+
+		note, err := database.GetActiveNote(ctx.DB, rowID)
+		if err != nil {
+			return errors.Wrap(err, "getting the note")
+		}
+
+		if err := snoozeNote(ctx.DB, note.UUID, until); err != nil {
+			return err
+		}
+
+		log.Successf("snoozed the note %d until %s\n", rowID, formatSnoozedUntil(until))
+
+		return nil
+	}
+}
+
+func newSnoozedRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		notes, err := getSnoozedNotes(ctx.DB, ctx.Clock.Now())
+		if err != nil {
+			return errors.Wrap(err, "getting snoozed notes")
+		}
+
+		if output.IsJSON() {
+			return output.JSON(notes)
+		}
+
+		if len(notes) == 0 {
+			log.Infof("no notes are snoozed\n")
+			return nil
+		}
+
+		for _, n := range notes {
+			log.Plainf("%s %s %s %s\n",
+				log.ColorYellow.Sprintf("(%d)", n.RowID),
+				n.Title,
+				log.ColorGray.Sprintf("[%s]", n.BookLabel),
+				log.ColorGray.Sprintf("until %s", formatSnoozedUntil(n.SnoozedUntil)))
+		}
+
+		return nil
+	}
+}
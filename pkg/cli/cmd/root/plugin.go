@@ -0,0 +1,77 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package root
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/config"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/pkg/errors"
+)
+
+// pluginPrefix is the prefix of the names of the executables that provide external commands.
+// For instance, 'dnote foo' runs 'dnote-foo' in PATH if foo is not a built-in command.
+const pluginPrefix = "dnote-"
+
+// findPlugin returns the path to the executable that provides the command in the given
+// arguments. It returns false if the command is built in or no such executable exists.
+func findPlugin(args []string) (string, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", false
+	}
+
+	if cmd, _, err := root.Find(args); err == nil && cmd != root {
+		return "", false
+	}
+
+	path, err := exec.LookPath(pluginPrefix + args[0])
+	if err != nil {
+		return "", false
+	}
+
+	return path, true
+}
+
+// getPluginEnv returns the environment variables passed to the external commands
+func getPluginEnv(ctx context.DnoteCtx) []string {
+	return append(os.Environ(),
+		"DNOTE_DB_PATH="+ctx.DBPath,
+		"DNOTE_CONFIG_PATH="+config.GetPath(ctx),
+		"DNOTE_DATA_DIR="+ctx.Paths.Data,
+		"DNOTE_API_ENDPOINT="+ctx.APIEndpoint,
+		"DNOTE_VERSION="+ctx.Version,
+	)
+}
+
+func runPlugin(ctx context.DnoteCtx, path string, args []string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = getPluginEnv(ctx)
+
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "running %s", path)
+	}
+
+	return nil
+}
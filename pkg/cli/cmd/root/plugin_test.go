@@ -0,0 +1,78 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package root
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func TestFindPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins in the test are shell scripts")
+	}
+
+	// set up
+	dir, err := ioutil.TempDir("", "dnote-plugin")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temporary directory"))
+	}
+	defer os.RemoveAll(dir)
+
+	pluginPath := filepath.Join(dir, "dnote-hello")
+	if err := ioutil.WriteFile(pluginPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the plugin"))
+	}
+	builtinPath := filepath.Join(dir, "dnote-builtin")
+	if err := ioutil.WriteFile(builtinPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the plugin"))
+	}
+
+	origPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir)
+	defer os.Setenv("PATH", origPath)
+
+	Register(&cobra.Command{Use: "builtin", Run: func(cmd *cobra.Command, args []string) {}})
+
+	testCases := []struct {
+		args         []string
+		expectedPath string
+		expectedOk   bool
+	}{
+		{args: []string{"hello", "world"}, expectedPath: pluginPath, expectedOk: true},
+		{args: []string{"builtin"}, expectedPath: "", expectedOk: false},
+		{args: []string{"missing"}, expectedPath: "", expectedOk: false},
+		{args: []string{"--format", "json"}, expectedPath: "", expectedOk: false},
+		{args: []string{}, expectedPath: "", expectedOk: false},
+	}
+
+	for _, tc := range testCases {
+		path, ok := findPlugin(tc.args)
+
+		assert.Equal(t, path, tc.expectedPath, "path mismatch")
+		assert.Equal(t, ok, tc.expectedOk, "ok mismatch")
+	}
+}
@@ -19,9 +19,22 @@
 package root
 
 import (
+	"os"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/lock"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/pending"
 	"github.com/spf13/cobra"
 )
 
+var formatFlag string
+var dbFlag string
+var waitFlag bool
+
 var root = &cobra.Command{
 	Use:           "dnote",
 	Short:         "Dnote - a simple command line notebook",
@@ -29,12 +42,138 @@ var root = &cobra.Command{
 	SilenceUsage:  true,
 }
 
+func init() {
+	f := root.PersistentFlags()
+	f.StringVar(&formatFlag, "format", output.FormatText, "output format. Use 'json' to print JSON for 'view', 'find' and 'sync'")
+	f.StringVar(&dbFlag, "db", "", "path to the database. Overrides the DNOTE_DB_PATH environment variable")
+	f.BoolVar(&waitFlag, "wait", false, "wait for another dnote process using the database to finish, instead of failing")
+}
+
+// GetDBFlag returns the value of the --db flag in the given arguments. It is read before
+// the commands are set up, because the database is opened to set them up.
+func GetDBFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if strings.HasPrefix(arg, "--db=") {
+			return strings.TrimPrefix(arg, "--db=")
+		}
+		if arg == "--db" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
+
+// IsMigrateCmd tells if the given arguments run the migrate command, which runs the
+// local migrations itself instead of having them run when the database is opened
+func IsMigrateCmd(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			return false
+		}
+		if arg == "--db" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		return arg == "migrate"
+	}
+
+	return false
+}
+
 // Register adds a new command
 func Register(cmd *cobra.Command) {
 	root.AddCommand(cmd)
 }
 
-// Execute runs the main command
-func Execute() error {
+// reportsPending returns true if the pending changes should be checked after running
+// the command. The output of the shell completions must not be mixed with a warning,
+// and sync and status report the pending changes themselves.
+func reportsPending(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case "sync", "status", "completion", cobra.ShellCompRequestCmd:
+		return false
+	}
+
+	return true
+}
+
+// needsLock returns true if the command must hold the database lock while it runs.
+// The servers and the sync daemon run until they are stopped and would keep the other
+// commands out. The servers rely on the busy timeout of the database instead, and the
+// sync daemon takes the lock for each sync.
+func needsLock(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case "completion", cobra.ShellCompRequestCmd, "help", "version", "serve", "watch":
+		return false
+	case "sync":
+		if f := cmd.Flags().Lookup("watch"); f != nil && f.Changed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Execute runs the main command. If the command is not built in, it runs the
+// external command provided by an executable in PATH, if any.
+func Execute(ctx context.DnoteCtx) error {
+	if path, ok := findPlugin(os.Args[1:]); ok {
+		return runPlugin(ctx, path, os.Args[2:])
+	}
+
+	var l *lock.Lock
+	defer func() {
+		if l == nil {
+			return
+		}
+		if err := l.Release(); err != nil {
+			log.Debug("releasing the lock: %s\n", err.Error())
+		}
+	}()
+
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := output.SetFormat(formatFlag); err != nil {
+			return err
+		}
+
+		if !needsLock(cmd) {
+			return nil
+		}
+
+		var err error
+		l, err = lock.Acquire(ctx.DBPath, false)
+		if err == lock.ErrLocked && waitFlag {
+			log.Info("waiting for another dnote process to finish\n")
+			l, err = lock.Acquire(ctx.DBPath, true)
+		}
+
+		return err
+	}
+
+	// keep the shell completions fast by refreshing their cache after the commands
+	// that change the data, rather than when completing
+	root.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		if err := completion.Refresh(ctx); err != nil {
+			log.Debug("refreshing the completion cache: %s\n", err.Error())
+		}
+
+		if !output.IsJSON() && reportsPending(cmd) {
+			if err := pending.Check(ctx); err != nil {
+				log.Debug("checking the pending changes: %s\n", err.Error())
+			}
+		}
+	}
+
 	return root.Execute()
 }
@@ -0,0 +1,63 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package root
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+)
+
+func TestGetDBFlag(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{args: []string{"ls"}, expected: ""},
+		{args: []string{"--db", "/vault/dnote.db", "ls"}, expected: "/vault/dnote.db"},
+		{args: []string{"ls", "--db=/vault/dnote.db"}, expected: "/vault/dnote.db"},
+		{args: []string{"add", "js", "--", "--db", "/vault/dnote.db"}, expected: ""},
+		{args: []string{"ls", "--db"}, expected: ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, GetDBFlag(tc.args), tc.expected, "result mismatch")
+	}
+}
+
+func TestIsMigrateCmd(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{}, expected: false},
+		{args: []string{"ls"}, expected: false},
+		{args: []string{"migrate"}, expected: true},
+		{args: []string{"migrate", "status"}, expected: true},
+		{args: []string{"--db", "/vault/dnote.db", "migrate"}, expected: true},
+		{args: []string{"--db", "migrate", "ls"}, expected: false},
+		{args: []string{"add", "migrate"}, expected: false},
+		{args: []string{"--", "migrate"}, expected: false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, IsMigrateCmd(tc.args), tc.expected, fmt.Sprintf("result mismatch for %v", tc.args))
+	}
+}
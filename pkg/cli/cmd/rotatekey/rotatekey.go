@@ -0,0 +1,165 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package rotatekey
+
+import (
+	"github.com/dnote/dnote/pkg/cli/cmd/sync"
+	"github.com/dnote/dnote/pkg/cli/config"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Re-encrypt the metadata of the notes for a new age recipient
+ dnote rotate-key -r age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+
+ * Re-encrypt the metadata of the notes for the recipients in the config file
+ dnote rotate-key`
+
+var recipientsFlag []string
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new rotate-key command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rotate-key",
+		Short:   "Re-encrypt the synced metadata of the notes for new keys",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&recipientsFlag, "recipient", "r", []string{}, "An age recipient, or a GPG key id or email, to encrypt for. Replaces metadata.recipients. Can be given multiple times")
+
+	return cmd
+}
+
+// markNotes marks the notes that have metadata dirty so that their metadata is encrypted
+// again when they are sent on the next sync. The other notes are left alone, as sending
+// them again would only touch their edited time on the server. It returns the number of
+// the notes marked.
+func markNotes(db *database.DB) (int, error) {
+	res, err := db.Exec("UPDATE notes SET dirty = ? WHERE deleted = ? AND dirty = ? AND uuid IN (SELECT note_uuid FROM note_metadata)", true, false, false)
+	if err != nil {
+		return 0, errors.Wrap(err, "marking the notes dirty")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "counting the notes")
+	}
+
+	return int(count), nil
+}
+
+// saveRecipients replaces the recipients of the metadata in the config file
+func saveRecipients(ctx context.DnoteCtx, recipients []string) error {
+	cf, err := config.Read(ctx)
+	if err != nil {
+		return errors.Wrap(err, "reading config")
+	}
+
+	cf.Metadata.Recipients = recipients
+
+	if err := config.Write(ctx, cf); err != nil {
+		return errors.Wrap(err, "writing config")
+	}
+
+	return nil
+}
+
+// rotate marks the notes to be sent again with the metadata encrypted for the recipients,
+// tags the metadata with the new recipients, and saves them in the config file if save is
+// true. Nothing is marked if the config file cannot be written. It returns the number of
+// the notes marked.
+func rotate(ctx context.DnoteCtx, recipients []string, save bool) (int, error) {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning a transaction")
+	}
+
+	count, err := markNotes(tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := sync.RotateMetadataKeys(tx, recipients); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "tagging the new keys")
+	}
+
+	if save {
+		if err := saveRecipients(ctx, recipients); err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "saving the recipients")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "committing the transaction")
+	}
+
+	return count, nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		// the note bodies and the book labels are sent to the server as they are, and
+		// only the metadata is encrypted with keys of the user's own
+		m := ctx.Metadata
+		if m.Encryption == "" {
+			return errors.New("the metadata of the notes is not synced, and there is no key to rotate. Set metadata.encryption and metadata.recipients to sync it")
+		}
+
+		recipients := m.Recipients
+		if len(recipientsFlag) > 0 {
+			recipients = recipientsFlag
+		}
+		if len(recipients) == 0 {
+			return errors.New("no recipients to encrypt for. Give them with --recipient")
+		}
+		if _, err := crypt.NewProvider(m.Encryption, recipients, m.Identities); err != nil {
+			return errors.Wrap(err, "checking the recipients")
+		}
+
+		count, err := rotate(ctx, recipients, len(recipientsFlag) > 0)
+		if err != nil {
+			return err
+		}
+
+		log.Successf("the metadata of %d notes will be encrypted for the new keys on the next sync\n", count)
+		log.Infof("the other devices stop sending the metadata once they sync, until metadata.recipients is updated on them as well\n")
+		log.Infof("keep the old identities in metadata.identities until every device has synced, to decrypt the metadata encrypted for the old keys\n")
+
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package rotatekey
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/config"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestMarkNotes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 3, false, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 0, true, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "", 3, 5, false, true)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4 body", 4, 6, false, false)
+	for _, uuid := range []string{"n1-uuid", "n2-uuid", "n3-uuid"} {
+		if err := database.SetNoteMetadata(db, uuid, "project", "atlas"); err != nil {
+			t.Fatal(errors.Wrap(err, "setting the metadata"))
+		}
+	}
+
+	// execute
+	count, err := markNotes(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, count, 1, "count mismatch")
+
+	var n1Dirty, n2Dirty, n3Dirty, n4Dirty bool
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1Dirty)
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2Dirty)
+	database.MustScan(t, "getting n3", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n3-uuid"), &n3Dirty)
+	database.MustScan(t, "getting n4", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n4-uuid"), &n4Dirty)
+	assert.Equal(t, n1Dirty, true, "n1 dirty mismatch")
+	assert.Equal(t, n2Dirty, true, "n2 dirty mismatch")
+	assert.Equal(t, n3Dirty, false, "n3 dirty mismatch")
+	assert.Equal(t, n4Dirty, false, "n4 without metadata should not be sent again")
+}
+
+func TestRotate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		writeConfig   bool
+		expectedDirty bool
+	}{
+		{
+			name:          "config saved",
+			writeConfig:   true,
+			expectedDirty: true,
+		},
+		{
+			name:          "config not saved",
+			writeConfig:   false,
+			expectedDirty: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			// without a config file, the recipients cannot be saved
+			if tc.writeConfig {
+				if err := os.MkdirAll(filepath.Join(ctx.Paths.Config, consts.DnoteDirName), 0755); err != nil {
+					t.Fatal(errors.Wrap(err, "creating the config directory"))
+				}
+				if err := config.Write(ctx, config.Config{}); err != nil {
+					t.Fatal(errors.Wrap(err, "writing the config"))
+				}
+			}
+
+			db := ctx.DB
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 3, false, false)
+			if err := database.SetNoteMetadata(db, "n1-uuid", "project", "atlas"); err != nil {
+				t.Fatal(errors.Wrap(err, "setting the metadata"))
+			}
+
+			// execute
+			_, err := rotate(ctx, []string{"age1alice"}, true)
+
+			// test
+			assert.Equal(t, err == nil, tc.writeConfig, "error mismatch")
+
+			var dirty bool
+			var tagCount int
+			database.MustScan(t, "getting n1", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n1-uuid"), &dirty)
+			database.MustScan(t, "counting the key tags", db.QueryRow("SELECT count(*) FROM system WHERE key = ?", consts.SystemMetadataKeys), &tagCount)
+			assert.Equal(t, dirty, tc.expectedDirty, "n1 dirty mismatch")
+			assert.Equal(t, tagCount == 1, tc.expectedDirty, "the keys should be tagged only if the config is saved")
+
+			if tc.writeConfig {
+				cf, err := config.Read(ctx)
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "reading the config"))
+				}
+				assert.DeepEqual(t, cf.Metadata.Recipients, []string{"age1alice"}, "recipients mismatch")
+			}
+		})
+	}
+}
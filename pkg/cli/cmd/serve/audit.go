@@ -0,0 +1,87 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package serve
+
+import (
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var auditIntegrationFlag string
+var auditLimitFlag int
+
+var auditExample = `
+ * Show the recent changes made through the API
+ dnote serve audit
+
+ * Show the changes made by the integration 'vim'
+ dnote serve audit --integration vim`
+
+func auditPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+	if auditLimitFlag < 1 {
+		return errors.New("--limit must be positive")
+	}
+
+	return nil
+}
+
+func newAuditCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "audit",
+		Short:   "Show which integrations changed the notes through the API",
+		Example: auditExample,
+		PreRunE: auditPreRun,
+		RunE:    newAuditRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&auditIntegrationFlag, "integration", "i", "", "Only show the changes made by the integration")
+	f.IntVarP(&auditLimitFlag, "limit", "n", 20, "Maximum number of the changes to show")
+
+	return cmd
+}
+
+func newAuditRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		entries, err := listAudit(ctx.DB, auditIntegrationFlag, auditLimitFlag)
+		if err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			log.Plain("no changes\n")
+			return nil
+		}
+		for _, e := range entries {
+			if e.target == "" {
+				log.Plainf("%s  %s  %s\n", formatTime(e.createdAt), e.integration, e.action)
+			} else {
+				log.Plainf("%s  %s  %s %s\n", formatTime(e.createdAt), e.integration, e.action, e.target)
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,490 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package serve
+
+import (
+	stdCtx "context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	gosync "sync"
+
+	"github.com/dnote/dnote/pkg/cli/cmd/add"
+	"github.com/dnote/dnote/pkg/cli/cmd/find"
+	"github.com/dnote/dnote/pkg/cli/cmd/sync"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+)
+
+// defaultIntegration is the name of the integration using the token generated by the serve command
+const defaultIntegration = "default"
+
+type contextKey int
+
+const (
+	// peerKey is the context key for the name of the unix socket peer of a connection
+	peerKey contextKey = iota
+	// principalKey is the context key for the authenticated principal of a request
+	principalKey
+)
+
+// handler serves the API for the local database
+type handler struct {
+	ctx context.DnoteCtx
+	// token is the token generated by the serve command, granted the scopes
+	token  string
+	scopes []string
+	// socketScopes are the scopes granted to the unix socket peers that send no token.
+	// If nil, the peers must send a token.
+	socketScopes []string
+	mux          *http.ServeMux
+	// mu serializes the access to the database
+	mu gosync.Mutex
+}
+
+func newHandler(ctx context.DnoteCtx, token string, scopes, socketScopes []string) *handler {
+	h := &handler{
+		ctx:          ctx,
+		token:        token,
+		scopes:       scopes,
+		socketScopes: socketScopes,
+		mux:          http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("/books", h.books)
+	h.mux.HandleFunc("/notes", h.notes)
+	h.mux.HandleFunc("/notes/", h.note)
+	h.mux.HandleFunc("/search", h.search)
+	h.mux.HandleFunc("/sync", h.sync)
+
+	return h
+}
+
+// authenticate returns the principal that made the request, or false if the request
+// is not authenticated
+func (h *handler) authenticate(r *http.Request) (principal, bool, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		peer, ok := r.Context().Value(peerKey).(string)
+		if ok && h.socketScopes != nil {
+			return principal{name: peer, scopes: h.socketScopes}, true, nil
+		}
+
+		return principal{}, false, nil
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1 {
+		return principal{name: defaultIntegration, scopes: h.scopes}, true, nil
+	}
+
+	return lookupToken(h.ctx.DB, token)
+}
+
+// getRequiredScope returns the scope required to make the request
+func getRequiredScope(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/books":
+		return scopeReadBooks
+	case r.URL.Path == "/sync":
+		return scopeSync
+	case r.Method == http.MethodGet:
+		return scopeReadNotes
+	default:
+		return scopeWriteNotes
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok, err := h.authenticate(r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "authenticating"))
+		return
+	}
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	if scope := getRequiredScope(r); !p.can(scope) {
+		respondError(w, http.StatusForbidden, errors.Errorf("'%s' does not have the scope '%s'", p.name, scope))
+		return
+	}
+
+	h.mux.ServeHTTP(w, r.WithContext(stdCtx.WithValue(r.Context(), principalKey, p)))
+}
+
+// audit records the mutation made by the principal of the request. A failure is only
+// logged because the mutation has already been made.
+func (h *handler) audit(r *http.Request, action, target string) {
+	p := r.Context().Value(principalKey).(principal)
+
+	if err := recordAudit(h.ctx.DB, h.ctx.Clock, p.name, action, target); err != nil {
+		log.Errorf("%s\n", errors.Wrap(err, "recording the audit").Error())
+	}
+}
+
+func respondJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug("encoding the response: %s\n", err.Error())
+	}
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Errorf("%s\n", err.Error())
+	}
+
+	respondJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// bookInfo is the representation of a book in the API
+type bookInfo struct {
+	Label     string `json:"label"`
+	NoteCount int    `json:"note_count"`
+}
+
+func (h *handler) books(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	rows, err := h.ctx.DB.Query(`SELECT books.label, count(notes.uuid)
+	FROM books
+	LEFT JOIN notes ON notes.book_uuid = books.uuid AND notes.deleted = false
+	WHERE books.deleted = false
+	GROUP BY books.uuid
+	ORDER BY books.label ASC`)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "querying books"))
+		return
+	}
+	defer rows.Close()
+
+	ret := []bookInfo{}
+	for rows.Next() {
+		var b bookInfo
+		if err := rows.Scan(&b.Label, &b.NoteCount); err != nil {
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "scanning a book"))
+			return
+		}
+
+		ret = append(ret, b)
+	}
+
+	respondJSON(w, http.StatusOK, ret)
+}
+
+func (h *handler) notes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listNotes(w, r)
+	case http.MethodPost:
+		h.createNote(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (h *handler) listNotes(w http.ResponseWriter, r *http.Request) {
+	db := h.ctx.DB
+
+	query := `SELECT notes.rowid, books.label, notes.uuid, notes.body, notes.added_on, notes.edited_on, notes.language, notes.content_type
+	FROM notes
+	INNER JOIN books ON books.uuid = notes.book_uuid
+	WHERE notes.deleted = false`
+	args := []interface{}{}
+
+	if bookName := r.URL.Query().Get("book"); bookName != "" {
+		label, err := database.ResolveBookLabel(db, bookName, h.ctx.CaseSensitiveBooks)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "resolving the book"))
+			return
+		}
+
+		query += " AND books.label = ?"
+		args = append(args, label)
+	}
+
+	rows, err := db.Query(query+" ORDER BY notes.added_on ASC", args...)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "querying notes"))
+		return
+	}
+	defer rows.Close()
+
+	ret := []output.Note{}
+	for rows.Next() {
+		var info database.NoteInfo
+		if err := rows.Scan(&info.RowID, &info.BookLabel, &info.UUID, &info.Content, &info.AddedOn, &info.EditedOn, &info.Language, &info.ContentType); err != nil {
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "scanning a note"))
+			return
+		}
+
+		ret = append(ret, output.NewNote(info))
+	}
+
+	respondJSON(w, http.StatusOK, ret)
+}
+
+// notePayload is the request body for creating or updating a note
+type notePayload struct {
+	Book    *string `json:"book"`
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+// validateTitle returns an error if the title in the payload is invalid
+func (p notePayload) validateTitle() error {
+	if p.Title == nil {
+		return nil
+	}
+
+	return validate.NoteTitle(*p.Title)
+}
+
+func (h *handler) createNote(w http.ResponseWriter, r *http.Request) {
+	var p notePayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "decoding the payload"))
+		return
+	}
+	if p.Book == nil || p.Content == nil || *p.Content == "" {
+		respondError(w, http.StatusBadRequest, errors.New("book and content are required"))
+		return
+	}
+	if err := validate.BookName(*p.Book); err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "invalid book name"))
+		return
+	}
+	if err := p.validateTitle(); err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "invalid title"))
+		return
+	}
+
+	label, err := database.ResolveBookLabel(h.ctx.DB, *p.Book, h.ctx.CaseSensitiveBooks)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "resolving the book"))
+		return
+	}
+
+	var title string
+	if p.Title != nil {
+		title = *p.Title
+	}
+
+	rowID, err := add.WriteNote(h.ctx, label, title, *p.Content, "", "", h.ctx.Clock.Now().UnixNano())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "writing the note"))
+		return
+	}
+
+	info, err := database.GetNoteInfo(h.ctx.DB, rowID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "getting the note"))
+		return
+	}
+	h.audit(r, auditAdd, info.UUID)
+
+	h.respondNote(w, http.StatusCreated, rowID)
+}
+
+func (h *handler) respondNote(w http.ResponseWriter, status, rowID int) {
+	info, err := database.GetNoteInfo(h.ctx.DB, rowID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "getting the note"))
+		return
+	}
+
+	respondJSON(w, status, output.NewNote(info))
+}
+
+func (h *handler) note(w http.ResponseWriter, r *http.Request) {
+	rowID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/notes/"))
+	if err != nil {
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if err := thin.EnsureBody(h.ctx, rowID); err != nil {
+		respondError(w, http.StatusBadGateway, errors.Wrap(err, "getting the note body"))
+		return
+	}
+
+	note, err := database.GetActiveNote(h.ctx.DB, rowID)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, errors.Errorf("note %d not found", rowID))
+		return
+	} else if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "getting the note"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.respondNote(w, http.StatusOK, rowID)
+	case http.MethodPatch:
+		h.updateNote(w, r, note)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (h *handler) updateNote(w http.ResponseWriter, r *http.Request, note database.Note) {
+	var p notePayload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "decoding the payload"))
+		return
+	}
+	if p.Content != nil && *p.Content == "" {
+		respondError(w, http.StatusBadRequest, errors.New("content cannot be empty"))
+		return
+	}
+	if err := p.validateTitle(); err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "invalid title"))
+		return
+	}
+
+	db := h.ctx.DB
+
+	var bookUUID string
+	if p.Book != nil {
+		label, err := database.ResolveBookLabel(db, *p.Book, h.ctx.CaseSensitiveBooks)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "resolving the book"))
+			return
+		}
+
+		bookUUID, err = database.GetBookUUID(db, label)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "beginning a transaction"))
+		return
+	}
+
+	contentChanged := p.Content != nil && *p.Content != note.Body
+	bookChanged := bookUUID != "" && bookUUID != note.BookUUID
+	titleChanged := p.Title != nil && *p.Title != note.Title
+
+	if contentChanged || bookChanged || titleChanged {
+		if err := database.SaveNoteVersion(tx, h.ctx.Clock, note.UUID, database.NoteVersionEdit, h.ctx.HistoryRetention); err != nil {
+			tx.Rollback()
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "saving a version"))
+			return
+		}
+	}
+	if contentChanged {
+		if err := database.UpdateNoteContent(tx, h.ctx.Clock, note.RowID, *p.Content); err != nil {
+			tx.Rollback()
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "updating the content"))
+			return
+		}
+	}
+	if bookChanged {
+		if err := database.UpdateNoteBook(tx, h.ctx.Clock, note.RowID, bookUUID); err != nil {
+			tx.Rollback()
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "moving the note"))
+			return
+		}
+	}
+	// the title is set after the content, which may have changed the inferred title
+	if titleChanged {
+		if err := database.UpdateNoteTitle(tx, h.ctx.Clock, note.RowID, *p.Title); err != nil {
+			tx.Rollback()
+			respondError(w, http.StatusInternalServerError, errors.Wrap(err, "updating the title"))
+			return
+		}
+	}
+
+	if contentChanged || bookChanged || titleChanged {
+		p := r.Context().Value(principalKey).(principal)
+		if err := recordAudit(tx, h.ctx.Clock, p.name, auditEdit, note.UUID); err != nil {
+			tx.Rollback()
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "committing a transaction"))
+		return
+	}
+
+	h.respondNote(w, http.StatusOK, note.RowID)
+}
+
+func (h *handler) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	q := r.URL.Query()
+	keywords := q.Get("q")
+	if keywords == "" {
+		respondError(w, http.StatusBadRequest, errors.New("q is required"))
+		return
+	}
+
+	results, err := find.Search(h.ctx, keywords, q.Get("book"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, errors.Wrap(err, "searching notes"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, results)
+}
+
+func (h *handler) sync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	h.audit(r, auditSync, "")
+
+	if err := sync.Run(h.ctx); err != nil {
+		respondError(w, http.StatusBadGateway, errors.Wrap(err, "syncing"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
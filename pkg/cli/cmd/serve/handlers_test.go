@@ -0,0 +1,270 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package serve
+
+import (
+	stdCtx "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func doRequest(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the response"))
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	h := newHandler(ctx, "secret", allScopes, nil)
+
+	w := doRequest(t, h, "GET", "/books", "wrong", "")
+	assert.Equal(t, w.Code, http.StatusUnauthorized, "status mismatch for a wrong token")
+
+	w = doRequest(t, h, "GET", "/books", "secret", "")
+	assert.Equal(t, w.Code, http.StatusOK, "status mismatch for a correct token")
+}
+
+func TestNotes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "closures capture variables", 1)
+
+	h := newHandler(ctx, "secret", allScopes, nil)
+
+	t.Run("create", func(t *testing.T) {
+		w := doRequest(t, h, "POST", "/notes", "secret", `{"book": "JS", "content": "promises are eager"}`)
+		assert.Equal(t, w.Code, http.StatusCreated, "status mismatch")
+
+		var got output.Note
+		decode(t, w, &got)
+		assert.Equal(t, got.Book, "js", "book mismatch")
+		assert.Equal(t, got.Content, "promises are eager", "content mismatch")
+
+		var dirty bool
+		database.MustScan(t, "getting the note", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", got.UUID), &dirty)
+		assert.Equal(t, dirty, true, "dirty mismatch")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := doRequest(t, h, "GET", "/notes?book=js", "secret", "")
+		assert.Equal(t, w.Code, http.StatusOK, "status mismatch")
+
+		var got []output.Note
+		decode(t, w, &got)
+		assert.Equal(t, len(got), 2, "note count mismatch")
+		assert.Equal(t, got[0].UUID, "n1-uuid", "first note mismatch")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		w := doRequest(t, h, "PATCH", "/notes/1", "secret", `{"book": "css", "content": "n1 edited"}`)
+		assert.Equal(t, w.Code, http.StatusOK, "status mismatch")
+
+		var got output.Note
+		decode(t, w, &got)
+		assert.Equal(t, got.Book, "css", "book mismatch")
+		assert.Equal(t, got.Content, "n1 edited", "content mismatch")
+	})
+
+	t.Run("update to a nonexistent book", func(t *testing.T) {
+		w := doRequest(t, h, "PATCH", "/notes/1", "secret", `{"book": "go"}`)
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status mismatch")
+	})
+
+	t.Run("get nonexistent", func(t *testing.T) {
+		w := doRequest(t, h, "GET", "/notes/100", "secret", "")
+		assert.Equal(t, w.Code, http.StatusNotFound, "status mismatch")
+	})
+
+	t.Run("search", func(t *testing.T) {
+		w := doRequest(t, h, "GET", "/search?q=promises", "secret", "")
+		assert.Equal(t, w.Code, http.StatusOK, "status mismatch")
+
+		var got []map[string]interface{}
+		decode(t, w, &got)
+		assert.Equal(t, len(got), 1, "result count mismatch")
+		assert.Equal(t, got[0]["snippet"], "promises are eager", "snippet mismatch")
+	})
+}
+
+func TestScopes(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+	h := newHandler(ctx, "secret", []string{scopeReadNotes}, nil)
+
+	testCases := []struct {
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{"GET", "/notes", "", http.StatusOK},
+		{"GET", "/search?q=js", "", http.StatusOK},
+		{"GET", "/books", "", http.StatusForbidden},
+		{"POST", "/notes", `{"book": "js", "content": "c1"}`, http.StatusForbidden},
+		{"POST", "/sync", "", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		w := doRequest(t, h, tc.method, tc.path, "secret", tc.body)
+		assert.Equal(t, w.Code, tc.expected, fmt.Sprintf("status mismatch for %s %s", tc.method, tc.path))
+	}
+
+	var noteCount int
+	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	assert.Equal(t, noteCount, 0, "note count mismatch")
+}
+
+func TestIssuedToken(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+	token, err := insertToken(db, ctx.Clock, "vim", []string{scopeReadBooks, scopeWriteNotes})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "inserting a token"))
+	}
+
+	var hash string
+	database.MustScan(t, "getting the token", db.QueryRow("SELECT token_hash FROM api_tokens WHERE name = ?", "vim"), &hash)
+	assert.NotEqual(t, hash, token, "the token should not be stored as is")
+
+	_, err = insertToken(db, ctx.Clock, "vim", []string{scopeReadBooks})
+	assert.NotEqual(t, err, nil, "expected an error for a duplicate name")
+
+	h := newHandler(ctx, "secret", allScopes, nil)
+
+	w := doRequest(t, h, "GET", "/books", token, "")
+	assert.Equal(t, w.Code, http.StatusOK, "status mismatch for read:books")
+	w = doRequest(t, h, "GET", "/notes", token, "")
+	assert.Equal(t, w.Code, http.StatusForbidden, "status mismatch for read:notes")
+	w = doRequest(t, h, "POST", "/notes", token, `{"book": "js", "content": "c1"}`)
+	assert.Equal(t, w.Code, http.StatusCreated, "status mismatch for write:notes")
+
+	var got output.Note
+	decode(t, w, &got)
+
+	var integration, action, target string
+	database.MustScan(t, "getting the audit entry", db.QueryRow("SELECT integration, action, target FROM api_audit"), &integration, &action, &target)
+	assert.Equal(t, integration, "vim", "integration mismatch")
+	assert.Equal(t, action, auditAdd, "action mismatch")
+	assert.Equal(t, target, got.UUID, "target mismatch")
+
+	if err := deleteToken(db, "vim"); err != nil {
+		t.Fatal(errors.Wrap(err, "deleting the token"))
+	}
+	w = doRequest(t, h, "GET", "/books", token, "")
+	assert.Equal(t, w.Code, http.StatusUnauthorized, "status mismatch for a revoked token")
+}
+
+func TestSocketPeer(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+
+	doPeerRequest := func(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(stdCtx.WithValue(req.Context(), peerKey, "socket:42"))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		return w
+	}
+
+	t.Run("without socket scopes", func(t *testing.T) {
+		h := newHandler(ctx, "secret", allScopes, nil)
+
+		w := doPeerRequest(h, "GET", "/notes", "")
+		assert.Equal(t, w.Code, http.StatusUnauthorized, "status mismatch")
+	})
+
+	t.Run("with socket scopes", func(t *testing.T) {
+		h := newHandler(ctx, "secret", allScopes, []string{scopeReadNotes, scopeWriteNotes})
+
+		w := doPeerRequest(h, "GET", "/notes", "")
+		assert.Equal(t, w.Code, http.StatusOK, "status mismatch for read:notes")
+		w = doPeerRequest(h, "GET", "/books", "")
+		assert.Equal(t, w.Code, http.StatusForbidden, "status mismatch for read:books")
+		w = doPeerRequest(h, "PATCH", "/notes/1", `{"content": "n1 edited"}`)
+		assert.Equal(t, w.Code, http.StatusOK, "status mismatch for write:notes")
+
+		entries, err := listAudit(db, "", 10)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "listing the audit"))
+		}
+		assert.Equal(t, len(entries), 1, "audit entry count mismatch")
+		assert.Equal(t, entries[0].integration, "socket:42", "integration mismatch")
+		assert.Equal(t, entries[0].action, auditEdit, "action mismatch")
+		assert.Equal(t, entries[0].target, "n1-uuid", "target mismatch")
+	})
+
+	t.Run("without a peer", func(t *testing.T) {
+		h := newHandler(ctx, "secret", allScopes, []string{scopeReadNotes})
+
+		w := doRequest(t, h, "GET", "/notes", "", "")
+		assert.Equal(t, w.Code, http.StatusUnauthorized, "status mismatch")
+	})
+}
@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package serve
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// getPeerName returns the name of the process at the other end of a unix socket
+// connection, used to tell the integrations apart in the audit
+func getPeerName(c net.Conn) string {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return socketIntegration
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return socketIntegration
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return socketIntegration
+	}
+
+	return fmt.Sprintf("%s:%d", socketIntegration, cred.Pid)
+}
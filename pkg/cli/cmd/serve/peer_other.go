@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package serve
+
+import (
+	"net"
+)
+
+// getPeerName returns the name of the process at the other end of a unix socket
+// connection. The process cannot be identified on this platform.
+func getPeerName(c net.Conn) string {
+	return socketIntegration
+}
@@ -0,0 +1,246 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package serve
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+const (
+	// scopeReadNotes allows listing, reading and searching notes
+	scopeReadNotes = "read:notes"
+	// scopeWriteNotes allows adding and editing notes
+	scopeWriteNotes = "write:notes"
+	// scopeReadBooks allows listing books
+	scopeReadBooks = "read:books"
+	// scopeSync allows syncing with the server
+	scopeSync = "sync"
+)
+
+// allScopes is the list of all scopes, granted to the token generated by the serve command by default
+var allScopes = []string{scopeReadNotes, scopeWriteNotes, scopeReadBooks, scopeSync}
+
+// validateScopes returns an error if any of the given scopes is unknown or if none is given
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+
+	for _, s := range scopes {
+		var ok bool
+		for _, known := range allScopes {
+			if s == known {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return errors.Errorf("unknown scope '%s'. Available scopes are: %s", s, strings.Join(allScopes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// principal is the integration that made a request, and the scopes it was granted
+type principal struct {
+	name   string
+	scopes []string
+}
+
+func (p principal) can(scope string) bool {
+	for _, s := range p.scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apiToken is a named token issued to an integration
+type apiToken struct {
+	name      string
+	scopes    []string
+	createdAt int64
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken returns a random access token
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating random bytes")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// insertToken issues a new token for the integration with the given name and returns it.
+// Only the hash of the token is stored.
+func insertToken(db *database.DB, c clock.Clock, name string, scopes []string) (string, error) {
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM api_tokens WHERE name = ?", name).Scan(&count); err != nil {
+		return "", errors.Wrap(err, "checking the existing token")
+	}
+	if count > 0 {
+		return "", errors.Errorf("a token for '%s' already exists", name)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := db.Exec("INSERT INTO api_tokens (name, token_hash, scopes, created_at) VALUES (?, ?, ?, ?)",
+		name, hashToken(token), strings.Join(scopes, ","), c.Now().UnixNano()); err != nil {
+		return "", errors.Wrap(err, "inserting the token")
+	}
+
+	return token, nil
+}
+
+// lookupToken returns the integration to which the given token was issued
+func lookupToken(db *database.DB, token string) (principal, bool, error) {
+	var ret principal
+	var scopes string
+
+	err := db.QueryRow("SELECT name, scopes FROM api_tokens WHERE token_hash = ?", hashToken(token)).Scan(&ret.name, &scopes)
+	if err == sql.ErrNoRows {
+		return ret, false, nil
+	} else if err != nil {
+		return ret, false, errors.Wrap(err, "querying the token")
+	}
+
+	ret.scopes = strings.Split(scopes, ",")
+
+	return ret, true, nil
+}
+
+// listTokens returns the tokens ordered by the name of the integration
+func listTokens(db *database.DB) ([]apiToken, error) {
+	rows, err := db.Query("SELECT name, scopes, created_at FROM api_tokens ORDER BY name ASC")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying tokens")
+	}
+	defer rows.Close()
+
+	ret := []apiToken{}
+	for rows.Next() {
+		var t apiToken
+		var scopes string
+		if err := rows.Scan(&t.name, &scopes, &t.createdAt); err != nil {
+			return nil, errors.Wrap(err, "scanning a token")
+		}
+
+		t.scopes = strings.Split(scopes, ",")
+		ret = append(ret, t)
+	}
+
+	return ret, nil
+}
+
+// deleteToken revokes the token of the integration with the given name
+func deleteToken(db *database.DB, name string) error {
+	res, err := db.Exec("DELETE FROM api_tokens WHERE name = ?", name)
+	if err != nil {
+		return errors.Wrap(err, "deleting the token")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting the deleted tokens")
+	}
+	if n == 0 {
+		return errors.Errorf("token for '%s' not found", name)
+	}
+
+	return nil
+}
+
+const (
+	// auditAdd is the audit action of adding a note
+	auditAdd = "add"
+	// auditEdit is the audit action of editing a note
+	auditEdit = "edit"
+	// auditSync is the audit action of syncing with the server
+	auditSync = "sync"
+)
+
+// auditEntry is a record of a mutation made through the API
+type auditEntry struct {
+	integration string
+	action      string
+	target      string
+	createdAt   int64
+}
+
+// recordAudit records that the given integration performed the action on the target
+func recordAudit(db *database.DB, c clock.Clock, integration, action, target string) error {
+	if _, err := db.Exec("INSERT INTO api_audit (integration, action, target, created_at) VALUES (?, ?, ?, ?)",
+		integration, action, target, c.Now().UnixNano()); err != nil {
+		return errors.Wrap(err, "inserting an audit entry")
+	}
+
+	return nil
+}
+
+// listAudit returns the most recent audit entries, newest first, optionally of one integration
+func listAudit(db *database.DB, integration string, limit int) ([]auditEntry, error) {
+	query := "SELECT integration, action, target, created_at FROM api_audit"
+	args := []interface{}{}
+	if integration != "" {
+		query += " WHERE integration = ?"
+		args = append(args, integration)
+	}
+	query += " ORDER BY created_at DESC, rowid DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the audit entries")
+	}
+	defer rows.Close()
+
+	ret := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		if err := rows.Scan(&e.integration, &e.action, &e.target, &e.createdAt); err != nil {
+			return nil, errors.Wrap(err, "scanning an audit entry")
+		}
+
+		ret = append(ret, e)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,214 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package serve
+
+import (
+	stdCtx "context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// tokenFilename is the name of the file in the data directory to which the access token is written
+const tokenFilename = "serve-token"
+
+// socketIntegration is the name of the integration connecting to the unix socket without a token
+const socketIntegration = "socket"
+
+var addrFlag string
+var socketFlag string
+var scopeFlag []string
+var socketScopesFlag []string
+
+var example = `
+ * Serve the API on http://127.0.0.1:3939
+ dnote serve
+
+ * Serve the API on a unix domain socket
+ dnote serve --socket /tmp/dnote.sock
+
+ * Only allow reading notes and books with the generated token
+ dnote serve --scope read:notes,read:books
+
+ * Allow the socket peers to read notes without a token
+ dnote serve --socket /tmp/dnote.sock --socket-scopes read:notes`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	if err := validateScopes(scopeFlag); err != nil {
+		return errors.Wrap(err, "invalid --scope")
+	}
+	if cmd.Flags().Changed("socket-scopes") {
+		if socketFlag == "" {
+			return errors.New("--socket-scopes flag is only valid with --socket")
+		}
+		if err := validateScopes(socketScopesFlag); err != nil {
+			return errors.Wrap(err, "invalid --socket-scopes")
+		}
+	}
+
+	return nil
+}
+
+// NewCmd returns a new serve command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "serve",
+		Short:   "Serve an HTTP API for the local notes",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&addrFlag, "addr", "a", "127.0.0.1:3939", "Address to listen on")
+	f.StringVarP(&socketFlag, "socket", "s", "", "Path to a unix domain socket to listen on instead of the address")
+	f.StringSliceVarP(&scopeFlag, "scope", "", allScopes, "Scopes granted to the generated token")
+	f.StringSliceVarP(&socketScopesFlag, "socket-scopes", "", nil, "Scopes granted to the socket peers that send no token")
+
+	cmd.AddCommand(newTokenCmd(ctx))
+	cmd.AddCommand(newAuditCmd(ctx))
+
+	return cmd
+}
+
+// getTokenPath returns the path to the file containing the access token
+func getTokenPath(ctx context.DnoteCtx) string {
+	return filepath.Join(ctx.Paths.Data, consts.DnoteDirName, tokenFilename)
+}
+
+// generateToken generates a random access token and writes it to a file readable only by the user
+func generateToken(ctx context.DnoteCtx) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(getTokenPath(ctx), []byte(token), 0600); err != nil {
+		return "", errors.Wrap(err, "writing the token")
+	}
+
+	return token, nil
+}
+
+// removeStaleSocket removes the socket left over from the previous run at the given path.
+// Anything other than a socket at the path is left alone, so that a mistyped --socket
+// never removes a file of the user.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "checking the existing socket")
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("%s exists and is not a socket", path)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing the existing socket")
+	}
+
+	return nil
+}
+
+func listen() (net.Listener, error) {
+	if socketFlag == "" {
+		return net.Listen("tcp", addrFlag)
+	}
+
+	if err := removeStaleSocket(socketFlag); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", socketFlag)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketFlag, 0600); err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "setting the permission of the socket")
+	}
+
+	return l, nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		token, err := generateToken(ctx)
+		if err != nil {
+			return errors.Wrap(err, "generating an access token")
+		}
+		defer os.Remove(getTokenPath(ctx))
+
+		l, err := listen()
+		if err != nil {
+			return errors.Wrap(err, "listening")
+		}
+
+		var socketScopes []string
+		if cmd.Flags().Changed("socket-scopes") {
+			socketScopes = socketScopesFlag
+		}
+
+		srv := &http.Server{
+			Handler: newHandler(ctx, token, scopeFlag, socketScopes),
+			ConnContext: func(c stdCtx.Context, conn net.Conn) stdCtx.Context {
+				if socketFlag == "" {
+					return c
+				}
+
+				return stdCtx.WithValue(c, peerKey, getPeerName(conn))
+			},
+		}
+
+		// shut down on interrupt so that the token and the socket are cleaned up
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			srv.Close()
+		}()
+
+		log.Infof("serving on %s\n", l.Addr().String())
+		log.Infof("access token is saved in %s\n", getTokenPath(ctx))
+
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			return errors.Wrap(err, "serving")
+		}
+
+		return nil
+	}
+}
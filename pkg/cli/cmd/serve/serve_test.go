@@ -0,0 +1,82 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package serve
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnote-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("socket", func(t *testing.T) {
+		path := filepath.Join(dir, "dnote.sock")
+
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "listening"))
+		}
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+
+		if err := removeStaleSocket(path); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		ok, err := utils.FileExists(path)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "checking the socket"))
+		}
+		assert.Equal(t, ok, false, "the socket should be removed")
+	})
+
+	t.Run("regular file", func(t *testing.T) {
+		path := filepath.Join(dir, "notes.txt")
+		if err := ioutil.WriteFile(path, []byte("my notes"), 0644); err != nil {
+			t.Fatal(errors.Wrap(err, "writing the file"))
+		}
+
+		err := removeStaleSocket(path)
+		assert.NotEqual(t, err, nil, "error mismatch")
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the file"))
+		}
+		assert.Equal(t, string(b), "my notes", "the file should be kept")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if err := removeStaleSocket(filepath.Join(dir, "missing.sock")); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+	})
+}
@@ -0,0 +1,133 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package serve
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var tokenScopeFlag []string
+var tokenListFlag bool
+var tokenRevokeFlag bool
+
+var tokenExample = `
+ * Issue a token for an editor plugin that can read and write notes
+ dnote serve token vim --scope read:notes,write:notes
+
+ * List the tokens
+ dnote serve token --list
+
+ * Revoke the token
+ dnote serve token vim --revoke`
+
+func tokenPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return errors.New("Incorrect number of argument")
+	}
+	if tokenListFlag && tokenRevokeFlag {
+		return errors.New("--list and --revoke cannot be used together")
+	}
+	if tokenListFlag && len(args) != 0 {
+		return errors.New("--list does not take an integration name")
+	}
+	if !tokenListFlag && len(args) != 1 {
+		return errors.New("an integration name is required")
+	}
+	if !tokenListFlag && !tokenRevokeFlag {
+		if err := validateScopes(tokenScopeFlag); err != nil {
+			return errors.Wrap(err, "invalid --scope")
+		}
+		if strings.HasPrefix(args[0], socketIntegration) || args[0] == defaultIntegration {
+			return errors.Errorf("'%s' is reserved", args[0])
+		}
+	}
+
+	return nil
+}
+
+func newTokenCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "token [integration name]",
+		Short:   "Issue, list or revoke the tokens of the integrations",
+		Example: tokenExample,
+		PreRunE: tokenPreRun,
+		RunE:    newTokenRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&tokenScopeFlag, "scope", "", []string{scopeReadNotes, scopeReadBooks}, "Scopes granted to the token")
+	f.BoolVarP(&tokenListFlag, "list", "l", false, "List the tokens")
+	f.BoolVarP(&tokenRevokeFlag, "revoke", "r", false, "Revoke the token of the integration")
+
+	return cmd
+}
+
+func formatTime(ts int64) string {
+	return time.Unix(0, ts).Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+func newTokenRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if tokenListFlag {
+			tokens, err := listTokens(ctx.DB)
+			if err != nil {
+				return err
+			}
+
+			if len(tokens) == 0 {
+				log.Plain("no tokens\n")
+				return nil
+			}
+			for _, t := range tokens {
+				log.Plainf("%s: %s (issued %s)\n", t.name, strings.Join(t.scopes, ", "), formatTime(t.createdAt))
+			}
+
+			return nil
+		}
+
+		name := args[0]
+
+		if tokenRevokeFlag {
+			if err := deleteToken(ctx.DB, name); err != nil {
+				return err
+			}
+
+			log.Successf("revoked the token for '%s'\n", name)
+			return nil
+		}
+
+		token, err := insertToken(ctx.DB, ctx.Clock, name, tokenScopeFlag)
+		if err != nil {
+			return errors.Wrap(err, "issuing a token")
+		}
+
+		log.Successf("issued a token for '%s' with the scopes %s\n", name, strings.Join(tokenScopeFlag, ", "))
+		log.Plainf("%s\n", token)
+		log.Plain("The token is not shown again. Pass it in the header 'Authorization: Bearer <token>'.\n")
+
+		return nil
+	}
+}
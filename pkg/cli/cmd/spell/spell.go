@@ -0,0 +1,250 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package spell
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/config"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/spell"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// dictionaryDirName is the name of the directory under the dnote data directory
+// in which the dictionaries are looked up
+const dictionaryDirName = "dictionaries"
+
+var languageFlag string
+
+var example = `
+ * Spell check all notes
+ dnote spell
+
+ * Spell check notes in a book
+ dnote spell javascript
+
+ * Spell check notes without a language as British English
+ dnote spell -l en-GB`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	if err := validate.Language(languageFlag); err != nil {
+		return errors.Wrap(err, "invalid language")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new spell command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "spell <book name?>",
+		Short:             "Spell check notes",
+		Example:           example,
+		PreRunE:           preRun,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.BookArgs(ctx, 1),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&languageFlag, "language", "l", "en", "The language of the notes whose language is not set")
+
+	return cmd
+}
+
+// noteInfo is an information about a note to spell check
+type noteInfo struct {
+	RowID     int
+	BookLabel string
+	Body      string
+	Language  string
+}
+
+func getNotes(ctx context.DnoteCtx, bookName string) ([]noteInfo, error) {
+	query := `SELECT notes.rowid, books.label, notes.body, notes.language
+	FROM notes
+	INNER JOIN books ON books.uuid = notes.book_uuid
+	WHERE notes.deleted = false`
+	args := []interface{}{}
+
+	if bookName != "" {
+		label, err := database.ResolveBookLabel(ctx.DB, bookName, ctx.CaseSensitiveBooks)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolving the book")
+		}
+
+		bookUUID, err := database.GetBookUUID(ctx.DB, label)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding the book")
+		}
+
+		query = fmt.Sprintf("%s AND notes.book_uuid = ?", query)
+		args = append(args, bookUUID)
+	}
+
+	rows, err := ctx.DB.Query(fmt.Sprintf("%s ORDER BY books.label ASC, notes.added_on ASC", query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []noteInfo{}
+	for rows.Next() {
+		var info noteInfo
+		if err := rows.Scan(&info.RowID, &info.BookLabel, &info.Body, &info.Language); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, info)
+	}
+
+	return ret, nil
+}
+
+// getDictionaryPaths returns the candidate paths of the dictionary for the language,
+// in the order of preference. A dictionary configured in the config file takes
+// precedence over the one in the data directory. A regional language such as
+// 'en-GB' falls back to the dictionary for its primary language.
+func getDictionaryPaths(ctx context.DnoteCtx, cf config.Config, language string) []string {
+	tags := []string{language}
+	if idx := strings.Index(language, "-"); idx != -1 {
+		tags = append(tags, language[:idx])
+	}
+
+	ret := []string{}
+	for _, tag := range tags {
+		if p, ok := cf.Spell.Dictionaries[tag]; ok {
+			ret = append(ret, p)
+		}
+
+		ret = append(ret, filepath.Join(ctx.Paths.Data, consts.DnoteDirName, dictionaryDirName, fmt.Sprintf("%s.dic", tag)))
+	}
+
+	return ret
+}
+
+// loadDictionary loads the dictionary for the language. It returns nil if no
+// dictionary is found.
+func loadDictionary(ctx context.DnoteCtx, cf config.Config, language string) (spell.Dictionary, error) {
+	for _, p := range getDictionaryPaths(ctx, cf, language) {
+		ok, err := utils.FileExists(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "checking %s", p)
+		}
+		if !ok {
+			continue
+		}
+
+		dict, err := spell.LoadWordList(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading %s", p)
+		}
+
+		log.Debug("loaded the dictionary for %s from %s\n", language, p)
+
+		return dict, nil
+	}
+
+	return nil, nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		var bookName string
+		if len(args) == 1 {
+			bookName = args[0]
+		}
+
+		cf, err := config.Read(ctx)
+		if err != nil {
+			return errors.Wrap(err, "reading the config")
+		}
+
+		notes, err := getNotes(ctx, bookName)
+		if err != nil {
+			return errors.Wrap(err, "getting notes")
+		}
+
+		dicts := map[string]spell.Dictionary{}
+		missing := map[string]bool{}
+		var count, noteCount int
+
+		for _, note := range notes {
+			language := note.Language
+			if language == "" {
+				language = languageFlag
+			}
+
+			if missing[language] {
+				continue
+			}
+
+			dict, ok := dicts[language]
+			if !ok {
+				dict, err = loadDictionary(ctx, cf, language)
+				if err != nil {
+					return errors.Wrapf(err, "loading the dictionary for %s", language)
+				}
+				if dict == nil {
+					log.Warnf("no dictionary found for %s. skipping the notes in %s\n", language, language)
+					log.Plainf("  Place a word list at %s, or set one under spell.dictionaries in the config.\n", getDictionaryPaths(ctx, cf, language)[0])
+					missing[language] = true
+					continue
+				}
+
+				dicts[language] = dict
+			}
+
+			misspellings := spell.Check(note.Body, dict)
+			if len(misspellings) == 0 {
+				continue
+			}
+
+			noteCount++
+			count += len(misspellings)
+
+			log.Infof("note %d in %s\n", note.RowID, note.BookLabel)
+			for _, m := range misspellings {
+				log.Plainf("  %s %s\n", log.ColorYellow.Sprintf("line %d:", m.Line), m.Word)
+			}
+		}
+
+		if count == 0 {
+			log.Success("no misspellings found\n")
+		} else {
+			log.Infof("found %d misspellings in %d notes\n", count, noteCount)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,420 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package stats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/goal"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+var example = `
+ * See the stats
+ dnote stats
+
+ * Print the stats as JSON
+ dnote stats --format json
+
+ * Print the stats as CSV with the activity of the last 30 days
+ dnote stats --format csv --days 30
+
+ * Push the stats as JSON to a webhook every hour
+ dnote stats --push https://dashboard.example.com/hooks/dnote --every 1h`
+
+var formatFlag string
+var daysFlag int
+var pushFlag string
+var everyFlag time.Duration
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	if formatFlag != formatText && formatFlag != formatJSON && formatFlag != formatCSV {
+		return errors.Errorf("invalid format '%s'. Use 'text', 'json' or 'csv'", formatFlag)
+	}
+	if daysFlag <= 0 {
+		return errors.New("--days must be positive")
+	}
+	if cmd.Flags().Changed("every") {
+		if pushFlag == "" {
+			return errors.New("--every flag is only valid with --push")
+		}
+		if everyFlag <= 0 {
+			return errors.New("--every must be positive")
+		}
+	}
+
+	return nil
+}
+
+// NewCmd returns a new stats command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "stats",
+		Short:   "See or export the stats about the notes and the reviews",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&formatFlag, "format", "f", formatText, "the format of the stats: text, json or csv")
+	f.IntVarP(&daysFlag, "days", "", 365, "the number of the past days, including today, of which to include the activity")
+	f.StringVarP(&pushFlag, "push", "", "", "POST the stats as JSON to the given URL instead of printing them")
+	f.DurationVarP(&everyFlag, "every", "", 0, "keep running and push the stats at the given interval")
+
+	return cmd
+}
+
+// bookStats is the stats of a book
+type bookStats struct {
+	Book  string `json:"book"`
+	Notes int    `json:"notes"`
+}
+
+// dayStats is the activity on a day
+type dayStats struct {
+	Date   string `json:"date"`
+	Added  int    `json:"added"`
+	Edited int    `json:"edited"`
+}
+
+// reviewStats is the performance of the reviews
+type reviewStats struct {
+	// Reviewed is the number of the notes reviewed at least once
+	Reviewed int `json:"reviewed"`
+	// Due is the number of the reviewed notes that are due for another review
+	Due int `json:"due"`
+	// AverageEaseFactor is the average SM-2 ease factor of the reviewed notes. It goes
+	// down as the notes are recalled with difficulty.
+	AverageEaseFactor float64 `json:"average_ease_factor"`
+	// AverageInterval is the average number of days between the reviews of the reviewed notes
+	AverageInterval float64 `json:"average_interval"`
+}
+
+// stats is all the stats, in a form that can be exported
+type stats struct {
+	GeneratedAt time.Time   `json:"generated_at"`
+	Notes       int         `json:"notes"`
+	Today       int         `json:"today"`
+	ThisWeek    int         `json:"this_week"`
+	Streak      int         `json:"streak"`
+	Books       []bookStats `json:"books"`
+	Activity    []dayStats  `json:"activity"`
+	Review      reviewStats `json:"review"`
+}
+
+func getBookStats(db *database.DB) ([]bookStats, error) {
+	rows, err := db.Query(`SELECT books.label, count(notes.uuid)
+		FROM books
+		LEFT JOIN notes ON notes.book_uuid = books.uuid AND notes.deleted = ?
+		WHERE books.deleted = ?
+		GROUP BY books.uuid
+		ORDER BY books.label ASC`, false, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	ret := []bookStats{}
+	for rows.Next() {
+		var s bookStats
+		if err := rows.Scan(&s.Book, &s.Notes); err != nil {
+			return nil, errors.Wrap(err, "scanning a book")
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret, rows.Err()
+}
+
+// getActivity returns the number of the notes added and edited on each of the given
+// number of days up to the day of the given time, oldest first. The days without any
+// activity are included so that the result can be drawn as a heatmap as is.
+func getActivity(db *database.DB, now time.Time, days int) ([]dayStats, error) {
+	today := goal.StartOfDay(now)
+	start := today.AddDate(0, 0, -(days - 1))
+
+	ret := make([]dayStats, days)
+	idx := map[string]int{}
+	for i := range ret {
+		date := start.AddDate(0, 0, i).Format("2006-01-02")
+		ret[i].Date = date
+		idx[date] = i
+	}
+
+	rows, err := db.Query("SELECT added_on, edited_on FROM notes WHERE deleted = ? AND (added_on >= ? OR edited_on >= ?)", false, start.UnixNano(), start.UnixNano())
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var addedOn, editedOn int64
+		if err := rows.Scan(&addedOn, &editedOn); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		if i, ok := idx[time.Unix(0, addedOn).In(now.Location()).Format("2006-01-02")]; ok {
+			ret[i].Added++
+		}
+		if editedOn == 0 {
+			continue
+		}
+		if i, ok := idx[time.Unix(0, editedOn).In(now.Location()).Format("2006-01-02")]; ok {
+			ret[i].Edited++
+		}
+	}
+
+	return ret, rows.Err()
+}
+
+func getReviewStats(db *database.DB, now time.Time) (reviewStats, error) {
+	var ret reviewStats
+
+	err := db.QueryRow(`SELECT count(*), coalesce(sum(review_state.due_on <= ?), 0), coalesce(avg(review_state.ease_factor), 0), coalesce(avg(review_state.interval), 0)
+		FROM review_state
+		INNER JOIN notes ON notes.uuid = review_state.note_uuid
+		WHERE notes.deleted = ?`, now.UnixNano(), false).
+		Scan(&ret.Reviewed, &ret.Due, &ret.AverageEaseFactor, &ret.AverageInterval)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying the review states")
+	}
+
+	return ret, nil
+}
+
+// getStats returns the stats as of the given time, with the activity of the given
+// number of days
+func getStats(ctx context.DnoteCtx, now time.Time, days int) (stats, error) {
+	ret := stats{GeneratedAt: now.UTC()}
+
+	if err := ctx.DB.QueryRow("SELECT count(*) FROM notes WHERE deleted = ?", false).Scan(&ret.Notes); err != nil {
+		return ret, errors.Wrap(err, "counting notes")
+	}
+
+	p, err := goal.GetProgress(ctx.DB, ctx.Goal, now)
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the progress")
+	}
+	ret.Today = p.Today
+	ret.ThisWeek = p.ThisWeek
+	ret.Streak = p.Streak
+
+	ret.Books, err = getBookStats(ctx.DB)
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the book stats")
+	}
+	ret.Activity, err = getActivity(ctx.DB, now, days)
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the activity")
+	}
+	ret.Review, err = getReviewStats(ctx.DB, now)
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the review stats")
+	}
+
+	return ret, nil
+}
+
+// writeCSV writes the given stats as CSV with a row for each value, so that all stats
+// fit in a single table. The key is the book label for the per-book counts and the date
+// for the activity, and is empty otherwise.
+func writeCSV(w io.Writer, s stats) error {
+	cw := csv.NewWriter(w)
+
+	itoa := strconv.Itoa
+	ftoa := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 2, 64)
+	}
+
+	records := [][]string{
+		{"metric", "key", "value"},
+		{"notes", "", itoa(s.Notes)},
+		{"today", "", itoa(s.Today)},
+		{"this_week", "", itoa(s.ThisWeek)},
+		{"streak", "", itoa(s.Streak)},
+	}
+	for _, b := range s.Books {
+		records = append(records, []string{"book_notes", b.Book, itoa(b.Notes)})
+	}
+	for _, d := range s.Activity {
+		records = append(records, []string{"added", d.Date, itoa(d.Added)}, []string{"edited", d.Date, itoa(d.Edited)})
+	}
+	records = append(records,
+		[]string{"review_reviewed", "", itoa(s.Review.Reviewed)},
+		[]string{"review_due", "", itoa(s.Review.Due)},
+		[]string{"review_average_ease_factor", "", ftoa(s.Review.AverageEaseFactor)},
+		[]string{"review_average_interval", "", ftoa(s.Review.AverageInterval)},
+	)
+
+	if err := cw.WriteAll(records); err != nil {
+		return errors.Wrap(err, "writing CSV")
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, s stats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(s); err != nil {
+		return errors.Wrap(err, "encoding JSON")
+	}
+
+	return nil
+}
+
+func printText(s stats) {
+	log.Infof("notes: %s\n", log.ColorYellow.Sprintf("%d", s.Notes))
+	log.Infof("notes today: %s\n", log.ColorYellow.Sprintf("%d", s.Today))
+	log.Infof("notes this week: %s\n", log.ColorYellow.Sprintf("%d", s.ThisWeek))
+	log.Infof("streak: %s\n", log.ColorYellow.Sprintf("%d", s.Streak))
+
+	var added, edited int
+	for _, d := range s.Activity {
+		added += d.Added
+		edited += d.Edited
+	}
+	log.Infof("in the last %d days: %s added, %s edited\n", len(s.Activity), log.ColorYellow.Sprintf("%d", added), log.ColorYellow.Sprintf("%d", edited))
+
+	log.Infof("reviewed notes: %s (%d due, average ease factor %.2f, average interval %.1f days)\n", log.ColorYellow.Sprintf("%d", s.Review.Reviewed), s.Review.Due, s.Review.AverageEaseFactor, s.Review.AverageInterval)
+
+	log.Plainf("\n")
+	for _, b := range s.Books {
+		log.Plainf("  %s %s\n", log.ColorYellow.Sprintf("(%d)", b.Notes), b.Book)
+	}
+}
+
+// push POSTs the given stats as JSON to the given URL
+func push(url string, s stats) error {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, s); err != nil {
+		return err
+	}
+
+	hc := http.Client{Timeout: 30 * time.Second}
+	res, err := hc.Post(url, "application/json", &buf)
+	if err != nil {
+		return errors.Wrap(err, "making http request")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("the webhook responded with %s", res.Status)
+	}
+
+	return nil
+}
+
+func pushStats(ctx context.DnoteCtx) error {
+	s, err := getStats(ctx, ctx.Clock.Now(), daysFlag)
+	if err != nil {
+		return errors.Wrap(err, "getting the stats")
+	}
+
+	if err := push(pushFlag, s); err != nil {
+		return errors.Wrap(err, "pushing the stats")
+	}
+
+	return nil
+}
+
+// runSchedule pushes the stats at the interval until interrupted. A failed push is
+// reported and retried at the next tick, so that a temporary outage of the webhook does
+// not stop the schedule.
+func runSchedule(ctx context.DnoteCtx) error {
+	log.Infof("pushing the stats every %s. Press ctrl-c to stop\n", everyFlag)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	ticker := time.NewTicker(everyFlag)
+	defer ticker.Stop()
+
+	for {
+		if err := pushStats(ctx); err != nil {
+			log.Errorf("%s\n", err.Error())
+		}
+
+		select {
+		case <-sig:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if pushFlag != "" {
+			if everyFlag > 0 {
+				return runSchedule(ctx)
+			}
+
+			if err := pushStats(ctx); err != nil {
+				return err
+			}
+
+			log.Successf("pushed the stats\n")
+			return nil
+		}
+
+		s, err := getStats(ctx, ctx.Clock.Now(), daysFlag)
+		if err != nil {
+			return errors.Wrap(err, "getting the stats")
+		}
+
+		switch formatFlag {
+		case formatJSON:
+			return writeJSON(os.Stdout, s)
+		case formatCSV:
+			return writeCSV(os.Stdout, s)
+		}
+
+		printText(s)
+		return nil
+	}
+}
@@ -0,0 +1,148 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestGetStats(t *testing.T) {
+	now := time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+	day := int64(24 * time.Hour)
+	ts := now.UnixNano()
+
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1", ts, 0)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2", ts-day, ts)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3", ts-10*day, 0)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n4-uuid", "b2-uuid", "n4", ts, 0, true)
+	database.MustExec(t, "inserting r1", db, "INSERT INTO review_state (note_uuid, ease_factor, interval, repetitions, due_on, last_reviewed_on) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", 2.5, 6, 2, ts-day, ts-7*day)
+	database.MustExec(t, "inserting r3", db, "INSERT INTO review_state (note_uuid, ease_factor, interval, repetitions, due_on, last_reviewed_on) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", 2.1, 1, 1, ts+day, ts)
+	database.MustExec(t, "inserting r4", db, "INSERT INTO review_state (note_uuid, ease_factor, interval, repetitions, due_on, last_reviewed_on) VALUES (?, ?, ?, ?, ?, ?)", "n4-uuid", 1.3, 1, 1, ts-day, ts)
+
+	s, err := getStats(ctx, now, 3)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the stats"))
+	}
+
+	assert.Equal(t, s.Notes, 3, "notes mismatch")
+	assert.Equal(t, s.Today, 1, "today mismatch")
+	assert.Equal(t, s.Streak, 2, "streak mismatch")
+	assert.DeepEqual(t, s.Books, []bookStats{{Book: "css", Notes: 0}, {Book: "js", Notes: 3}}, "books mismatch")
+	assert.DeepEqual(t, s.Activity, []dayStats{
+		{Date: "2020-03-13", Added: 0, Edited: 0},
+		{Date: "2020-03-14", Added: 1, Edited: 0},
+		{Date: "2020-03-15", Added: 1, Edited: 1},
+	}, "activity mismatch")
+	assert.Equal(t, s.Review.Reviewed, 2, "reviewed mismatch")
+	assert.Equal(t, s.Review.Due, 1, "due mismatch")
+	assert.Equal(t, s.Review.AverageEaseFactor, 2.3, "average ease factor mismatch")
+	assert.Equal(t, s.Review.AverageInterval, 3.5, "average interval mismatch")
+}
+
+func TestWriteCSV(t *testing.T) {
+	s := stats{
+		Notes:    3,
+		Today:    1,
+		ThisWeek: 2,
+		Streak:   2,
+		Books:    []bookStats{{Book: "js", Notes: 3}},
+		Activity: []dayStats{{Date: "2020-03-15", Added: 1, Edited: 1}},
+		Review:   reviewStats{Reviewed: 2, Due: 1, AverageEaseFactor: 2.3, AverageInterval: 3.5},
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, s); err != nil {
+		t.Fatal(errors.Wrap(err, "writing CSV"))
+	}
+
+	expected := `metric,key,value
+notes,,3
+today,,1
+this_week,,2
+streak,,2
+book_notes,js,3
+added,2020-03-15,1
+edited,2020-03-15,1
+review_reviewed,,2
+review_due,,1
+review_average_ease_factor,,2.30
+review_average_interval,,3.50
+`
+	assert.Equal(t, buf.String(), expected, "CSV mismatch")
+}
+
+func TestPush(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var got stats
+		var contentType string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding the payload"))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer ts.Close()
+
+		if err := push(ts.URL, stats{Notes: 3, Books: []bookStats{{Book: "js", Notes: 3}}}); err != nil {
+			t.Fatal(errors.Wrap(err, "pushing"))
+		}
+
+		assert.Equal(t, contentType, "application/json", "content type mismatch")
+		assert.Equal(t, got.Notes, 3, "notes mismatch")
+		assert.DeepEqual(t, got.Books, []bookStats{{Book: "js", Notes: 3}}, "books mismatch")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer ts.Close()
+
+		err := push(ts.URL, stats{})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		assert.Equal(t, strings.Contains(err.Error(), "502"), true, "error should contain the status")
+	})
+}
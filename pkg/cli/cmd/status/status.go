@@ -0,0 +1,261 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package status
+
+import (
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/goal"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/pending"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// excerptLength is the maximum number of characters of a note body to print
+const excerptLength = 50
+
+var remoteFlag bool
+
+var example = `
+ * Show the local changes to be uploaded on the next sync
+ dnote status
+
+ * Also check the server for the changes to be downloaded
+ dnote status --remote`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new status command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status",
+		Aliases: []string{"st"},
+		Short:   "Show the changes pending sync",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&remoteFlag, "remote", "r", false, "Contact the server to check if it is reachable and if there are changes to download")
+
+	return cmd
+}
+
+// change is a dirty book or note to be uploaded on the next sync
+type change struct {
+	// Kind is either 'new', 'modified' or 'deleted'
+	Kind  string
+	RowID int
+	UUID  string
+	Label string
+}
+
+// status is the sync status of the local database
+type status struct {
+	LastSyncAt int64
+	LastMaxUSN int
+	Books      []change
+	Notes      []change
+	// Estimate is how long it will take to upload the changes
+	Estimate time.Duration
+}
+
+func getChangeKind(usn int, deleted bool) string {
+	if deleted {
+		return "deleted"
+	}
+	if usn == 0 {
+		return "new"
+	}
+
+	return "modified"
+}
+
+// getExcerpt returns the title of the note, truncated if too long
+func getExcerpt(title, body string) string {
+	ret := database.NoteTitle(title, body)
+
+	r := []rune(ret)
+	if len(r) > excerptLength {
+		ret = string(r[:excerptLength]) + "..."
+	}
+
+	return ret
+}
+
+func getStatus(ctx context.DnoteCtx) (status, error) {
+	var ret status
+	db := ctx.DB
+
+	if err := database.GetSystem(db, consts.SystemLastSyncAt, &ret.LastSyncAt); err != nil {
+		return ret, errors.Wrap(err, "getting the last sync time")
+	}
+	if err := database.GetSystem(db, consts.SystemLastMaxUSN, &ret.LastMaxUSN); err != nil {
+		return ret, errors.Wrap(err, "getting the last max usn")
+	}
+
+	bookRows, err := db.Query("SELECT rowid, uuid, label, usn, deleted FROM books WHERE dirty ORDER BY rowid ASC")
+	if err != nil {
+		return ret, errors.Wrap(err, "querying books")
+	}
+	defer bookRows.Close()
+
+	for bookRows.Next() {
+		var c change
+		var usn int
+		var deleted bool
+		if err := bookRows.Scan(&c.RowID, &c.UUID, &c.Label, &usn, &deleted); err != nil {
+			return ret, errors.Wrap(err, "scanning a book")
+		}
+
+		c.Kind = getChangeKind(usn, deleted)
+		if deleted {
+			// The labels of deleted books are overridden with random strings
+			c.Label = ""
+		}
+
+		ret.Books = append(ret.Books, c)
+	}
+
+	noteRows, err := db.Query("SELECT rowid, uuid, title, body, usn, deleted FROM notes WHERE dirty ORDER BY rowid ASC")
+	if err != nil {
+		return ret, errors.Wrap(err, "querying notes")
+	}
+	defer noteRows.Close()
+
+	for noteRows.Next() {
+		var c change
+		var title, body string
+		var usn int
+		var deleted bool
+		if err := noteRows.Scan(&c.RowID, &c.UUID, &title, &body, &usn, &deleted); err != nil {
+			return ret, errors.Wrap(err, "scanning a note")
+		}
+
+		c.Kind = getChangeKind(usn, deleted)
+		c.Label = getExcerpt(title, body)
+
+		ret.Notes = append(ret.Notes, c)
+	}
+
+	estimate, err := pending.Estimate(db, pending.Changes{Books: len(ret.Books), Notes: len(ret.Notes)})
+	if err != nil {
+		return ret, errors.Wrap(err, "estimating the sync time")
+	}
+	ret.Estimate = estimate
+
+	return ret, nil
+}
+
+func printLocal(s status) {
+	if s.LastSyncAt == 0 {
+		log.Infof("last sync: never\n")
+	} else {
+		log.Infof("last sync: %s\n", time.Unix(s.LastSyncAt, 0).Format("Jan 2, 2006 3:04pm (MST)"))
+	}
+	log.Infof("last max usn: %d\n", s.LastMaxUSN)
+
+	if len(s.Books) == 0 && len(s.Notes) == 0 {
+		log.Plainf("\nnothing to upload\n")
+		return
+	}
+
+	log.Plainf("\nchanges to be uploaded on the next sync:\n")
+	for _, c := range s.Books {
+		label := c.Label
+		if label == "" {
+			label = c.UUID
+		}
+
+		log.Plainf("  %s %s\n", log.ColorYellow.Sprintf("%-14s", c.Kind+" book:"), label)
+	}
+	for _, c := range s.Notes {
+		var desc string
+		if c.Kind == "deleted" {
+			desc = c.UUID
+		} else {
+			desc = log.ColorYellow.Sprintf("(%d)", c.RowID) + " " + c.Label
+		}
+
+		log.Plainf("  %s %s\n", log.ColorYellow.Sprintf("%-14s", c.Kind+" note:"), desc)
+	}
+
+	log.Plainf("\n%d changes. The next sync will take %s.\n", len(s.Books)+len(s.Notes), pending.FormatEstimate(s.Estimate))
+}
+
+func printRemote(ctx context.DnoteCtx, s status) {
+	if ctx.SessionKey == "" {
+		log.Infof("server: not logged in\n")
+		return
+	}
+
+	syncState, err := client.GetSyncState(ctx)
+	if err != nil {
+		log.Warnf("server: unreachable (%s)\n", err.Error())
+		return
+	}
+
+	log.Infof("server: reachable at %s\n", ctx.APIEndpoint)
+	// the usn grows with every change on the server, so that several changes to the same
+	// note or book count more than once
+	if syncState.MaxUSN > s.LastMaxUSN {
+		log.Infof("up to %d changes to be downloaded on the next sync\n", syncState.MaxUSN-s.LastMaxUSN)
+	} else {
+		log.Infof("up to date with the server\n")
+	}
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		s, err := getStatus(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting the status")
+		}
+
+		if remoteFlag {
+			printRemote(ctx, s)
+		}
+
+		printLocal(s)
+
+		p, err := goal.GetProgress(ctx.DB, ctx.Goal, ctx.Clock.Now())
+		if err != nil {
+			return errors.Wrap(err, "getting the progress towards the goals")
+		}
+		if p.HasGoal() {
+			log.Plainf("\n")
+			goal.Print(p)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package status
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/pending"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestGetStatus(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting last sync time", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastSyncAt, 1541108743)
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 8)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b1-uuid", "js", 0, true, false)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b2-uuid", "css", 3, false, false)
+	database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b3-uuid", "b3-random", 4, true, true)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 line 1\nn1 line 2", 1541108743, 0, true, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b2-uuid", "n2 body", 1541108743, 5, false, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3 body", 1541108743, 6, true, false)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n4-uuid", "b2-uuid", "", 1541108743, 7, true, true)
+
+	// execute
+	got, err := getStatus(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// test
+	expected := status{
+		LastSyncAt: 1541108743,
+		LastMaxUSN: 8,
+		Books: []change{
+			{Kind: "new", RowID: 1, UUID: "b1-uuid", Label: "js"},
+			{Kind: "deleted", RowID: 3, UUID: "b3-uuid", Label: ""},
+		},
+		Notes: []change{
+			{Kind: "new", RowID: 1, UUID: "n1-uuid", Label: "n1 line 1"},
+			{Kind: "modified", RowID: 3, UUID: "n3-uuid", Label: "n3 body"},
+			{Kind: "deleted", RowID: 4, UUID: "n4-uuid", Label: ""},
+		},
+		Estimate: 5 * pending.DefaultTimePerChange,
+	}
+	assert.DeepEqual(t, got, expected, "status mismatch")
+}
+
+func TestGetExcerpt(t *testing.T) {
+	testCases := []struct {
+		title    string
+		input    string
+		expected string
+	}{
+		{input: "foo", expected: "foo"},
+		{title: "qux", input: "foo", expected: "qux"},
+		{input: "  foo\nbar", expected: "foo"},
+		{input: "0123456789012345678901234567890123456789012345678901234", expected: "01234567890123456789012345678901234567890123456789..."},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, getExcerpt(tc.title, tc.input), tc.expected, "excerpt mismatch for "+tc.input)
+	}
+}
@@ -0,0 +1,113 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/pkg/errors"
+)
+
+// AuditIssue is a problem with a note on the server found by Audit
+type AuditIssue struct {
+	NoteUUID string
+	Problem  string
+}
+
+// AuditResult is the result of auditing the notes on the server
+type AuditResult struct {
+	// Checked is the number of the notes checked
+	Checked int
+	// Unverified is the number of the notes whose metadata could not be checked because
+	// the metadata is not synced on this device
+	Unverified int
+	Issues     []AuditIssue
+}
+
+// auditNote returns the problems with the content and the metadata of the note downloaded
+// from the server. The metadata is not checked if codec is nil.
+func auditNote(note client.SyncFragNote, c *metadataCodec) []string {
+	ret := []string{}
+
+	if err := verifyNoteChecksum(note); err != nil {
+		ret = append(ret, "the content does not match its checksum")
+	}
+	if !utf8.ValidString(note.Body) {
+		ret = append(ret, "the content is not a valid UTF-8 text")
+	}
+
+	if note.Metadata != "" && c != nil {
+		if _, err := c.decode(note.Metadata); err != nil {
+			ret = append(ret, fmt.Sprintf("the metadata cannot be decrypted: %s", errors.Cause(err).Error()))
+		}
+	}
+
+	return ret
+}
+
+// audit checks every note on the server, fetching the sync fragments from the start
+func audit(ctx context.DnoteCtx, c *metadataCodec) (AuditResult, error) {
+	var ret AuditResult
+
+	afterUSN := 0
+	for {
+		resp, err := client.GetSyncFragmentPage(ctx, afterUSN, ctx.SyncPageSize)
+		if err != nil {
+			return ret, errors.Wrapf(err, "getting the fragment after usn %d", afterUSN)
+		}
+
+		frag := resp.Fragment
+		for _, note := range frag.Notes {
+			if note.Deleted {
+				continue
+			}
+
+			ret.Checked++
+			if note.Metadata != "" && c == nil {
+				ret.Unverified++
+			}
+
+			for _, problem := range auditNote(note, c) {
+				ret.Issues = append(ret.Issues, AuditIssue{NoteUUID: note.UUID, Problem: problem})
+			}
+		}
+
+		afterUSN = frag.FragMaxUSN
+		if afterUSN == 0 || (frag.HasMore != nil && !*frag.HasMore) {
+			break
+		}
+	}
+
+	return ret, nil
+}
+
+// Audit downloads every note on the server, without writing anything locally, and checks
+// that its content matches its checksum and that its metadata can be decrypted, so that
+// a corruption is found before it is synced to this device
+func Audit(ctx context.DnoteCtx) (AuditResult, error) {
+	c, err := newMetadataCodec(ctx, ctx.DB)
+	if err != nil {
+		return AuditResult{}, errors.Wrap(err, "getting the metadata codec")
+	}
+
+	return audit(ctx, c)
+}
@@ -0,0 +1,143 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestAuditNote(t *testing.T) {
+	codec := &metadataCodec{p: fakeProvider{name: "alice"}}
+
+	testCases := []struct {
+		name     string
+		note     client.SyncFragNote
+		codec    *metadataCodec
+		expected []string
+	}{
+		{
+			name:     "intact",
+			note:     client.SyncFragNote{Body: "n1 body", Checksum: client.Checksum("n1 body"), Metadata: `alice:{"project":"atlas"}`},
+			codec:    codec,
+			expected: []string{},
+		},
+		{
+			name:     "no checksum",
+			note:     client.SyncFragNote{Body: "n1 body"},
+			codec:    codec,
+			expected: []string{},
+		},
+		{
+			name:     "checksum mismatch",
+			note:     client.SyncFragNote{Body: "n1 bodz", Checksum: client.Checksum("n1 body")},
+			codec:    codec,
+			expected: []string{"the content does not match its checksum"},
+		},
+		{
+			name:     "invalid utf-8",
+			note:     client.SyncFragNote{Body: "n1 \xff"},
+			codec:    codec,
+			expected: []string{"the content is not a valid UTF-8 text"},
+		},
+		{
+			name:     "undecryptable metadata",
+			note:     client.SyncFragNote{Body: "n1 body", Metadata: `bob:{"project":"atlas"}`},
+			codec:    codec,
+			expected: []string{"the metadata cannot be decrypted: no identity matched"},
+		},
+		{
+			name:     "metadata not synced",
+			note:     client.SyncFragNote{Body: "n1 body", Metadata: `bob:{"project":"atlas"}`},
+			codec:    nil,
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.DeepEqual(t, auditNote(tc.note, tc.codec), tc.expected, "problems mismatch")
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	hasMore := true
+	noMore := false
+	fragments := map[string]client.SyncFragment{
+		"0": {
+			FragMaxUSN: 2,
+			UserMaxUSN: 3,
+			HasMore:    &hasMore,
+			Notes: []client.SyncFragNote{
+				{UUID: "n1-uuid", USN: 1, Body: "n1 body", Checksum: client.Checksum("n1 body")},
+				{UUID: "n2-uuid", USN: 2, Body: "n2 bodz", Checksum: client.Checksum("n2 body"), Metadata: `alice:{}`},
+			},
+		},
+		"2": {
+			FragMaxUSN: 3,
+			UserMaxUSN: 3,
+			HasMore:    &noMore,
+			Notes: []client.SyncFragNote{
+				{UUID: "n3-uuid", USN: 3, Deleted: true, Checksum: "stale"},
+			},
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		frag, ok := fragments[r.URL.Query().Get("after_usn")]
+		if r.URL.Path != "/v3/sync/fragment" || r.Method != "GET" || !ok {
+			t.Fatalf("unrecognized endpoint reached Method: %s URL: %s", r.Method, r.URL.String())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(client.GetSyncFragmentResp{Fragment: frag}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	result, err := audit(ctx, nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.DeepEqual(t, result, AuditResult{
+		Checked:    2,
+		Unverified: 1,
+		Issues:     []AuditIssue{{NoteUUID: "n2-uuid", Problem: "the content does not match its checksum"}},
+	}, "result mismatch")
+}
@@ -0,0 +1,220 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"database/sql"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dnote/color"
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/lock"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// watchPollInterval is how often the sync daemon checks the database for local changes
+const watchPollInterval = 2 * time.Second
+
+// daemonLockPath returns the path to the lockfile held by the sync daemon for the
+// database at the given path, which keeps a second daemon from starting
+func daemonLockPath(dbPath string) string {
+	return dbPath + ".sync.lock"
+}
+
+// daemon syncs periodically, and soon after the local changes
+type daemon struct {
+	ctx context.DnoteCtx
+	// dirty is the number of the books and notes changed locally at the last check
+	dirty int
+	// failed is true if the last sync failed, in which case the local changes wait for
+	// the next periodic sync rather than being retried at every check
+	failed bool
+}
+
+// countDirty returns the number of the books and notes changed locally since the last sync
+func countDirty(db *database.DB) (int, error) {
+	var ret int
+	if err := db.QueryRow("SELECT (SELECT count(*) FROM books WHERE dirty) + (SELECT count(*) FROM notes WHERE dirty)").Scan(&ret); err != nil {
+		return 0, errors.Wrap(err, "counting the local changes")
+	}
+
+	return ret, nil
+}
+
+// checkChanges returns true if the local changes should be synced. The changes are
+// synced once they stop growing between two checks, so that a burst of edits is sent
+// in one sync.
+func (d *daemon) checkChanges() (bool, error) {
+	n, err := countDirty(d.ctx.DB)
+	if err != nil {
+		return false, err
+	}
+
+	ok := n > 0 && n == d.dirty && !d.failed
+	d.dirty = n
+
+	return ok, nil
+}
+
+// loadSession reads the session from the database, since the user may have logged in or
+// out after the daemon started
+func loadSession(ctx context.DnoteCtx) (context.DnoteCtx, error) {
+	ctx.SessionKey = ""
+	ctx.SessionKeyExpiry = 0
+	ctx.RefreshToken = ""
+
+	err := ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSessionKey).Scan(&ctx.SessionKey)
+	if err != nil && err != sql.ErrNoRows {
+		return ctx, errors.Wrap(err, "finding the session key")
+	}
+	err = ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSessionKeyExpiry).Scan(&ctx.SessionKeyExpiry)
+	if err != nil && err != sql.ErrNoRows {
+		return ctx, errors.Wrap(err, "finding the session key expiry")
+	}
+	err = ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemRefreshToken).Scan(&ctx.RefreshToken)
+	if err != nil && err != sql.ErrNoRows {
+		return ctx, errors.Wrap(err, "finding the refresh token")
+	}
+
+	return ctx, nil
+}
+
+// sync runs a sync for the given reason while holding the database lock. A failure is
+// logged rather than returned, so that the daemon keeps running.
+func (d *daemon) sync(reason string) {
+	log.Infof("%s: syncing %s\n", d.ctx.Clock.Now().Format(time.RFC3339), reason)
+
+	l, err := lock.Acquire(d.ctx.DBPath, false)
+	if err == lock.ErrLocked {
+		log.Infof("another dnote process is running. Retrying later\n")
+		return
+	} else if err != nil {
+		log.Errorf("taking the database lock: %s\n", err.Error())
+		return
+	}
+	defer func() {
+		if err := l.Release(); err != nil {
+			log.Debug("releasing the lock: %s\n", err.Error())
+		}
+	}()
+
+	ctx, err := loadSession(d.ctx)
+	if err != nil {
+		log.Errorf("%s\n", err.Error())
+		d.failed = true
+		return
+	}
+
+	s := newSummary(ctx.Clock.Now())
+	report := newRemovalReport()
+	syncErr := runSync(ctx, &s, &report)
+
+	// the session renewed during the sync is saved so that the next one loads it
+	if err := client.SaveSession(ctx.DB); err != nil {
+		log.Warnf("could not save the renewed session: %s\n", err.Error())
+	}
+
+	reportSync(ctx, &s, report, syncErr)
+	mirrorNotes(ctx, s, syncErr)
+
+	d.failed = syncErr != nil || s.Offline
+	if syncErr != nil {
+		log.Errorf("%s\n", syncErr.Error())
+	}
+}
+
+// openLogFile directs the messages to the file at the given path
+func openLogFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the log file")
+	}
+
+	log.SetOutput(f)
+	color.NoColor = true
+
+	return f, nil
+}
+
+// runDaemon syncs every interval and soon after the local changes until it is stopped
+// by a signal. Only one daemon runs for a database.
+func runDaemon(ctx context.DnoteCtx, interval time.Duration) error {
+	dl, err := lock.AcquireFile(daemonLockPath(ctx.DBPath), false)
+	if err == lock.ErrLocked {
+		return errors.Errorf("another sync daemon is running. Its process id is in %s", daemonLockPath(ctx.DBPath))
+	} else if err != nil {
+		return errors.Wrap(err, "taking the daemon lock")
+	}
+	defer dl.Release()
+
+	if err := dl.WritePID(); err != nil {
+		return err
+	}
+
+	if logFile != "" {
+		f, err := openLogFile(logFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	// the progress is not drawn in the log
+	quietFlag = true
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	log.Infof("%s: started the sync daemon with process id %d, syncing every %s\n", ctx.Clock.Now().Format(time.RFC3339), os.Getpid(), interval)
+
+	d := daemon{ctx: ctx}
+	d.sync("on start")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	poll := time.NewTicker(watchPollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case s := <-sig:
+			log.Infof("%s: stopped the sync daemon on %s\n", ctx.Clock.Now().Format(time.RFC3339), s)
+			return nil
+		case <-ticker.C:
+			d.sync("periodically")
+		case <-poll.C:
+			ok, err := d.checkChanges()
+			if err != nil {
+				log.Errorf("%s\n", err.Error())
+				continue
+			}
+			if ok {
+				d.sync("the local changes")
+			}
+		}
+	}
+}
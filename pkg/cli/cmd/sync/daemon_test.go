@@ -0,0 +1,105 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/lock"
+	"github.com/pkg/errors"
+)
+
+func TestDaemon_checkChanges(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "b1-label", 1, false)
+
+	d := daemon{ctx: context.DnoteCtx{DB: db}}
+	check := func(message string, expected bool) {
+		ok, err := d.checkChanges()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, message))
+		}
+		assert.Equal(t, ok, expected, message)
+	}
+
+	check("no changes", false)
+
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, dirty) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1-body", 1541108743, true)
+	check("the changes are growing", false)
+	check("the changes stopped growing", true)
+
+	database.MustExec(t, "marking b1 dirty", db, "UPDATE books SET dirty = ? WHERE uuid = ?", true, "b1-uuid")
+	check("the changes are growing again", false)
+
+	d.failed = true
+	check("the last sync failed", false)
+}
+
+func TestDaemon_syncLocked(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	ctx.DBPath = dbPath
+
+	l, err := lock.Acquire(ctx.DBPath, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "acquiring the lock"))
+	}
+	defer l.Release()
+	defer os.Remove(lock.Path(ctx.DBPath))
+
+	// execute
+	d := daemon{ctx: ctx}
+	d.sync("in a test")
+
+	// test
+	assert.Equal(t, d.failed, false, "a locked database should not fail the sync")
+}
+
+func TestLoadSession(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	ctx.SessionKey = "stale-key"
+
+	got, err := loadSession(ctx)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "loading without a session"))
+	}
+	assert.Equal(t, got.SessionKey, "", "session key mismatch before login")
+
+	database.MustExec(t, "inserting the session key", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSessionKey, "new-key")
+	database.MustExec(t, "inserting the session key expiry", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSessionKeyExpiry, 1893456000)
+
+	got, err = loadSession(ctx)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "loading after login"))
+	}
+	assert.Equal(t, got.SessionKey, "new-key", "session key mismatch after login")
+	assert.Equal(t, got.SessionKeyExpiry, int64(1893456000), "session key expiry mismatch")
+}
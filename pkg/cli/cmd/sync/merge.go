@@ -157,6 +157,7 @@ func getConflictsBookUUID(tx *database.DB) (string, error) {
 
 // noteMergeReport holds the result of a field-by-field merge of two copies of notes
 type noteMergeReport struct {
+	title    string
 	body     string
 	bookUUID string
 	editedOn int64
@@ -167,6 +168,7 @@ type noteMergeReport struct {
 func mergeNoteFields(tx *database.DB, localNote database.Note, serverNote client.SyncFragNote) (*noteMergeReport, error) {
 	if !localNote.Dirty {
 		return &noteMergeReport{
+			title:    getServerNoteTitle(serverNote),
 			body:     serverNote.Body,
 			bookUUID: serverNote.BookUUID,
 			editedOn: serverNote.EditedOn,
@@ -194,7 +196,9 @@ func mergeNoteFields(tx *database.DB, localNote database.Note, serverNote client
 		bookUUID = serverNote.BookUUID
 	}
 
+	// the local title is kept because the note is uploaded again with the merged content
 	ret := noteMergeReport{
+		title:    localNote.Title,
 		body:     body,
 		bookUUID: bookUUID,
 		editedOn: maxInt64(localNote.EditedOn, serverNote.EditedOn),
@@ -0,0 +1,255 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+// keyTagPrefix starts the line that tags the encrypted metadata with the keys it is encrypted for
+const keyTagPrefix = "dnote-keys:"
+
+// keyTag identifies the set of the recipients for which the metadata is encrypted. The
+// version is raised by every `dnote rotate-key`, so that a device finds out that the
+// metadata was encrypted for newer keys than its own. It is zero until the keys are rotated.
+type keyTag struct {
+	Version     int
+	Fingerprint string
+}
+
+// String formats the tag, such as '2:1a2b3c4d5e6f7a8b'
+func (t keyTag) String() string {
+	return fmt.Sprintf("%d:%s", t.Version, t.Fingerprint)
+}
+
+// parseKeyTag parses the tag formatted by keyTag.String
+func parseKeyTag(s string) (keyTag, error) {
+	var ret keyTag
+
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return ret, errors.Errorf("invalid key tag '%s'", s)
+	}
+	if _, err := fmt.Sscanf(parts[0], "%d", &ret.Version); err != nil {
+		return ret, errors.Errorf("invalid key tag '%s'", s)
+	}
+	ret.Fingerprint = parts[1]
+
+	return ret, nil
+}
+
+// getRecipientsFingerprint returns a short fingerprint of the set of the recipients, which
+// does not depend on their order
+func getRecipientsFingerprint(recipients []string) string {
+	sorted := append([]string{}, recipients...)
+	sort.Strings(sorted)
+
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// getSeenKeyTag returns the tag of the newest keys for which the synced metadata was
+// encrypted, as seen by this device. ok is false if no tagged metadata has been seen.
+func getSeenKeyTag(db *database.DB) (keyTag, bool, error) {
+	var val string
+	err := db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemMetadataKeys).Scan(&val)
+	if err == sql.ErrNoRows {
+		return keyTag{}, false, nil
+	} else if err != nil {
+		return keyTag{}, false, errors.Wrap(err, "getting the key tag")
+	}
+
+	t, err := parseKeyTag(val)
+	if err != nil {
+		return keyTag{}, false, err
+	}
+
+	return t, true, nil
+}
+
+// recordKeyTag records the tag if it is newer than the one seen so far
+func recordKeyTag(db *database.DB, t keyTag) error {
+	seen, ok, err := getSeenKeyTag(db)
+	if err != nil {
+		return err
+	}
+	if ok && seen.Version >= t.Version {
+		return nil
+	}
+
+	if err := database.UpsertSystem(db, consts.SystemMetadataKeys, t.String()); err != nil {
+		return errors.Wrap(err, "saving the key tag")
+	}
+
+	return nil
+}
+
+// RotateMetadataKeys records that the metadata is encrypted for the given recipients from
+// now on, with a newer tag than any seen so far, so that the devices that still encrypt
+// for other recipients stop sending the metadata.
+func RotateMetadataKeys(db *database.DB, recipients []string) error {
+	seen, ok, err := getSeenKeyTag(db)
+	if err != nil {
+		return err
+	}
+
+	fingerprint := getRecipientsFingerprint(recipients)
+	if ok && seen.Version > 0 && seen.Fingerprint == fingerprint {
+		return nil
+	}
+
+	t := keyTag{Version: seen.Version + 1, Fingerprint: fingerprint}
+	if err := database.UpsertSystem(db, consts.SystemMetadataKeys, t.String()); err != nil {
+		return errors.Wrap(err, "saving the key tag")
+	}
+
+	return nil
+}
+
+// metadataCodec encrypts and decrypts the key-value metadata of the notes, which the
+// server stores as an opaque blob
+type metadataCodec struct {
+	p crypt.Provider
+	// tag is the tag of the recipients for which the metadata is encrypted
+	tag keyTag
+	// stale is true if the metadata was encrypted for newer keys by another device
+	stale bool
+}
+
+// newMetadataCodec returns the codec for the metadata, or nil if the metadata is not synced
+func newMetadataCodec(ctx context.DnoteCtx, db *database.DB) (*metadataCodec, error) {
+	cf := ctx.Metadata
+	if cf.Encryption == "" {
+		return nil, nil
+	}
+	if len(cf.Recipients) == 0 {
+		return nil, errors.New("metadata.recipients must be configured to sync the metadata. Add them to the config file")
+	}
+
+	p, err := crypt.NewProvider(cf.Encryption, cf.Recipients, cf.Identities)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the metadata encryption")
+	}
+
+	ret := &metadataCodec{
+		p:   p,
+		tag: keyTag{Fingerprint: getRecipientsFingerprint(cf.Recipients)},
+	}
+
+	seen, ok, err := getSeenKeyTag(db)
+	if err != nil {
+		return nil, err
+	}
+	if ok && seen.Version > 0 {
+		if seen.Fingerprint == ret.tag.Fingerprint {
+			ret.tag.Version = seen.Version
+		} else {
+			ret.stale = true
+		}
+	}
+
+	return ret, nil
+}
+
+// encode encrypts the metadata and tags it with the recipients. Empty metadata is encrypted
+// as well, so that the keys removed locally are removed on the other devices.
+func (c *metadataCodec) encode(metadata map[string]string) (string, error) {
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling the metadata")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(keyTagPrefix + c.tag.String() + "\n")
+	if err := c.p.Encrypt(&buf, bytes.NewReader(b)); err != nil {
+		return "", errors.Wrap(err, "encrypting the metadata")
+	}
+
+	return buf.String(), nil
+}
+
+// splitKeyTag separates the tag from the encrypted metadata. ok is false if the metadata
+// is not tagged, as it is when sent by an older version of dnote.
+func splitKeyTag(blob string) (keyTag, string, bool) {
+	if !strings.HasPrefix(blob, keyTagPrefix) {
+		return keyTag{}, blob, false
+	}
+
+	idx := strings.Index(blob, "\n")
+	if idx == -1 {
+		return keyTag{}, blob, false
+	}
+
+	t, err := parseKeyTag(blob[len(keyTagPrefix):idx])
+	if err != nil {
+		return keyTag{}, blob, false
+	}
+
+	return t, blob[idx+1:], true
+}
+
+// decode decrypts the metadata
+func (c *metadataCodec) decode(blob string) (map[string]string, error) {
+	_, ciphertext, _ := splitKeyTag(blob)
+
+	var buf bytes.Buffer
+	if err := c.p.Decrypt(&buf, strings.NewReader(ciphertext)); err != nil {
+		return nil, errors.Wrap(err, "decrypting the metadata")
+	}
+
+	ret := map[string]string{}
+	if err := json.Unmarshal(buf.Bytes(), &ret); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling the metadata")
+	}
+
+	return ret, nil
+}
+
+// getNoteMetadataBlob returns the encrypted metadata of the note to be sent, or nil if
+// the metadata is not synced or this device encrypts it for keys older than the synced ones
+func getNoteMetadataBlob(tx *database.DB, c *metadataCodec, noteUUID string) (*string, error) {
+	if c == nil || c.stale {
+		return nil, nil
+	}
+
+	metadata, err := database.GetNoteMetadata(tx, noteUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := c.encode(metadata)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding the metadata of note %s", noteUUID)
+	}
+
+	return &blob, nil
+}
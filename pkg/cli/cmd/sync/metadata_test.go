@@ -0,0 +1,383 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+// fakeProvider is a crypt.Provider that marks the data with its name in place of encrypting
+type fakeProvider struct {
+	name string
+}
+
+func (p fakeProvider) Name() string {
+	return p.name
+}
+
+func (p fakeProvider) Encrypt(dst io.Writer, src io.Reader) error {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(append([]byte(p.name+":"), b...))
+	return err
+}
+
+func (p fakeProvider) Decrypt(dst io.Writer, src io.Reader) error {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	prefix := []byte(p.name + ":")
+	if !bytes.HasPrefix(b, prefix) {
+		return errors.New("no identity matched")
+	}
+
+	_, err = dst.Write(bytes.TrimPrefix(b, prefix))
+	return err
+}
+
+func TestMetadataCodec(t *testing.T) {
+	c := &metadataCodec{p: fakeProvider{name: "alice"}, tag: keyTag{Version: 2, Fingerprint: "a1"}}
+
+	blob, err := c.encode(map[string]string{"project": "atlas"})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encoding"))
+	}
+	assert.Equal(t, blob, "dnote-keys:2:a1\nalice:{\"project\":\"atlas\"}", "blob mismatch")
+
+	got, err := c.decode(blob)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decoding"))
+	}
+	assert.DeepEqual(t, got, map[string]string{"project": "atlas"}, "metadata mismatch")
+
+	// the metadata sent by an older version of dnote is not tagged
+	got, err = c.decode(`alice:{"project":"zephyr"}`)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the untagged metadata"))
+	}
+	assert.DeepEqual(t, got, map[string]string{"project": "zephyr"}, "untagged metadata mismatch")
+
+	empty, err := c.encode(map[string]string{})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encoding empty metadata"))
+	}
+	assert.Equal(t, empty, "dnote-keys:2:a1\nalice:{}", "empty blob mismatch")
+
+	other := &metadataCodec{p: fakeProvider{name: "bob"}}
+	if _, err := other.decode(blob); err == nil {
+		t.Error("expected an error for the metadata encrypted for another recipient")
+	}
+}
+
+func TestGetRecipientsFingerprint(t *testing.T) {
+	a := getRecipientsFingerprint([]string{"age1alice", "age1bob"})
+	b := getRecipientsFingerprint([]string{"age1bob", "age1alice"})
+	c := getRecipientsFingerprint([]string{"age1alice"})
+
+	assert.Equal(t, len(a), 16, "length mismatch")
+	assert.Equal(t, a, b, "the fingerprint should not depend on the order")
+	assert.NotEqual(t, a, c, "the fingerprints of different recipients should differ")
+}
+
+func TestNewMetadataCodec_keyTag(t *testing.T) {
+	alice := getRecipientsFingerprint([]string{"age1alice"})
+	bob := getRecipientsFingerprint([]string{"age1bob"})
+
+	testCases := []struct {
+		name     string
+		seen     string
+		expected keyTag
+		stale    bool
+	}{
+		{
+			name:     "never rotated",
+			seen:     "",
+			expected: keyTag{Version: 0, Fingerprint: alice},
+			stale:    false,
+		},
+		{
+			name:     "rotated to the own keys",
+			seen:     "3:" + alice,
+			expected: keyTag{Version: 3, Fingerprint: alice},
+			stale:    false,
+		},
+		{
+			name:     "rotated to other keys",
+			seen:     "3:" + bob,
+			expected: keyTag{Version: 0, Fingerprint: alice},
+			stale:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			ctx := context.InitTestCtx(t, paths, nil)
+			defer context.TeardownTestCtx(t, ctx)
+
+			ctx.Metadata = context.Metadata{
+				Encryption: crypt.ProviderAge,
+				Recipients: []string{"age1alice"},
+			}
+			if tc.seen != "" {
+				database.MustExec(t, "inserting the key tag", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemMetadataKeys, tc.seen)
+			}
+
+			// execute
+			c, err := newMetadataCodec(ctx, ctx.DB)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			assert.Equal(t, c.tag, tc.expected, "tag mismatch")
+			assert.Equal(t, c.stale, tc.stale, "stale mismatch")
+
+			c.p = fakeProvider{name: "alice"}
+
+			blob, err := getNoteMetadataBlob(ctx.DB, c, "n1-uuid")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting the blob"))
+			}
+			assert.Equal(t, blob == nil, tc.stale, "the metadata should not be sent only if the keys are stale")
+		})
+	}
+}
+
+func TestRotateMetadataKeys(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	alice := getRecipientsFingerprint([]string{"age1alice"})
+	bob := getRecipientsFingerprint([]string{"age1bob"})
+
+	// execute
+	if err := RotateMetadataKeys(db, []string{"age1alice"}); err != nil {
+		t.Fatal(errors.Wrap(err, "rotating"))
+	}
+	var first string
+	database.MustScan(t, "getting the key tag", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemMetadataKeys), &first)
+
+	// rotating to the same keys keeps the tag
+	if err := RotateMetadataKeys(db, []string{"age1alice"}); err != nil {
+		t.Fatal(errors.Wrap(err, "rotating again"))
+	}
+	var second string
+	database.MustScan(t, "getting the key tag", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemMetadataKeys), &second)
+
+	if err := RotateMetadataKeys(db, []string{"age1bob"}); err != nil {
+		t.Fatal(errors.Wrap(err, "rotating to other keys"))
+	}
+	var third string
+	database.MustScan(t, "getting the key tag", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemMetadataKeys), &third)
+
+	// test
+	assert.Equal(t, first, "1:"+alice, "first tag mismatch")
+	assert.Equal(t, second, "1:"+alice, "second tag mismatch")
+	assert.Equal(t, third, "2:"+bob, "third tag mismatch")
+}
+
+func TestNoteMerger_keyTag(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "b1", 1)
+	database.MustExec(t, "inserting the key tag", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemMetadataKeys, "2:a1")
+
+	codec := &metadataCodec{p: fakeProvider{name: "alice"}, tag: keyTag{Version: 2, Fingerprint: "a1"}}
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	m, err := newNoteMerger(tx, &summary{}, false, codec)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "preparing the merger"))
+	}
+
+	notes := []client.SyncFragNote{
+		{UUID: "n1-uuid", BookUUID: "b1-uuid", USN: 2, AddedOn: 1541232118, Body: "n1 body", Metadata: "dnote-keys:3:b2\nbob:{}"},
+		{UUID: "n2-uuid", BookUUID: "b1-uuid", USN: 3, AddedOn: 1541232118, Body: "n2 body", Metadata: "dnote-keys:1:a0\nalice:{}"},
+	}
+	for _, n := range notes {
+		if err := m.stepSyncNote(n); err != nil {
+			m.close()
+			tx.Rollback()
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+	}
+	if err := m.flush(); err != nil {
+		m.close()
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "flushing"))
+	}
+	m.close()
+	tx.Commit()
+
+	// test
+	var val string
+	database.MustScan(t, "getting the key tag", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemMetadataKeys), &val)
+	assert.Equal(t, val, "3:b2", "key tag mismatch")
+}
+
+func TestNoteMerger_metadata(t *testing.T) {
+	codec := &metadataCodec{p: fakeProvider{name: "alice"}}
+
+	testCases := []struct {
+		name       string
+		full       bool
+		localDirty bool
+		blob       string
+		expected   map[string]string
+	}{
+		{
+			name:     "step sync",
+			blob:     `alice:{"project":"zephyr"}`,
+			expected: map[string]string{"project": "zephyr"},
+		},
+		{
+			name:     "full sync",
+			full:     true,
+			blob:     `alice:{"project":"zephyr"}`,
+			expected: map[string]string{"project": "zephyr"},
+		},
+		{
+			name:       "dirty locally",
+			localDirty: true,
+			blob:       `alice:{"project":"zephyr"}`,
+			expected:   map[string]string{"project": "atlas"},
+		},
+		{
+			name:     "no metadata on server",
+			blob:     "",
+			expected: map[string]string{"project": "atlas"},
+		},
+		{
+			name:     "another recipient",
+			blob:     `bob:{"project":"zephyr"}`,
+			expected: map[string]string{"project": "atlas"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// set up
+			db := database.InitTestDB(t, dbPath, nil)
+			defer database.TeardownTestDB(t, db)
+
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "b1", 1)
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1541232118, 2, tc.localDirty)
+			database.MustExec(t, "inserting n1 metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)", "n1-uuid", "project", "atlas")
+
+			// execute
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "beginning a transaction"))
+			}
+
+			m, err := newNoteMerger(tx, &summary{}, tc.full, codec)
+			if err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "preparing the merger"))
+			}
+
+			n := client.SyncFragNote{UUID: "n1-uuid", BookUUID: "b1-uuid", USN: 3, AddedOn: 1541232118, Body: "n1 body", Metadata: tc.blob}
+			if tc.full {
+				err = m.fullSyncNote(n)
+			} else {
+				err = m.stepSyncNote(n)
+			}
+			if err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "merging"))
+			}
+			m.close()
+
+			tx.Commit()
+
+			// test
+			got, err := database.GetNoteMetadata(db, "n1-uuid")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting the metadata"))
+			}
+			assert.DeepEqual(t, got, tc.expected, "metadata mismatch")
+		})
+	}
+}
+
+func TestNoteMerger_metadataInsert(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "b1", 1)
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	m, err := newNoteMerger(tx, &summary{}, true, &metadataCodec{p: fakeProvider{name: "alice"}})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "preparing the merger"))
+	}
+
+	n := client.SyncFragNote{UUID: "n1-uuid", BookUUID: "b1-uuid", USN: 3, AddedOn: 1541232118, Body: "n1 body", Metadata: `alice:{"project":"atlas"}`}
+	if err := m.fullSyncNote(n); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "merging"))
+	}
+	if err := m.flush(); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "flushing"))
+	}
+	m.close()
+
+	tx.Commit()
+
+	// test
+	got, err := database.GetNoteMetadata(db, "n1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the metadata"))
+	}
+	assert.DeepEqual(t, got, map[string]string{"project": "atlas"}, "metadata mismatch")
+}
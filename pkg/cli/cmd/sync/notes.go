@@ -0,0 +1,301 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"database/sql"
+
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// pendingNoteLimit is the number of new notes held in memory before they are inserted
+const pendingNoteLimit = 500
+
+// localNoteState is the state of a local note that decides how the server copy is merged
+type localNoteState struct {
+	usn     int
+	dirty   bool
+	deleted bool
+	author  string
+}
+
+// noteMerger merges the notes from the server into the local database. The statements run
+// for every note are prepared once, and the new notes are inserted in batches.
+type noteMerger struct {
+	tx *database.DB
+	s  *summary
+
+	selectStmt *sql.Stmt
+	authorStmt *sql.Stmt
+
+	// local holds the state of all local notes for a full sync, in which most of the notes
+	// from the server are up to date. It is nil for a step sync, which looks up the notes.
+	local map[string]localNoteState
+
+	// pending are the new notes to be inserted, pendingAuthors the authors of the ones in
+	// team books, and pendingMetadata the encrypted metadata of the ones that have it
+	pending         []database.Note
+	pendingAuthors  map[string]string
+	pendingMetadata map[string]string
+
+	// codec decrypts the metadata of the notes. It is nil if the metadata is not synced.
+	codec *metadataCodec
+}
+
+// newNoteMerger prepares the statements for merging notes in the transaction. If full is
+// true, the state of the local notes is loaded up front.
+func newNoteMerger(tx *database.DB, s *summary, full bool, codec *metadataCodec) (*noteMerger, error) {
+	ret := &noteMerger{
+		tx:              tx,
+		s:               s,
+		pendingAuthors:  map[string]string{},
+		pendingMetadata: map[string]string{},
+		codec:           codec,
+	}
+
+	var err error
+	ret.selectStmt, err = tx.Prepare("SELECT title, body, usn, book_uuid, dirty, deleted, trashed_on, author FROM notes WHERE uuid = ?")
+	if err != nil {
+		return nil, errors.Wrap(err, "preparing the note query")
+	}
+	ret.authorStmt, err = tx.Prepare("UPDATE notes SET author = ? WHERE uuid = ?")
+	if err != nil {
+		ret.close()
+		return nil, errors.Wrap(err, "preparing the author update")
+	}
+
+	if full {
+		ret.local, err = loadLocalNoteStates(tx)
+		if err != nil {
+			ret.close()
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// loadLocalNoteStates reads the state of all local notes
+func loadLocalNoteStates(tx *database.DB) (map[string]localNoteState, error) {
+	rows, err := tx.Query("SELECT uuid, usn, dirty, deleted, author FROM notes")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying local notes")
+	}
+	defer rows.Close()
+
+	ret := map[string]localNoteState{}
+	for rows.Next() {
+		var uuid string
+		var st localNoteState
+		if err := rows.Scan(&uuid, &st.usn, &st.dirty, &st.deleted, &st.author); err != nil {
+			return nil, errors.Wrap(err, "scanning a local note")
+		}
+
+		ret[uuid] = st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading local notes")
+	}
+
+	return ret, nil
+}
+
+// close releases the prepared statements
+func (m *noteMerger) close() {
+	if m.selectStmt != nil {
+		m.selectStmt.Close()
+	}
+	if m.authorStmt != nil {
+		m.authorStmt.Close()
+	}
+}
+
+// getLocalNote returns the local copy of the note and its author. It returns sql.ErrNoRows
+// if the note does not exist locally.
+func (m *noteMerger) getLocalNote(uuid string) (database.Note, string, error) {
+	var ret database.Note
+	var author string
+
+	err := m.selectStmt.QueryRow(uuid).
+		Scan(&ret.Title, &ret.Body, &ret.USN, &ret.BookUUID, &ret.Dirty, &ret.Deleted, &ret.TrashedOn, &author)
+	if err != nil {
+		return ret, "", err
+	}
+
+	ret.UUID = uuid
+
+	return ret, author, nil
+}
+
+// insert queues the note, which does not exist locally, to be inserted
+func (m *noteMerger) insert(n client.SyncFragNote) error {
+	m.pending = append(m.pending, newLocalNote(n))
+	if n.Author != "" {
+		m.pendingAuthors[n.UUID] = n.Author
+	}
+	if n.Metadata != "" {
+		m.pendingMetadata[n.UUID] = n.Metadata
+	}
+
+	m.s.Local.Created++
+	tracef(traceDecision, "note %s: inserted because it does not exist locally\n", n.UUID)
+
+	if len(m.pending) >= pendingNoteLimit {
+		return m.flush()
+	}
+
+	return nil
+}
+
+// updateAuthor sets the author of the local note if it changed
+func (m *noteMerger) updateAuthor(n client.SyncFragNote, localAuthor string) error {
+	if n.Author == localAuthor {
+		return nil
+	}
+
+	if _, err := m.authorStmt.Exec(n.Author, n.UUID); err != nil {
+		return errors.Wrapf(err, "updating the author of local note %s", n.UUID)
+	}
+
+	return nil
+}
+
+// flush inserts the pending notes
+func (m *noteMerger) flush() error {
+	if len(m.pending) == 0 {
+		return nil
+	}
+
+	if err := database.InsertNotes(m.tx, m.pending); err != nil {
+		return errors.Wrap(err, "inserting notes")
+	}
+	for uuid, author := range m.pendingAuthors {
+		if _, err := m.authorStmt.Exec(author, uuid); err != nil {
+			return errors.Wrapf(err, "updating the author of local note %s", uuid)
+		}
+	}
+	for uuid, blob := range m.pendingMetadata {
+		if err := m.applyMetadata(uuid, blob); err != nil {
+			return err
+		}
+	}
+
+	// a note changed on the server while the fragments are pulled can come again in a
+	// later fragment, and must then be merged rather than inserted
+	if m.local != nil {
+		for _, n := range m.pending {
+			m.local[n.UUID] = localNoteState{usn: n.USN, deleted: n.Deleted, author: m.pendingAuthors[n.UUID]}
+		}
+	}
+
+	m.pending = nil
+	m.pendingAuthors = map[string]string{}
+	m.pendingMetadata = map[string]string{}
+
+	return nil
+}
+
+// applyMetadata replaces the metadata of the local note with the encrypted metadata from
+// the server. The metadata that cannot be decrypted, such as the one encrypted for other
+// recipients, is skipped with a warning.
+func (m *noteMerger) applyMetadata(noteUUID, blob string) error {
+	if m.codec == nil || blob == "" {
+		return nil
+	}
+
+	if t, _, ok := splitKeyTag(blob); ok {
+		if err := recordKeyTag(m.tx, t); err != nil {
+			return errors.Wrap(err, "recording the keys of the metadata")
+		}
+	}
+
+	metadata, err := m.codec.decode(blob)
+	if err != nil {
+		log.Warnf("skipping the metadata of note %s: %s\n", noteUUID, err.Error())
+		return nil
+	}
+
+	if err := database.ReplaceNoteMetadata(m.tx, noteUUID, metadata); err != nil {
+		return errors.Wrapf(err, "replacing the metadata of local note %s", noteUUID)
+	}
+
+	return nil
+}
+
+// stepSyncNote merges the note changed on the server since the last sync
+func (m *noteMerger) stepSyncNote(n client.SyncFragNote) error {
+	localNote, localAuthor, err := m.getLocalNote(n.UUID)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrapf(err, "getting local note %s", n.UUID)
+	}
+
+	tracef(traceDetail, "note %s: server usn %d. local usn %d, dirty %t, deleted %t\n", n.UUID, n.USN, localNote.USN, localNote.Dirty, localNote.Deleted)
+
+	// if note exists in the server and does not exist in the client, insert the note.
+	if err == sql.ErrNoRows {
+		return m.insert(n)
+	}
+
+	if err := mergeNote(m.tx, n, localNote, m.s); err != nil {
+		return errors.Wrap(err, "merging local note")
+	}
+	// the local metadata changed since the last sync is sent to the server instead
+	if !localNote.Dirty {
+		if err := m.applyMetadata(n.UUID, n.Metadata); err != nil {
+			return err
+		}
+	}
+
+	return m.updateAuthor(n, localAuthor)
+}
+
+// fullSyncNote merges the note on the server with the local copy, if the server copy is newer
+func (m *noteMerger) fullSyncNote(n client.SyncFragNote) error {
+	st, ok := m.local[n.UUID]
+
+	tracef(traceDetail, "note %s: server usn %d. local usn %d, dirty %t, deleted %t\n", n.UUID, n.USN, st.usn, st.dirty, st.deleted)
+
+	// if note exists in the server and does not exist in the client, insert the note.
+	if !ok {
+		return m.insert(n)
+	}
+
+	if n.USN > st.usn {
+		localNote, _, err := m.getLocalNote(n.UUID)
+		if err != nil {
+			return errors.Wrapf(err, "getting local note %s", n.UUID)
+		}
+
+		if err := mergeNote(m.tx, n, localNote, m.s); err != nil {
+			return errors.Wrap(err, "merging local note")
+		}
+		if !localNote.Dirty {
+			if err := m.applyMetadata(n.UUID, n.Metadata); err != nil {
+				return err
+			}
+		}
+	} else {
+		tracef(traceDecision, "note %s: skipped because the local copy is up to date\n", n.UUID)
+	}
+
+	return m.updateAuthor(n, st.author)
+}
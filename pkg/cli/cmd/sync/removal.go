@@ -0,0 +1,171 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// reasonExpunged is the reason for removing an item that was expunged on the server
+	reasonExpunged = "expunged on the server"
+	// reasonBookExpunged is the reason for removing a note whose book was expunged on the server
+	reasonBookExpunged = "its book was expunged on the server"
+	// reasonInvalid is the reason for removing an item that was uploaded before but is not on the server
+	reasonInvalid = "not found on the server although it was uploaded before"
+)
+
+// removedNote is a note removed from the local database by the sync
+type removedNote struct {
+	UUID      string `json:"uuid"`
+	BookLabel string `json:"book"`
+	Title     string `json:"title"`
+	Body      string `json:"content"`
+	Reason    string `json:"reason"`
+}
+
+// removedBook is a book removed from the local database by the sync
+type removedBook struct {
+	UUID   string `json:"uuid"`
+	Label  string `json:"label"`
+	Reason string `json:"reason"`
+}
+
+// removalReport is a list of the books and notes removed from the local database by the sync.
+// Items that had already been deleted locally are not reported.
+type removalReport struct {
+	Books []removedBook `json:"books"`
+	Notes []removedNote `json:"notes"`
+}
+
+func newRemovalReport() removalReport {
+	return removalReport{
+		Books: []removedBook{},
+		Notes: []removedNote{},
+	}
+}
+
+func (r *removalReport) isEmpty() bool {
+	return len(r.Books) == 0 && len(r.Notes) == 0
+}
+
+// addNote records the note with the given uuid as removed. It must be called before the note is deleted.
+func (r *removalReport) addNote(tx *database.DB, uuid, reason string) error {
+	var n removedNote
+	var deleted bool
+
+	err := tx.QueryRow(`SELECT notes.title, notes.body, notes.deleted, IFNULL(books.label, '')
+	FROM notes LEFT JOIN books ON books.uuid = notes.book_uuid
+	WHERE notes.uuid = ?`, uuid).Scan(&n.Title, &n.Body, &deleted, &n.BookLabel)
+	if err == sql.ErrNoRows || (err == nil && deleted) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "getting the note %s", uuid)
+	}
+
+	n.UUID = uuid
+	n.Reason = reason
+	r.Notes = append(r.Notes, n)
+
+	return nil
+}
+
+// addBook records the book with the given uuid as removed. It must be called before the book is deleted.
+func (r *removalReport) addBook(tx *database.DB, uuid, reason string) error {
+	var b removedBook
+	var deleted bool
+
+	err := tx.QueryRow("SELECT label, deleted FROM books WHERE uuid = ?", uuid).Scan(&b.Label, &deleted)
+	if err == sql.ErrNoRows || (err == nil && deleted) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "getting the book %s", uuid)
+	}
+
+	b.UUID = uuid
+	b.Reason = reason
+	r.Books = append(r.Books, b)
+
+	return nil
+}
+
+// addBookNotes records the notes in the book with the given uuid as removed. It must be called
+// before the notes are deleted.
+func (r *removalReport) addBookNotes(tx *database.DB, bookUUID, reason string) error {
+	rows, err := tx.Query(`SELECT notes.uuid, notes.title, notes.body, books.label
+	FROM notes INNER JOIN books ON books.uuid = notes.book_uuid
+	WHERE notes.book_uuid = ? AND notes.deleted = ?`, bookUUID, false)
+	if err != nil {
+		return errors.Wrapf(err, "getting the notes in the book %s", bookUUID)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n := removedNote{Reason: reason}
+		if err := rows.Scan(&n.UUID, &n.Title, &n.Body, &n.BookLabel); err != nil {
+			return errors.Wrap(err, "scanning a note")
+		}
+
+		r.Notes = append(r.Notes, n)
+	}
+
+	return nil
+}
+
+// getNoteExcerpt returns the title of the note
+func getNoteExcerpt(n removedNote) string {
+	return database.NoteTitle(n.Title, n.Body)
+}
+
+// print prints the summary of the removed items
+func (r *removalReport) print() {
+	log.Infof("removed %d books and %d notes from this device:\n", len(r.Books), len(r.Notes))
+
+	for _, b := range r.Books {
+		log.Plainf("  book %s: %s\n", log.ColorYellow.Sprint(b.Label), b.Reason)
+	}
+	for _, n := range r.Notes {
+		log.Plainf("  note %s in %s: %s\n", log.ColorGray.Sprintf("%q", getNoteExcerpt(n)), log.ColorYellow.Sprint(n.BookLabel), n.Reason)
+	}
+}
+
+// save writes the bodies of the removed notes to a file at the given path so that they can be recovered
+func (r *removalReport) save(path string) error {
+	var buf strings.Builder
+
+	for _, n := range r.Notes {
+		buf.WriteString(fmt.Sprintf("# %s (%s)\n", n.BookLabel, n.UUID))
+		buf.WriteString(fmt.Sprintf("reason: %s\n\n", n.Reason))
+		buf.WriteString(n.Body)
+		buf.WriteString("\n\n")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(buf.String()), 0600); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestRemovalReport(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b1-uuid", "b1-label", 1, false, false)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b2-uuid", "b2-label", 2, false, false)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 3, "n1 body", 1541108743, false, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b2-uuid", 4, "n2 body", 1541108743, false, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", 5, "", 1541108743, true, false)
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	var report removalReport
+	if err := syncDeleteNote(tx, "n1-uuid", &report); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "deleting note").Error())
+	}
+	if err := syncDeleteBook(tx, "b2-uuid", &report); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "deleting book").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.DeepEqual(t, report.Books, []removedBook{
+		{UUID: "b2-uuid", Label: "b2-label", Reason: reasonExpunged},
+	}, "books mismatch")
+	assert.DeepEqual(t, report.Notes, []removedNote{
+		{UUID: "n1-uuid", BookLabel: "b1-label", Body: "n1 body", Reason: reasonExpunged},
+		{UUID: "n2-uuid", BookLabel: "b2-label", Body: "n2 body", Reason: reasonBookExpunged},
+	}, "notes mismatch")
+
+	p := "../../tmp/recovery.txt"
+	if err := report.save(p); err != nil {
+		t.Fatal(errors.Wrap(err, "saving").Error())
+	}
+	defer os.Remove(p)
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the recovery file").Error())
+	}
+
+	expected := `# b1-label (n1-uuid)
+reason: expunged on the server
+
+n1 body
+
+# b2-label (n2-uuid)
+reason: its book was expunged on the server
+
+n2 body
+
+`
+	assert.Equal(t, string(b), expected, "recovery file mismatch")
+}
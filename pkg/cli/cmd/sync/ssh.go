@@ -0,0 +1,179 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// sshCommand is the ssh client that opens the tunnels
+var sshCommand = "ssh"
+
+const (
+	// tunnelTimeout is how long to wait for an SSH tunnel to accept connections
+	tunnelTimeout = 30 * time.Second
+	// tunnelPollInterval is how often to check if an SSH tunnel accepts connections
+	tunnelPollInterval = 100 * time.Millisecond
+)
+
+// sshTunnel is an SSH local forward from a port on this device to the server
+type sshTunnel struct {
+	// Addr is the local address that connects to the server
+	Addr string
+	cmd  *exec.Cmd
+	done chan error
+}
+
+// getForwardTarget returns the host and port of the API endpoint, as seen from the SSH host
+func getForwardTarget(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing the endpoint")
+	}
+	if u.Hostname() == "" {
+		return "", errors.Errorf("the endpoint '%s' has no host", endpoint)
+	}
+
+	port := u.Port()
+	if port == "" {
+		if u.Scheme == "http" {
+			port = "80"
+		} else {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// getFreePort returns a port on the loopback interface that is not in use
+func getFreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, errors.Wrap(err, "listening on a free port")
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// newSSHCmd returns the ssh command that forwards the given local port to the target
+// through the destination, such as 'user@bastion'. The settings in the ssh config,
+// such as the keys and the jump hosts, apply.
+func newSSHCmd(destination string, localPort int, target string) *exec.Cmd {
+	forward := net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)) + ":" + target
+
+	return exec.Command(sshCommand,
+		"-N",
+		"-o", "ExitOnForwardFailure=yes",
+		"-L", forward,
+		destination,
+	)
+}
+
+// openSSHTunnel forwards a local port to the API endpoint through the destination, and
+// waits until the tunnel accepts connections
+func openSSHTunnel(destination, endpoint string) (*sshTunnel, error) {
+	target, err := getForwardTarget(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the server address")
+	}
+
+	port, err := getFreePort()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := newSSHCmd(destination, port, target)
+	// let ssh prompt for passwords and print its errors
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "starting ssh")
+	}
+
+	t := &sshTunnel{
+		Addr: net.JoinHostPort("127.0.0.1", strconv.Itoa(port)),
+		cmd:  cmd,
+		done: make(chan error, 1),
+	}
+	go func() {
+		t.done <- cmd.Wait()
+	}()
+
+	if err := t.wait(tunnelTimeout); err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	log.Debug("opened an SSH tunnel from %s to %s through %s\n", t.Addr, target, destination)
+
+	return t, nil
+}
+
+// wait waits until the tunnel accepts connections, or fails if ssh exits first
+func (t *sshTunnel) wait(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		select {
+		case err := <-t.done:
+			t.done <- err
+			return errors.Errorf("ssh exited before the tunnel was ready: %v", err)
+		default:
+		}
+
+		conn, err := net.DialTimeout("tcp", t.Addr, tunnelPollInterval)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errors.Errorf("the SSH tunnel was not ready in %s", timeout)
+		}
+
+		time.Sleep(tunnelPollInterval)
+	}
+}
+
+// Close tears down the tunnel
+func (t *sshTunnel) Close() error {
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+
+	if err := t.cmd.Process.Kill(); err != nil {
+		return errors.Wrap(err, "stopping ssh")
+	}
+	<-t.done
+
+	return nil
+}
@@ -0,0 +1,72 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestGetForwardTarget(t *testing.T) {
+	testCases := []struct {
+		endpoint string
+		expected string
+	}{
+		{endpoint: "https://dnote.internal/api", expected: "dnote.internal:443"},
+		{endpoint: "http://10.0.0.5/api", expected: "10.0.0.5:80"},
+		{endpoint: "http://dnote.internal:3000/api", expected: "dnote.internal:3000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			got, err := getForwardTarget(tc.endpoint)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			assert.Equal(t, got, tc.expected, "target mismatch")
+		})
+	}
+}
+
+func TestNewSSHCmd(t *testing.T) {
+	cmd := newSSHCmd("alice@bastion", 51234, "dnote.internal:443")
+
+	assert.DeepEqual(t, cmd.Args, []string{
+		"ssh", "-N", "-o", "ExitOnForwardFailure=yes", "-L", "127.0.0.1:51234:dnote.internal:443", "alice@bastion",
+	}, "args mismatch")
+}
+
+func TestOpenSSHTunnel_sshExits(t *testing.T) {
+	sshCommand = "false"
+	defer func() { sshCommand = "ssh" }()
+
+	start := time.Now()
+	_, err := openSSHTunnel("alice@bastion", "https://dnote.internal/api")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assert.Equal(t, strings.HasPrefix(err.Error(), "ssh exited before the tunnel was ready"), true, "error mismatch")
+	assert.Equal(t, time.Since(start) < tunnelTimeout, true, "waited for the timeout")
+}
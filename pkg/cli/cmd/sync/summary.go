@@ -0,0 +1,148 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pullCounts is the number of the items received from the server
+type pullCounts struct {
+	Books         int `json:"books"`
+	Notes         int `json:"notes"`
+	ExpungedBooks int `json:"expunged_books"`
+	ExpungedNotes int `json:"expunged_notes"`
+}
+
+// pushCounts is the number of the items sent to the server
+type pushCounts struct {
+	Books int `json:"books"`
+	Notes int `json:"notes"`
+}
+
+// localChanges is the number of the notes created, updated and deleted on this device
+// by the changes from the server
+type localChanges struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// removedItems is the uuids of the items removed from this device. The note bodies are
+// left out so that the summary can be handed to the monitoring tools.
+type removedItems struct {
+	Books []string `json:"books"`
+	Notes []string `json:"notes"`
+}
+
+// durations is the time taken by the sync and its steps, in milliseconds
+type durations struct {
+	Total int64 `json:"total_ms"`
+	Pull  int64 `json:"pull_ms"`
+	Push  int64 `json:"push_ms"`
+}
+
+// summary is the result of a sync written to the summary file for the external tools
+type summary struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Success    bool      `json:"success"`
+	// Error is the error that stopped the sync, if any
+	Error   string `json:"error"`
+	Offline bool   `json:"offline"`
+	// FullSync is true if a full sync was performed rather than a step sync
+	FullSync bool       `json:"full_sync"`
+	Pulled   pullCounts `json:"pulled"`
+	Pushed   pushCounts `json:"pushed"`
+	// Conflicts is the number of the notes changed both locally and on the server
+	Conflicts int          `json:"conflicts"`
+	Local     localChanges `json:"local"`
+	Removed   removedItems `json:"removed"`
+	Durations durations    `json:"durations"`
+}
+
+func newSummary(startedAt time.Time) summary {
+	return summary{
+		StartedAt: startedAt,
+		Removed: removedItems{
+			Books: []string{},
+			Notes: []string{},
+		},
+	}
+}
+
+// addPulled adds the number of the items in the sync list to the summary
+func (s *summary) addPulled(l syncList) {
+	s.Pulled.Books += len(l.Books)
+	s.Pulled.Notes += len(l.Notes)
+	s.Pulled.ExpungedBooks += len(l.ExpungedBooks)
+	s.Pulled.ExpungedNotes += len(l.ExpungedNotes)
+}
+
+// finish records the outcome of the sync
+func (s *summary) finish(finishedAt time.Time, report removalReport, err error) {
+	s.FinishedAt = finishedAt
+	s.Durations.Total = finishedAt.Sub(s.StartedAt).Milliseconds()
+	s.Success = err == nil
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	for _, b := range report.Books {
+		s.Removed.Books = append(s.Removed.Books, b.UUID)
+	}
+	for _, n := range report.Notes {
+		s.Removed.Notes = append(s.Removed.Notes, n.UUID)
+	}
+	s.Local.Deleted = len(report.Notes)
+}
+
+// save writes the summary to the given path. The file is replaced atomically so that
+// the tools watching it never read a partially written summary.
+func (s *summary) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling the summary")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "creating a temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "writing %s", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", tmp.Name())
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+
+	return nil
+}
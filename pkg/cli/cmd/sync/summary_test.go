@@ -0,0 +1,88 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/pkg/errors"
+)
+
+func TestSummary(t *testing.T) {
+	startedAt := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	s := newSummary(startedAt)
+	s.FullSync = true
+	s.addPulled(syncList{
+		Books:         map[string]client.SyncFragBook{"b1-uuid": {}},
+		Notes:         map[string]client.SyncFragNote{"n1-uuid": {}, "n2-uuid": {}},
+		ExpungedNotes: map[string]bool{"n3-uuid": true},
+		ExpungedBooks: map[string]bool{},
+	})
+	s.Pushed = pushCounts{Books: 1, Notes: 3}
+	s.Conflicts = 1
+	s.Durations.Pull = 1500
+	s.Durations.Push = 500
+
+	report := removalReport{
+		Books: []removedBook{{UUID: "b2-uuid", Label: "b2-label", Reason: reasonExpunged}},
+		Notes: []removedNote{{UUID: "n3-uuid", BookLabel: "b1-label", Body: "n3 body", Reason: reasonExpunged}},
+	}
+	s.finish(startedAt.Add(3*time.Second), report, errors.New("syncing changes from the server: some error"))
+
+	p := "../../tmp/summary.json"
+	if err := s.save(p); err != nil {
+		t.Fatal(errors.Wrap(err, "saving").Error())
+	}
+	defer os.Remove(p)
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the summary file").Error())
+	}
+
+	var got summary
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(errors.Wrap(err, "unmarshalling the summary").Error())
+	}
+
+	expected := summary{
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(3 * time.Second),
+		Success:    false,
+		Error:      "syncing changes from the server: some error",
+		FullSync:   true,
+		Pulled:     pullCounts{Books: 1, Notes: 2, ExpungedBooks: 0, ExpungedNotes: 1},
+		Pushed:     pushCounts{Books: 1, Notes: 3},
+		Conflicts:  1,
+		Local:      localChanges{Deleted: 1},
+		Removed: removedItems{
+			Books: []string{"b2-uuid"},
+			Notes: []string{"n3-uuid"},
+		},
+		Durations: durations{Total: 3000, Pull: 1500, Push: 500},
+	}
+	assert.DeepEqual(t, got, expected, "summary mismatch")
+}
@@ -20,15 +20,24 @@ package sync
 
 import (
 	"database/sql"
-	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/dnote/dnote/pkg/cli/backup"
 	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/cmd/mirror"
 	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/infra"
 	"github.com/dnote/dnote/pkg/cli/log"
 	"github.com/dnote/dnote/pkg/cli/migrate"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/dnote/dnote/pkg/cli/pending"
+	"github.com/dnote/dnote/pkg/cli/progress"
+	"github.com/dnote/dnote/pkg/cli/thin"
 	"github.com/dnote/dnote/pkg/cli/upgrade"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -40,9 +49,67 @@ const (
 )
 
 var example = `
-  dnote sync`
+  dnote sync
+
+  # sync with a server reachable only from inside a private network
+  dnote sync --via-ssh alice@bastion.example.com
+
+  # request smaller fragments over a slow connection
+  dnote sync --page-size 20
+
+  # sync in the background without saturating a metered connection
+  dnote sync --max-rps 2 --max-bandwidth 256K
+
+  # keep syncing every 10 minutes, and soon after the changes on this device
+  dnote sync --watch --interval 10m --log-file ~/.cache/dnote-sync.log`
 
 var isFullSync bool
+var verbosity int
+var recoveryFile string
+var offlineCheck bool
+var quietFlag bool
+var summaryFile string
+var viaSSH string
+var pageSize int
+var maxRPS float64
+var maxBandwidth string
+var watchFlag bool
+var intervalFlag time.Duration
+var logFile string
+
+const (
+	// traceStep reports the progress of each step of the sync
+	traceStep = 1
+	// traceDecision reports what was done to each book and note and why
+	traceDecision = 2
+	// traceDetail reports the local and server states behind each decision
+	traceDetail = 3
+)
+
+// tracef prints a message about the sync if the verbosity is at least the given level
+func tracef(level int, msg string, v ...interface{}) {
+	if verbosity >= level {
+		log.Printf(msg, v...)
+	}
+}
+
+// getProgressMode returns how the progress of the sync is reported. A progress bar is
+// drawn only on a terminal and when the traces are not printed.
+func getProgressMode() progress.Mode {
+	if verbosity >= traceStep {
+		return progress.ModeNone
+	}
+
+	f := os.Stdout
+	if output.IsJSON() {
+		f = os.Stderr
+	}
+	if quietFlag || !progress.IsTerminal(f) {
+		return progress.ModeCounter
+	}
+
+	return progress.ModeBar
+}
 
 // NewCmd returns a new sync command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
@@ -56,6 +123,18 @@ func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 
 	f := cmd.Flags()
 	f.BoolVarP(&isFullSync, "full", "f", false, "perform a full sync instead of incrementally syncing only the changed data.")
+	f.StringVar(&recoveryFile, "recovery-file", "", "save the notes removed from this device by the sync to the given file")
+	f.CountVarP(&verbosity, "verbose", "v", "trace the sync. Repeat up to three times (-vvv) for more details.")
+	f.BoolVar(&offlineCheck, "offline-check", false, "only check if the server can be reached, without syncing")
+	f.BoolVarP(&quietFlag, "quiet", "q", false, "show the progress as plain counters instead of a progress bar")
+	f.StringVar(&summaryFile, "summary-file", "", "write a JSON summary of the sync to the given file, even if the sync fails")
+	f.StringVar(&viaSSH, "via-ssh", "", "connect to the server through a temporary SSH tunnel to the given host, such as user@host")
+	f.IntVar(&pageSize, "page-size", 0, "the number of books and notes to request in each sync fragment, up to 100. Defaults to the 'sync.pageSize' setting.")
+	f.Float64Var(&maxRPS, "max-rps", 0, "the number of requests to make per second. Defaults to the 'sync.maxRPS' setting.")
+	f.StringVar(&maxBandwidth, "max-bandwidth", "", "the bandwidth to use in bytes per second, such as 256K or 2M. Defaults to the 'sync.maxBandwidth' setting.")
+	f.BoolVar(&watchFlag, "watch", false, "keep running, and sync periodically and soon after the changes on this device")
+	f.DurationVar(&intervalFlag, "interval", 5*time.Minute, "how often to sync with --watch")
+	f.StringVar(&logFile, "log-file", "", "write the messages of --watch to the given file")
 
 	return cmd
 }
@@ -90,12 +169,60 @@ type syncList struct {
 	MaxCurrentTime int64
 }
 
-func (l syncList) getLength() int {
-	return len(l.Notes) + len(l.Books) + len(l.ExpungedNotes) + len(l.ExpungedBooks)
+// verifyNoteChecksum returns an error if the body of the downloaded note does not match its
+// checksum, so that a corrupted body never overwrites the local copy
+func verifyNoteChecksum(note client.SyncFragNote) error {
+	if note.Deleted || note.Checksum == "" {
+		return nil
+	}
+
+	if client.Checksum(note.Body) != note.Checksum {
+		return errors.Errorf("the content of the note %s was corrupted during the download. Please try again", note.UUID)
+	}
+
+	return nil
 }
 
-// processFragments categorizes items in sync fragments into a sync list. It also decrypts any
-// encrypted data in sync fragments.
+// checkNoteBody returns an error if the body of the note to be uploaded is not a valid
+// UTF-8 text, which suggests that the local copy has been corrupted
+func checkNoteBody(note database.Note) error {
+	if !utf8.ValidString(note.Body) || strings.ContainsRune(note.Body, 0) {
+		return errors.Errorf("the content of the note %s looks corrupted, so it was not uploaded. Please check it with `dnote history`, and edit or remove it", note.UUID)
+	}
+
+	return nil
+}
+
+// getServerNoteTitle returns the title of the note downloaded from the server. The servers
+// that predate the note titles do not send them, so the title is inferred from the content.
+func getServerNoteTitle(note client.SyncFragNote) string {
+	if note.Title != "" {
+		return note.Title
+	}
+
+	return database.InferTitle(note.Body)
+}
+
+// getServerNoteVisibility returns the visibility of the note from the server, falling back
+// to the one implied by the public field if the server predates the visibility
+func getServerNoteVisibility(note client.SyncFragNote) string {
+	if note.Visibility != "" {
+		return note.Visibility
+	}
+
+	return database.VisibilityFromPublic(note.Public)
+}
+
+// newLocalNote returns a local copy of the note from the server
+func newLocalNote(n client.SyncFragNote) database.Note {
+	ret := database.NewNote(n.UUID, n.BookUUID, getServerNoteTitle(n), n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.Deleted, false)
+	ret.Visibility = getServerNoteVisibility(n)
+
+	return ret
+}
+
+// processFragments categorizes items in sync fragments into a sync list. It also verifies
+// the checksums of the notes in sync fragments.
 func processFragments(fragments []client.SyncFragment) (syncList, error) {
 	notes := map[string]client.SyncFragNote{}
 	books := map[string]client.SyncFragBook{}
@@ -106,6 +233,10 @@ func processFragments(fragments []client.SyncFragment) (syncList, error) {
 
 	for _, fragment := range fragments {
 		for _, note := range fragment.Notes {
+			if err := verifyNoteChecksum(note); err != nil {
+				return syncList{}, err
+			}
+
 			notes[note.UUID] = note
 		}
 		for _, book := range fragment.Books {
@@ -138,65 +269,65 @@ func processFragments(fragments []client.SyncFragment) (syncList, error) {
 	return sl, nil
 }
 
-// getSyncList gets a list of all sync fragments after the specified usn
-// and aggregates them into a syncList data structure
-func getSyncList(ctx context.DnoteCtx, afterUSN int) (syncList, error) {
-	fragments, err := getSyncFragments(ctx, afterUSN)
-	if err != nil {
-		return syncList{}, errors.Wrap(err, "getting sync fragments")
-	}
-
-	ret, err := processFragments(fragments)
-	if err != nil {
-		return syncList{}, errors.Wrap(err, "making sync list")
-	}
-
-	return ret, nil
+// pullResult is the state of the server after all sync fragments are pulled
+type pullResult struct {
+	MaxUSN         int
+	MaxCurrentTime int64
 }
 
-// getSyncFragments repeatedly gets all sync fragments after the specified usn until there is no more new data
-// remaining and returns the buffered list
-func getSyncFragments(ctx context.DnoteCtx, afterUSN int) ([]client.SyncFragment, error) {
-	var buf []client.SyncFragment
+// pullFragments gets the sync fragments after the specified usn one at a time, and calls
+// merge with the sync list of each fragment before getting the next one. Only one fragment
+// is held in memory however much data the server has. The fragments are requested in the
+// page size in the context, or a smaller one if the server asks for it.
+func pullFragments(ctx context.DnoteCtx, afterUSN int, bar *progress.Bar, merge func(syncList) error) (pullResult, error) {
+	var ret pullResult
 
 	nextAfterUSN := afterUSN
+	limit := ctx.SyncPageSize
 
 	for {
-		resp, err := client.GetSyncFragment(ctx, nextAfterUSN)
+		resp, err := client.GetSyncFragmentPage(ctx, nextAfterUSN, limit)
 		if err != nil {
-			return buf, errors.Wrap(err, "getting sync fragment")
+			return ret, errors.Wrap(err, "getting sync fragment")
 		}
 
 		frag := resp.Fragment
-		buf = append(buf, frag)
+		log.Debug("received a sync fragment: %+v\n", frag)
 
-		nextAfterUSN = frag.FragMaxUSN
-
-		// if there is no more data, break
-		if nextAfterUSN == 0 {
-			break
+		// the number of changes on the server approximates the number of items to merge
+		if nextAfterUSN == afterUSN {
+			total := frag.UserMaxUSN - afterUSN
+			if total < 0 {
+				total = 0
+			}
+			bar.SetTotal(total)
 		}
-	}
-
-	log.Debug("received sync fragments: %+v\n", buf)
 
-	return buf, nil
-}
-
-// resolveLabel resolves a book label conflict by repeatedly appending an increasing integer
-// to the label until it finds a unique label. It returns the first non-conflicting label.
-func resolveLabel(tx *database.DB, label string) (string, error) {
-	var ret string
+		list, err := processFragments([]client.SyncFragment{frag})
+		if err != nil {
+			return ret, errors.Wrap(err, "making sync list")
+		}
+		if err := merge(list); err != nil {
+			return ret, err
+		}
 
-	for i := 2; ; i++ {
-		ret = fmt.Sprintf("%s_%d", label, i)
+		if list.MaxUSN > ret.MaxUSN {
+			ret.MaxUSN = list.MaxUSN
+		}
+		if list.MaxCurrentTime > ret.MaxCurrentTime {
+			ret.MaxCurrentTime = list.MaxCurrentTime
+		}
 
-		var cnt int
-		if err := tx.QueryRow("SELECT count(*) FROM books WHERE label = ?", ret).Scan(&cnt); err != nil {
-			return "", errors.Wrapf(err, "checking availability of label %s", ret)
+		if limit > 0 && frag.Limit > 0 && frag.Limit < limit {
+			tracef(traceStep, "requesting %d books and notes in each fragment as the server asks\n", frag.Limit)
+			limit = frag.Limit
 		}
 
-		if cnt == 0 {
+		nextAfterUSN = frag.FragMaxUSN
+
+		// if there is no more data, break. The servers that predate the pagination hints
+		// tell it only by an empty fragment.
+		if nextAfterUSN == 0 || (frag.HasMore != nil && !*frag.HasMore) {
 			break
 		}
 	}
@@ -206,22 +337,40 @@ func resolveLabel(tx *database.DB, label string) (string, error) {
 
 // mergeBook inserts or updates the given book in the local database.
 // If a book with a duplicate label exists locally, it renames the duplicate by appending a number.
-func mergeBook(tx *database.DB, b client.SyncFragBook, mode int) error {
-	var count int
-	if err := tx.QueryRow("SELECT count(*) FROM books WHERE label = ?", b.Label).Scan(&count); err != nil {
+// Unless caseSensitive is true, the labels differing only in case are duplicates as well.
+func mergeBook(tx *database.DB, b client.SyncFragBook, mode int, caseSensitive bool) error {
+	query := "SELECT uuid FROM books WHERE uuid <> ? AND label = ?"
+	if !caseSensitive {
+		query += " COLLATE NOCASE"
+	}
+
+	rows, err := tx.Query(query, b.UUID, b.Label)
+	if err != nil {
 		return errors.Wrapf(err, "checking for books with a duplicate label %s", b.Label)
 	}
+	var duplicates []string
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "scanning a book with a duplicate label")
+		}
+		duplicates = append(duplicates, uuid)
+	}
+	rows.Close()
 
-	// if duplicate exists locally, rename it and mark it dirty
-	if count > 0 {
-		newLabel, err := resolveLabel(tx, b.Label)
+	// if duplicates exist locally, rename them one by one and mark them dirty
+	for _, uuid := range duplicates {
+		newLabel, err := database.ResolveLabelConflict(tx, b.Label, caseSensitive)
 		if err != nil {
 			return errors.Wrap(err, "getting a new book label for conflict resolution")
 		}
 
-		if _, err := tx.Exec("UPDATE books SET label = ?, dirty = ? WHERE label = ?", newLabel, true, b.Label); err != nil {
+		if _, err := tx.Exec("UPDATE books SET label = ?, dirty = ? WHERE uuid = ?", newLabel, true, uuid); err != nil {
 			return errors.Wrap(err, "resolving duplicate book label")
 		}
+
+		tracef(traceDecision, "book %s: renamed the local book to %s because the server has a book with the same name\n", b.Label, newLabel)
 	}
 
 	if mode == modeInsert {
@@ -229,18 +378,26 @@ func mergeBook(tx *database.DB, b client.SyncFragBook, mode int) error {
 		if err := book.Insert(tx); err != nil {
 			return errors.Wrapf(err, "inserting note with uuid %s", b.UUID)
 		}
+
+		tracef(traceDecision, "book %s (%s): inserted because it does not exist locally\n", b.Label, b.UUID)
 	} else if mode == modeUpdate {
 		// The state from the server overwrites the local state. In other words, the server change always wins.
 		if _, err := tx.Exec("UPDATE books SET usn = ?, uuid = ?, label = ?, deleted = ? WHERE uuid = ?",
 			b.USN, b.UUID, b.Label, b.Deleted, b.UUID); err != nil {
 			return errors.Wrapf(err, "updating local book %s", b.UUID)
 		}
+
+		tracef(traceDecision, "book %s (%s): updated with the server copy\n", b.Label, b.UUID)
+	}
+
+	if _, err := tx.Exec("UPDATE books SET owner = ? WHERE uuid = ?", b.Owner, b.UUID); err != nil {
+		return errors.Wrapf(err, "updating the owner of local book %s", b.UUID)
 	}
 
 	return nil
 }
 
-func stepSyncBook(tx *database.DB, b client.SyncFragBook) error {
+func stepSyncBook(tx *database.DB, b client.SyncFragBook, caseSensitive bool) error {
 	var localUSN int
 	var dirty bool
 	err := tx.QueryRow("SELECT usn, dirty FROM books WHERE uuid = ?", b.UUID).Scan(&localUSN, &dirty)
@@ -248,23 +405,25 @@ func stepSyncBook(tx *database.DB, b client.SyncFragBook) error {
 		return errors.Wrapf(err, "getting local book %s", b.UUID)
 	}
 
+	tracef(traceDetail, "book %s: server usn %d. local usn %d, dirty %t\n", b.UUID, b.USN, localUSN, dirty)
+
 	// if book exists in the server and does not exist in the client
 	if err == sql.ErrNoRows {
-		if e := mergeBook(tx, b, modeInsert); e != nil {
+		if e := mergeBook(tx, b, modeInsert, caseSensitive); e != nil {
 			return errors.Wrapf(e, "resolving book")
 		}
 
 		return nil
 	}
 
-	if e := mergeBook(tx, b, modeUpdate); e != nil {
+	if e := mergeBook(tx, b, modeUpdate, caseSensitive); e != nil {
 		return errors.Wrapf(e, "resolving book")
 	}
 
 	return nil
 }
 
-func mergeNote(tx *database.DB, serverNote client.SyncFragNote, localNote database.Note) error {
+func mergeNote(tx *database.DB, serverNote client.SyncFragNote, localNote database.Note, s *summary) error {
 	var bookDeleted bool
 	err := tx.QueryRow("SELECT deleted FROM books WHERE uuid = ?", localNote.BookUUID).Scan(&bookDeleted)
 	if err != nil {
@@ -273,16 +432,30 @@ func mergeNote(tx *database.DB, serverNote client.SyncFragNote, localNote databa
 
 	// if the book is deleted, noop
 	if bookDeleted {
+		tracef(traceDecision, "note %s: skipped because its book is deleted locally\n", serverNote.UUID)
+		return nil
+	}
+
+	// if the local copy is in the trash and it was deleted on the server as well, keep the body in the trash.
+	if localNote.TrashedOn > 0 && serverNote.Deleted {
+		if _, err := tx.Exec("UPDATE notes SET usn = ?, dirty = ? WHERE uuid = ?", serverNote.USN, false, serverNote.UUID); err != nil {
+			return errors.Wrapf(err, "updating local note %s", serverNote.UUID)
+		}
+
+		s.Local.Updated++
+		tracef(traceDecision, "note %s: kept in the trash because it was deleted on the server\n", serverNote.UUID)
 		return nil
 	}
 
 	// if the local copy is deleted, and it was edited on the server, override with server values and mark it not dirty.
 	if localNote.Deleted {
-		if _, err := tx.Exec("UPDATE notes SET usn = ?, book_uuid = ?, body = ?, edited_on = ?, deleted = ?, public = ?, dirty = ? WHERE uuid = ?",
-			serverNote.USN, serverNote.BookUUID, serverNote.Body, serverNote.EditedOn, serverNote.Deleted, serverNote.Public, false, serverNote.UUID); err != nil {
+		if _, err := tx.Exec("UPDATE notes SET usn = ?, book_uuid = ?, title = ?, body = ?, edited_on = ?, deleted = ?, public = ?, visibility = ?, dirty = ?, evicted = ?, trashed_on = ? WHERE uuid = ?",
+			serverNote.USN, serverNote.BookUUID, getServerNoteTitle(serverNote), serverNote.Body, serverNote.EditedOn, serverNote.Deleted, serverNote.Public, getServerNoteVisibility(serverNote), false, false, 0, serverNote.UUID); err != nil {
 			return errors.Wrapf(err, "updating local note %s", serverNote.UUID)
 		}
 
+		s.Local.Updated++
+		tracef(traceDecision, "note %s: restored with the server copy because it was edited on the server after being deleted locally\n", serverNote.UUID)
 		return nil
 	}
 
@@ -291,81 +464,63 @@ func mergeNote(tx *database.DB, serverNote client.SyncFragNote, localNote databa
 		return errors.Wrapf(err, "reporting note conflict for note %s", localNote.UUID)
 	}
 
-	if _, err := tx.Exec("UPDATE notes SET usn = ?, book_uuid = ?, body = ?, edited_on = ?, deleted = ?  WHERE uuid = ?",
-		serverNote.USN, mr.bookUUID, mr.body, mr.editedOn, serverNote.Deleted, serverNote.UUID); err != nil {
+	if _, err := tx.Exec("UPDATE notes SET usn = ?, book_uuid = ?, title = ?, body = ?, edited_on = ?, deleted = ?, evicted = ? WHERE uuid = ?",
+		serverNote.USN, mr.bookUUID, mr.title, mr.body, mr.editedOn, serverNote.Deleted, false, serverNote.UUID); err != nil {
 		return errors.Wrapf(err, "updating local note %s", serverNote.UUID)
 	}
+	s.Local.Updated++
 
-	return nil
-}
-
-func stepSyncNote(tx *database.DB, n client.SyncFragNote) error {
-	var localNote database.Note
-	err := tx.QueryRow("SELECT body, usn, book_uuid, dirty, deleted FROM notes WHERE uuid = ?", n.UUID).
-		Scan(&localNote.Body, &localNote.USN, &localNote.BookUUID, &localNote.Dirty, &localNote.Deleted)
-	if err != nil && err != sql.ErrNoRows {
-		return errors.Wrapf(err, "getting local note %s", n.UUID)
-	}
-
-	// if note exists in the server and does not exist in the client, insert the note.
-	if err == sql.ErrNoRows {
-		note := database.NewNote(n.UUID, n.BookUUID, n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.Deleted, false)
-
-		if err := note.Insert(tx); err != nil {
-			return errors.Wrapf(err, "inserting note with uuid %s", n.UUID)
+	if localNote.Dirty {
+		s.Conflicts++
+		if serverNote.Author != "" {
+			tracef(traceDecision, "note %s: merged with the server copy because both copies were changed in the team book\n", serverNote.UUID)
+		} else {
+			tracef(traceDecision, "note %s: merged with the server copy because both copies were changed\n", serverNote.UUID)
 		}
+	} else if serverNote.Deleted {
+		tracef(traceDecision, "note %s: marked deleted because it was deleted on the server\n", serverNote.UUID)
 	} else {
-		if err := mergeNote(tx, n, localNote); err != nil {
-			return errors.Wrap(err, "merging local note")
-		}
-	}
-
-	return nil
-}
-
-func fullSyncNote(tx *database.DB, n client.SyncFragNote) error {
-	var localNote database.Note
-	err := tx.QueryRow("SELECT body, usn, book_uuid, dirty, deleted FROM notes WHERE uuid = ?", n.UUID).
-		Scan(&localNote.Body, &localNote.USN, &localNote.BookUUID, &localNote.Dirty, &localNote.Deleted)
-	if err != nil && err != sql.ErrNoRows {
-		return errors.Wrapf(err, "getting local note %s", n.UUID)
-	}
-
-	// if note exists in the server and does not exist in the client, insert the note.
-	if err == sql.ErrNoRows {
-		note := database.NewNote(n.UUID, n.BookUUID, n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.Deleted, false)
-
-		if err := note.Insert(tx); err != nil {
-			return errors.Wrapf(err, "inserting note with uuid %s", n.UUID)
-		}
-	} else if n.USN > localNote.USN {
-		if err := mergeNote(tx, n, localNote); err != nil {
-			return errors.Wrap(err, "merging local note")
-		}
+		tracef(traceDecision, "note %s: updated with the server copy\n", serverNote.UUID)
 	}
 
 	return nil
 }
 
-func syncDeleteNote(tx *database.DB, noteUUID string) error {
+func syncDeleteNote(tx *database.DB, noteUUID string, report *removalReport) error {
 	var localUSN int
 	var dirty bool
-	err := tx.QueryRow("SELECT usn, dirty FROM notes WHERE uuid = ?", noteUUID).Scan(&localUSN, &dirty)
+	var trashedOn int64
+	err := tx.QueryRow("SELECT usn, dirty, trashed_on FROM notes WHERE uuid = ?", noteUUID).Scan(&localUSN, &dirty, &trashedOn)
 	if err != nil && err != sql.ErrNoRows {
 		return errors.Wrapf(err, "getting local note %s", noteUUID)
 	}
 
 	// if note does not exist on client, noop
 	if err == sql.ErrNoRows {
+		tracef(traceDecision, "note %s: skipped deleting because it does not exist locally\n", noteUUID)
+		return nil
+	}
+
+	// the notes in the trash are deleted on the server, and are kept until the trash is emptied
+	if trashedOn > 0 {
+		tracef(traceDecision, "note %s: kept in the trash although it was expunged on the server\n", noteUUID)
 		return nil
 	}
 
 	// if local copy is not dirty, delete
 	if !dirty {
+		if err := report.addNote(tx, noteUUID, reasonExpunged); err != nil {
+			return errors.Wrap(err, "reporting the removed note")
+		}
+
 		_, err = tx.Exec("DELETE FROM notes WHERE uuid = ?", noteUUID)
 		if err != nil {
 			return errors.Wrapf(err, "deleting local note %s", noteUUID)
 		}
+
+		tracef(traceDecision, "note %s: deleted because it was expunged on the server\n", noteUUID)
+	} else {
+		tracef(traceDecision, "note %s: kept although it was expunged on the server because it has local changes\n", noteUUID)
 	}
 
 	return nil
@@ -385,21 +540,24 @@ func checkNotesPristine(tx *database.DB, bookUUID string) (bool, error) {
 	return true, nil
 }
 
-func syncDeleteBook(tx *database.DB, bookUUID string) error {
+func syncDeleteBook(tx *database.DB, bookUUID string, report *removalReport) error {
 	var localUSN int
 	var dirty bool
-	err := tx.QueryRow("SELECT usn, dirty FROM books WHERE uuid = ?", bookUUID).Scan(&localUSN, &dirty)
+	var owner string
+	err := tx.QueryRow("SELECT usn, dirty, owner FROM books WHERE uuid = ?", bookUUID).Scan(&localUSN, &dirty, &owner)
 	if err != nil && err != sql.ErrNoRows {
 		return errors.Wrapf(err, "getting local book %s", bookUUID)
 	}
 
 	// if book does not exist on client, noop
 	if err == sql.ErrNoRows {
+		tracef(traceDecision, "book %s: skipped deleting because it does not exist locally\n", bookUUID)
 		return nil
 	}
 
 	// if local copy is dirty, noop. it will be uploaded to the server later
 	if dirty {
+		tracef(traceDecision, "book %s: kept although it was expunged on the server because it has local changes\n", bookUUID)
 		return nil
 	}
 
@@ -407,6 +565,16 @@ func syncDeleteBook(tx *database.DB, bookUUID string) error {
 	if err != nil {
 		return errors.Wrap(err, "checking if any notes are dirty in book")
 	}
+	// if the user was removed from a team book, the server no longer accepts changes to it. keep the
+	// changed notes in a new book of the user instead, to be uploaded as if they were never synced.
+	if !ok && owner != "" {
+		if err := keepTeamBook(tx, bookUUID); err != nil {
+			return errors.Wrap(err, "keeping the changed notes of the team book")
+		}
+
+		tracef(traceDecision, "book %s: kept as a new book of the user although the user was removed from it because some of its notes have local changes\n", bookUUID)
+		return nil
+	}
 	// if the local book is not pristine, do not delete but mark it as dirty
 	// so that it can be uploaded to the server later and become un-deleted
 	if !ok {
@@ -415,9 +583,17 @@ func syncDeleteBook(tx *database.DB, bookUUID string) error {
 			return errors.Wrapf(err, "marking a book dirty with uuid %s", bookUUID)
 		}
 
+		tracef(traceDecision, "book %s: kept although it was expunged on the server because some of its notes have local changes\n", bookUUID)
 		return nil
 	}
 
+	if err := report.addBook(tx, bookUUID, reasonExpunged); err != nil {
+		return errors.Wrap(err, "reporting the removed book")
+	}
+	if err := report.addBookNotes(tx, bookUUID, reasonBookExpunged); err != nil {
+		return errors.Wrap(err, "reporting the removed notes")
+	}
+
 	_, err = tx.Exec("DELETE FROM notes WHERE book_uuid = ?", bookUUID)
 	if err != nil {
 		return errors.Wrapf(err, "deleting local notes of the book %s", bookUUID)
@@ -428,10 +604,27 @@ func syncDeleteBook(tx *database.DB, bookUUID string) error {
 		return errors.Wrapf(err, "deleting local book %s", bookUUID)
 	}
 
+	tracef(traceDecision, "book %s: deleted with its notes because it was expunged on the server\n", bookUUID)
+	return nil
+}
+
+// keepTeamBook turns the team book with the given uuid into a new book of the user that holds only
+// the notes with local changes. The notes are uploaded as new notes in the next sync.
+func keepTeamBook(tx *database.DB, bookUUID string) error {
+	if _, err := tx.Exec("DELETE FROM notes WHERE book_uuid = ? AND NOT dirty", bookUUID); err != nil {
+		return errors.Wrap(err, "deleting the notes without local changes")
+	}
+	if _, err := tx.Exec("UPDATE notes SET usn = 0, author = '' WHERE book_uuid = ?", bookUUID); err != nil {
+		return errors.Wrap(err, "resetting the usn of the notes")
+	}
+	if _, err := tx.Exec("UPDATE books SET usn = 0, owner = '', dirty = ? WHERE uuid = ?", true, bookUUID); err != nil {
+		return errors.Wrap(err, "resetting the usn of the book")
+	}
+
 	return nil
 }
 
-func fullSyncBook(tx *database.DB, b client.SyncFragBook) error {
+func fullSyncBook(tx *database.DB, b client.SyncFragBook, caseSensitive bool) error {
 	var localUSN int
 	var dirty bool
 	err := tx.QueryRow("SELECT usn, dirty FROM books WHERE uuid = ?", b.UUID).Scan(&localUSN, &dirty)
@@ -439,52 +632,72 @@ func fullSyncBook(tx *database.DB, b client.SyncFragBook) error {
 		return errors.Wrapf(err, "getting local book %s", b.UUID)
 	}
 
+	tracef(traceDetail, "book %s: server usn %d. local usn %d, dirty %t\n", b.UUID, b.USN, localUSN, dirty)
+
 	// if book exists in the server and does not exist in the client
 	if err == sql.ErrNoRows {
-		if e := mergeBook(tx, b, modeInsert); e != nil {
+		if e := mergeBook(tx, b, modeInsert, caseSensitive); e != nil {
 			return errors.Wrapf(e, "resolving book")
 		}
 	} else if b.USN > localUSN {
-		if e := mergeBook(tx, b, modeUpdate); e != nil {
+		if e := mergeBook(tx, b, modeUpdate, caseSensitive); e != nil {
 			return errors.Wrapf(e, "resolving book")
 		}
+	} else {
+		tracef(traceDecision, "book %s (%s): skipped because the local copy is up to date\n", b.Label, b.UUID)
 	}
 
 	return nil
 }
 
-// checkNoteInList checks if the given syncList contains the note with the given uuid
-func checkNoteInList(uuid string, list *syncList) bool {
-	if _, ok := list.Notes[uuid]; ok {
-		return true
-	}
+// pulledResources holds the uuids of the books and notes pulled from the server in a full
+// sync. Unlike the sync lists, which are dropped after their fragments are merged, it lasts
+// until all fragments are pulled and does not hold the content.
+type pulledResources struct {
+	Notes map[string]bool
+	Books map[string]bool
+}
 
-	if _, ok := list.ExpungedNotes[uuid]; ok {
-		return true
+func newPulledResources() pulledResources {
+	return pulledResources{
+		Notes: map[string]bool{},
+		Books: map[string]bool{},
 	}
-
-	return false
 }
 
-// checkBookInList checks if the given syncList contains the book with the given uuid
-func checkBookInList(uuid string, list *syncList) bool {
-	if _, ok := list.Books[uuid]; ok {
-		return true
+// add records the books and notes in the sync list, including the expunged ones
+func (p pulledResources) add(l syncList) {
+	for uuid := range l.Notes {
+		p.Notes[uuid] = true
 	}
-
-	if _, ok := list.ExpungedBooks[uuid]; ok {
-		return true
+	for uuid := range l.ExpungedNotes {
+		p.Notes[uuid] = true
+	}
+	for uuid := range l.Books {
+		p.Books[uuid] = true
+	}
+	for uuid := range l.ExpungedBooks {
+		p.Books[uuid] = true
 	}
+}
+
+// hasNote checks if the note with the given uuid was pulled
+func (p pulledResources) hasNote(uuid string) bool {
+	return p.Notes[uuid]
+}
 
-	return false
+// hasBook checks if the book with the given uuid was pulled
+func (p pulledResources) hasBook(uuid string) bool {
+	return p.Books[uuid]
 }
 
 // cleanLocalNotes deletes from the local database any notes that are in invalid state
 // judging by the full list of resources in the server. Concretely, the only acceptable
 // situation in which a local note is not present in the server is if it is new and has not been
-// uploaded (i.e. dirty and usn is 0). Otherwise, it is a result of some kind of error and should be cleaned.
-func cleanLocalNotes(tx *database.DB, fullList *syncList) error {
-	rows, err := tx.Query("SELECT uuid, usn, dirty FROM notes")
+// uploaded (i.e. dirty and usn is 0), or if it is in the trash. Otherwise, it is a result of some kind
+// of error and should be cleaned.
+func cleanLocalNotes(tx *database.DB, pulled pulledResources, report *removalReport) error {
+	rows, err := tx.Query("SELECT uuid, usn, dirty, trashed_on FROM notes")
 	if err != nil {
 		return errors.Wrap(err, "getting local notes")
 	}
@@ -492,16 +705,25 @@ func cleanLocalNotes(tx *database.DB, fullList *syncList) error {
 
 	for rows.Next() {
 		var note database.Note
-		if err := rows.Scan(&note.UUID, &note.USN, &note.Dirty); err != nil {
+		if err := rows.Scan(&note.UUID, &note.USN, &note.Dirty, &note.TrashedOn); err != nil {
 			return errors.Wrap(err, "scanning a row for local note")
 		}
 
-		ok := checkNoteInList(note.UUID, fullList)
-		if !ok && (!note.Dirty || note.USN != 0) {
+		// the notes in the trash are deleted on the server, or were never uploaded
+		localOnly := (note.USN == 0 && note.Dirty) || note.TrashedOn > 0
+
+		ok := pulled.hasNote(note.UUID)
+		if !ok && !localOnly {
+			if err := report.addNote(tx, note.UUID, reasonInvalid); err != nil {
+				return errors.Wrap(err, "reporting the removed note")
+			}
+
 			err = note.Expunge(tx)
 			if err != nil {
 				return errors.Wrap(err, "expunging a note")
 			}
+
+			tracef(traceDecision, "note %s: deleted because it is not on the server although it was uploaded before\n", note.UUID)
 		}
 	}
 
@@ -509,7 +731,7 @@ func cleanLocalNotes(tx *database.DB, fullList *syncList) error {
 }
 
 // cleanLocalBooks deletes from the local database any books that are in invalid state
-func cleanLocalBooks(tx *database.DB, fullList *syncList) error {
+func cleanLocalBooks(tx *database.DB, pulled pulledResources, report *removalReport) error {
 	rows, err := tx.Query("SELECT uuid, usn, dirty FROM books")
 	if err != nil {
 		return errors.Wrap(err, "getting local books")
@@ -522,117 +744,166 @@ func cleanLocalBooks(tx *database.DB, fullList *syncList) error {
 			return errors.Wrap(err, "scanning a row for local book")
 		}
 
-		ok := checkBookInList(book.UUID, fullList)
+		ok := pulled.hasBook(book.UUID)
 		if !ok && (!book.Dirty || book.USN != 0) {
+			if err := report.addBook(tx, book.UUID, reasonInvalid); err != nil {
+				return errors.Wrap(err, "reporting the removed book")
+			}
+
 			err = book.Expunge(tx)
 			if err != nil {
 				return errors.Wrap(err, "expunging a book")
 			}
+
+			tracef(traceDecision, "book %s: deleted because it is not on the server although it was uploaded before\n", book.UUID)
 		}
 	}
 
 	return nil
 }
 
-func fullSync(ctx context.DnoteCtx, tx *database.DB) error {
-	log.Debug("performing a full sync\n")
-	log.Info("resolving delta.")
-
-	list, err := getSyncList(ctx, 0)
-	if err != nil {
-		return errors.Wrap(err, "getting sync list")
-	}
-
-	fmt.Printf(" (total %d).", list.getLength())
-
-	// clean resources that are in erroneous states
-	if err := cleanLocalNotes(tx, &list); err != nil {
-		return errors.Wrap(err, "cleaning up local notes")
-	}
-	if err := cleanLocalBooks(tx, &list); err != nil {
-		return errors.Wrap(err, "cleaning up local books")
-	}
-
+// mergeList merges the books and notes in the sync list of a fragment into the local
+// database. The notes are flushed before the expunged resources are deleted.
+func mergeList(tx *database.DB, m *noteMerger, list syncList, full, caseSensitive bool, report *removalReport, bar *progress.Bar) error {
 	for _, note := range list.Notes {
-		if err := fullSyncNote(tx, note); err != nil {
+		var err error
+		if full {
+			err = m.fullSyncNote(note)
+		} else {
+			err = m.stepSyncNote(note)
+		}
+		if err != nil {
 			return errors.Wrap(err, "merging note")
 		}
+		bar.Increment()
+	}
+	if err := m.flush(); err != nil {
+		return errors.Wrap(err, "merging notes")
 	}
 	for _, book := range list.Books {
-		if err := fullSyncBook(tx, book); err != nil {
+		var err error
+		if full {
+			err = fullSyncBook(tx, book, caseSensitive)
+		} else {
+			err = stepSyncBook(tx, book, caseSensitive)
+		}
+		if err != nil {
 			return errors.Wrap(err, "merging book")
 		}
+		bar.Increment()
 	}
 
 	for noteUUID := range list.ExpungedNotes {
-		if err := syncDeleteNote(tx, noteUUID); err != nil {
+		if err := syncDeleteNote(tx, noteUUID, report); err != nil {
 			return errors.Wrap(err, "deleting note")
 		}
+		bar.Increment()
 	}
 	for bookUUID := range list.ExpungedBooks {
-		if err := syncDeleteBook(tx, bookUUID); err != nil {
+		if err := syncDeleteBook(tx, bookUUID, report); err != nil {
 			return errors.Wrap(err, "deleting book")
 		}
+		bar.Increment()
 	}
 
-	err = saveSyncState(tx, list.MaxCurrentTime, list.MaxUSN)
-	if err != nil {
-		return errors.Wrap(err, "saving sync state")
-	}
-
-	fmt.Println(" done.")
-
 	return nil
 }
 
-func stepSync(ctx context.DnoteCtx, tx *database.DB, afterUSN int) error {
-	log.Debug("performing a step sync\n")
+// pullAndMerge pulls the sync fragments after the given usn and merges each of them in the
+// transaction. The pulled fragments are recorded in pulled if it is not nil.
+func pullAndMerge(ctx context.DnoteCtx, tx *database.DB, afterUSN int, full bool, report *removalReport, s *summary, pulled *pulledResources) (pullResult, error) {
+	bar := progress.New(getProgressMode(), "resolving delta")
 
-	log.Info("resolving delta.")
+	codec, err := newMetadataCodec(ctx, tx)
+	if err != nil {
+		return pullResult{}, err
+	}
 
-	list, err := getSyncList(ctx, afterUSN)
+	m, err := newNoteMerger(tx, s, full, codec)
 	if err != nil {
-		return errors.Wrap(err, "getting sync list")
+		return pullResult{}, errors.Wrap(err, "preparing to merge notes")
 	}
+	defer m.close()
 
-	fmt.Printf(" (total %d).", list.getLength())
+	ret, err := pullFragments(ctx, afterUSN, bar, func(list syncList) error {
+		s.addPulled(list)
+		tracef(traceStep, "received %d books, %d notes, %d expunged books and %d expunged notes\n",
+			len(list.Books), len(list.Notes), len(list.ExpungedBooks), len(list.ExpungedNotes))
 
-	for _, note := range list.Notes {
-		if err := stepSyncNote(tx, note); err != nil {
-			return errors.Wrap(err, "merging note")
+		if pulled != nil {
+			pulled.add(list)
 		}
+
+		return mergeList(tx, m, list, full, ctx.CaseSensitiveBooks, report, bar)
+	})
+	if err != nil {
+		return ret, errors.Wrap(err, "pulling sync fragments")
 	}
-	for _, book := range list.Books {
-		if err := stepSyncBook(tx, book); err != nil {
-			return errors.Wrap(err, "merging book")
-		}
+
+	bar.Done()
+
+	return ret, nil
+}
+
+func fullSync(ctx context.DnoteCtx, tx *database.DB, report *removalReport, s *summary) error {
+	log.Debug("performing a full sync\n")
+
+	pulled := newPulledResources()
+	result, err := pullAndMerge(ctx, tx, 0, true, report, s, &pulled)
+	if err != nil {
+		return err
 	}
 
-	for noteUUID := range list.ExpungedNotes {
-		if err := syncDeleteNote(tx, noteUUID); err != nil {
-			return errors.Wrap(err, "deleting note")
-		}
+	// clean resources that are in erroneous states. The resources missing on the server
+	// are known only after all fragments are pulled.
+	if err := cleanLocalNotes(tx, pulled, report); err != nil {
+		return errors.Wrap(err, "cleaning up local notes")
 	}
-	for bookUUID := range list.ExpungedBooks {
-		if err := syncDeleteBook(tx, bookUUID); err != nil {
-			return errors.Wrap(err, "deleting book")
-		}
+	if err := cleanLocalBooks(tx, pulled, report); err != nil {
+		return errors.Wrap(err, "cleaning up local books")
 	}
 
-	err = saveSyncState(tx, list.MaxCurrentTime, list.MaxUSN)
+	err = saveSyncState(tx, result.MaxCurrentTime, result.MaxUSN)
 	if err != nil {
 		return errors.Wrap(err, "saving sync state")
 	}
 
-	fmt.Println(" done.")
+	return nil
+}
+
+func stepSync(ctx context.DnoteCtx, tx *database.DB, afterUSN int, report *removalReport, s *summary) error {
+	log.Debug("performing a step sync\n")
+
+	result, err := pullAndMerge(ctx, tx, afterUSN, false, report, s, nil)
+	if err != nil {
+		return err
+	}
+
+	err = saveSyncState(tx, result.MaxCurrentTime, result.MaxUSN)
+	if err != nil {
+		return errors.Wrap(err, "saving sync state")
+	}
 
 	return nil
 }
 
-func sendBooks(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
+// sendBooks sends the dirty books except the removals of the uploaded books, which are
+// sent by sendBookRemovals after the notes. The server removes the notes in a book along
+// with the book, including those that have been moved out of it locally but not sent yet.
+func sendBooks(ctx context.DnoteCtx, tx *database.DB, bar *progress.Bar) (bool, error) {
+	return sendDirtyBooks(ctx, tx, bar, "dirty AND NOT (deleted AND usn > 0)")
+}
+
+// sendBookRemovals sends the removals of the uploaded books
+func sendBookRemovals(ctx context.DnoteCtx, tx *database.DB, bar *progress.Bar) (bool, error) {
+	return sendDirtyBooks(ctx, tx, bar, "dirty AND deleted AND usn > 0")
+}
+
+// sendDirtyBooks sends the books matching the given condition
+func sendDirtyBooks(ctx context.DnoteCtx, tx *database.DB, bar *progress.Bar, cond string) (bool, error) {
 	isBehind := false
 
-	rows, err := tx.Query("SELECT uuid, label, usn, deleted FROM books WHERE dirty")
+	rows, err := tx.Query("SELECT uuid, label, usn, deleted FROM books WHERE " + cond)
 	if err != nil {
 		return isBehind, errors.Wrap(err, "getting syncable books")
 	}
@@ -644,6 +915,7 @@ func sendBooks(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 		if err = rows.Scan(&book.UUID, &book.Label, &book.USN, &book.Deleted); err != nil {
 			return isBehind, errors.Wrap(err, "scanning a syncable book")
 		}
+		bar.Increment()
 
 		log.Debug("sending book %s\n", book.UUID)
 
@@ -657,6 +929,7 @@ func sendBooks(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 					return isBehind, errors.Wrap(err, "expunging a book locally")
 				}
 
+				tracef(traceDecision, "book %s: deleted locally without sending because it was never uploaded\n", book.UUID)
 				continue
 			} else {
 				resp, err := client.CreateBook(ctx, book.Label)
@@ -719,6 +992,8 @@ func sendBooks(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 		}
 
 		log.Debug("sent book %s. response USN %d. last max usn: %d\n", book.UUID, respUSN, lastMaxUSN)
+		tracef(traceDecision, "book %s: sent\n", book.UUID)
+		tracef(traceDetail, "book %s: response usn %d. last max usn %d\n", book.UUID, respUSN, lastMaxUSN)
 
 		if respUSN == lastMaxUSN+1 {
 			err = updateLastMaxUSN(tx, lastMaxUSN+1)
@@ -733,10 +1008,18 @@ func sendBooks(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 	return isBehind, nil
 }
 
-func sendNotes(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
+func sendNotes(ctx context.DnoteCtx, tx *database.DB, bar *progress.Bar) (bool, error) {
 	isBehind := false
 
-	rows, err := tx.Query("SELECT uuid, book_uuid, body, public, deleted, usn, added_on FROM notes WHERE dirty")
+	codec, err := newMetadataCodec(ctx, tx)
+	if err != nil {
+		return isBehind, err
+	}
+	if codec != nil && codec.stale {
+		log.Warnf("the metadata was encrypted for newer keys by another device, and is not sent. Update metadata.recipients to the new recipients\n")
+	}
+
+	rows, err := tx.Query("SELECT uuid, book_uuid, title, body, public, visibility, deleted, usn, added_on, trashed_on FROM notes WHERE dirty")
 	if err != nil {
 		return isBehind, errors.Wrap(err, "getting syncable notes")
 	}
@@ -745,9 +1028,16 @@ func sendNotes(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 	for rows.Next() {
 		var note database.Note
 
-		if err = rows.Scan(&note.UUID, &note.BookUUID, &note.Body, &note.Public, &note.Deleted, &note.USN, &note.AddedOn); err != nil {
+		if err = rows.Scan(&note.UUID, &note.BookUUID, &note.Title, &note.Body, &note.Public, &note.Visibility, &note.Deleted, &note.USN, &note.AddedOn, &note.TrashedOn); err != nil {
 			return isBehind, errors.Wrap(err, "scanning a syncable note")
 		}
+		bar.Increment()
+
+		if !note.Deleted {
+			if err := checkNoteBody(note); err != nil {
+				return isBehind, err
+			}
+		}
 
 		log.Debug("sending note %s\n", note.UUID)
 
@@ -755,16 +1045,30 @@ func sendNotes(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 
 		// if new, create it in the server, or else, update.
 		if note.USN == 0 {
-			if note.Deleted {
+			if note.Deleted && note.TrashedOn > 0 {
+				// if a note was added and moved to the trash locally, keep it in the trash without sending
+				if _, err = tx.Exec("UPDATE notes SET dirty = ? WHERE uuid = ?", false, note.UUID); err != nil {
+					return isBehind, errors.Wrap(err, "marking note not dirty")
+				}
+
+				tracef(traceDecision, "note %s: kept in the trash without sending because it was never uploaded\n", note.UUID)
+				continue
+			} else if note.Deleted {
 				// if a note was added and deleted locally, simply expunge
 				err = note.Expunge(tx)
 				if err != nil {
 					return isBehind, errors.Wrap(err, "expunging a note locally")
 				}
 
+				tracef(traceDecision, "note %s: deleted locally without sending because it was never uploaded\n", note.UUID)
 				continue
 			} else {
-				resp, err := client.CreateNote(ctx, note.BookUUID, note.Body)
+				metadata, err := getNoteMetadataBlob(tx, codec, note.UUID)
+				if err != nil {
+					return isBehind, err
+				}
+
+				resp, err := client.CreateNote(ctx, note.BookUUID, note.Title, note.Body, metadata)
 				if err != nil {
 					return isBehind, errors.Wrap(err, "creating a note")
 				}
@@ -790,14 +1094,24 @@ func sendNotes(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 					return isBehind, errors.Wrap(err, "deleting a note")
 				}
 
-				err = note.Expunge(tx)
+				// keep the notes in the trash until the trash is emptied
+				if note.TrashedOn > 0 {
+					_, err = tx.Exec("UPDATE notes SET usn = ?, dirty = ? WHERE uuid = ?", resp.Result.USN, false, note.UUID)
+				} else {
+					err = note.Expunge(tx)
+				}
 				if err != nil {
 					return isBehind, errors.Wrap(err, "expunging a note locally")
 				}
 
 				respUSN = resp.Result.USN
 			} else {
-				resp, err := client.UpdateNote(ctx, note.UUID, note.BookUUID, note.Body, note.Public)
+				metadata, err := getNoteMetadataBlob(tx, codec, note.UUID)
+				if err != nil {
+					return isBehind, err
+				}
+
+				resp, err := client.UpdateNote(ctx, note.UUID, note.BookUUID, note.Title, note.Body, note.Visibility, metadata)
 				if err != nil {
 					return isBehind, errors.Wrap(err, "updating a note")
 				}
@@ -819,6 +1133,8 @@ func sendNotes(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 		}
 
 		log.Debug("sent note %s. response USN %d. last max usn: %d\n", note.UUID, respUSN, lastMaxUSN)
+		tracef(traceDecision, "note %s: sent\n", note.UUID)
+		tracef(traceDetail, "note %s: response usn %d. last max usn %d\n", note.UUID, respUSN, lastMaxUSN)
 
 		if respUSN == lastMaxUSN+1 {
 			err = updateLastMaxUSN(tx, lastMaxUSN+1)
@@ -833,27 +1149,40 @@ func sendNotes(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
 	return isBehind, nil
 }
 
-func sendChanges(ctx context.DnoteCtx, tx *database.DB) (bool, error) {
-	log.Info("sending changes.")
+func sendChanges(ctx context.DnoteCtx, tx *database.DB, s *summary) (bool, error) {
+	bar := progress.New(getProgressMode(), "sending changes")
 
-	var delta int
-	err := tx.QueryRow("SELECT (SELECT count(*) FROM notes WHERE dirty) + (SELECT count(*) FROM books WHERE dirty)").Scan(&delta)
+	var bookCount, noteCount int
+	if err := tx.QueryRow("SELECT count(*) FROM books WHERE dirty = ?", true).Scan(&bookCount); err != nil {
+		return false, errors.Wrap(err, "counting dirty books")
+	}
+	if err := tx.QueryRow("SELECT count(*) FROM notes WHERE dirty = ?", true).Scan(&noteCount); err != nil {
+		return false, errors.Wrap(err, "counting dirty notes")
+	}
 
-	fmt.Printf(" (total %d).", delta)
+	bar.SetTotal(bookCount + noteCount)
 
-	behind1, err := sendBooks(ctx, tx)
+	behind1, err := sendBooks(ctx, tx, bar)
 	if err != nil {
 		return behind1, errors.Wrap(err, "sending books")
 	}
 
-	behind2, err := sendNotes(ctx, tx)
+	behind2, err := sendNotes(ctx, tx, bar)
 	if err != nil {
 		return behind2, errors.Wrap(err, "sending notes")
 	}
 
-	fmt.Println(" done.")
+	behind3, err := sendBookRemovals(ctx, tx, bar)
+	if err != nil {
+		return behind3, errors.Wrap(err, "sending book removals")
+	}
+
+	bar.Done()
+
+	s.Pushed.Books += bookCount
+	s.Pushed.Notes += noteCount
 
-	isBehind := behind1 || behind2
+	isBehind := behind1 || behind2 || behind3
 
 	return isBehind, nil
 }
@@ -885,79 +1214,317 @@ func saveSyncState(tx *database.DB, serverTime int64, serverMaxUSN int) error {
 	return nil
 }
 
-func newRun(ctx context.DnoteCtx) infra.RunEFunc {
-	return func(cmd *cobra.Command, args []string) error {
-		if ctx.SessionKey == "" {
-			return errors.New("not logged in")
-		}
+// result is the JSON representation of the result of a sync
+type result struct {
+	LastMaxUSN int           `json:"last_max_usn"`
+	LastSyncAt int           `json:"last_sync_at"`
+	Removed    removalReport `json:"removed"`
+}
 
-		if err := migrate.Run(ctx, migrate.RemoteSequence, migrate.RemoteMode); err != nil {
-			return errors.Wrap(err, "running remote migrations")
-		}
+func printJSON(ctx context.DnoteCtx, report removalReport) error {
+	ret := result{Removed: report}
+
+	var err error
+	if ret.LastMaxUSN, err = getLastMaxUSN(ctx.DB); err != nil {
+		return errors.Wrap(err, "getting the last max_usn")
+	}
+	if ret.LastSyncAt, err = getLastSyncAt(ctx.DB); err != nil {
+		return errors.Wrap(err, "getting the last sync time")
+	}
+
+	return output.JSON(ret)
+}
+
+// reportOffline tells that the sync is skipped because the server cannot be reached
+func reportOffline(ctx context.DnoteCtx) error {
+	if _, err := pending.Compact(ctx.DB); err != nil {
+		return errors.Wrap(err, "compacting the pending changes")
+	}
+
+	c, err := pending.Count(ctx.DB)
+	if err != nil {
+		return errors.Wrap(err, "counting the pending changes")
+	}
 
-		tx, err := ctx.DB.Begin()
+	log.Warnf("you are offline. Skipping the sync.\n")
+	if c.Total() > 0 {
+		estimate, err := pending.Estimate(ctx.DB, c)
 		if err != nil {
-			return errors.Wrap(err, "beginning a transaction")
+			return errors.Wrap(err, "estimating the sync time")
 		}
 
-		syncState, err := client.GetSyncState(ctx)
-		if err != nil {
-			return errors.Wrap(err, "getting the sync state from the server")
+		log.Plainf("%d changes are kept on this device and will be uploaded on the next sync, which will take %s.\n", c.Total(), pending.FormatEstimate(estimate))
+	}
+
+	return nil
+}
+
+// runSync syncs the data with the server, recording the result in the given summary
+func runSync(ctx context.DnoteCtx, s *summary, report *removalReport) error {
+	if ctx.SessionKey == "" {
+		return errors.New("not logged in")
+	}
+
+	if err := client.Probe(ctx); client.IsOffline(err) {
+		s.Offline = true
+		return reportOffline(ctx)
+	} else if err != nil {
+		return errors.Wrap(err, "checking the connection")
+	}
+
+	if pending, err := migrate.Pending(ctx, migrate.RemoteSequence, migrate.RemoteMode); err != nil {
+		return errors.Wrap(err, "checking the remote migrations")
+	} else if pending {
+		if _, err := backup.Auto(ctx, backup.ReasonMigration); err != nil {
+			return errors.Wrap(err, "backing up the database before the remote migrations")
 		}
-		lastSyncAt, err := getLastSyncAt(tx)
+	}
+	if err := migrate.Run(ctx, migrate.RemoteSequence, migrate.RemoteMode); err != nil {
+		return errors.Wrap(err, "running remote migrations")
+	}
+
+	if !ctx.CaseSensitiveBooks {
+		collisions, err := database.GetBookLabelCollisions(ctx.DB)
 		if err != nil {
-			return errors.Wrap(err, "getting the last sync time")
+			return errors.Wrap(err, "checking book names")
 		}
-		lastMaxUSN, err := getLastMaxUSN(tx)
-		if err != nil {
-			return errors.Wrap(err, "getting the last max_usn")
+		if len(collisions) > 0 {
+			log.Warnf("some books have names that differ only in case. Run `dnote books dedupe` to merge them.\n")
 		}
+	}
 
-		log.Debug("lastSyncAt: %d, lastMaxUSN: %d, syncState: %+v\n", lastSyncAt, lastMaxUSN, syncState)
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	syncState, err := client.GetSyncState(ctx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "getting the sync state from the server")
+	}
+	lastSyncAt, err := getLastSyncAt(tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "getting the last sync time")
+	}
+	lastMaxUSN, err := getLastMaxUSN(tx)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "getting the last max_usn")
+	}
+
+	log.Debug("lastSyncAt: %d, lastMaxUSN: %d, syncState: %+v\n", lastSyncAt, lastMaxUSN, syncState)
+
+	tracef(traceStep, "server max usn %d, full sync before %d. local last max usn %d, last sync at %d\n",
+		syncState.MaxUSN, syncState.FullSyncBefore, lastMaxUSN, lastSyncAt)
 
-		var syncErr error
-		if isFullSync || lastSyncAt < syncState.FullSyncBefore {
-			syncErr = fullSync(ctx, tx)
-		} else if lastMaxUSN != syncState.MaxUSN {
-			syncErr = stepSync(ctx, tx, lastMaxUSN)
+	pullStart := ctx.Clock.Now()
+	var syncErr error
+	if isFullSync || lastSyncAt < syncState.FullSyncBefore {
+		s.FullSync = true
+
+		if isFullSync {
+			tracef(traceStep, "performing a full sync as requested\n")
 		} else {
-			// if no need to sync from the server, simply update the last sync timestamp and proceed to send changes
-			err = updateLastSyncAt(tx, syncState.CurrentTime)
-			if err != nil {
-				return errors.Wrap(err, "updating last sync at")
-			}
+			tracef(traceStep, "performing a full sync because the server requires it\n")
 		}
-		if syncErr != nil {
+
+		// a full sync can remove many local notes, so keep a copy to roll back to
+		if _, err := backup.Auto(ctx, backup.ReasonFullSync); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "backing up the database before the full sync")
+		}
+
+		syncErr = fullSync(ctx, tx, report, s)
+	} else if lastMaxUSN != syncState.MaxUSN {
+		tracef(traceStep, "performing a step sync because the server has changes\n")
+
+		syncErr = stepSync(ctx, tx, lastMaxUSN, report, s)
+	} else {
+		tracef(traceStep, "skipping the sync from the server because it has no changes\n")
+
+		// if no need to sync from the server, simply update the last sync timestamp and proceed to send changes
+		err = updateLastSyncAt(tx, syncState.CurrentTime)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "updating last sync at")
+		}
+	}
+	s.Durations.Pull = ctx.Clock.Now().Sub(pullStart).Milliseconds()
+	if syncErr != nil {
+		tx.Rollback()
+		return errors.Wrap(syncErr, "syncing changes from the server")
+	}
+
+	pushStart := ctx.Clock.Now()
+	isBehind, err := sendChanges(ctx, tx, s)
+	pushElapsed := ctx.Clock.Now().Sub(pushStart)
+	s.Durations.Push = pushElapsed.Milliseconds()
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "sending changes")
+	}
+
+	if err := pending.SaveTimePerChange(tx, pushElapsed, s.Pushed.Books+s.Pushed.Notes); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving the sync time")
+	}
+
+	// if server state gets ahead of that of client during the sync, do an additional step sync
+	if isBehind {
+		log.Debug("performing another step sync because client is behind\n")
+		tracef(traceStep, "performing another step sync because the server changed while sending changes\n")
+
+		updatedLastMaxUSN, err := getLastMaxUSN(tx)
+		if err != nil {
 			tx.Rollback()
-			return errors.Wrap(syncErr, "syncing changes from the server")
+			return errors.Wrap(err, "getting the new last max_usn")
 		}
 
-		isBehind, err := sendChanges(ctx, tx)
+		pullStart := ctx.Clock.Now()
+		err = stepSync(ctx, tx, updatedLastMaxUSN, report, s)
+		s.Durations.Pull += ctx.Clock.Now().Sub(pullStart).Milliseconds()
 		if err != nil {
 			tx.Rollback()
-			return errors.Wrap(err, "sending changes")
+			return errors.Wrap(err, "performing the follow-up step sync")
+		}
+	}
+
+	// save the removed notes before committing so that they are not lost if saving fails
+	if recoveryFile != "" && !report.isEmpty() {
+		if err := report.save(recoveryFile); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "saving the removed notes")
+		}
+	}
+
+	tx.Commit()
+
+	if err := thin.Update(ctx); err != nil {
+		return errors.Wrap(err, "updating the locally stored notes for the thin mode")
+	}
+
+	log.Success("success\n")
+
+	if output.IsJSON() {
+		if err := printJSON(ctx, *report); err != nil {
+			return errors.Wrap(err, "printing the result")
+		}
+	} else if !report.isEmpty() {
+		report.print()
+
+		if recoveryFile != "" {
+			log.Infof("saved the removed notes to %s\n", recoveryFile)
+		}
+	}
+
+	return nil
+}
+
+// reportSync writes the summary of the sync to the summary file and posts it to the
+// webhook, if they are configured. Their failures are logged without failing the sync.
+func reportSync(ctx context.DnoteCtx, s *summary, report removalReport, syncErr error) {
+	if summaryFile == "" && ctx.SyncWebhook == "" {
+		return
+	}
+
+	s.finish(ctx.Clock.Now(), report, syncErr)
+
+	if summaryFile != "" {
+		if err := s.save(summaryFile); err != nil {
+			log.Error(errors.Wrap(err, "saving the sync summary").Error())
+		}
+	}
+	if ctx.SyncWebhook != "" {
+		if err := postWebhook(ctx.SyncWebhook, *s); err != nil {
+			log.Error(errors.Wrap(err, "posting the sync summary to the webhook").Error())
 		}
+	}
+}
+
+// mirrorNotes mirrors the notes into the git repository after a sync, if it is
+// configured. A failure is logged without failing the sync.
+func mirrorNotes(ctx context.DnoteCtx, s summary, syncErr error) {
+	if ctx.SyncGitMirror == "" || syncErr != nil || s.Offline {
+		return
+	}
+
+	if _, err := mirror.Git(ctx, ctx.SyncGitMirror, ""); err != nil {
+		log.Error(errors.Wrapf(err, "mirroring the notes to %s", ctx.SyncGitMirror).Error())
+	}
+}
 
-		// if server state gets ahead of that of client during the sync, do an additional step sync
-		if isBehind {
-			log.Debug("performing another step sync because client is behind\n")
+// Run syncs the data with the server as the sync command does without any flags
+func Run(ctx context.DnoteCtx) error {
+	s := newSummary(ctx.Clock.Now())
+	report := newRemovalReport()
 
-			updatedLastMaxUSN, err := getLastMaxUSN(tx)
+	return runSync(ctx, &s, &report)
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if watchFlag && intervalFlag <= 0 {
+			return errors.New("--interval must be positive")
+		}
+		if watchFlag && (isFullSync || offlineCheck) {
+			return errors.New("--watch cannot be used with --full or --offline-check")
+		}
+
+		if pageSize != 0 {
+			ctx.SyncPageSize = pageSize
+		}
+		if err := client.CheckSyncPageSize(ctx.SyncPageSize); err != nil {
+			return err
+		}
+		if maxRPS < 0 {
+			return errors.New("the requests per second must not be negative")
+		} else if maxRPS > 0 {
+			ctx.Throttle.MaxRPS = maxRPS
+		}
+		if maxBandwidth != "" {
+			n, err := client.ParseBandwidth(maxBandwidth)
 			if err != nil {
-				tx.Rollback()
-				return errors.Wrap(err, "getting the new last max_usn")
+				return err
 			}
 
-			err = stepSync(ctx, tx, updatedLastMaxUSN)
+			ctx.Throttle.MaxBandwidth = n
+		}
+
+		if viaSSH != "" {
+			t, err := openSSHTunnel(viaSSH, ctx.APIEndpoint)
 			if err != nil {
-				tx.Rollback()
-				return errors.Wrap(err, "performing the follow-up step sync")
+				return errors.Wrapf(err, "opening an SSH tunnel through %s", viaSSH)
 			}
+			defer t.Close()
+
+			ctx.APIDialAddr = t.Addr
+		}
+
+		if watchFlag {
+			return runDaemon(ctx, intervalFlag)
 		}
 
-		tx.Commit()
+		if offlineCheck {
+			if err := client.Probe(ctx); err != nil {
+				return err
+			}
 
-		log.Success("success\n")
+			log.Successf("online. %s can be reached\n", ctx.APIEndpoint)
+			return nil
+		}
+
+		s := newSummary(ctx.Clock.Now())
+		report := newRemovalReport()
+
+		syncErr := runSync(ctx, &s, &report)
+
+		reportSync(ctx, &s, report, syncErr)
+		mirrorNotes(ctx, s, syncErr)
+		if syncErr != nil {
+			return syncErr
+		}
 
 		if err := upgrade.Check(ctx); err != nil {
 			log.Error(errors.Wrap(err, "automatically checking updates").Error())
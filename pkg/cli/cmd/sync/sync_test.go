@@ -32,6 +32,7 @@ import (
 	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/progress"
 	"github.com/dnote/dnote/pkg/cli/testutils"
 	"github.com/pkg/errors"
 )
@@ -104,6 +105,54 @@ func TestProcessFragments(t *testing.T) {
 	assert.DeepEqual(t, sl, expected, "syncList mismatch")
 }
 
+func TestProcessFragments_checksum(t *testing.T) {
+	testCases := []struct {
+		checksum    string
+		deleted     bool
+		expectedErr bool
+	}{
+		{
+			checksum:    client.Checksum("n1-body"),
+			expectedErr: false,
+		},
+		{
+			checksum:    "",
+			expectedErr: false,
+		},
+		{
+			checksum:    client.Checksum("n1-body-corrupted"),
+			expectedErr: true,
+		},
+		{
+			checksum:    client.Checksum("n1-body-corrupted"),
+			deleted:     true,
+			expectedErr: false,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			fragments := []client.SyncFragment{
+				{
+					FragMaxUSN: 1,
+					UserMaxUSN: 1,
+					Notes: []client.SyncFragNote{
+						{
+							UUID:     "n1-uuid",
+							Body:     "n1-body",
+							Deleted:  tc.deleted,
+							Checksum: tc.checksum,
+						},
+					},
+				},
+			}
+
+			_, err := processFragments(fragments)
+			assert.Equal(t, err != nil, tc.expectedErr, "error mismatch")
+		})
+	}
+}
+
 func TestGetLastSyncAt(t *testing.T) {
 	// set up
 	db := database.InitTestDB(t, "../../tmp/.dnote", nil)
@@ -150,59 +199,6 @@ func TestGetLastMaxUSN(t *testing.T) {
 	assert.Equal(t, got, 20001, "last_max_usn mismatch")
 }
 
-func TestResolveLabel(t *testing.T) {
-	testCases := []struct {
-		input    string
-		expected string
-	}{
-		{
-			input:    "js",
-			expected: "js_2",
-		},
-		{
-			input:    "css",
-			expected: "css_3",
-		},
-		{
-			input:    "linux",
-			expected: "linux_4",
-		},
-		{
-			input:    "cool_ideas",
-			expected: "cool_ideas_2",
-		},
-	}
-
-	for idx, tc := range testCases {
-		func() {
-			// set up
-			db := database.InitTestDB(t, "../../tmp/.dnote", nil)
-			defer database.TeardownTestDB(t, db)
-
-			database.MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
-			database.MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css_2")
-			database.MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b3-uuid", "linux_(1)")
-			database.MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b4-uuid", "linux_2")
-			database.MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b5-uuid", "linux_3")
-			database.MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b6-uuid", "cool_ideas")
-
-			// execute
-			tx, err := db.Begin()
-			if err != nil {
-				t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
-			}
-
-			got, err := resolveLabel(tx, tc.input)
-			if err != nil {
-				t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
-			}
-			tx.Rollback()
-
-			assert.Equal(t, got, tc.expected, fmt.Sprintf("output mismatch for test case %d", idx))
-		}()
-	}
-}
-
 func TestSyncDeleteNote(t *testing.T) {
 	t.Run("exists on server only", func(t *testing.T) {
 		// set up
@@ -215,7 +211,7 @@ func TestSyncDeleteNote(t *testing.T) {
 			t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
 		}
 
-		if err := syncDeleteNote(tx, "nonexistent-note-uuid"); err != nil {
+		if err := syncDeleteNote(tx, "nonexistent-note-uuid", &removalReport{}); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -257,7 +253,7 @@ func TestSyncDeleteNote(t *testing.T) {
 			t.Fatalf(errors.Wrap(err, "beginning a transaction for test case").Error())
 		}
 
-		if err := syncDeleteNote(tx, "n1-uuid"); err != nil {
+		if err := syncDeleteNote(tx, "n1-uuid", &removalReport{}); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -327,7 +323,7 @@ func TestSyncDeleteNote(t *testing.T) {
 			t.Fatalf(errors.Wrap(err, "beginning a transaction for test case").Error())
 		}
 
-		if err := syncDeleteNote(tx, "n1-uuid"); err != nil {
+		if err := syncDeleteNote(tx, "n1-uuid", &removalReport{}); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -376,7 +372,7 @@ func TestSyncDeleteBook(t *testing.T) {
 			t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
 		}
 
-		if err := syncDeleteBook(tx, "nonexistent-book-uuid"); err != nil {
+		if err := syncDeleteBook(tx, "nonexistent-book-uuid", &removalReport{}); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -427,7 +423,7 @@ func TestSyncDeleteBook(t *testing.T) {
 			t.Fatalf(errors.Wrap(err, "beginning a transaction for test case").Error())
 		}
 
-		if err := syncDeleteBook(tx, b1UUID); err != nil {
+		if err := syncDeleteBook(tx, b1UUID, &removalReport{}); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -495,7 +491,7 @@ func TestSyncDeleteBook(t *testing.T) {
 			t.Fatalf(errors.Wrap(err, "beginning a transaction for test case").Error())
 		}
 
-		if err := syncDeleteBook(tx, b1UUID); err != nil {
+		if err := syncDeleteBook(tx, b1UUID, &removalReport{}); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -550,7 +546,7 @@ func TestSyncDeleteBook(t *testing.T) {
 			t.Fatalf(errors.Wrap(err, "beginning a transaction for test case").Error())
 		}
 
-		if err := syncDeleteBook(tx, b1UUID); err != nil {
+		if err := syncDeleteBook(tx, b1UUID, &removalReport{}); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -587,6 +583,26 @@ func TestSyncDeleteBook(t *testing.T) {
 	})
 }
 
+// syncNote merges the note from the server in a full or step sync, and inserts it if new
+func syncNote(tx *database.DB, n client.SyncFragNote, full bool) error {
+	m, err := newNoteMerger(tx, &summary{}, full, nil)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+
+	if full {
+		err = m.fullSyncNote(n)
+	} else {
+		err = m.stepSyncNote(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.flush()
+}
+
 func TestFullSyncNote(t *testing.T) {
 	t.Run("exists on server only", func(t *testing.T) {
 		// set up
@@ -612,7 +628,7 @@ func TestFullSyncNote(t *testing.T) {
 			Deleted:  false,
 		}
 
-		if err := fullSyncNote(tx, n); err != nil {
+		if err := syncNote(tx, n, true); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -848,7 +864,7 @@ n1 body edited
 					Deleted:  tc.serverDeleted,
 				}
 
-				if err := fullSyncNote(tx, n); err != nil {
+				if err := syncNote(tx, n, true); err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
 				}
@@ -905,7 +921,7 @@ func TestFullSyncBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := fullSyncBook(tx, b); err != nil {
+		if err := fullSyncBook(tx, b, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1043,7 +1059,7 @@ func TestFullSyncBook(t *testing.T) {
 					Deleted: tc.serverDeleted,
 				}
 
-				if err := fullSyncBook(tx, b); err != nil {
+				if err := fullSyncBook(tx, b, false); err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
 				}
@@ -1098,7 +1114,7 @@ func TestStepSyncNote(t *testing.T) {
 			Deleted:  false,
 		}
 
-		if err := stepSyncNote(tx, n); err != nil {
+		if err := syncNote(tx, n, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1260,7 +1276,7 @@ n1 body edited
 					Deleted:  tc.serverDeleted,
 				}
 
-				if err := stepSyncNote(tx, n); err != nil {
+				if err := syncNote(tx, n, false); err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
 				}
@@ -1317,7 +1333,7 @@ func TestStepSyncBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := stepSyncBook(tx, b); err != nil {
+		if err := stepSyncBook(tx, b, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1441,7 +1457,7 @@ func TestStepSyncBook(t *testing.T) {
 					Deleted: tc.serverDeleted,
 				}
 
-				if err := fullSyncBook(tx, b); err != nil {
+				if err := fullSyncBook(tx, b, false); err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
 				}
@@ -1500,7 +1516,7 @@ func TestMergeBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := mergeBook(tx, b1, modeInsert); err != nil {
+		if err := mergeBook(tx, b1, modeInsert, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1545,7 +1561,7 @@ func TestMergeBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := mergeBook(tx, b, modeInsert); err != nil {
+		if err := mergeBook(tx, b, modeInsert, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1600,7 +1616,7 @@ func TestMergeBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := mergeBook(tx, b, modeInsert); err != nil {
+		if err := mergeBook(tx, b, modeInsert, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1668,7 +1684,7 @@ func TestMergeBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := mergeBook(tx, b1, modeUpdate); err != nil {
+		if err := mergeBook(tx, b1, modeUpdate, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1715,7 +1731,7 @@ func TestMergeBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := mergeBook(tx, b, modeUpdate); err != nil {
+		if err := mergeBook(tx, b, modeUpdate, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1771,7 +1787,7 @@ func TestMergeBook(t *testing.T) {
 			Deleted: false,
 		}
 
-		if err := mergeBook(tx, b, modeUpdate); err != nil {
+		if err := mergeBook(tx, b, modeUpdate, false); err != nil {
 			tx.Rollback()
 			t.Fatalf(errors.Wrap(err, "executing").Error())
 		}
@@ -1816,6 +1832,119 @@ func TestMergeBook(t *testing.T) {
 		assert.Equal(t, b4Record.USN, 4, "b4 USN mismatch")
 		assert.Equal(t, b4Record.Dirty, false, "b4 Dirty mismatch")
 	})
+
+	t.Run("insert, duplicate in a different case", func(t *testing.T) {
+		testCases := []struct {
+			caseSensitive bool
+			expectedLabel string
+			expectedDirty bool
+		}{
+			{
+				caseSensitive: false,
+				expectedLabel: "JS_3",
+				expectedDirty: true,
+			},
+			{
+				caseSensitive: true,
+				expectedLabel: "js",
+				expectedDirty: false,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("case sensitive %t", tc.caseSensitive), func(t *testing.T) {
+				// set up
+				db := database.InitTestDB(t, dbPath, nil)
+				defer database.TeardownTestDB(t, db)
+
+				database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, usn, label, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b1-uuid", 1, "js", false, false)
+				database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, usn, label, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b2-uuid", 2, "js_2", false, false)
+
+				// test
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+				}
+
+				b := client.SyncFragBook{
+					UUID:    "b3-uuid",
+					USN:     12,
+					AddedOn: 1541108743,
+					Label:   "JS",
+					Deleted: false,
+				}
+
+				if err := mergeBook(tx, b, modeInsert, tc.caseSensitive); err != nil {
+					tx.Rollback()
+					t.Fatalf(errors.Wrap(err, "executing").Error())
+				}
+
+				tx.Commit()
+
+				// execute
+				var bookCount int
+				database.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+				assert.Equalf(t, bookCount, 3, "book count mismatch")
+
+				var b1Record, b2Record, b3Record database.Book
+				database.MustScan(t, "getting b1",
+					db.QueryRow("SELECT label, dirty FROM books WHERE uuid = ?", "b1-uuid"),
+					&b1Record.Label, &b1Record.Dirty)
+				database.MustScan(t, "getting b2",
+					db.QueryRow("SELECT label, dirty FROM books WHERE uuid = ?", "b2-uuid"),
+					&b2Record.Label, &b2Record.Dirty)
+				database.MustScan(t, "getting b3",
+					db.QueryRow("SELECT label, dirty FROM books WHERE uuid = ?", "b3-uuid"),
+					&b3Record.Label, &b3Record.Dirty)
+
+				assert.Equal(t, b1Record.Label, tc.expectedLabel, "b1 Label mismatch")
+				assert.Equal(t, b1Record.Dirty, tc.expectedDirty, "b1 Dirty mismatch")
+				assert.Equal(t, b2Record.Label, "js_2", "b2 Label mismatch")
+				assert.Equal(t, b2Record.Dirty, false, "b2 Dirty mismatch")
+				assert.Equal(t, b3Record.Label, "JS", "b3 Label mismatch")
+				assert.Equal(t, b3Record.Dirty, false, "b3 Dirty mismatch")
+			})
+		}
+	})
+
+	t.Run("update, label changed in case", func(t *testing.T) {
+		// set up
+		db := database.InitTestDB(t, dbPath, nil)
+		defer database.TeardownTestDB(t, db)
+
+		database.MustExec(t, "inserting book", db, "INSERT INTO books (uuid, usn, label, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b1-uuid", 1, "js", false, false)
+
+		// test
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+		}
+
+		b := client.SyncFragBook{
+			UUID:    "b1-uuid",
+			USN:     12,
+			AddedOn: 1541108743,
+			Label:   "JS",
+			Deleted: false,
+		}
+
+		if err := mergeBook(tx, b, modeUpdate, false); err != nil {
+			tx.Rollback()
+			t.Fatalf(errors.Wrap(err, "executing").Error())
+		}
+
+		tx.Commit()
+
+		// execute
+		var b1Record database.Book
+		database.MustScan(t, "getting b1",
+			db.QueryRow("SELECT label, usn, dirty FROM books WHERE uuid = ?", "b1-uuid"),
+			&b1Record.Label, &b1Record.USN, &b1Record.Dirty)
+
+		assert.Equal(t, b1Record.Label, "JS", "b1 Label mismatch")
+		assert.Equal(t, b1Record.USN, 12, "b1 USN mismatch")
+		assert.Equal(t, b1Record.Dirty, false, "b1 Dirty mismatch")
+	})
 }
 
 func TestSaveServerState(t *testing.T) {
@@ -1958,10 +2087,16 @@ func TestSendBooks(t *testing.T) {
 		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
 	}
 
-	if _, err := sendBooks(ctx, tx); err != nil {
+	if _, err := sendBooks(ctx, tx, progress.New(progress.ModeNone, "sending books")); err != nil {
 		tx.Rollback()
 		t.Fatalf(errors.Wrap(err, "executing").Error())
 	}
+	assert.DeepEqual(t, deletedUUIDs, []string(nil), "books should not be deleted before the notes are sent")
+
+	if _, err := sendBookRemovals(ctx, tx, progress.New(progress.ModeNone, "sending book removals")); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing the removals").Error())
+	}
 
 	tx.Commit()
 
@@ -2113,7 +2248,7 @@ func TestSendBooks_isBehind(t *testing.T) {
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
 				}
 
-				isBehind, err := sendBooks(ctx, tx)
+				isBehind, err := sendBooks(ctx, tx, progress.New(progress.ModeNone, "sending books"))
 				if err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
@@ -2161,7 +2296,7 @@ func TestSendBooks_isBehind(t *testing.T) {
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
 				}
 
-				isBehind, err := sendBooks(ctx, tx)
+				isBehind, err := sendBookRemovals(ctx, tx, progress.New(progress.ModeNone, "sending book removals"))
 				if err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
@@ -2209,7 +2344,7 @@ func TestSendBooks_isBehind(t *testing.T) {
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
 				}
 
-				isBehind, err := sendBooks(ctx, tx)
+				isBehind, err := sendBooks(ctx, tx, progress.New(progress.ModeNone, "sending books"))
 				if err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
@@ -2224,6 +2359,55 @@ func TestSendBooks_isBehind(t *testing.T) {
 	})
 }
 
+// TestSendChanges_order tests that the removal of a book is sent after the notes moved out
+// of it, because the server removes the notes in the book along with it
+func TestSendChanges_order(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+	// b1 was merged into b2
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b1-uuid", "b1-removed", 1, true, true)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b2-uuid", "b2-label", 2, false, true)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b2-uuid", 3, "n1-body", 1541108743, false, true)
+
+	var requests []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	if _, err := sendChanges(ctx, tx, &summary{}); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.DeepEqual(t, requests, []string{
+		"PATCH /v3/books/b2-uuid",
+		"PATCH /v3/notes/n1-uuid",
+		"DELETE /v3/books/b1-uuid",
+	}, "requests mismatch")
+}
+
 // TestSendNotes tests that notes are put to correct 'buckets' by running a test server and recording the
 // uuid from the incoming data.
 func TestSendNotes(t *testing.T) {
@@ -2322,7 +2506,7 @@ func TestSendNotes(t *testing.T) {
 		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
 	}
 
-	if _, err := sendNotes(ctx, tx); err != nil {
+	if _, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes")); err != nil {
 		tx.Rollback()
 		t.Fatalf(errors.Wrap(err, "executing").Error())
 	}
@@ -2422,7 +2606,7 @@ func TestSendNotes_addedOn(t *testing.T) {
 		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
 	}
 
-	if _, err := sendNotes(ctx, tx); err != nil {
+	if _, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes")); err != nil {
 		tx.Rollback()
 		t.Fatalf(errors.Wrap(err, "executing").Error())
 	}
@@ -2435,67 +2619,429 @@ func TestSendNotes_addedOn(t *testing.T) {
 	assert.Equal(t, n1.AddedOn, int64(1541108743), "n1 AddedOn mismatch")
 }
 
-func TestSendNotes_isBehind(t *testing.T) {
+func TestSendNotes_checksum(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 0, "n1-body", 1541108743, false, true)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", 3, "n2-body", 1541108743, false, true)
+
+	var createChecksum, updateChecksum string
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.String() == "/v3/notes" && r.Method == "POST" {
-			var payload client.CreateBookPayload
+		var payload struct {
+			Checksum string `json:"checksum"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf(errors.Wrap(err, "decoding payload").Error())
+		}
 
-			err := json.NewDecoder(r.Body).Decode(&payload)
-			if err != nil {
-				t.Fatalf(errors.Wrap(err, "decoding payload in the test server").Error())
-				return
+		var resp interface{}
+		if r.URL.String() == "/v3/notes" && r.Method == "POST" {
+			createChecksum = payload.Checksum
+			resp = client.CreateNoteResp{
+				Result: client.RespNote{UUID: testutils.MustGenerateUUID(t), USN: 10},
 			}
-
-			resp := client.CreateNoteResp{
-				Result: client.RespNote{
-					USN: 11,
-				},
+		} else if r.URL.String() == "/v3/notes/n2-uuid" && r.Method == "PATCH" {
+			updateChecksum = payload.Checksum
+			resp = client.UpdateNoteResp{
+				Result: client.RespNote{UUID: "n2-uuid", USN: 11},
 			}
+		} else {
+			t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+		}
 
-			w.Header().Set("Content-Type", "application/json")
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+	}))
+	defer ts.Close()
 
-		p := strings.Split(r.URL.Path, "/")
-		if len(p) == 4 && p[0] == "" && p[1] == "v3" && p[2] == "notes" {
-			if r.Method == "PATCH" {
-				resp := client.UpdateNoteResp{
-					Result: client.RespNote{
-						USN: 11,
-					},
-				}
+	ctx.APIEndpoint = ts.URL
 
-				w.Header().Set("Content-Type", "application/json")
-				if err := json.NewEncoder(w).Encode(resp); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				return
-			} else if r.Method == "DELETE" {
-				resp := client.DeleteNoteResp{
-					Result: client.RespNote{
-						USN: 11,
-					},
-				}
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
 
-				w.Header().Set("Content-Type", "application/json")
-				if err := json.NewEncoder(w).Encode(resp); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				return
+	if _, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes")); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.Equal(t, createChecksum, client.Checksum("n1-body"), "create checksum mismatch")
+	assert.Equal(t, updateChecksum, client.Checksum("n2-body"), "update checksum mismatch")
+}
+
+func TestSendNotes_title(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, title, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 0, "n1-title", "n1-body", 1541108743, false, true)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, title, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", 3, "n2-title", "n2-body", 1541108743, false, true)
+
+	var createTitle, updateTitle string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Title string `json:"title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf(errors.Wrap(err, "decoding payload").Error())
+		}
+
+		var resp interface{}
+		if r.URL.String() == "/v3/notes" && r.Method == "POST" {
+			createTitle = payload.Title
+			resp = client.CreateNoteResp{
+				Result: client.RespNote{UUID: "n1-uuid-new", USN: 10},
+			}
+		} else if r.URL.String() == "/v3/notes/n2-uuid" && r.Method == "PATCH" {
+			updateTitle = payload.Title
+			resp = client.UpdateNoteResp{
+				Result: client.RespNote{UUID: "n2-uuid", USN: 11},
 			}
+		} else {
+			t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
 		}
 
-		t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}))
 	defer ts.Close()
 
-	t.Run("create note", func(t *testing.T) {
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	if _, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes")); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.Equal(t, createTitle, "n1-title", "create title mismatch")
+	assert.Equal(t, updateTitle, "n2-title", "update title mismatch")
+
+	var n1Title, n2Title string
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT title FROM notes WHERE uuid = ?", "n1-uuid-new"), &n1Title)
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT title FROM notes WHERE uuid = ?", "n2-uuid"), &n2Title)
+	assert.Equal(t, n1Title, "n1-title", "n1 title mismatch")
+	assert.Equal(t, n2Title, "n2-title", "n2 title mismatch")
+}
+
+func TestStepSyncNote_title(t *testing.T) {
+	testCases := []struct {
+		title    string
+		expected string
+	}{
+		{
+			title:    "n1-title",
+			expected: "n1-title",
+		},
+		{
+			// a server that predates the note titles does not send them
+			title:    "",
+			expected: "n1 first line",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			// set up
+			db := database.InitTestDB(t, dbPath, nil)
+			defer database.TeardownTestDB(t, db)
+
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "b1-label", 1, false)
+
+			n := client.SyncFragNote{
+				UUID:     "n1-uuid",
+				BookUUID: "b1-uuid",
+				USN:      2,
+				AddedOn:  1541108743,
+				Title:    tc.title,
+				Body:     "n1 first line\nn1 second line",
+			}
+
+			// execute
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+			}
+
+			if err := syncNote(tx, n, false); err != nil {
+				tx.Rollback()
+				t.Fatalf(errors.Wrap(err, "executing").Error())
+			}
+
+			tx.Commit()
+
+			// test
+			var title string
+			database.MustScan(t, "getting n1", db.QueryRow("SELECT title FROM notes WHERE uuid = ?", "n1-uuid"), &title)
+			assert.Equal(t, title, tc.expected, "title mismatch")
+		})
+	}
+}
+
+func TestStepSyncNote_visibility(t *testing.T) {
+	testCases := []struct {
+		public     bool
+		visibility string
+		expected   string
+	}{
+		{
+			public:     true,
+			visibility: "public",
+			expected:   "public",
+		},
+		{
+			public:     false,
+			visibility: "private",
+			expected:   "private",
+		},
+		{
+			// a server that predates the visibility sends only the public field
+			public:     true,
+			visibility: "",
+			expected:   "unlisted",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("public %t visibility %s", tc.public, tc.visibility), func(t *testing.T) {
+			// set up
+			db := database.InitTestDB(t, dbPath, nil)
+			defer database.TeardownTestDB(t, db)
+
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty) VALUES (?, ?, ?, ?)", "b1-uuid", "b1-label", 1, false)
+
+			n := client.SyncFragNote{
+				UUID:       "n1-uuid",
+				BookUUID:   "b1-uuid",
+				USN:        2,
+				AddedOn:    1541108743,
+				Body:       "n1 body",
+				Public:     tc.public,
+				Visibility: tc.visibility,
+			}
+
+			// execute
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+			}
+
+			if err := syncNote(tx, n, false); err != nil {
+				tx.Rollback()
+				t.Fatalf(errors.Wrap(err, "executing").Error())
+			}
+
+			tx.Commit()
+
+			// test
+			var visibility string
+			var public bool
+			database.MustScan(t, "getting n1", db.QueryRow("SELECT public, visibility FROM notes WHERE uuid = ?", "n1-uuid"), &public, &visibility)
+			assert.Equal(t, public, tc.public, "public mismatch")
+			assert.Equal(t, visibility, tc.expected, "visibility mismatch")
+		})
+	}
+}
+
+func TestSendNotes_corruptedBody(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 0, "n1-body\xff\xfe", 1541108743, false, true)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("unexpected request Method: %s Path: %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	_, err = sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes"))
+	tx.Rollback()
+
+	// test
+	assert.NotEqual(t, err, nil, "error mismatch")
+
+	var n1 database.Note
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT usn, dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1.USN, &n1.Dirty)
+	assert.Equal(t, n1.USN, 0, "n1 USN mismatch")
+	assert.Equal(t, n1.Dirty, true, "n1 Dirty mismatch")
+}
+
+func TestSendNotes_trash(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+	// moved to the trash before being uploaded
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 0, "n1-body", 1541108743, true, true, 1541108744)
+	// moved to the trash after being uploaded
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", 3, "n2-body", 1541108743, true, true, 1541108744)
+	// removed from the trash permanently before its removal was synced
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", 4, "", 1541108743, true, true)
+
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v3/notes/") && r.Method == "DELETE" {
+			uuid := strings.TrimPrefix(r.URL.Path, "/v3/notes/")
+			deleted = append(deleted, uuid)
+
+			resp := client.DeleteNoteResp{
+				Result: client.RespNote{UUID: uuid, USN: 10 + len(deleted)},
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	if _, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes")); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.Equal(t, len(deleted), 2, "deleted count mismatch")
+
+	var n1, n2 database.Note
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT body, usn, deleted, dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1.Body, &n1.USN, &n1.Deleted, &n1.Dirty)
+	assert.Equal(t, n1.Body, "n1-body", "n1 body mismatch")
+	assert.Equal(t, n1.USN, 0, "n1 usn mismatch")
+	assert.Equal(t, n1.Dirty, false, "n1 dirty mismatch")
+
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT body, usn, deleted, dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2.Body, &n2.USN, &n2.Deleted, &n2.Dirty)
+	assert.Equal(t, n2.Body, "n2-body", "n2 body mismatch")
+	assert.NotEqual(t, n2.USN, 3, "n2 usn should be updated")
+	assert.Equal(t, n2.Deleted, true, "n2 deleted mismatch")
+	assert.Equal(t, n2.Dirty, false, "n2 dirty mismatch")
+
+	var n3Count int
+	database.MustScan(t, "counting n3", db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", "n3-uuid"), &n3Count)
+	assert.Equal(t, n3Count, 0, "n3 should be expunged")
+}
+
+func TestSendNotes_isBehind(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == "/v3/notes" && r.Method == "POST" {
+			var payload client.CreateBookPayload
+
+			err := json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				t.Fatalf(errors.Wrap(err, "decoding payload in the test server").Error())
+				return
+			}
+
+			resp := client.CreateNoteResp{
+				Result: client.RespNote{
+					USN: 11,
+				},
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		p := strings.Split(r.URL.Path, "/")
+		if len(p) == 4 && p[0] == "" && p[1] == "v3" && p[2] == "notes" {
+			if r.Method == "PATCH" {
+				resp := client.UpdateNoteResp{
+					Result: client.RespNote{
+						USN: 11,
+					},
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				if err := json.NewEncoder(w).Encode(resp); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				return
+			} else if r.Method == "DELETE" {
+				resp := client.DeleteNoteResp{
+					Result: client.RespNote{
+						USN: 11,
+					},
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				if err := json.NewEncoder(w).Encode(resp); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				return
+			}
+		}
+
+		t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	t.Run("create note", func(t *testing.T) {
 		testCases := []struct {
 			systemLastMaxUSN int
 			expectedIsBehind bool
@@ -2530,7 +3076,7 @@ func TestSendNotes_isBehind(t *testing.T) {
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
 				}
 
-				isBehind, err := sendNotes(ctx, tx)
+				isBehind, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes"))
 				if err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
@@ -2579,7 +3125,7 @@ func TestSendNotes_isBehind(t *testing.T) {
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
 				}
 
-				isBehind, err := sendNotes(ctx, tx)
+				isBehind, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes"))
 				if err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
@@ -2628,7 +3174,7 @@ func TestSendNotes_isBehind(t *testing.T) {
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
 				}
 
-				isBehind, err := sendNotes(ctx, tx)
+				isBehind, err := sendNotes(ctx, tx, progress.New(progress.ModeNone, "sending notes"))
 				if err != nil {
 					tx.Rollback()
 					t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
@@ -2643,6 +3189,85 @@ func TestSendNotes_isBehind(t *testing.T) {
 	})
 }
 
+func TestMergeNote_trash(t *testing.T) {
+	testCases := []struct {
+		serverDeleted   bool
+		serverBody      string
+		expectedBody    string
+		expectedDeleted bool
+		expectedTrashed bool
+		expectedDirty   bool
+		expectedUSN     int
+	}{
+		// deleted on the server as well
+		{
+			serverDeleted:   true,
+			serverBody:      "",
+			expectedBody:    "n1 body",
+			expectedDeleted: true,
+			expectedTrashed: true,
+			expectedDirty:   false,
+			expectedUSN:     21,
+		},
+		// edited on the server
+		{
+			serverDeleted:   false,
+			serverBody:      "n1 body edited",
+			expectedBody:    "n1 body edited",
+			expectedDeleted: false,
+			expectedTrashed: false,
+			expectedDirty:   false,
+			expectedUSN:     21,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// set up
+			db := database.InitTestDB(t, "../../tmp/.dnote", nil)
+			defer database.TeardownTestDB(t, db)
+
+			database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b1-uuid", "b1-label", 1, false, false)
+			database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 1, "n1 body", 1541232118, true, true, 1541232119)
+
+			var localNote database.Note
+			database.MustScan(t, "getting n1", db.QueryRow("SELECT uuid, book_uuid, body, usn, deleted, dirty, trashed_on FROM notes WHERE uuid = ?", "n1-uuid"),
+				&localNote.UUID, &localNote.BookUUID, &localNote.Body, &localNote.USN, &localNote.Deleted, &localNote.Dirty, &localNote.TrashedOn)
+
+			serverNote := client.SyncFragNote{
+				UUID:     "n1-uuid",
+				BookUUID: "b1-uuid",
+				USN:      21,
+				Body:     tc.serverBody,
+				Deleted:  tc.serverDeleted,
+			}
+
+			// execute
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+			}
+
+			if err := mergeNote(tx, serverNote, localNote, &summary{}); err != nil {
+				tx.Rollback()
+				t.Fatalf(errors.Wrap(err, "executing").Error())
+			}
+
+			tx.Commit()
+
+			// test
+			var n1 database.Note
+			database.MustScan(t, "getting n1", db.QueryRow("SELECT body, usn, deleted, dirty, trashed_on FROM notes WHERE uuid = ?", "n1-uuid"),
+				&n1.Body, &n1.USN, &n1.Deleted, &n1.Dirty, &n1.TrashedOn)
+			assert.Equal(t, n1.Body, tc.expectedBody, "n1 body mismatch")
+			assert.Equal(t, n1.USN, tc.expectedUSN, "n1 usn mismatch")
+			assert.Equal(t, n1.Deleted, tc.expectedDeleted, "n1 deleted mismatch")
+			assert.Equal(t, n1.Dirty, tc.expectedDirty, "n1 dirty mismatch")
+			assert.Equal(t, n1.TrashedOn > 0, tc.expectedTrashed, "n1 trashed mismatch")
+		})
+	}
+}
+
 func TestMergeNote(t *testing.T) {
 	b1UUID := "b1-uuid"
 	b2UUID := "b2-uuid"
@@ -2807,7 +3432,8 @@ n1 body edited
 				db.QueryRow("SELECT uuid, book_uuid, usn, added_on, edited_on, body, deleted, dirty FROM notes WHERE uuid = ?", n1UUID),
 				&localNote.UUID, &localNote.BookUUID, &localNote.USN, &localNote.AddedOn, &localNote.EditedOn, &localNote.Body, &localNote.Deleted, &localNote.Dirty)
 
-			if err := mergeNote(tx, fragNote, localNote); err != nil {
+			var s summary
+			if err := mergeNote(tx, fragNote, localNote, &s); err != nil {
 				tx.Rollback()
 				t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
 			}
@@ -2815,6 +3441,12 @@ n1 body edited
 			tx.Commit()
 
 			// test
+			expectedConflicts := 0
+			if tc.clientDirty && !tc.clientDeleted {
+				expectedConflicts = 1
+			}
+			assert.Equalf(t, s.Conflicts, expectedConflicts, fmt.Sprintf("conflict count mismatch for test case %d", idx))
+
 			var noteCount, bookCount int
 			database.MustScan(t, fmt.Sprintf("counting notes for test case %d", idx), db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
 			database.MustScan(t, fmt.Sprintf("counting books for test case %d", idx), db.QueryRow("SELECT count(*) FROM books"), &bookCount)
@@ -2907,7 +3539,7 @@ func TestCheckBookPristine(t *testing.T) {
 	})
 }
 
-func TestCheckNoteInList(t *testing.T) {
+func TestPulledResources_hasNote(t *testing.T) {
 	list := syncList{
 		Notes: map[string]client.SyncFragNote{
 			"n1-uuid": {
@@ -2936,6 +3568,8 @@ func TestCheckNoteInList(t *testing.T) {
 		MaxUSN:         1,
 		MaxCurrentTime: 2,
 	}
+	pulled := newPulledResources()
+	pulled.add(list)
 
 	testCases := []struct {
 		uuid     string
@@ -2964,12 +3598,12 @@ func TestCheckNoteInList(t *testing.T) {
 	}
 
 	for idx, tc := range testCases {
-		got := checkNoteInList(tc.uuid, &list)
+		got := pulled.hasNote(tc.uuid)
 		assert.Equal(t, got, tc.expected, fmt.Sprintf("result mismatch for test case %d", idx))
 	}
 }
 
-func TestCheckBookInList(t *testing.T) {
+func TestPulledResources_hasBook(t *testing.T) {
 	list := syncList{
 		Notes: map[string]client.SyncFragNote{
 			"n1-uuid": {
@@ -2998,6 +3632,8 @@ func TestCheckBookInList(t *testing.T) {
 		MaxUSN:         1,
 		MaxCurrentTime: 2,
 	}
+	pulled := newPulledResources()
+	pulled.add(list)
 
 	testCases := []struct {
 		uuid     string
@@ -3026,7 +3662,7 @@ func TestCheckBookInList(t *testing.T) {
 	}
 
 	for idx, tc := range testCases {
-		got := checkBookInList(tc.uuid, &list)
+		got := pulled.hasBook(tc.uuid)
 		assert.Equal(t, got, tc.expected, fmt.Sprintf("result mismatch for test case %d", idx))
 	}
 }
@@ -3064,6 +3700,8 @@ func TestCleanLocalNotes(t *testing.T) {
 		MaxUSN:         1,
 		MaxCurrentTime: 2,
 	}
+	pulled := newPulledResources()
+	pulled.add(list)
 
 	b1UUID := "b1-uuid"
 	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", b1UUID, "b1-label", 1, false, false)
@@ -3074,6 +3712,8 @@ func TestCleanLocalNotes(t *testing.T) {
 	// non-existent in the list but in valid state
 	// (created in the cli and hasn't been uploaded)
 	database.MustExec(t, "inserting n6", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n6-uuid", b1UUID, 0, "n6 body", 1541108743, false, true)
+	// (moved to the trash before being uploaded)
+	database.MustExec(t, "inserting n11", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n11-uuid", b1UUID, 0, "n11 body", 1541108743, true, false, 1541108744)
 	// non-existent in the list and in an invalid state
 	database.MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n5-uuid", b1UUID, 7, "n5 body", 1541108743, true, true)
 	database.MustExec(t, "inserting n9", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n9-uuid", b1UUID, 17, "n9 body", 1541108743, true, false)
@@ -3085,7 +3725,7 @@ func TestCleanLocalNotes(t *testing.T) {
 		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
 	}
 
-	if err := cleanLocalNotes(tx, &list); err != nil {
+	if err := cleanLocalNotes(tx, pulled, &removalReport{}); err != nil {
 		tx.Rollback()
 		t.Fatalf(errors.Wrap(err, "executing").Error())
 	}
@@ -3095,7 +3735,7 @@ func TestCleanLocalNotes(t *testing.T) {
 	// test
 	var noteCount int
 	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
-	assert.Equal(t, noteCount, 3, "note count mismatch")
+	assert.Equal(t, noteCount, 4, "note count mismatch")
 
 	var n1, n2, n6 database.Note
 	database.MustScan(t, "getting n1", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1.Dirty)
@@ -3136,6 +3776,8 @@ func TestCleanLocalBooks(t *testing.T) {
 		MaxUSN:         1,
 		MaxCurrentTime: 2,
 	}
+	pulled := newPulledResources()
+	pulled.add(list)
 
 	// existent in the server
 	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b1-uuid", "b1-label", 1, false, false)
@@ -3153,7 +3795,7 @@ func TestCleanLocalBooks(t *testing.T) {
 		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
 	}
 
-	if err := cleanLocalBooks(tx, &list); err != nil {
+	if err := cleanLocalBooks(tx, pulled, &removalReport{}); err != nil {
 		tx.Rollback()
 		t.Fatalf(errors.Wrap(err, "executing").Error())
 	}
@@ -3170,3 +3812,410 @@ func TestCleanLocalBooks(t *testing.T) {
 	database.MustScan(t, "getting b3", db.QueryRow("SELECT label FROM books WHERE uuid = ?", "b3-uuid"), &b3.Label)
 	database.MustScan(t, "getting b5", db.QueryRow("SELECT label FROM books WHERE uuid = ?", "b5-uuid"), &b5.Label)
 }
+
+func TestStepSync_team(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	b := client.SyncFragBook{
+		UUID:  "b1-uuid",
+		USN:   10,
+		Label: "team",
+		Owner: "alice@example.com",
+	}
+	n := client.SyncFragNote{
+		UUID:     "n1-uuid",
+		BookUUID: "b1-uuid",
+		USN:      11,
+		AddedOn:  1541232118,
+		Body:     "n1-body",
+		Author:   "bob@example.com",
+	}
+
+	if err := stepSyncBook(tx, b, false); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "syncing the book").Error())
+	}
+	if err := syncNote(tx, n, false); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "syncing the note").Error())
+	}
+
+	// the book changes hands
+	b.USN = 12
+	b.Owner = ""
+	if err := stepSyncBook(tx, b, false); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "syncing the book again").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	var owner, author string
+	database.MustScan(t, "getting the book", db.QueryRow("SELECT owner FROM books WHERE uuid = ?", "b1-uuid"), &owner)
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT author FROM notes WHERE uuid = ?", "n1-uuid"), &author)
+
+	assert.Equal(t, owner, "", "owner mismatch")
+	assert.Equal(t, author, "bob@example.com", "author mismatch")
+}
+
+func TestSyncDeleteBook_team(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, owner) VALUES (?, ?, ?, ?)", "b1-uuid", "team", 10, "alice@example.com")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, author, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 11, "n1-body", 1541232118, "alice@example.com", false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, author, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", 12, "n2-body", 1541232118, "bob@example.com", true)
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	// the server expunges the notes and then the book once the user is removed from it
+	report := removalReport{}
+	for _, uuid := range []string{"n1-uuid", "n2-uuid"} {
+		if err := syncDeleteNote(tx, uuid, &report); err != nil {
+			tx.Rollback()
+			t.Fatalf(errors.Wrap(err, "deleting the note").Error())
+		}
+	}
+	if err := syncDeleteBook(tx, "b1-uuid", &report); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "deleting the book").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	var noteCount int
+	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	assert.Equal(t, noteCount, 1, "note count mismatch")
+
+	var b1 database.Book
+	var owner string
+	database.MustScan(t, "getting b1",
+		db.QueryRow("SELECT label, usn, dirty, owner FROM books WHERE uuid = ?", "b1-uuid"),
+		&b1.Label, &b1.USN, &b1.Dirty, &owner)
+	assert.Equal(t, b1.Label, "team", "b1 label mismatch")
+	assert.Equal(t, b1.USN, 0, "b1 usn mismatch")
+	assert.Equal(t, b1.Dirty, true, "b1 dirty mismatch")
+	assert.Equal(t, owner, "", "b1 owner mismatch")
+
+	var n2 database.Note
+	var author string
+	database.MustScan(t, "getting n2",
+		db.QueryRow("SELECT book_uuid, usn, dirty, author FROM notes WHERE uuid = ?", "n2-uuid"),
+		&n2.BookUUID, &n2.USN, &n2.Dirty, &author)
+	assert.Equal(t, n2.BookUUID, "b1-uuid", "n2 book_uuid mismatch")
+	assert.Equal(t, n2.USN, 0, "n2 usn mismatch")
+	assert.Equal(t, n2.Dirty, true, "n2 dirty mismatch")
+	assert.Equal(t, author, "", "n2 author mismatch")
+}
+
+func TestNoteMerger_batch(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, dbPath, nil)
+	defer database.TeardownTestDB(t, db)
+
+	b1UUID := testutils.MustGenerateUUID(t)
+	database.MustExec(t, "inserting book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", b1UUID, "b1-label")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, usn, added_on, author) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", b1UUID, "n1-body", 5, 1541232118, "alice")
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	m, err := newNoteMerger(tx, &summary{}, true, nil)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "preparing the merger").Error())
+	}
+
+	count := pendingNoteLimit + 3
+	for i := 0; i < count; i++ {
+		n := client.SyncFragNote{
+			UUID:     fmt.Sprintf("new-%d", i),
+			BookUUID: b1UUID,
+			USN:      10 + i,
+			AddedOn:  1541232118,
+			Body:     fmt.Sprintf("body-%d", i),
+		}
+		if i == 0 {
+			n.Author = "bob"
+		}
+
+		if err := m.fullSyncNote(n); err != nil {
+			tx.Rollback()
+			t.Fatalf(errors.Wrap(err, "merging").Error())
+		}
+	}
+	if err := m.fullSyncNote(client.SyncFragNote{UUID: "n1-uuid", BookUUID: b1UUID, USN: 5, Body: "n1-body", Author: "carol"}); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "merging n1").Error())
+	}
+	if err := m.flush(); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "flushing").Error())
+	}
+	m.close()
+
+	tx.Commit()
+
+	// test
+	var noteCount int
+	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	assert.Equal(t, noteCount, count+1, "note count mismatch")
+
+	var lastBody, newAuthor, n1Author string
+	database.MustScan(t, "getting the last note", db.QueryRow("SELECT body FROM notes WHERE uuid = ?", fmt.Sprintf("new-%d", count-1)), &lastBody)
+	database.MustScan(t, "getting the author of new-0", db.QueryRow("SELECT author FROM notes WHERE uuid = ?", "new-0"), &newAuthor)
+	database.MustScan(t, "getting the author of n1", db.QueryRow("SELECT author FROM notes WHERE uuid = ?", "n1-uuid"), &n1Author)
+
+	assert.Equal(t, lastBody, fmt.Sprintf("body-%d", count-1), "last note body mismatch")
+	assert.Equal(t, newAuthor, "bob", "new-0 author mismatch")
+	assert.Equal(t, n1Author, "carol", "n1 author mismatch")
+}
+
+func TestFullSync_fragments(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+	database.MustExec(t, "inserting last sync at", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastSyncAt, 0)
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "b1-label", 1)
+	// uploaded before but not on the server
+	database.MustExec(t, "inserting stale note", db, "INSERT INTO notes (uuid, book_uuid, body, usn, added_on) VALUES (?, ?, ?, ?, ?)", "stale-uuid", "b1-uuid", "stale-body", 5, 1541232118)
+
+	fragments := map[string]client.SyncFragment{
+		"0": {
+			FragMaxUSN:  2,
+			UserMaxUSN:  4,
+			CurrentTime: 1550436136,
+			Books:       []client.SyncFragBook{{UUID: "b1-uuid", USN: 1, Label: "b1-label"}},
+			Notes:       []client.SyncFragNote{{UUID: "n1-uuid", BookUUID: "b1-uuid", USN: 2, AddedOn: 1541232118, Body: "n1-body"}},
+		},
+		// n1 changed while the fragments were pulled
+		"2": {
+			FragMaxUSN:  4,
+			UserMaxUSN:  4,
+			CurrentTime: 1550436137,
+			Notes: []client.SyncFragNote{
+				{UUID: "n1-uuid", BookUUID: "b1-uuid", USN: 3, AddedOn: 1541232118, Body: "n1-body-edited"},
+				{UUID: "n2-uuid", BookUUID: "b1-uuid", USN: 4, AddedOn: 1541232118, Body: "n2-body"},
+			},
+		},
+		"4": {
+			UserMaxUSN:  4,
+			CurrentTime: 1550436138,
+		},
+	}
+
+	var afterUSNs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		afterUSN := r.URL.Query().Get("after_usn")
+		afterUSNs = append(afterUSNs, afterUSN)
+
+		frag, ok := fragments[afterUSN]
+		if r.URL.Path != "/v3/sync/fragment" || !ok {
+			t.Fatalf("unrecognized endpoint reached Method: %s URL: %s", r.Method, r.URL.String())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(client.GetSyncFragmentResp{Fragment: frag}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	s := summary{}
+	if err := fullSync(ctx, tx, &removalReport{}, &s); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.DeepEqual(t, afterUSNs, []string{"0", "2", "4"}, "requested fragments mismatch")
+	assert.Equal(t, s.Pulled.Notes, 3, "pulled note count mismatch")
+
+	var noteCount, staleCount int
+	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	database.MustScan(t, "counting stale notes", db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", "stale-uuid"), &staleCount)
+	assert.Equal(t, noteCount, 2, "note count mismatch")
+	assert.Equal(t, staleCount, 0, "stale note should be removed")
+
+	var n1Body string
+	var n1USN int
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT body, usn FROM notes WHERE uuid = ?", "n1-uuid"), &n1Body, &n1USN)
+	assert.Equal(t, n1Body, "n1-body-edited", "n1 body mismatch")
+	assert.Equal(t, n1USN, 3, "n1 usn mismatch")
+
+	var lastMaxUSN, lastSyncAt int
+	database.MustScan(t, "getting last max usn", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastMaxUSN), &lastMaxUSN)
+	database.MustScan(t, "getting last sync at", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastSyncAt), &lastSyncAt)
+	assert.Equal(t, lastMaxUSN, 4, "last max usn mismatch")
+	assert.Equal(t, lastSyncAt, 1550436138, "last sync at mismatch")
+}
+
+func TestFullSync_trashedNote(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 3)
+	database.MustExec(t, "inserting last sync at", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastSyncAt, 0)
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn) VALUES (?, ?, ?)", "b1-uuid", "b1-label", 1)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, usn, added_on) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1-body", 2, 1541232118)
+	// moved to the trash, and its deletion already uploaded
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, usn, added_on, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2-body", 3, 1541232118, true, false, 1541232119)
+
+	fragments := map[string]client.SyncFragment{
+		"0": {
+			FragMaxUSN:    3,
+			UserMaxUSN:    3,
+			CurrentTime:   1550436136,
+			Books:         []client.SyncFragBook{{UUID: "b1-uuid", USN: 1, Label: "b1-label"}},
+			Notes:         []client.SyncFragNote{{UUID: "n1-uuid", BookUUID: "b1-uuid", USN: 2, AddedOn: 1541232118, Body: "n1-body"}},
+			ExpungedNotes: []string{"n2-uuid"},
+		},
+		"3": {
+			UserMaxUSN:  3,
+			CurrentTime: 1550436137,
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		frag, ok := fragments[r.URL.Query().Get("after_usn")]
+		if r.URL.Path != "/v3/sync/fragment" || !ok {
+			t.Fatalf("unrecognized endpoint reached Method: %s URL: %s", r.Method, r.URL.String())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(client.GetSyncFragmentResp{Fragment: frag}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	report := removalReport{}
+	if err := fullSync(ctx, tx, &report, &summary{}); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	var noteCount int
+	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	assert.Equal(t, noteCount, 2, "note count mismatch")
+
+	var n2Body string
+	var n2TrashedOn int64
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT body, trashed_on FROM notes WHERE uuid = ?", "n2-uuid"), &n2Body, &n2TrashedOn)
+	assert.Equal(t, n2Body, "n2-body", "n2 body mismatch")
+	assert.Equal(t, n2TrashedOn, int64(1541232119), "n2 trashed_on mismatch")
+	assert.Equal(t, report.isEmpty(), true, "no note should be reported as removed")
+}
+
+func TestPullFragments_hints(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	hasMore := true
+	noMore := false
+	fragments := map[string]client.SyncFragment{
+		"0": {
+			FragMaxUSN: 20,
+			UserMaxUSN: 30,
+			Limit:      20,
+			HasMore:    &hasMore,
+			Notes:      []client.SyncFragNote{{UUID: "n1-uuid", USN: 20}},
+		},
+		"20": {
+			FragMaxUSN:  30,
+			UserMaxUSN:  30,
+			CurrentTime: 1550436136,
+			Limit:       20,
+			HasMore:     &noMore,
+			Notes:       []client.SyncFragNote{{UUID: "n2-uuid", USN: 30}},
+		},
+	}
+
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		queries = append(queries, q.Encode())
+
+		frag, ok := fragments[q.Get("after_usn")]
+		if r.URL.Path != "/v3/sync/fragment" || !ok {
+			t.Fatalf("unrecognized endpoint reached Method: %s URL: %s", r.Method, r.URL.String())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(client.GetSyncFragmentResp{Fragment: frag}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+	ctx.SyncPageSize = 50
+
+	// execute
+	var merged []string
+	result, err := pullFragments(ctx, 0, progress.New(progress.ModeNone, "resolving delta"), func(l syncList) error {
+		for uuid := range l.Notes {
+			merged = append(merged, uuid)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	// test
+	assert.DeepEqual(t, queries, []string{"after_usn=0&limit=50", "after_usn=20&limit=20"}, "queries mismatch")
+	assert.DeepEqual(t, merged, []string{"n1-uuid", "n2-uuid"}, "merged notes mismatch")
+	assert.Equal(t, result.MaxUSN, 30, "max usn mismatch")
+	assert.Equal(t, result.MaxCurrentTime, int64(1550436136), "max current time mismatch")
+}
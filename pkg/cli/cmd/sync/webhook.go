@@ -0,0 +1,74 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// webhookTimeout is how long the post to the webhook may take
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is the summary of a sync posted to the webhook
+type webhookPayload struct {
+	// Text is a line describing the sync, which the chat services such as Slack show as
+	// the message
+	Text string `json:"text"`
+	summary
+}
+
+// describe returns a line describing the outcome of the sync
+func describe(s summary) string {
+	if s.Offline {
+		return "dnote sync skipped: the server could not be reached"
+	}
+	if !s.Success {
+		return fmt.Sprintf("dnote sync failed: %s", s.Error)
+	}
+
+	return fmt.Sprintf("dnote sync succeeded: %d notes created, %d updated and %d deleted on this device, %d notes sent, %d conflicts",
+		s.Local.Created, s.Local.Updated, s.Local.Deleted, s.Pushed.Notes, s.Conflicts)
+}
+
+// postWebhook posts the summary of the sync to the given URL as JSON
+func postWebhook(url string, s summary) error {
+	b, err := json.Marshal(webhookPayload{Text: describe(s), summary: s})
+	if err != nil {
+		return errors.Wrap(err, "marshalling the payload")
+	}
+
+	hc := http.Client{Timeout: webhookTimeout}
+	res, err := hc.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "posting the summary")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf("the webhook responded with %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestDescribe(t *testing.T) {
+	testCases := []struct {
+		s        summary
+		expected string
+	}{
+		{
+			s: summary{
+				Success:   true,
+				Local:     localChanges{Created: 2, Updated: 1, Deleted: 3},
+				Pushed:    pushCounts{Notes: 4},
+				Conflicts: 1,
+			},
+			expected: "dnote sync succeeded: 2 notes created, 1 updated and 3 deleted on this device, 4 notes sent, 1 conflicts",
+		},
+		{
+			s:        summary{Error: "some error"},
+			expected: "dnote sync failed: some error",
+		},
+		{
+			s:        summary{Offline: true},
+			expected: "dnote sync skipped: the server could not be reached",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, describe(tc.s), tc.expected, "text mismatch")
+		})
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var payload map[string]interface{}
+		var contentType string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding the payload").Error())
+			}
+		}))
+		defer ts.Close()
+
+		s := summary{Success: true, Local: localChanges{Created: 1}}
+		if err := postWebhook(ts.URL, s); err != nil {
+			t.Fatal(errors.Wrap(err, "posting").Error())
+		}
+
+		assert.Equal(t, contentType, "application/json", "content type mismatch")
+		assert.Equal(t, payload["text"], describe(s), "text mismatch")
+		assert.Equal(t, payload["success"], true, "success mismatch")
+		assert.DeepEqual(t, payload["local"], map[string]interface{}{"created": float64(1), "updated": float64(0), "deleted": float64(0)}, "local mismatch")
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		if err := postWebhook(ts.URL, summary{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
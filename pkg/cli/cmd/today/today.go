@@ -0,0 +1,119 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package today
+
+import (
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/goal"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * See the notes written today and the progress towards the goals
+ dnote today`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new today command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "today",
+		Short:   "See the notes written today and the progress towards the goals",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+// getTodayNotes returns the notes added on the day of the given context's current time
+func getTodayNotes(ctx context.DnoteCtx) ([]database.NoteInfo, error) {
+	since := goal.StartOfDay(ctx.Clock.Now()).UnixNano()
+
+	rows, err := ctx.DB.Query(`SELECT notes.rowid, notes.uuid, books.label, notes.body, notes.added_on, notes.edited_on, notes.language
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.deleted = ? AND notes.added_on >= ?
+		ORDER BY notes.added_on ASC`, false, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []database.NoteInfo{}
+	for rows.Next() {
+		var info database.NoteInfo
+		if err := rows.Scan(&info.RowID, &info.UUID, &info.BookLabel, &info.Content, &info.AddedOn, &info.EditedOn, &info.Language); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, info)
+	}
+
+	return ret, nil
+}
+
+func printNotes(infos []database.NoteInfo) {
+	if len(infos) == 0 {
+		log.Plainf("no notes written today\n")
+		return
+	}
+
+	for _, info := range infos {
+		body := strings.TrimSpace(info.Content)
+		if idx := strings.Index(body, "\n"); idx > -1 {
+			body = strings.TrimSpace(body[:idx]) + " " + log.ColorYellow.Sprintf("[---More---]")
+		}
+
+		log.Plainf("%s %s %s\n", log.ColorYellow.Sprintf("(%d)", info.RowID), body, log.ColorGray.Sprintf("[%s]", info.BookLabel))
+	}
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		infos, err := getTodayNotes(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting the notes written today")
+		}
+
+		p, err := goal.GetProgress(ctx.DB, ctx.Goal, ctx.Clock.Now())
+		if err != nil {
+			return errors.Wrap(err, "getting the progress")
+		}
+
+		printNotes(infos)
+		log.Plainf("\n")
+		goal.Print(p)
+
+		return nil
+	}
+}
@@ -0,0 +1,199 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package trash
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var emptyYesFlag bool
+
+var example = `
+ * List the notes in the trash
+ dnote trash
+
+ * Restore the note with id 3 from the trash
+ dnote restore 3
+
+ * Permanently remove the notes in the trash
+ dnote trash empty`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new trash command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "trash",
+		Short:   "List the removed notes",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	cmd.AddCommand(newEmptyCmd(ctx))
+
+	return cmd
+}
+
+func newEmptyCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "empty",
+		Short:   "Permanently remove the notes in the trash",
+		PreRunE: preRun,
+		RunE:    newEmptyRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&emptyYesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+// trashedNote is a note in the trash
+type trashedNote struct {
+	RowID     int
+	BookLabel string
+	Body      string
+	TrashedOn int64
+}
+
+// getTrashedNotes returns the notes in the trash, the most recently removed first
+func getTrashedNotes(db *database.DB) ([]trashedNote, error) {
+	rows, err := db.Query(`SELECT notes.rowid, books.label, notes.body, notes.trashed_on
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.trashed_on > 0
+		ORDER BY notes.trashed_on DESC`)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the notes in the trash")
+	}
+	defer rows.Close()
+
+	ret := []trashedNote{}
+	for rows.Next() {
+		var n trashedNote
+		if err := rows.Scan(&n.RowID, &n.BookLabel, &n.Body, &n.TrashedOn); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// excerptLength is the maximum number of characters of a note shown in the list
+const excerptLength = 50
+
+func getExcerpt(body string) string {
+	lines := strings.SplitN(strings.TrimSpace(body), "\n", 2)
+	excerpt := []rune(lines[0])
+
+	if len(excerpt) > excerptLength {
+		return string(excerpt[:excerptLength]) + "..."
+	}
+	if len(lines) > 1 {
+		return string(excerpt) + "..."
+	}
+
+	return string(excerpt)
+}
+
+func formatTime(ts int64) string {
+	return time.Unix(0, ts).Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := database.PruneTrash(ctx.DB, ctx.Clock, ctx.TrashRetention); err != nil {
+			return errors.Wrap(err, "pruning the trash")
+		}
+
+		notes, err := getTrashedNotes(ctx.DB)
+		if err != nil {
+			return err
+		}
+
+		if len(notes) == 0 {
+			log.Infof("the trash is empty\n")
+			return nil
+		}
+
+		for _, n := range notes {
+			log.Printf("%s %s %s\n", log.ColorYellow.Sprintf("(%d)", n.RowID), getExcerpt(n.Body),
+				log.ColorGray.Sprintf("(removed from %s on %s)", n.BookLabel, formatTime(n.TrashedOn)))
+		}
+
+		if ctx.TrashRetention > 0 {
+			log.Infof("the notes are removed permanently %d days after being moved to the trash\n", int(ctx.TrashRetention.Hours()/24))
+		}
+
+		return nil
+	}
+}
+
+func newEmptyRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		notes, err := getTrashedNotes(ctx.DB)
+		if err != nil {
+			return err
+		}
+
+		if len(notes) == 0 {
+			log.Infof("the trash is empty\n")
+			return nil
+		}
+
+		if !emptyYesFlag {
+			ok, err := ui.Confirm(fmt.Sprintf("permanently remove %d notes in the trash?", len(notes)), false)
+			if err != nil {
+				return errors.Wrap(err, "getting confirmation")
+			}
+			if !ok {
+				log.Warnf("aborted by user\n")
+				return nil
+			}
+		}
+
+		count, err := database.ExpungeTrash(ctx.DB, ctx.Clock.Now().UnixNano()+1)
+		if err != nil {
+			return errors.Wrap(err, "emptying the trash")
+		}
+
+		log.Successf("permanently removed %d notes\n", count)
+
+		return nil
+	}
+}
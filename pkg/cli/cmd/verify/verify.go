@@ -0,0 +1,82 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package verify
+
+import (
+	"github.com/dnote/dnote/pkg/cli/cmd/sync"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Check the notes on the server for corruption
+ dnote verify`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new verify command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "verify",
+		Short:   "Check the notes on the server for corrupted contents and undecryptable metadata",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if ctx.SessionKey == "" {
+			return errors.New("not logged in")
+		}
+
+		result, err := sync.Audit(ctx)
+		if err != nil {
+			return errors.Wrap(err, "auditing the notes")
+		}
+
+		for _, issue := range result.Issues {
+			log.Errorf("note %s: %s\n", issue.NoteUUID, issue.Problem)
+		}
+
+		if result.Unverified > 0 {
+			log.Warnf("the metadata of %d notes was not checked, as metadata.encryption is not set\n", result.Unverified)
+		}
+
+		if len(result.Issues) > 0 {
+			return errors.Errorf("found %d problems in %d notes. Nothing was changed locally", len(result.Issues), result.Checked)
+		}
+
+		log.Successf("checked %d notes on the server\n", result.Checked)
+
+		return nil
+	}
+}
@@ -0,0 +1,430 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package verifysync
+
+import (
+	"fmt"
+
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Check that the server follows the sync protocol
+ dnote verify-sync`
+
+// pageSize is the number of items in each sync fragment requested when checking
+// the pagination. It is small so that the test book and notes span several fragments.
+const pageSize = 1
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new verify-sync command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "verify-sync",
+		Short:   "Check that the server follows the sync protocol",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+// fragmentItems are the books and notes collected from sync fragments, keyed by uuid
+type fragmentItems struct {
+	books         map[string]client.SyncFragBook
+	notes         map[string]client.SyncFragNote
+	expungedBooks map[string]bool
+	expungedNotes map[string]bool
+}
+
+func newFragmentItems() fragmentItems {
+	return fragmentItems{
+		books:         map[string]client.SyncFragBook{},
+		notes:         map[string]client.SyncFragNote{},
+		expungedBooks: map[string]bool{},
+		expungedNotes: map[string]bool{},
+	}
+}
+
+// has returns true if the item with the given uuid has been collected
+func (f fragmentItems) has(uuid string) bool {
+	_, isBook := f.books[uuid]
+	_, isNote := f.notes[uuid]
+
+	return isBook || isNote || f.expungedBooks[uuid] || f.expungedNotes[uuid]
+}
+
+// checkFragment checks that the fragment fetched after the given usn continues the previous
+// fragments, and adds its items to the collected ones. An item is not allowed to appear
+// in more than one fragment because each item is listed only at its latest usn.
+func checkFragment(frag client.SyncFragment, afterUSN int, items fragmentItems) error {
+	if frag.FragMaxUSN <= afterUSN {
+		return errors.Errorf("frag_max_usn %d is not greater than after_usn %d", frag.FragMaxUSN, afterUSN)
+	}
+	if frag.FragMaxUSN > frag.UserMaxUSN {
+		return errors.Errorf("frag_max_usn %d is greater than user_max_usn %d", frag.FragMaxUSN, frag.UserMaxUSN)
+	}
+
+	checkUSN := func(kind, uuid string, usn int) error {
+		if usn <= afterUSN || usn > frag.FragMaxUSN {
+			return errors.Errorf("%s %s has usn %d outside of the fragment (%d, %d]", kind, uuid, usn, afterUSN, frag.FragMaxUSN)
+		}
+		if items.has(uuid) {
+			return errors.Errorf("%s %s appears in more than one fragment", kind, uuid)
+		}
+
+		return nil
+	}
+
+	for _, b := range frag.Books {
+		if err := checkUSN("book", b.UUID, b.USN); err != nil {
+			return err
+		}
+		items.books[b.UUID] = b
+	}
+	for _, n := range frag.Notes {
+		if err := checkUSN("note", n.UUID, n.USN); err != nil {
+			return err
+		}
+		items.notes[n.UUID] = n
+	}
+	for _, uuid := range frag.ExpungedBooks {
+		if items.has(uuid) {
+			return errors.Errorf("expunged book %s appears in more than one fragment", uuid)
+		}
+		items.expungedBooks[uuid] = true
+	}
+	for _, uuid := range frag.ExpungedNotes {
+		if items.has(uuid) {
+			return errors.Errorf("expunged note %s appears in more than one fragment", uuid)
+		}
+		items.expungedNotes[uuid] = true
+	}
+
+	return nil
+}
+
+// fetchFragments fetches all sync fragments after the given usn, checking that they
+// are paginated correctly
+func fetchFragments(ctx context.DnoteCtx, afterUSN, limit int) (fragmentItems, error) {
+	items := newFragmentItems()
+
+	for {
+		resp, err := client.GetSyncFragmentPage(ctx, afterUSN, limit)
+		if err != nil {
+			return items, errors.Wrapf(err, "getting the fragment after usn %d", afterUSN)
+		}
+
+		frag := resp.Fragment
+		if frag.FragMaxUSN == 0 && afterUSN >= frag.UserMaxUSN {
+			return items, nil
+		}
+
+		if err := checkFragment(frag, afterUSN, items); err != nil {
+			return items, errors.Wrapf(err, "checking the fragment after usn %d", afterUSN)
+		}
+
+		afterUSN = frag.FragMaxUSN
+		if afterUSN >= frag.UserMaxUSN {
+			return items, nil
+		}
+	}
+}
+
+// verifier runs the checks against the server using a throwaway book
+type verifier struct {
+	ctx       context.DnoteCtx
+	bookLabel string
+	bookUUID  string
+	noteUUID  string
+	// baseUSN is the max usn of the user before the checks
+	baseUSN int
+	// lastUSN is the usn of the latest change made by the checks
+	lastUSN     int
+	noteContent string
+	failures    int
+}
+
+// check runs the given check and reports the result. It returns false if the check failed.
+func (v *verifier) check(name string, fn func() error) bool {
+	if err := fn(); err != nil {
+		log.Errorf("%s: %s\n", name, err.Error())
+		v.failures++
+		return false
+	}
+
+	log.Successf("%s\n", name)
+	return true
+}
+
+// expectNewUSN checks that the usn assigned to a change is greater than the previous one
+func (v *verifier) expectNewUSN(usn int) error {
+	if usn <= v.lastUSN {
+		return errors.Errorf("usn %d is not greater than the previous usn %d", usn, v.lastUSN)
+	}
+
+	v.lastUSN = usn
+	return nil
+}
+
+func (v *verifier) checkSyncState() error {
+	state, err := client.GetSyncState(v.ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting the sync state")
+	}
+	if state.MaxUSN < 0 {
+		return errors.Errorf("max_usn %d is negative", state.MaxUSN)
+	}
+
+	v.baseUSN = state.MaxUSN
+	v.lastUSN = state.MaxUSN
+	return nil
+}
+
+func (v *verifier) checkCreateBook() error {
+	resp, err := client.CreateBook(v.ctx, v.bookLabel)
+	if err != nil {
+		return errors.Wrap(err, "creating a book")
+	}
+
+	v.bookUUID = resp.Book.UUID
+	if v.bookUUID == "" {
+		return errors.New("the created book has no uuid")
+	}
+
+	return v.expectNewUSN(resp.Book.USN)
+}
+
+func (v *verifier) checkCreateNote() error {
+	resp, err := client.CreateNote(v.ctx, v.bookUUID, "dnote verify-sync", "dnote verify-sync", nil)
+	if err != nil {
+		return errors.Wrap(err, "creating a note")
+	}
+
+	v.noteUUID = resp.Result.UUID
+	if v.noteUUID == "" {
+		return errors.New("the created note has no uuid")
+	}
+
+	return v.expectNewUSN(resp.Result.USN)
+}
+
+func (v *verifier) checkUpdateNote() error {
+	v.noteContent = "dnote verify-sync\n\nupdated"
+
+	resp, err := client.UpdateNote(v.ctx, v.noteUUID, v.bookUUID, "dnote verify-sync", v.noteContent, database.NoteVisibilityPrivate, nil)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+	if resp.Result.Body != v.noteContent {
+		return errors.Errorf("the content of the updated note is %q, not %q", resp.Result.Body, v.noteContent)
+	}
+
+	return v.expectNewUSN(resp.Result.USN)
+}
+
+func (v *verifier) checkMaxUSN() error {
+	state, err := client.GetSyncState(v.ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting the sync state")
+	}
+	if state.MaxUSN < v.lastUSN {
+		return errors.Errorf("max_usn %d is less than the usn %d of the latest change", state.MaxUSN, v.lastUSN)
+	}
+
+	return nil
+}
+
+func (v *verifier) checkPagination() error {
+	paged, err := fetchFragments(v.ctx, v.baseUSN, pageSize)
+	if err != nil {
+		return err
+	}
+	whole, err := fetchFragments(v.ctx, v.baseUSN, 0)
+	if err != nil {
+		return err
+	}
+
+	b, ok := paged.books[v.bookUUID]
+	if !ok {
+		return errors.Errorf("book %s is missing", v.bookUUID)
+	}
+	if b.Label != v.bookLabel {
+		return errors.Errorf("book %s has label %q, not %q", b.UUID, b.Label, v.bookLabel)
+	}
+
+	n, ok := paged.notes[v.noteUUID]
+	if !ok {
+		return errors.Errorf("note %s is missing", v.noteUUID)
+	}
+	if n.USN != v.lastUSN {
+		return errors.Errorf("note %s has usn %d, not its latest usn %d", n.UUID, n.USN, v.lastUSN)
+	}
+	if n.Body != v.noteContent {
+		return errors.Errorf("note %s has content %q, not %q", n.UUID, n.Body, v.noteContent)
+	}
+	if n.BookUUID != v.bookUUID {
+		return errors.Errorf("note %s is in book %s, not %s", n.UUID, n.BookUUID, v.bookUUID)
+	}
+
+	for uuid := range whole.notes {
+		if !paged.has(uuid) {
+			return errors.Errorf("note %s is in the whole fragment but missing in the paginated fragments", uuid)
+		}
+	}
+	for uuid := range whole.books {
+		if !paged.has(uuid) {
+			return errors.Errorf("book %s is in the whole fragment but missing in the paginated fragments", uuid)
+		}
+	}
+
+	return nil
+}
+
+func (v *verifier) checkExpungeNote() error {
+	prevUSN := v.lastUSN
+
+	resp, err := client.DeleteNote(v.ctx, v.noteUUID)
+	if err != nil {
+		return errors.Wrap(err, "deleting the note")
+	}
+	if err := v.expectNewUSN(resp.Result.USN); err != nil {
+		return err
+	}
+
+	items, err := fetchFragments(v.ctx, prevUSN, 0)
+	if err != nil {
+		return err
+	}
+	if _, ok := items.notes[v.noteUUID]; ok {
+		return errors.Errorf("deleted note %s is listed as a note instead of an expunged note", v.noteUUID)
+	}
+	if !items.expungedNotes[v.noteUUID] {
+		return errors.Errorf("deleted note %s is not listed as an expunged note", v.noteUUID)
+	}
+
+	return nil
+}
+
+func (v *verifier) checkExpungeBook() error {
+	prevUSN := v.lastUSN
+
+	resp, err := client.DeleteBook(v.ctx, v.bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "deleting the book")
+	}
+	bookUUID := v.bookUUID
+	v.bookUUID = ""
+	if err := v.expectNewUSN(resp.Book.USN); err != nil {
+		return err
+	}
+
+	items, err := fetchFragments(v.ctx, prevUSN, 0)
+	if err != nil {
+		return err
+	}
+	if _, ok := items.books[bookUUID]; ok {
+		return errors.Errorf("deleted book %s is listed as a book instead of an expunged book", bookUUID)
+	}
+	if !items.expungedBooks[bookUUID] {
+		return errors.Errorf("deleted book %s is not listed as an expunged book", bookUUID)
+	}
+
+	return nil
+}
+
+// cleanUp deletes the test book if the checks stopped before deleting it
+func (v *verifier) cleanUp() {
+	if v.bookUUID == "" {
+		return
+	}
+
+	if _, err := client.DeleteBook(v.ctx, v.bookUUID); err != nil {
+		log.Errorf("deleting the test book %s: %s\n", v.bookLabel, err.Error())
+	}
+}
+
+func (v *verifier) run() {
+	defer v.cleanUp()
+
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"sync state is readable", v.checkSyncState},
+		{"creating a book assigns a new usn", v.checkCreateBook},
+		{"creating a note assigns a new usn", v.checkCreateNote},
+		{"updating a note assigns a new usn", v.checkUpdateNote},
+		{"max_usn covers the latest change", v.checkMaxUSN},
+		{"fragments are paginated correctly", v.checkPagination},
+		{"deleted notes are expunged", v.checkExpungeNote},
+		{"deleted books are expunged", v.checkExpungeBook},
+	}
+
+	for _, s := range steps {
+		// the later checks depend on the changes made by the earlier ones
+		if !v.check(s.name, s.fn) {
+			return
+		}
+	}
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if ctx.SessionKey == "" {
+			return errors.New("not logged in")
+		}
+
+		uuid, err := utils.GenerateUUID()
+		if err != nil {
+			return errors.Wrap(err, "generating uuid")
+		}
+
+		v := verifier{
+			ctx:       ctx,
+			bookLabel: fmt.Sprintf("dnote-verify-sync-%s", uuid[:8]),
+		}
+
+		log.Infof("verifying %s using a test book %s\n", ctx.APIEndpoint, v.bookLabel)
+		v.run()
+
+		if v.failures > 0 {
+			return errors.New("the server does not follow the sync protocol")
+		}
+
+		log.Success("the server follows the sync protocol\n")
+
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package verifysync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/context"
+)
+
+func TestCheckFragment(t *testing.T) {
+	testCases := []struct {
+		name     string
+		frag     client.SyncFragment
+		afterUSN int
+		ok       bool
+	}{
+		{
+			name: "valid",
+			frag: client.SyncFragment{
+				FragMaxUSN:    4,
+				UserMaxUSN:    5,
+				Books:         []client.SyncFragBook{{UUID: "b1-uuid", USN: 3}},
+				Notes:         []client.SyncFragNote{{UUID: "n1-uuid", USN: 4}},
+				ExpungedNotes: []string{"n2-uuid"},
+			},
+			afterUSN: 2,
+			ok:       true,
+		},
+		{
+			name: "frag_max_usn not increasing",
+			frag: client.SyncFragment{
+				FragMaxUSN: 2,
+				UserMaxUSN: 5,
+			},
+			afterUSN: 2,
+			ok:       false,
+		},
+		{
+			name: "frag_max_usn greater than user_max_usn",
+			frag: client.SyncFragment{
+				FragMaxUSN: 6,
+				UserMaxUSN: 5,
+			},
+			afterUSN: 2,
+			ok:       false,
+		},
+		{
+			name: "usn before the fragment",
+			frag: client.SyncFragment{
+				FragMaxUSN: 4,
+				UserMaxUSN: 5,
+				Notes:      []client.SyncFragNote{{UUID: "n1-uuid", USN: 2}},
+			},
+			afterUSN: 2,
+			ok:       false,
+		},
+		{
+			name: "usn after the fragment",
+			frag: client.SyncFragment{
+				FragMaxUSN: 4,
+				UserMaxUSN: 5,
+				Books:      []client.SyncFragBook{{UUID: "b1-uuid", USN: 5}},
+			},
+			afterUSN: 2,
+			ok:       false,
+		},
+		{
+			name: "duplicate",
+			frag: client.SyncFragment{
+				FragMaxUSN:    4,
+				UserMaxUSN:    5,
+				Notes:         []client.SyncFragNote{{UUID: "n1-uuid", USN: 4}},
+				ExpungedNotes: []string{"n1-uuid"},
+			},
+			afterUSN: 2,
+			ok:       false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkFragment(tc.frag, tc.afterUSN, newFragmentItems())
+			assert.Equal(t, err == nil, tc.ok, "result mismatch")
+		})
+	}
+}
+
+// newFragmentServer returns a server that serves the given notes in sync fragments,
+// in the way the dnote server paginates them
+func newFragmentServer(notes []client.SyncFragNote) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		afterUSN, _ := strconv.Atoi(r.URL.Query().Get("after_usn"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit == 0 {
+			limit = 100
+		}
+
+		frag := client.SyncFragment{
+			UserMaxUSN: notes[len(notes)-1].USN,
+			Notes:      []client.SyncFragNote{},
+		}
+		for _, n := range notes {
+			if n.USN > afterUSN && len(frag.Notes) < limit {
+				frag.Notes = append(frag.Notes, n)
+				frag.FragMaxUSN = n.USN
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(client.GetSyncFragmentResp{Fragment: frag})
+	}))
+}
+
+func TestFetchFragments(t *testing.T) {
+	notes := []client.SyncFragNote{
+		{UUID: "n1-uuid", USN: 2},
+		{UUID: "n2-uuid", USN: 3},
+		{UUID: "n3-uuid", USN: 5},
+	}
+
+	server := newFragmentServer(notes)
+	defer server.Close()
+
+	ctx := context.DnoteCtx{APIEndpoint: server.URL, SessionKey: "someSessionKey"}
+
+	t.Run("paginated", func(t *testing.T) {
+		items, err := fetchFragments(ctx, 2, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		assert.Equal(t, len(items.notes), 2, "note count mismatch")
+		assert.Equal(t, items.has("n2-uuid"), true, "n2 should be fetched")
+		assert.Equal(t, items.has("n3-uuid"), true, "n3 should be fetched")
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		items, err := fetchFragments(ctx, 5, 1)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		assert.Equal(t, len(items.notes), 0, "note count mismatch")
+	})
+}
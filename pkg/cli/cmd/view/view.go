@@ -19,8 +19,14 @@
 package view
 
 import (
+	"fmt"
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/completion"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/picker"
+	"github.com/dnote/dnote/pkg/cli/validate"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
@@ -38,15 +44,36 @@ var example = `
 
  * View a particular note in a book
  dnote view javascript 0
+
+ * List notes in a book, most recently edited first
+ dnote view javascript --sort edited
+
+ * Pick a note to view from a list
+ dnote view -i
+
+ * View all books, including the archived ones
+ dnote view --archived
  `
 
 var nameOnly bool
 var contentOnly bool
+var recentNotes bool
+var sortFlag string
+var interactiveFlag bool
+var archivedFlag bool
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) > 2 {
 		return errors.New("Incorrect number of argument")
 	}
+	if interactiveFlag && len(args) > 0 {
+		return errors.New("--interactive flag is only valid without arguments")
+	}
+	if sortFlag != "" {
+		if err := validate.NoteSort(sortFlag); err != nil {
+			return errors.Wrap(err, "invalid sort")
+		}
+	}
 
 	return nil
 }
@@ -54,27 +81,71 @@ func preRun(cmd *cobra.Command, args []string) error {
 // NewCmd returns a new view command
 func NewCmd(ctx context.DnoteCtx) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "view <book name?> <note index?>",
-		Aliases: []string{"v"},
-		Short:   "List books, notes or view a content",
-		Example: example,
-		RunE:    newRun(ctx),
-		PreRunE: preRun,
+		Use:               "view <book name?> <note index?>",
+		Aliases:           []string{"v"},
+		Short:             "List books, notes or view a content",
+		Example:           example,
+		RunE:              newRun(ctx),
+		ValidArgsFunction: completion.NoteOrBookArgs(ctx),
+		PreRunE:           preRun,
 	}
 
 	f := cmd.Flags()
 	f.BoolVarP(&nameOnly, "name-only", "", false, "print book names only")
 	f.BoolVarP(&contentOnly, "content-only", "", false, "print the note content only")
+	f.StringVarP(&sortFlag, "sort", "s", "", "the order of the notes in a book: manual, added, edited, alphabetical or last-viewed. Defaults to the sort set for the book")
+	f.BoolVarP(&archivedFlag, "archived", "", false, "include the archived books when viewing books")
+	f.BoolVarP(&interactiveFlag, "interactive", "i", false, "pick a note to view from a list")
+	f.BoolVarP(&recentNotes, "recent-notes", "", false, "print the ids and titles of the recent notes for the shell completions")
+	f.MarkHidden("recent-notes")
 
 	return cmd
 }
 
+// printRecentNotes prints the recent notes from the completion cache, one per line
+// in the form of "<id>:<title>"
+func printRecentNotes(ctx context.DnoteCtx) error {
+	d, err := completion.Load(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading the completion data")
+	}
+
+	for _, note := range d.Notes {
+		fmt.Printf("%d:%s\n", note.RowID, note.Title)
+	}
+
+	return nil
+}
+
 func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		var run infra.RunEFunc
 
+		if recentNotes {
+			if len(args) > 0 {
+				return errors.New("--recent-notes flag is only valid without arguments")
+			}
+
+			return printRecentNotes(ctx)
+		}
+
+		if interactiveFlag {
+			rowID, err := picker.PickNote(ctx)
+			if err == picker.ErrCancelled {
+				return nil
+			} else if err != nil {
+				return errors.Wrap(err, "picking a note")
+			}
+
+			return cat.NewRun(ctx, contentOnly)(cmd, []string{strconv.Itoa(rowID)})
+		}
+
 		if len(args) == 0 {
-			run = ls.NewRun(ctx, nameOnly)
+			if sortFlag != "" {
+				return errors.New("--sort flag is only valid when listing notes in a book")
+			}
+
+			run = ls.NewRun(ctx, nameOnly, "", archivedFlag)
 		} else if len(args) == 1 {
 			if nameOnly {
 				return errors.New("--name-only flag is only valid when viewing books")
@@ -83,7 +154,7 @@ func newRun(ctx context.DnoteCtx) infra.RunEFunc {
 			if utils.IsNumber(args[0]) {
 				run = cat.NewRun(ctx, contentOnly)
 			} else {
-				run = ls.NewRun(ctx, false)
+				run = ls.NewRun(ctx, false, sortFlag, false)
 			}
 		} else if len(args) == 2 {
 			// DEPRECATED: passing book name to view command is deprecated
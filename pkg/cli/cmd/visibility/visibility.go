@@ -0,0 +1,279 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package visibility
+
+import (
+	"github.com/dnote/dnote/pkg/cli/completion"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/secrets"
+	"github.com/dnote/dnote/pkg/cli/thin"
+	"github.com/dnote/dnote/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Make all notes in a book public and list them on your profile
+ dnote visibility --book blog --public
+
+ * Make all notes in a book visible only to those with their links
+ dnote visibility --book blog --unlisted
+
+ * Make all notes in a book private without confirmation
+ dnote visibility --book blog --private -y`
+
+var bookFlag string
+var publicFlag bool
+var unlistedFlag bool
+var privateFlag bool
+var yesFlag bool
+var forceFlag bool
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+	if bookFlag == "" {
+		return errors.New("--book is required")
+	}
+	if getVisibility() == "" {
+		return errors.New("Specify one of --public, --unlisted and --private")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new visibility command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "visibility",
+		Short:   "Make the notes in a book public, unlisted or private",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&bookFlag, "book", "b", "", "the book whose notes to change")
+	f.BoolVarP(&publicFlag, "public", "", false, "make the notes public and list them on your profile")
+	f.BoolVarP(&unlistedFlag, "unlisted", "", false, "make the notes visible only to those with their links")
+	f.BoolVarP(&privateFlag, "private", "", false, "make the notes private")
+	f.BoolVarP(&yesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+	f.BoolVarP(&forceFlag, "force", "", false, "make the notes public even if they seem to contain secrets, without confirmation")
+
+	cmd.RegisterFlagCompletionFunc("book", completion.BookFlag(ctx))
+
+	return cmd
+}
+
+// getVisibility returns the visibility requested by the flags, or an empty string if not
+// exactly one of them is given
+func getVisibility() string {
+	var ret string
+	var count int
+
+	if publicFlag {
+		ret = database.NoteVisibilityPublic
+		count++
+	}
+	if unlistedFlag {
+		ret = database.NoteVisibilityUnlisted
+		count++
+	}
+	if privateFlag {
+		ret = database.NoteVisibilityPrivate
+		count++
+	}
+
+	if count != 1 {
+		return ""
+	}
+
+	return ret
+}
+
+func maybeConfirm(message string, defaultValue bool) (bool, error) {
+	if yesFlag {
+		return true, nil
+	}
+
+	return ui.Confirm(message, defaultValue)
+}
+
+// getExcerpt returns the title of the note
+func getExcerpt(n database.Note) string {
+	line := database.NoteTitle(n.Title, n.Body)
+
+	r := []rune(line)
+	if len(r) > 60 {
+		return string(r[:60]) + "..."
+	}
+
+	return line
+}
+
+// getTargets returns the notes in the book whose visibility differs from the given one
+func getTargets(db *database.DB, bookUUID, visibility string) ([]database.Note, error) {
+	rows, err := db.Query(`SELECT rowid, uuid, title, body, public
+		FROM notes
+		WHERE book_uuid = ? AND deleted = ? AND visibility != ?
+		ORDER BY added_on ASC`, bookUUID, false, visibility)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []database.Note{}
+	for rows.Next() {
+		var n database.Note
+		if err := rows.Scan(&n.RowID, &n.UUID, &n.Title, &n.Body, &n.Public); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// checkSecrets scans the notes that are about to be shared for likely secrets, and
+// asks for a confirmation if any is found. The notes already shared are not scanned.
+func checkSecrets(notes []database.Note) error {
+	var found bool
+	for _, n := range notes {
+		if n.Public {
+			continue
+		}
+
+		findings := secrets.Scan(n.Body)
+		if len(findings) == 0 {
+			continue
+		}
+
+		if !found {
+			log.Warnf("some notes seem to contain secrets\n")
+			found = true
+		}
+		for _, f := range findings {
+			log.Plainf("  %s %s %s\n", log.ColorYellow.Sprintf("(%d) line %d:", n.RowID, f.Line), f.Kind, log.ColorGray.Sprintf("(%s)", f.Excerpt))
+		}
+	}
+
+	if !found || forceFlag {
+		return nil
+	}
+
+	ok, err := ui.Confirm("share them anyway?", false)
+	if err != nil {
+		return errors.Wrap(err, "getting confirmation")
+	}
+	if !ok {
+		return errors.New("Aborted. Use --force to share the notes regardless")
+	}
+
+	return nil
+}
+
+// setVisibility sets the visibility of the notes and marks them dirty, saving their
+// current states as versions
+func setVisibility(ctx context.DnoteCtx, notes []database.Note, visibility string) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	for _, n := range notes {
+		if err := database.SaveNoteVersion(tx, ctx.Clock, n.UUID, database.NoteVersionEdit, ctx.HistoryRetention); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "saving a version")
+		}
+		if err := database.UpdateNoteVisibility(tx, ctx.Clock, n.RowID, visibility); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "updating the note %d", n.RowID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		label, err := database.ResolveBookLabel(ctx.DB, bookFlag, ctx.CaseSensitiveBooks)
+		if err != nil {
+			return errors.Wrap(err, "resolving the book")
+		}
+		bookUUID, err := database.GetBookUUID(ctx.DB, label)
+		if err != nil {
+			return errors.Wrap(err, "finding the book")
+		}
+
+		visibility := getVisibility()
+		if visibility != database.NoteVisibilityPrivate {
+			// the contents are needed to check for secrets
+			if _, err := thin.EnsureBodies(ctx, bookUUID); err != nil {
+				return errors.Wrap(err, "getting the note bodies")
+			}
+		}
+
+		notes, err := getTargets(ctx.DB, bookUUID, visibility)
+		if err != nil {
+			return errors.Wrap(err, "getting the notes")
+		}
+		if len(notes) == 0 {
+			log.Infof("all notes in %s are already %s\n", label, visibility)
+			return nil
+		}
+
+		log.Infof("the following notes in %s will be made %s\n", label, visibility)
+		for _, n := range notes {
+			log.Plainf("%s %s\n", log.ColorYellow.Sprintf("(%d)", n.RowID), getExcerpt(n))
+		}
+
+		if visibility != database.NoteVisibilityPrivate {
+			if err := checkSecrets(notes); err != nil {
+				return err
+			}
+		}
+
+		ok, err := maybeConfirm("proceed?", false)
+		if err != nil {
+			return errors.Wrap(err, "getting confirmation")
+		}
+		if !ok {
+			log.Warnf("aborted by user\n")
+			return nil
+		}
+
+		if err := setVisibility(ctx, notes, visibility); err != nil {
+			return errors.Wrap(err, "setting the visibility")
+		}
+
+		log.Successf("made %d notes %s\n", len(notes), visibility)
+
+		return nil
+	}
+}
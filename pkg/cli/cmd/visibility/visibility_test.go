@@ -0,0 +1,102 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package visibility
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestGetExcerpt(t *testing.T) {
+	assert.Equal(t, getExcerpt(database.Note{Body: "\n  first line  \nsecond line"}), "first line", "excerpt mismatch")
+	assert.Equal(t, getExcerpt(database.Note{Title: "title", Body: "first line"}), "title", "title mismatch")
+	assert.Equal(t, getExcerpt(database.Note{Title: strings.Repeat("a", 70)}), strings.Repeat("a", 60)+"...", "long excerpt mismatch")
+}
+
+func TestSetVisibility(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	c := clock.NewMock()
+	c.SetNow(time.Unix(0, 1542058875))
+	ctx.Clock = c
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "blog")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, false, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, visibility, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, true, "public", false)
+	database.MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, visibility, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n5-uuid", "b1-uuid", "n5 body", 5, true, "unlisted", false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "", 3, false, true, false)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n4-uuid", "b2-uuid", "n4 body", 4, false, false)
+
+	// execute
+	notes, err := getTargets(db, "b1-uuid", database.NoteVisibilityPublic)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting targets"))
+	}
+	if err := setVisibility(ctx, notes, database.NoteVisibilityPublic); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, len(notes), 2, "target count mismatch")
+	assert.Equal(t, notes[0].UUID, "n1-uuid", "target mismatch")
+	assert.Equal(t, notes[1].UUID, "n5-uuid", "target mismatch")
+
+	var n1Public, n1Dirty bool
+	var n1Visibility string
+	var n1EditedOn int64
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT public, visibility, dirty, edited_on FROM notes WHERE uuid = ?", "n1-uuid"), &n1Public, &n1Visibility, &n1Dirty, &n1EditedOn)
+	assert.Equal(t, n1Public, true, "n1 public mismatch")
+	assert.Equal(t, n1Visibility, "public", "n1 visibility mismatch")
+	assert.Equal(t, n1Dirty, true, "n1 dirty mismatch")
+	assert.Equal(t, n1EditedOn, int64(1542058875), "n1 edited_on mismatch")
+
+	var n2Dirty, n3Public, n4Public bool
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2Dirty)
+	database.MustScan(t, "getting n3", db.QueryRow("SELECT public FROM notes WHERE uuid = ?", "n3-uuid"), &n3Public)
+	database.MustScan(t, "getting n4", db.QueryRow("SELECT public FROM notes WHERE uuid = ?", "n4-uuid"), &n4Public)
+	assert.Equal(t, n2Dirty, false, "n2 should not be changed")
+	assert.Equal(t, n3Public, false, "deleted n3 should not be changed")
+	assert.Equal(t, n4Public, false, "n4 in another book should not be changed")
+
+	var n5Visibility string
+	database.MustScan(t, "getting n5", db.QueryRow("SELECT visibility FROM notes WHERE uuid = ?", "n5-uuid"), &n5Visibility)
+	assert.Equal(t, n5Visibility, "public", "n5 visibility mismatch")
+
+	var versionCount int
+	database.MustScan(t, "counting versions", db.QueryRow("SELECT count(*) FROM note_versions WHERE note_uuid = ?", "n1-uuid"), &versionCount)
+	assert.Equal(t, versionCount, 1, "version count mismatch")
+}
@@ -0,0 +1,307 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package watch
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/infra"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/output"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Print the notes as they are added or edited in the oncall book
+ dnote watch book:oncall
+
+ * Print the notes mentioning a keyword in any book
+ dnote watch postgres
+
+ * Combine books and keywords
+ dnote watch "book:oncall book:infra failover"`
+
+// bookPrefix is the prefix of a query term that matches a book
+const bookPrefix = "book:"
+
+var intervalFlag time.Duration
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 1 {
+		return errors.New("Incorrect number of argument")
+	}
+	if intervalFlag <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new watch command
+func NewCmd(ctx context.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "watch <query?>",
+		Short:   "Print the matching notes as they are added or edited",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.DurationVarP(&intervalFlag, "interval", "", time.Second, "how often to check for the changes")
+
+	return cmd
+}
+
+// query is a parsed watch query. A note matches if it is in any of the books, or in
+// any book if none is given, and contains all of the keywords.
+type query struct {
+	books    []string
+	keywords []string
+}
+
+// parseQuery parses a query made of 'book:<name>' terms and keywords separated by spaces
+func parseQuery(s string) (query, error) {
+	var ret query
+
+	for _, term := range strings.Fields(s) {
+		if strings.HasPrefix(term, bookPrefix) {
+			label := strings.TrimPrefix(term, bookPrefix)
+			if label == "" {
+				return ret, errors.Errorf("missing a book name in '%s'", term)
+			}
+
+			ret.books = append(ret.books, label)
+			continue
+		}
+
+		ret.keywords = append(ret.keywords, strings.ToLower(term))
+	}
+
+	return ret, nil
+}
+
+// matchBook returns true if the book with the given label is in the query
+func (q query) matchBook(label string, caseSensitive bool) bool {
+	if len(q.books) == 0 {
+		return true
+	}
+
+	for _, b := range q.books {
+		if b == label || (!caseSensitive && strings.EqualFold(b, label)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchContent returns true if the title or the content contains all of the keywords
+func (q query) matchContent(title, content string) bool {
+	s := strings.ToLower(title + "\n" + content)
+
+	for _, k := range q.keywords {
+		if !strings.Contains(s, k) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// event is a matching note that has been added or edited
+type event struct {
+	Kind string      `json:"event"`
+	Note output.Note `json:"note"`
+}
+
+const (
+	eventAdded  = "added"
+	eventEdited = "edited"
+)
+
+// watcher finds the matching notes that have changed since the last scan
+type watcher struct {
+	query         query
+	caseSensitive bool
+	// seen maps the rowids of the matching notes to their versions in the last scan
+	seen map[int]string
+	// dataVersion is the version of the database in the last check
+	dataVersion int64
+}
+
+// getVersion returns a string that changes whenever the note is edited locally or
+// updated by a sync
+func getVersion(info database.NoteInfo, usn int) string {
+	return fmt.Sprintf("%d:%d:%d", info.EditedOn, usn, len(info.Content))
+}
+
+// scan returns the matching notes that have been added or edited since the last scan.
+// The first scan only records the existing notes.
+func (w *watcher) scan(db *database.DB) ([]event, error) {
+	rows, err := db.Query(`SELECT notes.rowid, notes.uuid, books.label, notes.title, notes.body,
+		notes.added_on, notes.edited_on, notes.language, notes.content_type, notes.usn
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.deleted = ?
+		ORDER BY max(notes.added_on, notes.edited_on) ASC`, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	initial := w.seen == nil
+	seen := map[int]string{}
+
+	ret := []event{}
+	for rows.Next() {
+		var info database.NoteInfo
+		var usn int
+		if err := rows.Scan(&info.RowID, &info.UUID, &info.BookLabel, &info.Title, &info.Content,
+			&info.AddedOn, &info.EditedOn, &info.Language, &info.ContentType, &usn); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		if !w.query.matchBook(info.BookLabel, w.caseSensitive) || !w.query.matchContent(info.Title, info.Content) {
+			continue
+		}
+
+		version := getVersion(info, usn)
+		seen[info.RowID] = version
+
+		if initial {
+			continue
+		}
+
+		prev, ok := w.seen[info.RowID]
+		if !ok {
+			ret = append(ret, event{Kind: eventAdded, Note: output.NewNote(info)})
+		} else if prev != version {
+			ret = append(ret, event{Kind: eventEdited, Note: output.NewNote(info)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "iterating notes")
+	}
+
+	w.seen = seen
+
+	return ret, nil
+}
+
+// check scans the notes only if another connection has written to the database since
+// the last check, which keeps the polling cheap. The version is kept per connection, so
+// a version read from another connection in the pool only causes an extra scan.
+func (w *watcher) check(db *database.DB) ([]event, error) {
+	var version int64
+	if err := db.QueryRow("PRAGMA data_version").Scan(&version); err != nil {
+		return nil, errors.Wrap(err, "getting the data version")
+	}
+	if w.seen != nil && version == w.dataVersion {
+		return nil, nil
+	}
+
+	events, err := w.scan(db)
+	if err != nil {
+		return nil, err
+	}
+
+	w.dataVersion = version
+
+	return events, nil
+}
+
+func printEvent(e event) error {
+	if output.IsJSON() {
+		return output.JSONLine(e)
+	}
+
+	ts := e.Note.AddedOn
+	if e.Note.EditedOn != nil {
+		ts = *e.Note.EditedOn
+	}
+
+	log.Plainf("%s %s %s %s %s\n",
+		log.ColorGray.Sprint(ts.Local().Format("15:04:05")),
+		log.ColorGreen.Sprintf("%-6s", e.Kind),
+		log.ColorYellow.Sprintf("(%d)", e.Note.RowID),
+		e.Note.Title,
+		log.ColorGray.Sprintf("[%s]", e.Note.Book),
+	)
+	for _, line := range strings.Split(strings.TrimRight(e.Note.Content, "\n"), "\n") {
+		log.Plainf("  %s\n", line)
+	}
+	log.Plainf("\n")
+
+	return nil
+}
+
+func newRun(ctx context.DnoteCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		var s string
+		if len(args) == 1 {
+			s = args[0]
+		}
+
+		q, err := parseQuery(s)
+		if err != nil {
+			return errors.Wrap(err, "parsing the query")
+		}
+
+		w := watcher{query: q, caseSensitive: ctx.CaseSensitiveBooks}
+		if _, err := w.check(ctx.DB); err != nil {
+			return err
+		}
+
+		log.Infof("watching for the matching notes. Press ctrl-c to stop\n")
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sig)
+
+		ticker := time.NewTicker(intervalFlag)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-sig:
+				return nil
+			case <-ticker.C:
+				events, err := w.check(ctx.DB)
+				if err != nil {
+					return err
+				}
+
+				for _, e := range events {
+					if err := printEvent(e); err != nil {
+						return errors.Wrap(err, "printing a note")
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package watch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+)
+
+var paths = context.Paths{
+	Home:   "../../tmp",
+	Cache:  "../../tmp",
+	Config: "../../tmp",
+	Data:   "../../tmp",
+}
+
+func TestParseQuery(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected query
+	}{
+		{
+			input:    "",
+			expected: query{},
+		},
+		{
+			input:    "book:oncall",
+			expected: query{books: []string{"oncall"}},
+		},
+		{
+			input:    "book:oncall  Postgres book:infra failover",
+			expected: query{books: []string{"oncall", "infra"}, keywords: []string{"postgres", "failover"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parseQuery(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("result mismatch. Expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("empty book", func(t *testing.T) {
+		if _, err := parseQuery("book:"); err == nil {
+			t.Fatal("error should have been returned")
+		}
+	})
+}
+
+func TestQueryMatch(t *testing.T) {
+	q := query{books: []string{"oncall"}, keywords: []string{"postgres"}}
+
+	assert.Equal(t, q.matchBook("oncall", false), true, "book mismatch")
+	assert.Equal(t, q.matchBook("OnCall", false), true, "case-insensitive book mismatch")
+	assert.Equal(t, q.matchBook("OnCall", true), false, "case-sensitive book mismatch")
+	assert.Equal(t, q.matchBook("infra", false), false, "other book mismatch")
+	assert.Equal(t, query{}.matchBook("infra", false), true, "any book mismatch")
+
+	assert.Equal(t, q.matchContent("failover", "restart Postgres"), true, "content mismatch")
+	assert.Equal(t, q.matchContent("Postgres", ""), true, "title mismatch")
+	assert.Equal(t, q.matchContent("failover", "restart redis"), false, "no keyword mismatch")
+}
+
+func TestWatcherScan(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "oncall")
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "existing note", 1, 0, 1)
+
+	w := watcher{query: query{books: []string{"oncall"}}}
+
+	// execute and test
+	events, err := w.scan(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(events), 0, "the existing notes should not be reported")
+
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "new note", 2, 0)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "other book", 3, 0)
+
+	events, err = w.scan(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(events), 1, "event count mismatch")
+	assert.Equal(t, events[0].Kind, eventAdded, "kind mismatch")
+	assert.Equal(t, events[0].Note.UUID, "n2-uuid", "uuid mismatch")
+	assert.Equal(t, events[0].Note.Title, "new note", "title mismatch")
+
+	// a note updated by a sync keeps its edited_on but gets a new usn
+	database.MustExec(t, "syncing n1", db, "UPDATE notes SET usn = ? WHERE uuid = ?", 2, "n1-uuid")
+
+	events, err = w.scan(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(events), 1, "event count mismatch")
+	assert.Equal(t, events[0].Kind, eventEdited, "kind mismatch")
+	assert.Equal(t, events[0].Note.UUID, "n1-uuid", "uuid mismatch")
+
+	events, err = w.scan(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(events), 0, "unchanged notes should not be reported")
+}
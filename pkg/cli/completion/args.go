@@ -0,0 +1,105 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package completion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/spf13/cobra"
+)
+
+// Func is a function that returns the completions of an argument or a flag of a command
+type Func func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+// kind is a kind of values to complete
+type kind int
+
+const (
+	kindBook kind = 1 << iota
+	kindNote
+)
+
+// candidates returns the values of the given kinds that start with the prefix. Notes are
+// completed by their ids, described by their titles.
+func candidates(d Data, k kind, prefix string) []string {
+	ret := []string{}
+
+	if k&kindBook != 0 {
+		for _, label := range d.Books {
+			if strings.HasPrefix(label, prefix) {
+				ret = append(ret, label)
+			}
+		}
+	}
+	if k&kindNote != 0 {
+		for _, note := range d.Notes {
+			id := strconv.Itoa(note.RowID)
+			if strings.HasPrefix(id, prefix) {
+				ret = append(ret, fmt.Sprintf("%s\t%s", id, note.Title))
+			}
+		}
+	}
+
+	return ret
+}
+
+// newFunc returns a completion function that completes the values of the given kind for
+// the first n arguments, or for any argument if n is negative.
+func newFunc(ctx context.DnoteCtx, k kind, n int) Func {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if n >= 0 && len(args) >= n {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		d, err := Load(ctx)
+		if err != nil {
+			log.Debug("loading the completion data: %s\n", err.Error())
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		return candidates(d, k, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// BookArgs returns a completion function that completes the book names for the first
+// n arguments.
+func BookArgs(ctx context.DnoteCtx, n int) Func {
+	return newFunc(ctx, kindBook, n)
+}
+
+// NoteArgs returns a completion function that completes the ids of the recent notes
+// for the first argument.
+func NoteArgs(ctx context.DnoteCtx) Func {
+	return newFunc(ctx, kindNote, 1)
+}
+
+// NoteOrBookArgs returns a completion function that completes the ids of the recent
+// notes and the book names for the first argument.
+func NoteOrBookArgs(ctx context.DnoteCtx) Func {
+	return newFunc(ctx, kindNote|kindBook, 1)
+}
+
+// BookFlag returns a completion function that completes the book names for a flag.
+func BookFlag(ctx context.DnoteCtx) Func {
+	return newFunc(ctx, kindBook, -1)
+}
@@ -0,0 +1,102 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package completion
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/spf13/cobra"
+)
+
+func TestCandidates(t *testing.T) {
+	d := Data{
+		Books: []string{"css", "javascript", "js"},
+		Notes: []Note{
+			{RowID: 12, Title: "closures"},
+			{RowID: 3, Title: "flexbox"},
+			{RowID: 1, Title: "grid"},
+		},
+	}
+
+	testCases := []struct {
+		kind     kind
+		prefix   string
+		expected []string
+	}{
+		{
+			kind:     kindBook,
+			prefix:   "",
+			expected: []string{"css", "javascript", "js"},
+		},
+		{
+			kind:     kindBook,
+			prefix:   "j",
+			expected: []string{"javascript", "js"},
+		},
+		{
+			kind:     kindBook,
+			prefix:   "go",
+			expected: []string{},
+		},
+		{
+			kind:     kindNote,
+			prefix:   "1",
+			expected: []string{"12\tclosures", "1\tgrid"},
+		},
+		{
+			kind:     kindNote | kindBook,
+			prefix:   "",
+			expected: []string{"css", "javascript", "js", "12\tclosures", "3\tflexbox", "1\tgrid"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.prefix, func(t *testing.T) {
+			assert.DeepEqual(t, candidates(d, tc.kind, tc.prefix), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestBookArgs(t *testing.T) {
+	// set up
+	ctx := initTestCtx(t)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b1-uuid", "js", false)
+	database.MustExec(t, "inserting b2", ctx.DB, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b2-uuid", "css", false)
+
+	f := BookArgs(ctx, 2)
+
+	t.Run("within the arguments", func(t *testing.T) {
+		got, directive := f(&cobra.Command{}, []string{"js"}, "c")
+
+		assert.DeepEqual(t, got, []string{"css"}, "result mismatch")
+		assert.Equal(t, directive, cobra.ShellCompDirectiveNoFileComp, "directive mismatch")
+	})
+
+	t.Run("past the arguments", func(t *testing.T) {
+		got, directive := f(&cobra.Command{}, []string{"js", "css"}, "")
+
+		assert.Equal(t, len(got), 0, "result mismatch")
+		assert.Equal(t, directive, cobra.ShellCompDirectiveNoFileComp, "directive mismatch")
+	})
+}
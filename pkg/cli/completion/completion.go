@@ -0,0 +1,209 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package completion keeps a cache of the data used by the shell completions, so that
+// completing a book or a note does not need to query the database on every TAB.
+package completion
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// cacheFilename is the name of the cache file in the cache directory
+	cacheFilename = "completion.json"
+	// recentNoteCount is the number of the most recently edited notes in the cache
+	recentNoteCount = 50
+	// maxTitleLength is the maximum number of characters in a note title
+	maxTitleLength = 50
+)
+
+// Note is a note that can be completed
+type Note struct {
+	RowID int    `json:"rowid"`
+	Title string `json:"title"`
+}
+
+// Data is the data used by the shell completions
+type Data struct {
+	Books []string `json:"books"`
+	Notes []Note   `json:"notes"`
+}
+
+// getCachePath returns the path to the cache file
+func getCachePath(ctx context.DnoteCtx) string {
+	return filepath.Join(ctx.Paths.Cache, consts.DnoteDirName, cacheFilename)
+}
+
+// isStale returns true if the database has been modified since the cache was written. The
+// changes are written to the write-ahead log before they reach the database file.
+func isStale(ctx context.DnoteCtx) bool {
+	cacheInfo, err := os.Stat(getCachePath(ctx))
+	if err != nil {
+		return true
+	}
+
+	dbInfo, err := os.Stat(ctx.DBPath)
+	if err != nil {
+		return true
+	}
+	if cacheInfo.ModTime().Before(dbInfo.ModTime()) {
+		return true
+	}
+
+	walInfo, err := os.Stat(ctx.DBPath + "-wal")
+	if err == nil && cacheInfo.ModTime().Before(walInfo.ModTime()) {
+		return true
+	}
+
+	return false
+}
+
+// getTitle returns the title of the note, shortened to fit in a completion menu
+func getTitle(title, body string) string {
+	title = database.NoteTitle(title, body)
+
+	runes := []rune(title)
+	if len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength-3]) + "..."
+	}
+
+	return title
+}
+
+// query reads the completion data from the database
+func query(db *database.DB) (Data, error) {
+	ret := Data{Books: []string{}, Notes: []Note{}}
+
+	rows, err := db.Query("SELECT label FROM books WHERE deleted = ? ORDER BY label ASC", false)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying books")
+	}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			rows.Close()
+			return ret, errors.Wrap(err, "scanning a book")
+		}
+
+		ret.Books = append(ret.Books, label)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT rowid, title, body FROM notes WHERE deleted = ?
+		ORDER BY max(coalesce(edited_on, 0), added_on) DESC LIMIT ?`, false, recentNoteCount)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note Note
+		var title, body string
+		if err := rows.Scan(&note.RowID, &title, &body); err != nil {
+			return ret, errors.Wrap(err, "scanning a note")
+		}
+
+		note.Title = getTitle(title, body)
+		ret.Notes = append(ret.Notes, note)
+	}
+
+	return ret, nil
+}
+
+// write writes the data to the cache file. The file is replaced atomically so that a
+// completion running at the same time never reads a partially written file.
+func write(ctx context.DnoteCtx, d Data) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "marshalling the data")
+	}
+
+	path := getCachePath(ctx)
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, 0600); err != nil {
+		return errors.Wrap(err, "writing the cache file")
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "replacing the cache file")
+	}
+
+	return nil
+}
+
+// read reads the data from the cache file
+func read(ctx context.DnoteCtx) (Data, error) {
+	var ret Data
+
+	b, err := ioutil.ReadFile(getCachePath(ctx))
+	if err != nil {
+		return ret, errors.Wrap(err, "reading the cache file")
+	}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return ret, errors.Wrap(err, "unmarshalling the cache file")
+	}
+
+	return ret, nil
+}
+
+// Refresh rewrites the cache if the database has been modified since it was written.
+func Refresh(ctx context.DnoteCtx) error {
+	if !isStale(ctx) {
+		return nil
+	}
+
+	d, err := query(ctx.DB)
+	if err != nil {
+		return err
+	}
+
+	return write(ctx, d)
+}
+
+// Load returns the completion data from the cache. If the cache is missing or stale,
+// it reads the data from the database and rewrites the cache.
+func Load(ctx context.DnoteCtx) (Data, error) {
+	if !isStale(ctx) {
+		d, err := read(ctx)
+		if err == nil {
+			return d, nil
+		}
+
+		log.Debug("reading the completion cache: %s\n", err.Error())
+	}
+
+	d, err := query(ctx.DB)
+	if err != nil {
+		return d, err
+	}
+
+	if err := write(ctx, d); err != nil {
+		log.Debug("writing the completion cache: %s\n", err.Error())
+	}
+
+	return d, nil
+}
@@ -0,0 +1,219 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package completion
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+)
+
+var paths = context.Paths{
+	Home:   "../tmp",
+	Cache:  "../tmp",
+	Config: "../tmp",
+	Data:   "../tmp",
+}
+
+func initTestCtx(t *testing.T) context.DnoteCtx {
+	ctx := context.InitTestCtx(t, paths, nil)
+	ctx.DBPath = filepath.Join(paths.Data, consts.DnoteDirName, consts.DnoteDBFileName)
+
+	return ctx
+}
+
+// touch sets the modification time of the file at the given path
+func touch(t *testing.T, path string, modTime time.Time) {
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetTitle(t *testing.T) {
+	testCases := []struct {
+		title    string
+		body     string
+		expected string
+	}{
+		{
+			body:     "foo",
+			expected: "foo",
+		},
+		{
+			title:    "qux",
+			body:     "foo",
+			expected: "qux",
+		},
+		{
+			body:     "\n  foo bar \nbaz",
+			expected: "foo bar",
+		},
+		{
+			body:     "foo\r\nbar",
+			expected: "foo",
+		},
+		{
+			body:     "",
+			expected: "",
+		},
+		{
+			body:     "0123456789012345678901234567890123456789012345678901234567890",
+			expected: "01234567890123456789012345678901234567890123456...",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("title %q body %q", tc.title, tc.body), func(t *testing.T) {
+			assert.Equal(t, getTitle(tc.title, tc.body), tc.expected, "title mismatch")
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	// set up
+	ctx := initTestCtx(t)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting b1", ctx.DB, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b1-uuid", "js", false)
+	database.MustExec(t, "inserting b2", ctx.DB, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b2-uuid", "css", false)
+	database.MustExec(t, "inserting b3", ctx.DB, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b3-uuid", "deleted-book", true)
+	database.MustExec(t, "inserting n1", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 title\nn1 body", 1, 5, false)
+	database.MustExec(t, "inserting n2", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 3, 0, false)
+	database.MustExec(t, "inserting n3", ctx.DB, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "", 4, 0, true)
+
+	var n1RowID, n2RowID int
+	database.MustScan(t, "getting n1 rowid", ctx.DB.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", "n1-uuid"), &n1RowID)
+	database.MustScan(t, "getting n2 rowid", ctx.DB.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", "n2-uuid"), &n2RowID)
+
+	// execute
+	got, err := Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	expected := Data{
+		Books: []string{"css", "js"},
+		Notes: []Note{
+			{RowID: n1RowID, Title: "n1 title"},
+			{RowID: n2RowID, Title: "n2 body"},
+		},
+	}
+	assert.DeepEqual(t, got, expected, "data mismatch")
+
+	cached, err := read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, cached, expected, "cached data mismatch")
+}
+
+func TestRefresh(t *testing.T) {
+	t.Run("stale", func(t *testing.T) {
+		// set up
+		ctx := initTestCtx(t)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if _, err := Load(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		database.MustExec(t, "inserting a book", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+		now := time.Now()
+		touch(t, getCachePath(ctx), now.Add(-time.Minute))
+		touch(t, ctx.DBPath, now)
+
+		// execute
+		if err := Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// test
+		got, err := read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, got.Books, []string{"js"}, "books mismatch")
+	})
+
+	t.Run("stale write-ahead log", func(t *testing.T) {
+		// set up
+		ctx := initTestCtx(t)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if _, err := Load(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		database.MustExec(t, "inserting a book", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+		now := time.Now()
+		touch(t, ctx.DBPath, now.Add(-2*time.Minute))
+		touch(t, getCachePath(ctx), now.Add(-time.Minute))
+		touch(t, ctx.DBPath+"-wal", now)
+
+		// execute
+		if err := Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// test
+		got, err := read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, got.Books, []string{"js"}, "books mismatch")
+	})
+
+	t.Run("fresh", func(t *testing.T) {
+		// set up
+		ctx := initTestCtx(t)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if _, err := Load(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		database.MustExec(t, "inserting a book", ctx.DB, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+		now := time.Now()
+		touch(t, ctx.DBPath, now.Add(-time.Minute))
+		touch(t, getCachePath(ctx), now)
+
+		// execute
+		if err := Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// test
+		got, err := Load(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, got.Books, []string{}, "books mismatch")
+	})
+}
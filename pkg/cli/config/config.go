@@ -30,10 +30,136 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	// DefaultSearchRecencyWeight is the default weight of the recency signal in search ranking
+	DefaultSearchRecencyWeight = 1.0
+	// DefaultSearchFrequencyWeight is the default weight of the view frequency signal in search ranking
+	DefaultSearchFrequencyWeight = 1.0
+	// DefaultHistoryRetentionDays is the default number of days for which the past versions of notes are kept
+	DefaultHistoryRetentionDays = 90
+	// DefaultTrashRetentionDays is the default number of days for which the removed notes are kept in the trash
+	DefaultTrashRetentionDays = 30
+	// DefaultPendingWarnThreshold is the default number of the changes pending sync above which a warning is shown
+	DefaultPendingWarnThreshold = 500
+	// DefaultThinCacheSize is the default number of note bodies kept locally in the thin mode
+	DefaultThinCacheSize = 200
+	// DefaultBackupKeep is the default number of the automatic local backups kept
+	DefaultBackupKeep = 5
+)
+
+// SearchConfig holds the configuration for ranking full text search results
+type SearchConfig struct {
+	RecencyWeight   *float64 `yaml:"recencyWeight,omitempty"`
+	FrequencyWeight *float64 `yaml:"frequencyWeight,omitempty"`
+}
+
+// SpellConfig holds the configuration for spell checking
+type SpellConfig struct {
+	// Dictionaries maps language tags to the paths of the dictionary files
+	Dictionaries map[string]string `yaml:"dictionaries,omitempty"`
+}
+
+// HistoryConfig holds the configuration for the past versions of notes
+type HistoryConfig struct {
+	// RetentionDays is the number of days for which the versions are kept. 0 keeps them forever.
+	RetentionDays *int `yaml:"retentionDays,omitempty"`
+}
+
+// TrashConfig holds the configuration for the removed notes
+type TrashConfig struct {
+	// RetentionDays is the number of days for which the removed notes are kept. 0 keeps them forever.
+	RetentionDays *int `yaml:"retentionDays,omitempty"`
+}
+
+// BackupConfig holds the configuration for the backups of the database
+type BackupConfig struct {
+	// Keep is the number of the automatic local backups kept. 0 turns them off.
+	Keep *int `yaml:"keep,omitempty"`
+}
+
+// OfflineConfig holds the configuration for the changes made while offline
+type OfflineConfig struct {
+	// WarnThreshold is the number of the changes pending sync above which a warning is shown. 0 disables the warning.
+	WarnThreshold *int `yaml:"warnThreshold,omitempty"`
+}
+
+// GoalConfig holds the configuration for the note writing goals
+type GoalConfig struct {
+	// Daily is the number of notes to write each day. 0 means no goal.
+	Daily int `yaml:"daily,omitempty"`
+	// Weekly is the number of notes to write each week. 0 means no goal.
+	Weekly int `yaml:"weekly,omitempty"`
+}
+
+// ThinConfig holds the configuration for the thin mode, in which only the recently
+// accessed note bodies are kept locally and the others are fetched from the server on demand
+type ThinConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// CacheSize is the number of note bodies kept locally
+	CacheSize *int `yaml:"cacheSize,omitempty"`
+}
+
+// EditorConfig holds the configuration for editing notes in a text editor
+type EditorConfig struct {
+	// Args are the extra arguments passed to the editor before the path of the file
+	Args []string `yaml:"args,omitempty"`
+	// FileSuffix is the suffix of the temporary file, such as '.md', from which the editor
+	// may choose the syntax highlighting
+	FileSuffix string `yaml:"fileSuffix,omitempty"`
+	// Frontmatter is whether the book, the title and the visibility of a note are edited
+	// with its content in a frontmatter. Defaults to true.
+	Frontmatter *bool `yaml:"frontmatter,omitempty"`
+	// TmpDir is the directory, such as a ramdisk, in which the temporary files holding
+	// the notes being edited are made, so that they never reach the disk
+	TmpDir string `yaml:"tmpDir,omitempty"`
+}
+
+// MetadataConfig holds the configuration for the key-value metadata of notes
+type MetadataConfig struct {
+	// Encryption is the provider, age or gpg, with which the metadata is encrypted to be
+	// synced. Empty keeps the metadata local.
+	Encryption string `yaml:"encryption,omitempty"`
+	// Recipients are the age recipients, or the GPG key ids or emails, to encrypt for
+	Recipients []string `yaml:"recipients,omitempty"`
+	// Identities are the age identity files to decrypt with
+	Identities []string `yaml:"identities,omitempty"`
+}
+
+// SyncConfig holds the configuration for syncing with the server
+type SyncConfig struct {
+	// PageSize is the number of books and notes requested in each sync fragment. 0 lets
+	// the server decide.
+	PageSize int `yaml:"pageSize,omitempty"`
+	// MaxRPS is the number of requests made to the server per second. 0 means no limit.
+	MaxRPS float64 `yaml:"maxRPS,omitempty"`
+	// MaxBandwidth is the bandwidth used for the server, such as '256K'. Empty means no limit.
+	MaxBandwidth string `yaml:"maxBandwidth,omitempty"`
+	// Webhook is the URL to which a summary is posted after each sync
+	Webhook string `yaml:"webhook,omitempty"`
+	// GitMirror is the git repository into which the notes are mirrored after each sync
+	GitMirror string `yaml:"gitMirror,omitempty"`
+}
+
 // Config holds dnote configuration
 type Config struct {
-	Editor      string `yaml:"editor"`
-	APIEndpoint string `yaml:"apiEndpoint"`
+	Editor        string       `yaml:"editor"`
+	EditorOptions EditorConfig `yaml:"editorOptions,omitempty"`
+	APIEndpoint   string       `yaml:"apiEndpoint"`
+	// Color is whether the output is colored. Defaults to true.
+	Color   *bool         `yaml:"color,omitempty"`
+	Search  SearchConfig  `yaml:"search,omitempty"`
+	Spell   SpellConfig   `yaml:"spell,omitempty"`
+	History HistoryConfig `yaml:"history,omitempty"`
+	Trash   TrashConfig   `yaml:"trash,omitempty"`
+	Offline OfflineConfig `yaml:"offline,omitempty"`
+	Goal    GoalConfig    `yaml:"goal,omitempty"`
+	Thin    ThinConfig    `yaml:"thin,omitempty"`
+	// Metadata is the configuration for the key-value metadata of notes
+	Metadata MetadataConfig `yaml:"metadata,omitempty"`
+	Sync     SyncConfig     `yaml:"sync,omitempty"`
+	Backup   BackupConfig   `yaml:"backup,omitempty"`
+	// CaseSensitiveBooks allows books whose labels differ only in case
+	CaseSensitiveBooks bool `yaml:"caseSensitiveBooks,omitempty"`
 }
 
 func checkLegacyPath(ctx context.DnoteCtx) (string, bool) {
@@ -0,0 +1,440 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/crypt"
+	"github.com/dnote/dnote/pkg/cli/validate"
+	"github.com/pkg/errors"
+)
+
+// Key is a setting in the config file that can be read and written by its name
+type Key struct {
+	// Name is the path to the setting in the config file, such as 'history.retentionDays'
+	Name  string
+	Usage string
+	// Default is the value in effect if the setting is not configured
+	Default string
+	// get returns the configured value, and false if the setting is not configured
+	get func(cf Config) (string, bool)
+	// set validates and configures the value. An empty value removes the setting.
+	set func(cf *Config, val string) error
+}
+
+// parseBool parses an optional boolean setting. An empty value returns nil.
+func parseBool(val string) (*bool, error) {
+	if val == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return nil, errors.Errorf("'%s' is not true or false", val)
+	}
+
+	return &b, nil
+}
+
+// parseCount parses an optional setting of a non-negative integer. An empty value returns nil.
+func parseCount(val string) (*int, error) {
+	if val == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return nil, errors.Errorf("'%s' is not a non-negative integer", val)
+	}
+
+	return &n, nil
+}
+
+// parseWeight parses an optional setting of a non-negative number. An empty value returns nil.
+func parseWeight(val string) (*float64, error) {
+	if val == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || f < 0 {
+		return nil, errors.Errorf("'%s' is not a non-negative number", val)
+	}
+
+	return &f, nil
+}
+
+func formatBool(b *bool) (string, bool) {
+	if b == nil {
+		return "", false
+	}
+
+	return strconv.FormatBool(*b), true
+}
+
+func formatCount(n *int) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+
+	return strconv.Itoa(*n), true
+}
+
+func formatWeight(f *float64) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+
+	return strconv.FormatFloat(*f, 'g', -1, 64), true
+}
+
+func formatString(s string) (string, bool) {
+	return s, s != ""
+}
+
+// Keys are the settings that can be managed by their names. The settings holding a list
+// or a map, such as 'editorOptions.args' and 'spell.dictionaries', are edited in the file.
+var Keys = []Key{
+	{
+		Name:    "editor",
+		Usage:   "the command to edit the notes with",
+		Default: "$EDITOR, or vim",
+		get:     func(cf Config) (string, bool) { return formatString(cf.Editor) },
+		set: func(cf *Config, val string) error {
+			cf.Editor = val
+			return nil
+		},
+	},
+	{
+		Name:  "editorOptions.fileSuffix",
+		Usage: "the suffix of the file being edited, such as '.md', for the syntax highlighting",
+		get:   func(cf Config) (string, bool) { return formatString(cf.EditorOptions.FileSuffix) },
+		set: func(cf *Config, val string) error {
+			cf.EditorOptions.FileSuffix = val
+			return nil
+		},
+	},
+	{
+		Name:    "editorOptions.frontmatter",
+		Usage:   "whether the book, the title and the visibility are edited in a frontmatter",
+		Default: "true",
+		get:     func(cf Config) (string, bool) { return formatBool(cf.EditorOptions.Frontmatter) },
+		set: func(cf *Config, val string) error {
+			b, err := parseBool(val)
+			cf.EditorOptions.Frontmatter = b
+			return err
+		},
+	},
+	{
+		Name:  "editorOptions.tmpDir",
+		Usage: "the directory in which the files being edited are made",
+		get:   func(cf Config) (string, bool) { return formatString(cf.EditorOptions.TmpDir) },
+		set: func(cf *Config, val string) error {
+			cf.EditorOptions.TmpDir = val
+			return nil
+		},
+	},
+	{
+		Name:  "apiEndpoint",
+		Usage: "the URL of the API of the server to sync with",
+		get:   func(cf Config) (string, bool) { return formatString(cf.APIEndpoint) },
+		set: func(cf *Config, val string) error {
+			if val != "" {
+				if err := validate.APIEndpoint(val); err != nil {
+					return err
+				}
+			}
+
+			cf.APIEndpoint = val
+			return nil
+		},
+	},
+	{
+		Name:    "color",
+		Usage:   "whether the output is colored",
+		Default: "true",
+		get:     func(cf Config) (string, bool) { return formatBool(cf.Color) },
+		set: func(cf *Config, val string) error {
+			b, err := parseBool(val)
+			cf.Color = b
+			return err
+		},
+	},
+	{
+		Name:    "search.recencyWeight",
+		Usage:   "how much the recently added, edited or viewed notes are boosted in the search results",
+		Default: strconv.FormatFloat(DefaultSearchRecencyWeight, 'g', -1, 64),
+		get:     func(cf Config) (string, bool) { return formatWeight(cf.Search.RecencyWeight) },
+		set: func(cf *Config, val string) error {
+			f, err := parseWeight(val)
+			cf.Search.RecencyWeight = f
+			return err
+		},
+	},
+	{
+		Name:    "search.frequencyWeight",
+		Usage:   "how much the frequently viewed notes are boosted in the search results",
+		Default: strconv.FormatFloat(DefaultSearchFrequencyWeight, 'g', -1, 64),
+		get:     func(cf Config) (string, bool) { return formatWeight(cf.Search.FrequencyWeight) },
+		set: func(cf *Config, val string) error {
+			f, err := parseWeight(val)
+			cf.Search.FrequencyWeight = f
+			return err
+		},
+	},
+	{
+		Name:    "history.retentionDays",
+		Usage:   "the number of days for which the past versions of the notes are kept. 0 keeps them forever",
+		Default: strconv.Itoa(DefaultHistoryRetentionDays),
+		get:     func(cf Config) (string, bool) { return formatCount(cf.History.RetentionDays) },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			cf.History.RetentionDays = n
+			return err
+		},
+	},
+	{
+		Name:    "trash.retentionDays",
+		Usage:   "the number of days for which the removed notes are kept in the trash. 0 keeps them forever",
+		Default: strconv.Itoa(DefaultTrashRetentionDays),
+		get:     func(cf Config) (string, bool) { return formatCount(cf.Trash.RetentionDays) },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			cf.Trash.RetentionDays = n
+			return err
+		},
+	},
+	{
+		Name:    "backup.keep",
+		Usage:   "the number of the local backups taken before the migrations and the full syncs that are kept. 0 turns them off",
+		Default: strconv.Itoa(DefaultBackupKeep),
+		get:     func(cf Config) (string, bool) { return formatCount(cf.Backup.Keep) },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			cf.Backup.Keep = n
+			return err
+		},
+	},
+	{
+		Name:    "offline.warnThreshold",
+		Usage:   "the number of the changes pending sync above which a warning is shown. 0 disables the warning",
+		Default: strconv.Itoa(DefaultPendingWarnThreshold),
+		get:     func(cf Config) (string, bool) { return formatCount(cf.Offline.WarnThreshold) },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			cf.Offline.WarnThreshold = n
+			return err
+		},
+	},
+	{
+		Name:    "goal.daily",
+		Usage:   "the number of notes to write each day. 0 means no goal",
+		Default: "0",
+		get:     func(cf Config) (string, bool) { return strconv.Itoa(cf.Goal.Daily), cf.Goal.Daily != 0 },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			if n != nil {
+				cf.Goal.Daily = *n
+			} else {
+				cf.Goal.Daily = 0
+			}
+			return err
+		},
+	},
+	{
+		Name:    "goal.weekly",
+		Usage:   "the number of notes to write each week. 0 means no goal",
+		Default: "0",
+		get:     func(cf Config) (string, bool) { return strconv.Itoa(cf.Goal.Weekly), cf.Goal.Weekly != 0 },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			if n != nil {
+				cf.Goal.Weekly = *n
+			} else {
+				cf.Goal.Weekly = 0
+			}
+			return err
+		},
+	},
+	{
+		Name:    "thin.enabled",
+		Usage:   "whether only the recently accessed note bodies are kept locally",
+		Default: "false",
+		get:     func(cf Config) (string, bool) { return strconv.FormatBool(cf.Thin.Enabled), cf.Thin.Enabled },
+		set: func(cf *Config, val string) error {
+			b, err := parseBool(val)
+			cf.Thin.Enabled = b != nil && *b
+			return err
+		},
+	},
+	{
+		Name:    "thin.cacheSize",
+		Usage:   "the number of note bodies kept locally in the thin mode",
+		Default: strconv.Itoa(DefaultThinCacheSize),
+		get:     func(cf Config) (string, bool) { return formatCount(cf.Thin.CacheSize) },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			if err == nil && n != nil && *n == 0 {
+				return errors.New("the cache size must be greater than 0")
+			}
+			cf.Thin.CacheSize = n
+			return err
+		},
+	},
+	{
+		Name:  "metadata.encryption",
+		Usage: "the provider, age or gpg, with which the metadata of the notes is encrypted to be synced",
+		get:   func(cf Config) (string, bool) { return formatString(cf.Metadata.Encryption) },
+		set: func(cf *Config, val string) error {
+			if val != "" && val != crypt.ProviderAge && val != crypt.ProviderGPG {
+				return errors.Errorf("'%s' is not %s or %s", val, crypt.ProviderAge, crypt.ProviderGPG)
+			}
+
+			cf.Metadata.Encryption = val
+			return nil
+		},
+	},
+	{
+		Name:    "sync.pageSize",
+		Usage:   "the number of books and notes requested in each sync fragment, up to 100. 0 lets the server decide",
+		Default: "0",
+		get:     func(cf Config) (string, bool) { return strconv.Itoa(cf.Sync.PageSize), cf.Sync.PageSize != 0 },
+		set: func(cf *Config, val string) error {
+			n, err := parseCount(val)
+			if n != nil {
+				cf.Sync.PageSize = *n
+				err = client.CheckSyncPageSize(*n)
+			} else {
+				cf.Sync.PageSize = 0
+			}
+			return err
+		},
+	},
+	{
+		Name:    "sync.maxRPS",
+		Usage:   "the number of requests made to the server per second. 0 means no limit",
+		Default: "0",
+		get: func(cf Config) (string, bool) {
+			return strconv.FormatFloat(cf.Sync.MaxRPS, 'g', -1, 64), cf.Sync.MaxRPS != 0
+		},
+		set: func(cf *Config, val string) error {
+			f, err := parseWeight(val)
+			if f != nil {
+				cf.Sync.MaxRPS = *f
+			} else {
+				cf.Sync.MaxRPS = 0
+			}
+			return err
+		},
+	},
+	{
+		Name:  "sync.maxBandwidth",
+		Usage: "the bandwidth used for the server in bytes per second, such as 256K or 2M",
+		get:   func(cf Config) (string, bool) { return formatString(cf.Sync.MaxBandwidth) },
+		set: func(cf *Config, val string) error {
+			if val != "" {
+				if _, err := client.ParseBandwidth(val); err != nil {
+					return err
+				}
+			}
+
+			cf.Sync.MaxBandwidth = val
+			return nil
+		},
+	},
+	{
+		Name:  "sync.webhook",
+		Usage: "the URL to which a JSON summary is posted after each sync",
+		get:   func(cf Config) (string, bool) { return formatString(cf.Sync.Webhook) },
+		set: func(cf *Config, val string) error {
+			if val != "" {
+				if err := validate.WebhookURL(val); err != nil {
+					return err
+				}
+			}
+
+			cf.Sync.Webhook = val
+			return nil
+		},
+	},
+	{
+		Name:  "sync.gitMirror",
+		Usage: "the absolute path to the git repository into which the notes are mirrored after each sync",
+		get:   func(cf Config) (string, bool) { return formatString(cf.Sync.GitMirror) },
+		set: func(cf *Config, val string) error {
+			if val != "" && !filepath.IsAbs(val) {
+				return errors.Errorf("'%s' is not an absolute path", val)
+			}
+
+			cf.Sync.GitMirror = val
+			return nil
+		},
+	},
+	{
+		Name:    "caseSensitiveBooks",
+		Usage:   "whether the books whose names differ only in case are allowed",
+		Default: "false",
+		get: func(cf Config) (string, bool) {
+			return strconv.FormatBool(cf.CaseSensitiveBooks), cf.CaseSensitiveBooks
+		},
+		set: func(cf *Config, val string) error {
+			b, err := parseBool(val)
+			cf.CaseSensitiveBooks = b != nil && *b
+			return err
+		},
+	},
+}
+
+// FindKey returns the setting with the given name
+func FindKey(name string) (Key, error) {
+	for _, k := range Keys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+
+	return Key{}, errors.Errorf("unknown setting '%s'. Run 'dnote config list' to see the settings", name)
+}
+
+// Set validates the value and configures the setting with the given name. An empty
+// value removes the setting, so that the default is in effect.
+func Set(cf *Config, name, val string) error {
+	k, err := FindKey(name)
+	if err != nil {
+		return err
+	}
+
+	// validate on a copy so that an invalid value leaves the config as it is
+	tmp := *cf
+	if err := k.set(&tmp, val); err != nil {
+		return errors.Wrapf(err, "invalid value for '%s'", name)
+	}
+
+	*cf = tmp
+
+	return nil
+}
+
+// Get returns the configured value of the setting, and false if it is not configured
+func (k Key) Get(cf Config) (string, bool) {
+	return k.get(cf)
+}
@@ -0,0 +1,102 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+)
+
+func TestSet(t *testing.T) {
+	testCases := []struct {
+		name     string
+		val      string
+		expected string
+		ok       bool
+	}{
+		{name: "editor", val: "nano", expected: "nano", ok: true},
+		{name: "apiEndpoint", val: "https://dnote.example.com/api", expected: "https://dnote.example.com/api", ok: true},
+		{name: "color", val: "false", expected: "false", ok: true},
+		{name: "trash.retentionDays", val: "0", expected: "0", ok: true},
+		{name: "search.recencyWeight", val: "0.5", expected: "0.5", ok: true},
+		{name: "goal.daily", val: "3", expected: "3", ok: true},
+		{name: "thin.enabled", val: "true", expected: "true", ok: true},
+		{name: "sync.pageSize", val: "20", expected: "20", ok: true},
+		{name: "sync.maxRPS", val: "0.5", expected: "0.5", ok: true},
+		{name: "sync.maxBandwidth", val: "256K", expected: "256K", ok: true},
+		{name: "sync.webhook", val: "https://hooks.example.com/dnote", expected: "https://hooks.example.com/dnote", ok: true},
+		{name: "sync.gitMirror", val: "/home/user/notes", expected: "/home/user/notes", ok: true},
+		{name: "backup.keep", val: "0", expected: "0", ok: true},
+		{name: "history.retentionDays", val: "", expected: "", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cf := Config{}
+			days := 7
+			cf.History.RetentionDays = &days
+
+			if err := Set(&cf, tc.name, tc.val); err != nil {
+				t.Fatalf("setting: %s", err)
+			}
+
+			k, err := FindKey(tc.name)
+			if err != nil {
+				t.Fatalf("finding the key: %s", err)
+			}
+
+			val, ok := k.Get(cf)
+			assert.Equal(t, val, tc.expected, "value mismatch")
+			assert.Equal(t, ok, tc.ok, "configured mismatch")
+		})
+	}
+}
+
+func TestSet_invalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  string
+	}{
+		{name: "unknown", val: "1"},
+		{name: "apiEndpoint", val: "dnote.example.com"},
+		{name: "color", val: "maybe"},
+		{name: "trash.retentionDays", val: "-1"},
+		{name: "search.frequencyWeight", val: "heavy"},
+		{name: "thin.cacheSize", val: "0"},
+		{name: "sync.pageSize", val: "101"},
+		{name: "sync.maxRPS", val: "-1"},
+		{name: "sync.maxBandwidth", val: "fast"},
+		{name: "sync.webhook", val: "hooks.example.com"},
+		{name: "sync.gitMirror", val: "notes"},
+		{name: "backup.keep", val: "-1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cf := Config{APIEndpoint: "https://api.getdnote.com"}
+
+			if err := Set(&cf, tc.name, tc.val); err == nil {
+				t.Error("expected an error")
+			}
+
+			assert.DeepEqual(t, cf, Config{APIEndpoint: "https://api.getdnote.com"}, "config mismatch")
+		})
+	}
+}
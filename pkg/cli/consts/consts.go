@@ -22,6 +22,9 @@ package consts
 var (
 	// LegacyDnoteDirName is the name of the legacy directory containing dnote files
 	LegacyDnoteDirName = ".dnote"
+	// MigratedLegacyDnoteDirName is the name to which the legacy directory is renamed after
+	// its files are moved to the XDG base directories
+	MigratedLegacyDnoteDirName = ".dnote-migrated"
 	// DnoteDirName is the name of the directory containing dnote files
 	DnoteDirName = "dnote"
 	// DnoteDBFileName is a filename for the Dnote SQLite database
@@ -30,6 +33,12 @@ var (
 	TmpContentFileBase = "DNOTE_TMPCONTENT"
 	// TmpContentFileExt is the extension for the temporary content file
 	TmpContentFileExt = "md"
+	// TmpDirName is the name of the private directory in the dnote directory for the
+	// temporary content files
+	TmpDirName = "tmp"
+	// BackupsDirName is the name of the directory next to the database for the local
+	// backups of the database
+	BackupsDirName = "backups"
 	// ConfigFilename is the name of the config file
 	ConfigFilename = "dnoterc"
 
@@ -37,6 +46,8 @@ var (
 	SystemSchema = "schema"
 	// SystemRemoteSchema is the key for remote schema in the system table
 	SystemRemoteSchema = "remote_schema"
+	// SystemSchemaVersion is the version of dnote that most recently migrated the database
+	SystemSchemaVersion = "schema_cli_version"
 	// SystemLastSyncAt is the timestamp of the server at the last sync
 	SystemLastSyncAt = "last_sync_time"
 	// SystemLastMaxUSN is the user's max_usn from the server at the alst sync
@@ -47,4 +58,14 @@ var (
 	SystemSessionKey = "session_token"
 	// SystemSessionKeyExpiry is the timestamp at which the session key will expire
 	SystemSessionKeyExpiry = "session_token_expiry"
+	// SystemRefreshToken is the token with which an expired session is renewed
+	SystemRefreshToken = "refresh_token"
+	// SystemLastExportAt is the timestamp at which the notes were most recently exported
+	SystemLastExportAt = "last_export_at"
+	// SystemSyncMSPerChange is the time in milliseconds it took to upload each change in the last sync
+	SystemSyncMSPerChange = "sync_ms_per_change"
+	// SystemLastPendingWarning is the timestamp at which the pending changes were most recently warned about
+	SystemLastPendingWarning = "last_pending_warning"
+	// SystemMetadataKeys is the tag of the newest keys for which the synced metadata of the notes is encrypted
+	SystemMetadataKeys = "metadata_keys"
 )
@@ -0,0 +1,67 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package consts
+
+// SystemKey describes a key that dnote stores in the system table
+type SystemKey struct {
+	Name string
+	// Integer is true if the value is an integer, such as a timestamp or a usn
+	Integer bool
+	// Default is the value to which an invalid value is reset. Empty if there is none.
+	Default string
+	// Optional is true if the key may be missing, so that an invalid value can be removed
+	Optional bool
+	// Requires is the key without which the value is meaningless. Empty if there is none.
+	Requires string
+}
+
+// SystemKeys is the registry of the keys in use in the system table. A feature that stores
+// a new key must add it here, or `dnote doctor --system` reports it as unknown.
+var SystemKeys = []SystemKey{
+	{Name: SystemSchema, Integer: true},
+	{Name: SystemRemoteSchema, Integer: true},
+	{Name: SystemLastSyncAt, Integer: true, Default: "0"},
+	{Name: SystemLastMaxUSN, Integer: true, Default: "0"},
+	{Name: SystemLastUpgrade, Integer: true, Default: "0"},
+	{Name: SystemSessionKey, Optional: true},
+	{Name: SystemSessionKeyExpiry, Integer: true, Optional: true, Requires: SystemSessionKey},
+	{Name: SystemRefreshToken, Optional: true, Requires: SystemSessionKey},
+	{Name: SystemLastExportAt, Integer: true, Optional: true},
+	{Name: SystemSyncMSPerChange, Integer: true, Optional: true},
+	{Name: SystemLastPendingWarning, Integer: true, Optional: true},
+	{Name: SystemMetadataKeys, Optional: true},
+}
+
+// ObsoleteSystemKeys are the keys written by the older versions that are no longer read
+var ObsoleteSystemKeys = []string{
+	// written by the migration from the legacy YAML files
+	"last_action",
+	"bookmark",
+}
+
+// GetSystemKey returns the registered key with the given name
+func GetSystemKey(name string) (SystemKey, bool) {
+	for _, k := range SystemKeys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+
+	return SystemKey{}, false
+}
@@ -20,6 +20,8 @@
 package context
 
 import (
+	"time"
+
 	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/clock"
 )
@@ -31,18 +33,101 @@ type Paths struct {
 	Data        string
 	Cache       string
 	LegacyDnote string
+	// DB is the path to the database overriding the default location, or empty
+	DB string
+}
+
+// SearchWeights holds the weights used to blend ranking signals into
+// full text search results
+type SearchWeights struct {
+	Recency   float64
+	Frequency float64
+}
+
+// Goal holds the number of notes the user aims to write. A zero value means no goal.
+type Goal struct {
+	Daily  int
+	Weekly int
+}
+
+// EditorOptions holds the settings for editing notes in a text editor
+type EditorOptions struct {
+	// Args are the extra arguments passed to the editor before the path of the file
+	Args []string
+	// FileSuffix is the suffix of the temporary file. Empty uses the default suffix.
+	FileSuffix string
+	// Frontmatter is true if the metadata of a note is edited in a frontmatter
+	Frontmatter bool
+	// TmpDir is the directory in which the temporary files are made. Empty uses the
+	// private directory in the dnote data directory.
+	TmpDir string
+}
+
+// Thin holds the settings of the thin mode
+type Thin struct {
+	Enabled bool
+	// CacheSize is the number of note bodies kept locally
+	CacheSize int
+}
+
+// Metadata holds the settings for syncing the key-value metadata of notes
+type Metadata struct {
+	// Encryption is the provider with which the metadata is encrypted to be synced. Empty
+	// keeps the metadata local.
+	Encryption string
+	Recipients []string
+	Identities []string
+}
+
+// Throttle holds the limits on the requests to the server. A zero value means no limit.
+type Throttle struct {
+	// MaxRPS is the number of requests per second
+	MaxRPS float64
+	// MaxBandwidth is the number of bytes transferred per second
+	MaxBandwidth int
 }
 
 // DnoteCtx is a context holding the information of the current runtime
 type DnoteCtx struct {
 	Paths            Paths
+	DBPath           string
 	APIEndpoint      string
 	Version          string
 	DB               *database.DB
 	SessionKey       string
 	SessionKeyExpiry int64
-	Editor           string
-	Clock            clock.Clock
+	// RefreshToken renews the session when it expires. It is empty if the server
+	// does not support renewing the sessions.
+	RefreshToken  string
+	Editor        string
+	EditorOptions EditorOptions
+	Clock         clock.Clock
+	SearchWeights SearchWeights
+	// CaseSensitiveBooks is true if book labels that differ only in case refer to different books
+	CaseSensitiveBooks bool
+	// HistoryRetention is how long the past versions of notes are kept. 0 keeps them forever.
+	HistoryRetention time.Duration
+	// TrashRetention is how long the removed notes are kept in the trash. 0 keeps them forever.
+	TrashRetention time.Duration
+	// PendingWarnThreshold is the number of the changes pending sync above which a warning is shown. 0 disables it.
+	PendingWarnThreshold int
+	// BackupKeep is the number of the automatic local backups kept. 0 turns them off.
+	BackupKeep int
+	// APIDialAddr is the address to connect to for the API endpoint in place of its host,
+	// such as the local end of an SSH tunnel. Empty connects to the host.
+	APIDialAddr string
+	Goal        Goal
+	Thin        Thin
+	Metadata    Metadata
+	// SyncPageSize is the number of books and notes requested in each sync fragment. 0 lets
+	// the server decide.
+	SyncPageSize int
+	Throttle     Throttle
+	// SyncWebhook is the URL to which a summary is posted after each sync, or empty
+	SyncWebhook string
+	// SyncGitMirror is the git repository into which the notes are mirrored after each
+	// sync, or empty
+	SyncGitMirror string
 }
 
 // Redact replaces private information from the context with a set of
@@ -55,6 +140,9 @@ func Redact(ctx DnoteCtx) DnoteCtx {
 		sessionKey = "0"
 	}
 	ctx.SessionKey = sessionKey
+	if ctx.RefreshToken != "" {
+		ctx.RefreshToken = "1"
+	}
 
 	return ctx
 }
@@ -0,0 +1,170 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package crypt
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ProviderAge is the provider that encrypts for age recipients with the age command
+	ProviderAge = "age"
+	// ProviderGPG is the provider that encrypts for GPG keys with the gpg command
+	ProviderGPG = "gpg"
+)
+
+// Provider encrypts and decrypts streams with a key infrastructure other than the account
+// cipher key, so that the encrypted data can be shared with specific people
+type Provider interface {
+	// Name returns the name of the provider
+	Name() string
+	// Encrypt encrypts the data read from src for the recipients and writes it to dst
+	Encrypt(dst io.Writer, src io.Reader) error
+	// Decrypt decrypts the data read from src and writes it to dst
+	Decrypt(dst io.Writer, src io.Reader) error
+}
+
+// commandProvider is a provider that runs an external command
+type commandProvider struct {
+	name        string
+	bin         string
+	encryptArgs []string
+	decryptArgs []string
+}
+
+func (p commandProvider) Name() string {
+	return p.name
+}
+
+func (p commandProvider) run(args []string, dst io.Writer, src io.Reader) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(p.bin, args...)
+	cmd.Stdin = src
+	cmd.Stdout = dst
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.Error); ok {
+			return errors.Errorf("'%s' was not found. Install it to use %s", p.bin, p.name)
+		}
+
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+
+		return errors.Errorf("%s: %s", p.bin, msg)
+	}
+
+	return nil
+}
+
+func (p commandProvider) Encrypt(dst io.Writer, src io.Reader) error {
+	return p.run(p.encryptArgs, dst, src)
+}
+
+func (p commandProvider) Decrypt(dst io.Writer, src io.Reader) error {
+	return p.run(p.decryptArgs, dst, src)
+}
+
+// NewAgeProvider returns a provider that encrypts for the given age recipients, and decrypts
+// with the given identity files
+func NewAgeProvider(recipients, identities []string) Provider {
+	encryptArgs := []string{"--encrypt", "--armor"}
+	for _, r := range recipients {
+		encryptArgs = append(encryptArgs, "--recipient", r)
+	}
+
+	decryptArgs := []string{"--decrypt"}
+	for _, i := range identities {
+		decryptArgs = append(decryptArgs, "--identity", i)
+	}
+
+	return commandProvider{
+		name:        ProviderAge,
+		bin:         "age",
+		encryptArgs: encryptArgs,
+		decryptArgs: decryptArgs,
+	}
+}
+
+// NewGPGProvider returns a provider that encrypts for the given GPG key ids or emails, and
+// decrypts with the secret keys in the keyring of the user
+func NewGPGProvider(recipients []string) Provider {
+	encryptArgs := []string{"--batch", "--yes", "--armor", "--encrypt"}
+	for _, r := range recipients {
+		encryptArgs = append(encryptArgs, "--recipient", r)
+	}
+
+	return commandProvider{
+		name:        ProviderGPG,
+		bin:         "gpg",
+		encryptArgs: encryptArgs,
+		decryptArgs: []string{"--batch", "--yes", "--decrypt"},
+	}
+}
+
+// NewProvider returns the provider with the given name. The identities are used only by age
+// to decrypt, while gpg finds the secret keys in the keyring.
+func NewProvider(name string, recipients, identities []string) (Provider, error) {
+	switch name {
+	case ProviderAge:
+		return NewAgeProvider(recipients, identities), nil
+	case ProviderGPG:
+		return NewGPGProvider(recipients), nil
+	}
+
+	return nil, errors.Errorf("unknown encryption provider '%s'. Use '%s' or '%s'", name, ProviderAge, ProviderGPG)
+}
+
+// headers are the prefixes of the data encrypted by each provider, both armored and binary
+var headers = []struct {
+	provider string
+	prefix   []byte
+}{
+	{provider: ProviderAge, prefix: []byte("-----BEGIN AGE ENCRYPTED FILE-----")},
+	{provider: ProviderAge, prefix: []byte("age-encryption.org/")},
+	{provider: ProviderGPG, prefix: []byte("-----BEGIN PGP MESSAGE-----")},
+}
+
+// Detect returns the name of the provider that encrypted the data starting with the given
+// header, or an empty string if the data does not look encrypted
+func Detect(header []byte) string {
+	trimmed := bytes.TrimLeft(header, " \t\r\n")
+
+	for _, h := range headers {
+		if bytes.HasPrefix(trimmed, h.prefix) {
+			return h.provider
+		}
+	}
+
+	// a binary OpenPGP message starts with a public-key encrypted session key packet,
+	// in either the old or the new packet format
+	if len(header) > 0 && ((header[0] >= 0x84 && header[0] <= 0x87) || header[0] == 0xc1) {
+		return ProviderGPG
+	}
+
+	return ""
+}
@@ -0,0 +1,124 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		header   []byte
+		expected string
+	}{
+		{header: []byte("-----BEGIN AGE ENCRYPTED FILE-----\nYWdl"), expected: ProviderAge},
+		{header: []byte("age-encryption.org/v1\n-> X25519"), expected: ProviderAge},
+		{header: []byte("\n-----BEGIN PGP MESSAGE-----\n\nhQ"), expected: ProviderGPG},
+		{header: []byte{0x85, 0x01, 0x0c}, expected: ProviderGPG},
+		{header: []byte{0xc1, 0xc0, 0x4c}, expected: ProviderGPG},
+		{header: []byte("{\n  \"books\": []"), expected: ""},
+		{header: []byte{}, expected: ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, Detect(tc.header), tc.expected, "provider mismatch for "+string(tc.header))
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider(ProviderAge, []string{"age1a", "age1b"}, []string{"key.txt"})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting age"))
+	}
+	cp := p.(commandProvider)
+	assert.DeepEqual(t, cp.encryptArgs, []string{"--encrypt", "--armor", "--recipient", "age1a", "--recipient", "age1b"}, "age encrypt args mismatch")
+	assert.DeepEqual(t, cp.decryptArgs, []string{"--decrypt", "--identity", "key.txt"}, "age decrypt args mismatch")
+
+	p, err = NewProvider(ProviderGPG, []string{"alice@example.com"}, nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting gpg"))
+	}
+	assert.Equal(t, p.Name(), ProviderGPG, "name mismatch")
+
+	if _, err := NewProvider("rot13", nil, nil); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
+
+func TestCommandProvider(t *testing.T) {
+	t.Run("missing command", func(t *testing.T) {
+		p := commandProvider{name: "test", bin: "dnote-missing-command"}
+
+		err := p.Encrypt(&bytes.Buffer{}, strings.NewReader("foo"))
+		if err == nil || !strings.Contains(err.Error(), "was not found") {
+			t.Fatalf("expected an error about the missing command but got %v", err)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		p := commandProvider{name: "test", bin: "sh", encryptArgs: []string{"-c", "echo no recipient >&2; exit 1"}}
+
+		err := p.Encrypt(&bytes.Buffer{}, strings.NewReader("foo"))
+		if err == nil || !strings.Contains(err.Error(), "no recipient") {
+			t.Fatalf("expected the error output of the command but got %v", err)
+		}
+	})
+}
+
+func TestGPGProvider(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+
+	home, err := ioutil.TempDir("", "dnote-gpg")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a gpg home"))
+	}
+	defer os.RemoveAll(home)
+
+	os.Setenv("GNUPGHOME", home)
+	defer os.Unsetenv("GNUPGHOME")
+	defer exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+
+	if out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "alice@example.com", "default", "default", "never").CombinedOutput(); err != nil {
+		t.Skipf("generating a key: %s", out)
+	}
+
+	p := NewGPGProvider([]string{"alice@example.com"})
+
+	var encrypted bytes.Buffer
+	if err := p.Encrypt(&encrypted, strings.NewReader("foo bar")); err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting"))
+	}
+	assert.Equal(t, Detect(encrypted.Bytes()), ProviderGPG, "detected provider mismatch")
+
+	var decrypted bytes.Buffer
+	if err := p.Decrypt(&decrypted, &encrypted); err != nil {
+		t.Fatal(errors.Wrap(err, "decrypting"))
+	}
+	assert.Equal(t, decrypted.String(), "foo bar", "decrypted mismatch")
+}
@@ -0,0 +1,357 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ftsTableSQL creates the full text search index of the note bodies
+var ftsTableSQL = `CREATE VIRTUAL TABLE note_fts USING fts5(content=notes, body, tokenize="porter unicode61 categories 'L* N* Co Ps Pe'")`
+
+// ftsTrigger is a trigger that keeps the full text search index in sync with the notes
+type ftsTrigger struct {
+	name string
+	sql  string
+}
+
+var ftsTriggers = []ftsTrigger{
+	{"notes_after_insert", `CREATE TRIGGER notes_after_insert AFTER INSERT ON notes BEGIN
+		INSERT INTO note_fts(rowid, body) VALUES (new.rowid, new.body);
+	END`},
+	{"notes_after_delete", `CREATE TRIGGER notes_after_delete AFTER DELETE ON notes BEGIN
+		INSERT INTO note_fts(note_fts, rowid, body) VALUES ('delete', old.rowid, old.body);
+	END`},
+	{"notes_after_update", `CREATE TRIGGER notes_after_update AFTER UPDATE ON notes BEGIN
+		INSERT INTO note_fts(note_fts, rowid, body) VALUES ('delete', old.rowid, old.body);
+		INSERT INTO note_fts(rowid, body) VALUES (new.rowid, new.body);
+	END`},
+}
+
+const (
+	// TokenizerPorter stems English words, and is the default tokenizer of the books
+	TokenizerPorter = "porter"
+	// TokenizerUnicode61 splits the words without stemming them, and suits the
+	// languages other than English that separate words by spaces
+	TokenizerUnicode61 = "unicode61"
+	// TokenizerTrigram matches any substring of three or more characters, and suits
+	// the languages that do not separate words by spaces, such as Chinese and Japanese
+	TokenizerTrigram = "trigram"
+)
+
+// FTSRoute maps a tokenizer to the full text search index that the notes in the books
+// using the tokenizer are searched in
+type FTSRoute struct {
+	Tokenizer string
+	Table     string
+}
+
+// FTSRoutes are the full text search indices for the tokenizers
+var FTSRoutes = []FTSRoute{
+	{TokenizerPorter, "note_fts"},
+	{TokenizerUnicode61, "note_fts_unicode61"},
+	{TokenizerTrigram, "note_fts_trigram"},
+}
+
+// IsTokenizer returns true if the given name is a tokenizer a book can use
+func IsTokenizer(name string) bool {
+	for _, r := range FTSRoutes {
+		if r.Tokenizer == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routedFTSTable is a full text search index of the notes in the books that use its
+// tokenizer. Unlike note_fts, which indexes all notes, it keeps its own copy of the
+// bodies so that a note can be removed from it without knowing whether it was indexed.
+type routedFTSTable struct {
+	tokenizer string
+	name      string
+	sql       string
+	triggers  []ftsTrigger
+}
+
+func newRoutedFTSTable(tokenizer, tokenize string) routedFTSTable {
+	name := fmt.Sprintf("note_fts_%s", tokenizer)
+
+	return routedFTSTable{
+		tokenizer: tokenizer,
+		name:      name,
+		sql:       fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts5(body, tokenize="%s")`, name, tokenize),
+		triggers: []ftsTrigger{
+			{fmt.Sprintf("notes_after_insert_%s", tokenizer), fmt.Sprintf(`CREATE TRIGGER notes_after_insert_%[1]s AFTER INSERT ON notes BEGIN
+		INSERT INTO %[2]s(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = '%[1]s';
+	END`, tokenizer, name)},
+			{fmt.Sprintf("notes_after_delete_%s", tokenizer), fmt.Sprintf(`CREATE TRIGGER notes_after_delete_%[1]s AFTER DELETE ON notes BEGIN
+		DELETE FROM %[2]s WHERE rowid = old.rowid;
+	END`, tokenizer, name)},
+			{fmt.Sprintf("notes_after_update_%s", tokenizer), fmt.Sprintf(`CREATE TRIGGER notes_after_update_%[1]s AFTER UPDATE ON notes BEGIN
+		DELETE FROM %[2]s WHERE rowid = old.rowid;
+		INSERT INTO %[2]s(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = '%[1]s';
+	END`, tokenizer, name)},
+			// the notes are moved to a book before its uuid changes during the sync, so
+			// a change to the uuid of a book routes its notes again, too
+			{fmt.Sprintf("books_after_update_%s", tokenizer), fmt.Sprintf(`CREATE TRIGGER books_after_update_%[1]s AFTER UPDATE OF uuid, tokenizer ON books BEGIN
+		DELETE FROM %[2]s WHERE rowid IN (SELECT rowid FROM notes WHERE book_uuid IN (old.uuid, new.uuid));
+		INSERT INTO %[2]s(rowid, body) SELECT rowid, body FROM notes WHERE book_uuid = new.uuid AND new.tokenizer = '%[1]s';
+	END`, tokenizer, name)},
+		},
+	}
+}
+
+var routedFTSTables = []routedFTSTable{
+	newRoutedFTSTable(TokenizerUnicode61, "unicode61 categories 'L* N* Co Ps Pe'"),
+	newRoutedFTSTable(TokenizerTrigram, "trigram"),
+}
+
+// populateSQL returns the SQL that indexes the notes in the books using the tokenizer
+func (t routedFTSTable) populateSQL() string {
+	return fmt.Sprintf(`INSERT INTO %s(rowid, body) SELECT notes.rowid, notes.body FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE books.tokenizer = '%s'`, t.name, t.tokenizer)
+}
+
+// isStale returns true if the number of the notes in the index differs from the number
+// of the notes in the books using the tokenizer
+func (t routedFTSTable) isStale(db *DB) (bool, error) {
+	var noteCount, indexCount int
+	if err := db.QueryRow(`SELECT count(*) FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE books.tokenizer = ?`, t.tokenizer).Scan(&noteCount); err != nil {
+		return false, errors.Wrapf(err, "counting the notes using %s", t.tokenizer)
+	}
+	if err := db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s", t.name)).Scan(&indexCount); err != nil {
+		return false, errors.Wrapf(err, "counting the notes in %s", t.name)
+	}
+
+	return noteCount != indexCount, nil
+}
+
+// normalizeSQL collapses the whitespaces in the given SQL so that statements
+// that differ only in formatting compare equal
+func normalizeSQL(s string) string {
+	return strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimSpace(s), ";")), " ")
+}
+
+// getSchemaSQL returns the SQL that created the schema object with the given name, or
+// an empty string if it does not exist
+func getSchemaSQL(db *DB, name string) (string, error) {
+	rows, err := db.Query("SELECT sql FROM sqlite_master WHERE name = ?", name)
+	if err != nil {
+		return "", errors.Wrapf(err, "querying %s", name)
+	}
+	defer rows.Close()
+
+	var ret string
+	if rows.Next() {
+		if err := rows.Scan(&ret); err != nil {
+			return "", errors.Wrapf(err, "scanning %s", name)
+		}
+	}
+
+	return ret, nil
+}
+
+// CheckFTS checks that the full text search index and its triggers exist as defined,
+// and that the index matches the notes. It returns the descriptions of the problems found.
+func CheckFTS(db *DB) ([]string, error) {
+	ret := []string{}
+
+	tableSQL, err := getSchemaSQL(db, "note_fts")
+	if err != nil {
+		return nil, err
+	}
+	if tableSQL == "" {
+		return append(ret, "the search index does not exist"), nil
+	}
+
+	triggerProblems, err := checkFTSTriggers(db, ftsTriggers)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, triggerProblems...)
+
+	// the integrity check with the rank of 1 also compares the index with the notes
+	if _, err := db.Exec("INSERT INTO note_fts(note_fts, rank) VALUES ('integrity-check', 1)"); err != nil {
+		ret = append(ret, "the search index does not match the notes")
+	}
+
+	for _, t := range routedFTSTables {
+		tableSQL, err := getSchemaSQL(db, t.name)
+		if err != nil {
+			return nil, err
+		}
+		if tableSQL == "" {
+			ret = append(ret, fmt.Sprintf("the search index for %s does not exist", t.tokenizer))
+			continue
+		}
+
+		triggerProblems, err := checkFTSTriggers(db, t.triggers)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, triggerProblems...)
+
+		stale, err := t.isStale(db)
+		if err != nil {
+			return nil, err
+		}
+		if stale {
+			ret = append(ret, fmt.Sprintf("the search index for %s does not match the notes", t.tokenizer))
+		}
+	}
+
+	return ret, nil
+}
+
+// checkFTSTriggers returns the descriptions of the triggers that are missing or differ
+// from their definitions
+func checkFTSTriggers(db *DB, triggers []ftsTrigger) ([]string, error) {
+	ret := []string{}
+
+	for _, t := range triggers {
+		triggerSQL, err := getSchemaSQL(db, t.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if triggerSQL == "" {
+			ret = append(ret, fmt.Sprintf("the trigger %s does not exist", t.name))
+		} else if normalizeSQL(triggerSQL) != normalizeSQL(t.sql) {
+			ret = append(ret, fmt.Sprintf("the trigger %s differs from its definition", t.name))
+		}
+	}
+
+	return ret, nil
+}
+
+// IsFTSStale returns true if the full text search index or a trigger is missing, or the
+// number of the notes in the index differs from the number of the notes. It is cheaper
+// than CheckFTS, and catches the most common cases of a stale index.
+func IsFTSStale(db *DB) (bool, error) {
+	names := []interface{}{"note_fts"}
+	for _, t := range ftsTriggers {
+		names = append(names, t.name)
+	}
+	for _, t := range routedFTSTables {
+		names = append(names, t.name)
+		for _, tr := range t.triggers {
+			names = append(names, tr.name)
+		}
+	}
+
+	var objectCount int
+	query := fmt.Sprintf("SELECT count(*) FROM sqlite_master WHERE name IN (?%s)", strings.Repeat(", ?", len(names)-1))
+	if err := db.QueryRow(query, names...).Scan(&objectCount); err != nil {
+		return false, errors.Wrap(err, "counting the search index and its triggers")
+	}
+	if objectCount != len(names) {
+		return true, nil
+	}
+
+	var noteCount, indexCount int
+	if err := db.QueryRow("SELECT count(*) FROM notes").Scan(&noteCount); err != nil {
+		return false, errors.Wrap(err, "counting the notes")
+	}
+	if err := db.QueryRow("SELECT count(*) FROM note_fts_docsize").Scan(&indexCount); err != nil {
+		return false, errors.Wrap(err, "counting the indexed notes")
+	}
+
+	if noteCount != indexCount {
+		return true, nil
+	}
+
+	for _, t := range routedFTSTables {
+		stale, err := t.isStale(db)
+		if err != nil {
+			return false, err
+		}
+		if stale {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// RebuildFTS drops the full text search index and its triggers, and creates them
+// again from the notes.
+func RebuildFTS(tx *DB) error {
+	for _, t := range ftsTriggers {
+		if _, err := tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s", t.name)); err != nil {
+			return errors.Wrapf(err, "dropping the trigger %s", t.name)
+		}
+	}
+	if _, err := tx.Exec("DROP TABLE IF EXISTS note_fts"); err != nil {
+		return errors.Wrap(err, "dropping the search index")
+	}
+
+	if _, err := tx.Exec(ftsTableSQL); err != nil {
+		return errors.Wrap(err, "creating the search index")
+	}
+	for _, t := range ftsTriggers {
+		if _, err := tx.Exec(t.sql); err != nil {
+			return errors.Wrapf(err, "creating the trigger %s", t.name)
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO note_fts(note_fts) VALUES ('rebuild')"); err != nil {
+		return errors.Wrap(err, "populating the search index")
+	}
+
+	for _, t := range routedFTSTables {
+		if err := rebuildRoutedFTS(tx, t); err != nil {
+			return errors.Wrapf(err, "rebuilding the search index for %s", t.tokenizer)
+		}
+	}
+
+	return nil
+}
+
+func rebuildRoutedFTS(tx *DB, t routedFTSTable) error {
+	for _, tr := range t.triggers {
+		if _, err := tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s", tr.name)); err != nil {
+			return errors.Wrapf(err, "dropping the trigger %s", tr.name)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", t.name)); err != nil {
+		return errors.Wrap(err, "dropping the index")
+	}
+
+	if _, err := tx.Exec(t.sql); err != nil {
+		return errors.Wrap(err, "creating the index")
+	}
+	for _, tr := range t.triggers {
+		if _, err := tx.Exec(tr.sql); err != nil {
+			return errors.Wrapf(err, "creating the trigger %s", tr.name)
+		}
+	}
+
+	if _, err := tx.Exec(t.populateSQL()); err != nil {
+		return errors.Wrap(err, "populating the index")
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+)
+
+func TestCheckFTS(t *testing.T) {
+	t.Run("consistent", func(t *testing.T) {
+		// set up
+		db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+		defer TeardownTestDB(t, db)
+
+		MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "foo", 1)
+
+		// execute
+		problems, err := CheckFTS(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// test
+		assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+	})
+
+	t.Run("missing trigger and stale index", func(t *testing.T) {
+		// set up
+		db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+		defer TeardownTestDB(t, db)
+
+		MustExec(t, "dropping a trigger", db, "DROP TRIGGER notes_after_insert")
+		MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "foo", 1)
+
+		// execute
+		problems, err := CheckFTS(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// test
+		assert.DeepEqual(t, problems, []string{
+			"the trigger notes_after_insert does not exist",
+			"the search index does not match the notes",
+		}, "problems mismatch")
+	})
+}
+
+func TestIsFTSStale(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "foo", 1)
+
+	stale, err := IsFTSStale(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, stale, false, "stale mismatch for a consistent index")
+
+	// execute
+	MustExec(t, "removing n1 from the index", db, "INSERT INTO note_fts(note_fts, rowid, body) VALUES ('delete', 1, 'foo')")
+
+	stale, err = IsFTSStale(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test
+	assert.Equal(t, stale, true, "stale mismatch for a stale index")
+}
+
+func TestRebuildFTS(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	MustExec(t, "dropping a trigger", db, "DROP TRIGGER notes_after_update")
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "foo", 1)
+	MustExec(t, "updating n1", db, "UPDATE notes SET body = ? WHERE uuid = ?", "bar", "n1-uuid")
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RebuildFTS(tx); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	tx.Commit()
+
+	// test
+	problems, err := CheckFTS(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+
+	var count int
+	MustScan(t, "searching", db.QueryRow("SELECT count(*) FROM note_fts WHERE note_fts MATCH ?", "bar"), &count)
+	assert.Equal(t, count, 1, "search result count mismatch")
+
+	// the triggers keep the index in sync after the rebuild
+	MustExec(t, "updating n1 again", db, "UPDATE notes SET body = ? WHERE uuid = ?", "baz", "n1-uuid")
+	MustScan(t, "searching again", db.QueryRow("SELECT count(*) FROM note_fts WHERE note_fts MATCH ?", "baz"), &count)
+	assert.Equal(t, count, 1, "search result count mismatch after update")
+}
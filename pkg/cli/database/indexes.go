@@ -0,0 +1,71 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Index is an index on which the queries rely
+type Index struct {
+	Name string
+	// SQL creates the index if it does not exist
+	SQL string
+}
+
+// Indexes are the indexes that the sync and listing queries need, for looking up the
+// notes by their books, scanning the dirty rows and checking the book labels
+var Indexes = []Index{
+	{Name: "idx_books_label", SQL: "CREATE UNIQUE INDEX IF NOT EXISTS idx_books_label ON books(label)"},
+	{Name: "idx_books_uuid", SQL: "CREATE UNIQUE INDEX IF NOT EXISTS idx_books_uuid ON books(uuid)"},
+	{Name: "idx_books_dirty", SQL: "CREATE INDEX IF NOT EXISTS idx_books_dirty ON books(dirty)"},
+	{Name: "idx_notes_uuid", SQL: "CREATE UNIQUE INDEX IF NOT EXISTS idx_notes_uuid ON notes(uuid)"},
+	{Name: "idx_notes_book_uuid", SQL: "CREATE INDEX IF NOT EXISTS idx_notes_book_uuid ON notes(book_uuid)"},
+	{Name: "idx_notes_dirty", SQL: "CREATE INDEX IF NOT EXISTS idx_notes_dirty ON notes(dirty)"},
+}
+
+// FindMissingIndexes returns the indexes in Indexes that do not exist in the database
+func FindMissingIndexes(db *DB) ([]Index, error) {
+	ret := []Index{}
+
+	for _, idx := range Indexes {
+		var count int
+		err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name = ?", idx.Name).Scan(&count)
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding index %s", idx.Name)
+		}
+
+		if count == 0 {
+			ret = append(ret, idx)
+		}
+	}
+
+	return ret, nil
+}
+
+// CreateIndexes creates the given indexes
+func CreateIndexes(db *DB, indexes []Index) error {
+	for _, idx := range indexes {
+		if _, err := db.Exec(idx.SQL); err != nil {
+			return errors.Wrapf(err, "creating index %s", idx.Name)
+		}
+	}
+
+	return nil
+}
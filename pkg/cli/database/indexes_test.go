@@ -0,0 +1,64 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestFindMissingIndexes(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	missing, err := FindMissingIndexes(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "finding the indexes"))
+	}
+	assert.Equal(t, len(missing), 0, "missing index count mismatch")
+
+	MustExec(t, "dropping idx_notes_dirty", db, "DROP INDEX idx_notes_dirty")
+	MustExec(t, "dropping idx_books_label", db, "DROP INDEX idx_books_label")
+
+	// execute
+	missing, err = FindMissingIndexes(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "finding the indexes after dropping"))
+	}
+
+	// test
+	names := []string{}
+	for _, idx := range missing {
+		names = append(names, idx.Name)
+	}
+	assert.DeepEqual(t, names, []string{"idx_books_label", "idx_notes_dirty"}, "missing indexes mismatch")
+
+	if err := CreateIndexes(db, missing); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the indexes"))
+	}
+
+	missing, err = FindMissingIndexes(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "finding the indexes after creating"))
+	}
+	assert.Equal(t, len(missing), 0, "missing index count mismatch after creating")
+}
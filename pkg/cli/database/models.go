@@ -19,6 +19,8 @@
 package database
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 )
 
@@ -37,34 +39,51 @@ type Note struct {
 	RowID    int    `json:"rowid"`
 	UUID     string `json:"uuid"`
 	BookUUID string `json:"book_uuid"`
+	Title    string `json:"title"`
 	Body     string `json:"content"`
 	AddedOn  int64  `json:"added_on"`
 	EditedOn int64  `json:"edited_on"`
 	USN      int    `json:"usn"`
 	Public   bool   `json:"public"`
-	Deleted  bool   `json:"deleted"`
-	Dirty    bool   `json:"dirty"`
+	// Visibility is one of NoteVisibilities. Public is true unless it is private.
+	Visibility string `json:"visibility"`
+	Deleted    bool   `json:"deleted"`
+	Dirty      bool   `json:"dirty"`
+	// TrashedOn is the time when the note was moved to the trash, or 0 if it is not in the trash
+	TrashedOn int64 `json:"trashed_on"`
 }
 
 // NewNote constructs a note with the given data
-func NewNote(uuid, bookUUID, body string, addedOn, editedOn int64, usn int, public, deleted, dirty bool) Note {
+func NewNote(uuid, bookUUID, title, body string, addedOn, editedOn int64, usn int, public, deleted, dirty bool) Note {
 	return Note{
-		UUID:     uuid,
-		BookUUID: bookUUID,
-		Body:     body,
-		AddedOn:  addedOn,
-		EditedOn: editedOn,
-		USN:      usn,
-		Public:   public,
-		Deleted:  deleted,
-		Dirty:    dirty,
+		UUID:       uuid,
+		BookUUID:   bookUUID,
+		Title:      title,
+		Body:       body,
+		AddedOn:    addedOn,
+		EditedOn:   editedOn,
+		USN:        usn,
+		Public:     public,
+		Visibility: VisibilityFromPublic(public),
+		Deleted:    deleted,
+		Dirty:      dirty,
 	}
 }
 
+// getVisibility returns the visibility of the note, falling back to the one implied by the
+// public field if the visibility is missing or disagrees with it
+func (n Note) getVisibility() string {
+	if n.Visibility != "" && (n.Visibility != NoteVisibilityPrivate) == n.Public {
+		return n.Visibility
+	}
+
+	return VisibilityFromPublic(n.Public)
+}
+
 // Insert inserts a new note
 func (n Note) Insert(db *DB) error {
-	_, err := db.Exec("INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		n.UUID, n.BookUUID, n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.Deleted, n.Dirty)
+	_, err := db.Exec("INSERT INTO notes (uuid, book_uuid, title, body, added_on, edited_on, usn, public, visibility, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		n.UUID, n.BookUUID, n.Title, n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.getVisibility(), n.Deleted, n.Dirty)
 
 	if err != nil {
 		return errors.Wrapf(err, "inserting note with uuid %s", n.UUID)
@@ -73,10 +92,39 @@ func (n Note) Insert(db *DB) error {
 	return nil
 }
 
+// noteInsertBatchSize is the number of notes inserted by a single statement. It keeps the
+// number of parameters below the limit of the older versions of SQLite.
+const noteInsertBatchSize = 50
+
+// InsertNotes inserts the given notes with multi-row statements
+func InsertNotes(db *DB, notes []Note) error {
+	for start := 0; start < len(notes); start += noteInsertBatchSize {
+		end := start + noteInsertBatchSize
+		if end > len(notes) {
+			end = len(notes)
+		}
+
+		batch := notes[start:end]
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*11)
+		for i, n := range batch {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+			args = append(args, n.UUID, n.BookUUID, n.Title, n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.getVisibility(), n.Deleted, n.Dirty)
+		}
+
+		query := "INSERT INTO notes (uuid, book_uuid, title, body, added_on, edited_on, usn, public, visibility, deleted, dirty) VALUES " + strings.Join(placeholders, ", ")
+		if _, err := db.Exec(query, args...); err != nil {
+			return errors.Wrapf(err, "inserting %d notes", len(batch))
+		}
+	}
+
+	return nil
+}
+
 // Update updates the note with the given data
 func (n Note) Update(db *DB) error {
-	_, err := db.Exec("UPDATE notes SET book_uuid = ?, body = ?, added_on = ?, edited_on = ?, usn = ?, public = ?, deleted = ?, dirty = ? WHERE uuid = ?",
-		n.BookUUID, n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.Deleted, n.Dirty, n.UUID)
+	_, err := db.Exec("UPDATE notes SET book_uuid = ?, title = ?, body = ?, added_on = ?, edited_on = ?, usn = ?, public = ?, visibility = ?, deleted = ?, dirty = ? WHERE uuid = ?",
+		n.BookUUID, n.Title, n.Body, n.AddedOn, n.EditedOn, n.USN, n.Public, n.getVisibility(), n.Deleted, n.Dirty, n.UUID)
 
 	if err != nil {
 		return errors.Wrapf(err, "updating the note with uuid %s", n.UUID)
@@ -93,6 +141,27 @@ func (n *Note) UpdateUUID(db *DB, newUUID string) error {
 		return errors.Wrapf(err, "updating note uuid from '%s' to '%s'", n.UUID, newUUID)
 	}
 
+	// keep the snapshots pointing to the note
+	_, err = db.Exec("UPDATE book_snapshot_notes SET note_uuid = ? WHERE note_uuid = ?", newUUID, n.UUID)
+	if err != nil {
+		return errors.Wrapf(err, "updating note uuid in snapshots from '%s' to '%s'", n.UUID, newUUID)
+	}
+
+	_, err = db.Exec("UPDATE review_state SET note_uuid = ? WHERE note_uuid = ?", newUUID, n.UUID)
+	if err != nil {
+		return errors.Wrapf(err, "updating note uuid in review state from '%s' to '%s'", n.UUID, newUUID)
+	}
+
+	_, err = db.Exec("UPDATE note_versions SET note_uuid = ? WHERE note_uuid = ?", newUUID, n.UUID)
+	if err != nil {
+		return errors.Wrapf(err, "updating note uuid in versions from '%s' to '%s'", n.UUID, newUUID)
+	}
+
+	_, err = db.Exec("UPDATE note_metadata SET note_uuid = ? WHERE note_uuid = ?", newUUID, n.UUID)
+	if err != nil {
+		return errors.Wrapf(err, "updating note uuid in metadata from '%s' to '%s'", n.UUID, newUUID)
+	}
+
 	n.UUID = newUUID
 
 	return nil
@@ -105,6 +174,10 @@ func (n Note) Expunge(db *DB) error {
 		return errors.Wrap(err, "expunging a note locally")
 	}
 
+	if _, err := db.Exec("DELETE FROM note_metadata WHERE note_uuid = ?", n.UUID); err != nil {
+		return errors.Wrap(err, "expunging the metadata of a note locally")
+	}
+
 	return nil
 }
 
@@ -151,6 +224,12 @@ func (b *Book) UpdateUUID(db *DB, newUUID string) error {
 		return errors.Wrapf(err, "updating book uuid from '%s' to '%s'", b.UUID, newUUID)
 	}
 
+	// keep the snapshots pointing to the book
+	_, err = db.Exec("UPDATE book_snapshots SET book_uuid = ? WHERE book_uuid = ?", newUUID, b.UUID)
+	if err != nil {
+		return errors.Wrapf(err, "updating book uuid in snapshots from '%s' to '%s'", b.UUID, newUUID)
+	}
+
 	b.UUID = newUUID
 
 	return nil
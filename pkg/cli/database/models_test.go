@@ -30,6 +30,7 @@ func TestNewNote(t *testing.T) {
 	testCases := []struct {
 		uuid     string
 		bookUUID string
+		title    string
 		body     string
 		addedOn  int64
 		editedOn int64
@@ -41,6 +42,7 @@ func TestNewNote(t *testing.T) {
 		{
 			uuid:     "n1-uuid",
 			bookUUID: "b1-uuid",
+			title:    "n1-title",
 			body:     "n1-body",
 			addedOn:  1542058875,
 			editedOn: 0,
@@ -52,6 +54,7 @@ func TestNewNote(t *testing.T) {
 		{
 			uuid:     "n2-uuid",
 			bookUUID: "b2-uuid",
+			title:    "n2-title",
 			body:     "n2-body",
 			addedOn:  1542058875,
 			editedOn: 1542058876,
@@ -63,10 +66,11 @@ func TestNewNote(t *testing.T) {
 	}
 
 	for idx, tc := range testCases {
-		got := NewNote(tc.uuid, tc.bookUUID, tc.body, tc.addedOn, tc.editedOn, tc.usn, tc.public, tc.deleted, tc.dirty)
+		got := NewNote(tc.uuid, tc.bookUUID, tc.title, tc.body, tc.addedOn, tc.editedOn, tc.usn, tc.public, tc.deleted, tc.dirty)
 
 		assert.Equal(t, got.UUID, tc.uuid, fmt.Sprintf("UUID mismatch for test case %d", idx))
 		assert.Equal(t, got.BookUUID, tc.bookUUID, fmt.Sprintf("BookUUID mismatch for test case %d", idx))
+		assert.Equal(t, got.Title, tc.title, fmt.Sprintf("Title mismatch for test case %d", idx))
 		assert.Equal(t, got.Body, tc.body, fmt.Sprintf("Body mismatch for test case %d", idx))
 		assert.Equal(t, got.AddedOn, tc.addedOn, fmt.Sprintf("AddedOn mismatch for test case %d", idx))
 		assert.Equal(t, got.EditedOn, tc.editedOn, fmt.Sprintf("EditedOn mismatch for test case %d", idx))
@@ -81,6 +85,7 @@ func TestNoteInsert(t *testing.T) {
 	testCases := []struct {
 		uuid     string
 		bookUUID string
+		title    string
 		body     string
 		addedOn  int64
 		editedOn int64
@@ -92,6 +97,7 @@ func TestNoteInsert(t *testing.T) {
 		{
 			uuid:     "n1-uuid",
 			bookUUID: "b1-uuid",
+			title:    "n1-title",
 			body:     "n1-body",
 			addedOn:  1542058875,
 			editedOn: 0,
@@ -103,6 +109,7 @@ func TestNoteInsert(t *testing.T) {
 		{
 			uuid:     "n2-uuid",
 			bookUUID: "b2-uuid",
+			title:    "n2-title",
 			body:     "n2-body",
 			addedOn:  1542058875,
 			editedOn: 1542058876,
@@ -122,6 +129,7 @@ func TestNoteInsert(t *testing.T) {
 			n := Note{
 				UUID:     tc.uuid,
 				BookUUID: tc.bookUUID,
+				Title:    tc.title,
 				Body:     tc.body,
 				AddedOn:  tc.addedOn,
 				EditedOn: tc.editedOn,
@@ -145,16 +153,17 @@ func TestNoteInsert(t *testing.T) {
 			tx.Commit()
 
 			// test
-			var uuid, bookUUID, body string
+			var uuid, bookUUID, title, body string
 			var addedOn, editedOn int64
 			var usn int
 			var public, deleted, dirty bool
 			MustScan(t, "getting n1",
-				db.QueryRow("SELECT uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty FROM notes WHERE uuid = ?", tc.uuid),
-				&uuid, &bookUUID, &body, &addedOn, &editedOn, &usn, &public, &deleted, &dirty)
+				db.QueryRow("SELECT uuid, book_uuid, title, body, added_on, edited_on, usn, public, deleted, dirty FROM notes WHERE uuid = ?", tc.uuid),
+				&uuid, &bookUUID, &title, &body, &addedOn, &editedOn, &usn, &public, &deleted, &dirty)
 
 			assert.Equal(t, uuid, tc.uuid, fmt.Sprintf("uuid mismatch for test case %d", idx))
 			assert.Equal(t, bookUUID, tc.bookUUID, fmt.Sprintf("bookUUID mismatch for test case %d", idx))
+			assert.Equal(t, title, tc.title, fmt.Sprintf("title mismatch for test case %d", idx))
 			assert.Equal(t, body, tc.body, fmt.Sprintf("body mismatch for test case %d", idx))
 			assert.Equal(t, addedOn, tc.addedOn, fmt.Sprintf("addedOn mismatch for test case %d", idx))
 			assert.Equal(t, editedOn, tc.editedOn, fmt.Sprintf("editedOn mismatch for test case %d", idx))
@@ -166,6 +175,53 @@ func TestNoteInsert(t *testing.T) {
 	}
 }
 
+func TestInsertNotes(t *testing.T) {
+	// Setup
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	// more than a batch
+	count := noteInsertBatchSize*2 + 3
+
+	notes := []Note{}
+	for i := 0; i < count; i++ {
+		n := NewNote(fmt.Sprintf("n%d-uuid", i), "b1-uuid", "", fmt.Sprintf("n%d-body", i), int64(i), 0, i, i%2 == 0, false, false)
+		notes = append(notes, n)
+	}
+	notes[1].Visibility = NoteVisibilityUnlisted
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+	if err := InsertNotes(tx, notes); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+	tx.Commit()
+
+	// test
+	var noteCount int
+	MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	assert.Equal(t, noteCount, count, "note count mismatch")
+
+	var body, visibility string
+	var usn int
+	var public bool
+	MustScan(t, "getting the last note",
+		db.QueryRow("SELECT body, usn, public, visibility FROM notes WHERE uuid = ?", fmt.Sprintf("n%d-uuid", count-1)),
+		&body, &usn, &public, &visibility)
+	assert.Equal(t, body, fmt.Sprintf("n%d-body", count-1), "body mismatch")
+	assert.Equal(t, usn, count-1, "usn mismatch")
+	assert.Equal(t, public, true, "public mismatch")
+	assert.Equal(t, visibility, VisibilityFromPublic(true), "visibility mismatch")
+
+	// the visibility that disagrees with public falls back to the one implied by it
+	MustScan(t, "getting n1", db.QueryRow("SELECT visibility FROM notes WHERE uuid = ?", "n1-uuid"), &visibility)
+	assert.Equal(t, visibility, NoteVisibilityPrivate, "visibility mismatch for n1")
+}
+
 func TestNoteUpdate(t *testing.T) {
 	testCases := []struct {
 		uuid        string
@@ -442,6 +498,8 @@ func TestNoteExpunge(t *testing.T) {
 
 	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, added_on, edited_on, body, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", n1.UUID, n1.BookUUID, n1.USN, n1.AddedOn, n1.EditedOn, n1.Body, n1.Public, n1.Deleted, n1.Dirty)
 	MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, added_on, edited_on, body, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", n2.UUID, n2.BookUUID, n2.USN, n2.AddedOn, n2.EditedOn, n2.Body, n2.Public, n2.Deleted, n2.Dirty)
+	MustExec(t, "inserting n1 metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)", n1.UUID, "project", "atlas")
+	MustExec(t, "inserting n2 metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)", n2.UUID, "project", "zephyr")
 
 	// execute
 	tx, err := db.Begin()
@@ -457,10 +515,12 @@ func TestNoteExpunge(t *testing.T) {
 	tx.Commit()
 
 	// test
-	var noteCount int
+	var noteCount, metadataCount int
 	MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	MustScan(t, "counting metadata", db.QueryRow("SELECT count(*) FROM note_metadata"), &metadataCount)
 
 	assert.Equalf(t, noteCount, 1, "note count mismatch")
+	assert.Equalf(t, metadataCount, 1, "metadata count mismatch")
 
 	var n2Record Note
 	MustScan(t, "getting n2",
@@ -20,6 +20,11 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/dnote/dnote/pkg/clock"
 	"github.com/pkg/errors"
@@ -81,25 +86,88 @@ func DeleteSystem(db *DB, key string) error {
 	return nil
 }
 
+const (
+	// ContentTypeMarkdown is the content type of a note written in Markdown
+	ContentTypeMarkdown = "markdown"
+	// ContentTypePlaintext is the content type of a note printed verbatim
+	ContentTypePlaintext = "plaintext"
+	// ContentTypeCode is the content type of a note containing source code
+	ContentTypeCode = "code"
+)
+
+// ContentTypes are the content types a note can have
+var ContentTypes = []string{ContentTypeMarkdown, ContentTypePlaintext, ContentTypeCode}
+
+const (
+	// NoteSortManual lists the notes in the order arranged by `dnote books reorder`,
+	// followed by the rest in the order they were added
+	NoteSortManual = "manual"
+	// NoteSortAdded lists the notes in the order they were added
+	NoteSortAdded = "added"
+	// NoteSortEdited lists the most recently added or edited notes first
+	NoteSortEdited = "edited"
+	// NoteSortAlphabetical lists the notes in the alphabetical order of their contents
+	NoteSortAlphabetical = "alphabetical"
+	// NoteSortLastViewed lists the most recently viewed notes first, followed by the
+	// notes never viewed
+	NoteSortLastViewed = "last-viewed"
+)
+
+// NoteSorts are the orders in which the notes in a book can be listed
+var NoteSorts = []string{NoteSortManual, NoteSortAdded, NoteSortEdited, NoteSortAlphabetical, NoteSortLastViewed}
+
+const (
+	// NoteVisibilityPrivate indicates that only the owner can see a note
+	NoteVisibilityPrivate = "private"
+	// NoteVisibilityUnlisted indicates that anyone with the link can see a note
+	NoteVisibilityUnlisted = "unlisted"
+	// NoteVisibilityPublic indicates that anyone can see a note and that it is listed on
+	// the profile of the owner
+	NoteVisibilityPublic = "public"
+)
+
+// NoteVisibilities are the visibilities a note can have
+var NoteVisibilities = []string{NoteVisibilityPrivate, NoteVisibilityUnlisted, NoteVisibilityPublic}
+
+// VisibilityFromPublic returns the visibility for the given public field of the notes that
+// do not have a visibility, such as the ones from older servers and exports. A shared note
+// is unlisted rather than listed.
+func VisibilityFromPublic(public bool) string {
+	if public {
+		return NoteVisibilityUnlisted
+	}
+
+	return NoteVisibilityPrivate
+}
+
 // NoteInfo is a basic information about a note
 type NoteInfo struct {
-	RowID     int
-	BookLabel string
-	UUID      string
-	Content   string
-	AddedOn   int64
-	EditedOn  int64
+	RowID       int
+	BookLabel   string
+	UUID        string
+	Title       string
+	Content     string
+	AddedOn     int64
+	EditedOn    int64
+	Language    string
+	ContentType string
+	Source      NoteSource
+	// Author is the email of the user who wrote a note in a team book, or empty
+	Author string
+	Pinned bool
 }
 
 // GetNoteInfo returns a NoteInfo for the note with the given noteRowID
 func GetNoteInfo(db *DB, noteRowID int) (NoteInfo, error) {
 	var ret NoteInfo
 
-	err := db.QueryRow(`SELECT books.label, notes.uuid, notes.body, notes.added_on, notes.edited_on, notes.rowid
+	err := db.QueryRow(`SELECT books.label, notes.uuid, notes.title, notes.body, notes.added_on, notes.edited_on, notes.rowid, notes.language, notes.content_type,
+			notes.source_url, notes.source_page, notes.source_fragment, notes.author, notes.pinned_on > 0
 			FROM notes
 			INNER JOIN books ON books.uuid = notes.book_uuid
 			WHERE notes.rowid = ? AND notes.deleted = false`, noteRowID).
-		Scan(&ret.BookLabel, &ret.UUID, &ret.Content, &ret.AddedOn, &ret.EditedOn, &ret.RowID)
+		Scan(&ret.BookLabel, &ret.UUID, &ret.Title, &ret.Content, &ret.AddedOn, &ret.EditedOn, &ret.RowID, &ret.Language, &ret.ContentType,
+			&ret.Source.URL, &ret.Source.Page, &ret.Source.Fragment, &ret.Author, &ret.Pinned)
 	if err == sql.ErrNoRows {
 		return ret, errors.Errorf("note %d not found", noteRowID)
 	} else if err != nil {
@@ -146,6 +214,118 @@ func GetBookUUID(db *DB, label string) (string, error) {
 	return ret, nil
 }
 
+// GetBookLabel returns the label of the book with the given uuid
+func GetBookLabel(db *DB, uuid string) (string, error) {
+	var ret string
+	err := db.QueryRow("SELECT label FROM books WHERE uuid = ?", uuid).Scan(&ret)
+	if err == sql.ErrNoRows {
+		return ret, errors.Errorf("book '%s' not found", uuid)
+	} else if err != nil {
+		return ret, errors.Wrap(err, "querying the book")
+	}
+
+	return ret, nil
+}
+
+// CheckBookOwner returns an error if the book with the given uuid is a team book owned by
+// another user, which only its owner can rename or remove
+func CheckBookOwner(db *DB, uuid string) error {
+	var label, owner string
+	err := db.QueryRow("SELECT label, owner FROM books WHERE uuid = ?", uuid).Scan(&label, &owner)
+	if err == sql.ErrNoRows {
+		return errors.Errorf("book '%s' not found", uuid)
+	} else if err != nil {
+		return errors.Wrap(err, "querying the book")
+	}
+
+	if owner != "" {
+		return errors.Errorf("the book '%s' is owned by %s. Only the owner can rename or remove it", label, owner)
+	}
+
+	return nil
+}
+
+// ResolveBookLabel returns the label of the existing book that has the given label,
+// ignoring case unless caseSensitive is true. An exact match takes precedence. If no
+// such book exists, the given label is returned as it is.
+func ResolveBookLabel(db *DB, label string, caseSensitive bool) (string, error) {
+	if caseSensitive {
+		return label, nil
+	}
+
+	var ret string
+	err := db.QueryRow(`SELECT label FROM books
+		WHERE label = ? COLLATE NOCASE AND deleted = false
+		ORDER BY label = ? DESC, rowid ASC
+		LIMIT 1`, label, label).Scan(&ret)
+	if err == sql.ErrNoRows {
+		return label, nil
+	} else if err != nil {
+		return "", errors.Wrap(err, "querying the book")
+	}
+
+	return ret, nil
+}
+
+// ResolveLabelConflict resolves a book label conflict by repeatedly appending an increasing integer
+// to the label until it finds a unique label. It returns the first non-conflicting label. Unless
+// caseSensitive is true, a label differing only in case from an existing one is not unique.
+func ResolveLabelConflict(db *DB, label string, caseSensitive bool) (string, error) {
+	query := "SELECT count(*) FROM books WHERE label = ?"
+	if !caseSensitive {
+		query += " COLLATE NOCASE"
+	}
+
+	var ret string
+
+	for i := 2; ; i++ {
+		ret = fmt.Sprintf("%s_%d", label, i)
+
+		var cnt int
+		if err := db.QueryRow(query, ret).Scan(&cnt); err != nil {
+			return "", errors.Wrapf(err, "checking availability of label %s", ret)
+		}
+
+		if cnt == 0 {
+			break
+		}
+	}
+
+	return ret, nil
+}
+
+// GetBookLabelCollisions returns the groups of labels of the books whose labels
+// differ only in case
+func GetBookLabelCollisions(db *DB) ([][]string, error) {
+	rows, err := db.Query(`SELECT label FROM books
+		WHERE deleted = false AND lower(label) IN (
+			SELECT lower(label) FROM books WHERE deleted = false GROUP BY lower(label) HAVING count(*) > 1
+		)
+		ORDER BY lower(label), rowid`)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	ret := [][]string{}
+	var key string
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		if len(ret) == 0 || strings.ToLower(label) != key {
+			key = strings.ToLower(label)
+			ret = append(ret, []string{})
+		}
+
+		ret[len(ret)-1] = append(ret[len(ret)-1], label)
+	}
+
+	return ret, nil
+}
+
 // UpdateBookName updates a book name
 func UpdateBookName(db *DB, uuid string, name string) error {
 	_, err := db.Exec(`UPDATE books
@@ -160,30 +340,45 @@ func UpdateBookName(db *DB, uuid string, name string) error {
 
 // GetActiveNote gets the note which has the given rowid and is not deleted
 func GetActiveNote(db *DB, rowid int) (Note, error) {
+	return getNote(db, rowid, false)
+}
+
+// GetNote gets the note which has the given rowid, including a deleted one
+func GetNote(db *DB, rowid int) (Note, error) {
+	return getNote(db, rowid, true)
+}
+
+func getNote(db *DB, rowid int, includeDeleted bool) (Note, error) {
 	var ret Note
 
 	err := db.QueryRow(`SELECT
 		rowid,
 		uuid,
 		book_uuid,
+		title,
 		body,
 		added_on,
 		edited_on,
 		usn,
 		public,
+		visibility,
 		deleted,
-		dirty
-	FROM notes WHERE rowid = ? AND deleted = false;`, rowid).Scan(
+		dirty,
+		trashed_on
+	FROM notes WHERE rowid = ? AND (deleted = false OR ?);`, rowid, includeDeleted).Scan(
 		&ret.RowID,
 		&ret.UUID,
 		&ret.BookUUID,
+		&ret.Title,
 		&ret.Body,
 		&ret.AddedOn,
 		&ret.EditedOn,
 		&ret.USN,
 		&ret.Public,
+		&ret.Visibility,
 		&ret.Deleted,
 		&ret.Dirty,
+		&ret.TrashedOn,
 	)
 
 	if err == sql.ErrNoRows {
@@ -195,13 +390,65 @@ func GetActiveNote(db *DB, rowid int) (Note, error) {
 	return ret, nil
 }
 
-// UpdateNoteContent updates the note content and marks the note as dirty
+// InferTitle returns the title inferred from the note content, which is its first non-empty
+// line without the leading marks of a Markdown heading
+func InferTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if trimmed := strings.TrimLeft(line, "#"); trimmed != line && strings.HasPrefix(trimmed, " ") {
+			line = strings.TrimSpace(trimmed)
+		}
+
+		return line
+	}
+
+	return ""
+}
+
+// NoteTitle returns the title of the note, or the title inferred from its content if the
+// note has no title
+func NoteTitle(title, content string) string {
+	if title != "" {
+		return title
+	}
+
+	return InferTitle(content)
+}
+
+// UpdateNoteContent updates the note content and marks the note as dirty. If the title
+// of the note was inferred from the old content, it is inferred again from the new one.
 func UpdateNoteContent(db *DB, c clock.Clock, rowID int, content string) error {
 	ts := c.Now().UnixNano()
 
+	var title, body string
+	if err := db.QueryRow("SELECT title, body FROM notes WHERE rowid = ?", rowID).Scan(&title, &body); err != nil {
+		return errors.Wrap(err, "getting the note")
+	}
+	if title == InferTitle(body) {
+		title = InferTitle(content)
+	}
+
+	_, err := db.Exec(`UPDATE notes
+			SET title = ?, body = ?, edited_on = ?, dirty = ?
+			WHERE rowid = ?`, title, content, ts, true, rowID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+// UpdateNoteTitle updates the note title and marks the note as dirty
+func UpdateNoteTitle(db *DB, c clock.Clock, rowID int, title string) error {
+	ts := c.Now().UnixNano()
+
 	_, err := db.Exec(`UPDATE notes
-			SET body = ?, edited_on = ?, dirty = ?
-			WHERE rowid = ?`, content, ts, true, rowID)
+			SET title = ?, edited_on = ?, dirty = ?
+			WHERE rowid = ?`, title, ts, true, rowID)
 	if err != nil {
 		return errors.Wrap(err, "updating the note")
 	}
@@ -222,3 +469,364 @@ func UpdateNoteBook(db *DB, c clock.Clock, rowID int, bookUUID string) error {
 
 	return nil
 }
+
+// UpdateNoteVisibility sets the visibility of the note and marks the note as dirty
+func UpdateNoteVisibility(db *DB, c clock.Clock, rowID int, visibility string) error {
+	ts := c.Now().UnixNano()
+
+	_, err := db.Exec(`UPDATE notes
+			SET visibility = ?, public = ?, edited_on = ?, dirty = ?
+			WHERE rowid = ?`, visibility, visibility != NoteVisibilityPrivate, ts, true, rowID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+// ReconcileNoteVisibility makes the visibility of the note agree with its public field after
+// the latter was restored from a version or a snapshot, which do not record the visibility.
+// A listed note stays listed if it is still public.
+func ReconcileNoteVisibility(db *DB, uuid string) error {
+	_, err := db.Exec(`UPDATE notes
+			SET visibility = CASE
+				WHEN NOT public THEN ?
+				WHEN visibility = ? THEN ?
+				ELSE visibility
+			END
+			WHERE uuid = ?`, NoteVisibilityPrivate, NoteVisibilityPrivate, NoteVisibilityUnlisted, uuid)
+	if err != nil {
+		return errors.Wrap(err, "updating the visibility")
+	}
+
+	return nil
+}
+
+// MarkNoteViewed increments the view count of the note and records the time at which
+// it was viewed. The note is not marked dirty because view statistics are local.
+func MarkNoteViewed(db *DB, c clock.Clock, rowID int) error {
+	ts := c.Now().UnixNano()
+
+	_, err := db.Exec(`UPDATE notes
+			SET view_count = view_count + 1, last_viewed_on = ?
+			WHERE rowid = ?`, ts, rowID)
+	if err != nil {
+		return errors.Wrap(err, "updating the view statistics of the note")
+	}
+
+	return nil
+}
+
+// SetNotePinned pins or unpins the note. A pinned note records the time at which it was
+// pinned. Pins are local and are not synced, so the note is not marked dirty.
+func SetNotePinned(db *DB, c clock.Clock, rowID int, pinned bool) error {
+	var ts int64
+	if pinned {
+		ts = c.Now().UnixNano()
+	}
+
+	if _, err := db.Exec("UPDATE notes SET pinned_on = ? WHERE rowid = ?", ts, rowID); err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+// UpdateNoteContentType sets the content type of the note. The content type is a local
+// metadata and is not synced, so the note is not marked as dirty.
+func UpdateNoteContentType(db *DB, rowID int, contentType string) error {
+	if _, err := db.Exec("UPDATE notes SET content_type = ? WHERE rowid = ?", contentType, rowID); err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+// UpdateNoteLanguage sets the language of the note. The language is a local metadata
+// and is not synced, so the note is not marked as dirty.
+func UpdateNoteLanguage(db *DB, rowID int, language string) error {
+	if _, err := db.Exec("UPDATE notes SET language = ? WHERE rowid = ?", language, rowID); err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+// NoteSource is where a clipped note comes from. Page and Fragment anchor the note to
+// a location in the source, and are zero if the note is not anchored.
+type NoteSource struct {
+	URL      string
+	Page     int
+	Fragment string
+}
+
+// Location returns the URL that opens the source at the anchored location. A local path
+// is turned into a file URL, and the page is given as the 'page' parameter of the
+// fragment, which the browsers and most PDF readers understand.
+func (s NoteSource) Location() string {
+	ret := s.URL
+	if !strings.Contains(ret, "://") {
+		p := filepath.ToSlash(ret)
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+
+		ret = (&url.URL{Scheme: "file", Path: p}).String()
+	}
+
+	var anchors []string
+	if s.Page > 0 {
+		anchors = append(anchors, fmt.Sprintf("page=%d", s.Page))
+	}
+	if s.Fragment != "" {
+		anchors = append(anchors, s.Fragment)
+	}
+	if len(anchors) == 0 {
+		return ret
+	}
+
+	// the anchors replace the fragment of the URL, if any
+	if idx := strings.Index(ret, "#"); idx != -1 {
+		ret = ret[:idx]
+	}
+
+	return fmt.Sprintf("%s#%s", ret, strings.Join(anchors, "&"))
+}
+
+// UpdateNoteSource sets the source of the note. Like the language, the source is a
+// local metadata and is not synced, so the note is not marked as dirty.
+func UpdateNoteSource(db *DB, rowID int, source NoteSource) error {
+	if _, err := db.Exec("UPDATE notes SET source_url = ?, source_page = ?, source_fragment = ? WHERE rowid = ?",
+		source.URL, source.Page, source.Fragment, rowID); err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+const (
+	// NoteVersionEdit is the action of a version saved before the note was edited
+	NoteVersionEdit = "edit"
+	// NoteVersionRemove is the action of a version saved before the note was removed
+	NoteVersionRemove = "remove"
+	// NoteVersionRestore is the action of a version saved before the note was restored to another version
+	NoteVersionRestore = "restore"
+)
+
+// NoteVersion is a past state of a note. Title and ContentType are null for the versions
+// saved before they were recorded.
+type NoteVersion struct {
+	NoteUUID    string
+	Version     int
+	BookUUID    string
+	Body        string
+	Public      bool
+	Language    string
+	Title       sql.NullString
+	ContentType sql.NullString
+	Action      string
+	CreatedAt   int64
+}
+
+// SaveNoteVersion saves the current state of the note with the given uuid as a new version,
+// before it is changed by the given action. Versions older than the retention window are
+// pruned afterwards. A retention of 0 keeps all versions.
+func SaveNoteVersion(db *DB, c clock.Clock, noteUUID, action string, retention time.Duration) error {
+	now := c.Now()
+
+	_, err := db.Exec(`INSERT INTO note_versions (note_uuid, version, book_uuid, body, public, language, title, content_type, action, created_at)
+			SELECT uuid, (SELECT coalesce(max(version), 0) + 1 FROM note_versions WHERE note_uuid = ?), book_uuid, body, public, language, title, content_type, ?, ?
+			FROM notes WHERE uuid = ?`, noteUUID, action, now.UnixNano(), noteUUID)
+	if err != nil {
+		return errors.Wrapf(err, "saving a version of the note %s", noteUUID)
+	}
+
+	if err := PruneNoteVersions(db, c, retention); err != nil {
+		return errors.Wrap(err, "pruning note versions")
+	}
+
+	return nil
+}
+
+// PruneNoteVersions deletes the versions of all notes that are older than the retention
+// window. A retention of 0 keeps all versions.
+func PruneNoteVersions(db *DB, c clock.Clock, retention time.Duration) error {
+	if retention <= 0 {
+		return nil
+	}
+
+	cutoff := c.Now().Add(-retention).UnixNano()
+	if _, err := db.Exec("DELETE FROM note_versions WHERE created_at < ?", cutoff); err != nil {
+		return errors.Wrap(err, "deleting old versions")
+	}
+
+	return nil
+}
+
+// GetNoteVersions returns the versions of the note with the given uuid, from the oldest to the newest
+func GetNoteVersions(db *DB, noteUUID string) ([]NoteVersion, error) {
+	rows, err := db.Query(`SELECT note_uuid, version, book_uuid, body, public, language, title, content_type, action, created_at
+			FROM note_versions WHERE note_uuid = ? ORDER BY version ASC`, noteUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying note versions")
+	}
+	defer rows.Close()
+
+	ret := []NoteVersion{}
+	for rows.Next() {
+		var v NoteVersion
+		if err := rows.Scan(&v.NoteUUID, &v.Version, &v.BookUUID, &v.Body, &v.Public, &v.Language, &v.Title, &v.ContentType, &v.Action, &v.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "scanning a note version")
+		}
+
+		ret = append(ret, v)
+	}
+
+	return ret, nil
+}
+
+// GetNoteVersion returns the given version of the note with the given uuid
+func GetNoteVersion(db *DB, noteUUID string, version int) (NoteVersion, error) {
+	var v NoteVersion
+	err := db.QueryRow(`SELECT note_uuid, version, book_uuid, body, public, language, title, content_type, action, created_at
+			FROM note_versions WHERE note_uuid = ? AND version = ?`, noteUUID, version).
+		Scan(&v.NoteUUID, &v.Version, &v.BookUUID, &v.Body, &v.Public, &v.Language, &v.Title, &v.ContentType, &v.Action, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return v, err
+	} else if err != nil {
+		return v, errors.Wrap(err, "finding the note version")
+	}
+
+	return v, nil
+}
+
+// TrashNote moves the note with the given uuid to the trash. The note is removed on the
+// server on the next sync, but its body is kept locally so that it can be restored until
+// the trash is emptied. The notes in the trash older than the retention window are
+// expunged afterwards.
+func TrashNote(db *DB, c clock.Clock, noteUUID string, retention time.Duration) error {
+	if _, err := db.Exec("UPDATE notes SET deleted = ?, dirty = ?, trashed_on = ? WHERE uuid = ?", true, true, c.Now().UnixNano(), noteUUID); err != nil {
+		return errors.Wrapf(err, "moving the note %s to the trash", noteUUID)
+	}
+
+	if err := PruneTrash(db, c, retention); err != nil {
+		return errors.Wrap(err, "pruning the trash")
+	}
+
+	return nil
+}
+
+// RestoreTrashedNote moves the note with the given uuid out of the trash. It is uploaded
+// again on the next sync.
+func RestoreTrashedNote(db *DB, c clock.Clock, noteUUID string) error {
+	if _, err := db.Exec("UPDATE notes SET deleted = ?, dirty = ?, trashed_on = ?, edited_on = ? WHERE uuid = ?", false, true, 0, c.Now().UnixNano(), noteUUID); err != nil {
+		return errors.Wrapf(err, "restoring the note %s", noteUUID)
+	}
+
+	return nil
+}
+
+// ExpungeTrash permanently removes the notes that were moved to the trash before the given
+// time in unix nanoseconds, and returns the number of the notes removed. The notes whose
+// removal has not been synced yet are kept without their bodies until the next sync.
+func ExpungeTrash(db *DB, before int64) (int, error) {
+	res, err := db.Exec("UPDATE notes SET body = ?, trashed_on = ? WHERE trashed_on > 0 AND trashed_on < ? AND dirty = ? AND usn > 0", "", 0, before, true)
+	if err != nil {
+		return 0, errors.Wrap(err, "removing the bodies of the unsynced notes")
+	}
+	pending, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "counting the unsynced notes")
+	}
+
+	res, err = db.Exec("DELETE FROM notes WHERE trashed_on > 0 AND trashed_on < ?", before)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting the notes")
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "counting the deleted notes")
+	}
+
+	return int(pending + deleted), nil
+}
+
+// PruneTrash expunges the notes in the trash that are older than the retention window.
+// A retention of 0 keeps them forever.
+func PruneTrash(db *DB, c clock.Clock, retention time.Duration) error {
+	if retention <= 0 {
+		return nil
+	}
+
+	if _, err := ExpungeTrash(db, c.Now().Add(-retention).UnixNano()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetNoteMetadata returns the key-value metadata of the note
+func GetNoteMetadata(db *DB, noteUUID string) (map[string]string, error) {
+	rows, err := db.Query("SELECT key, value FROM note_metadata WHERE note_uuid = ?", noteUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the metadata")
+	}
+	defer rows.Close()
+
+	ret := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, errors.Wrap(err, "scanning the metadata")
+		}
+
+		ret[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading the metadata")
+	}
+
+	return ret, nil
+}
+
+// SetNoteMetadata sets the value of the key in the metadata of the note
+func SetNoteMetadata(db *DB, noteUUID, key, value string) error {
+	_, err := db.Exec(`INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (note_uuid, key) DO UPDATE SET value = excluded.value`, noteUUID, key, value)
+	if err != nil {
+		return errors.Wrapf(err, "setting the metadata '%s'", key)
+	}
+
+	return nil
+}
+
+// UnsetNoteMetadata removes the key from the metadata of the note. It returns false if
+// the note did not have the key.
+func UnsetNoteMetadata(db *DB, noteUUID, key string) (bool, error) {
+	res, err := db.Exec("DELETE FROM note_metadata WHERE note_uuid = ? AND key = ?", noteUUID, key)
+	if err != nil {
+		return false, errors.Wrapf(err, "removing the metadata '%s'", key)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "counting the removed metadata")
+	}
+
+	return n > 0, nil
+}
+
+// ReplaceNoteMetadata replaces all metadata of the note with the given one
+func ReplaceNoteMetadata(db *DB, noteUUID string, metadata map[string]string) error {
+	if _, err := db.Exec("DELETE FROM note_metadata WHERE note_uuid = ?", noteUUID); err != nil {
+		return errors.Wrap(err, "removing the metadata")
+	}
+
+	for key, value := range metadata {
+		if err := SetNoteMetadata(db, noteUUID, key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
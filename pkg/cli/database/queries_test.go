@@ -290,13 +290,153 @@ func TestGetActiveNote(t *testing.T) {
 	})
 }
 
+func TestGetNote(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	n1UUID := "n1-uuid"
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", n1UUID, "b1-uuid", "", 1542058875, 1542058876, 1, false, true, true)
+
+	var n1RowID int
+	MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", n1UUID), &n1RowID)
+
+	// execute
+	got, err := GetNote(db, n1RowID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, got.UUID, n1UUID, "UUID mismatch")
+	assert.Equal(t, got.Deleted, true, "Deleted mismatch")
+}
+
+func TestSaveNoteVersion(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	c := clock.NewMock()
+	c.SetNow(time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC))
+	retention := 30 * 24 * time.Hour
+
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, language) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 content", 1542058875, true, "en")
+	MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 content", 1542058875)
+
+	// execute
+	if err := SaveNoteVersion(db, c, "n1-uuid", NoteVersionEdit, retention); err != nil {
+		t.Fatal(errors.Wrap(err, "saving the first version"))
+	}
+	MustExec(t, "editing n1", db, "UPDATE notes SET body = ? WHERE uuid = ?", "n1 content edited", "n1-uuid")
+	if err := SaveNoteVersion(db, c, "n1-uuid", NoteVersionRemove, retention); err != nil {
+		t.Fatal(errors.Wrap(err, "saving the second version"))
+	}
+
+	// test
+	versions, err := GetNoteVersions(db, "n1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting versions"))
+	}
+
+	assert.DeepEqual(t, versions, []NoteVersion{
+		{
+			NoteUUID:    "n1-uuid",
+			Version:     1,
+			BookUUID:    "b1-uuid",
+			Body:        "n1 content",
+			Public:      true,
+			Language:    "en",
+			Title:       sql.NullString{String: "", Valid: true},
+			ContentType: sql.NullString{String: "markdown", Valid: true},
+			Action:      NoteVersionEdit,
+			CreatedAt:   c.Now().UnixNano(),
+		},
+		{
+			NoteUUID:    "n1-uuid",
+			Version:     2,
+			BookUUID:    "b1-uuid",
+			Body:        "n1 content edited",
+			Public:      true,
+			Language:    "en",
+			Title:       sql.NullString{String: "", Valid: true},
+			ContentType: sql.NullString{String: "markdown", Valid: true},
+			Action:      NoteVersionRemove,
+			CreatedAt:   c.Now().UnixNano(),
+		},
+	}, "versions mismatch")
+
+	// versions older than the retention window are pruned when a new one is saved
+	c.SetNow(c.Now().Add(31 * 24 * time.Hour))
+	if err := SaveNoteVersion(db, c, "n2-uuid", NoteVersionEdit, retention); err != nil {
+		t.Fatal(errors.Wrap(err, "saving a version after the retention window"))
+	}
+
+	var n1Count, n2Count int
+	MustScan(t, "counting n1 versions", db.QueryRow("SELECT count(*) FROM note_versions WHERE note_uuid = ?", "n1-uuid"), &n1Count)
+	MustScan(t, "counting n2 versions", db.QueryRow("SELECT count(*) FROM note_versions WHERE note_uuid = ?", "n2-uuid"), &n2Count)
+	assert.Equal(t, n1Count, 0, "n1 version count mismatch")
+	assert.Equal(t, n2Count, 1, "n2 version count mismatch")
+}
+
 func TestUpdateNoteContent(t *testing.T) {
+	testCases := []struct {
+		title         string
+		expectedTitle string
+	}{
+		{
+			title:         "n1 content",
+			expectedTitle: "n1 content updated",
+		},
+		{
+			title:         "n1 title",
+			expectedTitle: "n1 title",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			// set up
+			db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+			defer TeardownTestDB(t, db)
+
+			uuid := "n1-uuid"
+			MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, title, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, "b1-uuid", tc.title, "n1 content", 1542058875, 0, 1, false, false, false)
+
+			var rowid int
+			MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowid)
+
+			// execute
+			c := clock.NewMock()
+			now := time.Date(2017, time.March, 14, 21, 15, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			err := UpdateNoteContent(db, c, rowid, "n1 content updated")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			var title, content string
+			var editedOn int
+			var dirty bool
+
+			MustScan(t, "getting the note record", db.QueryRow("SELECT title, body, edited_on, dirty FROM notes WHERE rowid = ?", rowid), &title, &content, &editedOn, &dirty)
+
+			assert.Equal(t, title, tc.expectedTitle, "title mismatch")
+			assert.Equal(t, content, "n1 content updated", "content mismatch")
+			assert.Equal(t, int64(editedOn), now.UnixNano(), "editedOn mismatch")
+			assert.Equal(t, dirty, true, "dirty mismatch")
+		})
+	}
+}
+
+func TestUpdateNoteTitle(t *testing.T) {
 	// set up
 	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
 	defer TeardownTestDB(t, db)
 
 	uuid := "n1-uuid"
-	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, "b1-uuid", "n1 content", 1542058875, 0, 1, false, false, false)
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, title, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, "b1-uuid", "n1 content", "n1 content", 1542058875, 0, 1, false, false, false)
 
 	var rowid int
 	MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowid)
@@ -306,22 +446,42 @@ func TestUpdateNoteContent(t *testing.T) {
 	now := time.Date(2017, time.March, 14, 21, 15, 0, 0, time.UTC)
 	c.SetNow(now)
 
-	err := UpdateNoteContent(db, c, rowid, "n1 content updated")
-	if err != nil {
+	if err := UpdateNoteTitle(db, c, rowid, "n1 title"); err != nil {
 		t.Fatal(errors.Wrap(err, "executing"))
 	}
 
-	var content string
+	var title, content string
 	var editedOn int
 	var dirty bool
 
-	MustScan(t, "getting the note record", db.QueryRow("SELECT body, edited_on, dirty FROM notes WHERE rowid = ?", rowid), &content, &editedOn, &dirty)
+	MustScan(t, "getting the note record", db.QueryRow("SELECT title, body, edited_on, dirty FROM notes WHERE rowid = ?", rowid), &title, &content, &editedOn, &dirty)
 
-	assert.Equal(t, content, "n1 content updated", "content mismatch")
+	assert.Equal(t, title, "n1 title", "title mismatch")
+	assert.Equal(t, content, "n1 content", "content mismatch")
 	assert.Equal(t, int64(editedOn), now.UnixNano(), "editedOn mismatch")
 	assert.Equal(t, dirty, true, "dirty mismatch")
 }
 
+func TestInferTitle(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected string
+	}{
+		{content: "foo", expected: "foo"},
+		{content: "\n  foo bar \nbaz", expected: "foo bar"},
+		{content: "foo\r\nbar", expected: "foo"},
+		{content: "## Heading\n\nbody", expected: "Heading"},
+		{content: "#hashtag", expected: "#hashtag"},
+		{content: "", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%q", tc.content), func(t *testing.T) {
+			assert.Equal(t, InferTitle(tc.content), tc.expected, "title mismatch")
+		})
+	}
+}
+
 func TestUpdateNoteBook(t *testing.T) {
 	// set up
 	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
@@ -359,6 +519,107 @@ func TestUpdateNoteBook(t *testing.T) {
 	assert.Equal(t, dirty, true, "dirty mismatch")
 }
 
+func TestUpdateNoteVisibility(t *testing.T) {
+	testCases := []struct {
+		visibility     string
+		expectedPublic bool
+	}{
+		{
+			visibility:     NoteVisibilityPublic,
+			expectedPublic: true,
+		},
+		{
+			visibility:     NoteVisibilityUnlisted,
+			expectedPublic: true,
+		},
+		{
+			visibility:     NoteVisibilityPrivate,
+			expectedPublic: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.visibility, func(t *testing.T) {
+			// set up
+			db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+			defer TeardownTestDB(t, db)
+
+			uuid := "n1-uuid"
+			MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, visibility, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", uuid, "b1-uuid", "n1 content", 1542058875, true, NoteVisibilityUnlisted, false)
+
+			var rowid int
+			MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowid)
+
+			// execute
+			c := clock.NewMock()
+			now := time.Date(2017, time.March, 14, 21, 15, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			if err := UpdateNoteVisibility(db, c, rowid, tc.visibility); err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			var visibility string
+			var public, dirty bool
+			MustScan(t, "getting the note record", db.QueryRow("SELECT visibility, public, dirty FROM notes WHERE rowid = ?", rowid), &visibility, &public, &dirty)
+
+			assert.Equal(t, visibility, tc.visibility, "visibility mismatch")
+			assert.Equal(t, public, tc.expectedPublic, "public mismatch")
+			assert.Equal(t, dirty, true, "dirty mismatch")
+		})
+	}
+}
+
+func TestReconcileNoteVisibility(t *testing.T) {
+	testCases := []struct {
+		public     bool
+		visibility string
+		expected   string
+	}{
+		{
+			public:     true,
+			visibility: NoteVisibilityPrivate,
+			expected:   NoteVisibilityUnlisted,
+		},
+		{
+			public:     true,
+			visibility: NoteVisibilityPublic,
+			expected:   NoteVisibilityPublic,
+		},
+		{
+			public:     false,
+			visibility: NoteVisibilityPublic,
+			expected:   NoteVisibilityPrivate,
+		},
+		{
+			public:     false,
+			visibility: NoteVisibilityPrivate,
+			expected:   NoteVisibilityPrivate,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("public %t visibility %s", tc.public, tc.visibility), func(t *testing.T) {
+			// set up
+			db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+			defer TeardownTestDB(t, db)
+
+			MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public, visibility) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 content", 1542058875, tc.public, tc.visibility)
+
+			// execute
+			if err := ReconcileNoteVisibility(db, "n1-uuid"); err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			var visibility string
+			MustScan(t, "getting the note record", db.QueryRow("SELECT visibility FROM notes WHERE uuid = ?", "n1-uuid"), &visibility)
+			assert.Equal(t, visibility, tc.expected, "visibility mismatch")
+		})
+	}
+}
+
 func TestUpdateBookName(t *testing.T) {
 	// set up
 	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
@@ -382,3 +643,409 @@ func TestUpdateBookName(t *testing.T) {
 	assert.Equal(t, b1.USN, 8, "USN mismatch")
 	assert.Equal(t, b1.Deleted, false, "Deleted mismatch")
 }
+
+func TestMarkNoteViewed(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	b1UUID := "b1-uuid"
+	MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", b1UUID, "b1-label", 8, false, false)
+
+	uuid := "n1-uuid"
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty, view_count) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, b1UUID, "n1 content", 1542058875, 0, 1, false, false, false, 2)
+
+	var rowid int
+	MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowid)
+
+	// execute
+	c := clock.NewMock()
+	now := time.Date(2017, time.March, 14, 21, 15, 0, 0, time.UTC)
+	c.SetNow(now)
+
+	err := MarkNoteViewed(db, c, rowid)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var viewCount int
+	var lastViewedOn int64
+	var dirty bool
+	MustScan(t, "getting the note record", db.QueryRow("SELECT view_count, last_viewed_on, dirty FROM notes WHERE rowid = ?", rowid), &viewCount, &lastViewedOn, &dirty)
+
+	assert.Equal(t, viewCount, 3, "viewCount mismatch")
+	assert.Equal(t, lastViewedOn, now.UnixNano(), "lastViewedOn mismatch")
+	assert.Equal(t, dirty, false, "dirty mismatch")
+}
+
+func TestSetNotePinned(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	uuid := "n1-uuid"
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, dirty) VALUES (?, ?, ?, ?, ?)", uuid, "b1-uuid", "n1 content", 1542058875, false)
+
+	var rowid int
+	MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowid)
+
+	c := clock.NewMock()
+	now := time.Date(2017, time.March, 14, 21, 15, 0, 0, time.UTC)
+	c.SetNow(now)
+
+	t.Run("pin", func(t *testing.T) {
+		if err := SetNotePinned(db, c, rowid, true); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		var pinnedOn int64
+		var dirty bool
+		MustScan(t, "getting the note record", db.QueryRow("SELECT pinned_on, dirty FROM notes WHERE rowid = ?", rowid), &pinnedOn, &dirty)
+		assert.Equal(t, pinnedOn, now.UnixNano(), "pinnedOn mismatch")
+		assert.Equal(t, dirty, false, "dirty mismatch")
+	})
+
+	t.Run("unpin", func(t *testing.T) {
+		if err := SetNotePinned(db, c, rowid, false); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		var pinnedOn int64
+		MustScan(t, "getting the note record", db.QueryRow("SELECT pinned_on FROM notes WHERE rowid = ?", rowid), &pinnedOn)
+		assert.Equal(t, pinnedOn, int64(0), "pinnedOn mismatch")
+	})
+}
+
+func TestResolveBookLabel(t *testing.T) {
+	testCases := []struct {
+		label         string
+		caseSensitive bool
+		expected      string
+	}{
+		{
+			label:         "js",
+			caseSensitive: false,
+			expected:      "js",
+		},
+		{
+			label:         "CSS",
+			caseSensitive: false,
+			expected:      "css",
+		},
+		{
+			label:         "Go",
+			caseSensitive: false,
+			expected:      "Go",
+		},
+		{
+			label:         "GO",
+			caseSensitive: false,
+			expected:      "go",
+		},
+		{
+			label:         "CSS",
+			caseSensitive: true,
+			expected:      "CSS",
+		},
+		{
+			label:         "linux",
+			caseSensitive: false,
+			expected:      "linux",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("label %s case sensitive %t", tc.label, tc.caseSensitive), func(t *testing.T) {
+			// set up
+			db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+			defer TeardownTestDB(t, db)
+
+			MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+			MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+			MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b3-uuid", "go")
+			MustExec(t, "inserting b4", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b4-uuid", "Go")
+
+			// execute
+			got, err := ResolveBookLabel(db, tc.label, tc.caseSensitive)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			assert.Equal(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestGetBookLabelCollisions(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css")
+	MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b3-uuid", "JS")
+	MustExec(t, "inserting b4", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b4-uuid", "Go")
+	MustExec(t, "inserting b5", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b5-uuid", "go")
+	MustExec(t, "inserting b6", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b6-uuid", "Js")
+	MustExec(t, "inserting b7", db, "INSERT INTO books (uuid, label, deleted) VALUES (?, ?, ?)", "b7-uuid", "CSS", true)
+
+	// execute
+	got, err := GetBookLabelCollisions(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	expected := [][]string{
+		{"Go", "go"},
+		{"js", "JS", "Js"},
+	}
+	assert.DeepEqual(t, got, expected, "result mismatch")
+}
+
+func TestResolveLabelConflict(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "js",
+			expected: "js_2",
+		},
+		{
+			input:    "css",
+			expected: "css_3",
+		},
+		{
+			input:    "linux",
+			expected: "linux_4",
+		},
+		{
+			input:    "cool_ideas",
+			expected: "cool_ideas_2",
+		},
+	}
+
+	for idx, tc := range testCases {
+		func() {
+			// set up
+			db := InitTestDB(t, "../tmp/.dnote", nil)
+			defer TeardownTestDB(t, db)
+
+			MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+			MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "css_2")
+			MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b3-uuid", "linux_(1)")
+			MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b4-uuid", "linux_2")
+			MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b5-uuid", "linux_3")
+			MustExec(t, fmt.Sprintf("inserting book for test case %d", idx), db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b6-uuid", "cool_ideas")
+
+			// execute
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
+			}
+
+			got, err := ResolveLabelConflict(tx, tc.input, true)
+			if err != nil {
+				t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
+			}
+			tx.Rollback()
+
+			assert.Equal(t, got, tc.expected, fmt.Sprintf("output mismatch for test case %d", idx))
+		}()
+	}
+}
+
+func TestResolveLabelConflict_caseInsensitive(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/.dnote", nil)
+	defer TeardownTestDB(t, db)
+
+	MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b2-uuid", "js_2")
+
+	// execute
+	got, err := ResolveLabelConflict(db, "JS", false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, got, "JS_3", "output mismatch")
+}
+
+func TestTrashNote(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	c := clock.NewMock()
+	c.SetNow(time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC))
+	retention := 30 * 24 * time.Hour
+
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 content", 1542058875, 1, false)
+	MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 content", 1542058875, 2, false)
+
+	// execute
+	if err := TrashNote(db, c, "n1-uuid", retention); err != nil {
+		t.Fatal(errors.Wrap(err, "trashing n1"))
+	}
+
+	// test
+	var body string
+	var deleted, dirty bool
+	var trashedOn int64
+	MustScan(t, "getting n1", db.QueryRow("SELECT body, deleted, dirty, trashed_on FROM notes WHERE uuid = ?", "n1-uuid"), &body, &deleted, &dirty, &trashedOn)
+	assert.Equal(t, body, "n1 content", "body should be kept")
+	assert.Equal(t, deleted, true, "deleted mismatch")
+	assert.Equal(t, dirty, true, "dirty mismatch")
+	assert.Equal(t, trashedOn, c.Now().UnixNano(), "trashed_on mismatch")
+
+	// notes older than the retention window are expunged when another note is trashed
+	MustExec(t, "marking n1 synced", db, "UPDATE notes SET dirty = ? WHERE uuid = ?", false, "n1-uuid")
+	c.SetNow(c.Now().Add(31 * 24 * time.Hour))
+	if err := TrashNote(db, c, "n2-uuid", retention); err != nil {
+		t.Fatal(errors.Wrap(err, "trashing n2"))
+	}
+
+	var n1Count, n2Count int
+	MustScan(t, "counting n1", db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", "n1-uuid"), &n1Count)
+	MustScan(t, "counting n2", db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", "n2-uuid"), &n2Count)
+	assert.Equal(t, n1Count, 0, "n1 count mismatch")
+	assert.Equal(t, n2Count, 1, "n2 count mismatch")
+}
+
+func TestRestoreTrashedNote(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	c := clock.NewMock()
+	c.SetNow(time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 content", 1542058875, 1, true, false, 1542058876)
+
+	// execute
+	if err := RestoreTrashedNote(db, c, "n1-uuid"); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var deleted, dirty bool
+	var trashedOn, editedOn int64
+	MustScan(t, "getting n1", db.QueryRow("SELECT deleted, dirty, trashed_on, edited_on FROM notes WHERE uuid = ?", "n1-uuid"), &deleted, &dirty, &trashedOn, &editedOn)
+	assert.Equal(t, deleted, false, "deleted mismatch")
+	assert.Equal(t, dirty, true, "dirty mismatch")
+	assert.Equal(t, trashedOn, int64(0), "trashed_on mismatch")
+	assert.Equal(t, editedOn, c.Now().UnixNano(), "edited_on mismatch")
+}
+
+func TestExpungeTrash(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	// synced removal
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 content", 1, 1, true, false, 10)
+	// unsynced removal
+	MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 content", 1, 2, true, true, 10)
+	// never uploaded
+	MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 content", 1, 0, true, true, 10)
+	// removed recently
+	MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4 content", 1, 4, true, false, 30)
+	// not in the trash
+	MustExec(t, "inserting n5", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n5-uuid", "b1-uuid", "n5 content", 1, 5)
+
+	// execute
+	count, err := ExpungeTrash(db, 20)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, count, 3, "count mismatch")
+
+	var noteCount int
+	MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	assert.Equal(t, noteCount, 3, "note count mismatch")
+
+	var n2Body string
+	var n2Deleted, n2Dirty bool
+	var n2TrashedOn int64
+	MustScan(t, "getting n2", db.QueryRow("SELECT body, deleted, dirty, trashed_on FROM notes WHERE uuid = ?", "n2-uuid"), &n2Body, &n2Deleted, &n2Dirty, &n2TrashedOn)
+	assert.Equal(t, n2Body, "", "n2 body mismatch")
+	assert.Equal(t, n2Deleted, true, "n2 deleted mismatch")
+	assert.Equal(t, n2Dirty, true, "n2 dirty mismatch")
+	assert.Equal(t, n2TrashedOn, int64(0), "n2 trashed_on mismatch")
+
+	var n4TrashedOn int64
+	MustScan(t, "getting n4", db.QueryRow("SELECT trashed_on FROM notes WHERE uuid = ?", "n4-uuid"), &n4TrashedOn)
+	assert.Equal(t, n4TrashedOn, int64(30), "n4 trashed_on mismatch")
+}
+
+func TestNoteMetadata(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	t.Run("set", func(t *testing.T) {
+		if err := SetNoteMetadata(db, "n1-uuid", "project", "atlas"); err != nil {
+			t.Fatal(errors.Wrap(err, "setting project"))
+		}
+		if err := SetNoteMetadata(db, "n1-uuid", "status", "draft"); err != nil {
+			t.Fatal(errors.Wrap(err, "setting status"))
+		}
+		if err := SetNoteMetadata(db, "n1-uuid", "status", "done"); err != nil {
+			t.Fatal(errors.Wrap(err, "overwriting status"))
+		}
+		if err := SetNoteMetadata(db, "n2-uuid", "project", "zephyr"); err != nil {
+			t.Fatal(errors.Wrap(err, "setting project of n2"))
+		}
+
+		got, err := GetNoteMetadata(db, "n1-uuid")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the metadata"))
+		}
+		assert.DeepEqual(t, got, map[string]string{"project": "atlas", "status": "done"}, "metadata mismatch")
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		ok, err := UnsetNoteMetadata(db, "n1-uuid", "status")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "unsetting status"))
+		}
+		assert.Equal(t, ok, true, "removed mismatch")
+
+		ok, err = UnsetNoteMetadata(db, "n1-uuid", "status")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "unsetting status again"))
+		}
+		assert.Equal(t, ok, false, "removed mismatch for a missing key")
+
+		got, err := GetNoteMetadata(db, "n1-uuid")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the metadata"))
+		}
+		assert.DeepEqual(t, got, map[string]string{"project": "atlas"}, "metadata mismatch")
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		if err := ReplaceNoteMetadata(db, "n1-uuid", map[string]string{"owner": "sung"}); err != nil {
+			t.Fatal(errors.Wrap(err, "replacing"))
+		}
+
+		got, err := GetNoteMetadata(db, "n1-uuid")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the metadata"))
+		}
+		assert.DeepEqual(t, got, map[string]string{"owner": "sung"}, "metadata mismatch")
+
+		n2, err := GetNoteMetadata(db, "n2-uuid")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting the metadata of n2"))
+		}
+		assert.DeepEqual(t, n2, map[string]string{"project": "zephyr"}, "n2 metadata mismatch")
+	})
+}
@@ -20,6 +20,7 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 
 	"github.com/pkg/errors"
 	// use sqlite
@@ -118,9 +119,54 @@ func (d *DB) Close() error {
 	return errors.New("can't close db")
 }
 
-// Open initializes a new connection to the sqlite database
+// busyTimeout is the number of milliseconds for which a statement waits for another
+// connection to release its lock on the database before failing
+const busyTimeout = 5000
+
+const (
+	// JournalModeWAL is the journal mode of the connections. The readers are not blocked
+	// by a writer, such as a long sync, and a write does not rewrite the database file.
+	JournalModeWAL = "wal"
+	// SynchronousNormal syncs the write-ahead log at checkpoints only. In WAL mode, a power
+	// loss may roll back the last transactions but does not corrupt the database.
+	SynchronousNormal = 1
+)
+
+// Settings are the settings of a connection to the database
+type Settings struct {
+	JournalMode string
+	Synchronous int
+	ForeignKeys bool
+	BusyTimeout int
+}
+
+// GetSettings reads the settings of a connection to the database
+func GetSettings(db *DB) (Settings, error) {
+	var ret Settings
+
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&ret.JournalMode); err != nil {
+		return ret, errors.Wrap(err, "getting the journal mode")
+	}
+	if err := db.QueryRow("PRAGMA synchronous").Scan(&ret.Synchronous); err != nil {
+		return ret, errors.Wrap(err, "getting the synchronous setting")
+	}
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&ret.ForeignKeys); err != nil {
+		return ret, errors.Wrap(err, "getting the foreign keys setting")
+	}
+	if err := db.QueryRow("PRAGMA busy_timeout").Scan(&ret.BusyTimeout); err != nil {
+		return ret, errors.Wrap(err, "getting the busy timeout")
+	}
+
+	return ret, nil
+}
+
+// Open initializes a new connection to the sqlite database. An existing database is
+// switched to the WAL journal mode, which persists in the file.
 func Open(dbPath string) (*DB, error) {
-	dbConn, err := sql.Open("sqlite3", dbPath)
+	dsn := fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=%s&_synchronous=%d&_foreign_keys=1",
+		dbPath, busyTimeout, JournalModeWAL, SynchronousNormal)
+
+	dbConn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, errors.Wrap(err, "opening db connection")
 	}
@@ -0,0 +1,42 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestOpen(t *testing.T) {
+	db := InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer TeardownTestDB(t, db)
+
+	settings, err := GetSettings(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the settings"))
+	}
+
+	assert.Equal(t, settings.JournalMode, JournalModeWAL, "journal mode mismatch")
+	assert.Equal(t, settings.Synchronous, SynchronousNormal, "synchronous mismatch")
+	assert.Equal(t, settings.ForeignKeys, true, "foreign keys mismatch")
+	assert.Equal(t, settings.BusyTimeout, busyTimeout, "busy timeout mismatch")
+	assert.Equal(t, db.Filepath, "../tmp/dnote-test.db", "filepath mismatch")
+}
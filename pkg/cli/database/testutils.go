@@ -34,7 +34,7 @@ var defaultSchemaSQL = `CREATE TABLE books
 		(
 			uuid text PRIMARY KEY,
 			label text NOT NULL
-		, dirty bool DEFAULT false, usn int DEFAULT 0 NOT NULL, deleted bool DEFAULT false);
+		, dirty bool DEFAULT false, usn int DEFAULT 0 NOT NULL, deleted bool DEFAULT false, tokenizer text DEFAULT 'porter' NOT NULL, note_sort text DEFAULT '' NOT NULL, owner text DEFAULT '' NOT NULL, archived bool DEFAULT false NOT NULL);
 CREATE TABLE system
 		(
 			key string NOT NULL,
@@ -53,7 +53,7 @@ CREATE TABLE IF NOT EXISTS "notes"
 			dirty bool DEFAULT false,
 			usn int DEFAULT 0 NOT NULL,
 			deleted bool DEFAULT false
-		);
+		, view_count int DEFAULT 0 NOT NULL, last_viewed_on integer DEFAULT 0, language text DEFAULT '' NOT NULL, evicted bool DEFAULT false NOT NULL, content_type text DEFAULT 'markdown' NOT NULL, position integer DEFAULT 0 NOT NULL, heading text DEFAULT '' NOT NULL, trashed_on integer DEFAULT 0 NOT NULL, source_url text DEFAULT '' NOT NULL, source_page integer DEFAULT 0 NOT NULL, source_fragment text DEFAULT '' NOT NULL, title text DEFAULT '' NOT NULL, author text DEFAULT '' NOT NULL, visibility text DEFAULT 'private' NOT NULL, pinned_on integer DEFAULT 0 NOT NULL);
 CREATE VIRTUAL TABLE note_fts USING fts5(content=notes, body, tokenize="porter unicode61 categories 'L* N* Co Ps Pe'")
 /* note_fts(body) */;
 CREATE TABLE IF NOT EXISTS 'note_fts_data'(id INTEGER PRIMARY KEY, block BLOB);
@@ -79,7 +79,164 @@ CREATE TABLE actions
 			timestamp integer NOT NULL
 		);
 CREATE UNIQUE INDEX idx_notes_uuid ON notes(uuid);
-CREATE INDEX idx_notes_book_uuid ON notes(book_uuid);`
+CREATE INDEX idx_notes_book_uuid ON notes(book_uuid);
+CREATE INDEX idx_notes_dirty ON notes(dirty);
+CREATE INDEX idx_books_dirty ON books(dirty);
+CREATE INDEX idx_books_label_nocase ON books(label COLLATE NOCASE);
+CREATE TABLE book_snapshots
+		(
+			uuid text PRIMARY KEY,
+			book_uuid text NOT NULL,
+			name text NOT NULL,
+			created_at integer NOT NULL
+		);
+CREATE TABLE book_snapshot_notes
+		(
+			snapshot_uuid text NOT NULL,
+			note_uuid text NOT NULL,
+			body text NOT NULL,
+			added_on integer NOT NULL,
+			edited_on integer DEFAULT 0,
+			public bool DEFAULT false
+		);
+CREATE UNIQUE INDEX idx_book_snapshots_book_uuid_name ON book_snapshots(book_uuid, name);
+CREATE INDEX idx_book_snapshot_notes_snapshot_uuid ON book_snapshot_notes(snapshot_uuid);
+CREATE TABLE review_state
+		(
+			note_uuid text PRIMARY KEY,
+			ease_factor real NOT NULL,
+			interval integer NOT NULL,
+			repetitions integer NOT NULL,
+			due_on integer NOT NULL,
+			last_reviewed_on integer NOT NULL
+		);
+CREATE TABLE review_snoozes
+		(
+			note_uuid text PRIMARY KEY,
+			snoozed_until integer NOT NULL
+		);
+CREATE TABLE note_metadata
+		(
+			note_uuid text NOT NULL,
+			key text NOT NULL,
+			value text NOT NULL,
+			PRIMARY KEY (note_uuid, key)
+		);
+CREATE TABLE note_versions
+		(
+			note_uuid text NOT NULL,
+			version integer NOT NULL,
+			book_uuid text NOT NULL,
+			body text NOT NULL,
+			public bool DEFAULT false,
+			language text DEFAULT '' NOT NULL,
+			action text NOT NULL,
+			created_at integer NOT NULL
+		, title text, content_type text);
+CREATE UNIQUE INDEX idx_note_versions_note_uuid_version ON note_versions(note_uuid, version);
+CREATE TABLE api_tokens
+		(
+			name text PRIMARY KEY,
+			token_hash text NOT NULL,
+			scopes text NOT NULL,
+			created_at integer NOT NULL
+		);
+CREATE UNIQUE INDEX idx_api_tokens_token_hash ON api_tokens(token_hash);
+CREATE TABLE api_audit
+		(
+			integration text NOT NULL,
+			action text NOT NULL,
+			target text DEFAULT '' NOT NULL,
+			created_at integer NOT NULL
+		);
+CREATE VIRTUAL TABLE note_fts_unicode61 USING fts5(body, tokenize="unicode61 categories 'L* N* Co Ps Pe'");
+CREATE TABLE IF NOT EXISTS 'note_fts_unicode61_data'(id INTEGER PRIMARY KEY, block BLOB);
+CREATE TABLE IF NOT EXISTS 'note_fts_unicode61_idx'(segid, term, pgno, PRIMARY KEY(segid, term)) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS 'note_fts_unicode61_content'(id INTEGER PRIMARY KEY, c0);
+CREATE TABLE IF NOT EXISTS 'note_fts_unicode61_docsize'(id INTEGER PRIMARY KEY, sz BLOB);
+CREATE TABLE IF NOT EXISTS 'note_fts_unicode61_config'(k PRIMARY KEY, v) WITHOUT ROWID;
+CREATE TRIGGER notes_after_insert_unicode61 AFTER INSERT ON notes BEGIN
+				INSERT INTO note_fts_unicode61(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = 'unicode61';
+			END;
+CREATE TRIGGER notes_after_delete_unicode61 AFTER DELETE ON notes BEGIN
+				DELETE FROM note_fts_unicode61 WHERE rowid = old.rowid;
+			END;
+CREATE TRIGGER notes_after_update_unicode61 AFTER UPDATE ON notes BEGIN
+				DELETE FROM note_fts_unicode61 WHERE rowid = old.rowid;
+				INSERT INTO note_fts_unicode61(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = 'unicode61';
+			END;
+CREATE TRIGGER books_after_update_unicode61 AFTER UPDATE OF uuid, tokenizer ON books BEGIN
+				DELETE FROM note_fts_unicode61 WHERE rowid IN (SELECT rowid FROM notes WHERE book_uuid IN (old.uuid, new.uuid));
+				INSERT INTO note_fts_unicode61(rowid, body) SELECT rowid, body FROM notes WHERE book_uuid = new.uuid AND new.tokenizer = 'unicode61';
+			END;
+CREATE VIRTUAL TABLE note_fts_trigram USING fts5(body, tokenize="trigram");
+CREATE TABLE IF NOT EXISTS 'note_fts_trigram_data'(id INTEGER PRIMARY KEY, block BLOB);
+CREATE TABLE IF NOT EXISTS 'note_fts_trigram_idx'(segid, term, pgno, PRIMARY KEY(segid, term)) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS 'note_fts_trigram_content'(id INTEGER PRIMARY KEY, c0);
+CREATE TABLE IF NOT EXISTS 'note_fts_trigram_docsize'(id INTEGER PRIMARY KEY, sz BLOB);
+CREATE TABLE IF NOT EXISTS 'note_fts_trigram_config'(k PRIMARY KEY, v) WITHOUT ROWID;
+CREATE TRIGGER notes_after_insert_trigram AFTER INSERT ON notes BEGIN
+				INSERT INTO note_fts_trigram(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = 'trigram';
+			END;
+CREATE TRIGGER notes_after_delete_trigram AFTER DELETE ON notes BEGIN
+				DELETE FROM note_fts_trigram WHERE rowid = old.rowid;
+			END;
+CREATE TRIGGER notes_after_update_trigram AFTER UPDATE ON notes BEGIN
+				DELETE FROM note_fts_trigram WHERE rowid = old.rowid;
+				INSERT INTO note_fts_trigram(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = 'trigram';
+			END;
+CREATE TRIGGER books_after_update_trigram AFTER UPDATE OF uuid, tokenizer ON books BEGIN
+				DELETE FROM note_fts_trigram WHERE rowid IN (SELECT rowid FROM notes WHERE book_uuid IN (old.uuid, new.uuid));
+				INSERT INTO note_fts_trigram(rowid, body) SELECT rowid, body FROM notes WHERE book_uuid = new.uuid AND new.tokenizer = 'trigram';
+			END;
+CREATE TABLE local_changes
+		(
+			uuid text NOT NULL,
+			type text NOT NULL,
+			changed_on integer NOT NULL,
+			PRIMARY KEY (uuid, type)
+		);
+CREATE INDEX idx_local_changes_changed_on ON local_changes(changed_on);
+CREATE TRIGGER notes_after_insert_changed AFTER INSERT ON notes BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = new.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (new.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+CREATE TRIGGER notes_after_update_changed AFTER UPDATE OF uuid, book_uuid, title, body, edited_on, public, visibility, content_type, language, deleted, trashed_on ON notes
+			WHEN old.evicted = new.evicted AND (old.uuid IS NOT new.uuid OR old.book_uuid IS NOT new.book_uuid OR old.title IS NOT new.title OR old.body IS NOT new.body
+				OR old.edited_on IS NOT new.edited_on OR old.public IS NOT new.public OR old.visibility IS NOT new.visibility OR old.content_type IS NOT new.content_type
+				OR old.language IS NOT new.language OR old.deleted IS NOT new.deleted OR old.trashed_on IS NOT new.trashed_on) BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid IN (old.uuid, new.uuid);
+				INSERT INTO local_changes (uuid, type, changed_on) SELECT old.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000 UNION SELECT new.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000;
+			END;
+CREATE TRIGGER notes_after_delete_changed AFTER DELETE ON notes BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = old.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (old.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+CREATE TRIGGER books_after_insert_changed AFTER INSERT ON books BEGIN
+				DELETE FROM local_changes WHERE type = 'book' AND uuid = new.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (new.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+CREATE TRIGGER books_after_update_changed AFTER UPDATE OF uuid, label, deleted ON books
+			WHEN old.uuid IS NOT new.uuid OR old.label IS NOT new.label OR old.deleted IS NOT new.deleted BEGIN
+				DELETE FROM local_changes WHERE type = 'book' AND uuid IN (old.uuid, new.uuid);
+				INSERT INTO local_changes (uuid, type, changed_on) SELECT old.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000 UNION SELECT new.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000;
+			END;
+CREATE TRIGGER books_after_delete_changed AFTER DELETE ON books BEGIN
+				DELETE FROM local_changes WHERE type = 'book' AND uuid = old.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (old.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+CREATE TRIGGER note_metadata_after_insert_changed AFTER INSERT ON note_metadata BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = new.note_uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (new.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+CREATE TRIGGER note_metadata_after_update_changed AFTER UPDATE ON note_metadata BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid IN (old.note_uuid, new.note_uuid);
+				INSERT INTO local_changes (uuid, type, changed_on) SELECT old.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000 UNION SELECT new.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000;
+			END;
+CREATE TRIGGER note_metadata_after_delete_changed AFTER DELETE ON note_metadata BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = old.note_uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (old.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;`
 
 // MustScan scans the given row and fails a test in case of any errors
 func MustScan(t *testing.T, message string, row *sql.Row, args ...interface{}) {
@@ -162,7 +319,7 @@ func OpenTestDB(t *testing.T, dnoteDir string) *DB {
 
 // MarkMigrationComplete marks all migrations as complete in the database
 func MarkMigrationComplete(t *testing.T, db *DB) {
-	if _, err := db.Exec("INSERT INTO system (key, value) VALUES (? , ?);", consts.SystemSchema, 12); err != nil {
+	if _, err := db.Exec("INSERT INTO system (key, value) VALUES (? , ?);", consts.SystemSchema, 36); err != nil {
 		t.Fatal(errors.Wrap(err, "inserting schema"))
 	}
 	if _, err := db.Exec("INSERT INTO system (key, value) VALUES (? , ?);", consts.SystemRemoteSchema, 1); err != nil {
@@ -0,0 +1,208 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package deprecation keeps track of the commands, flags and usages that are
+// kept working for backward compatibility until they are removed, and warns
+// the users when they are used.
+package deprecation
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// KindCommand is the kind of a deprecated command
+	KindCommand = "command"
+	// KindFlag is the kind of a deprecated flag
+	KindFlag = "flag"
+	// KindUsage is the kind of a deprecated way of using a command, such as an argument
+	KindUsage = "usage"
+)
+
+// Deprecation is a command, flag or usage that still works but will be removed
+type Deprecation struct {
+	Kind string
+	// Name is how the deprecated feature is used. e.g. "dnote cat"
+	Name string
+	// Replacement is what to use instead
+	Replacement string
+	// RemoveIn is the version in which the deprecated feature will be removed
+	RemoveIn string
+}
+
+// Message returns the explanation of the deprecation shown to the users
+func (d Deprecation) Message() string {
+	return fmt.Sprintf("use %s instead. It will be removed in %s", d.Replacement, d.RemoveIn)
+}
+
+// registry holds the deprecations keyed by their kind and name
+var registry = map[string]Deprecation{}
+
+// Register records the deprecation so that it shows up in the report
+func Register(d Deprecation) Deprecation {
+	registry[d.Kind+" "+d.Name] = d
+
+	return d
+}
+
+// List returns the registered deprecations sorted by their kinds and names
+func List() []Deprecation {
+	ret := []Deprecation{}
+	for _, d := range registry {
+		ret = append(ret, d)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Kind != ret[j].Kind {
+			return ret[i].Kind < ret[j].Kind
+		}
+
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+// Warn prints a warning that the deprecated feature is used
+func Warn(d Deprecation) {
+	log.Plain(log.ColorYellow.Sprintf("DEPRECATED: %s is deprecated, %s.\n\n", d.Name, d.Message()))
+}
+
+// Usage registers a deprecated way of using a command. The caller is responsible for
+// calling Warn when it is used.
+func Usage(name, replacement, removeIn string) Deprecation {
+	return Register(Deprecation{
+		Kind:        KindUsage,
+		Name:        name,
+		Replacement: replacement,
+		RemoveIn:    removeIn,
+	})
+}
+
+// Command marks the command as deprecated in favor of the replacement
+func Command(cmd *cobra.Command, replacement, removeIn string) {
+	d := Register(Deprecation{
+		Kind:        KindCommand,
+		Name:        "dnote " + cmd.Name(),
+		Replacement: replacement,
+		RemoveIn:    removeIn,
+	})
+
+	cmd.Deprecated = d.Message()
+}
+
+// RenameCommand keeps the old name of a renamed command working as an alias,
+// warning when the command is run under the old name.
+func RenameCommand(cmd *cobra.Command, oldName, removeIn string) {
+	d := Register(Deprecation{
+		Kind:        KindCommand,
+		Name:        "dnote " + oldName,
+		Replacement: fmt.Sprintf(`"dnote %s"`, cmd.Name()),
+		RemoveIn:    removeIn,
+	})
+
+	cmd.Aliases = append(cmd.Aliases, oldName)
+
+	preRunE := cmd.PreRunE
+	cmd.PreRunE = func(c *cobra.Command, args []string) error {
+		if c.CalledAs() == oldName {
+			Warn(d)
+		}
+		if preRunE != nil {
+			return preRunE(c, args)
+		}
+
+		return nil
+	}
+}
+
+// Flag marks the flag of the command as deprecated in favor of the replacement
+func Flag(cmd *cobra.Command, name, replacement, removeIn string) {
+	d := Register(Deprecation{
+		Kind:        KindFlag,
+		Name:        fmt.Sprintf("dnote %s --%s", cmd.Name(), name),
+		Replacement: replacement,
+		RemoveIn:    removeIn,
+	})
+
+	cmd.Flags().MarkDeprecated(name, d.Message())
+}
+
+// RenameFlag keeps the old name of a renamed flag working. The old flag shares the
+// value of the new one, and is hidden from the help.
+func RenameFlag(cmd *cobra.Command, oldName, newName, removeIn string) {
+	f := cmd.Flags()
+
+	flag := f.Lookup(newName)
+	if flag == nil {
+		panic(fmt.Sprintf("flag --%s of %s is not defined", newName, cmd.Name()))
+	}
+
+	f.Var(flag.Value, oldName, flag.Usage)
+	f.Lookup(oldName).NoOptDefVal = flag.NoOptDefVal
+
+	Flag(cmd, oldName, fmt.Sprintf(`"--%s"`, newName), removeIn)
+}
+
+// parseVersion parses a version of the form "1.2.3", with an optional "v" prefix
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+
+	ret := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+
+		ret[i] = n
+	}
+
+	return ret, true
+}
+
+// IsOverdue returns true if the deprecated feature should have been removed by the
+// given version. It returns false if either version cannot be parsed, as in the
+// development builds.
+func (d Deprecation) IsOverdue(version string) bool {
+	current, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+	removeIn, ok := parseVersion(d.RemoveIn)
+	if !ok {
+		return false
+	}
+
+	for i := range current {
+		if current[i] != removeIn[i] {
+			return current[i] > removeIn[i]
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,118 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package deprecation
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/spf13/cobra"
+)
+
+func TestIsOverdue(t *testing.T) {
+	testCases := []struct {
+		removeIn string
+		version  string
+		expected bool
+	}{
+		{removeIn: "1.0.0", version: "0.12.0", expected: false},
+		{removeIn: "1.0.0", version: "1.0.0", expected: true},
+		{removeIn: "1.0.0", version: "v1.0.1", expected: true},
+		{removeIn: "0.13.0", version: "0.12.5", expected: false},
+		{removeIn: "1.0.0", version: "master", expected: false},
+		{removeIn: "next", version: "1.0.0", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s at %s", tc.removeIn, tc.version), func(t *testing.T) {
+			d := Deprecation{RemoveIn: tc.removeIn}
+
+			assert.Equal(t, d.IsOverdue(tc.version), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestRenameCommand(t *testing.T) {
+	var ran bool
+	root := &cobra.Command{Use: "dnote"}
+	cmd := &cobra.Command{
+		Use: "books",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ran = true
+			return nil
+		},
+	}
+	root.AddCommand(cmd)
+
+	RenameCommand(cmd, "notebooks", "1.0.0")
+
+	root.SetArgs([]string{"notebooks"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, ran, true, "command was not run under the old name")
+	assert.DeepEqual(t, registry["command dnote notebooks"], Deprecation{
+		Kind:        KindCommand,
+		Name:        "dnote notebooks",
+		Replacement: `"dnote books"`,
+		RemoveIn:    "1.0.0",
+	}, "deprecation mismatch")
+}
+
+func TestRenameFlag(t *testing.T) {
+	var name string
+	var force bool
+	cmd := &cobra.Command{
+		Use:  "add",
+		RunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+	cmd.Flags().StringVar(&name, "name", "", "")
+	cmd.Flags().BoolVar(&force, "force", false, "")
+
+	RenameFlag(cmd, "title", "name", "1.0.0")
+	RenameFlag(cmd, "yes", "force", "1.0.0")
+
+	cmd.SetArgs([]string{"--title", "foo", "--yes"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, name, "foo", "name mismatch")
+	assert.Equal(t, force, true, "force mismatch")
+	assert.Equal(t, cmd.Flags().Lookup("title").Hidden, true, "old flag is not hidden")
+}
+
+func TestList(t *testing.T) {
+	registry = map[string]Deprecation{}
+
+	Usage("dnote view <book name> <note id>", `"dnote view <note id>"`, "1.0.0")
+	Register(Deprecation{Kind: KindCommand, Name: "dnote ls", Replacement: `"dnote view"`, RemoveIn: "1.0.0"})
+	Register(Deprecation{Kind: KindCommand, Name: "dnote cat", Replacement: `"dnote view"`, RemoveIn: "1.0.0"})
+	// registering again does not duplicate
+	Register(Deprecation{Kind: KindCommand, Name: "dnote cat", Replacement: `"dnote view"`, RemoveIn: "1.0.0"})
+
+	got := List()
+
+	assert.Equal(t, len(got), 3, "length mismatch")
+	assert.Equal(t, got[0].Name, "dnote cat", "got[0] mismatch")
+	assert.Equal(t, got[1].Name, "dnote ls", "got[1] mismatch")
+	assert.Equal(t, got[2].Name, "dnote view <book name> <note id>", "got[2] mismatch")
+}
@@ -6,9 +6,23 @@ import (
 	"path/filepath"
 )
 
+// The environment variable names for the application data directories on Windows
+var (
+	envAppData      = "APPDATA"
+	envLocalAppData = "LOCALAPPDATA"
+)
+
 func initDirs() {
 	Home = getHomeDir()
-	ConfigHome = filepath.Join(Home, ".dnote")
-	DataHome = filepath.Join(Home, ".dnote")
-	CacheHome = filepath.Join(Home, ".dnote")
+	ConfigHome = readPath(envAppData, getAppData(Home))
+	DataHome = readPath(envAppData, getAppData(Home))
+	CacheHome = readPath(envLocalAppData, getLocalAppData(Home))
+}
+
+func getAppData(homeDir string) string {
+	return filepath.Join(homeDir, "AppData", "Roaming")
+}
+
+func getLocalAppData(homeDir string) string {
+	return filepath.Join(homeDir, "AppData", "Local")
 }
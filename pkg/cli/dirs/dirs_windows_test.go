@@ -13,9 +13,9 @@ func TestDirs(t *testing.T) {
 	home := Home
 	assert.NotEqual(t, home, "", "home is empty")
 
-	configHome := filepath.Join(home, ".dnote")
-	dataHome := filepath.Join(home, ".dnote")
-	cacheHome := filepath.Join(home, ".dnote")
+	configHome := readPath("APPDATA", filepath.Join(home, "AppData", "Roaming"))
+	dataHome := readPath("APPDATA", filepath.Join(home, "AppData", "Roaming"))
+	cacheHome := readPath("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
 
 	testCases := []struct {
 		got      string
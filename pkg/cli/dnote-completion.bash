@@ -26,6 +26,12 @@ _complete_view_command() {
     done <<< "$names"
 }
 
+_complete_note_id() {
+    ids=$(dnote view --recent-notes | cut -d: -f1)
+
+    COMPREPLY=($(compgen -W "${ids}" "${current_word}"))
+}
+
 _dnote_completions() {
     local current_word="${COMP_WORDS[${COMP_CWORD}]}"
 
@@ -40,6 +46,8 @@ _dnote_completions() {
 
         if [[ ( "${cmd}" == view ) || ( "${cmd}" == v ) || ( "${cmd}" == add ) || ( "${cmd}" == a ) ]]; then
             _complete_view_command
+        elif [[ ( "${cmd}" == edit ) || ( "${cmd}" == e ) || ( "${cmd}" == remove ) || ( "${cmd}" == rm ) || ( "${cmd}" == cat ) ]]; then
+            _complete_note_id
         fi
     fi
 
@@ -0,0 +1,73 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package frontmatter reads and writes the YAML frontmatter at the top of Markdown documents
+package frontmatter
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Delimiter is the line that opens and closes the frontmatter
+const Delimiter = "---"
+
+// Split separates the frontmatter from the body of a Markdown document.
+// The returned frontmatter is empty if the document does not have one.
+func Split(s string) (string, string) {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+
+	if !strings.HasPrefix(s, Delimiter+"\n") {
+		return "", s
+	}
+
+	rest := s[len(Delimiter)+1:]
+	end := strings.Index(rest, "\n"+Delimiter+"\n")
+	if end == -1 {
+		if strings.HasSuffix(rest, "\n"+Delimiter) {
+			return rest[:len(rest)-len(Delimiter)-1], ""
+		}
+
+		return "", s
+	}
+
+	fm := rest[:end]
+	body := rest[end+len(Delimiter)+2:]
+
+	return fm, strings.TrimPrefix(body, "\n")
+}
+
+// Render returns a Markdown document with the given value marshalled into the frontmatter,
+// followed by a blank line and the body.
+func Render(v interface{}, body string) ([]byte, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling frontmatter")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(Delimiter + "\n")
+	buf.Write(b)
+	buf.WriteString(Delimiter + "\n\n")
+	buf.WriteString(body)
+
+	return buf.Bytes(), nil
+}
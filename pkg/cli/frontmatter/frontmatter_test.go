@@ -0,0 +1,89 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frontmatter
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+)
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		input        string
+		expectedFM   string
+		expectedBody string
+	}{
+		{
+			input:        "---\nbook: js\n---\n\nbody\n",
+			expectedFM:   "book: js",
+			expectedBody: "body\n",
+		},
+		{
+			input:        "---\r\nbook: js\r\n---\r\nbody",
+			expectedFM:   "book: js",
+			expectedBody: "body",
+		},
+		{
+			input:        "---\nbook: js\n---",
+			expectedFM:   "book: js",
+			expectedBody: "",
+		},
+		{
+			input:        "body\n---\nmore",
+			expectedFM:   "",
+			expectedBody: "body\n---\nmore",
+		},
+		{
+			input:        "---\nunclosed",
+			expectedFM:   "",
+			expectedBody: "---\nunclosed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			fm, body := Split(tc.input)
+
+			assert.Equal(t, fm, tc.expectedFM, "frontmatter mismatch")
+			assert.Equal(t, body, tc.expectedBody, "body mismatch")
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	v := struct {
+		Book   string `yaml:"book"`
+		Public bool   `yaml:"public"`
+	}{
+		Book:   "js",
+		Public: true,
+	}
+
+	b, err := Render(v, "body")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, string(b), "---\nbook: js\npublic: true\n---\n\nbody", "result mismatch")
+
+	fm, body := Split(string(b))
+	assert.Equal(t, fm, "book: js\npublic: true", "frontmatter mismatch")
+	assert.Equal(t, body, "body", "body mismatch")
+}
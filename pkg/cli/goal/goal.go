@@ -0,0 +1,140 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package goal computes the progress towards the note writing goals
+package goal
+
+import (
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// Progress is the progress towards the note writing goals
+type Progress struct {
+	Goal context.Goal
+	// Today is the number of notes written today
+	Today int
+	// ThisWeek is the number of notes written since the beginning of the week, on Monday
+	ThisWeek int
+	// Streak is the number of consecutive days on which the daily goal was met, or on which
+	// at least one note was written if there is no daily goal. Today counts only if the goal
+	// has been met already.
+	Streak int
+}
+
+// StartOfDay returns the beginning of the day of the given time, in its location
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the beginning of the Monday of the week of the given time
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+
+	return StartOfDay(t).AddDate(0, 0, -daysSinceMonday)
+}
+
+// countByDay returns the number of notes written on each day, keyed by the beginning of the day
+func countByDay(db *database.DB, loc *time.Location) (map[time.Time]int, error) {
+	rows, err := db.Query("SELECT added_on FROM notes WHERE deleted = ?", false)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := map[time.Time]int{}
+	for rows.Next() {
+		var addedOn int64
+		if err := rows.Scan(&addedOn); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		day := StartOfDay(time.Unix(0, addedOn).In(loc))
+		ret[day]++
+	}
+
+	return ret, nil
+}
+
+// GetProgress returns the progress towards the goal as of the given time
+func GetProgress(db *database.DB, g context.Goal, now time.Time) (Progress, error) {
+	ret := Progress{Goal: g}
+
+	counts, err := countByDay(db, now.Location())
+	if err != nil {
+		return ret, errors.Wrap(err, "counting notes by day")
+	}
+
+	today := StartOfDay(now)
+	ret.Today = counts[today]
+
+	for day := startOfWeek(now); !day.After(today); day = day.AddDate(0, 0, 1) {
+		ret.ThisWeek += counts[day]
+	}
+
+	threshold := g.Daily
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	// today is still in progress, so the streak is not broken until it is over
+	day := today
+	if counts[day] < threshold {
+		day = day.AddDate(0, 0, -1)
+	}
+	for counts[day] >= threshold {
+		ret.Streak++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return ret, nil
+}
+
+// HasGoal returns true if any goal is set
+func (p Progress) HasGoal() bool {
+	return p.Goal.Daily > 0 || p.Goal.Weekly > 0
+}
+
+func formatCount(count, goal int) string {
+	if goal <= 0 {
+		return log.ColorYellow.Sprintf("%d", count)
+	}
+
+	ret := log.ColorYellow.Sprintf("%d/%d", count, goal)
+	if count >= goal {
+		ret += log.ColorGreen.Sprint(" (goal met)")
+	}
+
+	return ret
+}
+
+// Print prints the progress
+func Print(p Progress) {
+	log.Infof("notes today: %s\n", formatCount(p.Today, p.Goal.Daily))
+	log.Infof("notes this week: %s\n", formatCount(p.ThisWeek, p.Goal.Weekly))
+
+	unit := "days"
+	if p.Streak == 1 {
+		unit = "day"
+	}
+	log.Infof("streak: %s\n", log.ColorYellow.Sprintf("%d %s", p.Streak, unit))
+}
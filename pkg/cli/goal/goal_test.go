@@ -0,0 +1,112 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package goal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+)
+
+func TestGetProgress(t *testing.T) {
+	// Wednesday
+	now := time.Date(2020, 3, 4, 15, 0, 0, 0, time.UTC)
+
+	insertNote := func(t *testing.T, db *database.DB, uuid string, addedOn time.Time, deleted bool) {
+		database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", uuid, "b1-uuid", "body", addedOn.UnixNano(), deleted)
+	}
+
+	t.Run("daily goal", func(t *testing.T) {
+		// set up
+		db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+		defer database.TeardownTestDB(t, db)
+
+		// met on Saturday, Monday and Tuesday, but not on Sunday
+		insertNote(t, db, "n1-uuid", now.AddDate(0, 0, -4), false)
+		insertNote(t, db, "n2-uuid", now.AddDate(0, 0, -4), false)
+		insertNote(t, db, "n3-uuid", now.AddDate(0, 0, -3), false)
+		insertNote(t, db, "n4-uuid", now.AddDate(0, 0, -2), false)
+		insertNote(t, db, "n5-uuid", now.AddDate(0, 0, -2), false)
+		insertNote(t, db, "n6-uuid", now.AddDate(0, 0, -1), false)
+		insertNote(t, db, "n7-uuid", now.AddDate(0, 0, -1), false)
+		insertNote(t, db, "n8-uuid", now.AddDate(0, 0, -1), true)
+		insertNote(t, db, "n9-uuid", now.Add(-time.Hour), false)
+
+		// execute
+		got, err := GetProgress(db, context.Goal{Daily: 2, Weekly: 10}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// test
+		assert.Equal(t, got.Today, 1, "Today mismatch")
+		assert.Equal(t, got.ThisWeek, 5, "ThisWeek mismatch")
+		assert.Equal(t, got.Streak, 2, "Streak mismatch")
+		assert.Equal(t, got.HasGoal(), true, "HasGoal mismatch")
+	})
+
+	t.Run("no goal", func(t *testing.T) {
+		// set up
+		db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+		defer database.TeardownTestDB(t, db)
+
+		insertNote(t, db, "n1-uuid", now.AddDate(0, 0, -2), false)
+		insertNote(t, db, "n2-uuid", now.AddDate(0, 0, -1), false)
+		insertNote(t, db, "n3-uuid", now.Add(-time.Hour), false)
+
+		// execute
+		got, err := GetProgress(db, context.Goal{}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// test
+		assert.Equal(t, got.Today, 1, "Today mismatch")
+		assert.Equal(t, got.ThisWeek, 3, "ThisWeek mismatch")
+		assert.Equal(t, got.Streak, 3, "Streak mismatch")
+		assert.Equal(t, got.HasGoal(), false, "HasGoal mismatch")
+	})
+}
+
+func TestStartOfWeek(t *testing.T) {
+	testCases := []struct {
+		t        time.Time
+		expected time.Time
+	}{
+		{
+			t:        time.Date(2020, 3, 4, 15, 0, 0, 0, time.UTC),
+			expected: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			t:        time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			t:        time.Date(2020, 3, 8, 23, 59, 0, 0, time.UTC),
+			expected: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, startOfWeek(tc.t), tc.expected, "result mismatch")
+	}
+}
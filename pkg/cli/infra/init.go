@@ -28,6 +28,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/dnote/color"
+	"github.com/dnote/dnote/pkg/cli/backup"
+	"github.com/dnote/dnote/pkg/cli/client"
 	"github.com/dnote/dnote/pkg/cli/config"
 	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
@@ -39,13 +42,48 @@ import (
 	"github.com/dnote/dnote/pkg/clock"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // RunEFunc is a function type of dnote commands
 type RunEFunc func(*cobra.Command, []string) error
 
-func checkLegacyDBPath() (string, bool) {
-	legacyDnoteDir := getLegacyDnotePath(dirs.Home)
+// DemoEnv is the name of the environment variable which, if set to 1, makes dnote use
+// the sandbox of the demo instead of the data of the user
+const DemoEnv = "DNOTE_DEMO"
+
+// demoDirName is the name of the directory in the dnote data directory containing the sandbox
+const demoDirName = "demo"
+
+// GetDemoDir returns the path to the directory containing the sandbox of the demo
+func GetDemoDir(paths context.Paths) string {
+	return filepath.Join(paths.Data, consts.DnoteDirName, demoDirName)
+}
+
+// GetDemoPaths returns the paths of the sandbox of the demo, which has its own
+// config, data and cache directories
+func GetDemoPaths(paths context.Paths) context.Paths {
+	root := GetDemoDir(paths)
+
+	return context.Paths{
+		Home:   paths.Home,
+		Config: filepath.Join(root, "config"),
+		Data:   filepath.Join(root, "data"),
+		Cache:  filepath.Join(root, "cache"),
+		// never created, so that the sandbox never reads the legacy files of the user
+		LegacyDnote: filepath.Join(root, consts.LegacyDnoteDirName),
+	}
+}
+
+// DBPathEnv is the name of the environment variable overriding the path to the database
+const DBPathEnv = "DNOTE_DB_PATH"
+
+// IsDemo returns true if dnote is running in the sandbox of the demo
+func IsDemo() bool {
+	return os.Getenv(DemoEnv) == "1"
+}
+
+func checkLegacyDBPath(legacyDnoteDir string) (string, bool) {
 	ok, err := utils.FileExists(legacyDnoteDir)
 	if ok {
 		return legacyDnoteDir, true
@@ -58,27 +96,32 @@ func checkLegacyDBPath() (string, bool) {
 	return "", false
 }
 
-func getDBPath(paths context.Paths) string {
-	legacyDnoteDir, ok := checkLegacyDBPath()
+// getDBPath resolves the path to the database. The path given by the user takes
+// precedence over the legacy directory and the data directory.
+func getDBPath(paths context.Paths) (string, error) {
+	if paths.DB != "" {
+		p, err := filepath.Abs(paths.DB)
+		if err != nil {
+			return "", errors.Wrapf(err, "resolving the database path %s", paths.DB)
+		}
+
+		return p, nil
+	}
+
+	legacyDnoteDir, ok := checkLegacyDBPath(paths.LegacyDnote)
 	if ok {
-		return fmt.Sprintf("%s/%s", legacyDnoteDir, consts.DnoteDBFileName)
+		return fmt.Sprintf("%s/%s", legacyDnoteDir, consts.DnoteDBFileName), nil
 	}
 
-	return fmt.Sprintf("%s/%s/%s", paths.Data, consts.DnoteDirName, consts.DnoteDBFileName)
+	return fmt.Sprintf("%s/%s/%s", paths.Data, consts.DnoteDirName, consts.DnoteDBFileName), nil
 }
 
-func newCtx(versionTag string) (context.DnoteCtx, error) {
-	dnoteDir := getLegacyDnotePath(dirs.Home)
-	paths := context.Paths{
-		Home:        dirs.Home,
-		Config:      dirs.ConfigHome,
-		Data:        dirs.DataHome,
-		Cache:       dirs.CacheHome,
-		LegacyDnote: dnoteDir,
+func newCtx(paths context.Paths, versionTag string) (context.DnoteCtx, error) {
+	dbPath, err := getDBPath(paths)
+	if err != nil {
+		return context.DnoteCtx{}, err
 	}
 
-	dbPath := getDBPath(paths)
-
 	db, err := database.Open(dbPath)
 	if err != nil {
 		return context.DnoteCtx{}, errors.Wrap(err, "conntecting to db")
@@ -86,16 +129,69 @@ func newCtx(versionTag string) (context.DnoteCtx, error) {
 
 	ctx := context.DnoteCtx{
 		Paths:   paths,
+		DBPath:  dbPath,
 		Version: versionTag,
 		DB:      db,
+		Clock:   clock.New(),
 	}
 
 	return ctx, nil
 }
 
-// Init initializes the Dnote environment and returns a new dnote context
-func Init(apiEndpoint, versionTag string) (*context.DnoteCtx, error) {
-	ctx, err := newCtx(versionTag)
+// GetPaths returns the paths of the directories used by dnote, or those of the
+// sandbox when running in the demo. The database is at the given path if it is not
+// empty, or at the path in the DNOTE_DB_PATH environment variable if it is set. The
+// sandbox always uses its own database.
+func GetPaths(dbPath string) context.Paths {
+	if dbPath == "" {
+		dbPath = os.Getenv(DBPathEnv)
+	}
+
+	paths := context.Paths{
+		Home:        dirs.Home,
+		Config:      dirs.ConfigHome,
+		Data:        dirs.DataHome,
+		Cache:       dirs.CacheHome,
+		LegacyDnote: getLegacyDnotePath(dirs.Home),
+		DB:          dbPath,
+	}
+
+	if IsDemo() {
+		return GetDemoPaths(paths)
+	}
+
+	return paths
+}
+
+// Init initializes the Dnote environment and returns a new dnote context. The database
+// is at the given path if it is not empty. The local migrations are left for the caller
+// to run if runMigrations is false.
+func Init(apiEndpoint, versionTag, dbPath string, runMigrations bool) (*context.DnoteCtx, error) {
+	return initPaths(GetPaths(dbPath), apiEndpoint, versionTag, runMigrations)
+}
+
+// InitPaths initializes the Dnote environment in the given directories and returns
+// a new dnote context
+func InitPaths(paths context.Paths, apiEndpoint, versionTag string) (*context.DnoteCtx, error) {
+	return initPaths(paths, apiEndpoint, versionTag, true)
+}
+
+func initPaths(paths context.Paths, apiEndpoint, versionTag string, runMigrations bool) (*context.DnoteCtx, error) {
+	l, err := lockInit(paths, runMigrations)
+	if err != nil {
+		return nil, errors.Wrap(err, "locking the database")
+	}
+	defer l.release()
+
+	// a failed move leaves the legacy directory as it was, and it keeps being used. The
+	// legacy directory is left alone if the database is elsewhere, as it may be the one given.
+	if paths.DB == "" {
+		if _, err := migrateLegacyDir(paths); err != nil {
+			log.Warnf("could not move %s to the XDG base directories: %s\n", paths.LegacyDnote, err.Error())
+		}
+	}
+
+	ctx, err := newCtx(paths, versionTag)
 	if err != nil {
 		return nil, errors.Wrap(err, "initializing a context")
 	}
@@ -114,8 +210,22 @@ func Init(apiEndpoint, versionTag string) (*context.DnoteCtx, error) {
 	if err := migrate.Legacy(ctx); err != nil {
 		return nil, errors.Wrap(err, "running legacy migration")
 	}
-	if err := migrate.Run(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
-		return nil, errors.Wrap(err, "running migration")
+	if runMigrations {
+		if err := migrate.CheckSchema(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+			return nil, errors.Wrap(err, "checking the schema")
+		}
+		if err := migrate.CheckSchema(ctx, migrate.RemoteSequence, migrate.RemoteMode); err != nil {
+			return nil, errors.Wrap(err, "checking the remote schema")
+		}
+
+		if err := BackupBeforeMigration(ctx); err != nil {
+			return nil, errors.Wrap(err, "backing up the database before the migration")
+		}
+		if err := migrate.Run(ctx, migrate.LocalSequence, migrate.LocalMode); err != nil {
+			return nil, errors.Wrap(err, "running migration")
+		}
+
+		checkSearchIndex(ctx)
 	}
 
 	ctx, err = SetupCtx(ctx)
@@ -128,11 +238,54 @@ func Init(apiEndpoint, versionTag string) (*context.DnoteCtx, error) {
 	return &ctx, nil
 }
 
+// BackupBeforeMigration takes a local backup of the database if it is about to be
+// migrated, so that a migration gone wrong can be rolled back with dnote backup restore
+func BackupBeforeMigration(ctx context.DnoteCtx) error {
+	pending, err := migrate.Pending(ctx, migrate.LocalSequence, migrate.LocalMode)
+	if err != nil {
+		return errors.Wrap(err, "checking the migrations")
+	}
+	if !pending {
+		return nil
+	}
+
+	cf, err := config.Read(ctx)
+	if err != nil {
+		return errors.Wrap(err, "reading config")
+	}
+	ctx.BackupKeep = getBackupKeep(cf)
+
+	if _, err := backup.Auto(ctx, backup.ReasonMigration); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkSearchIndex suggests rebuilding the search index if it looks out of date. It
+// stays quiet if the output is not a terminal, so as not to break the scripts and the
+// shell completions reading it.
+func checkSearchIndex(ctx context.DnoteCtx) {
+	if !terminal.IsTerminal(int(os.Stdout.Fd())) {
+		return
+	}
+
+	stale, err := database.IsFTSStale(ctx.DB)
+	if err != nil {
+		log.Debug("checking the search index: %s\n", err.Error())
+		return
+	}
+
+	if stale {
+		log.Warnf("the search index is out of date. Run `dnote index rebuild` to rebuild it.\n")
+	}
+}
+
 // SetupCtx populates the context and returns a new context
 func SetupCtx(ctx context.DnoteCtx) (context.DnoteCtx, error) {
 	db := ctx.DB
 
-	var sessionKey string
+	var sessionKey, refreshToken string
 	var sessionKeyExpiry int64
 
 	err := db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSessionKey).Scan(&sessionKey)
@@ -143,26 +296,165 @@ func SetupCtx(ctx context.DnoteCtx) (context.DnoteCtx, error) {
 	if err != nil && err != sql.ErrNoRows {
 		return ctx, errors.Wrap(err, "finding sesison key expiry")
 	}
+	err = db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemRefreshToken).Scan(&refreshToken)
+	if err != nil && err != sql.ErrNoRows {
+		return ctx, errors.Wrap(err, "finding refresh token")
+	}
 
 	cf, err := config.Read(ctx)
 	if err != nil {
 		return ctx, errors.Wrap(err, "reading config")
 	}
+	if cf.Color != nil && !*cf.Color {
+		color.NoColor = true
+	}
+
+	throttle, err := getThrottle(cf)
+	if err != nil {
+		return ctx, err
+	}
 
 	ret := context.DnoteCtx{
-		Paths:            ctx.Paths,
-		Version:          ctx.Version,
-		DB:               ctx.DB,
-		SessionKey:       sessionKey,
-		SessionKeyExpiry: sessionKeyExpiry,
-		APIEndpoint:      cf.APIEndpoint,
-		Editor:           cf.Editor,
-		Clock:            clock.New(),
+		Paths:                ctx.Paths,
+		DBPath:               ctx.DBPath,
+		Version:              ctx.Version,
+		DB:                   ctx.DB,
+		SessionKey:           sessionKey,
+		SessionKeyExpiry:     sessionKeyExpiry,
+		RefreshToken:         refreshToken,
+		APIEndpoint:          cf.APIEndpoint,
+		Editor:               cf.Editor,
+		EditorOptions:        getEditorOptions(cf),
+		Clock:                clock.New(),
+		SearchWeights:        getSearchWeights(cf),
+		CaseSensitiveBooks:   cf.CaseSensitiveBooks,
+		HistoryRetention:     getHistoryRetention(cf),
+		TrashRetention:       getTrashRetention(cf),
+		PendingWarnThreshold: getPendingWarnThreshold(cf),
+		BackupKeep:           getBackupKeep(cf),
+		Goal: context.Goal{
+			Daily:  cf.Goal.Daily,
+			Weekly: cf.Goal.Weekly,
+		},
+		Thin: getThin(cf),
+		Metadata: context.Metadata{
+			Encryption: cf.Metadata.Encryption,
+			Recipients: cf.Metadata.Recipients,
+			Identities: cf.Metadata.Identities,
+		},
+		SyncPageSize:  cf.Sync.PageSize,
+		Throttle:      throttle,
+		SyncWebhook:   cf.Sync.Webhook,
+		SyncGitMirror: cf.Sync.GitMirror,
 	}
 
 	return ret, nil
 }
 
+// getSearchWeights returns the search ranking weights from the config, falling back to
+// the defaults for the weights that are not configured
+func getSearchWeights(cf config.Config) context.SearchWeights {
+	ret := context.SearchWeights{
+		Recency:   config.DefaultSearchRecencyWeight,
+		Frequency: config.DefaultSearchFrequencyWeight,
+	}
+
+	if cf.Search.RecencyWeight != nil {
+		ret.Recency = *cf.Search.RecencyWeight
+	}
+	if cf.Search.FrequencyWeight != nil {
+		ret.Frequency = *cf.Search.FrequencyWeight
+	}
+
+	return ret
+}
+
+// getHistoryRetention returns how long the past versions of notes are kept
+func getHistoryRetention(cf config.Config) time.Duration {
+	days := config.DefaultHistoryRetentionDays
+	if cf.History.RetentionDays != nil {
+		days = *cf.History.RetentionDays
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// getBackupKeep returns the number of the automatic local backups kept
+func getBackupKeep(cf config.Config) int {
+	if cf.Backup.Keep != nil {
+		return *cf.Backup.Keep
+	}
+
+	return config.DefaultBackupKeep
+}
+
+// getTrashRetention returns how long the removed notes are kept in the trash
+func getTrashRetention(cf config.Config) time.Duration {
+	days := config.DefaultTrashRetentionDays
+	if cf.Trash.RetentionDays != nil {
+		days = *cf.Trash.RetentionDays
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// getThrottle returns the limits on the requests to the server from the config
+func getThrottle(cf config.Config) (context.Throttle, error) {
+	ret := context.Throttle{MaxRPS: cf.Sync.MaxRPS}
+
+	if cf.Sync.MaxBandwidth != "" {
+		n, err := client.ParseBandwidth(cf.Sync.MaxBandwidth)
+		if err != nil {
+			return ret, errors.Wrap(err, "invalid sync.maxBandwidth in the configuration file")
+		}
+
+		ret.MaxBandwidth = n
+	}
+
+	return ret, nil
+}
+
+// getPendingWarnThreshold returns the number of the changes pending sync above which a warning is shown
+func getPendingWarnThreshold(cf config.Config) int {
+	if cf.Offline.WarnThreshold != nil {
+		return *cf.Offline.WarnThreshold
+	}
+
+	return config.DefaultPendingWarnThreshold
+}
+
+// getEditorOptions returns the settings for the editor from the config. The frontmatter
+// is enabled unless it is turned off.
+func getEditorOptions(cf config.Config) context.EditorOptions {
+	ret := context.EditorOptions{
+		Args:        cf.EditorOptions.Args,
+		FileSuffix:  cf.EditorOptions.FileSuffix,
+		Frontmatter: true,
+		TmpDir:      cf.EditorOptions.TmpDir,
+	}
+
+	if cf.EditorOptions.Frontmatter != nil {
+		ret.Frontmatter = *cf.EditorOptions.Frontmatter
+	}
+
+	return ret
+}
+
+// getThin returns the settings of the thin mode from the config, falling back to the
+// default cache size if it is not configured
+func getThin(cf config.Config) context.Thin {
+	ret := context.Thin{
+		Enabled:   cf.Thin.Enabled,
+		CacheSize: config.DefaultThinCacheSize,
+	}
+
+	if cf.Thin.CacheSize != nil {
+		ret.CacheSize = *cf.Thin.CacheSize
+	}
+
+	return ret
+}
+
 // getLegacyDnotePath returns a legacy dnote directory path placed under
 // the user's home directory
 func getLegacyDnotePath(homeDir string) string {
@@ -19,9 +19,11 @@
 package infra
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/pkg/errors"
 )
@@ -91,3 +93,35 @@ func TestInitSystemKV_existing(t *testing.T) {
 		db.QueryRow("SELECT value FROM system WHERE key = ?", "testKey"), &val)
 	assert.Equal(t, val, "testVal", "system value should not have been updated")
 }
+
+func TestGetDBPath(t *testing.T) {
+	paths := context.Paths{
+		Data:        "/home/user/.local/share",
+		LegacyDnote: "/nonexistent/.dnote",
+	}
+
+	t.Run("default", func(t *testing.T) {
+		got, err := getDBPath(paths)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.Equal(t, got, "/home/user/.local/share/dnote/dnote.db", "result mismatch")
+	})
+
+	t.Run("override", func(t *testing.T) {
+		p := paths
+		p.DB = "vault/dnote.db"
+
+		got, err := getDBPath(p)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		expected, err := filepath.Abs("vault/dnote.db")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "resolving the expected path"))
+		}
+		assert.Equal(t, got, expected, "result mismatch")
+	})
+}
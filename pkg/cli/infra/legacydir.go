@@ -0,0 +1,207 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package infra
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/migrate"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// KeepLegacyDirEnv is the name of the environment variable which, if set to 1, keeps
+// dnote using the legacy directory instead of moving it to the XDG base directories
+const KeepLegacyDirEnv = "DNOTE_KEEP_LEGACY_DIR"
+
+// hashFile returns the sha256 digest of the file at the given path
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, errors.Wrap(err, "reading the file")
+	}
+
+	return h.Sum(nil), nil
+}
+
+// copyVerified copies the file, and checks that the copy is identical to the source.
+// The copy is written to a temporary file first, so that an interruption never leaves
+// a partial file at the destination.
+func copyVerified(src, dest string) error {
+	tmpPath := dest + ".tmp"
+	if err := utils.CopyFile(src, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "copying %s", src)
+	}
+
+	srcSum, err := hashFile(src)
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "hashing %s", src)
+	}
+	destSum, err := hashFile(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "hashing the copy of %s", src)
+	}
+	if !bytes.Equal(srcSum, destSum) {
+		os.Remove(tmpPath)
+		return errors.Errorf("the copy of %s does not match the original", src)
+	}
+
+	if err := os.Rename(tmpPath, dest); err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "moving the copy of %s into place", src)
+	}
+
+	return nil
+}
+
+// legacyDirFile is a file in the legacy directory and the path to which it is moved
+type legacyDirFile struct {
+	src  string
+	dest string
+}
+
+// migrateLegacyDir moves the database and the config file in the legacy ~/.dnote directory
+// to the XDG base directories, once. The files are copied and verified first, and the legacy
+// directory is then renamed to ~/.dnote-migrated and kept, so that nothing is lost and the
+// move can be rolled back by renaming it back. It returns true if the files were moved.
+//
+// Nothing is moved if the legacy directory has no database, if its JSON-based notes are yet
+// to be migrated, if its database has a write-ahead log, or if the XDG base directories already
+// have a database.
+func migrateLegacyDir(paths context.Paths) (bool, error) {
+	if os.Getenv(KeepLegacyDirEnv) == "1" {
+		return false, nil
+	}
+
+	legacyDBPath := filepath.Join(paths.LegacyDnote, consts.DnoteDBFileName)
+	ok, err := utils.FileExists(legacyDBPath)
+	if err != nil {
+		return false, errors.Wrap(err, "checking the legacy database")
+	}
+	if !ok {
+		return false, nil
+	}
+
+	pending, err := migrate.LegacyPending(context.DnoteCtx{Paths: paths})
+	if err != nil {
+		return false, errors.Wrap(err, "checking the legacy migration")
+	}
+	if pending {
+		return false, nil
+	}
+
+	// the write-ahead log of a process that did not close the database holds changes that are
+	// not in the database file yet. It is checkpointed when the legacy directory is next used.
+	walPath := legacyDBPath + "-wal"
+	ok, err = utils.FileExists(walPath)
+	if err != nil {
+		return false, errors.Wrap(err, "checking the write-ahead log")
+	}
+	if ok {
+		log.Debug("not moving the legacy directory because %s exists\n", walPath)
+		return false, nil
+	}
+
+	dataDir := filepath.Join(paths.Data, consts.DnoteDirName)
+	configDir := filepath.Join(paths.Config, consts.DnoteDirName)
+
+	files := []legacyDirFile{
+		{src: legacyDBPath, dest: filepath.Join(dataDir, consts.DnoteDBFileName)},
+	}
+
+	legacyConfigPath := filepath.Join(paths.LegacyDnote, consts.ConfigFilename)
+	ok, err = utils.FileExists(legacyConfigPath)
+	if err != nil {
+		return false, errors.Wrap(err, "checking the legacy config file")
+	}
+	if ok {
+		files = append(files, legacyDirFile{src: legacyConfigPath, dest: filepath.Join(configDir, consts.ConfigFilename)})
+	}
+
+	for _, f := range files {
+		ok, err := utils.FileExists(f.dest)
+		if err != nil {
+			return false, errors.Wrapf(err, "checking %s", f.dest)
+		}
+		if ok {
+			log.Debug("not moving the legacy directory because %s exists\n", f.dest)
+			return false, nil
+		}
+	}
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return false, errors.Wrap(err, "creating the data directory")
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return false, errors.Wrap(err, "creating the config directory")
+	}
+
+	// roll back the copies if any step fails, so that the legacy directory stays in use
+	var copied []string
+	rollback := func() {
+		for _, path := range copied {
+			os.Remove(path)
+		}
+	}
+
+	for _, f := range files {
+		if err := copyVerified(f.src, f.dest); err != nil {
+			rollback()
+			return false, err
+		}
+
+		copied = append(copied, f.dest)
+	}
+
+	migratedPath := filepath.Join(filepath.Dir(paths.LegacyDnote), consts.MigratedLegacyDnoteDirName)
+	ok, err = utils.FileExists(migratedPath)
+	if err != nil {
+		rollback()
+		return false, errors.Wrapf(err, "checking %s", migratedPath)
+	}
+	if ok {
+		rollback()
+		return false, errors.Errorf("%s already exists", migratedPath)
+	}
+
+	if err := os.Rename(paths.LegacyDnote, migratedPath); err != nil {
+		rollback()
+		return false, errors.Wrap(err, "renaming the legacy directory")
+	}
+
+	log.Infof("moved the database to %s and the config to %s. The old directory is kept at %s\n", dataDir, configDir, migratedPath)
+
+	return true, nil
+}
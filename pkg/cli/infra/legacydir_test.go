@@ -0,0 +1,156 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package infra
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// setupLegacyDir makes a legacy directory with a database and a config file, and
+// returns the paths using it
+func setupLegacyDir(t *testing.T, root string) context.Paths {
+	paths := context.Paths{
+		Home:        root,
+		Config:      filepath.Join(root, "config"),
+		Data:        filepath.Join(root, "data"),
+		Cache:       filepath.Join(root, "cache"),
+		LegacyDnote: filepath.Join(root, consts.LegacyDnoteDirName),
+	}
+
+	if err := os.MkdirAll(paths.LegacyDnote, 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the legacy directory"))
+	}
+	if err := ioutil.WriteFile(filepath.Join(paths.LegacyDnote, consts.DnoteDBFileName), []byte("db content"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the database"))
+	}
+	if err := ioutil.WriteFile(filepath.Join(paths.LegacyDnote, consts.ConfigFilename), []byte("editor: vim\n"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	return paths
+}
+
+func mustReadFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(errors.Wrapf(err, "reading %s", path))
+	}
+
+	return string(b)
+}
+
+func TestMigrateLegacyDir(t *testing.T) {
+	// set up
+	root := "../tmp/legacydir"
+	defer os.RemoveAll(root)
+
+	paths := setupLegacyDir(t, root)
+
+	// execute
+	moved, err := migrateLegacyDir(paths)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, moved, true, "moved mismatch")
+	assert.Equal(t, mustReadFile(t, filepath.Join(paths.Data, consts.DnoteDirName, consts.DnoteDBFileName)), "db content", "database mismatch")
+	assert.Equal(t, mustReadFile(t, filepath.Join(paths.Config, consts.DnoteDirName, consts.ConfigFilename)), "editor: vim\n", "config mismatch")
+
+	ok, err := utils.FileExists(paths.LegacyDnote)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "checking the legacy directory"))
+	}
+	assert.Equal(t, ok, false, "legacy directory should be gone")
+
+	migratedPath := filepath.Join(root, consts.MigratedLegacyDnoteDirName)
+	assert.Equal(t, mustReadFile(t, filepath.Join(migratedPath, consts.DnoteDBFileName)), "db content", "kept database mismatch")
+
+	// running again does nothing
+	moved, err = migrateLegacyDir(paths)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing again"))
+	}
+	assert.Equal(t, moved, false, "moved mismatch on the second run")
+}
+
+func TestMigrateLegacyDir_existingDB(t *testing.T) {
+	// set up
+	root := "../tmp/legacydir"
+	defer os.RemoveAll(root)
+
+	paths := setupLegacyDir(t, root)
+
+	dataDir := filepath.Join(paths.Data, consts.DnoteDirName)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the data directory"))
+	}
+	if err := ioutil.WriteFile(filepath.Join(dataDir, consts.DnoteDBFileName), []byte("other db"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the database"))
+	}
+
+	// execute
+	moved, err := migrateLegacyDir(paths)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, moved, false, "moved mismatch")
+	assert.Equal(t, mustReadFile(t, filepath.Join(dataDir, consts.DnoteDBFileName)), "other db", "database mismatch")
+	assert.Equal(t, mustReadFile(t, filepath.Join(paths.LegacyDnote, consts.DnoteDBFileName)), "db content", "legacy database mismatch")
+}
+
+func TestMigrateLegacyDir_writeAheadLog(t *testing.T) {
+	// set up
+	root := "../tmp/legacydir"
+	defer os.RemoveAll(root)
+
+	paths := setupLegacyDir(t, root)
+
+	walPath := filepath.Join(paths.LegacyDnote, consts.DnoteDBFileName+"-wal")
+	if err := ioutil.WriteFile(walPath, []byte("wal content"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the write-ahead log"))
+	}
+
+	// execute
+	moved, err := migrateLegacyDir(paths)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, moved, false, "moved mismatch")
+	assert.Equal(t, mustReadFile(t, filepath.Join(paths.LegacyDnote, consts.DnoteDBFileName)), "db content", "legacy database mismatch")
+
+	ok, err := utils.FileExists(filepath.Join(paths.Data, consts.DnoteDirName, consts.DnoteDBFileName))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "checking the database"))
+	}
+	assert.Equal(t, ok, false, "database should not be copied")
+}
@@ -0,0 +1,180 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package infra
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/lock"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/migrate"
+	"github.com/dnote/dnote/pkg/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// initLock is the set of the database locks held while dnote initializes
+type initLock []*lock.Lock
+
+// release releases the locks in the reverse order of their acquisition
+func (l initLock) release() {
+	for i := len(l) - 1; i >= 0; i-- {
+		if err := l[i].Release(); err != nil {
+			log.Debug("releasing the lock: %s\n", err.Error())
+		}
+	}
+}
+
+// mayMoveLegacyDir returns true if the legacy directory may be moved to the XDG base
+// directories during the initialization
+func mayMoveLegacyDir(paths context.Paths) (bool, error) {
+	if paths.DB != "" || os.Getenv(KeepLegacyDirEnv) == "1" {
+		return false, nil
+	}
+
+	ok, err := utils.FileExists(filepath.Join(paths.LegacyDnote, consts.DnoteDBFileName))
+	if err != nil {
+		return false, errors.Wrap(err, "checking the legacy database")
+	}
+
+	return ok, nil
+}
+
+// getInitLockPaths returns the paths to the databases locked while dnote initializes.
+// While the legacy directory may be moved, the database in the data directory is locked
+// before the legacy one, as the processes started after the move use it.
+func getInitLockPaths(paths context.Paths) ([]string, error) {
+	dbPath, err := getDBPath(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	move, err := mayMoveLegacyDir(paths)
+	if err != nil {
+		return nil, err
+	}
+	if !move {
+		return []string{dbPath}, nil
+	}
+
+	dataDBPath := filepath.Join(paths.Data, consts.DnoteDirName, consts.DnoteDBFileName)
+	if dataDBPath == dbPath {
+		return []string{dbPath}, nil
+	}
+
+	return []string{dataDBPath, dbPath}, nil
+}
+
+// hasInitWork returns true if the initialization changes the database or moves it,
+// by moving the legacy directory, or by running the legacy or the local migrations
+func hasInitWork(paths context.Paths, runMigrations bool) (bool, error) {
+	move, err := mayMoveLegacyDir(paths)
+	if err != nil {
+		return false, err
+	}
+	if move {
+		return true, nil
+	}
+
+	pending, err := migrate.LegacyPending(context.DnoteCtx{Paths: paths})
+	if err != nil {
+		return false, errors.Wrap(err, "checking the legacy migration")
+	}
+	if pending || !runMigrations {
+		return pending, nil
+	}
+
+	dbPath, err := getDBPath(paths)
+	if err != nil {
+		return false, err
+	}
+	db, err := database.Open(dbPath)
+	if err != nil {
+		return false, errors.Wrap(err, "opening the database")
+	}
+	defer db.Close()
+
+	pending, err = migrate.Pending(context.DnoteCtx{Paths: paths, DBPath: dbPath, DB: db}, migrate.LocalSequence, migrate.LocalMode)
+	if err != nil {
+		// a database without the system table is yet to be set up
+		log.Debug("checking the migrations: %s\n", err.Error())
+		return true, nil
+	}
+
+	return pending, nil
+}
+
+// lockInit takes the database lock for the initialization, so that no two processes move
+// the legacy directory, back up, or migrate the database at the same time. If another
+// process holds the lock, it waits for it only if the initialization has work to do, so
+// that the commands that do not need the lock are not held up by a long-running one.
+func lockInit(paths context.Paths, runMigrations bool) (initLock, error) {
+	lockPaths, err := getInitLockPaths(paths)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the database paths")
+	}
+
+	var ret initLock
+	for i, p := range lockPaths {
+		dir := filepath.Dir(p)
+		if i == 0 {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				ret.release()
+				return nil, errors.Wrapf(err, "creating %s", dir)
+			}
+		} else {
+			// the legacy directory is gone if another process moved it while this one waited
+			ok, err := utils.FileExists(dir)
+			if err != nil {
+				ret.release()
+				return nil, errors.Wrapf(err, "checking %s", dir)
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		l, err := lock.Acquire(p, false)
+		if err == lock.ErrLocked {
+			work, workErr := hasInitWork(paths, runMigrations)
+			if workErr != nil {
+				ret.release()
+				return nil, errors.Wrap(workErr, "checking the initialization")
+			}
+			if !work {
+				ret.release()
+				return nil, nil
+			}
+
+			log.Info("waiting for another dnote process to finish\n")
+			l, err = lock.Acquire(p, true)
+		}
+		if err != nil {
+			ret.release()
+			return nil, errors.Wrapf(err, "locking %s", p)
+		}
+
+		ret = append(ret, l)
+	}
+
+	return ret, nil
+}
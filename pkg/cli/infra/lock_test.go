@@ -0,0 +1,160 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package infra
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/lock"
+	"github.com/pkg/errors"
+)
+
+func TestGetInitLockPaths(t *testing.T) {
+	root := "../tmp/initlock"
+	defer os.RemoveAll(root)
+
+	paths := setupLegacyDir(t, root)
+
+	dataDBPath := filepath.Join(paths.Data, consts.DnoteDirName, consts.DnoteDBFileName)
+	legacyDBPath := filepath.Join(paths.LegacyDnote, consts.DnoteDBFileName)
+
+	t.Run("legacy directory", func(t *testing.T) {
+		got, err := getInitLockPaths(paths)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.DeepEqual(t, got, []string{dataDBPath, legacyDBPath}, "paths mismatch")
+	})
+
+	t.Run("legacy directory kept", func(t *testing.T) {
+		os.Setenv(KeepLegacyDirEnv, "1")
+		defer os.Unsetenv(KeepLegacyDirEnv)
+
+		got, err := getInitLockPaths(paths)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.DeepEqual(t, got, []string{legacyDBPath}, "paths mismatch")
+	})
+
+	t.Run("database given", func(t *testing.T) {
+		p := paths
+		p.DB = "/tmp/my.db"
+
+		got, err := getInitLockPaths(p)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.DeepEqual(t, got, []string{"/tmp/my.db"}, "paths mismatch")
+	})
+}
+
+func TestLockInit_noWork(t *testing.T) {
+	// set up
+	root := "../tmp/initlock"
+	defer os.RemoveAll(root)
+
+	paths := context.Paths{
+		Home:        root,
+		Config:      filepath.Join(root, "config"),
+		Data:        filepath.Join(root, "data"),
+		Cache:       filepath.Join(root, "cache"),
+		LegacyDnote: filepath.Join(root, consts.LegacyDnoteDirName),
+	}
+
+	dbPath := filepath.Join(paths.Data, consts.DnoteDirName, consts.DnoteDBFileName)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the data directory"))
+	}
+
+	held, err := lock.Acquire(dbPath, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "acquiring"))
+	}
+	defer held.Release()
+
+	// execute
+	l, err := lockInit(paths, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, len(l), 0, "lock count mismatch")
+}
+
+func TestLockInit_legacyDir(t *testing.T) {
+	// set up
+	root := "../tmp/initlock"
+	defer os.RemoveAll(root)
+
+	paths := setupLegacyDir(t, root)
+
+	dataDBPath := filepath.Join(paths.Data, consts.DnoteDirName, consts.DnoteDBFileName)
+	if err := os.MkdirAll(filepath.Dir(dataDBPath), 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the data directory"))
+	}
+
+	held, err := lock.Acquire(dataDBPath, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "acquiring"))
+	}
+
+	// execute
+	acquired := make(chan initLock)
+	go func() {
+		l, err := lockInit(paths, true)
+		if err != nil {
+			t.Error(errors.Wrap(err, "executing"))
+		}
+		acquired <- l
+	}()
+
+	// test
+	select {
+	case <-acquired:
+		t.Fatal("initialized while another process held the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the other process moves the legacy directory before it releases the lock
+	if err := os.Rename(paths.LegacyDnote, filepath.Join(root, consts.MigratedLegacyDnoteDirName)); err != nil {
+		t.Fatal(errors.Wrap(err, "moving the legacy directory"))
+	}
+	if err := held.Release(); err != nil {
+		t.Fatal(errors.Wrap(err, "releasing"))
+	}
+
+	select {
+	case l := <-acquired:
+		assert.Equal(t, len(l), 1, "lock count mismatch")
+		l.release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not initialize after the lock was released")
+	}
+}
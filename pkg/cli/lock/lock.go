@@ -0,0 +1,95 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package lock provides a cross-process lock on the database so that dnote
+// processes do not write to it at the same time
+package lock
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLocked is returned when another dnote process holds the lock
+var ErrLocked = errors.New("another dnote process is running. Try again when it finishes, or use --wait to wait for it")
+
+// errWouldBlock is returned by lockFile when the file is locked and it is not waiting
+var errWouldBlock = errors.New("lock is held")
+
+// Lock is an exclusive lock held on a lockfile
+type Lock struct {
+	f *os.File
+}
+
+// Path returns the path to the lockfile for the database at the given path. It sits
+// next to the database so that every process using the database uses the same file.
+func Path(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// Acquire takes the lock on the database at the given path. If another process holds
+// the lock, it returns ErrLocked, or blocks until the lock frees if wait is true.
+func Acquire(dbPath string, wait bool) (*Lock, error) {
+	return AcquireFile(Path(dbPath), wait)
+}
+
+// AcquireFile takes the lock on the lockfile at the given path, as Acquire does
+func AcquireFile(path string, wait bool) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the lockfile")
+	}
+
+	if err := lockFile(f, wait); err != nil {
+		f.Close()
+
+		if err == errWouldBlock {
+			return nil, ErrLocked
+		}
+
+		return nil, errors.Wrap(err, "locking")
+	}
+
+	return &Lock{f: f}, nil
+}
+
+// WritePID writes the id of this process to the lockfile, so that the holder of a
+// long-held lock can be found
+func (l *Lock) WritePID() error {
+	if err := l.f.Truncate(0); err != nil {
+		return errors.Wrap(err, "truncating the lockfile")
+	}
+	if _, err := l.f.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0); err != nil {
+		return errors.Wrap(err, "writing the pid")
+	}
+
+	return nil
+}
+
+// Release releases the lock. The lockfile is left in place because removing it could
+// let two processes lock different files at the same path.
+func (l *Lock) Release() error {
+	if err := unlockFile(l.f); err != nil {
+		l.f.Close()
+		return errors.Wrap(err, "unlocking")
+	}
+
+	return l.f.Close()
+}
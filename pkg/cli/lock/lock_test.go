@@ -0,0 +1,131 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package lock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnote-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "dnote.db")
+
+	l, err := Acquire(dbPath, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "acquiring"))
+	}
+
+	_, err = Acquire(dbPath, false)
+	assert.Equal(t, err, ErrLocked, "second acquire error mismatch")
+
+	if err := l.Release(); err != nil {
+		t.Fatal(errors.Wrap(err, "releasing"))
+	}
+
+	l, err = Acquire(dbPath, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "acquiring after release"))
+	}
+	defer l.Release()
+}
+
+func TestAcquireWait(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnote-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "dnote.db")
+
+	l, err := Acquire(dbPath, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "acquiring"))
+	}
+
+	acquired := make(chan error)
+	go func() {
+		l, err := Acquire(dbPath, true)
+		if err == nil {
+			err = l.Release()
+		}
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired while the lock was held: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(errors.Wrap(err, "releasing"))
+	}
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "waiting"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not acquire after the lock was released")
+	}
+}
+
+func TestWritePID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnote-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dnote.db.sync.lock")
+	if err := ioutil.WriteFile(path, []byte("a stale pid that is longer\n"), 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "writing a stale pid"))
+	}
+
+	l, err := AcquireFile(path, false)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "acquiring"))
+	}
+	defer l.Release()
+
+	if err := l.WritePID(); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the pid"))
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the lockfile"))
+	}
+	assert.Equal(t, string(b), fmt.Sprintf("%d\n", os.Getpid()), "pid mismatch")
+}
@@ -20,25 +20,60 @@ package main
 
 import (
 	"os"
+	"os/exec"
 
+	"github.com/dnote/dnote/pkg/cli/client"
 	"github.com/dnote/dnote/pkg/cli/infra"
 	"github.com/dnote/dnote/pkg/cli/log"
+	migrations "github.com/dnote/dnote/pkg/cli/migrate"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 
 	// commands
 	"github.com/dnote/dnote/pkg/cli/cmd/add"
+	"github.com/dnote/dnote/pkg/cli/cmd/backup"
+	"github.com/dnote/dnote/pkg/cli/cmd/books"
 	"github.com/dnote/dnote/pkg/cli/cmd/cat"
+	"github.com/dnote/dnote/pkg/cli/cmd/completion"
+	"github.com/dnote/dnote/pkg/cli/cmd/config"
+	"github.com/dnote/dnote/pkg/cli/cmd/demo"
+	"github.com/dnote/dnote/pkg/cli/cmd/deprecations"
+	"github.com/dnote/dnote/pkg/cli/cmd/digest"
+	"github.com/dnote/dnote/pkg/cli/cmd/doctor"
 	"github.com/dnote/dnote/pkg/cli/cmd/edit"
+	"github.com/dnote/dnote/pkg/cli/cmd/export"
 	"github.com/dnote/dnote/pkg/cli/cmd/find"
+	"github.com/dnote/dnote/pkg/cli/cmd/history"
+	"github.com/dnote/dnote/pkg/cli/cmd/importer"
+	"github.com/dnote/dnote/pkg/cli/cmd/index"
 	"github.com/dnote/dnote/pkg/cli/cmd/login"
 	"github.com/dnote/dnote/pkg/cli/cmd/logout"
 	"github.com/dnote/dnote/pkg/cli/cmd/ls"
+	"github.com/dnote/dnote/pkg/cli/cmd/meta"
+	"github.com/dnote/dnote/pkg/cli/cmd/migrate"
+	"github.com/dnote/dnote/pkg/cli/cmd/mirror"
+	"github.com/dnote/dnote/pkg/cli/cmd/move"
+	"github.com/dnote/dnote/pkg/cli/cmd/opensource"
+	"github.com/dnote/dnote/pkg/cli/cmd/pin"
+	"github.com/dnote/dnote/pkg/cli/cmd/random"
 	"github.com/dnote/dnote/pkg/cli/cmd/remove"
+	"github.com/dnote/dnote/pkg/cli/cmd/restore"
+	"github.com/dnote/dnote/pkg/cli/cmd/review"
 	"github.com/dnote/dnote/pkg/cli/cmd/root"
+	"github.com/dnote/dnote/pkg/cli/cmd/rotatekey"
+	"github.com/dnote/dnote/pkg/cli/cmd/serve"
+	"github.com/dnote/dnote/pkg/cli/cmd/spell"
+	"github.com/dnote/dnote/pkg/cli/cmd/stats"
+	"github.com/dnote/dnote/pkg/cli/cmd/status"
 	"github.com/dnote/dnote/pkg/cli/cmd/sync"
+	"github.com/dnote/dnote/pkg/cli/cmd/today"
+	"github.com/dnote/dnote/pkg/cli/cmd/trash"
+	"github.com/dnote/dnote/pkg/cli/cmd/verify"
+	"github.com/dnote/dnote/pkg/cli/cmd/verifysync"
 	"github.com/dnote/dnote/pkg/cli/cmd/version"
 	"github.com/dnote/dnote/pkg/cli/cmd/view"
+	"github.com/dnote/dnote/pkg/cli/cmd/visibility"
+	"github.com/dnote/dnote/pkg/cli/cmd/watch"
 )
 
 // apiEndpoint and versionTag are populated during link time
@@ -46,8 +81,15 @@ var apiEndpoint string
 var versionTag = "master"
 
 func main() {
-	ctx, err := infra.Init(apiEndpoint, versionTag)
+	args := os.Args[1:]
+	ctx, err := infra.Init(apiEndpoint, versionTag, root.GetDBFlag(args), !root.IsMigrateCmd(args))
 	if err != nil {
+		// a database from a newer version of dnote is not a bug, and needs no stack trace
+		if schemaErr, ok := errors.Cause(err).(*migrations.SchemaError); ok {
+			log.Errorf("%s\n", schemaErr.Error())
+			os.Exit(1)
+		}
+
 		panic(errors.Wrap(err, "initializing context"))
 	}
 	defer ctx.DB.Close()
@@ -63,9 +105,59 @@ func main() {
 	root.Register(cat.NewCmd(*ctx))
 	root.Register(view.NewCmd(*ctx))
 	root.Register(find.NewCmd(*ctx))
+	root.Register(export.NewCmd(*ctx))
+	root.Register(backup.NewCmd(*ctx))
+	root.Register(migrate.NewCmd(*ctx))
+	root.Register(importer.NewCmd(*ctx))
+	root.Register(importer.NewVerifyCmd(*ctx))
+	root.Register(spell.NewCmd(*ctx))
+	root.Register(books.NewCmd(*ctx))
+	root.Register(status.NewCmd(*ctx))
+	root.Register(serve.NewCmd(*ctx))
+	root.Register(review.NewCmd(*ctx))
+	root.Register(history.NewCmd(*ctx))
+	root.Register(restore.NewCmd(*ctx))
+	root.Register(deprecations.NewCmd(*ctx))
+	root.Register(today.NewCmd(*ctx))
+	root.Register(verify.NewCmd(*ctx))
+	root.Register(verifysync.NewCmd(*ctx))
+	root.Register(visibility.NewCmd(*ctx))
+	root.Register(doctor.NewCmd(*ctx))
+	root.Register(index.NewCmd(*ctx))
+	root.Register(move.NewCmd(*ctx))
+	root.Register(demo.NewCmd(*ctx))
+	root.Register(trash.NewCmd(*ctx))
+	root.Register(opensource.NewCmd(*ctx))
+	root.Register(completion.NewCmd(*ctx))
+	root.Register(watch.NewCmd(*ctx))
+	root.Register(digest.NewCmd(*ctx))
+	root.Register(stats.NewCmd(*ctx))
+	root.Register(random.NewCmd(*ctx))
+	root.Register(pin.NewCmd(*ctx))
+	root.Register(pin.NewUnpinCmd(*ctx))
+	root.Register(pin.NewPinnedCmd(*ctx))
+	root.Register(meta.NewCmd(*ctx))
+	root.Register(rotatekey.NewCmd(*ctx))
+	root.Register(mirror.NewCmd(*ctx))
+	root.Register(config.NewCmd(*ctx))
+
+	err = root.Execute(*ctx)
+
+	// a session renewed while running the command is saved once no transaction is open
+	if saveErr := client.SaveSession(ctx.DB); saveErr != nil {
+		log.Warnf("could not save the renewed session: %s\n", saveErr.Error())
+	}
+
+	if err != nil {
+		// exit with the same code as the external command
+		if exitErr, ok := errors.Cause(err).(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
 
-	if err := root.Execute(); err != nil {
 		log.Errorf("%s\n", err.Error())
+		if hint := client.GetErrorHint(err); hint != "" {
+			log.Plainf("%s\n", hint)
+		}
 		os.Exit(1)
 	}
 }
@@ -20,6 +20,8 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -173,6 +175,65 @@ func TestAddNote(t *testing.T) {
 		assert.Equal(t, n2.Body, "foo", "n2 body mismatch")
 		assert.Equal(t, n2.Dirty, true, "n2 dirty mismatch")
 	})
+
+	t.Run("existing book with a different case", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s/%s", testDir, consts.DnoteDirName, consts.DnoteDBFileName), nil)
+		testutils.Setup3(t, db)
+
+		// Execute
+		testutils.RunDnoteCmd(t, opts, binaryName, "add", "JS", "-c", "foo")
+		defer testutils.RemoveDir(t, testDir)
+
+		// Test
+		var noteCount, bookCount int
+		database.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+		database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &noteCount)
+
+		assert.Equalf(t, bookCount, 1, "book count mismatch")
+		assert.Equalf(t, noteCount, 2, "note count mismatch")
+	})
+
+	t.Run("standard input", func(t *testing.T) {
+		// Set up and execute
+		testutils.WaitDnoteCmd(t, opts, func(stdin io.WriteCloser) error {
+			if _, err := io.WriteString(stdin, "# foo\n\nbar\n"); err != nil {
+				return errors.Wrap(err, "writing the content")
+			}
+
+			return stdin.Close()
+		}, binaryName, "add", "js")
+		defer testutils.RemoveDir(t, testDir)
+
+		db := database.OpenTestDB(t, testDir)
+
+		// Test
+		var body string
+		database.MustScan(t, "getting note", db.QueryRow("SELECT notes.body FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ?", "js"), &body)
+		assert.Equal(t, body, "# foo\n\nbar\n", "Note body mismatch")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		// Set up
+		fpath := fmt.Sprintf("%s/content.md", testDir)
+		if err := os.MkdirAll(testDir, 0755); err != nil {
+			t.Fatal(errors.Wrap(err, "creating the test directory"))
+		}
+		if err := ioutil.WriteFile(fpath, []byte("foo from a file"), 0644); err != nil {
+			t.Fatal(errors.Wrap(err, "writing the content file"))
+		}
+
+		// Execute
+		testutils.RunDnoteCmd(t, opts, binaryName, "add", "js", "--file", fpath)
+		defer testutils.RemoveDir(t, testDir)
+
+		db := database.OpenTestDB(t, testDir)
+
+		// Test
+		var body string
+		database.MustScan(t, "getting note", db.QueryRow("SELECT body FROM notes"), &body)
+		assert.Equal(t, body, "foo from a file", "Note body mismatch")
+	})
 }
 
 func TestEditNote(t *testing.T) {
@@ -276,6 +337,80 @@ func TestEditNote(t *testing.T) {
 		assert.Equal(t, n2.Dirty, true, "n2 Dirty mismatch")
 		assert.NotEqual(t, n2.EditedOn, 0, "n2 EditedOn mismatch")
 	})
+
+	t.Run("language flag", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s/%s", testDir, consts.DnoteDirName, consts.DnoteDBFileName), nil)
+		testutils.Setup4(t, db)
+
+		// Execute
+		testutils.RunDnoteCmd(t, opts, binaryName, "edit", "2", "-l", "en-GB")
+		defer testutils.RemoveDir(t, testDir)
+
+		// Test
+		var n2Body, n2Language string
+		var n2Dirty bool
+		database.MustScan(t, "getting n2",
+			db.QueryRow("SELECT body, language, dirty FROM notes where uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &n2Body, &n2Language, &n2Dirty)
+
+		assert.Equal(t, n2Body, "Date object implements mathematical comparisons", "n2 Body mismatch")
+		assert.Equal(t, n2Language, "en-GB", "n2 Language mismatch")
+		assert.Equal(t, n2Dirty, false, "n2 Dirty mismatch")
+	})
+
+	t.Run("public flag", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s/%s", testDir, consts.DnoteDirName, consts.DnoteDBFileName), nil)
+		testutils.Setup4(t, db)
+
+		// Execute
+		testutils.RunDnoteCmd(t, opts, binaryName, "edit", "2", "--public")
+		defer testutils.RemoveDir(t, testDir)
+
+		// Test
+		var n2Public, n2Dirty bool
+		database.MustScan(t, "getting n2",
+			db.QueryRow("SELECT public, dirty FROM notes where uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &n2Public, &n2Dirty)
+
+		assert.Equal(t, n2Public, true, "n2 Public mismatch")
+		assert.Equal(t, n2Dirty, true, "n2 Dirty mismatch")
+	})
+
+	t.Run("public flag with secrets", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s/%s", testDir, consts.DnoteDirName, consts.DnoteDBFileName), nil)
+		testutils.Setup4(t, db)
+
+		// Execute
+		testutils.WaitDnoteCmd(t, opts, testutils.UserConfirm, binaryName, "edit", "2", "--public", "-c", "password: hunter22")
+		defer testutils.RemoveDir(t, testDir)
+
+		// Test
+		var n2Body string
+		var n2Public bool
+		database.MustScan(t, "getting n2",
+			db.QueryRow("SELECT body, public FROM notes where uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &n2Body, &n2Public)
+
+		assert.Equal(t, n2Body, "password: hunter22", "n2 Body mismatch")
+		assert.Equal(t, n2Public, true, "n2 Public mismatch")
+	})
+
+	t.Run("public flag with secrets and force", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s/%s", testDir, consts.DnoteDirName, consts.DnoteDBFileName), nil)
+		testutils.Setup4(t, db)
+
+		// Execute
+		testutils.RunDnoteCmd(t, opts, binaryName, "edit", "2", "--public", "--force", "-c", "password: hunter22")
+		defer testutils.RemoveDir(t, testDir)
+
+		// Test
+		var n2Public bool
+		database.MustScan(t, "getting n2",
+			db.QueryRow("SELECT public FROM notes where uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &n2Public)
+
+		assert.Equal(t, n2Public, true, "n2 Public mismatch")
+	})
 }
 
 func TestEditBook(t *testing.T) {
@@ -392,7 +527,7 @@ func TestRemoveNote(t *testing.T) {
 			assert.Equal(t, b2.USN, 122, "b2 usn mismatch")
 
 			assert.Equal(t, n1.UUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "n1 should have UUID")
-			assert.Equal(t, n1.Body, "", "n1 body mismatch")
+			assert.Equal(t, n1.Body, "n1 body", "n1 body should be kept in the trash")
 			assert.Equal(t, n1.Deleted, true, "n1 deleted mismatch")
 			assert.Equal(t, n1.Dirty, true, "n1 Dirty mismatch")
 			assert.Equal(t, n1.USN, 11, "n1 usn mismatch")
@@ -118,6 +118,25 @@ func Legacy(ctx context.DnoteCtx) error {
 	return nil
 }
 
+// LegacyPending returns true if the JSON-based dnote in the legacy directory has not
+// been fully migrated yet
+func LegacyPending(ctx context.DnoteCtx) (bool, error) {
+	ok, err := utils.FileExists(getSchemaPath(ctx))
+	if err != nil {
+		return false, errors.Wrap(err, "checking if schema exists")
+	}
+	if !ok {
+		return false, nil
+	}
+
+	unrunMigrations, err := getUnrunMigrations(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "getting unrun migrations")
+	}
+
+	return len(unrunMigrations) > 0, nil
+}
+
 // performMigration backs up current .dnote data, performs migration, and
 // restores or cleans backups depending on if there is an error
 func performMigration(ctx context.DnoteCtx, migrationID int) error {
@@ -20,9 +20,17 @@ package migrate
 
 import (
 	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dnote/dnote/pkg/cli/config"
 	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/dnote/dnote/pkg/cli/utils"
 	"github.com/pkg/errors"
 )
 
@@ -47,6 +55,30 @@ var LocalSequence = []migration{
 	lm10,
 	lm11,
 	lm12,
+	lm13,
+	lm14,
+	lm15,
+	lm16,
+	lm17,
+	lm18,
+	lm19,
+	lm20,
+	lm21,
+	lm22,
+	lm23,
+	lm24,
+	lm25,
+	lm26,
+	lm27,
+	lm28,
+	lm29,
+	lm30,
+	lm31,
+	lm32,
+	lm33,
+	lm34,
+	lm35,
+	lm36,
 }
 
 // RemoteSequence is a list of remote migrations to be run
@@ -129,6 +161,22 @@ func execute(ctx context.DnoteCtx, m migration, schemaKey string) error {
 	return nil
 }
 
+// Pending tells if an existing database has migrations to run. A new database, on
+// which all migrations are to run, has none.
+func Pending(ctx context.DnoteCtx, migrations []migration, mode int) (bool, error) {
+	schemaKey, err := getSchemaKey(mode)
+	if err != nil {
+		return false, errors.Wrap(err, "getting schema key")
+	}
+
+	schema, err := getSchema(ctx, schemaKey)
+	if err != nil {
+		return false, errors.Wrap(err, "getting the current schema")
+	}
+
+	return schema > 0 && schema < len(migrations), nil
+}
+
 // Run performs unrun migrations
 func Run(ctx context.DnoteCtx, migrations []migration, mode int) error {
 	schemaKey, err := getSchemaKey(mode)
@@ -143,6 +191,10 @@ func Run(ctx context.DnoteCtx, migrations []migration, mode int) error {
 
 	log.Debug("current schema: %s %d of %d\n", consts.SystemSchema, schema, len(migrations))
 
+	if schema > len(migrations) {
+		return newSchemaError(ctx, schema, len(migrations))
+	}
+
 	toRun := migrations[schema:]
 
 	for _, m := range toRun {
@@ -151,5 +203,270 @@ func Run(ctx context.DnoteCtx, migrations []migration, mode int) error {
 		}
 	}
 
+	if len(toRun) > 0 && mode == LocalMode {
+		if err := database.UpsertSystem(ctx.DB, consts.SystemSchemaVersion, ctx.Version); err != nil {
+			return errors.Wrap(err, "saving the version of dnote")
+		}
+	}
+
+	return nil
+}
+
+// SchemaError is an error for a database migrated by a newer version of dnote, whose
+// schema this version does not know about
+type SchemaError struct {
+	// Schema is the schema version of the database
+	Schema int
+	// Latest is the latest schema version this version of dnote supports
+	Latest int
+	// Version is the version of dnote that migrated the database, if known
+	Version string
+}
+
+func (e *SchemaError) Error() string {
+	by := "a newer version of dnote"
+	if e.Version != "" {
+		by = fmt.Sprintf("dnote %s", e.Version)
+	}
+
+	return fmt.Sprintf("the database was migrated by %s to the schema version %d, but this version of dnote supports up to %d. Upgrade dnote, or run 'dnote migrate --force' to use the database anyway", by, e.Schema, e.Latest)
+}
+
+func newSchemaError(ctx context.DnoteCtx, schema, latest int) error {
+	var version string
+	err := database.GetSystem(ctx.DB, consts.SystemSchemaVersion, &version)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return errors.Wrap(err, "getting the version of dnote that migrated the database")
+	}
+
+	return &SchemaError{Schema: schema, Latest: latest, Version: version}
+}
+
+// CheckSchema returns a *SchemaError if the database was migrated by a newer version of
+// dnote, so that it is not used with a schema this version does not know about
+func CheckSchema(ctx context.DnoteCtx, migrations []migration, mode int) error {
+	schemaKey, err := getSchemaKey(mode)
+	if err != nil {
+		return errors.Wrap(err, "getting schema key")
+	}
+
+	schema, err := getSchema(ctx, schemaKey)
+	if err != nil {
+		return errors.Wrap(err, "getting the current schema")
+	}
+
+	if schema > len(migrations) {
+		return newSchemaError(ctx, schema, len(migrations))
+	}
+
+	return nil
+}
+
+// Force sets the schema version of a database migrated by a newer version of dnote to
+// the latest one this version supports, so that the database can be used. The tables
+// and the columns added by the newer migrations are left as they are. It returns true
+// if the schema version was changed.
+func Force(ctx context.DnoteCtx, migrations []migration, mode int) (bool, error) {
+	schemaKey, err := getSchemaKey(mode)
+	if err != nil {
+		return false, errors.Wrap(err, "getting schema key")
+	}
+
+	schema, err := getSchema(ctx, schemaKey)
+	if err != nil {
+		return false, errors.Wrap(err, "getting the current schema")
+	}
+
+	if schema <= len(migrations) {
+		return false, nil
+	}
+
+	if _, err := ctx.DB.Exec("UPDATE system SET value = ? WHERE key = ?", len(migrations), schemaKey); err != nil {
+		return false, errors.Wrap(err, "updating the schema")
+	}
+	if mode == LocalMode {
+		if err := database.UpsertSystem(ctx.DB, consts.SystemSchemaVersion, ctx.Version); err != nil {
+			return false, errors.Wrap(err, "saving the version of dnote")
+		}
+	}
+
+	return true, nil
+}
+
+// Status is the state of a migration in a sequence
+type Status struct {
+	// Version is the schema version of the database after the migration runs
+	Version    int
+	Name       string
+	Applied    bool
+	Reversible bool
+}
+
+// copyConfig copies the configuration file, if any, to where it is found in the
+// context of the dry run
+func copyConfig(ctx, copyCtx context.DnoteCtx) error {
+	src := config.GetPath(ctx)
+
+	ok, err := utils.FileExists(src)
+	if err != nil {
+		return errors.Wrap(err, "checking the configuration file")
+	}
+	if !ok {
+		return nil
+	}
+
+	dest := config.GetPath(copyCtx)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return errors.Wrap(err, "creating the configuration directory")
+	}
+	if err := utils.CopyFile(src, dest); err != nil {
+		return errors.Wrap(err, "copying the configuration file")
+	}
+
+	return nil
+}
+
+// GetStatus returns the state of each migration in the sequence for the database
+func GetStatus(ctx context.DnoteCtx, migrations []migration, mode int) ([]Status, error) {
+	schemaKey, err := getSchemaKey(mode)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting schema key")
+	}
+
+	schema, err := getSchema(ctx, schemaKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the current schema")
+	}
+
+	ret := []Status{}
+	for i, m := range migrations {
+		ret = append(ret, Status{
+			Version:    i + 1,
+			Name:       m.name,
+			Applied:    i < schema,
+			Reversible: m.down != nil,
+		})
+	}
+
+	return ret, nil
+}
+
+// DryRun performs the unrun migrations against a copy of the database, leaving the
+// database untouched. It returns the names of the migrations that ran on the copy,
+// stopping at the first one that fails.
+func DryRun(ctx context.DnoteCtx, migrations []migration, mode int) ([]string, error) {
+	schemaKey, err := getSchemaKey(mode)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting schema key")
+	}
+
+	dir, err := ioutil.TempDir("", "dnote-migrate")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating a temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	copyPath := filepath.Join(dir, "dnote.db")
+	if _, err := ctx.DB.Exec("VACUUM INTO ?", copyPath); err != nil {
+		return nil, errors.Wrap(err, "copying the database")
+	}
+
+	db, err := database.Open(copyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the copy of the database")
+	}
+	defer db.Close()
+
+	// the migrations that change the configuration or the files of the legacy dnote
+	// work on copies in the temporary directory as well
+	copyCtx := ctx
+	copyCtx.DB = db
+	copyCtx.DBPath = copyPath
+	copyCtx.Paths = context.Paths{
+		Home:        dir,
+		Config:      dir,
+		Data:        dir,
+		Cache:       dir,
+		LegacyDnote: filepath.Join(dir, "legacy"),
+		DB:          copyPath,
+	}
+	if err := copyConfig(ctx, copyCtx); err != nil {
+		return nil, errors.Wrap(err, "copying the configuration")
+	}
+
+	schema, err := getSchema(copyCtx, schemaKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the current schema")
+	}
+	if schema > len(migrations) {
+		return nil, newSchemaError(ctx, schema, len(migrations))
+	}
+
+	ran := []string{}
+	for _, m := range migrations[schema:] {
+		if err := execute(copyCtx, m, schemaKey); err != nil {
+			return ran, errors.Wrap(err, "running migration")
+		}
+
+		ran = append(ran, m.name)
+	}
+
+	return ran, nil
+}
+
+func executeDown(ctx context.DnoteCtx, m migration, schemaKey string) error {
+	log.Debug("reversing migration %s\n", m.name)
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := m.down(ctx, tx); err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "reversing '%s'", m.name)
+	}
+
+	if _, err := tx.Exec("UPDATE system SET value = value - 1 WHERE key = ?", schemaKey); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "decrementing schema")
+	}
+
+	return tx.Commit()
+}
+
+// Down reverses the applied migrations until the schema of the database reaches the
+// given version. Nothing is reversed unless every migration in the way can be.
+func Down(ctx context.DnoteCtx, migrations []migration, mode int, target int) error {
+	schemaKey, err := getSchemaKey(mode)
+	if err != nil {
+		return errors.Wrap(err, "getting schema key")
+	}
+
+	schema, err := getSchema(ctx, schemaKey)
+	if err != nil {
+		return errors.Wrap(err, "getting the current schema")
+	}
+
+	if target < 0 || target > schema {
+		return errors.Errorf("the schema version must be between 0 and %d", schema)
+	}
+	if schema > len(migrations) {
+		return errors.Errorf("the schema version %d is newer than the latest migration %d", schema, len(migrations))
+	}
+
+	toReverse := migrations[target:schema]
+	for _, m := range toReverse {
+		if m.down == nil {
+			return errors.Errorf("migration '%s' cannot be reversed", m.name)
+		}
+	}
+
+	for i := len(toReverse) - 1; i >= 0; i-- {
+		if err := executeDown(ctx, toReverse[i], schemaKey); err != nil {
+			return errors.Wrap(err, "reversing migration")
+		}
+	}
+
 	return nil
 }
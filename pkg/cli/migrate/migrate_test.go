@@ -19,17 +19,22 @@
 package migrate
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dnote/actions"
 	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/config"
 	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/dnote/dnote/pkg/cli/database"
@@ -324,6 +329,322 @@ func TestRun_up_to_date(t *testing.T) {
 	}
 }
 
+func TestPending(t *testing.T) {
+	sequence := []migration{{name: "v1"}, {name: "v2"}, {name: "v3"}}
+
+	testCases := []struct {
+		schema   int
+		expected bool
+	}{
+		{schema: 0, expected: false},
+		{schema: 1, expected: true},
+		{schema: 3, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("schema %d", tc.schema), func(t *testing.T) {
+			// set up
+			opts := database.TestDBOptions{SkipMigration: true}
+			ctx := context.InitTestCtx(t, paths, &opts)
+			defer context.TeardownTestCtx(t, ctx)
+
+			database.MustExec(t, "inserting a schema", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSchema, tc.schema)
+
+			// execute
+			got, err := Pending(ctx, sequence, LocalMode)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			assert.Equal(t, got, tc.expected, "pending mismatch")
+		})
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	noop := func(ctx context.DnoteCtx, db *database.DB) error { return nil }
+	sequence := []migration{{name: "v1", run: noop}, {name: "v2", run: noop, down: noop}}
+	database.MustExec(t, "inserting a schema", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSchema, 1)
+
+	// execute
+	got, err := GetStatus(ctx, sequence, LocalMode)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	expected := []Status{
+		{Version: 1, Name: "v1", Applied: true, Reversible: false},
+		{Version: 2, Name: "v2", Applied: false, Reversible: true},
+	}
+	assert.DeepEqual(t, got, expected, "status mismatch")
+}
+
+func TestDryRun(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	database.MustExec(t, "inserting a schema", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSchema, 1)
+
+	sequence := []migration{
+		{name: "v1", run: func(ctx context.DnoteCtx, db *database.DB) error { return nil }},
+		{name: "v2", run: func(ctx context.DnoteCtx, db *database.DB) error {
+			_, err := db.Exec("CREATE TABLE t1 (id integer)")
+			return err
+		}},
+		{name: "v3", run: func(ctx context.DnoteCtx, db *database.DB) error {
+			return errors.New("v3 failed")
+		}},
+	}
+
+	// execute
+	got, err := DryRun(ctx, sequence, LocalMode)
+
+	// test
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assert.DeepEqual(t, got, []string{"v2"}, "ran mismatch")
+
+	var schema, tableCount int
+	database.MustScan(t, "getting schema", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSchema), &schema)
+	database.MustScan(t, "counting tables", ctx.DB.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 't1'"), &tableCount)
+	assert.Equal(t, schema, 1, "schema mismatch")
+	assert.Equal(t, tableCount, 0, "the database should not be changed")
+}
+
+func TestDryRun_config(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	if err := os.MkdirAll(filepath.Dir(config.GetPath(ctx)), 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the config directory"))
+	}
+	if err := config.Write(ctx, config.Config{APIEndpoint: "https://dnote.example.com/api"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	// lm12 writes the api endpoint into the configuration
+	sequence := []migration{lm12}
+
+	// execute
+	got, err := DryRun(ctx, sequence, LocalMode)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.DeepEqual(t, got, []string{lm12.name}, "ran mismatch")
+
+	cf, err := config.Read(ctx)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the config"))
+	}
+	assert.Equal(t, cf.APIEndpoint, "https://dnote.example.com/api", "the config should not be changed")
+}
+
+func TestDown(t *testing.T) {
+	create := func(name string) func(ctx context.DnoteCtx, db *database.DB) error {
+		return func(ctx context.DnoteCtx, db *database.DB) error {
+			_, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (id integer)", name))
+			return err
+		}
+	}
+	drop := func(name string) func(ctx context.DnoteCtx, db *database.DB) error {
+		return func(ctx context.DnoteCtx, db *database.DB) error {
+			_, err := db.Exec(fmt.Sprintf("DROP TABLE %s", name))
+			return err
+		}
+	}
+	sequence := []migration{
+		{name: "v1", run: create("t1")},
+		{name: "v2", run: create("t2"), down: drop("t2")},
+		{name: "v3", run: create("t3"), down: drop("t3")},
+	}
+
+	countTables := func(t *testing.T, db *database.DB) int {
+		var ret int
+		database.MustScan(t, "counting tables", db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name IN ('t1', 't2', 't3')"), &ret)
+		return ret
+	}
+
+	t.Run("reversible", func(t *testing.T) {
+		// set up
+		opts := database.TestDBOptions{SkipMigration: true}
+		ctx := context.InitTestCtx(t, paths, &opts)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if err := Run(ctx, sequence, LocalMode); err != nil {
+			t.Fatal(errors.Wrap(err, "running migrations"))
+		}
+
+		// execute
+		if err := Down(ctx, sequence, LocalMode, 1); err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		var schema int
+		database.MustScan(t, "getting schema", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSchema), &schema)
+		assert.Equal(t, schema, 1, "schema mismatch")
+		assert.Equal(t, countTables(t, ctx.DB), 1, "table count mismatch")
+	})
+
+	t.Run("irreversible", func(t *testing.T) {
+		// set up
+		opts := database.TestDBOptions{SkipMigration: true}
+		ctx := context.InitTestCtx(t, paths, &opts)
+		defer context.TeardownTestCtx(t, ctx)
+
+		if err := Run(ctx, sequence, LocalMode); err != nil {
+			t.Fatal(errors.Wrap(err, "running migrations"))
+		}
+
+		// execute
+		err := Down(ctx, sequence, LocalMode, 0)
+
+		// test
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		var schema int
+		database.MustScan(t, "getting schema", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSchema), &schema)
+		assert.Equal(t, schema, 3, "schema mismatch")
+		assert.Equal(t, countTables(t, ctx.DB), 3, "nothing should be reversed")
+	})
+}
+
+func TestLocalSequence_down(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	// execute
+	if err := Down(ctx, LocalSequence, LocalMode, 31); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var count int
+	database.MustScan(t, "counting tables", ctx.DB.QueryRow("SELECT count(*) FROM sqlite_master WHERE name IN ('review_snoozes', 'note_metadata', 'idx_notes_dirty', 'idx_books_dirty', 'local_changes')"), &count)
+	assert.Equal(t, count, 0, "the objects should be dropped")
+
+	database.MustScan(t, "counting columns", ctx.DB.QueryRow("SELECT count(*) FROM pragma_table_info('note_versions') WHERE name IN ('title', 'content_type')"), &count)
+	assert.Equal(t, count, 0, "the columns should be dropped")
+
+	if err := Run(ctx, LocalSequence, LocalMode); err != nil {
+		t.Fatal(errors.Wrap(err, "running the migrations again"))
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	sequence := []migration{{name: "v1"}, {name: "v2"}}
+
+	t.Run("supported", func(t *testing.T) {
+		// set up
+		opts := database.TestDBOptions{SkipMigration: true}
+		ctx := context.InitTestCtx(t, paths, &opts)
+		defer context.TeardownTestCtx(t, ctx)
+
+		database.MustExec(t, "inserting a schema", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSchema, 2)
+
+		// execute
+		err := CheckSchema(ctx, sequence, LocalMode)
+
+		// test
+		assert.Equal(t, err, nil, "error mismatch")
+	})
+
+	t.Run("newer", func(t *testing.T) {
+		// set up
+		opts := database.TestDBOptions{SkipMigration: true}
+		ctx := context.InitTestCtx(t, paths, &opts)
+		defer context.TeardownTestCtx(t, ctx)
+
+		database.MustExec(t, "inserting a schema", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSchema, 4)
+		database.MustExec(t, "inserting a version", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSchemaVersion, "1.2.0")
+
+		// execute
+		err := CheckSchema(ctx, sequence, LocalMode)
+
+		// test
+		schemaErr, ok := err.(*SchemaError)
+		if !ok {
+			t.Fatalf("expected a *SchemaError but got %v", err)
+		}
+		assert.DeepEqual(t, *schemaErr, SchemaError{Schema: 4, Latest: 2, Version: "1.2.0"}, "error mismatch")
+	})
+}
+
+func TestRun_saves_version(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+	ctx.Version = "1.2.0"
+
+	sequence := []migration{{name: "v1", run: func(ctx context.DnoteCtx, db *database.DB) error { return nil }}}
+
+	// execute
+	if err := Run(ctx, sequence, LocalMode); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var version string
+	database.MustScan(t, "getting the version", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSchemaVersion), &version)
+	assert.Equal(t, version, "1.2.0", "version mismatch")
+}
+
+func TestForce(t *testing.T) {
+	sequence := []migration{{name: "v1"}, {name: "v2"}}
+
+	testCases := []struct {
+		schema         int
+		expectedSchema int
+		expectedForced bool
+	}{
+		{schema: 4, expectedSchema: 2, expectedForced: true},
+		{schema: 2, expectedSchema: 2, expectedForced: false},
+		{schema: 1, expectedSchema: 1, expectedForced: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("schema %d", tc.schema), func(t *testing.T) {
+			// set up
+			opts := database.TestDBOptions{SkipMigration: true}
+			ctx := context.InitTestCtx(t, paths, &opts)
+			defer context.TeardownTestCtx(t, ctx)
+
+			database.MustExec(t, "inserting a schema", ctx.DB, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemSchema, tc.schema)
+
+			// execute
+			forced, err := Force(ctx, sequence, LocalMode)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			var schema int
+			database.MustScan(t, "getting schema", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSchema), &schema)
+			assert.Equal(t, forced, tc.expectedForced, "forced mismatch")
+			assert.Equal(t, schema, tc.expectedSchema, "schema mismatch")
+			assert.Equal(t, CheckSchema(ctx, sequence, LocalMode), nil, "the schema should be supported")
+		})
+	}
+}
+
 func TestLocalMigration1(t *testing.T) {
 	// set up
 	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-1-pre-schema.sql", SkipMigration: true}
@@ -1108,6 +1429,837 @@ func TestLocalMigration12(t *testing.T) {
 	assert.NotEqual(t, cf.APIEndpoint, "", "apiEndpoint was not populated")
 }
 
+func TestLocalMigration13(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-13-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	b1UUID := testutils.MustGenerateUUID(t)
+	database.MustExec(t, "inserting book 1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", b1UUID, "b1")
+
+	n1UUID := testutils.MustGenerateUUID(t)
+	database.MustExec(t, "inserting n1", db, `INSERT INTO notes
+		(uuid, book_uuid, body, added_on, edited_on, public, dirty, usn, deleted) VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?, ?)`, n1UUID, b1UUID, "n1 Body", 1, 2, true, true, 20, false)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm13.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var viewCount int
+	var lastViewedOn int64
+	database.MustScan(t, "scanning n1", db.QueryRow("SELECT view_count, last_viewed_on FROM notes WHERE uuid = ?", n1UUID), &viewCount, &lastViewedOn)
+	assert.Equal(t, viewCount, 0, "viewCount mismatch")
+	assert.Equal(t, lastViewedOn, int64(0), "lastViewedOn mismatch")
+}
+
+func TestLocalMigration14(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-14-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	b1UUID := testutils.MustGenerateUUID(t)
+	database.MustExec(t, "inserting book 1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", b1UUID, "b1")
+
+	n1UUID := testutils.MustGenerateUUID(t)
+	database.MustExec(t, "inserting n1", db, `INSERT INTO notes
+		(uuid, book_uuid, body, added_on, edited_on, public, dirty, usn, deleted) VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?, ?)`, n1UUID, b1UUID, "n1 Body", 1, 2, true, true, 20, false)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm14.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var language string
+	database.MustScan(t, "scanning n1", db.QueryRow("SELECT language FROM notes WHERE uuid = ?", n1UUID), &language)
+	assert.Equal(t, language, "", "language mismatch")
+}
+
+func TestLocalMigration15(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-15-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting book 1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", testutils.MustGenerateUUID(t), "js")
+	database.MustExec(t, "inserting book 2", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", testutils.MustGenerateUUID(t), "JS")
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm15.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var indexCount, bookCount int
+	database.MustScan(t, "counting index", db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = ? AND name = ?", "index", "idx_books_label_nocase"), &indexCount)
+	database.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	assert.Equal(t, indexCount, 1, "index count mismatch")
+	assert.Equal(t, bookCount, 2, "book count mismatch")
+}
+
+func TestLocalMigration16(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-16-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm16.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	database.MustExec(t, "inserting a snapshot", db, "INSERT INTO book_snapshots (uuid, book_uuid, name, created_at) VALUES (?, ?, ?, ?)", "s1-uuid", "b1-uuid", "before refactor", 1541108743)
+	database.MustExec(t, "inserting a snapshot note", db, "INSERT INTO book_snapshot_notes (snapshot_uuid, note_uuid, body, added_on) VALUES (?, ?, ?, ?)", "s1-uuid", "n1-uuid", "n1 body", 1541108743)
+
+	var name, body string
+	database.MustScan(t, "getting the snapshot", db.QueryRow("SELECT name FROM book_snapshots WHERE book_uuid = ?", "b1-uuid"), &name)
+	database.MustScan(t, "getting the snapshot note", db.QueryRow("SELECT body FROM book_snapshot_notes WHERE snapshot_uuid = ?", "s1-uuid"), &body)
+	assert.Equal(t, name, "before refactor", "name mismatch")
+	assert.Equal(t, body, "n1 body", "body mismatch")
+
+	_, err = db.Exec("INSERT INTO book_snapshots (uuid, book_uuid, name, created_at) VALUES (?, ?, ?, ?)", "s2-uuid", "b1-uuid", "before refactor", 1541108743)
+	assert.NotEqual(t, err, nil, "expected an error for a duplicate snapshot name")
+}
+
+func TestLocalMigration17(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-17-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm17.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	database.MustExec(t, "inserting a review state", db, "INSERT INTO review_state (note_uuid, ease_factor, interval, repetitions, due_on, last_reviewed_on) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", 2.5, 6, 2, 1541108743, 1541108743)
+
+	var easeFactor float64
+	var interval int
+	database.MustScan(t, "getting the review state", db.QueryRow("SELECT ease_factor, interval FROM review_state WHERE note_uuid = ?", "n1-uuid"), &easeFactor, &interval)
+	assert.Equal(t, easeFactor, 2.5, "ease_factor mismatch")
+	assert.Equal(t, interval, 6, "interval mismatch")
+}
+
+func TestLocalMigration18(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-18-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm18.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	database.MustExec(t, "inserting a note version", db, "INSERT INTO note_versions (note_uuid, version, book_uuid, body, action, created_at) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", 1, "b1-uuid", "n1 body", "edit", 1541108743)
+
+	var body, language string
+	database.MustScan(t, "getting the note version", db.QueryRow("SELECT body, language FROM note_versions WHERE note_uuid = ? AND version = ?", "n1-uuid", 1), &body, &language)
+	assert.Equal(t, body, "n1 body", "body mismatch")
+	assert.Equal(t, language, "", "language mismatch")
+
+	_, err = db.Exec("INSERT INTO note_versions (note_uuid, version, book_uuid, body, action, created_at) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", 1, "b1-uuid", "n1 body", "edit", 1541108743)
+	assert.NotEqual(t, err, nil, "expected an error for a duplicate version")
+}
+
+func TestLocalMigration19(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-19-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1541108743)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm19.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var evicted bool
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT evicted FROM notes WHERE uuid = ?", "n1-uuid"), &evicted)
+	assert.Equal(t, evicted, false, "evicted mismatch")
+}
+
+func TestLocalMigration20(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-20-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "b1")
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1541108743)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm20.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var contentType string
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT content_type FROM notes WHERE uuid = ?", "n1-uuid"), &contentType)
+	assert.Equal(t, contentType, "markdown", "content_type mismatch")
+}
+
+func TestLocalMigration21(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-21-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm21.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	database.MustExec(t, "inserting a token", db, "INSERT INTO api_tokens (name, token_hash, scopes, created_at) VALUES (?, ?, ?, ?)", "vim", "hash", "read:notes", 1)
+	database.MustExec(t, "inserting an audit entry", db, "INSERT INTO api_audit (integration, action, created_at) VALUES (?, ?, ?)", "vim", "add", 1)
+
+	var target string
+	database.MustScan(t, "getting the audit entry", db.QueryRow("SELECT target FROM api_audit WHERE integration = ?", "vim"), &target)
+	assert.Equal(t, target, "", "target mismatch")
+
+	_, err = db.Exec("INSERT INTO api_tokens (name, token_hash, scopes, created_at) VALUES (?, ?, ?, ?)", "emacs", "hash", "read:notes", 1)
+	assert.NotEqual(t, err, nil, "token_hash should be unique")
+}
+
+func TestLocalMigration22(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-22-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm22.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var position int
+	var heading string
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT position, heading FROM notes WHERE uuid = ?", "n1-uuid"), &position, &heading)
+	assert.Equal(t, position, 0, "position mismatch")
+	assert.Equal(t, heading, "", "heading mismatch")
+}
+
+func TestLocalMigration23(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-23-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "", 1, true)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm23.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var trashedOn int64
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT trashed_on FROM notes WHERE uuid = ?", "n1-uuid"), &trashedOn)
+	assert.Equal(t, trashedOn, int64(0), "trashed_on mismatch")
+}
+
+func TestLocalMigration24(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-24-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "東京タワー", 1)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm24.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var tokenizer string
+	database.MustScan(t, "getting the book", db.QueryRow("SELECT tokenizer FROM books WHERE uuid = ?", "b1-uuid"), &tokenizer)
+	assert.Equal(t, tokenizer, "porter", "tokenizer mismatch")
+
+	// changing the tokenizer of the book routes its notes to the index for the tokenizer
+	database.MustExec(t, "changing the tokenizer", db, "UPDATE books SET tokenizer = ? WHERE uuid = ?", "trigram", "b1-uuid")
+
+	var count int
+	database.MustScan(t, "searching", db.QueryRow("SELECT count(*) FROM note_fts_trigram WHERE note_fts_trigram MATCH ?", "京タワ"), &count)
+	assert.Equal(t, count, 1, "search result count mismatch")
+	database.MustScan(t, "searching unicode61", db.QueryRow("SELECT count(*) FROM note_fts_unicode61"), &count)
+	assert.Equal(t, count, 0, "unicode61 index count mismatch")
+
+	problems, err := database.CheckFTS(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "checking the search index"))
+	}
+	assert.DeepEqual(t, problems, []string{}, "problems mismatch")
+}
+
+func TestLocalMigration25(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-25-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm25.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var sourceURL, sourceFragment string
+	var sourcePage int
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT source_url, source_page, source_fragment FROM notes WHERE uuid = ?", "n1-uuid"), &sourceURL, &sourcePage, &sourceFragment)
+	assert.Equal(t, sourceURL, "", "source_url mismatch")
+	assert.Equal(t, sourcePage, 0, "source_page mismatch")
+	assert.Equal(t, sourceFragment, "", "source_fragment mismatch")
+}
+
+func TestLocalMigration26(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-26-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm26.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var noteSort string
+	database.MustScan(t, "getting the book", db.QueryRow("SELECT note_sort FROM books WHERE uuid = ?", "b1-uuid"), &noteSort)
+	assert.Equal(t, noteSort, "", "note_sort mismatch")
+}
+
+func TestLocalMigration27(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-27-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, dirty) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "\n  closures capture variables  \nand keep them alive", 1, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, dirty) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "## Hoisting\n\nvar declarations are hoisted", 2, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "", 3, true, true)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm27.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var n1Title, n2Title, n3Title string
+	var n1Dirty, n2Dirty bool
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT title, dirty FROM notes WHERE uuid = ?", "n1-uuid"), &n1Title, &n1Dirty)
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT title, dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2Title, &n2Dirty)
+	database.MustScan(t, "getting n3", db.QueryRow("SELECT title FROM notes WHERE uuid = ?", "n3-uuid"), &n3Title)
+
+	assert.Equal(t, n1Title, "closures capture variables", "n1 title mismatch")
+	assert.Equal(t, n2Title, "Hoisting", "n2 title mismatch")
+	assert.Equal(t, n3Title, "", "n3 title mismatch")
+	assert.Equal(t, n1Dirty, false, "n1 dirty mismatch")
+	assert.Equal(t, n2Dirty, false, "n2 dirty mismatch")
+}
+
+func TestLocalMigration28(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-28-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1-body", 1)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm28.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var owner, author string
+	database.MustScan(t, "getting the book", db.QueryRow("SELECT owner FROM books WHERE uuid = ?", "b1-uuid"), &owner)
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT author FROM notes WHERE uuid = ?", "n1-uuid"), &author)
+	assert.Equal(t, owner, "", "owner mismatch")
+	assert.Equal(t, author, "", "author mismatch")
+}
+
+func TestLocalMigration29(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-29-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1-body", 1, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, public) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2-body", 2, true)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm29.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var n1Visibility, n2Visibility string
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT visibility FROM notes WHERE uuid = ?", "n1-uuid"), &n1Visibility)
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT visibility FROM notes WHERE uuid = ?", "n2-uuid"), &n2Visibility)
+	assert.Equal(t, n1Visibility, "private", "n1 visibility mismatch")
+	assert.Equal(t, n2Visibility, "unlisted", "n2 visibility mismatch")
+}
+
+func TestLocalMigration30(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-30-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting a note", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1-body", 1)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm30.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var pinnedOn int64
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT pinned_on FROM notes WHERE uuid = ?", "n1-uuid"), &pinnedOn)
+	assert.Equal(t, pinnedOn, int64(0), "pinned_on mismatch")
+}
+
+func TestLocalMigration31(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-31-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting a book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm31.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var archived bool
+	database.MustScan(t, "getting the book", db.QueryRow("SELECT archived FROM books WHERE uuid = ?", "b1-uuid"), &archived)
+	assert.Equal(t, archived, false, "archived mismatch")
+}
+
+func TestLocalMigration32(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-32-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm32.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	database.MustExec(t, "inserting a snooze", db, "INSERT INTO review_snoozes (note_uuid, snoozed_until) VALUES (?, ?)", "n1-uuid", 1541108743)
+
+	var snoozedUntil int64
+	database.MustScan(t, "getting the snooze", db.QueryRow("SELECT snoozed_until FROM review_snoozes WHERE note_uuid = ?", "n1-uuid"), &snoozedUntil)
+	assert.Equal(t, snoozedUntil, int64(1541108743), "snoozed_until mismatch")
+}
+
+func TestLocalMigration33(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-33-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm33.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	database.MustExec(t, "inserting metadata", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)", "n1-uuid", "project", "atlas")
+
+	var value string
+	database.MustScan(t, "getting the metadata", db.QueryRow("SELECT value FROM note_metadata WHERE note_uuid = ? AND key = ?", "n1-uuid", "project"), &value)
+	assert.Equal(t, value, "atlas", "value mismatch")
+}
+
+func TestLocalMigration34(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-34-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "dropping idx_notes_book_uuid", db, "DROP INDEX idx_notes_book_uuid")
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm34.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	for _, name := range []string{"idx_notes_book_uuid", "idx_notes_dirty", "idx_books_dirty", "idx_books_label"} {
+		var count int
+		database.MustScan(t, fmt.Sprintf("finding %s", name), db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name = ?", name), &count)
+		assert.Equal(t, count, 1, fmt.Sprintf("%s count mismatch", name))
+	}
+
+	var detail string
+	database.MustScan(t, "explaining the dirty scan", db.QueryRow("EXPLAIN QUERY PLAN SELECT uuid FROM notes WHERE dirty = ?", true), new(int), new(int), new(int), &detail)
+	assert.Equal(t, strings.Contains(detail, "idx_notes_dirty"), true, fmt.Sprintf("query plan mismatch: %s", detail))
+}
+
+func TestLocalMigration35(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-35-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 100, 300)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 200, nil)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 body", 400, 0)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm35.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	getChangedOn := func(uuid, typ string) int64 {
+		var ret int64
+		database.MustScan(t, fmt.Sprintf("getting the change of %s", uuid), db.QueryRow("SELECT changed_on FROM local_changes WHERE uuid = ? AND type = ?", uuid, typ), &ret)
+		return ret
+	}
+
+	assert.Equal(t, getChangedOn("n1-uuid", "note"), int64(300), "n1 changed_on mismatch")
+	assert.Equal(t, getChangedOn("n2-uuid", "note"), int64(200), "n2 changed_on mismatch")
+	assert.Equal(t, getChangedOn("n3-uuid", "note"), int64(400), "n3 changed_on mismatch")
+
+	before := time.Now().Add(-time.Second).UnixNano()
+
+	database.MustExec(t, "updating the content type of n1", db, "UPDATE notes SET content_type = ? WHERE uuid = ?", "plaintext", "n1-uuid")
+	database.MustExec(t, "setting the metadata of n2", db, "INSERT INTO note_metadata (note_uuid, key, value) VALUES (?, ?, ?)", "n2-uuid", "status", "draft")
+	database.MustExec(t, "deleting n3", db, "DELETE FROM notes WHERE uuid = ?", "n3-uuid")
+	database.MustExec(t, "renaming b1", db, "UPDATE books SET label = ? WHERE uuid = ?", "javascript", "b1-uuid")
+
+	assert.Equal(t, getChangedOn("n1-uuid", "note") > before, true, "n1 should be changed")
+	assert.Equal(t, getChangedOn("n2-uuid", "note") > before, true, "n2 should be changed")
+	assert.Equal(t, getChangedOn("n3-uuid", "note") > before, true, "n3 should be changed")
+	assert.Equal(t, getChangedOn("b1-uuid", "book") > before, true, "b1 should be changed")
+
+	// evicting the body in the thin mode, or updating it with the same values, is not a change
+	database.MustExec(t, "resetting n1", db, "UPDATE local_changes SET changed_on = ? WHERE uuid = ?", 1, "n1-uuid")
+	database.MustExec(t, "evicting n1", db, "UPDATE notes SET body = ?, evicted = ? WHERE uuid = ?", "", true, "n1-uuid")
+	database.MustExec(t, "updating n1", db, "UPDATE notes SET content_type = ?, usn = ? WHERE uuid = ?", "plaintext", 5, "n1-uuid")
+	assert.Equal(t, getChangedOn("n1-uuid", "note"), int64(1), "n1 should not be changed")
+
+	var noteCount, noteFTSCount int
+	database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	database.MustScan(t, "counting note_fts", db.QueryRow("SELECT count(*) FROM note_fts WHERE note_fts MATCH ?", "body"), &noteFTSCount)
+	assert.Equal(t, noteFTSCount, 1, "note_fts count mismatch")
+	assert.Equal(t, noteCount, 2, "note count mismatch")
+}
+
+func TestLocalMigration36(t *testing.T) {
+	// set up
+	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/local-36-pre-schema.sql", SkipMigration: true}
+	ctx := context.InitTestCtx(t, paths, &opts)
+	defer context.TeardownTestCtx(t, ctx)
+
+	db := ctx.DB
+	database.MustExec(t, "inserting a version", db, "INSERT INTO note_versions (note_uuid, version, book_uuid, body, action, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		"n1-uuid", 1, "b1-uuid", "n1 body", "edit", 1)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "beginning a transaction"))
+	}
+
+	err = lm36.run(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "failed to run"))
+	}
+
+	tx.Commit()
+
+	// Test
+	var title, contentType sql.NullString
+	database.MustScan(t, "getting the version", db.QueryRow("SELECT title, content_type FROM note_versions WHERE note_uuid = ?", "n1-uuid"), &title, &contentType)
+	assert.Equal(t, title.Valid, false, "title should be null")
+	assert.Equal(t, contentType.Valid, false, "content_type should be null")
+}
+
 func TestRemoteMigration1(t *testing.T) {
 	// set up
 	opts := database.TestDBOptions{SchemaSQLPath: "./fixtures/remote-1-pre-schema.sql", SkipMigration: true}
@@ -37,6 +37,9 @@ import (
 type migration struct {
 	name string
 	run  func(ctx context.DnoteCtx, tx *database.DB) error
+	// down reverses the migration. It is nil for the migrations that cannot be
+	// reversed, such as the ones that add columns or rewrite the data.
+	down func(ctx context.DnoteCtx, tx *database.DB) error
 }
 
 var lm1 = migration{
@@ -550,6 +553,362 @@ var lm12 = migration{
 	},
 }
 
+var lm13 = migration{
+	name: "add-view-count-and-last-viewed-on-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN view_count int DEFAULT 0 NOT NULL")
+		if err != nil {
+			return errors.Wrap(err, "adding view_count column to notes")
+		}
+
+		_, err = tx.Exec("ALTER TABLE notes ADD COLUMN last_viewed_on integer DEFAULT 0")
+		if err != nil {
+			return errors.Wrap(err, "adding last_viewed_on column to notes")
+		}
+
+		return nil
+	},
+}
+
+var lm14 = migration{
+	name: "add-language-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN language text DEFAULT '' NOT NULL")
+		if err != nil {
+			return errors.Wrap(err, "adding language column to notes")
+		}
+
+		return nil
+	},
+}
+
+var lm15 = migration{
+	name: "add-case-insensitive-index-on-book-labels",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		// The index is not unique so that the existing books whose labels differ only in case
+		// can remain until they are merged by the user.
+		_, err := tx.Exec("CREATE INDEX idx_books_label_nocase ON books(label COLLATE NOCASE)")
+		if err != nil {
+			return errors.Wrap(err, "creating index")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec("DROP INDEX idx_books_label_nocase"); err != nil {
+			return errors.Wrap(err, "dropping index")
+		}
+
+		return nil
+	},
+}
+
+var lm16 = migration{
+	name: "create-book-snapshot-tables",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec(`CREATE TABLE book_snapshots
+		(
+			uuid text PRIMARY KEY,
+			book_uuid text NOT NULL,
+			name text NOT NULL,
+			created_at integer NOT NULL
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating book_snapshots table")
+		}
+
+		_, err = tx.Exec(`CREATE TABLE book_snapshot_notes
+		(
+			snapshot_uuid text NOT NULL,
+			note_uuid text NOT NULL,
+			body text NOT NULL,
+			added_on integer NOT NULL,
+			edited_on integer DEFAULT 0,
+			public bool DEFAULT false
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating book_snapshot_notes table")
+		}
+
+		_, err = tx.Exec(`CREATE UNIQUE INDEX idx_book_snapshots_book_uuid_name ON book_snapshots(book_uuid, name);
+		CREATE INDEX idx_book_snapshot_notes_snapshot_uuid ON book_snapshot_notes(snapshot_uuid);`)
+		if err != nil {
+			return errors.Wrap(err, "creating indices")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec(`DROP TABLE book_snapshot_notes;
+		DROP TABLE book_snapshots;`); err != nil {
+			return errors.Wrap(err, "dropping book snapshot tables")
+		}
+
+		return nil
+	},
+}
+
+var lm17 = migration{
+	name: "create-review-state-table",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec(`CREATE TABLE review_state
+		(
+			note_uuid text PRIMARY KEY,
+			ease_factor real NOT NULL,
+			interval integer NOT NULL,
+			repetitions integer NOT NULL,
+			due_on integer NOT NULL,
+			last_reviewed_on integer NOT NULL
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating review_state table")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec("DROP TABLE review_state"); err != nil {
+			return errors.Wrap(err, "dropping review_state table")
+		}
+
+		return nil
+	},
+}
+
+var lm18 = migration{
+	name: "create-note-versions-table",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec(`CREATE TABLE note_versions
+		(
+			note_uuid text NOT NULL,
+			version integer NOT NULL,
+			book_uuid text NOT NULL,
+			body text NOT NULL,
+			public bool DEFAULT false,
+			language text DEFAULT '' NOT NULL,
+			action text NOT NULL,
+			created_at integer NOT NULL
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating note_versions table")
+		}
+
+		_, err = tx.Exec("CREATE UNIQUE INDEX idx_note_versions_note_uuid_version ON note_versions(note_uuid, version);")
+		if err != nil {
+			return errors.Wrap(err, "creating an index")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec("DROP TABLE note_versions"); err != nil {
+			return errors.Wrap(err, "dropping note_versions table")
+		}
+
+		return nil
+	},
+}
+
+var lm19 = migration{
+	name: "add-evicted-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN evicted bool DEFAULT false NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding evicted column")
+		}
+
+		return nil
+	},
+}
+
+var lm20 = migration{
+	name: "add-content-type-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN content_type text DEFAULT 'markdown' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding content_type column")
+		}
+
+		return nil
+	},
+}
+
+var lm21 = migration{
+	name: "create-api-tokens-and-api-audit-tables",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec(`CREATE TABLE api_tokens
+		(
+			name text PRIMARY KEY,
+			token_hash text NOT NULL,
+			scopes text NOT NULL,
+			created_at integer NOT NULL
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating api_tokens table")
+		}
+
+		_, err = tx.Exec("CREATE UNIQUE INDEX idx_api_tokens_token_hash ON api_tokens(token_hash);")
+		if err != nil {
+			return errors.Wrap(err, "creating an index")
+		}
+
+		_, err = tx.Exec(`CREATE TABLE api_audit
+		(
+			integration text NOT NULL,
+			action text NOT NULL,
+			target text DEFAULT '' NOT NULL,
+			created_at integer NOT NULL
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating api_audit table")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec(`DROP TABLE api_audit;
+		DROP TABLE api_tokens;`); err != nil {
+			return errors.Wrap(err, "dropping api tables")
+		}
+
+		return nil
+	},
+}
+
+var lm22 = migration{
+	name: "add-position-and-heading-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN position integer DEFAULT 0 NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding position column")
+		}
+
+		_, err = tx.Exec("ALTER TABLE notes ADD COLUMN heading text DEFAULT '' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding heading column")
+		}
+
+		return nil
+	},
+}
+
+var lm23 = migration{
+	name: "add-trashed-on-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN trashed_on integer DEFAULT 0 NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding trashed_on column")
+		}
+
+		return nil
+	},
+}
+
+var lm24 = migration{
+	name: "add-tokenizer-to-books",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE books ADD COLUMN tokenizer text DEFAULT 'porter' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding tokenizer column")
+		}
+
+		// Create the search indices for the books using the tokenizers other than porter,
+		// and the triggers to route the notes to them
+		tokenizers := []struct {
+			name     string
+			tokenize string
+		}{
+			{"unicode61", "unicode61 categories 'L* N* Co Ps Pe'"},
+			{"trigram", "trigram"},
+		}
+		for _, t := range tokenizers {
+			_, err = tx.Exec(fmt.Sprintf(`CREATE VIRTUAL TABLE note_fts_%[1]s USING fts5(body, tokenize="%[2]s");
+				CREATE TRIGGER notes_after_insert_%[1]s AFTER INSERT ON notes BEGIN
+					INSERT INTO note_fts_%[1]s(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = '%[1]s';
+				END;
+				CREATE TRIGGER notes_after_delete_%[1]s AFTER DELETE ON notes BEGIN
+					DELETE FROM note_fts_%[1]s WHERE rowid = old.rowid;
+				END;
+				CREATE TRIGGER notes_after_update_%[1]s AFTER UPDATE ON notes BEGIN
+					DELETE FROM note_fts_%[1]s WHERE rowid = old.rowid;
+					INSERT INTO note_fts_%[1]s(rowid, body) SELECT new.rowid, new.body FROM books WHERE books.uuid = new.book_uuid AND books.tokenizer = '%[1]s';
+				END;
+				CREATE TRIGGER books_after_update_%[1]s AFTER UPDATE OF uuid, tokenizer ON books BEGIN
+					DELETE FROM note_fts_%[1]s WHERE rowid IN (SELECT rowid FROM notes WHERE book_uuid IN (old.uuid, new.uuid));
+					INSERT INTO note_fts_%[1]s(rowid, body) SELECT rowid, body FROM notes WHERE book_uuid = new.uuid AND new.tokenizer = '%[1]s';
+				END;`, t.name, t.tokenize))
+			if err != nil {
+				return errors.Wrapf(err, "creating the search index for %s", t.name)
+			}
+		}
+
+		return nil
+	},
+}
+
+var lm25 = migration{
+	name: "add-source-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec(`ALTER TABLE notes ADD COLUMN source_url text DEFAULT '' NOT NULL;
+			ALTER TABLE notes ADD COLUMN source_page integer DEFAULT 0 NOT NULL;
+			ALTER TABLE notes ADD COLUMN source_fragment text DEFAULT '' NOT NULL;`)
+		if err != nil {
+			return errors.Wrap(err, "adding source columns")
+		}
+
+		return nil
+	},
+}
+
+var lm26 = migration{
+	name: "add-note-sort-to-books",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE books ADD COLUMN note_sort text DEFAULT '' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding note_sort column")
+		}
+
+		return nil
+	},
+}
+
+var lm27 = migration{
+	name: "add-title-to-notes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN title text DEFAULT '' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding title column")
+		}
+
+		rows, err := tx.Query("SELECT uuid, body FROM notes WHERE deleted = ?", false)
+		if err != nil {
+			return errors.Wrap(err, "getting notes")
+		}
+
+		titles := map[string]string{}
+		for rows.Next() {
+			var uuid, body string
+			if err := rows.Scan(&uuid, &body); err != nil {
+				rows.Close()
+				return errors.Wrap(err, "scanning row")
+			}
+
+			titles[uuid] = database.InferTitle(body)
+		}
+		rows.Close()
+
+		// The server populates the titles of its copies in the same way, so the notes
+		// are not marked dirty.
+		for uuid, title := range titles {
+			if _, err := tx.Exec("UPDATE notes SET title = ? WHERE uuid = ?", title, uuid); err != nil {
+				return errors.Wrapf(err, "populating the title of the note %s", uuid)
+			}
+		}
+
+		return nil
+	},
+}
+
 var rm1 = migration{
 	name: "sync-book-uuids-from-server",
 	run: func(ctx context.DnoteCtx, tx *database.DB) error {
@@ -608,3 +967,258 @@ var rm1 = migration{
 		return nil
 	},
 }
+
+var lm28 = migration{
+	name: "add-team-columns",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN author text DEFAULT '' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding author column")
+		}
+
+		_, err = tx.Exec("ALTER TABLE books ADD COLUMN owner text DEFAULT '' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding owner column")
+		}
+
+		return nil
+	},
+}
+
+var lm29 = migration{
+	name: "add-visibility-column",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN visibility text DEFAULT 'private' NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding visibility column")
+		}
+
+		// the notes shared before the visibility was introduced are link-only
+		_, err = tx.Exec("UPDATE notes SET visibility = 'unlisted' WHERE public = true;")
+		if err != nil {
+			return errors.Wrap(err, "populating visibility column")
+		}
+
+		return nil
+	},
+}
+
+var lm30 = migration{
+	name: "add-pinned-on-column",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE notes ADD COLUMN pinned_on integer DEFAULT 0 NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding pinned_on column")
+		}
+
+		return nil
+	},
+}
+
+var lm31 = migration{
+	name: "add-archived-column",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE books ADD COLUMN archived bool DEFAULT false NOT NULL;")
+		if err != nil {
+			return errors.Wrap(err, "adding archived column")
+		}
+
+		return nil
+	},
+}
+
+var lm32 = migration{
+	name: "create-review-snoozes-table",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec(`CREATE TABLE review_snoozes
+		(
+			note_uuid text PRIMARY KEY,
+			snoozed_until integer NOT NULL
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating review_snoozes table")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec("DROP TABLE review_snoozes"); err != nil {
+			return errors.Wrap(err, "dropping review_snoozes table")
+		}
+
+		return nil
+	},
+}
+
+var lm33 = migration{
+	name: "create-note-metadata-table",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		_, err := tx.Exec(`CREATE TABLE note_metadata
+		(
+			note_uuid text NOT NULL,
+			key text NOT NULL,
+			value text NOT NULL,
+			PRIMARY KEY (note_uuid, key)
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating note_metadata table")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec("DROP TABLE note_metadata"); err != nil {
+			return errors.Wrap(err, "dropping note_metadata table")
+		}
+
+		return nil
+	},
+}
+
+var lm34 = migration{
+	name: "create-sync-indexes",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		// the indexes on the book uuid of the notes and on the book labels already exist in
+		// most databases, and are created here for the ones that lost them
+		_, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_book_uuid ON notes(book_uuid);
+		CREATE INDEX IF NOT EXISTS idx_notes_dirty ON notes(dirty);
+		CREATE INDEX IF NOT EXISTS idx_books_dirty ON books(dirty);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_books_label ON books(label);`)
+		if err != nil {
+			return errors.Wrap(err, "creating indexes")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec(`DROP INDEX IF EXISTS idx_notes_dirty;
+		DROP INDEX IF EXISTS idx_books_dirty;`); err != nil {
+			return errors.Wrap(err, "dropping indexes")
+		}
+
+		return nil
+	},
+}
+
+var lm35 = migration{
+	name: "create-local-changes-table",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		// local_changes records the time of the last change on this device to each note and
+		// book, including removals, whether made by a command or pulled by sync. The triggers
+		// keep it up to date so that incremental exports see every change. The time is in unix
+		// nanoseconds with the millisecond precision of SQLite. The notes start off with the
+		// times they were added or edited.
+		_, err := tx.Exec(`CREATE TABLE local_changes
+		(
+			uuid text NOT NULL,
+			type text NOT NULL,
+			changed_on integer NOT NULL,
+			PRIMARY KEY (uuid, type)
+		);
+		CREATE INDEX idx_local_changes_changed_on ON local_changes(changed_on);
+		INSERT INTO local_changes (uuid, type, changed_on) SELECT uuid, 'note', max(added_on, coalesce(edited_on, 0)) FROM notes;
+		CREATE TRIGGER notes_after_insert_changed AFTER INSERT ON notes BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = new.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (new.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+		CREATE TRIGGER notes_after_update_changed AFTER UPDATE OF uuid, book_uuid, title, body, edited_on, public, visibility, content_type, language, deleted, trashed_on ON notes
+			WHEN old.evicted = new.evicted AND (old.uuid IS NOT new.uuid OR old.book_uuid IS NOT new.book_uuid OR old.title IS NOT new.title OR old.body IS NOT new.body
+				OR old.edited_on IS NOT new.edited_on OR old.public IS NOT new.public OR old.visibility IS NOT new.visibility OR old.content_type IS NOT new.content_type
+				OR old.language IS NOT new.language OR old.deleted IS NOT new.deleted OR old.trashed_on IS NOT new.trashed_on) BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid IN (old.uuid, new.uuid);
+				INSERT INTO local_changes (uuid, type, changed_on) SELECT old.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000 UNION SELECT new.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000;
+			END;
+		CREATE TRIGGER notes_after_delete_changed AFTER DELETE ON notes BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = old.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (old.uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+		CREATE TRIGGER books_after_insert_changed AFTER INSERT ON books BEGIN
+				DELETE FROM local_changes WHERE type = 'book' AND uuid = new.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (new.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+		CREATE TRIGGER books_after_update_changed AFTER UPDATE OF uuid, label, deleted ON books
+			WHEN old.uuid IS NOT new.uuid OR old.label IS NOT new.label OR old.deleted IS NOT new.deleted BEGIN
+				DELETE FROM local_changes WHERE type = 'book' AND uuid IN (old.uuid, new.uuid);
+				INSERT INTO local_changes (uuid, type, changed_on) SELECT old.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000 UNION SELECT new.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000;
+			END;
+		CREATE TRIGGER books_after_delete_changed AFTER DELETE ON books BEGIN
+				DELETE FROM local_changes WHERE type = 'book' AND uuid = old.uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (old.uuid, 'book', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+		CREATE TRIGGER note_metadata_after_insert_changed AFTER INSERT ON note_metadata BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = new.note_uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (new.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;
+		CREATE TRIGGER note_metadata_after_update_changed AFTER UPDATE ON note_metadata BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid IN (old.note_uuid, new.note_uuid);
+				INSERT INTO local_changes (uuid, type, changed_on) SELECT old.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000 UNION SELECT new.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000;
+			END;
+		CREATE TRIGGER note_metadata_after_delete_changed AFTER DELETE ON note_metadata BEGIN
+				DELETE FROM local_changes WHERE type = 'note' AND uuid = old.note_uuid;
+				INSERT INTO local_changes (uuid, type, changed_on) VALUES (old.note_uuid, 'note', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000);
+			END;`)
+		if err != nil {
+			return errors.Wrap(err, "creating local_changes table")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		if _, err := tx.Exec(`DROP TRIGGER notes_after_insert_changed;
+		DROP TRIGGER notes_after_update_changed;
+		DROP TRIGGER notes_after_delete_changed;
+		DROP TRIGGER books_after_insert_changed;
+		DROP TRIGGER books_after_update_changed;
+		DROP TRIGGER books_after_delete_changed;
+		DROP TRIGGER note_metadata_after_insert_changed;
+		DROP TRIGGER note_metadata_after_update_changed;
+		DROP TRIGGER note_metadata_after_delete_changed;
+		DROP TABLE local_changes;`); err != nil {
+			return errors.Wrap(err, "dropping local_changes table")
+		}
+
+		return nil
+	},
+}
+
+var lm36 = migration{
+	name: "add-title-and-content-type-to-note-versions",
+	run: func(ctx context.DnoteCtx, tx *database.DB) error {
+		// The columns are null for the versions saved before they existed, so that restoring
+		// such a version keeps the current title and content type of the note.
+		_, err := tx.Exec("ALTER TABLE note_versions ADD COLUMN title text")
+		if err != nil {
+			return errors.Wrap(err, "adding title column")
+		}
+
+		_, err = tx.Exec("ALTER TABLE note_versions ADD COLUMN content_type text")
+		if err != nil {
+			return errors.Wrap(err, "adding content_type column")
+		}
+
+		return nil
+	},
+	down: func(ctx context.DnoteCtx, tx *database.DB) error {
+		// The bundled SQLite cannot drop columns, so the table is rebuilt without them.
+		if _, err := tx.Exec(`CREATE TABLE note_versions_tmp
+		(
+			note_uuid text NOT NULL,
+			version integer NOT NULL,
+			book_uuid text NOT NULL,
+			body text NOT NULL,
+			public bool DEFAULT false,
+			language text DEFAULT '' NOT NULL,
+			action text NOT NULL,
+			created_at integer NOT NULL
+		);
+		INSERT INTO note_versions_tmp (note_uuid, version, book_uuid, body, public, language, action, created_at)
+			SELECT note_uuid, version, book_uuid, body, public, language, action, created_at FROM note_versions;
+		DROP TABLE note_versions;
+		ALTER TABLE note_versions_tmp RENAME TO note_versions;
+		CREATE UNIQUE INDEX idx_note_versions_note_uuid_version ON note_versions(note_uuid, version);`); err != nil {
+			return errors.Wrap(err, "removing title and content_type columns")
+		}
+
+		return nil
+	},
+}
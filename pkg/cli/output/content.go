@@ -0,0 +1,201 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package output
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/dnote/color"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+)
+
+var (
+	colorHeading = color.New(color.FgBlue, color.Bold)
+	colorBold    = color.New(color.Bold)
+)
+
+var (
+	boldReg       = regexp.MustCompile(`\*\*[^*\n]+\*\*`)
+	inlineCodeReg = regexp.MustCompile("`[^`\n]+`")
+	bulletReg     = regexp.MustCompile(`^(\s*)([-*+]|\d+\.)(\s)`)
+)
+
+// renderMarkdownLine colorizes a line of Markdown outside of code blocks
+func renderMarkdownLine(line string) string {
+	if strings.HasPrefix(line, "#") {
+		return colorHeading.Sprint(line)
+	}
+
+	line = bulletReg.ReplaceAllStringFunc(line, func(s string) string {
+		m := bulletReg.FindStringSubmatch(s)
+		return m[1] + log.ColorYellow.Sprint(m[2]) + m[3]
+	})
+	line = inlineCodeReg.ReplaceAllStringFunc(line, func(s string) string {
+		return log.ColorYellow.Sprint(s)
+	})
+	line = boldReg.ReplaceAllStringFunc(line, func(s string) string {
+		return colorBold.Sprint(s)
+	})
+
+	return line
+}
+
+// renderMarkdown colorizes the headings, bullets, bold text and code in the Markdown
+// content. The text itself is not changed, so the content is printed verbatim if
+// the colors are disabled.
+func renderMarkdown(content string) string {
+	lines := strings.Split(content, "\n")
+
+	var inCodeBlock bool
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+			lines[i] = log.ColorGray.Sprint(line)
+		} else if inCodeBlock {
+			lines[i] = log.ColorYellow.Sprint(line)
+		} else {
+			lines[i] = renderMarkdownLine(line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// renderContent returns the content of the note to be printed on the terminal.
+// Only Markdown is rendered. Code and plain text are printed verbatim.
+func renderContent(info database.NoteInfo) string {
+	if info.ContentType == database.ContentTypeMarkdown {
+		return renderMarkdown(info.Content)
+	}
+
+	return info.Content
+}
+
+// languageSignature is a set of patterns that suggest a programming language
+type languageSignature struct {
+	name     string
+	patterns []*regexp.Regexp
+}
+
+var languageSignatures = []languageSignature{
+	{"go", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^package \w+`),
+		regexp.MustCompile(`\bfunc (\(\w+ \*?\w+\) )?\w+\(`),
+		regexp.MustCompile(`:=`),
+		regexp.MustCompile(`\bfmt\.\w+`),
+	}},
+	{"python", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\s*def \w+\(.*\):\s*$`),
+		regexp.MustCompile(`(?m)^\s*(from \w+ )?import \w+\s*$`),
+		regexp.MustCompile(`\bself\.`),
+		regexp.MustCompile(`\bprint\(`),
+		regexp.MustCompile(`(?m)^\s*(if|for|while|class) .*:\s*$`),
+	}},
+	{"javascript", []*regexp.Regexp{
+		regexp.MustCompile(`\b(const|let|var) \w+ =`),
+		regexp.MustCompile(`=>`),
+		regexp.MustCompile(`\bconsole\.\w+\(`),
+		regexp.MustCompile(`\bfunction\s*\w*\(`),
+		regexp.MustCompile(`\brequire\(|\bexport (default )?`),
+	}},
+	{"rust", []*regexp.Regexp{
+		regexp.MustCompile(`\bfn \w+\(`),
+		regexp.MustCompile(`\blet mut\b`),
+		regexp.MustCompile(`\w+!\(`),
+		regexp.MustCompile(`(?m)^\s*(use|impl|pub) `),
+	}},
+	{"c", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^#include\s*[<"]`),
+		regexp.MustCompile(`\bint main\(`),
+		regexp.MustCompile(`\bprintf\(`),
+	}},
+	{"sql", []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bselect\b.+\bfrom\b`),
+		regexp.MustCompile(`(?i)\b(insert into|create table|update \w+ set|delete from)\b`),
+		regexp.MustCompile(`(?i)\bwhere\b`),
+	}},
+	{"shell", []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^\s*\$ `),
+		regexp.MustCompile(`\becho\b`),
+		regexp.MustCompile(`\b(sudo|grep|awk|sed|export)\b`),
+		regexp.MustCompile(`\|\s*\w+`),
+	}},
+}
+
+// shebangLanguages maps the interpreters in a shebang line to languages
+var shebangLanguages = map[string]string{
+	"sh":      "shell",
+	"bash":    "shell",
+	"zsh":     "shell",
+	"python":  "python",
+	"python3": "python",
+	"node":    "javascript",
+}
+
+// detectShebang returns the language of the interpreter in the shebang line, if any
+func detectShebang(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+
+	line := strings.SplitN(content, "\n", 2)[0]
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := fields[0]
+	if strings.HasSuffix(interpreter, "/env") && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	if idx := strings.LastIndex(interpreter, "/"); idx != -1 {
+		interpreter = interpreter[idx+1:]
+	}
+
+	return shebangLanguages[interpreter]
+}
+
+// DetectLanguage guesses the programming language of the code from a shebang line,
+// or from the patterns that are common in the language. It returns an empty string
+// if the language cannot be guessed.
+func DetectLanguage(code string) string {
+	if lang := detectShebang(code); lang != "" {
+		return lang
+	}
+
+	var ret string
+	var maxScore int
+	for _, sig := range languageSignatures {
+		var score int
+		for _, p := range sig.patterns {
+			if p.MatchString(code) {
+				score++
+			}
+		}
+
+		if score > maxScore {
+			ret = sig.name
+			maxScore = score
+		}
+	}
+
+	return ret
+}
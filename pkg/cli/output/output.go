@@ -21,13 +21,108 @@
 package output
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/dnote/color"
 	"github.com/dnote/dnote/pkg/cli/database"
 	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
 )
 
+const (
+	// FormatText is the format of the output for humans
+	FormatText = "text"
+	// FormatJSON is the format of the output for scripts and integrations
+	FormatJSON = "json"
+)
+
+// format is the format of the output
+var format = FormatText
+
+// SetFormat sets the format of the output. In the JSON format, the messages are printed
+// to stderr so that stdout only contains JSON.
+func SetFormat(f string) error {
+	switch f {
+	case FormatText:
+		log.SetOutput(color.Output)
+	case FormatJSON:
+		log.SetOutput(color.Error)
+	default:
+		return errors.Errorf("unknown format '%s'. Use '%s' or '%s'", f, FormatText, FormatJSON)
+	}
+
+	format = f
+
+	return nil
+}
+
+// IsJSON returns true if the output is in the JSON format
+func IsJSON() bool {
+	return format == FormatJSON
+}
+
+// JSON prints the given value to stdout as JSON
+func JSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		return errors.Wrap(err, "encoding JSON")
+	}
+
+	return nil
+}
+
+// JSONLine prints the given value to stdout as JSON on a single line, for the commands
+// that print a stream of values
+func JSONLine(v interface{}) error {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		return errors.Wrap(err, "encoding JSON")
+	}
+
+	return nil
+}
+
+// Note is the JSON representation of a note
+type Note struct {
+	RowID       int        `json:"id"`
+	UUID        string     `json:"uuid"`
+	Book        string     `json:"book"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	AddedOn     time.Time  `json:"added_on"`
+	EditedOn    *time.Time `json:"edited_on,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Pinned      bool       `json:"pinned,omitempty"`
+}
+
+// NewNote returns the JSON representation of the given note
+func NewNote(info database.NoteInfo) Note {
+	ret := Note{
+		RowID:       info.RowID,
+		UUID:        info.UUID,
+		Book:        info.BookLabel,
+		Title:       database.NoteTitle(info.Title, info.Content),
+		Content:     info.Content,
+		AddedOn:     time.Unix(0, info.AddedOn).UTC(),
+		Language:    info.Language,
+		ContentType: info.ContentType,
+		Author:      info.Author,
+		Pinned:      info.Pinned,
+	}
+	if info.EditedOn != 0 {
+		t := time.Unix(0, info.EditedOn).UTC()
+		ret.EditedOn = &t
+	}
+
+	return ret
+}
+
 // NoteInfo prints a note information
 func NoteInfo(info database.NoteInfo) {
 	log.Infof("book name: %s\n", info.BookLabel)
@@ -37,9 +132,32 @@ func NoteInfo(info database.NoteInfo) {
 	}
 	log.Infof("note id: %d\n", info.RowID)
 	log.Infof("note uuid: %s\n", info.UUID)
+	if title := database.NoteTitle(info.Title, info.Content); title != "" {
+		log.Infof("title: %s\n", title)
+	}
+	if info.Author != "" {
+		log.Infof("author: %s\n", info.Author)
+	}
+	if info.Pinned {
+		log.Infof("pinned: yes\n")
+	}
+	if info.Language != "" {
+		log.Infof("language: %s\n", info.Language)
+	}
+	if info.ContentType != "" {
+		log.Infof("content type: %s\n", info.ContentType)
+	}
+	if info.Source.URL != "" {
+		log.Infof("source: %s\n", info.Source.Location())
+	}
+	if info.ContentType == database.ContentTypeCode {
+		if lang := DetectLanguage(info.Content); lang != "" {
+			log.Infof("detected language: %s\n", lang)
+		}
+	}
 
 	fmt.Printf("\n------------------------content------------------------\n")
-	fmt.Printf("%s", info.Content)
+	fmt.Printf("%s", renderContent(info))
 	fmt.Printf("\n-------------------------------------------------------\n")
 }
 
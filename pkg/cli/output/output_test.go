@@ -0,0 +1,166 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package output
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dnote/color"
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/database"
+)
+
+func TestSetFormat(t *testing.T) {
+	defer SetFormat(FormatText)
+
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, IsJSON(), true, "IsJSON mismatch after setting json")
+
+	if err := SetFormat("yaml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	assert.Equal(t, IsJSON(), true, "format should not change for an unknown format")
+
+	if err := SetFormat(FormatText); err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, IsJSON(), false, "IsJSON mismatch after setting text")
+}
+
+func TestNewNote(t *testing.T) {
+	addedOn := time.Date(2020, time.March, 14, 21, 15, 0, 0, time.UTC)
+	editedOn := time.Date(2020, time.March, 15, 8, 0, 0, 0, time.UTC)
+
+	t.Run("edited", func(t *testing.T) {
+		got := NewNote(database.NoteInfo{
+			RowID:       3,
+			BookLabel:   "js",
+			UUID:        "n1-uuid",
+			Title:       "n1 title",
+			Content:     "n1 content",
+			AddedOn:     addedOn.UnixNano(),
+			EditedOn:    editedOn.UnixNano(),
+			Language:    "en",
+			ContentType: "code",
+		})
+
+		expected := Note{
+			RowID:       3,
+			UUID:        "n1-uuid",
+			Book:        "js",
+			Title:       "n1 title",
+			Content:     "n1 content",
+			AddedOn:     addedOn,
+			EditedOn:    &editedOn,
+			Language:    "en",
+			ContentType: "code",
+		}
+		assert.DeepEqual(t, got, expected, "note mismatch")
+	})
+
+	t.Run("not edited", func(t *testing.T) {
+		got := NewNote(database.NoteInfo{
+			RowID:     3,
+			BookLabel: "js",
+			UUID:      "n1-uuid",
+			Content:   "n1 content",
+			AddedOn:   addedOn.UnixNano(),
+		})
+
+		expected := Note{
+			RowID:   3,
+			UUID:    "n1-uuid",
+			Book:    "js",
+			Title:   "n1 content",
+			Content: "n1 content",
+			AddedOn: addedOn,
+		}
+		assert.DeepEqual(t, got, expected, "note mismatch")
+	})
+}
+
+func TestDetectLanguage(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected string
+	}{
+		{
+			code:     "package main\n\nfunc main() {\n\tx := 1\n\tfmt.Println(x)\n}\n",
+			expected: "go",
+		},
+		{
+			code:     "def greet(name):\n    print(name)\n",
+			expected: "python",
+		},
+		{
+			code:     "const add = (a, b) => a + b;\nconsole.log(add(1, 2));\n",
+			expected: "javascript",
+		},
+		{
+			code:     "SELECT * FROM notes WHERE deleted = false;",
+			expected: "sql",
+		},
+		{
+			code:     "#!/usr/bin/env python3\nx = 1\n",
+			expected: "python",
+		},
+		{
+			code:     "#!/bin/bash\nls\n",
+			expected: "shell",
+		},
+		{
+			code:     "just some words",
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code, func(t *testing.T) {
+			assert.Equal(t, DetectLanguage(tc.code), tc.expected, "language mismatch")
+		})
+	}
+}
+
+func TestRenderContent(t *testing.T) {
+	content := "# title\n\n- **bold** and `code`\n"
+
+	noColor := color.NoColor
+	defer func() { color.NoColor = noColor }()
+
+	t.Run("no color", func(t *testing.T) {
+		color.NoColor = true
+
+		for _, ct := range database.ContentTypes {
+			got := renderContent(database.NoteInfo{Content: content, ContentType: ct})
+			assert.Equal(t, got, content, fmt.Sprintf("content mismatch for %s", ct))
+		}
+	})
+
+	t.Run("color", func(t *testing.T) {
+		color.NoColor = false
+
+		assert.NotEqual(t, renderContent(database.NoteInfo{Content: content, ContentType: database.ContentTypeMarkdown}), content, "markdown should be rendered")
+		assert.Equal(t, renderContent(database.NoteInfo{Content: content, ContentType: database.ContentTypeCode}), content, "code should be verbatim")
+		assert.Equal(t, renderContent(database.NoteInfo{Content: content, ContentType: database.ContentTypePlaintext}), content, "plaintext should be verbatim")
+	})
+}
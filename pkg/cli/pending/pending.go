@@ -0,0 +1,205 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package pending reports the changes waiting to be uploaded on the next sync, and keeps
+// them from growing needlessly while the device is offline
+package pending
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// DefaultTimePerChange is the estimated time to upload a change before any sync has
+// been timed on this device
+const DefaultTimePerChange = 300 * time.Millisecond
+
+// urgentFactor is how many times the warning threshold the pending changes must exceed
+// for the warning to be shown on every command rather than once a day
+const urgentFactor = 10
+
+// Changes is the number of the books and notes to be uploaded on the next sync
+type Changes struct {
+	Books int
+	Notes int
+}
+
+// Total returns the number of all changes
+func (c Changes) Total() int {
+	return c.Books + c.Notes
+}
+
+// Count returns the changes to be uploaded on the next sync. Each changed book or note
+// is uploaded once, however many times it was changed.
+func Count(db *database.DB) (Changes, error) {
+	var ret Changes
+
+	err := db.QueryRow(`SELECT
+		(SELECT count(*) FROM books WHERE dirty = ?),
+		(SELECT count(*) FROM notes WHERE dirty = ?)`, true, true).Scan(&ret.Books, &ret.Notes)
+	if err != nil {
+		return ret, errors.Wrap(err, "counting dirty books and notes")
+	}
+
+	return ret, nil
+}
+
+// Compact removes the pending changes that the next sync would discard without sending,
+// namely the books and notes that were added and then removed without being uploaded.
+// It returns the number of the changes removed.
+func Compact(db *database.DB) (int, error) {
+	noteRes, err := db.Exec("DELETE FROM notes WHERE usn = 0 AND deleted = ? AND trashed_on = 0", true)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting the notes that were never uploaded")
+	}
+	noteCount, err := noteRes.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "counting the deleted notes")
+	}
+
+	bookRes, err := db.Exec("DELETE FROM books WHERE usn = 0 AND deleted = ?", true)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting the books that were never uploaded")
+	}
+	bookCount, err := bookRes.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "counting the deleted books")
+	}
+
+	return int(noteCount + bookCount), nil
+}
+
+// SaveTimePerChange records the time it took to upload each change in a sync, so that
+// the later estimates reflect the connection to the server
+func SaveTimePerChange(db *database.DB, elapsed time.Duration, changes int) error {
+	if changes <= 0 {
+		return nil
+	}
+
+	val := strconv.FormatInt(elapsed.Milliseconds()/int64(changes), 10)
+	if err := database.UpsertSystem(db, consts.SystemSyncMSPerChange, val); err != nil {
+		return errors.Wrap(err, "saving the time per change")
+	}
+
+	return nil
+}
+
+// Estimate returns how long it will take to upload the changes, based on the last sync
+func Estimate(db *database.DB, c Changes) (time.Duration, error) {
+	perChange := DefaultTimePerChange
+
+	var ms int64
+	err := db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemSyncMSPerChange).Scan(&ms)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, errors.Wrap(err, "getting the time per change")
+	}
+	if err == nil && ms > 0 {
+		perChange = time.Duration(ms) * time.Millisecond
+	}
+
+	return time.Duration(c.Total()) * perChange, nil
+}
+
+// FormatEstimate returns a human readable estimate of the given duration
+func FormatEstimate(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "less than a minute"
+	case d < time.Hour:
+		return fmt.Sprintf("about %d minutes", int(d.Minutes()+0.5))
+	default:
+		return fmt.Sprintf("about %.1f hours", d.Hours())
+	}
+}
+
+// shouldWarn returns true if the warning for the given number of changes is due
+func shouldWarn(db *database.DB, now time.Time, total, threshold int) (bool, error) {
+	if threshold <= 0 || total < threshold {
+		return false, nil
+	}
+	if total >= threshold*urgentFactor {
+		return true, nil
+	}
+
+	var lastWarnedAt int64
+	err := db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemLastPendingWarning).Scan(&lastWarnedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return false, errors.Wrap(err, "getting the time of the last warning")
+	}
+
+	return now.Sub(time.Unix(0, lastWarnedAt)) >= 24*time.Hour, nil
+}
+
+// Check warns if the changes waiting for the next sync exceed the threshold, after
+// compacting them. The warning is shown at most once a day unless the changes far exceed
+// the threshold.
+func Check(ctx context.DnoteCtx) error {
+	if ctx.PendingWarnThreshold <= 0 {
+		return nil
+	}
+
+	c, err := Count(ctx.DB)
+	if err != nil {
+		return err
+	}
+	if c.Total() < ctx.PendingWarnThreshold {
+		return nil
+	}
+
+	compacted, err := Compact(ctx.DB)
+	if err != nil {
+		return errors.Wrap(err, "compacting the pending changes")
+	}
+	if compacted > 0 {
+		log.Debug("compacted %d pending changes\n", compacted)
+
+		if c, err = Count(ctx.DB); err != nil {
+			return err
+		}
+	}
+
+	now := ctx.Clock.Now()
+	ok, err := shouldWarn(ctx.DB, now, c.Total(), ctx.PendingWarnThreshold)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	estimate, err := Estimate(ctx.DB, c)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("%d changes are waiting to be uploaded. The next sync will take %s. Run `dnote sync` when you are online.\n", c.Total(), FormatEstimate(estimate))
+
+	if err := database.UpsertSystem(ctx.DB, consts.SystemLastPendingWarning, strconv.FormatInt(now.UnixNano(), 10)); err != nil {
+		return errors.Wrap(err, "saving the time of the warning")
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package pending
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestCount(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, dirty) VALUES (?, ?, ?)", "b1-uuid", "b1", true)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, dirty) VALUES (?, ?, ?)", "b2-uuid", "b2", false)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, dirty) VALUES (?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, true)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b2-uuid", "", 2, true, true)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, dirty) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3 body", 3, false)
+
+	// exec
+	got, err := Count(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, got, Changes{Books: 1, Notes: 2}, "count mismatch")
+	assert.Equal(t, got.Total(), 3, "total mismatch")
+}
+
+func TestCompact(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+
+	// added and removed without being uploaded
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b1-uuid", "b1-random", 0, true, true)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "", 1, 0, true, true)
+	// removed after being uploaded
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, label, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?)", "b2-uuid", "b2-random", 3, true, true)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b2-uuid", "", 2, 4, true, true)
+	// in the trash
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted, trashed_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b2-uuid", "n3 body", 3, 0, true, true, 1)
+	// edited many times
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?, ?)", "n4-uuid", "b2-uuid", "n4 body", 4, 5, true, false)
+
+	// exec
+	count, err := Compact(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, count, 2, "count mismatch")
+
+	c, err := Count(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "counting"))
+	}
+	assert.Equal(t, c, Changes{Books: 1, Notes: 3}, "changes mismatch")
+
+	var n1Count, b1Count int
+	database.MustScan(t, "counting n1", db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", "n1-uuid"), &n1Count)
+	database.MustScan(t, "counting b1", db.QueryRow("SELECT count(*) FROM books WHERE uuid = ?", "b1-uuid"), &b1Count)
+	assert.Equal(t, n1Count, 0, "n1 count mismatch")
+	assert.Equal(t, b1Count, 0, "b1 count mismatch")
+}
+
+func TestEstimate(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+
+	c := Changes{Books: 2, Notes: 8}
+
+	// exec and test
+	got, err := Estimate(db, c)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "estimating without a timed sync"))
+	}
+	assert.Equal(t, got, 10*DefaultTimePerChange, "default estimate mismatch")
+
+	if err := SaveTimePerChange(db, 6*time.Second, 3); err != nil {
+		t.Fatal(errors.Wrap(err, "saving the time per change"))
+	}
+
+	got, err = Estimate(db, c)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "estimating after a timed sync"))
+	}
+	assert.Equal(t, got, 20*time.Second, "estimate mismatch")
+}
+
+func TestFormatEstimate(t *testing.T) {
+	testCases := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{
+			input:    30 * time.Second,
+			expected: "less than a minute",
+		},
+		{
+			input:    90 * time.Second,
+			expected: "about 2 minutes",
+		},
+		{
+			input:    90 * time.Minute,
+			expected: "about 1.5 hours",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input.String(), func(t *testing.T) {
+			assert.Equal(t, FormatEstimate(tc.input), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestShouldWarn(t *testing.T) {
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		total        int
+		threshold    int
+		lastWarnedAt time.Time
+		expected     bool
+	}{
+		{
+			total:     100,
+			threshold: 500,
+			expected:  false,
+		},
+		{
+			total:     500,
+			threshold: 0,
+			expected:  false,
+		},
+		{
+			total:     500,
+			threshold: 500,
+			expected:  true,
+		},
+		{
+			total:        600,
+			threshold:    500,
+			lastWarnedAt: now.Add(-time.Hour),
+			expected:     false,
+		},
+		{
+			total:        600,
+			threshold:    500,
+			lastWarnedAt: now.Add(-25 * time.Hour),
+			expected:     true,
+		},
+		{
+			total:        5000,
+			threshold:    500,
+			lastWarnedAt: now.Add(-time.Hour),
+			expected:     true,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// set up
+			db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+			defer database.TeardownTestDB(t, db)
+
+			if !tc.lastWarnedAt.IsZero() {
+				database.MustExec(t, "inserting the last warning", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastPendingWarning, strconv.FormatInt(tc.lastWarnedAt.UnixNano(), 10))
+			}
+
+			// exec
+			got, err := shouldWarn(db, now, tc.total, tc.threshold)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			assert.Equal(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package picker
+
+import (
+	"fmt"
+
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+// getNoteItems returns the notes as the items to pick from, the most recently added or
+// edited first. The label of a note has its id, its book and its title, so that any of them
+// can be typed to find it.
+func getNoteItems(db *database.DB) ([]Item, error) {
+	rows, err := db.Query(`SELECT notes.rowid, books.label, notes.title, notes.body
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.deleted = ?
+		ORDER BY max(notes.added_on, notes.edited_on) DESC`, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []Item{}
+	for rows.Next() {
+		var rowID int
+		var bookLabel, title, body string
+		if err := rows.Scan(&rowID, &bookLabel, &title, &body); err != nil {
+			return nil, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, Item{
+			ID:    rowID,
+			Label: fmt.Sprintf("(%d) %s: %s", rowID, bookLabel, database.NoteTitle(title, body)),
+		})
+	}
+
+	return ret, nil
+}
+
+// PickNote lets the user pick a note interactively, and returns its rowid
+func PickNote(ctx context.DnoteCtx) (int, error) {
+	items, err := getNoteItems(ctx.DB)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting the notes")
+	}
+	if len(items) == 0 {
+		return 0, errors.New("there are no notes")
+	}
+
+	item, err := Run("note> ", items)
+	if err != nil {
+		return 0, err
+	}
+
+	return item.ID, nil
+}
@@ -0,0 +1,345 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package picker provides an interactive list that narrows down the items as the user
+// types a query, by fuzzy matching the query against them, and returns the selected item
+package picker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ErrCancelled is an error for when the user closes the picker without selecting an item
+var ErrCancelled = errors.New("cancelled")
+
+// ErrNotTerminal is an error for when the picker cannot be shown because the standard
+// input or the standard error is not a terminal
+var ErrNotTerminal = errors.New("the interactive picker requires a terminal")
+
+// maxVisible is the number of the matching items shown at a time
+const maxVisible = 10
+
+const (
+	// scoreMatch is the score for each character of the query found in the item
+	scoreMatch = 1
+	// scoreConsecutive is the bonus for a character that follows the previous match
+	scoreConsecutive = 5
+	// scoreWordStart is the bonus for a character at the start of a word
+	scoreWordStart = 3
+)
+
+// Item is an item to pick from
+type Item struct {
+	ID    int
+	Label string
+}
+
+// Match returns the score of the fuzzy match of the query against the given string, and
+// false if the characters of the query do not appear in the string in order. The match
+// is case insensitive, and the matches that are consecutive or at the starts of words
+// score higher.
+func Match(query, s string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, true
+	}
+
+	var score, qi int
+	prevMatch := -2
+	prev := ' '
+	for i, r := range []rune(strings.ToLower(s)) {
+		if qi < len(q) && r == q[qi] {
+			score += scoreMatch
+			if prevMatch == i-1 {
+				score += scoreConsecutive
+			}
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += scoreWordStart
+			}
+
+			prevMatch = i
+			qi++
+		}
+
+		prev = r
+	}
+
+	if qi < len(q) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+// Filter returns the items matching the query, the best matches first. The items that
+// score equally keep their order.
+func Filter(items []Item, query string) []Item {
+	type scored struct {
+		item  Item
+		score int
+	}
+
+	matches := []scored{}
+	for _, item := range items {
+		if score, ok := Match(query, item.Label); ok {
+			matches = append(matches, scored{item, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	ret := []Item{}
+	for _, m := range matches {
+		ret = append(ret, m.item)
+	}
+
+	return ret
+}
+
+const (
+	keyRune = iota
+	keyBackspace
+	keyClear
+	keyUp
+	keyDown
+	keyEnter
+	keyCancel
+	keyIgnored
+)
+
+// key is a key pressed by the user
+type key struct {
+	kind int
+	r    rune
+}
+
+// readKey reads a key from the terminal in the raw mode
+func readKey(r *bufio.Reader) (key, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch c {
+	case '\r', '\n':
+		return key{kind: keyEnter}, nil
+	case 127, '\b':
+		return key{kind: keyBackspace}, nil
+	case 21: // ctrl-u
+		return key{kind: keyClear}, nil
+	case 16: // ctrl-p
+		return key{kind: keyUp}, nil
+	case 14: // ctrl-n
+		return key{kind: keyDown}, nil
+	case 3, 4: // ctrl-c, ctrl-d
+		return key{kind: keyCancel}, nil
+	case 27:
+		// the arrow keys arrive at once as an escape sequence, while the escape key alone
+		// is not followed by anything
+		if r.Buffered() == 0 {
+			return key{kind: keyCancel}, nil
+		}
+
+		seq := make([]byte, 2)
+		if _, err := io.ReadFull(r, seq); err != nil {
+			return key{}, err
+		}
+		if seq[0] == '[' || seq[0] == 'O' {
+			switch seq[1] {
+			case 'A':
+				return key{kind: keyUp}, nil
+			case 'B':
+				return key{kind: keyDown}, nil
+			}
+		}
+
+		return key{kind: keyIgnored}, nil
+	}
+
+	if unicode.IsControl(c) {
+		return key{kind: keyIgnored}, nil
+	}
+
+	return key{kind: keyRune, r: c}, nil
+}
+
+// state is the state of the picker
+type state struct {
+	items   []Item
+	query   []rune
+	matches []Item
+	cursor  int
+}
+
+func newState(items []Item) *state {
+	s := &state{items: items}
+	s.update()
+
+	return s
+}
+
+// update finds the items matching the query, and moves the cursor to the best match
+func (s *state) update() {
+	s.matches = Filter(s.items, string(s.query))
+	s.cursor = 0
+}
+
+// handle updates the state with the given key. It returns true with the selected item if
+// the user picked one, and ErrCancelled if the user closed the picker.
+func (s *state) handle(k key) (bool, Item, error) {
+	switch k.kind {
+	case keyRune:
+		s.query = append(s.query, k.r)
+		s.update()
+	case keyBackspace:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+			s.update()
+		}
+	case keyClear:
+		s.query = nil
+		s.update()
+	case keyUp:
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case keyDown:
+		if s.cursor < len(s.matches)-1 {
+			s.cursor++
+		}
+	case keyEnter:
+		if len(s.matches) > 0 {
+			return true, s.matches[s.cursor], nil
+		}
+	case keyCancel:
+		return false, Item{}, ErrCancelled
+	}
+
+	return false, Item{}, nil
+}
+
+// truncate shortens the label to fit in the given number of characters
+func truncate(label string, width int) string {
+	r := []rune(label)
+	if width <= 3 || len(r) <= width {
+		return label
+	}
+
+	return string(r[:width-3]) + "..."
+}
+
+// render draws the prompt and the visible matches below it, replacing what was drawn
+// before. It leaves the cursor at the end of the query, on the line of the prompt.
+func render(w io.Writer, s *state, prompt string, width int) {
+	var b strings.Builder
+
+	// erase the previous drawing from the line of the prompt to the end of the screen
+	b.WriteString("\r\x1b[J")
+
+	// show the window of the matches containing the cursor
+	start := 0
+	if s.cursor >= maxVisible {
+		start = s.cursor - maxVisible + 1
+	}
+	end := start + maxVisible
+	if end > len(s.matches) {
+		end = len(s.matches)
+	}
+
+	lines := 0
+	for i := start; i < end; i++ {
+		marker := "  "
+		if i == s.cursor {
+			marker = "> "
+		}
+
+		fmt.Fprintf(&b, "\r\n%s%s", marker, truncate(s.matches[i].Label, width-2))
+		lines++
+	}
+	fmt.Fprintf(&b, "\r\n  %d/%d", len(s.matches), len(s.items))
+	lines++
+
+	// go back to the prompt
+	fmt.Fprintf(&b, "\x1b[%dA\r%s%s", lines, prompt, string(s.query))
+
+	io.WriteString(w, b.String())
+}
+
+// clear erases the picker from the screen
+func clear(w io.Writer) {
+	io.WriteString(w, "\r\x1b[J")
+}
+
+// Run shows the items in the picker with the given prompt, and returns the item that the
+// user picks. The picker reads the keys from the standard input, and draws on the
+// standard error so that the standard output is left for the command.
+func Run(prompt string, items []Item) (Item, error) {
+	if len(items) == 0 {
+		return Item{}, errors.New("there is nothing to pick from")
+	}
+
+	in := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(in) || !terminal.IsTerminal(int(os.Stderr.Fd())) {
+		return Item{}, ErrNotTerminal
+	}
+
+	width, _, err := terminal.GetSize(int(os.Stderr.Fd()))
+	if err != nil {
+		width = 80
+	}
+
+	oldState, err := terminal.MakeRaw(in)
+	if err != nil {
+		return Item{}, errors.Wrap(err, "setting the terminal to the raw mode")
+	}
+	defer terminal.Restore(in, oldState)
+
+	w := os.Stderr
+	defer clear(w)
+
+	r := bufio.NewReader(os.Stdin)
+	s := newState(items)
+
+	for {
+		render(w, s, prompt, width)
+
+		k, err := readKey(r)
+		if err != nil {
+			return Item{}, errors.Wrap(err, "reading a key")
+		}
+
+		done, item, err := s.handle(k)
+		if err != nil {
+			return Item{}, err
+		}
+		if done {
+			return item, nil
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package picker
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		query    string
+		s        string
+		expected bool
+	}{
+		{query: "", s: "anything", expected: true},
+		{query: "rpl", s: "rpoplpush", expected: true},
+		{query: "RPL", s: "rpoplpush", expected: true},
+		{query: "lpr", s: "rpoplpush", expected: false},
+		{query: "js heap", s: "(3) js: building a heap", expected: true},
+		{query: "xyz", s: "(3) js: building a heap", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query+" in "+tc.s, func(t *testing.T) {
+			_, ok := Match(tc.query, tc.s)
+
+			assert.Equal(t, ok, tc.expected, "match mismatch")
+		})
+	}
+}
+
+func TestMatch_score(t *testing.T) {
+	consecutive, _ := Match("heap", "a heap sort")
+	scattered, _ := Match("heap", "the extra apple")
+	assert.Equal(t, consecutive > scattered, true, "consecutive matches should score higher")
+
+	wordStart, _ := Match("bs", "binary search")
+	midWord, _ := Match("bs", "abstract")
+	assert.Equal(t, wordStart > midWord, true, "matches at the starts of words should score higher")
+}
+
+func TestFilter(t *testing.T) {
+	items := []Item{
+		{ID: 1, Label: "the extra apple"},
+		{ID: 2, Label: "a heap sort"},
+		{ID: 3, Label: "merge sort"},
+		{ID: 4, Label: "heap"},
+	}
+
+	got := Filter(items, "heap")
+	assert.DeepEqual(t, got, []Item{{ID: 2, Label: "a heap sort"}, {ID: 4, Label: "heap"}, {ID: 1, Label: "the extra apple"}}, "result mismatch")
+
+	got = Filter(items, "")
+	assert.DeepEqual(t, got, items, "empty query should keep all items in order")
+}
+
+func TestReadKey(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("aé\x7f\x1b[B\x1b[A\x15\x10\x0e\r\x01\x03"))
+
+	var got []key
+	for i := 0; i < 11; i++ {
+		k, err := readKey(r)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading a key"))
+		}
+
+		got = append(got, k)
+	}
+
+	expected := []key{
+		{kind: keyRune, r: 'a'},
+		{kind: keyRune, r: 'é'},
+		{kind: keyBackspace},
+		{kind: keyDown},
+		{kind: keyUp},
+		{kind: keyClear},
+		{kind: keyUp},
+		{kind: keyDown},
+		{kind: keyEnter},
+		{kind: keyIgnored},
+		{kind: keyCancel},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("keys mismatch. got: %+v, expected: %+v", got, expected)
+	}
+}
+
+func TestReadKey_escape(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\x1b"))
+
+	k, err := readKey(r)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading a key"))
+	}
+
+	assert.Equal(t, k.kind, keyCancel, "kind mismatch")
+}
+
+func TestStateHandle(t *testing.T) {
+	items := []Item{
+		{ID: 1, Label: "merge sort"},
+		{ID: 2, Label: "heap sort"},
+		{ID: 3, Label: "binary search"},
+	}
+
+	t.Run("type and select", func(t *testing.T) {
+		s := newState(items)
+
+		for _, r := range "sort" {
+			if _, _, err := s.handle(key{kind: keyRune, r: r}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		assert.Equal(t, len(s.matches), 2, "match count mismatch")
+
+		s.handle(key{kind: keyDown})
+		s.handle(key{kind: keyDown})
+		assert.Equal(t, s.cursor, 1, "cursor should stop at the last match")
+
+		done, item, err := s.handle(key{kind: keyEnter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, done, true, "done mismatch")
+		assert.Equal(t, item.ID, 2, "selected item mismatch")
+	})
+
+	t.Run("backspace and clear", func(t *testing.T) {
+		s := newState(items)
+
+		s.handle(key{kind: keyRune, r: 'z'})
+		assert.Equal(t, len(s.matches), 0, "match count mismatch")
+
+		done, _, _ := s.handle(key{kind: keyEnter})
+		assert.Equal(t, done, false, "nothing should be selected without a match")
+
+		s.handle(key{kind: keyBackspace})
+		assert.Equal(t, len(s.matches), 3, "match count mismatch after backspace")
+
+		s.handle(key{kind: keyRune, r: 'b'})
+		s.handle(key{kind: keyClear})
+		assert.Equal(t, string(s.query), "", "query mismatch after clear")
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		s := newState(items)
+
+		_, _, err := s.handle(key{kind: keyCancel})
+		assert.Equal(t, err, ErrCancelled, "error mismatch")
+	})
+}
+
+func TestRender(t *testing.T) {
+	var items []Item
+	for i := 1; i <= 12; i++ {
+		items = append(items, Item{ID: i, Label: strings.Repeat("x", i)})
+	}
+	s := newState(items)
+	s.cursor = 11
+
+	var b bytes.Buffer
+	render(&b, s, "note> ", 8)
+
+	got := b.String()
+	assert.Equal(t, strings.Contains(got, "> xxx..."), true, "the selected item should be marked and truncated")
+	assert.Equal(t, strings.Contains(got, "\r\n  x\r\n"), false, "the first item should be scrolled out")
+	assert.Equal(t, strings.Contains(got, "12/12"), true, "the count should be shown")
+	assert.Equal(t, strings.HasSuffix(got, "\rnote> "), true, "the cursor should be left at the prompt")
+}
+
+func TestGetNoteItems(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "n1-uuid", "b1-uuid", "closures\ncapture variables", 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on) VALUES (?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "hoisting", 2, 10)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, deleted) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "", 3, true)
+
+	// execute
+	got, err := getNoteItems(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.DeepEqual(t, got, []Item{
+		{ID: 2, Label: "(2) js: hoisting"},
+		{ID: 1, Label: "(1) js: closures"},
+	}, "items mismatch")
+}
@@ -0,0 +1,169 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package progress reports the progress of long running operations on the terminal
+package progress
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dnote/dnote/pkg/cli/log"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Mode is the way in which the progress is reported
+type Mode int
+
+const (
+	// ModeBar redraws a progress bar with the counts and the estimated time left
+	ModeBar Mode = iota
+	// ModeCounter appends the percentage done at every quarter, for the output
+	// that is not a terminal
+	ModeCounter
+	// ModeNone reports only the total, for when other messages are printed in between
+	ModeNone
+)
+
+const (
+	// barWidth is the number of characters in the progress bar
+	barWidth = 30
+	// redrawInterval is the minimum interval between redrawing the progress bar
+	redrawInterval = 100 * time.Millisecond
+	// counterMinTotal is the minimum total for which the counters are shown
+	counterMinTotal = 20
+)
+
+// IsTerminal returns true if the given file is a terminal
+func IsTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+// Bar reports the progress of an operation on a number of items
+type Bar struct {
+	mode  Mode
+	label string
+	total int
+	count int
+	// percent is the last percentage reported in the counter mode
+	percent  int
+	start    time.Time
+	lastDraw time.Time
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+}
+
+// New starts reporting the progress of the operation with the given label.
+// The total is set later by SetTotal when it is known.
+func New(mode Mode, label string) *Bar {
+	b := &Bar{
+		mode:  mode,
+		label: label,
+		now:   time.Now,
+	}
+
+	log.Infof("%s.", label)
+
+	return b
+}
+
+// SetTotal sets the number of items to be processed and starts the timer for the estimate
+func (b *Bar) SetTotal(total int) {
+	b.total = total
+	b.start = b.now()
+
+	switch b.mode {
+	case ModeBar:
+		b.draw()
+	case ModeCounter:
+		log.Appendf(" (total %d).", total)
+	case ModeNone:
+		// start a new line so that the other messages do not run into the progress
+		log.Appendf(" (total %d).\n", total)
+	}
+}
+
+// Increment reports that an item has been processed
+func (b *Bar) Increment() {
+	b.count++
+
+	switch b.mode {
+	case ModeBar:
+		if b.count == b.total || b.now().Sub(b.lastDraw) >= redrawInterval {
+			b.draw()
+		}
+	case ModeCounter:
+		if b.total < counterMinTotal {
+			return
+		}
+
+		percent := b.count * 100 / b.total / 25 * 25
+		if percent > b.percent && percent < 100 {
+			b.percent = percent
+			log.Appendf(" %d%%..", percent)
+		}
+	}
+}
+
+// Done reports that the operation has finished
+func (b *Bar) Done() {
+	if b.mode == ModeBar {
+		b.count = b.total
+		b.draw()
+	}
+
+	log.Appendf(" done.\n")
+}
+
+// formatETA returns the estimated time left, rounded to seconds
+func (b *Bar) formatETA() string {
+	if b.count == 0 || b.count >= b.total {
+		return ""
+	}
+
+	elapsed := b.now().Sub(b.start)
+	left := time.Duration(int64(elapsed) / int64(b.count) * int64(b.total-b.count))
+
+	return fmt.Sprintf(" ETA %s", left.Round(time.Second))
+}
+
+// render returns the progress bar
+func (b *Bar) render() string {
+	filled := barWidth
+	if b.total > 0 {
+		filled = b.count * barWidth / b.total
+	}
+
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+
+	return fmt.Sprintf("[%s] %d/%d%s", bar, b.count, b.total, b.formatETA())
+}
+
+// draw redraws the progress bar on the current line
+func (b *Bar) draw() {
+	b.lastDraw = b.now()
+
+	// return to the start of the line, and clear the rest of it after drawing
+	log.Appendf("\r")
+	log.Infof("%s. %s\033[K", b.label, b.render())
+}
@@ -0,0 +1,108 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package progress
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/log"
+)
+
+func newTestBar(mode Mode, now *time.Time) *Bar {
+	b := New(mode, "test")
+	b.now = func() time.Time {
+		return *now
+	}
+
+	return b
+}
+
+func TestRender(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	log.SetOutput(&bytes.Buffer{})
+	defer log.SetOutput(os.Stdout)
+
+	b := newTestBar(ModeBar, &now)
+	b.SetTotal(10)
+	assert.Equal(t, b.render(), "[>                             ] 0/10", "render mismatch at the start")
+
+	now = now.Add(3 * time.Second)
+	b.Increment()
+	b.Increment()
+	b.Increment()
+	assert.Equal(t, b.render(), "[=========>                    ] 3/10 ETA 7s", "render mismatch in the middle")
+
+	b.Done()
+	assert.Equal(t, b.render(), "[==============================] 10/10", "render mismatch at the end")
+}
+
+func TestRender_empty(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	log.SetOutput(&bytes.Buffer{})
+	defer log.SetOutput(os.Stdout)
+
+	b := newTestBar(ModeBar, &now)
+	b.SetTotal(0)
+	assert.Equal(t, b.render(), "[==============================] 0/0", "render mismatch")
+}
+
+func TestCounter(t *testing.T) {
+	testCases := []struct {
+		total    int
+		expected string
+	}{
+		{
+			total:    3,
+			expected: " (total 3). done.\n",
+		},
+		{
+			total:    20,
+			expected: " (total 20). 25%.. 50%.. 75%.. done.\n",
+		},
+		{
+			total:    0,
+			expected: " (total 0). done.\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		b := newTestBar(ModeCounter, &now)
+		buf.Reset()
+
+		b.SetTotal(tc.total)
+		for i := 0; i < tc.total; i++ {
+			b.Increment()
+		}
+		b.Done()
+
+		assert.Equal(t, buf.String(), tc.expected, "output mismatch")
+	}
+
+	log.SetOutput(os.Stdout)
+}
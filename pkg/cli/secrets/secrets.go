@@ -0,0 +1,90 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package secrets detects likely secrets, such as API keys, private keys and
+// passwords, in note contents
+package secrets
+
+import (
+	"regexp"
+	"strings"
+)
+
+// rule is a pattern of a kind of secret
+type rule struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+var rules = []rule{
+	{kind: "private key", pattern: regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{kind: "AWS access key", pattern: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "GitHub token", pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{kind: "Slack token", pattern: regexp.MustCompile(`\bxox[aboprs]-[A-Za-z0-9-]{10,}`)},
+	{kind: "Stripe key", pattern: regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{16,}`)},
+	{kind: "Google API key", pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`)},
+	{kind: "JSON web token", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{kind: "credentials in URL", pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:[^\s:/@]+@`)},
+	{kind: "password", pattern: regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token)\b["']?\s*[:=]\s*["']?[^\s"']{6,}`)},
+}
+
+// Finding is a likely secret found in a text
+type Finding struct {
+	// Line is the 1-based line number of the secret
+	Line int
+	// Kind describes what kind of secret it is
+	Kind string
+	// Excerpt is the redacted match
+	Excerpt string
+}
+
+// redact hides all but the first few characters of the match so that the secret
+// itself is not printed on the screen
+func redact(s string) string {
+	const visible = 6
+
+	r := []rune(s)
+	if len(r) <= visible {
+		return s
+	}
+
+	return string(r[:visible]) + strings.Repeat("*", 6)
+}
+
+// Scan returns the likely secrets in the text. At most one finding is reported for each line.
+func Scan(text string) []Finding {
+	ret := []Finding{}
+
+	for idx, line := range strings.Split(text, "\n") {
+		for _, r := range rules {
+			match := r.pattern.FindString(line)
+			if match == "" {
+				continue
+			}
+
+			ret = append(ret, Finding{
+				Line:    idx + 1,
+				Kind:    r.kind,
+				Excerpt: redact(match),
+			})
+			break
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,104 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package spell provides a spell checker for note contents with pluggable dictionaries
+package spell
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Dictionary is a set of correctly spelled words in a language
+type Dictionary interface {
+	Contains(word string) bool
+}
+
+// WordList is a dictionary backed by a list of words
+type WordList map[string]bool
+
+// NewWordList returns a new WordList containing the given words
+func NewWordList(words []string) WordList {
+	ret := WordList{}
+	for _, w := range words {
+		ret[w] = true
+	}
+
+	return ret
+}
+
+// Contains checks if the word is in the list. A capitalized word is also
+// accepted if its lowercase form is in the list.
+func (l WordList) Contains(word string) bool {
+	if l[word] {
+		return true
+	}
+
+	return l[strings.ToLower(word)]
+}
+
+// ReadWordList reads a word list with one word per line. Hunspell dictionaries
+// are supported by ignoring the word count on the first line and the affix
+// flags following a slash.
+func ReadWordList(r io.Reader) (WordList, error) {
+	ret := WordList{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if idx := strings.Index(line, "/"); idx != -1 {
+			line = line[:idx]
+		}
+		if line == "" || isNumeric(line) {
+			continue
+		}
+
+		ret[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanning")
+	}
+
+	return ret, nil
+}
+
+// LoadWordList reads a word list from the file at the given path
+func LoadWordList(path string) (WordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	return ReadWordList(f)
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return true
+}
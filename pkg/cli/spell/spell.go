@@ -0,0 +1,121 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package spell
+
+import (
+	"strings"
+	"unicode"
+)
+
+// codeFence is the delimiter of a fenced code block in Markdown
+const codeFence = "```"
+
+// Misspelling is a word that is not in the dictionary
+type Misspelling struct {
+	// Line is the 1-based line number of the word
+	Line int
+	Word string
+}
+
+// stripCodeSpans removes the inline code spans enclosed in backticks from a line
+func stripCodeSpans(line string) string {
+	var b strings.Builder
+
+	inCode := false
+	for _, r := range line {
+		if r == '`' {
+			inCode = !inCode
+			continue
+		}
+		if !inCode {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// isCheckable reports whether a whitespace separated field should be spell checked.
+// Links, email addresses, paths and fields containing numbers are skipped.
+func isCheckable(field string) bool {
+	if strings.Contains(field, "://") || strings.HasPrefix(field, "www.") {
+		return false
+	}
+	if strings.ContainsAny(field, "@/\\_") {
+		return false
+	}
+
+	for _, r := range field {
+		if unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitWords splits a field into words made of letters and inner apostrophes
+func splitWords(field string) []string {
+	words := strings.FieldsFunc(field, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	ret := []string{}
+	for _, w := range words {
+		w = strings.Trim(w, "'")
+
+		// Single letters are not meaningful to spell check
+		if len([]rune(w)) > 1 {
+			ret = append(ret, w)
+		}
+	}
+
+	return ret
+}
+
+// Check returns the words in the text that are not in the dictionary. The contents
+// of Markdown code blocks and code spans are ignored.
+func Check(text string, dict Dictionary) []Misspelling {
+	ret := []Misspelling{}
+
+	inCodeBlock := false
+	for idx, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), codeFence) {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+
+		for _, field := range strings.Fields(stripCodeSpans(line)) {
+			if !isCheckable(field) {
+				continue
+			}
+
+			for _, word := range splitWords(field) {
+				if !dict.Contains(word) {
+					ret = append(ret, Misspelling{Line: idx + 1, Word: word})
+				}
+			}
+		}
+	}
+
+	return ret
+}
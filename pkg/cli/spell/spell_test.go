@@ -0,0 +1,84 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package spell
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestReadWordList(t *testing.T) {
+	r := strings.NewReader("3\nhello/MS\nworld\n\nDnote\n")
+
+	got, err := ReadWordList(r)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	assert.DeepEqual(t, got, WordList{"hello": true, "world": true, "Dnote": true}, "result mismatch")
+}
+
+func TestWordListContains(t *testing.T) {
+	l := NewWordList([]string{"hello", "Dnote"})
+
+	assert.Equal(t, l.Contains("hello"), true, "hello mismatch")
+	assert.Equal(t, l.Contains("Hello"), true, "Hello mismatch")
+	assert.Equal(t, l.Contains("Dnote"), true, "Dnote mismatch")
+	assert.Equal(t, l.Contains("dnote"), false, "dnote mismatch")
+	assert.Equal(t, l.Contains("world"), false, "world mismatch")
+}
+
+func TestCheck(t *testing.T) {
+	dict := NewWordList([]string{"the", "quick", "brown", "fox", "don't", "see", "run", "or"})
+
+	testCases := []struct {
+		text     string
+		expected []Misspelling
+	}{
+		{
+			text:     "The quick brown fox.",
+			expected: []Misspelling{},
+		},
+		{
+			text: "The quikc brown fox\ndon't jumpp",
+			expected: []Misspelling{
+				{Line: 1, Word: "quikc"},
+				{Line: 2, Word: "jumpp"},
+			},
+		},
+		{
+			text:     "run `git loggg`\n```\nfmt.Printlnn()\n```\nsee https://www.getdnote.com or me@exampl.com",
+			expected: []Misspelling{},
+		},
+		{
+			text:     "the fox (a) ran 3rd",
+			expected: []Misspelling{{Line: 1, Word: "ran"}},
+		},
+	}
+
+	for idx, tc := range testCases {
+		got := Check(tc.text, dict)
+
+		assert.DeepEqual(t, got, tc.expected, fmt.Sprintf("result mismatch for test case %d", idx))
+	}
+}
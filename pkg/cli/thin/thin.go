@@ -0,0 +1,154 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package thin implements the thin mode, in which only the recently accessed
+// note bodies are kept locally and the others are fetched from the server on demand
+package thin
+
+import (
+	"database/sql"
+
+	"github.com/dnote/dnote/pkg/cli/client"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// fetch downloads the body of the evicted note with the given uuid from the server
+func fetch(ctx context.DnoteCtx, uuid string) error {
+	if ctx.SessionKey == "" {
+		return errors.New("the note is not stored locally in the thin mode. Please log in to fetch it from the server")
+	}
+
+	resp, err := client.GetNote(ctx, uuid)
+	if client.IsOffline(err) {
+		return errors.Errorf("the note %s is not stored locally in the thin mode, and cannot be fetched while offline", uuid)
+	} else if err != nil {
+		return errors.Wrapf(err, "fetching the note %s from the server", uuid)
+	}
+
+	if _, err := ctx.DB.Exec("UPDATE notes SET body = ?, evicted = ? WHERE uuid = ? AND evicted = ?", resp.Body, false, uuid, true); err != nil {
+		return errors.Wrapf(err, "saving the body of the note %s", uuid)
+	}
+
+	return nil
+}
+
+// EnsureBody fetches the body of the note with the given rowid from the server if it
+// has been evicted. It does nothing if the note does not exist, leaving it to the caller
+// to handle.
+func EnsureBody(ctx context.DnoteCtx, rowID int) error {
+	var uuid string
+	var evicted bool
+	err := ctx.DB.QueryRow("SELECT uuid, evicted FROM notes WHERE rowid = ?", rowID).Scan(&uuid, &evicted)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "querying the note")
+	}
+
+	if !evicted {
+		return nil
+	}
+
+	return fetch(ctx, uuid)
+}
+
+// EnsureBodies fetches the evicted bodies of the notes in the book with the given uuid,
+// or of all notes if the book uuid is empty. It returns the number of the bodies fetched.
+func EnsureBodies(ctx context.DnoteCtx, bookUUID string) (int, error) {
+	query := "SELECT uuid FROM notes WHERE evicted = ?"
+	args := []interface{}{true}
+	if bookUUID != "" {
+		query += " AND book_uuid = ?"
+		args = append(args, bookUUID)
+	}
+
+	rows, err := ctx.DB.Query(query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "querying evicted notes")
+	}
+
+	uuids := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			rows.Close()
+			return 0, errors.Wrap(err, "scanning a note uuid")
+		}
+
+		uuids = append(uuids, uuid)
+	}
+	rows.Close()
+
+	for _, uuid := range uuids {
+		if err := fetch(ctx, uuid); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(uuids), nil
+}
+
+// Evict removes the bodies of the notes that were accessed least recently, so that at
+// most cacheSize bodies are kept. The bodies of the notes that have not been uploaded
+// to the server are never removed. It returns the number of the bodies removed.
+func Evict(db *database.DB, cacheSize int) (int, error) {
+	res, err := db.Exec(`UPDATE notes SET body = ?, evicted = ?
+		WHERE evicted = ? AND dirty = ? AND deleted = ? AND usn > 0
+		AND uuid NOT IN (
+			SELECT uuid FROM notes WHERE deleted = ?
+			ORDER BY max(coalesce(last_viewed_on, 0), coalesce(edited_on, 0), added_on) DESC
+			LIMIT ?
+		)`, "", true, false, false, false, false, cacheSize)
+	if err != nil {
+		return 0, errors.Wrap(err, "evicting note bodies")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "counting the evicted note bodies")
+	}
+
+	return int(count), nil
+}
+
+// Update applies the thin mode setting. If the thin mode is enabled, it evicts the bodies
+// beyond the cache size. Otherwise, it fetches back the evicted bodies, if any.
+func Update(ctx context.DnoteCtx) error {
+	if ctx.Thin.Enabled {
+		count, err := Evict(ctx.DB, ctx.Thin.CacheSize)
+		if err != nil {
+			return err
+		}
+
+		log.Debug("evicted %d note bodies\n", count)
+		return nil
+	}
+
+	count, err := EnsureBodies(ctx, "")
+	if err != nil {
+		return errors.Wrap(err, "fetching the evicted note bodies")
+	}
+	if count > 0 {
+		log.Infof("fetched %d notes that were not stored locally in the thin mode\n", count)
+	}
+
+	return nil
+}
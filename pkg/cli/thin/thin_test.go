@@ -0,0 +1,120 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package thin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/context"
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/dnote/dnote/pkg/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+var paths = context.Paths{
+	Home:   "../tmp",
+	Cache:  "../tmp",
+	Config: "../tmp",
+	Data:   "../tmp",
+}
+
+func TestEvict(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../tmp/dnote-test.db", nil)
+	defer database.TeardownTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	// n1 was viewed recently, n2 was edited recently, n3 is old, n4 is old but not uploaded yet
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, last_viewed_on, usn) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1, 100, 1)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn) VALUES (?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 2, 90, 2)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn) VALUES (?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "n3 body", 3, 3)
+	database.MustExec(t, "inserting n4", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, dirty) VALUES (?, ?, ?, ?, ?, ?)", "n4-uuid", "b1-uuid", "n4 body", 4, 0, true)
+
+	// execute
+	count, err := Evict(db, 2)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "evicting"))
+	}
+
+	// test
+	assert.Equal(t, count, 1, "evicted count mismatch")
+
+	testCases := []struct {
+		uuid            string
+		expectedBody    string
+		expectedEvicted bool
+	}{
+		{uuid: "n1-uuid", expectedBody: "n1 body", expectedEvicted: false},
+		{uuid: "n2-uuid", expectedBody: "n2 body", expectedEvicted: false},
+		{uuid: "n3-uuid", expectedBody: "", expectedEvicted: true},
+		{uuid: "n4-uuid", expectedBody: "n4 body", expectedEvicted: false},
+	}
+
+	for _, tc := range testCases {
+		var body string
+		var evicted bool
+		database.MustScan(t, "getting the note", db.QueryRow("SELECT body, evicted FROM notes WHERE uuid = ?", tc.uuid), &body, &evicted)
+		assert.Equal(t, body, tc.expectedBody, tc.uuid+" body mismatch")
+		assert.Equal(t, evicted, tc.expectedEvicted, tc.uuid+" evicted mismatch")
+	}
+}
+
+func TestEnsureBody(t *testing.T) {
+	// set up
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/notes/n1-uuid" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"uuid": "n1-uuid", "content": "n1 body"}); err != nil {
+			t.Fatal(errors.Wrap(err, "encoding the response"))
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.InitTestCtx(t, paths, nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+	ctx.APIEndpoint = ts.URL
+
+	db := ctx.DB
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "b1-uuid", "js")
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, evicted) VALUES (?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "", 1, 1, true)
+
+	var rowID int
+	database.MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", "n1-uuid"), &rowID)
+
+	// execute
+	if err := EnsureBody(ctx, rowID); err != nil {
+		t.Fatal(errors.Wrap(err, "ensuring the body"))
+	}
+
+	// test
+	var body string
+	var evicted bool
+	database.MustScan(t, "getting the note", db.QueryRow("SELECT body, evicted FROM notes WHERE uuid = ?", "n1-uuid"), &body, &evicted)
+	assert.Equal(t, body, "n1 body", "body mismatch")
+	assert.Equal(t, evicted, false, "evicted mismatch")
+}
@@ -24,29 +24,116 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
-	"github.com/dnote/dnote/pkg/cli/utils"
 	"github.com/pkg/errors"
 )
 
-// GetTmpContentPath returns the path to the temporary file containing
-// content being added or edited
-func GetTmpContentPath(ctx context.DnoteCtx) (string, error) {
-	for i := 0; ; i++ {
-		filename := fmt.Sprintf("%s_%d.%s", consts.TmpContentFileBase, i, consts.TmpContentFileExt)
-		candidate := fmt.Sprintf("%s/%s", ctx.Paths.Cache, filename)
+// getTmpContentSuffix returns the suffix of the temporary content file
+func getTmpContentSuffix(ctx context.DnoteCtx) string {
+	if ctx.EditorOptions.FileSuffix != "" {
+		return ctx.EditorOptions.FileSuffix
+	}
+
+	return "." + consts.TmpContentFileExt
+}
+
+// staleTmpContentAge is the age after which a temporary content file left behind by a
+// session that was killed is removed
+const staleTmpContentAge = 24 * time.Hour
+
+// getTmpDir returns the private directory for the temporary content files. A directory
+// for the current user is made in the configured directory, such as a ramdisk, so that
+// the directory itself can be shared.
+func getTmpDir(ctx context.DnoteCtx) string {
+	if ctx.EditorOptions.TmpDir != "" {
+		return filepath.Join(ctx.EditorOptions.TmpDir, fmt.Sprintf("dnote-%d", os.Getuid()))
+	}
+
+	return filepath.Join(ctx.Paths.Data, consts.DnoteDirName, consts.TmpDirName)
+}
+
+// ensureTmpDir creates the private directory for the temporary content files if it does
+// not exist, and makes it accessible only by the current user
+func ensureTmpDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "creating %s", dir)
+	}
+
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return errors.Wrapf(err, "checking %s", dir)
+	}
+	if !fi.IsDir() {
+		return errors.Errorf("%s is not a directory", dir)
+	}
+
+	// the directory may have been created with looser permissions, or by another user,
+	// in which case it cannot be changed
+	if err := os.Chmod(dir, 0700); err != nil {
+		return errors.Wrapf(err, "making %s private", dir)
+	}
 
-		ok, err := utils.FileExists(candidate)
+	return nil
+}
+
+// removeStaleTmpContent removes the temporary content files in the given directory that
+// were last modified before the given time
+func removeStaleTmpContent(dir string, before time.Time) error {
+	matches, err := filepath.Glob(filepath.Join(dir, consts.TmpContentFileBase+"_*"))
+	if err != nil {
+		return errors.Wrap(err, "listing the temporary content files")
+	}
+
+	for _, path := range matches {
+		fi, err := os.Lstat(path)
 		if err != nil {
-			return "", errors.Wrapf(err, "checking if file exists at %s", candidate)
+			continue
 		}
-		if !ok {
-			return candidate, nil
+
+		if fi.ModTime().Before(before) {
+			if err := os.Remove(path); err != nil {
+				return errors.Wrapf(err, "removing %s", path)
+			}
 		}
 	}
+
+	return nil
+}
+
+// CreateTmpContentFile creates a temporary file with the given content for editing in
+// the editor, and returns its path. The file has a unique name and is readable only by
+// the current user. It is removed by GetEditorInput.
+func CreateTmpContentFile(ctx context.DnoteCtx, content []byte) (string, error) {
+	dir := getTmpDir(ctx)
+	if err := ensureTmpDir(dir); err != nil {
+		return "", errors.Wrap(err, "preparing the temporary directory")
+	}
+	if err := removeStaleTmpContent(dir, time.Now().Add(-staleTmpContentAge)); err != nil {
+		return "", errors.Wrap(err, "removing the stale temporary content files")
+	}
+
+	f, err := ioutil.TempFile(dir, fmt.Sprintf("%s_*%s", consts.TmpContentFileBase, getTmpContentSuffix(ctx)))
+	if err != nil {
+		return "", errors.Wrap(err, "creating a temporary content file")
+	}
+
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", errors.Wrap(err, "writing the temporary content file")
+	}
+
+	return f.Name(), nil
 }
 
 // getEditorCommand returns the system's editor command with appropriate flags,
@@ -80,28 +167,58 @@ func getEditorCommand() string {
 
 func newEditorCmd(ctx context.DnoteCtx, fpath string) (*exec.Cmd, error) {
 	args := strings.Fields(ctx.Editor)
+	args = append(args, ctx.EditorOptions.Args...)
 	args = append(args, fpath)
 
 	return exec.Command(args[0], args[1:]...), nil
 }
 
-// GetEditorInput gets the user input by launching a text editor and waiting for
-// it to exit
-func GetEditorInput(ctx context.DnoteCtx, fpath string) (string, error) {
-	ok, err := utils.FileExists(fpath)
-	if err != nil {
-		return "", errors.Wrapf(err, "checking if the file exists at %s", fpath)
+// runEditor runs the given editor command until it exits. An interrupt is left to the
+// editor, which receives it from the terminal as well, while the other signals to
+// terminate are passed on to the editor and make it an error.
+func runEditor(cmd *exec.Cmd) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "launching an editor")
 	}
-	if !ok {
-		f, err := os.Create(fpath)
-		if err != nil {
-			return "", errors.Wrap(err, "creating a temporary content file")
-		}
-		err = f.Close()
-		if err != nil {
-			return "", errors.Wrap(err, "closing the temporary content file")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var received os.Signal
+	for {
+		select {
+		case s := <-sig:
+			if s == os.Interrupt {
+				continue
+			}
+
+			received = s
+			cmd.Process.Signal(s)
+		case err := <-done:
+			if received != nil {
+				return errors.Errorf("stopped by %s", received)
+			}
+			if err != nil {
+				return errors.Wrap(err, "waiting for the editor")
+			}
+
+			return nil
 		}
 	}
+}
+
+// GetEditorInput gets the user input by launching a text editor on the temporary content
+// file at the given path and waiting for it to exit. The file is read by its path after
+// the editor exits, as the editors may save by renaming a new file over it, and is
+// removed in any case.
+func GetEditorInput(ctx context.DnoteCtx, fpath string) (string, error) {
+	defer os.Remove(fpath)
 
 	cmd, err := newEditorCmd(ctx, fpath)
 	if err != nil {
@@ -112,14 +229,8 @@ func GetEditorInput(ctx context.DnoteCtx, fpath string) (string, error) {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	err = cmd.Start()
-	if err != nil {
-		return "", errors.Wrapf(err, "launching an editor")
-	}
-
-	err = cmd.Wait()
-	if err != nil {
-		return "", errors.Wrap(err, "waiting for the editor")
+	if err := runEditor(cmd); err != nil {
+		return "", err
 	}
 
 	b, err := ioutil.ReadFile(fpath)
@@ -127,11 +238,6 @@ func GetEditorInput(ctx context.DnoteCtx, fpath string) (string, error) {
 		return "", errors.Wrap(err, "reading the temporary content file")
 	}
 
-	err = os.Remove(fpath)
-	if err != nil {
-		return "", errors.Wrap(err, "removing the temporary content file")
-	}
-
 	raw := string(b)
 
 	return raw, nil
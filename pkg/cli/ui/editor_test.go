@@ -20,80 +20,156 @@ package ui
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/cli/consts"
 	"github.com/dnote/dnote/pkg/cli/context"
 	"github.com/pkg/errors"
 )
 
-func TestGetTmpContentPath(t *testing.T) {
-	t.Run("no collision", func(t *testing.T) {
+func TestCreateTmpContentFile(t *testing.T) {
+	t.Run("default directory", func(t *testing.T) {
 		ctx := context.InitTestCtx(t, context.Paths{
 			Data:  "../tmp",
 			Cache: "../tmp",
 		}, nil)
 		defer context.TeardownTestCtx(t, ctx)
 
-		res, err := GetTmpContentPath(ctx)
+		p1, err := CreateTmpContentFile(ctx, []byte("foo"))
 		if err != nil {
 			t.Fatal(errors.Wrap(err, "executing"))
 		}
+		p2, err := CreateTmpContentFile(ctx, nil)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		dir := filepath.Join(ctx.Paths.Data, consts.DnoteDirName, consts.TmpDirName)
+		assert.Equal(t, filepath.Dir(p1), dir, "directory mismatch")
+		assert.Equal(t, strings.HasPrefix(filepath.Base(p1), "DNOTE_TMPCONTENT_"), true, "file name should have the prefix")
+		assert.Equal(t, strings.HasSuffix(p1, ".md"), true, "file name should have the suffix")
+		assert.NotEqual(t, p1, p2, "file names should be unique")
+
+		b, err := ioutil.ReadFile(p1)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the file"))
+		}
+		assert.Equal(t, string(b), "foo", "content mismatch")
 
-		expected := fmt.Sprintf("%s/%s", ctx.Paths.Cache, "DNOTE_TMPCONTENT_0.md")
-		assert.Equal(t, res, expected, "filename did not match")
+		if runtime.GOOS != "windows" {
+			fi, err := os.Stat(p1)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "checking the file"))
+			}
+			assert.Equal(t, fi.Mode().Perm(), os.FileMode(0600), "file permission mismatch")
+
+			di, err := os.Stat(dir)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "checking the directory"))
+			}
+			assert.Equal(t, di.Mode().Perm(), os.FileMode(0700), "directory permission mismatch")
+		}
 	})
 
-	t.Run("one existing session", func(t *testing.T) {
-		// set up
+	t.Run("custom directory and suffix", func(t *testing.T) {
 		ctx := context.InitTestCtx(t, context.Paths{
 			Data:  "../tmp2",
 			Cache: "../tmp2",
 		}, nil)
 		defer context.TeardownTestCtx(t, ctx)
 
-		p := fmt.Sprintf("%s/%s", ctx.Paths.Cache, "DNOTE_TMPCONTENT_0.md")
-		if _, err := os.Create(p); err != nil {
-			t.Fatal(errors.Wrap(err, "preparing the conflicting file"))
-		}
+		ctx.EditorOptions.TmpDir = filepath.Join(ctx.Paths.Data, "ramdisk")
+		ctx.EditorOptions.FileSuffix = ".markdown"
 
-		// execute
-		res, err := GetTmpContentPath(ctx)
+		p, err := CreateTmpContentFile(ctx, nil)
 		if err != nil {
 			t.Fatal(errors.Wrap(err, "executing"))
 		}
 
-		// test
-		expected := fmt.Sprintf("%s/%s", ctx.Paths.Cache, "DNOTE_TMPCONTENT_1.md")
-		assert.Equal(t, res, expected, "filename did not match")
+		assert.Equal(t, filepath.Dir(p), filepath.Join(ctx.EditorOptions.TmpDir, fmt.Sprintf("dnote-%d", os.Getuid())), "directory mismatch")
+		assert.Equal(t, strings.HasSuffix(p, ".markdown"), true, "file name should have the suffix")
 	})
 
-	t.Run("two existing sessions", func(t *testing.T) {
-		// set up
+	t.Run("stale files", func(t *testing.T) {
 		ctx := context.InitTestCtx(t, context.Paths{
 			Data:  "../tmp3",
 			Cache: "../tmp3",
 		}, nil)
 		defer context.TeardownTestCtx(t, ctx)
 
-		p1 := fmt.Sprintf("%s/%s", ctx.Paths.Cache, "DNOTE_TMPCONTENT_0.md")
-		if _, err := os.Create(p1); err != nil {
-			t.Fatal(errors.Wrap(err, "preparing the conflicting file"))
+		p1, err := CreateTmpContentFile(ctx, nil)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "preparing a stale file"))
 		}
-		p2 := fmt.Sprintf("%s/%s", ctx.Paths.Cache, "DNOTE_TMPCONTENT_1.md")
-		if _, err := os.Create(p2); err != nil {
-			t.Fatal(errors.Wrap(err, "preparing the conflicting file"))
+		old := time.Now().Add(-staleTmpContentAge - time.Hour)
+		if err := os.Chtimes(p1, old, old); err != nil {
+			t.Fatal(errors.Wrap(err, "aging the file"))
 		}
-
-		// execute
-		res, err := GetTmpContentPath(ctx)
+		p2, err := CreateTmpContentFile(ctx, nil)
 		if err != nil {
+			t.Fatal(errors.Wrap(err, "preparing a recent file"))
+		}
+
+		if _, err := CreateTmpContentFile(ctx, nil); err != nil {
 			t.Fatal(errors.Wrap(err, "executing"))
 		}
 
-		// test
-		expected := fmt.Sprintf("%s/%s", ctx.Paths.Cache, "DNOTE_TMPCONTENT_2.md")
-		assert.Equal(t, res, expected, "filename did not match")
+		_, err = os.Stat(p1)
+		assert.Equal(t, os.IsNotExist(err), true, "the stale file should be removed")
+		_, err = os.Stat(p2)
+		assert.Equal(t, err, nil, "the recent file should be kept")
 	})
 }
+
+func TestGetEditorInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editor is a shell script")
+	}
+
+	ctx := context.InitTestCtx(t, context.Paths{
+		Data:  "../tmp",
+		Cache: "../tmp",
+	}, nil)
+	defer context.TeardownTestCtx(t, ctx)
+
+	// save by renaming a new file over the temporary file, like some editors
+	ctx.Editor = "sh"
+	ctx.EditorOptions.Args = []string{"-c", `printf bar > "$0.new" && mv "$0.new" "$0"`}
+
+	p, err := CreateTmpContentFile(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "preparing the file"))
+	}
+
+	got, err := GetEditorInput(ctx, p)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	assert.Equal(t, got, "bar", "content mismatch")
+	_, err = os.Stat(p)
+	assert.Equal(t, os.IsNotExist(err), true, "the file should be removed")
+}
+
+func TestNewEditorCmd(t *testing.T) {
+	ctx := context.DnoteCtx{
+		Editor: "code -w",
+		EditorOptions: context.EditorOptions{
+			Args: []string{"--new-window"},
+		},
+	}
+
+	cmd, err := newEditorCmd(ctx, "/tmp/note.md")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	assert.DeepEqual(t, cmd.Args, []string{"code", "-w", "--new-window", "/tmp/note.md"}, "args mismatch")
+}
@@ -30,6 +30,17 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// IsPiped returns true if the given file is a pipe or a regular file, rather than
+// a terminal or a device such as /dev/null
+func IsPiped(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice == 0
+}
+
 func readInput() (string, error) {
 	reader := bufio.NewReader(os.Stdin)
 	input, err := reader.ReadString('\n')
@@ -71,6 +82,41 @@ func PromptPassword(message string, dest *string) error {
 	return nil
 }
 
+// ErrNotTerminal is an error for when a key cannot be read because there is no terminal
+var ErrNotTerminal = errors.New("not a terminal")
+
+// PromptKey prompts the user to press a key and returns it without waiting for the
+// enter key. The key is read from the terminal even if the standard input is piped.
+func PromptKey(message string) (rune, error) {
+	f := os.Stdin
+	if !terminal.IsTerminal(int(f.Fd())) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return 0, ErrNotTerminal
+		}
+		defer tty.Close()
+
+		f = tty
+	}
+
+	log.Askf(message, false)
+
+	fd := int(f.Fd())
+	oldState, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return 0, errors.Wrap(err, "setting the terminal to the raw mode")
+	}
+
+	r, _, err := bufio.NewReader(f).ReadRune()
+	terminal.Restore(fd, oldState)
+	fmt.Println("")
+	if err != nil {
+		return 0, errors.Wrap(err, "reading a key")
+	}
+
+	return r, nil
+}
+
 // Confirm prompts for user input to confirm a choice
 func Confirm(question string, optimistic bool) (bool, error) {
 	var choices string
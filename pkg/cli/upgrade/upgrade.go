@@ -20,7 +20,6 @@ package upgrade
 
 import (
 	stdCtx "context"
-	"fmt"
 	"strings"
 	"time"
 
@@ -125,7 +124,7 @@ func Check(ctx context.DnoteCtx) error {
 		return errors.Wrap(err, "updating the last upgrade timestamp")
 	}
 
-	fmt.Printf("\n")
+	log.Appendf("\n")
 	willCheck, err := ui.Confirm("check for upgrade?", true)
 	if err != nil {
 		return errors.Wrap(err, "getting user confirmation")
@@ -0,0 +1,98 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidTime is an error for a time in an unsupported format
+var ErrInvalidTime = errors.New("invalid time")
+
+// ParseTime parses a time given by the user either as a date such as 2020-03-14 in the
+// local time zone, or as a time in RFC3339. It reports whether the value was a date, in
+// which case the returned time is the beginning of the day.
+func ParseTime(val string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", val, time.Local); err == nil {
+		return t, true, nil
+	}
+
+	return time.Time{}, false, ErrInvalidTime
+}
+
+// parseOffset parses a duration given by the user such as 12h, 7d or 2w, and returns the
+// time that is the duration away from the given time in the given direction
+func parseOffset(val string, now time.Time, sign int) (time.Time, bool) {
+	if len(val) < 2 {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.Atoi(val[:len(val)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+
+	n = n * sign
+	switch val[len(val)-1] {
+	case 'h':
+		return now.Add(time.Duration(n) * time.Hour), true
+	case 'd':
+		return now.AddDate(0, 0, n), true
+	case 'w':
+		return now.AddDate(0, 0, 7*n), true
+	}
+
+	return time.Time{}, false
+}
+
+// ParseSince parses the start of a period given by the user either as a duration before
+// the given time, such as 12h, 7d or 2w, or as a date or a time accepted by ParseTime.
+func ParseSince(val string, now time.Time) (time.Time, error) {
+	if t, ok := parseOffset(val, now, -1); ok {
+		return t, nil
+	}
+
+	t, _, err := ParseTime(val)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t, nil
+}
+
+// ParseUntil parses the end of a period given by the user either as a duration after
+// the given time, such as 12h, 3d or 2w, or as a date or a time accepted by ParseTime.
+func ParseUntil(val string, now time.Time) (time.Time, error) {
+	if t, ok := parseOffset(val, now, 1); ok {
+		return t, nil
+	}
+
+	t, _, err := ParseTime(val)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t, nil
+}
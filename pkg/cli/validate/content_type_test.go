@@ -0,0 +1,66 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+)
+
+func TestValidateContentType(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected error
+	}{
+		{
+			input:    "markdown",
+			expected: nil,
+		},
+		{
+			input:    "plaintext",
+			expected: nil,
+		},
+		{
+			input:    "code",
+			expected: nil,
+		},
+		{
+			input:    "",
+			expected: ErrContentTypeInvalid,
+		},
+		{
+			input:    "Markdown",
+			expected: ErrContentTypeInvalid,
+		},
+		{
+			input:    "html",
+			expected: ErrContentTypeInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("validate %s", tc.input), func(t *testing.T) {
+			actual := ContentType(tc.input)
+
+			assert.Equal(t, actual, tc.expected, "result mismatch")
+		})
+	}
+}
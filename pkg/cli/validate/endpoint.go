@@ -0,0 +1,63 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// ErrAPIEndpointInvalid is an error for an API endpoint that is not an absolute HTTP URL
+var ErrAPIEndpointInvalid = errors.New("The API endpoint must be an http or https URL such as 'https://dnote.example.com/api'")
+
+// APIEndpoint validates the URL of the API of a dnote server
+func APIEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ErrAPIEndpointInvalid
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrAPIEndpointInvalid
+	}
+	if u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return ErrAPIEndpointInvalid
+	}
+
+	return nil
+}
+
+// ErrWebhookURLInvalid is an error for a webhook URL that is not an http or https URL
+var ErrWebhookURLInvalid = errors.New("The webhook must be an http or https URL such as 'https://hooks.example.com/dnote'")
+
+// WebhookURL validates the URL to which the events are posted. Unlike the API endpoint,
+// it can carry a query string, in which some services put their tokens.
+func WebhookURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ErrWebhookURLInvalid
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrWebhookURLInvalid
+	}
+
+	return nil
+}
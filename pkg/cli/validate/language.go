@@ -0,0 +1,41 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLanguageInvalid is an error for a language tag that is not well-formed
+var ErrLanguageInvalid = errors.New("The language must be a tag such as 'en' or 'en-US'")
+
+// regexLanguage matches a language tag consisting of a primary language subtag
+// followed by optional subtags, such as 'en', 'pt-BR', or 'zh-Hant-TW'
+var regexLanguage = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// Language validates a language tag
+func Language(tag string) error {
+	if !regexLanguage.MatchString(tag) {
+		return ErrLanguageInvalid
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrMetadataKeyEmpty is an error for an empty metadata key
+	ErrMetadataKeyEmpty = errors.New("The metadata key is empty")
+	// ErrMetadataKeyInvalid is an error for a metadata key that cannot be written in a search query
+	ErrMetadataKeyInvalid = errors.New("The metadata key cannot contain a space, '=' or ':'")
+)
+
+// MetadataKey validates a key of the note metadata. The key is written as 'meta:key=value'
+// to find the notes, so it cannot contain the separators.
+func MetadataKey(key string) error {
+	if key == "" {
+		return ErrMetadataKeyEmpty
+	}
+	if strings.ContainsAny(key, " \t\r\n=:") {
+		return ErrMetadataKeyInvalid
+	}
+
+	return nil
+}
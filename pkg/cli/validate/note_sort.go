@@ -0,0 +1,40 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"strings"
+
+	"github.com/dnote/dnote/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+// ErrNoteSortInvalid is an error for an unknown order of the notes
+var ErrNoteSortInvalid = errors.Errorf("The sort must be one of %s", strings.Join(database.NoteSorts, ", "))
+
+// NoteSort validates an order in which the notes in a book are listed
+func NoteSort(sort string) error {
+	for _, s := range database.NoteSorts {
+		if sort == s {
+			return nil
+		}
+	}
+
+	return ErrNoteSortInvalid
+}
@@ -0,0 +1,38 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoteTitleMultiline is an error for a note title that spans multiple lines
+var ErrNoteTitleMultiline = errors.New("The title must be a single line")
+
+// NoteTitle validates a note title. An empty title is valid, and means that the title
+// is inferred from the content.
+func NoteTitle(title string) error {
+	if strings.ContainsAny(title, "\r\n") {
+		return ErrNoteTitleMultiline
+	}
+
+	return nil
+}
@@ -123,6 +123,61 @@ func (a *API) getNote(w http.ResponseWriter, r *http.Request) {
 	respondWithNote(w, note)
 }
 
+/**** getListedNotesHandler */
+
+// getListedNotes responds with the notes that the given user listed on their profile. The
+// unlisted notes are visible only to those who have their links.
+func (a *API) getListedNotes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userUUID := vars["userUUID"]
+
+	if !helpers.ValidateUUID(userUUID) {
+		handlers.RespondNotFound(w)
+		return
+	}
+
+	var page int
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		p, err := strconv.Atoi(pageStr)
+		if err != nil || p < 1 {
+			http.Error(w, fmt.Sprintf("invalid page %s", pageStr), http.StatusBadRequest)
+			return
+		}
+
+		page = p
+	} else {
+		page = 1
+	}
+
+	conn := a.App.DB.Model(database.Note{}).
+		Where("notes.user_id = (SELECT id FROM users WHERE uuid = ?)", userUUID).
+		Where("notes.visibility = ? AND notes.deleted = ?", database.NoteVisibilityPublic, false)
+
+	var total int
+	if err := conn.Count(&total).Error; err != nil {
+		handlers.DoError(w, "counting total", err, http.StatusInternalServerError)
+		return
+	}
+
+	notes := []database.Note{}
+	if total != 0 {
+		conn = orderGetNotes(conn)
+		conn = database.PreloadNote(conn)
+		conn = paginate(conn, page)
+
+		if err := conn.Find(&notes).Error; err != nil {
+			handlers.DoError(w, "finding notes", err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := GetNotesResponse{
+		Notes: presenters.PresentNotes(notes),
+		Total: total,
+	}
+	handlers.RespondJSON(w, http.StatusOK, response)
+}
+
 /**** getNotesHandler */
 
 // GetNotesResponse is a reponse by getNotesHandler
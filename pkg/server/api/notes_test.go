@@ -37,13 +37,14 @@ import (
 
 func getExpectedNotePayload(n database.Note, b database.Book, u database.User) presenters.Note {
 	return presenters.Note{
-		UUID:      n.UUID,
-		CreatedAt: n.CreatedAt,
-		UpdatedAt: n.UpdatedAt,
-		Body:      n.Body,
-		AddedOn:   n.AddedOn,
-		Public:    n.Public,
-		USN:       n.USN,
+		UUID:       n.UUID,
+		CreatedAt:  n.CreatedAt,
+		UpdatedAt:  n.UpdatedAt,
+		Body:       n.Body,
+		AddedOn:    n.AddedOn,
+		Public:     n.Public,
+		Visibility: n.Visibility,
+		USN:        n.USN,
 		Book: presenters.NoteBook{
 			UUID:  b.UUID,
 			Label: b.Label,
@@ -355,3 +356,67 @@ func TestGetNote(t *testing.T) {
 		assert.DeepEqual(t, string(body), "not found\n", "payload mismatch")
 	})
 }
+
+func TestGetListedNotes(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	// Setup
+	server := MustNewServer(t, &app.App{
+		Clock: clock.NewMock(),
+	})
+	defer server.Close()
+
+	user := testutils.SetupUserData()
+
+	b1 := database.Book{
+		UserID: user.ID,
+		Label:  "js",
+	}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+
+	privateNote := database.Note{
+		UserID:     user.ID,
+		BookUUID:   b1.UUID,
+		Body:       "privateNote content",
+		Visibility: database.NoteVisibilityPrivate,
+	}
+	testutils.MustExec(t, testutils.DB.Save(&privateNote), "preparing privateNote")
+	unlistedNote := database.Note{
+		UserID:     user.ID,
+		BookUUID:   b1.UUID,
+		Body:       "unlistedNote content",
+		Public:     true,
+		Visibility: database.NoteVisibilityUnlisted,
+	}
+	testutils.MustExec(t, testutils.DB.Save(&unlistedNote), "preparing unlistedNote")
+	publicNote := database.Note{
+		UserID:     user.ID,
+		BookUUID:   b1.UUID,
+		Body:       "publicNote content",
+		Public:     true,
+		Visibility: database.NoteVisibilityPublic,
+	}
+	testutils.MustExec(t, testutils.DB.Save(&publicNote), "preparing publicNote")
+
+	// Execute
+	url := fmt.Sprintf("/users/%s/notes", user.UUID)
+	req := testutils.MakeReq(server.URL, "GET", url, "")
+	res := testutils.HTTPDo(t, req)
+
+	// Test
+	assert.StatusCodeEquals(t, res, http.StatusOK, "")
+
+	var payload GetNotesResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding payload"))
+	}
+
+	var publicNoteRecord database.Note
+	testutils.MustExec(t, testutils.DB.Where("uuid = ?", publicNote.UUID).First(&publicNoteRecord), "finding publicNoteRecord")
+
+	expected := GetNotesResponse{
+		Notes: []presenters.Note{getExpectedNotePayload(publicNoteRecord, b1, user)},
+		Total: 1,
+	}
+	assert.DeepEqual(t, payload, expected, "payload mismatch")
+}
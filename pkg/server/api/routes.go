@@ -44,7 +44,7 @@ func (a *API) init() error {
 }
 
 func applyMiddleware(h http.HandlerFunc, rateLimit bool) http.Handler {
-	ret := h
+	ret := handlers.ErrorCode(h)
 	ret = handlers.Logging(ret)
 
 	if rateLimit && os.Getenv("GO_ENV") != "TEST" {
@@ -77,6 +77,7 @@ func NewRouter(a *API) (*mux.Router, error) {
 		{Method: "PATCH", Pattern: "/account/email-preference", HandlerFunc: handlers.TokenAuth(app, a.updateEmailPreference, database.TokenTypeEmailPreference, nil), RateLimit: true},
 		{Method: "GET", Pattern: "/notes", HandlerFunc: handlers.Auth(app, a.getNotes, nil), RateLimit: false},
 		{Method: "GET", Pattern: "/notes/{noteUUID}", HandlerFunc: a.getNote, RateLimit: true},
+		{Method: "GET", Pattern: "/users/{userUUID}/notes", HandlerFunc: a.getListedNotes, RateLimit: true},
 		{Method: "GET", Pattern: "/calendar", HandlerFunc: handlers.Auth(app, a.getCalendar, nil), RateLimit: true},
 
 		// v3
@@ -88,11 +89,15 @@ func NewRouter(a *API) (*mux.Router, error) {
 		{Method: "POST", Pattern: "/v3/books", HandlerFunc: handlers.Cors(handlers.Auth(app, a.CreateBook, &proOnly)), RateLimit: false},
 		{Method: "PATCH", Pattern: "/v3/books/{bookUUID}", HandlerFunc: handlers.Cors(handlers.Auth(app, a.UpdateBook, &proOnly)), RateLimit: false},
 		{Method: "DELETE", Pattern: "/v3/books/{bookUUID}", HandlerFunc: handlers.Cors(handlers.Auth(app, a.DeleteBook, &proOnly)), RateLimit: false},
+		{Method: "GET", Pattern: "/v3/books/{bookUUID}/members", HandlerFunc: handlers.Cors(handlers.Auth(app, a.GetBookMembers, &proOnly)), RateLimit: true},
+		{Method: "POST", Pattern: "/v3/books/{bookUUID}/members", HandlerFunc: handlers.Cors(handlers.Auth(app, a.AddBookMember, &proOnly)), RateLimit: true},
+		{Method: "DELETE", Pattern: "/v3/books/{bookUUID}/members/{email}", HandlerFunc: handlers.Cors(handlers.Auth(app, a.RemoveBookMember, &proOnly)), RateLimit: true},
 		{Method: "OPTIONS", Pattern: "/v3/notes", HandlerFunc: handlers.Cors(a.NotesOptions), RateLimit: true},
 		{Method: "POST", Pattern: "/v3/notes", HandlerFunc: handlers.Cors(handlers.Auth(app, a.CreateNote, &proOnly)), RateLimit: false},
 		{Method: "PATCH", Pattern: "/v3/notes/{noteUUID}", HandlerFunc: handlers.Auth(app, a.UpdateNote, &proOnly), RateLimit: false},
 		{Method: "DELETE", Pattern: "/v3/notes/{noteUUID}", HandlerFunc: handlers.Auth(app, a.DeleteNote, &proOnly), RateLimit: false},
 		{Method: "POST", Pattern: "/v3/signin", HandlerFunc: handlers.Cors(a.signin), RateLimit: true},
+		{Method: "POST", Pattern: "/v3/refresh", HandlerFunc: a.refreshSession, RateLimit: true},
 		{Method: "OPTIONS", Pattern: "/v3/signout", HandlerFunc: handlers.Cors(a.signoutOptions), RateLimit: true},
 		{Method: "POST", Pattern: "/v3/signout", HandlerFunc: handlers.Cors(a.signout), RateLimit: true},
 		{Method: "POST", Pattern: "/v3/register", HandlerFunc: a.register, RateLimit: true},
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dnote/dnote/pkg/server/app"
 	"github.com/dnote/dnote/pkg/server/database"
 	"github.com/dnote/dnote/pkg/server/handlers"
 	"github.com/dnote/dnote/pkg/server/log"
@@ -38,6 +39,8 @@ var ErrLoginFailure = errors.New("Wrong email and password combination")
 type SessionResponse struct {
 	Key       string `json:"key"`
 	ExpiresAt int64  `json:"expires_at"`
+	// RefreshToken renews the session after it expires. It can be used only once.
+	RefreshToken string `json:"refresh_token"`
 }
 
 func setSessionCookie(w http.ResponseWriter, key string, expires time.Time) {
@@ -110,6 +113,31 @@ func (a *API) signin(w http.ResponseWriter, r *http.Request) {
 	a.respondWithSession(a.App.DB, w, account.UserID, http.StatusOK)
 }
 
+type refreshPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshSession renews an expired session with its refresh token. The old session and
+// refresh token are revoked, and a new session with a new refresh token is returned.
+func (a *API) refreshSession(w http.ResponseWriter, r *http.Request) {
+	var params refreshPayload
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	session, err := a.App.RefreshSession(params.RefreshToken)
+	if errors.Cause(err) == app.ErrInvalidRefreshToken {
+		http.Error(w, app.ErrInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		handlers.DoError(w, "refreshing session", err, http.StatusInternalServerError)
+		return
+	}
+
+	writeSession(w, session, http.StatusOK)
+}
+
 func (a *API) signoutOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "POST")
 	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Version")
@@ -210,11 +238,17 @@ func (a *API) respondWithSession(db *gorm.DB, w http.ResponseWriter, userID int,
 		return
 	}
 
+	writeSession(w, session, statusCode)
+}
+
+// writeSession sets the session cookie and writes the session as JSON
+func writeSession(w http.ResponseWriter, session database.Session, statusCode int) {
 	setSessionCookie(w, session.Key, session.ExpiresAt)
 
 	response := SessionResponse{
-		Key:       session.Key,
-		ExpiresAt: session.ExpiresAt.Unix(),
+		Key:          session.Key,
+		ExpiresAt:    session.ExpiresAt.Unix(),
+		RefreshToken: session.RefreshToken,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
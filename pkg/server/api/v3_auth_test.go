@@ -50,6 +50,8 @@ func assertSessionResp(t *testing.T, res *http.Response) {
 	assert.Equal(t, sessionCount, 1, "sessionCount mismatch")
 	assert.Equal(t, got.Key, session.Key, "session Key mismatch")
 	assert.Equal(t, got.ExpiresAt, session.ExpiresAt.Unix(), "session ExpiresAt mismatch")
+	assert.Equal(t, got.RefreshToken, session.RefreshToken, "session RefreshToken mismatch")
+	assert.NotEqual(t, got.RefreshToken, "", "the refresh token should be set")
 
 	c := testutils.GetCookieByName(res.Cookies(), "id")
 	assert.Equal(t, c.Value, session.Key, "session key mismatch")
@@ -379,6 +381,85 @@ func TestSignIn(t *testing.T) {
 	})
 }
 
+func TestRefreshSession(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		defer testutils.ClearData(testutils.DB)
+
+		// Setup
+		server := MustNewServer(t, &app.App{
+			Clock: clock.NewMock(),
+		})
+		defer server.Close()
+
+		u := testutils.SetupUserData()
+		old := database.Session{
+			UserID:           u.ID,
+			Key:              "A9xgggqzTHETy++GDi1NpDNe0iyqosPm9bitdeNGkJU=",
+			ExpiresAt:        time.Now().Add(-time.Hour),
+			RefreshToken:     "Mr1Hb3CQoqSy0ZeF2ZP4Abk5eEvRT3BVAI/8CKhGvYE=",
+			RefreshExpiresAt: time.Now().Add(time.Hour * 24),
+		}
+		testutils.MustExec(t, testutils.DB.Save(&old), "preparing the session")
+
+		dat := `{"refresh_token": "Mr1Hb3CQoqSy0ZeF2ZP4Abk5eEvRT3BVAI/8CKhGvYE="}`
+		req := testutils.MakeReq(server.URL, "POST", "/v3/refresh", dat)
+
+		// Execute
+		res := testutils.HTTPDo(t, req)
+
+		// Test
+		assert.StatusCodeEquals(t, res, http.StatusOK, "")
+		assertSessionResp(t, res)
+
+		var session database.Session
+		testutils.MustExec(t, testutils.DB.First(&session), "getting the session")
+		assert.Equal(t, session.UserID, u.ID, "session UserID mismatch")
+		assert.NotEqual(t, session.Key, old.Key, "the session key should be new")
+		assert.NotEqual(t, session.RefreshToken, old.RefreshToken, "the refresh token should be new")
+
+		// the expired key is revoked
+		req = testutils.MakeReq(server.URL, "GET", "/v3/sync/state", "")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", old.Key))
+		res = testutils.HTTPDo(t, req)
+		assert.StatusCodeEquals(t, res, http.StatusUnauthorized, "")
+	})
+
+	t.Run("invalid refresh token", func(t *testing.T) {
+		defer testutils.ClearData(testutils.DB)
+
+		// Setup
+		server := MustNewServer(t, &app.App{
+			Clock: clock.NewMock(),
+		})
+		defer server.Close()
+
+		u := testutils.SetupUserData()
+		old := database.Session{
+			UserID:           u.ID,
+			Key:              "A9xgggqzTHETy++GDi1NpDNe0iyqosPm9bitdeNGkJU=",
+			ExpiresAt:        time.Now().Add(-time.Hour),
+			RefreshToken:     "Mr1Hb3CQoqSy0ZeF2ZP4Abk5eEvRT3BVAI/8CKhGvYE=",
+			RefreshExpiresAt: time.Now().Add(-time.Minute),
+		}
+		testutils.MustExec(t, testutils.DB.Save(&old), "preparing the session")
+
+		for _, token := range []string{"Mr1Hb3CQoqSy0ZeF2ZP4Abk5eEvRT3BVAI/8CKhGvYE=", "unknown", ""} {
+			dat := fmt.Sprintf(`{"refresh_token": "%s"}`, token)
+			req := testutils.MakeReq(server.URL, "POST", "/v3/refresh", dat)
+
+			// Execute
+			res := testutils.HTTPDo(t, req)
+
+			// Test
+			assert.StatusCodeEquals(t, res, http.StatusUnauthorized, fmt.Sprintf("status mismatch for '%s'", token))
+		}
+
+		var sessionCount int
+		testutils.MustExec(t, testutils.DB.Model(&database.Session{}).Count(&sessionCount), "counting sessions")
+		assert.Equal(t, sessionCount, 1, "sessionCount mismatch")
+	})
+}
+
 func TestSignout(t *testing.T) {
 	t.Run("authenticated", func(t *testing.T) {
 
@@ -0,0 +1,216 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dnote/dnote/pkg/server/app"
+	"github.com/dnote/dnote/pkg/server/database"
+	"github.com/dnote/dnote/pkg/server/handlers"
+	"github.com/dnote/dnote/pkg/server/helpers"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// BookMember is a user who can write to a team book
+type BookMember struct {
+	Email string `json:"email"`
+	Owner bool   `json:"owner"`
+}
+
+// GetBookMembersResp is the response from get book members api
+type GetBookMembersResp struct {
+	Members []BookMember `json:"members"`
+}
+
+// findAccessibleBook finds the book with the uuid in the route that the user can access
+func (a *API) findAccessibleBook(r *http.Request, user database.User) (database.Book, int, error) {
+	vars := mux.Vars(r)
+	bookUUID := vars["bookUUID"]
+
+	var book database.Book
+	conn := a.App.DB.Scopes(database.AccessibleBooks(user.ID)).Where("uuid = ? AND NOT deleted", bookUUID).First(&book)
+	if conn.RecordNotFound() {
+		return book, http.StatusNotFound, errors.New("book not found")
+	}
+	if err := conn.Error; err != nil {
+		return book, http.StatusInternalServerError, errors.Wrap(err, "finding book")
+	}
+
+	return book, 0, nil
+}
+
+// errMemberNotAvailable is an error for an email that cannot be added to a book. It does not tell
+// whether an account exists for the email so that book owners cannot look up the accounts.
+var errMemberNotAvailable = errors.New("The user cannot be added to the book")
+
+// findUserByEmail finds the user with the given email. The given error is returned if no user has
+// the email so that the response does not reveal whether an account exists.
+func (a *API) findUserByEmail(email string, notFoundErr error) (database.User, int, error) {
+	var account database.Account
+	conn := a.App.DB.Where("email = ?", email).First(&account)
+	if conn.RecordNotFound() {
+		return database.User{}, http.StatusNotFound, notFoundErr
+	}
+	if err := conn.Error; err != nil {
+		return database.User{}, http.StatusInternalServerError, errors.Wrap(err, "finding account")
+	}
+
+	var user database.User
+	if err := a.App.DB.Where("id = ?", account.UserID).First(&user).Error; err != nil {
+		return user, http.StatusInternalServerError, errors.Wrap(err, "finding user")
+	}
+
+	return user, 0, nil
+}
+
+// GetBookMembers returns the owner and the members of a book
+func (a *API) GetBookMembers(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(helpers.KeyUser).(database.User)
+	if !ok {
+		handlers.DoError(w, "No authenticated user found", nil, http.StatusInternalServerError)
+		return
+	}
+
+	book, status, err := a.findAccessibleBook(r, user)
+	if err != nil {
+		handlers.DoError(w, "finding book", err, status)
+		return
+	}
+
+	var owner database.Account
+	if err := a.App.DB.Where("user_id = ?", book.UserID).First(&owner).Error; err != nil {
+		handlers.DoError(w, "finding the owner", err, http.StatusInternalServerError)
+		return
+	}
+
+	members, err := a.App.GetBookMembers(book)
+	if err != nil {
+		handlers.DoError(w, "getting members", err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := GetBookMembersResp{
+		Members: []BookMember{{Email: owner.Email.String, Owner: true}},
+	}
+	for _, m := range members {
+		resp.Members = append(resp.Members, BookMember{Email: m.Account.Email.String})
+	}
+
+	handlers.RespondJSON(w, http.StatusOK, resp)
+}
+
+type addBookMemberPayload struct {
+	Email string `json:"email"`
+}
+
+// AddBookMember lets another user write to a book of the user
+func (a *API) AddBookMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(helpers.KeyUser).(database.User)
+	if !ok {
+		handlers.DoError(w, "No authenticated user found", nil, http.StatusInternalServerError)
+		return
+	}
+
+	var params addBookMemberPayload
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		handlers.DoError(w, "decoding payload", err, http.StatusInternalServerError)
+		return
+	}
+	if params.Email == "" {
+		handlers.DoError(w, "validating payload", errors.New("email is required"), http.StatusBadRequest)
+		return
+	}
+
+	book, status, err := a.findAccessibleBook(r, user)
+	if err != nil {
+		handlers.DoError(w, "finding book", err, status)
+		return
+	}
+	if book.UserID != user.ID {
+		handlers.DoError(w, "adding member", errors.New("only the owner of the book can add members"), http.StatusForbidden)
+		return
+	}
+
+	member, status, err := a.findUserByEmail(params.Email, errMemberNotAvailable)
+	if err != nil {
+		handlers.DoError(w, "finding member", err, status)
+		return
+	}
+
+	tx := a.App.DB.Begin()
+	if err := a.App.AddBookMember(tx, user, book, member); err != nil {
+		tx.Rollback()
+
+		if errors.Cause(err) == app.ErrBookMemberExists {
+			handlers.DoError(w, "adding member", err, http.StatusConflict)
+			return
+		}
+
+		handlers.DoError(w, "adding member", err, http.StatusInternalServerError)
+		return
+	}
+	tx.Commit()
+
+	handlers.RespondJSON(w, http.StatusCreated, BookMember{Email: params.Email})
+}
+
+// RemoveBookMember stops a user from writing to a book
+func (a *API) RemoveBookMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(helpers.KeyUser).(database.User)
+	if !ok {
+		handlers.DoError(w, "No authenticated user found", nil, http.StatusInternalServerError)
+		return
+	}
+
+	book, status, err := a.findAccessibleBook(r, user)
+	if err != nil {
+		handlers.DoError(w, "finding book", err, status)
+		return
+	}
+
+	vars := mux.Vars(r)
+	member, status, err := a.findUserByEmail(vars["email"], app.ErrBookMemberNotFound)
+	if err != nil {
+		handlers.DoError(w, "finding member", err, status)
+		return
+	}
+	if book.UserID != user.ID && member.ID != user.ID {
+		handlers.DoError(w, "removing member", errors.New("only the owner of the book can remove other members"), http.StatusForbidden)
+		return
+	}
+
+	tx := a.App.DB.Begin()
+	if err := a.App.RemoveBookMember(tx, user, book, member); err != nil {
+		tx.Rollback()
+
+		if errors.Cause(err) == app.ErrBookMemberNotFound {
+			handlers.DoError(w, "removing member", err, http.StatusNotFound)
+			return
+		}
+
+		handlers.DoError(w, "removing member", err, http.StatusInternalServerError)
+		return
+	}
+	tx.Commit()
+
+	handlers.RespondJSON(w, http.StatusOK, BookMember{Email: vars["email"]})
+}
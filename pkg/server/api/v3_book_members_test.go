@@ -0,0 +1,121 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/clock"
+	"github.com/dnote/dnote/pkg/server/app"
+	"github.com/dnote/dnote/pkg/server/database"
+	"github.com/dnote/dnote/pkg/server/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestRemoveBookMember(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	// Setup
+	server := MustNewServer(t, &app.App{
+		Clock: clock.NewMock(),
+	})
+	defer server.Close()
+
+	owner := testutils.SetupUserData()
+	testutils.SetupAccountData(owner, "alice@example.com", "pass1234")
+	member := testutils.SetupUserData()
+	testutils.SetupAccountData(member, "bob@example.com", "pass1234")
+	testutils.MustExec(t, testutils.DB.Model(&member).Update("max_usn", 3), "preparing member max_usn")
+
+	b1 := database.Book{UserID: owner.ID, Label: "team", USN: 1}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+	n1 := database.Note{UserID: owner.ID, BookUUID: b1.UUID, Body: "n1", USN: 2}
+	testutils.MustExec(t, testutils.DB.Save(&n1), "preparing n1")
+	n2 := database.Note{UserID: owner.ID, BookUUID: b1.UUID, Body: "n2", USN: 3, AuthorID: member.ID}
+	testutils.MustExec(t, testutils.DB.Save(&n2), "preparing n2")
+	m := database.BookMember{BookUUID: b1.UUID, UserID: member.ID}
+	testutils.MustExec(t, testutils.DB.Save(&m), "preparing membership")
+
+	// Execute
+	req := testutils.MakeReq(server.URL, "DELETE", fmt.Sprintf("/v3/books/%s/members/bob@example.com", b1.UUID), "")
+	res := testutils.HTTPAuthDo(t, req, owner)
+
+	// Test
+	assert.StatusCodeEquals(t, res, http.StatusOK, "")
+
+	t.Run("sync", func(t *testing.T) {
+		req := testutils.MakeReq(server.URL, "GET", "/v3/sync/fragment?after_usn=3", "")
+		res := testutils.HTTPAuthDo(t, req, member)
+		assert.StatusCodeEquals(t, res, http.StatusOK, "")
+
+		var payload GetSyncFragmentResp
+		if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+
+		assert.Equal(t, payload.Fragment.UserMaxUSN, 6, "user_max_usn mismatch")
+		assert.DeepEqual(t, payload.Fragment.ExpungedNotes, []string{n1.UUID, n2.UUID}, "expunged_notes mismatch")
+		assert.DeepEqual(t, payload.Fragment.ExpungedBooks, []string{b1.UUID}, "expunged_books mismatch")
+		assert.Equal(t, len(payload.Fragment.Books), 0, "books length mismatch")
+		assert.Equal(t, len(payload.Fragment.Notes), 0, "notes length mismatch")
+	})
+
+	t.Run("create note", func(t *testing.T) {
+		dat := fmt.Sprintf(`{"book_uuid": "%s", "content": "n3"}`, b1.UUID)
+		req := testutils.MakeReq(server.URL, "POST", "/v3/notes", dat)
+		res := testutils.HTTPAuthDo(t, req, member)
+		assert.StatusCodeEquals(t, res, http.StatusNotFound, "")
+	})
+
+	t.Run("update note", func(t *testing.T) {
+		req := testutils.MakeReq(server.URL, "PATCH", fmt.Sprintf("/v3/notes/%s", n2.UUID), `{"content": "n2 edited"}`)
+		res := testutils.HTTPAuthDo(t, req, member)
+		assert.StatusCodeEquals(t, res, http.StatusNotFound, "")
+	})
+}
+
+func TestRemoveBookMember_unknownEmail(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	// Setup
+	server := MustNewServer(t, &app.App{
+		Clock: clock.NewMock(),
+	})
+	defer server.Close()
+
+	owner := testutils.SetupUserData()
+	testutils.SetupAccountData(owner, "alice@example.com", "pass1234")
+	stranger := testutils.SetupUserData()
+	testutils.SetupAccountData(stranger, "bob@example.com", "pass1234")
+
+	b1 := database.Book{UserID: owner.ID, Label: "team", USN: 1}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+
+	// an email without an account is indistinguishable from an account that is not a member
+	for _, email := range []string{"bob@example.com", "nobody@example.com"} {
+		req := testutils.MakeReq(server.URL, "DELETE", fmt.Sprintf("/v3/books/%s/members/%s", b1.UUID, email), "")
+		res := testutils.HTTPAuthDo(t, req, owner)
+
+		assert.StatusCodeEquals(t, res, http.StatusNotFound, email)
+	}
+}
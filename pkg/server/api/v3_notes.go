@@ -22,6 +22,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/dnote/dnote/pkg/server/app"
 	"github.com/dnote/dnote/pkg/server/database"
@@ -34,8 +35,15 @@ import (
 
 type updateNotePayload struct {
 	BookUUID *string `json:"book_uuid"`
+	Title    *string `json:"title"`
 	Content  *string `json:"content"`
 	Public   *bool   `json:"public"`
+	// Visibility is one of private, unlisted and public. It takes precedence over Public.
+	Visibility *string `json:"visibility"`
+	// Checksum is the checksum of the content computed by the client, if given
+	Checksum *string `json:"checksum"`
+	// Metadata is the key-value metadata of the note encrypted by the client
+	Metadata *string `json:"metadata"`
 }
 
 type updateNoteResp struct {
@@ -44,7 +52,35 @@ type updateNoteResp struct {
 }
 
 func validateUpdateNotePayload(p updateNotePayload) bool {
-	return p.BookUUID != nil || p.Content != nil || p.Public != nil
+	return p.BookUUID != nil || p.Title != nil || p.Content != nil || p.Public != nil || p.Visibility != nil || p.Metadata != nil
+}
+
+// errInvalidVisibility is an error for an unknown note visibility
+var errInvalidVisibility = errors.New("the visibility must be one of private, unlisted and public")
+
+// errTitleMultiline is an error for a note title that spans multiple lines
+var errTitleMultiline = errors.New("the title must be a single line")
+
+// validateTitle returns errTitleMultiline if the title spans multiple lines
+func validateTitle(title string) error {
+	if strings.ContainsAny(title, "\r\n") {
+		return errTitleMultiline
+	}
+
+	return nil
+}
+
+// errChecksumMismatch is an error for the content that does not match the checksum computed
+// by the client, which means that the content was corrupted on the way
+var errChecksumMismatch = errors.New("the content does not match the checksum")
+
+// verifyChecksum returns errChecksumMismatch if the checksum is given and does not match the content
+func verifyChecksum(content string, checksum *string) error {
+	if checksum != nil && *checksum != helpers.Checksum(content) {
+		return errChecksumMismatch
+	}
+
+	return nil
 }
 
 // UpdateNote updates note
@@ -69,9 +105,30 @@ func (a *API) UpdateNote(w http.ResponseWriter, r *http.Request) {
 		handlers.DoError(w, "Invalid payload", nil, http.StatusBadRequest)
 		return
 	}
+	if params.Content != nil {
+		if err := verifyChecksum(*params.Content, params.Checksum); err != nil {
+			handlers.DoError(w, "verifying the checksum", err, http.StatusBadRequest)
+			return
+		}
+	}
+	if params.Title != nil {
+		if err := validateTitle(*params.Title); err != nil {
+			handlers.DoError(w, "validating the title", err, http.StatusBadRequest)
+			return
+		}
+	}
+	if params.Visibility != nil && !database.IsNoteVisibility(*params.Visibility) {
+		handlers.DoError(w, "validating the visibility", errInvalidVisibility, http.StatusBadRequest)
+		return
+	}
 
 	var note database.Note
-	if err := a.App.DB.Where("uuid = ? AND user_id = ?", noteUUID, user.ID).First(&note).Error; err != nil {
+	conn := a.App.DB.Scopes(database.AccessibleNotes(user.ID)).Where("uuid = ?", noteUUID).First(&note)
+	if conn.RecordNotFound() {
+		handlers.DoError(w, "finding note", errors.New("note not found"), http.StatusNotFound)
+		return
+	}
+	if err := conn.Error; err != nil {
 		handlers.DoError(w, "finding note", err, http.StatusInternalServerError)
 		return
 	}
@@ -79,18 +136,31 @@ func (a *API) UpdateNote(w http.ResponseWriter, r *http.Request) {
 	tx := a.App.DB.Begin()
 
 	note, err = a.App.UpdateNote(tx, user, note, &app.UpdateNoteParams{
-		BookUUID: params.BookUUID,
-		Content:  params.Content,
-		Public:   params.Public,
+		BookUUID:   params.BookUUID,
+		Title:      params.Title,
+		Content:    params.Content,
+		Public:     params.Public,
+		Visibility: params.Visibility,
+		Metadata:   params.Metadata,
 	})
 	if err != nil {
 		tx.Rollback()
+
+		if errors.Cause(err) == app.ErrBookNotFound {
+			handlers.DoError(w, "updating note", err, http.StatusNotFound)
+			return
+		}
+		if errors.Cause(err) == app.ErrNoteMoveNotAllowed {
+			handlers.DoError(w, "updating note", err, http.StatusForbidden)
+			return
+		}
+
 		handlers.DoError(w, "updating note", err, http.StatusInternalServerError)
 		return
 	}
 
 	var book database.Book
-	if err := tx.Where("uuid = ? AND user_id = ?", note.BookUUID, user.ID).First(&book).Error; err != nil {
+	if err := tx.Scopes(database.AccessibleBooks(user.ID)).Where("uuid = ?", note.BookUUID).First(&book).Error; err != nil {
 		tx.Rollback()
 		handlers.DoError(w, fmt.Sprintf("finding book %s to preload", note.BookUUID), err, http.StatusInternalServerError)
 		return
@@ -126,7 +196,12 @@ func (a *API) DeleteNote(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var note database.Note
-	if err := a.App.DB.Where("uuid = ? AND user_id = ?", noteUUID, user.ID).Preload("Book").First(&note).Error; err != nil {
+	conn := a.App.DB.Scopes(database.AccessibleNotes(user.ID)).Where("uuid = ?", noteUUID).Preload("Book").First(&note)
+	if conn.RecordNotFound() {
+		handlers.DoError(w, "finding note", errors.New("note not found"), http.StatusNotFound)
+		return
+	}
+	if err := conn.Error; err != nil {
 		handlers.DoError(w, "finding note", err, http.StatusInternalServerError)
 		return
 	}
@@ -151,17 +226,26 @@ func (a *API) DeleteNote(w http.ResponseWriter, r *http.Request) {
 
 type createNotePayload struct {
 	BookUUID string `json:"book_uuid"`
+	// Title is inferred from the content if empty
+	Title    string `json:"title"`
 	Content  string `json:"content"`
 	AddedOn  *int64 `json:"added_on"`
 	EditedOn *int64 `json:"edited_on"`
+	// Checksum is the checksum of the content computed by the client, if given
+	Checksum *string `json:"checksum"`
+	// Metadata is the key-value metadata of the note encrypted by the client, if any
+	Metadata *string `json:"metadata"`
 }
 
 func validateCreateNotePayload(p createNotePayload) error {
 	if p.BookUUID == "" {
 		return errors.New("bookUUID is required")
 	}
+	if err := validateTitle(p.Title); err != nil {
+		return err
+	}
 
-	return nil
+	return verifyChecksum(p.Content, p.Checksum)
 }
 
 // CreateNoteResp is a response for creating a note
@@ -190,18 +274,30 @@ func (a *API) CreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the book may no longer be accessible if the user was removed from it
 	var book database.Book
-	if err := a.App.DB.Where("uuid = ? AND user_id = ?", params.BookUUID, user.ID).First(&book).Error; err != nil {
+	conn := a.App.DB.Scopes(database.AccessibleBooks(user.ID)).Where("uuid = ?", params.BookUUID).First(&book)
+	if conn.RecordNotFound() {
+		handlers.DoError(w, "finding book", errors.New("book not found"), http.StatusNotFound)
+		return
+	}
+	if err := conn.Error; err != nil {
 		handlers.DoError(w, "finding book", err, http.StatusInternalServerError)
 		return
 	}
 
 	client := getClientType(r)
-	note, err := a.App.CreateNote(user, params.BookUUID, params.Content, params.AddedOn, params.EditedOn, false, client)
+	note, err := a.App.CreateNote(user, params.BookUUID, params.Title, params.Content, params.AddedOn, params.EditedOn, false, client)
 	if err != nil {
 		handlers.DoError(w, "creating note", err, http.StatusInternalServerError)
 		return
 	}
+	if params.Metadata != nil {
+		if err := a.App.DB.Model(&note).Update("metadata", *params.Metadata).Error; err != nil {
+			handlers.DoError(w, "saving the metadata", err, http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// preload associations
 	note.User = user
@@ -27,6 +27,7 @@ import (
 	"github.com/dnote/dnote/pkg/clock"
 	"github.com/dnote/dnote/pkg/server/app"
 	"github.com/dnote/dnote/pkg/server/database"
+	"github.com/dnote/dnote/pkg/server/helpers"
 	"github.com/dnote/dnote/pkg/server/testutils"
 )
 
@@ -79,8 +80,104 @@ func TestCreateNote(t *testing.T) {
 
 	assert.NotEqual(t, noteRecord.UUID, "", "note uuid should have been generated")
 	assert.Equal(t, noteRecord.BookUUID, b1.UUID, "note book_uuid mismatch")
+	assert.Equal(t, noteRecord.Title, "note content", "note title mismatch")
 	assert.Equal(t, noteRecord.Body, "note content", "note content mismatch")
 	assert.Equal(t, noteRecord.USN, 102, "note usn mismatch")
+	assert.Equal(t, noteRecord.Checksum, helpers.Checksum("note content"), "note checksum mismatch")
+}
+
+func TestCreateNote_title(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	// Setup
+	server := MustNewServer(t, &app.App{
+		Clock: clock.NewMock(),
+	})
+	defer server.Close()
+
+	user := testutils.SetupUserData()
+
+	b1 := database.Book{
+		UserID: user.ID,
+		Label:  "js",
+		USN:    58,
+	}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+
+	// Execute
+	dat := fmt.Sprintf(`{"book_uuid": "%s", "title": "closures", "content": "note content"}`, b1.UUID)
+	req := testutils.MakeReq(server.URL, "POST", "/v3/notes", dat)
+	res := testutils.HTTPAuthDo(t, req, user)
+
+	// Test
+	assert.StatusCodeEquals(t, res, http.StatusCreated, "")
+
+	var noteRecord database.Note
+	testutils.MustExec(t, testutils.DB.First(&noteRecord), "finding note")
+	assert.Equal(t, noteRecord.Title, "closures", "note title mismatch")
+	assert.Equal(t, noteRecord.Body, "note content", "note content mismatch")
+}
+
+func TestCreateNote_multilineTitle(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	// Setup
+	server := MustNewServer(t, &app.App{
+		Clock: clock.NewMock(),
+	})
+	defer server.Close()
+
+	user := testutils.SetupUserData()
+
+	b1 := database.Book{
+		UserID: user.ID,
+		Label:  "js",
+		USN:    58,
+	}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+
+	// Execute
+	dat := fmt.Sprintf(`{"book_uuid": "%s", "title": "line 1\nline 2", "content": "note content"}`, b1.UUID)
+	req := testutils.MakeReq(server.URL, "POST", "/v3/notes", dat)
+	res := testutils.HTTPAuthDo(t, req, user)
+
+	// Test
+	assert.StatusCodeEquals(t, res, http.StatusBadRequest, "")
+
+	var noteCount int
+	testutils.MustExec(t, testutils.DB.Model(&database.Note{}).Count(&noteCount), "counting notes")
+	assert.Equalf(t, noteCount, 0, "note count mismatch")
+}
+
+func TestCreateNote_checksumMismatch(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	// Setup
+	server := MustNewServer(t, &app.App{
+		Clock: clock.NewMock(),
+	})
+	defer server.Close()
+
+	user := testutils.SetupUserData()
+
+	b1 := database.Book{
+		UserID: user.ID,
+		Label:  "js",
+		USN:    58,
+	}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+
+	// Execute
+	dat := fmt.Sprintf(`{"book_uuid": "%s", "content": "note content", "checksum": "%s"}`, b1.UUID, helpers.Checksum("corrupted content"))
+	req := testutils.MakeReq(server.URL, "POST", "/v3/notes", dat)
+	res := testutils.HTTPAuthDo(t, req, user)
+
+	// Test
+	assert.StatusCodeEquals(t, res, http.StatusBadRequest, "")
+
+	var noteCount int
+	testutils.MustExec(t, testutils.DB.Model(&database.Note{}).Count(&noteCount), "counting notes")
+	assert.Equalf(t, noteCount, 0, "note count mismatch")
 }
 
 func TestUpdateNote(t *testing.T) {
@@ -304,6 +401,65 @@ func TestUpdateNote(t *testing.T) {
 	}
 }
 
+func TestUpdateNote_moveNotAllowed(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	// Setup
+	server := MustNewServer(t, &app.App{
+		Clock: clock.NewMock(),
+	})
+	defer server.Close()
+
+	owner := testutils.SetupUserData()
+	member := testutils.SetupUserData()
+	stranger := testutils.SetupUserData()
+
+	team := database.Book{UserID: owner.ID, Label: "team"}
+	testutils.MustExec(t, testutils.DB.Save(&team), "preparing the team book")
+	memberBook := database.Book{UserID: member.ID, Label: "mine"}
+	testutils.MustExec(t, testutils.DB.Save(&memberBook), "preparing the book of the member")
+	strangerBook := database.Book{UserID: stranger.ID, Label: "other"}
+	testutils.MustExec(t, testutils.DB.Save(&strangerBook), "preparing the book of the stranger")
+	m := database.BookMember{BookUUID: team.UUID, UserID: member.ID}
+	testutils.MustExec(t, testutils.DB.Save(&m), "preparing the membership")
+	note := database.Note{UserID: owner.ID, BookUUID: team.UUID, Body: "n1"}
+	testutils.MustExec(t, testutils.DB.Save(&note), "preparing the note")
+
+	testCases := []struct {
+		user           database.User
+		bookUUID       string
+		expectedStatus int
+	}{
+		{
+			user:           member,
+			bookUUID:       memberBook.UUID,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			user:           owner,
+			bookUUID:       strangerBook.UUID,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// Execute
+			endpoint := fmt.Sprintf("/v3/notes/%s", note.UUID)
+			req := testutils.MakeReq(server.URL, "PATCH", endpoint, fmt.Sprintf(`{"book_uuid": "%s"}`, tc.bookUUID))
+			res := testutils.HTTPAuthDo(t, req, tc.user)
+
+			// Test
+			assert.StatusCodeEquals(t, res, tc.expectedStatus, "status code mismatch")
+
+			var noteRecord database.Note
+			testutils.MustExec(t, testutils.DB.Where("uuid = ?", note.UUID).First(&noteRecord), "finding note")
+			assert.Equal(t, noteRecord.BookUUID, team.UUID, "note book_uuid mismatch")
+			assert.Equal(t, noteRecord.UserID, owner.ID, "note user_id mismatch")
+		})
+	}
+}
+
 func TestDeleteNote(t *testing.T) {
 	b1UUID := "37868a8e-a844-4265-9a4f-0be598084733"
 
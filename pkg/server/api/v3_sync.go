@@ -48,36 +48,51 @@ type SyncFragment struct {
 	Books         []SyncFragBook `json:"books"`
 	ExpungedNotes []string       `json:"expunged_notes"`
 	ExpungedBooks []string       `json:"expunged_books"`
+	// Limit is the number of books and notes used as the size of the fragment
+	Limit int `json:"limit"`
+	// HasMore is whether there may be more fragments after this one
+	HasMore bool `json:"has_more"`
 }
 
 // SyncFragNote represents a note in a sync fragment and contains only the necessary information
 // for the client to sync the note locally
 type SyncFragNote struct {
-	UUID      string    `json:"uuid"`
-	BookUUID  string    `json:"book_uuid"`
-	USN       int       `json:"usn"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	AddedOn   int64     `json:"added_on"`
-	EditedOn  int64     `json:"edited_on"`
-	Body      string    `json:"content"`
-	Public    bool      `json:"public"`
-	Deleted   bool      `json:"deleted"`
+	UUID       string    `json:"uuid"`
+	BookUUID   string    `json:"book_uuid"`
+	USN        int       `json:"usn"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	AddedOn    int64     `json:"added_on"`
+	EditedOn   int64     `json:"edited_on"`
+	Title      string    `json:"title"`
+	Body       string    `json:"content"`
+	Public     bool      `json:"public"`
+	Visibility string    `json:"visibility"`
+	Deleted    bool      `json:"deleted"`
+	Checksum   string    `json:"checksum,omitempty"`
+	// Author is the email of the user who wrote the note. It is given only for the notes in team books.
+	Author string `json:"author,omitempty"`
+	// Metadata is the key-value metadata of the note encrypted by a client
+	Metadata string `json:"metadata,omitempty"`
 }
 
 // NewFragNote presents the given note as a SyncFragNote
 func NewFragNote(note database.Note) SyncFragNote {
 	return SyncFragNote{
-		UUID:      note.UUID,
-		USN:       note.USN,
-		CreatedAt: note.CreatedAt,
-		UpdatedAt: note.UpdatedAt,
-		AddedOn:   note.AddedOn,
-		EditedOn:  note.EditedOn,
-		Body:      note.Body,
-		Public:    note.Public,
-		Deleted:   note.Deleted,
-		BookUUID:  note.BookUUID,
+		UUID:       note.UUID,
+		USN:        note.USN,
+		CreatedAt:  note.CreatedAt,
+		UpdatedAt:  note.UpdatedAt,
+		AddedOn:    note.AddedOn,
+		EditedOn:   note.EditedOn,
+		Title:      note.Title,
+		Body:       note.Body,
+		Public:     note.Public,
+		Visibility: note.Visibility,
+		Deleted:    note.Deleted,
+		BookUUID:   note.BookUUID,
+		Checksum:   note.Checksum,
+		Metadata:   note.Metadata,
 	}
 }
 
@@ -91,6 +106,8 @@ type SyncFragBook struct {
 	AddedOn   int64     `json:"added_on"`
 	Label     string    `json:"label"`
 	Deleted   bool      `json:"deleted"`
+	// Owner is the email of the owner of a team book owned by another user. It is empty otherwise.
+	Owner string `json:"owner,omitempty"`
 }
 
 // NewFragBook presents the given book as a SyncFragBook
@@ -121,15 +138,119 @@ func (e *queryParamError) Error() string {
 	return fmt.Sprintf("invalid query param %s=%s. %s", e.key, e.value, e.message)
 }
 
+// getNoteAuthors returns the emails of the authors of the given notes that are in team books,
+// keyed by the note uuids. A note without an author was written by the owner of the book.
+func (a *API) getNoteAuthors(notes []database.Note) (map[string]string, error) {
+	ret := map[string]string{}
+
+	var bookUUIDs []string
+	for _, note := range notes {
+		bookUUIDs = append(bookUUIDs, note.BookUUID)
+	}
+	if len(bookUUIDs) == 0 {
+		return ret, nil
+	}
+
+	var teamBookUUIDs []string
+	if err := a.App.DB.Model(&database.BookMember{}).Where("book_uuid IN (?)", bookUUIDs).Pluck("DISTINCT book_uuid", &teamBookUUIDs).Error; err != nil {
+		return nil, errors.Wrap(err, "finding the team books")
+	}
+	isTeamBook := map[string]bool{}
+	for _, uuid := range teamBookUUIDs {
+		isTeamBook[uuid] = true
+	}
+
+	authorIDs := map[string]int{}
+	var userIDs []int
+	for _, note := range notes {
+		if !isTeamBook[note.BookUUID] {
+			continue
+		}
+
+		id := note.AuthorID
+		if id == 0 {
+			id = note.UserID
+		}
+		authorIDs[note.UUID] = id
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) == 0 {
+		return ret, nil
+	}
+
+	var accounts []database.Account
+	if err := a.App.DB.Where("user_id IN (?)", userIDs).Find(&accounts).Error; err != nil {
+		return nil, errors.Wrap(err, "finding the accounts")
+	}
+	emails := map[int]string{}
+	for _, account := range accounts {
+		emails[account.UserID] = account.Email.String
+	}
+
+	for uuid, id := range authorIDs {
+		ret[uuid] = emails[id]
+	}
+
+	return ret, nil
+}
+
+// getBookOwners returns the emails of the owners of the given books that are owned by users other
+// than the user with the given id, keyed by the book uuids
+func (a *API) getBookOwners(books []database.Book, userID int) (map[string]string, error) {
+	ret := map[string]string{}
+
+	ownerIDs := map[string]int{}
+	var userIDs []int
+	for _, book := range books {
+		if book.UserID == userID {
+			continue
+		}
+
+		ownerIDs[book.UUID] = book.UserID
+		userIDs = append(userIDs, book.UserID)
+	}
+	if len(userIDs) == 0 {
+		return ret, nil
+	}
+
+	var accounts []database.Account
+	if err := a.App.DB.Where("user_id IN (?)", userIDs).Find(&accounts).Error; err != nil {
+		return nil, errors.Wrap(err, "finding the accounts")
+	}
+	emails := map[int]string{}
+	for _, account := range accounts {
+		emails[account.UserID] = account.Email.String
+	}
+
+	for uuid, id := range ownerIDs {
+		ret[uuid] = emails[id]
+	}
+
+	return ret, nil
+}
+
 func (a *API) newFragment(userID, userMaxUSN, afterUSN, limit int) (SyncFragment, error) {
 	var notes []database.Note
-	if err := a.App.DB.Where("user_id = ? AND usn > ? AND usn <= ?", userID, afterUSN, userMaxUSN).Order("usn ASC").Limit(limit).Find(&notes).Error; err != nil {
+	if err := a.App.DB.Scopes(database.AccessibleNotes(userID)).Where("usn > ? AND usn <= ?", afterUSN, userMaxUSN).Order("usn ASC").Limit(limit).Find(&notes).Error; err != nil {
 		return SyncFragment{}, nil
 	}
 	var books []database.Book
-	if err := a.App.DB.Where("user_id = ? AND usn > ? AND usn <= ?", userID, afterUSN, userMaxUSN).Order("usn ASC").Limit(limit).Find(&books).Error; err != nil {
+	if err := a.App.DB.Scopes(database.AccessibleBooks(userID)).Where("usn > ? AND usn <= ?", afterUSN, userMaxUSN).Order("usn ASC").Limit(limit).Find(&books).Error; err != nil {
 		return SyncFragment{}, nil
 	}
+	var expunges []database.Expunge
+	if err := a.App.DB.Where("user_id = ? AND usn > ? AND usn <= ?", userID, afterUSN, userMaxUSN).Order("usn ASC").Limit(limit).Find(&expunges).Error; err != nil {
+		return SyncFragment{}, errors.Wrap(err, "finding the expunges")
+	}
+
+	authors, err := a.getNoteAuthors(notes)
+	if err != nil {
+		return SyncFragment{}, errors.Wrap(err, "getting the note authors")
+	}
+	owners, err := a.getBookOwners(books, userID)
+	if err != nil {
+		return SyncFragment{}, errors.Wrap(err, "getting the book owners")
+	}
 
 	var items []usnItem
 	for _, note := range notes {
@@ -146,6 +267,13 @@ func (a *API) newFragment(userID, userMaxUSN, afterUSN, limit int) (SyncFragment
 		}
 		items = append(items, i)
 	}
+	for _, expunge := range expunges {
+		i := usnItem{
+			usn: expunge.USN,
+			val: expunge,
+		}
+		items = append(items, i)
+	}
 
 	// order by usn in ascending order
 	sort.Slice(items, func(i, j int) bool {
@@ -174,7 +302,10 @@ func (a *API) newFragment(userID, userMaxUSN, afterUSN, limit int) (SyncFragment
 			if note.Deleted {
 				fragExpungedNotes = append(fragExpungedNotes, note.UUID)
 			} else {
-				fragNotes = append(fragNotes, NewFragNote(note))
+				fragNote := NewFragNote(note)
+				fragNote.Author = authors[note.UUID]
+
+				fragNotes = append(fragNotes, fragNote)
 			}
 		case database.Book:
 			book := item.val.(database.Book)
@@ -182,7 +313,18 @@ func (a *API) newFragment(userID, userMaxUSN, afterUSN, limit int) (SyncFragment
 			if book.Deleted {
 				fragExpungedBooks = append(fragExpungedBooks, book.UUID)
 			} else {
-				fragBooks = append(fragBooks, NewFragBook(book))
+				fragBook := NewFragBook(book)
+				fragBook.Owner = owners[book.UUID]
+
+				fragBooks = append(fragBooks, fragBook)
+			}
+		case database.Expunge:
+			expunge := item.val.(database.Expunge)
+
+			if expunge.Type == database.ExpungeTypeBook {
+				fragExpungedBooks = append(fragExpungedBooks, expunge.UUID)
+			} else {
+				fragExpungedNotes = append(fragExpungedNotes, expunge.UUID)
 			}
 		default:
 			return SyncFragment{}, errors.Errorf("unknown internal item type %s", v)
@@ -197,6 +339,8 @@ func (a *API) newFragment(userID, userMaxUSN, afterUSN, limit int) (SyncFragment
 		Books:         fragBooks,
 		ExpungedNotes: fragExpungedNotes,
 		ExpungedBooks: fragExpungedBooks,
+		Limit:         limit,
+		HasMore:       fragMaxUSN > 0 && fragMaxUSN < userMaxUSN,
 	}
 
 	return ret, nil
@@ -64,7 +64,7 @@ func (a *App) DeleteBook(tx *gorm.DB, user database.User, book database.Book) (d
 		return book, errors.New("Not allowed")
 	}
 
-	nextUSN, err := incrementUserUSN(tx, user.ID)
+	nextUSN, err := incrementBookUSN(tx, book.UUID)
 	if err != nil {
 		return book, errors.Wrap(err, "incrementing user max_usn")
 	}
@@ -87,7 +87,7 @@ func (a *App) UpdateBook(tx *gorm.DB, user database.User, book database.Book, la
 		return book, errors.New("Not allowed")
 	}
 
-	nextUSN, err := incrementUserUSN(tx, user.ID)
+	nextUSN, err := incrementBookUSN(tx, book.UUID)
 	if err != nil {
 		return book, errors.Wrap(err, "incrementing user max_usn")
 	}
@@ -38,3 +38,80 @@ func incrementUserUSN(tx *gorm.DB, userID int) (int, error) {
 
 	return user.MaxUSN, nil
 }
+
+// bookParticipantIDs returns the ids of the owner and the members of the book with the given uuid
+func bookParticipantIDs(tx *gorm.DB, bookUUID string) ([]int, error) {
+	var book database.Book
+	if err := tx.Select("user_id").Where("uuid = ?", bookUUID).First(&book).Error; err != nil {
+		return nil, errors.Wrap(err, "finding the book")
+	}
+
+	var memberIDs []int
+	if err := tx.Model(&database.BookMember{}).Where("book_uuid = ?", bookUUID).Pluck("user_id", &memberIDs).Error; err != nil {
+		return nil, errors.Wrap(err, "finding the book members")
+	}
+
+	return append([]int{book.UserID}, memberIDs...), nil
+}
+
+// containsID returns true if the ids contain the given id
+func containsID(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unionIDs returns the ids in either of the given lists, without duplicates
+func unionIDs(a, b []int) []int {
+	ret := append([]int{}, a...)
+	for _, id := range b {
+		if !containsID(ret, id) {
+			ret = append(ret, id)
+		}
+	}
+
+	return ret
+}
+
+// reserveUSNs reserves n consecutive usns that are greater than the max_usn of all the given users,
+// moves the max_usn of all of them to the last one, and returns the first one. Every user hence
+// receives the items stamped with the reserved usns in the next sync fragments.
+func reserveUSNs(tx *gorm.DB, userIDs []int, n int) (int, error) {
+	if len(userIDs) == 1 && n == 1 {
+		return incrementUserUSN(tx, userIDs[0])
+	}
+
+	var users []database.User
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id, max_usn").Where("id IN (?)", userIDs).Order("id ASC").Find(&users).Error; err != nil {
+		return 0, errors.Wrap(err, "locking the users")
+	}
+
+	var maxUSN int
+	for _, u := range users {
+		if u.MaxUSN > maxUSN {
+			maxUSN = u.MaxUSN
+		}
+	}
+
+	last := maxUSN + n
+	if err := tx.Table("users").Where("id IN (?)", userIDs).Update("max_usn", last).Error; err != nil {
+		return 0, errors.Wrap(err, "updating the max_usn of the users")
+	}
+
+	return maxUSN + 1, nil
+}
+
+// incrementBookUSN returns the next usn for an item in the book with the given uuid. For a team book,
+// it is the next usn of all the participants so that every one of them receives the item.
+func incrementBookUSN(tx *gorm.DB, bookUUID string) (int, error) {
+	userIDs, err := bookParticipantIDs(tx, bookUUID)
+	if err != nil {
+		return 0, errors.Wrap(err, "finding the participants")
+	}
+
+	return reserveUSNs(tx, userIDs, 1)
+}
@@ -0,0 +1,174 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"github.com/dnote/dnote/pkg/server/database"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBookMemberExists is an error for adding a user who can already write to the book
+	ErrBookMemberExists = errors.New("The user is already a member of the book")
+	// ErrBookMemberNotFound is an error for removing a user who is not a member of the book
+	ErrBookMemberNotFound = errors.New("The user is not a member of the book")
+)
+
+// GetBookMembers returns the members of the book other than the owner
+func (a *App) GetBookMembers(book database.Book) ([]database.User, error) {
+	var users []database.User
+	if err := a.DB.Preload("Account").
+		Where("id IN (SELECT user_id FROM book_members WHERE book_uuid = ?)", book.UUID).
+		Order("id ASC").Find(&users).Error; err != nil {
+		return nil, errors.Wrap(err, "finding the members")
+	}
+
+	return users, nil
+}
+
+// AddBookMember lets the member write to the book of the user. The book and its notes are stamped
+// with new usns so that the member receives them in the next sync.
+func (a *App) AddBookMember(tx *gorm.DB, user database.User, book database.Book, member database.User) error {
+	if user.ID != book.UserID {
+		return errors.New("Not allowed")
+	}
+	if member.ID == book.UserID {
+		return ErrBookMemberExists
+	}
+
+	var count int
+	if err := tx.Model(&database.BookMember{}).Where("book_uuid = ? AND user_id = ?", book.UUID, member.ID).Count(&count).Error; err != nil {
+		return errors.Wrap(err, "counting the memberships")
+	}
+	if count > 0 {
+		return ErrBookMemberExists
+	}
+
+	m := database.BookMember{
+		BookUUID: book.UUID,
+		UserID:   member.ID,
+	}
+	if err := tx.Save(&m).Error; err != nil {
+		return errors.Wrap(err, "inserting the membership")
+	}
+
+	// the expunges from an earlier membership must not remove the book once it is received again
+	if err := tx.Where("user_id = ? AND (uuid = ? OR uuid IN (SELECT uuid FROM notes WHERE book_uuid = ?))", member.ID, book.UUID, book.UUID).
+		Delete(&database.Expunge{}).Error; err != nil {
+		return errors.Wrap(err, "deleting the expunges")
+	}
+
+	if err := restampBook(tx, book); err != nil {
+		return errors.Wrap(err, "stamping the book")
+	}
+
+	return nil
+}
+
+// RemoveBookMember stops the member from writing to the book. Only the owner can remove other
+// members, while members can remove themselves. The member receives expunges for the book and
+// its notes in the next sync so that they are removed from the member's devices.
+func (a *App) RemoveBookMember(tx *gorm.DB, user database.User, book database.Book, member database.User) error {
+	if user.ID != book.UserID && user.ID != member.ID {
+		return errors.New("Not allowed")
+	}
+
+	conn := tx.Where("book_uuid = ? AND user_id = ?", book.UUID, member.ID).Delete(&database.BookMember{})
+	if err := conn.Error; err != nil {
+		return errors.Wrap(err, "deleting the membership")
+	}
+	if conn.RowsAffected == 0 {
+		return ErrBookMemberNotFound
+	}
+
+	if err := expungeBook(tx, book, member); err != nil {
+		return errors.Wrap(err, "expunging the book for the member")
+	}
+
+	return nil
+}
+
+// expungeBook stamps expunges of the book and its notes with new usns of the given user
+func expungeBook(tx *gorm.DB, book database.Book, user database.User) error {
+	var noteUUIDs []string
+	if err := tx.Model(&database.Note{}).Where("book_uuid = ? AND NOT deleted", book.UUID).Order("usn ASC").Pluck("uuid", &noteUUIDs).Error; err != nil {
+		return errors.Wrap(err, "finding the notes")
+	}
+
+	usn, err := reserveUSNs(tx, []int{user.ID}, len(noteUUIDs)+1)
+	if err != nil {
+		return errors.Wrap(err, "reserving usns")
+	}
+
+	// the notes come first so that the book is never expunged before them
+	for i, uuid := range noteUUIDs {
+		e := database.Expunge{
+			UserID: user.ID,
+			Type:   database.ExpungeTypeNote,
+			UUID:   uuid,
+			USN:    usn + i,
+		}
+		if err := tx.Save(&e).Error; err != nil {
+			return errors.Wrap(err, "inserting the note expunge")
+		}
+	}
+
+	e := database.Expunge{
+		UserID: user.ID,
+		Type:   database.ExpungeTypeBook,
+		UUID:   book.UUID,
+		USN:    usn + len(noteUUIDs),
+	}
+	if err := tx.Save(&e).Error; err != nil {
+		return errors.Wrap(err, "inserting the book expunge")
+	}
+
+	return nil
+}
+
+// restampBook gives the book and all of its notes new usns reserved for all participants of the book
+func restampBook(tx *gorm.DB, book database.Book) error {
+	var noteIDs []int
+	if err := tx.Model(&database.Note{}).Where("book_uuid = ?", book.UUID).Order("usn ASC").Pluck("id", &noteIDs).Error; err != nil {
+		return errors.Wrap(err, "finding the notes")
+	}
+
+	userIDs, err := bookParticipantIDs(tx, book.UUID)
+	if err != nil {
+		return errors.Wrap(err, "finding the participants")
+	}
+
+	usn, err := reserveUSNs(tx, userIDs, len(noteIDs)+1)
+	if err != nil {
+		return errors.Wrap(err, "reserving usns")
+	}
+
+	// the book comes first so that the notes are never synced before it
+	if err := tx.Model(&database.Book{}).Where("id = ?", book.ID).Update("usn", usn).Error; err != nil {
+		return errors.Wrap(err, "updating the book usn")
+	}
+	for i, id := range noteIDs {
+		if err := tx.Model(&database.Note{}).Where("id = ?", id).Update("usn", usn+i+1).Error; err != nil {
+			return errors.Wrap(err, "updating the note usn")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/server/database"
+	"github.com/dnote/dnote/pkg/server/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestAddBookMember(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	owner := testutils.SetupUserData()
+	testutils.MustExec(t, testutils.DB.Model(&owner).Update("max_usn", 10), "preparing owner max_usn")
+	member := testutils.SetupUserData()
+	testutils.MustExec(t, testutils.DB.Model(&member).Update("max_usn", 25), "preparing member max_usn")
+
+	b1 := database.Book{UserID: owner.ID, Label: "team", USN: 1}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+	n1 := database.Note{UserID: owner.ID, BookUUID: b1.UUID, Body: "n1", USN: 2}
+	testutils.MustExec(t, testutils.DB.Save(&n1), "preparing n1")
+
+	a := NewTest(nil)
+
+	tx := testutils.DB.Begin()
+	if err := a.AddBookMember(tx, owner, b1, member); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "adding member"))
+	}
+	tx.Commit()
+
+	var ownerRecord, memberRecord database.User
+	var b1Record database.Book
+	var n1Record database.Note
+	testutils.MustExec(t, testutils.DB.Where("id = ?", owner.ID).First(&ownerRecord), "finding owner")
+	testutils.MustExec(t, testutils.DB.Where("id = ?", member.ID).First(&memberRecord), "finding member")
+	testutils.MustExec(t, testutils.DB.Where("id = ?", b1.ID).First(&b1Record), "finding b1")
+	testutils.MustExec(t, testutils.DB.Where("id = ?", n1.ID).First(&n1Record), "finding n1")
+
+	assert.Equal(t, b1Record.USN, 26, "b1 usn mismatch")
+	assert.Equal(t, n1Record.USN, 27, "n1 usn mismatch")
+	assert.Equal(t, ownerRecord.MaxUSN, 27, "owner max_usn mismatch")
+	assert.Equal(t, memberRecord.MaxUSN, 27, "member max_usn mismatch")
+
+	// a note written by the member belongs to the owner and is received by both
+	note, err := a.CreateNote(member, b1.UUID, "", "n2", nil, nil, false, "")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating note"))
+	}
+
+	assert.Equal(t, note.USN, 28, "note usn mismatch")
+	assert.Equal(t, note.UserID, owner.ID, "note user_id mismatch")
+	assert.Equal(t, note.AuthorID, member.ID, "note author_id mismatch")
+
+	tx = testutils.DB.Begin()
+	if err := a.AddBookMember(tx, owner, b1, member); errors.Cause(err) != ErrBookMemberExists {
+		t.Errorf("expected ErrBookMemberExists but got %v", err)
+	}
+	tx.Rollback()
+}
+
+func TestRemoveBookMember(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	owner := testutils.SetupUserData()
+	member := testutils.SetupUserData()
+	stranger := testutils.SetupUserData()
+
+	b1 := database.Book{UserID: owner.ID, Label: "team"}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+	n1 := database.Note{UserID: owner.ID, BookUUID: b1.UUID, Body: "n1"}
+	testutils.MustExec(t, testutils.DB.Save(&n1), "preparing n1")
+	m := database.BookMember{BookUUID: b1.UUID, UserID: member.ID}
+	testutils.MustExec(t, testutils.DB.Save(&m), "preparing membership")
+
+	a := NewTest(nil)
+
+	tx := testutils.DB.Begin()
+	if err := a.RemoveBookMember(tx, stranger, b1, member); err == nil {
+		t.Error("expected an error for removing a member as a stranger")
+	}
+	tx.Rollback()
+
+	tx = testutils.DB.Begin()
+	if err := a.RemoveBookMember(tx, member, b1, member); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "leaving the book"))
+	}
+	tx.Commit()
+
+	var count int
+	testutils.MustExec(t, testutils.DB.Model(&database.BookMember{}).Count(&count), "counting memberships")
+	assert.Equal(t, count, 0, "membership count mismatch")
+
+	var memberRecord database.User
+	var expunges []database.Expunge
+	testutils.MustExec(t, testutils.DB.Where("id = ?", member.ID).First(&memberRecord), "finding member")
+	testutils.MustExec(t, testutils.DB.Order("usn ASC").Find(&expunges), "finding expunges")
+
+	assert.Equal(t, memberRecord.MaxUSN, 2, "member max_usn mismatch")
+	assert.Equal(t, len(expunges), 2, "expunge count mismatch")
+	assert.Equal(t, expunges[0].UserID, member.ID, "expunges[0] user_id mismatch")
+	assert.Equal(t, expunges[0].Type, database.ExpungeTypeNote, "expunges[0] type mismatch")
+	assert.Equal(t, expunges[0].UUID, n1.UUID, "expunges[0] uuid mismatch")
+	assert.Equal(t, expunges[0].USN, 1, "expunges[0] usn mismatch")
+	assert.Equal(t, expunges[1].UserID, member.ID, "expunges[1] user_id mismatch")
+	assert.Equal(t, expunges[1].Type, database.ExpungeTypeBook, "expunges[1] type mismatch")
+	assert.Equal(t, expunges[1].UUID, b1.UUID, "expunges[1] uuid mismatch")
+	assert.Equal(t, expunges[1].USN, 2, "expunges[1] usn mismatch")
+
+	// adding the member again drops the expunges so that the book is not removed once it is received
+	tx = testutils.DB.Begin()
+	if err := a.AddBookMember(tx, owner, b1, member); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "adding the member again"))
+	}
+	tx.Commit()
+
+	testutils.MustExec(t, testutils.DB.Model(&database.Expunge{}).Count(&count), "counting expunges")
+	assert.Equal(t, count, 0, "expunge count mismatch after adding the member again")
+}
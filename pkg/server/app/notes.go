@@ -25,12 +25,19 @@ import (
 	"github.com/pkg/errors"
 )
 
-// CreateNote creates a note with the next usn and updates the user's max_usn.
-// It returns the created note.
-func (a *App) CreateNote(user database.User, bookUUID, content string, addedOn *int64, editedOn *int64, public bool, client string) (database.Note, error) {
+// CreateNote creates a note with the next usn and updates the user's max_usn. An empty title
+// is inferred from the content. The note belongs to the owner of the book and the user is
+// recorded as its author. It returns the created note.
+func (a *App) CreateNote(user database.User, bookUUID, title, content string, addedOn *int64, editedOn *int64, public bool, client string) (database.Note, error) {
 	tx := a.DB.Begin()
 
-	nextUSN, err := incrementUserUSN(tx, user.ID)
+	var book database.Book
+	if err := tx.Where("uuid = ?", bookUUID).First(&book).Error; err != nil {
+		tx.Rollback()
+		return database.Note{}, errors.Wrap(err, "finding the book")
+	}
+
+	nextUSN, err := incrementBookUSN(tx, bookUUID)
 	if err != nil {
 		tx.Rollback()
 		return database.Note{}, errors.Wrap(err, "incrementing user max_usn")
@@ -55,17 +62,25 @@ func (a *App) CreateNote(user database.User, bookUUID, content string, addedOn *
 		return database.Note{}, err
 	}
 
+	if title == "" {
+		title = helpers.InferTitle(content)
+	}
+
 	note := database.Note{
-		UUID:      uuid,
-		BookUUID:  bookUUID,
-		UserID:    user.ID,
-		AddedOn:   noteAddedOn,
-		EditedOn:  noteEditedOn,
-		USN:       nextUSN,
-		Body:      content,
-		Public:    public,
-		Encrypted: false,
-		Client:    client,
+		UUID:       uuid,
+		BookUUID:   bookUUID,
+		Title:      title,
+		UserID:     book.UserID,
+		AuthorID:   user.ID,
+		AddedOn:    noteAddedOn,
+		EditedOn:   noteEditedOn,
+		USN:        nextUSN,
+		Body:       content,
+		Public:     public,
+		Visibility: visibilityFromPublic(public),
+		Encrypted:  false,
+		Client:     client,
+		Checksum:   helpers.Checksum(content),
 	}
 	if err := tx.Create(&note).Error; err != nil {
 		tx.Rollback()
@@ -80,8 +95,23 @@ func (a *App) CreateNote(user database.User, bookUUID, content string, addedOn *
 // UpdateNoteParams is the parameters for updating a note
 type UpdateNoteParams struct {
 	BookUUID *string
+	Title    *string
 	Content  *string
 	Public   *bool
+	// Visibility takes precedence over Public if both are given
+	Visibility *string
+	// Metadata is the metadata encrypted by the client
+	Metadata *string
+}
+
+// visibilityFromPublic returns the visibility for the public field sent by the clients that
+// predate the visibility. A note shared by them is unlisted rather than listed.
+func visibilityFromPublic(public bool) string {
+	if public {
+		return database.NoteVisibilityUnlisted
+	}
+
+	return database.NoteVisibilityPrivate
 }
 
 // GetBookUUID gets the bookUUID from the UpdateNoteParams
@@ -93,6 +123,15 @@ func (r UpdateNoteParams) GetBookUUID() string {
 	return *r.BookUUID
 }
 
+// GetTitle gets the title from the UpdateNoteParams
+func (r UpdateNoteParams) GetTitle() string {
+	if r.Title == nil {
+		return ""
+	}
+
+	return *r.Title
+}
+
 // GetContent gets the content from the UpdateNoteParams
 func (r UpdateNoteParams) GetContent() string {
 	if r.Content == nil {
@@ -111,23 +150,121 @@ func (r UpdateNoteParams) GetPublic() bool {
 	return *r.Public
 }
 
-// UpdateNote creates a note with the next usn and updates the user's max_usn
+// GetVisibility gets the visibility from the UpdateNoteParams
+func (r UpdateNoteParams) GetVisibility() string {
+	if r.Visibility == nil {
+		return ""
+	}
+
+	return *r.Visibility
+}
+
+var (
+	// ErrBookNotFound is an error for a book that does not exist or that the user cannot write to
+	ErrBookNotFound = errors.New("The book was not found")
+	// ErrNoteMoveNotAllowed is an error for moving a note of another user into a book of yet another user
+	ErrNoteMoveNotAllowed = errors.New("Only the owner of the note can move it into a book of another user")
+)
+
+// UpdateNote creates a note with the next usn and updates the user's max_usn. The user must be
+// able to write to the book of the note, and to the book it is moved to. A note moved to a book
+// of another user changes hands to the owner of that book, which only the owner of the note can
+// do. The participants of the old book who cannot read the note anymore receive an expunge for it.
 func (a *App) UpdateNote(tx *gorm.DB, user database.User, note database.Note, p *UpdateNoteParams) (database.Note, error) {
-	nextUSN, err := incrementUserUSN(tx, user.ID)
+	userIDs, err := bookParticipantIDs(tx, note.BookUUID)
 	if err != nil {
-		return note, errors.Wrap(err, "incrementing user max_usn")
+		return note, errors.Wrap(err, "finding the participants")
 	}
+	if !containsID(userIDs, user.ID) {
+		return note, ErrBookNotFound
+	}
+
+	var lostIDs []int
+	if p.BookUUID != nil && p.GetBookUUID() != note.BookUUID {
+		var book database.Book
+		conn := tx.Select("user_id").Where("uuid = ?", p.GetBookUUID()).First(&book)
+		if conn.RecordNotFound() {
+			return note, ErrBookNotFound
+		}
+		if err := conn.Error; err != nil {
+			return note, errors.Wrap(err, "finding the book")
+		}
 
-	if p.BookUUID != nil {
+		newIDs, err := bookParticipantIDs(tx, p.GetBookUUID())
+		if err != nil {
+			return note, errors.Wrap(err, "finding the participants of the book")
+		}
+		if !containsID(newIDs, user.ID) {
+			return note, ErrBookNotFound
+		}
+		if book.UserID != note.UserID && user.ID != note.UserID {
+			return note, ErrNoteMoveNotAllowed
+		}
+
+		for _, id := range userIDs {
+			if !containsID(newIDs, id) {
+				lostIDs = append(lostIDs, id)
+			}
+		}
+
+		// the expunges from an earlier move must not remove the note once it is received again
+		if err := tx.Where("user_id IN (?) AND uuid = ?", newIDs, note.UUID).Delete(&database.Expunge{}).Error; err != nil {
+			return note, errors.Wrap(err, "deleting the expunges")
+		}
+
+		userIDs = unionIDs(userIDs, newIDs)
 		note.BookUUID = p.GetBookUUID()
+		note.UserID = book.UserID
 	}
+
+	// the participants of the old book receive the usn as well, so that they sync the move
+	nextUSN, err := reserveUSNs(tx, userIDs, 1)
+	if err != nil {
+		return note, errors.Wrap(err, "incrementing user max_usn")
+	}
+
+	for _, id := range lostIDs {
+		e := database.Expunge{
+			UserID: id,
+			Type:   database.ExpungeTypeNote,
+			UUID:   note.UUID,
+			USN:    nextUSN,
+		}
+		if err := tx.Save(&e).Error; err != nil {
+			return note, errors.Wrap(err, "inserting the note expunge")
+		}
+	}
+
 	if p.Content != nil {
+		// a title inferred from the old content is inferred again from the new one
+		if note.Title == "" || note.Title == helpers.InferTitle(note.Body) {
+			note.Title = helpers.InferTitle(p.GetContent())
+		}
+
 		note.Body = p.GetContent()
+		note.Checksum = helpers.Checksum(note.Body)
+	}
+	if p.Title != nil {
+		note.Title = p.GetTitle()
+		if note.Title == "" {
+			note.Title = helpers.InferTitle(note.Body)
+		}
 	}
-	if p.Public != nil {
+	if p.Visibility != nil {
+		note.Visibility = p.GetVisibility()
+		note.Public = note.Visibility != database.NoteVisibilityPrivate
+	} else if p.Public != nil {
+		// a listed note stays listed if a legacy client keeps it public
+		if !p.GetPublic() || note.Visibility == database.NoteVisibilityPrivate || note.Visibility == "" {
+			note.Visibility = visibilityFromPublic(p.GetPublic())
+		}
 		note.Public = p.GetPublic()
 	}
 
+	if p.Metadata != nil {
+		note.Metadata = *p.Metadata
+	}
+
 	note.USN = nextUSN
 	note.EditedOn = a.Clock.Now().UnixNano()
 	note.Deleted = false
@@ -143,16 +280,18 @@ func (a *App) UpdateNote(tx *gorm.DB, user database.User, note database.Note, p
 
 // DeleteNote marks a note deleted with the next usn and updates the user's max_usn
 func (a *App) DeleteNote(tx *gorm.DB, user database.User, note database.Note) (database.Note, error) {
-	nextUSN, err := incrementUserUSN(tx, user.ID)
+	nextUSN, err := incrementBookUSN(tx, note.BookUUID)
 	if err != nil {
 		return note, errors.Wrap(err, "incrementing user max_usn")
 	}
 
 	if err := tx.Model(&note).
 		Update(map[string]interface{}{
-			"usn":     nextUSN,
-			"deleted": true,
-			"body":    "",
+			"usn":      nextUSN,
+			"deleted":  true,
+			"title":    "",
+			"body":     "",
+			"checksum": "",
 		}).Error; err != nil {
 		return note, errors.Wrap(err, "deleting note")
 	}
@@ -90,7 +90,7 @@ func TestCreateNote(t *testing.T) {
 			})
 
 			tx := testutils.DB.Begin()
-			if _, err := a.CreateNote(user, b1.UUID, "note content", tc.addedOn, tc.editedOn, false, ""); err != nil {
+			if _, err := a.CreateNote(user, b1.UUID, "", "note content", tc.addedOn, tc.editedOn, false, ""); err != nil {
 				tx.Rollback()
 				t.Fatal(errors.Wrap(err, "deleting note"))
 			}
@@ -109,6 +109,7 @@ func TestCreateNote(t *testing.T) {
 			assert.Equal(t, noteCount, 1, "note count mismatch")
 			assert.NotEqual(t, noteRecord.UUID, "", "note UUID should have been generated")
 			assert.Equal(t, noteRecord.UserID, user.ID, "note UserID mismatch")
+			assert.Equal(t, noteRecord.Title, "note content", "note Title mismatch")
 			assert.Equal(t, noteRecord.Body, "note content", "note Body mismatch")
 			assert.Equal(t, noteRecord.Deleted, false, "note Deleted mismatch")
 			assert.Equal(t, noteRecord.USN, tc.expectedUSN, "note Label mismatch")
@@ -182,6 +183,7 @@ func TestUpdateNote(t *testing.T) {
 			assert.Equal(t, bookCount, 1, "book count mismatch")
 			assert.Equal(t, noteCount, 1, "note count mismatch")
 			assert.Equal(t, noteRecord.UserID, user.ID, "note UserID mismatch")
+			assert.Equal(t, noteRecord.Title, content, "note Title mismatch")
 			assert.Equal(t, noteRecord.Body, content, "note Body mismatch")
 			assert.Equal(t, noteRecord.Public, public, "note Public mismatch")
 			assert.Equal(t, noteRecord.Deleted, false, "note Deleted mismatch")
@@ -191,6 +193,180 @@ func TestUpdateNote(t *testing.T) {
 	}
 }
 
+func TestUpdateNote_metadata(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	user := testutils.SetupUserData()
+
+	b1 := database.Book{UserID: user.ID, Label: "js", Deleted: false}
+	testutils.MustExec(t, testutils.DB.Save(&b1), "preparing b1")
+
+	note := database.Note{UserID: user.ID, Deleted: false, Body: "test content", BookUUID: b1.UUID, Metadata: "old-blob"}
+	testutils.MustExec(t, testutils.DB.Save(&note), "preparing note")
+
+	a := NewTest(&App{
+		Clock: clock.NewMock(),
+	})
+
+	content := "updated test content"
+	tx := testutils.DB.Begin()
+	if _, err := a.UpdateNote(tx, user, note, &UpdateNoteParams{
+		Content: &content,
+	}); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "updating the content"))
+	}
+	tx.Commit()
+
+	var noteRecord database.Note
+	testutils.MustExec(t, testutils.DB.First(&noteRecord), "finding the note")
+	assert.Equal(t, noteRecord.Metadata, "old-blob", "metadata mismatch after updating the content")
+
+	metadata := "new-blob"
+	tx = testutils.DB.Begin()
+	if _, err := a.UpdateNote(tx, user, noteRecord, &UpdateNoteParams{
+		Metadata: &metadata,
+	}); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "updating the metadata"))
+	}
+	tx.Commit()
+
+	testutils.MustExec(t, testutils.DB.First(&noteRecord), "finding the note again")
+	assert.Equal(t, noteRecord.Metadata, "new-blob", "metadata mismatch")
+	assert.Equal(t, noteRecord.Body, content, "body mismatch")
+}
+
+func TestUpdateNote_moveOutOfTeamBook(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	owner := testutils.SetupUserData()
+	testutils.MustExec(t, testutils.DB.Model(&owner).Update("max_usn", 10), "preparing owner max_usn")
+	member := testutils.SetupUserData()
+	testutils.MustExec(t, testutils.DB.Model(&member).Update("max_usn", 20), "preparing member max_usn")
+
+	team := database.Book{UserID: owner.ID, Label: "team"}
+	testutils.MustExec(t, testutils.DB.Save(&team), "preparing the team book")
+	private := database.Book{UserID: owner.ID, Label: "private"}
+	testutils.MustExec(t, testutils.DB.Save(&private), "preparing the private book")
+	m := database.BookMember{BookUUID: team.UUID, UserID: member.ID}
+	testutils.MustExec(t, testutils.DB.Save(&m), "preparing the membership")
+	n1 := database.Note{UserID: owner.ID, BookUUID: team.UUID, Body: "n1"}
+	testutils.MustExec(t, testutils.DB.Save(&n1), "preparing n1")
+
+	a := NewTest(&App{
+		Clock: clock.NewMock(),
+	})
+
+	bookUUID := private.UUID
+	tx := testutils.DB.Begin()
+	if _, err := a.UpdateNote(tx, owner, n1, &UpdateNoteParams{BookUUID: &bookUUID}); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "moving the note"))
+	}
+	tx.Commit()
+
+	var n1Record database.Note
+	var ownerRecord, memberRecord database.User
+	var expunges []database.Expunge
+	testutils.MustExec(t, testutils.DB.Where("id = ?", n1.ID).First(&n1Record), "finding n1")
+	testutils.MustExec(t, testutils.DB.Where("id = ?", owner.ID).First(&ownerRecord), "finding owner")
+	testutils.MustExec(t, testutils.DB.Where("id = ?", member.ID).First(&memberRecord), "finding member")
+	testutils.MustExec(t, testutils.DB.Find(&expunges), "finding expunges")
+
+	assert.Equal(t, n1Record.BookUUID, private.UUID, "n1 book_uuid mismatch")
+	assert.Equal(t, n1Record.UserID, owner.ID, "n1 user_id mismatch")
+	assert.Equal(t, n1Record.USN, 21, "n1 usn mismatch")
+	assert.Equal(t, ownerRecord.MaxUSN, 21, "owner max_usn mismatch")
+	assert.Equal(t, memberRecord.MaxUSN, 21, "member max_usn mismatch")
+
+	// the member cannot read the note anymore, and removes it in the next sync
+	assert.Equal(t, len(expunges), 1, "expunge count mismatch")
+	assert.Equal(t, expunges[0].UserID, member.ID, "expunge user_id mismatch")
+	assert.Equal(t, expunges[0].Type, database.ExpungeTypeNote, "expunge type mismatch")
+	assert.Equal(t, expunges[0].UUID, n1.UUID, "expunge uuid mismatch")
+	assert.Equal(t, expunges[0].USN, 21, "expunge usn mismatch")
+
+	// moving it back into the team book lets the member receive it again
+	bookUUID = team.UUID
+	tx = testutils.DB.Begin()
+	if _, err := a.UpdateNote(tx, owner, n1Record, &UpdateNoteParams{BookUUID: &bookUUID}); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "moving the note back"))
+	}
+	tx.Commit()
+
+	var expungeCount int
+	testutils.MustExec(t, testutils.DB.Model(&database.Expunge{}).Count(&expungeCount), "counting expunges")
+	assert.Equal(t, expungeCount, 0, "expunge count mismatch after moving back")
+}
+
+func TestUpdateNote_movePermission(t *testing.T) {
+	defer testutils.ClearData(testutils.DB)
+
+	owner := testutils.SetupUserData()
+	member := testutils.SetupUserData()
+	stranger := testutils.SetupUserData()
+
+	team := database.Book{UserID: owner.ID, Label: "team"}
+	testutils.MustExec(t, testutils.DB.Save(&team), "preparing the team book")
+	memberBook := database.Book{UserID: member.ID, Label: "mine"}
+	testutils.MustExec(t, testutils.DB.Save(&memberBook), "preparing the book of the member")
+	strangerBook := database.Book{UserID: stranger.ID, Label: "other"}
+	testutils.MustExec(t, testutils.DB.Save(&strangerBook), "preparing the book of the stranger")
+	m := database.BookMember{BookUUID: team.UUID, UserID: member.ID}
+	testutils.MustExec(t, testutils.DB.Save(&m), "preparing the membership")
+	n1 := database.Note{UserID: owner.ID, BookUUID: team.UUID, Body: "n1"}
+	testutils.MustExec(t, testutils.DB.Save(&n1), "preparing n1")
+
+	a := NewTest(&App{
+		Clock: clock.NewMock(),
+	})
+
+	testCases := []struct {
+		name     string
+		user     database.User
+		bookUUID string
+		expected error
+	}{
+		{
+			name:     "member moves the note of the owner into the book of the member",
+			user:     member,
+			bookUUID: memberBook.UUID,
+			expected: ErrNoteMoveNotAllowed,
+		},
+		{
+			name:     "owner moves the note into a book that the owner cannot write to",
+			user:     owner,
+			bookUUID: strangerBook.UUID,
+			expected: ErrBookNotFound,
+		},
+		{
+			name:     "stranger moves the note",
+			user:     stranger,
+			bookUUID: strangerBook.UUID,
+			expected: ErrBookNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bookUUID := tc.bookUUID
+
+			tx := testutils.DB.Begin()
+			_, err := a.UpdateNote(tx, tc.user, n1, &UpdateNoteParams{BookUUID: &bookUUID})
+			tx.Rollback()
+
+			assert.Equal(t, errors.Cause(err), tc.expected, "error mismatch")
+
+			var n1Record database.Note
+			testutils.MustExec(t, testutils.DB.Where("id = ?", n1.ID).First(&n1Record), "finding n1")
+			assert.Equal(t, n1Record.BookUUID, team.UUID, "n1 book_uuid mismatch")
+			assert.Equal(t, n1Record.UserID, owner.ID, "n1 user_id mismatch")
+		})
+	}
+}
+
 func TestDeleteNote(t *testing.T) {
 	testCases := []struct {
 		userUSN     int
@@ -27,27 +27,100 @@ import (
 	"github.com/pkg/errors"
 )
 
+var (
+	// ErrInvalidRefreshToken is an error for a refresh token that is unknown, expired,
+	// or already used
+	ErrInvalidRefreshToken = errors.New("The session could not be renewed. Please sign in again")
+)
+
+const (
+	// sessionDuration is the duration for which a session is valid
+	sessionDuration = 24 * 100 * time.Hour
+	// refreshDuration is the duration for which a session can be renewed
+	refreshDuration = 24 * 365 * time.Hour
+)
+
 // CreateSession returns a new session for the user of the given id
 func (a *App) CreateSession(userID int) (database.Session, error) {
+	return createSession(a.DB, userID)
+}
+
+func createSession(db *gorm.DB, userID int) (database.Session, error) {
 	key, err := crypt.GetRandomStr(32)
 	if err != nil {
 		return database.Session{}, errors.Wrap(err, "generating key")
 	}
+	refreshToken, err := crypt.GetRandomStr(32)
+	if err != nil {
+		return database.Session{}, errors.Wrap(err, "generating refresh token")
+	}
 
+	now := time.Now()
 	session := database.Session{
-		UserID:     userID,
-		Key:        key,
-		LastUsedAt: time.Now(),
-		ExpiresAt:  time.Now().Add(24 * 100 * time.Hour),
+		UserID:           userID,
+		Key:              key,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(sessionDuration),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: now.Add(refreshDuration),
 	}
 
-	if err := a.DB.Save(&session).Error; err != nil {
+	if err := db.Save(&session).Error; err != nil {
 		return database.Session{}, errors.Wrap(err, "saving session")
 	}
 
 	return session, nil
 }
 
+// RefreshSession replaces the session with the given refresh token by a new session
+// with a new refresh token, so that each refresh token can be used only once. The
+// session may have expired, but not its refresh token.
+func (a *App) RefreshSession(refreshToken string) (database.Session, error) {
+	if refreshToken == "" {
+		return database.Session{}, ErrInvalidRefreshToken
+	}
+
+	tx := a.DB.Begin()
+
+	var old database.Session
+	conn := tx.Where("refresh_token = ?", refreshToken).First(&old)
+	if conn.RecordNotFound() {
+		tx.Rollback()
+		return database.Session{}, ErrInvalidRefreshToken
+	} else if conn.Error != nil {
+		tx.Rollback()
+		return database.Session{}, errors.Wrap(conn.Error, "finding the session")
+	}
+
+	if old.RefreshExpiresAt.Before(time.Now()) {
+		tx.Rollback()
+		return database.Session{}, ErrInvalidRefreshToken
+	}
+
+	// a concurrent refresh with the same token deletes nothing and fails
+	res := tx.Where("id = ?", old.ID).Delete(&database.Session{})
+	if res.Error != nil {
+		tx.Rollback()
+		return database.Session{}, errors.Wrap(res.Error, "deleting the old session")
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return database.Session{}, ErrInvalidRefreshToken
+	}
+
+	session, err := createSession(tx, old.UserID)
+	if err != nil {
+		tx.Rollback()
+		return database.Session{}, errors.Wrap(err, "creating a session")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return database.Session{}, errors.Wrap(err, "committing a transaction")
+	}
+
+	return session, nil
+}
+
 // DeleteUserSessions deletes all existing sessions for the given user. It effectively
 // invalidates all existing sessions.
 func (a *App) DeleteUserSessions(db *gorm.DB, userID int) error {
@@ -0,0 +1,153 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dnote/dnote/pkg/assert"
+	"github.com/dnote/dnote/pkg/server/database"
+	"github.com/dnote/dnote/pkg/server/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestRefreshSession(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		defer testutils.ClearData(testutils.DB)
+
+		user := testutils.SetupUserData()
+		old := database.Session{
+			UserID:           user.ID,
+			Key:              "old-key",
+			ExpiresAt:        time.Now().Add(-time.Hour),
+			RefreshToken:     "old-refresh-token",
+			RefreshExpiresAt: time.Now().Add(time.Hour),
+		}
+		testutils.MustExec(t, testutils.DB.Save(&old), "preparing the session")
+
+		a := NewTest(nil)
+
+		// execute
+		got, err := a.RefreshSession("old-refresh-token")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		var sessionCount int
+		var session database.Session
+		testutils.MustExec(t, testutils.DB.Model(&database.Session{}).Count(&sessionCount), "counting sessions")
+		testutils.MustExec(t, testutils.DB.First(&session), "finding the session")
+
+		assert.Equal(t, sessionCount, 1, "session count mismatch")
+		assert.Equal(t, session.ID, got.ID, "session id mismatch")
+		assert.Equal(t, session.UserID, user.ID, "session user mismatch")
+		assert.NotEqual(t, session.Key, "old-key", "the key should be new")
+		assert.NotEqual(t, session.RefreshToken, "old-refresh-token", "the refresh token should be new")
+		assert.NotEqual(t, session.RefreshToken, "", "the refresh token should be set")
+		assert.Equal(t, session.ExpiresAt.After(time.Now()), true, "the session should not be expired")
+	})
+
+	t.Run("used twice", func(t *testing.T) {
+		defer testutils.ClearData(testutils.DB)
+
+		user := testutils.SetupUserData()
+		old := database.Session{
+			UserID:           user.ID,
+			Key:              "old-key",
+			ExpiresAt:        time.Now().Add(-time.Hour),
+			RefreshToken:     "old-refresh-token",
+			RefreshExpiresAt: time.Now().Add(time.Hour),
+		}
+		testutils.MustExec(t, testutils.DB.Save(&old), "preparing the session")
+
+		a := NewTest(nil)
+		if _, err := a.RefreshSession("old-refresh-token"); err != nil {
+			t.Fatal(errors.Wrap(err, "refreshing for the first time"))
+		}
+
+		// execute
+		_, err := a.RefreshSession("old-refresh-token")
+
+		// test
+		assert.Equal(t, err, ErrInvalidRefreshToken, "error mismatch")
+
+		var sessionCount int
+		testutils.MustExec(t, testutils.DB.Model(&database.Session{}).Count(&sessionCount), "counting sessions")
+		assert.Equal(t, sessionCount, 1, "session count mismatch")
+	})
+
+	testCases := []struct {
+		name         string
+		refreshToken string
+		expiresAt    time.Time
+	}{
+		{
+			name:         "expired",
+			refreshToken: "old-refresh-token",
+			expiresAt:    time.Now().Add(-time.Minute),
+		},
+		{
+			name:         "unknown",
+			refreshToken: "unknown-refresh-token",
+			expiresAt:    time.Now().Add(time.Hour),
+		},
+		{
+			name:         "empty",
+			refreshToken: "",
+			expiresAt:    time.Now().Add(time.Hour),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer testutils.ClearData(testutils.DB)
+
+			user := testutils.SetupUserData()
+			old := database.Session{
+				UserID:           user.ID,
+				Key:              "old-key",
+				ExpiresAt:        time.Now().Add(-time.Hour),
+				RefreshToken:     "old-refresh-token",
+				RefreshExpiresAt: tc.expiresAt,
+			}
+			testutils.MustExec(t, testutils.DB.Save(&old), "preparing the session")
+			legacy := database.Session{
+				UserID:    user.ID,
+				Key:       "legacy-key",
+				ExpiresAt: time.Now().Add(-time.Hour),
+			}
+			testutils.MustExec(t, testutils.DB.Save(&legacy), "preparing a session without a refresh token")
+
+			a := NewTest(nil)
+
+			// execute
+			_, err := a.RefreshSession(tc.refreshToken)
+
+			// test
+			assert.Equal(t, err, ErrInvalidRefreshToken, "error mismatch")
+
+			var sessionCount int
+			testutils.MustExec(t, testutils.DB.Model(&database.Session{}).Count(&sessionCount), "counting sessions")
+			assert.Equal(t, sessionCount, 2, "session count mismatch")
+		})
+	}
+}
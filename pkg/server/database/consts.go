@@ -35,3 +35,24 @@ const (
 	// BookDomainExluding incidates that all books except for some specified books are eligible to be the source books
 	BookDomainExluding = "excluding"
 )
+
+const (
+	// NoteVisibilityPrivate indicates that only the owner can see a note
+	NoteVisibilityPrivate = "private"
+	// NoteVisibilityUnlisted indicates that anyone with the link can see a note
+	NoteVisibilityUnlisted = "unlisted"
+	// NoteVisibilityPublic indicates that anyone can see a note and that it is listed on the profile of the owner
+	NoteVisibilityPublic = "public"
+)
+
+// IsNoteVisibility returns whether the given value is a valid note visibility
+func IsNoteVisibility(v string) bool {
+	return v == NoteVisibilityPrivate || v == NoteVisibilityUnlisted || v == NoteVisibilityPublic
+}
+
+const (
+	// ExpungeTypeBook indicates that an expunge removes a book
+	ExpungeTypeBook = "book"
+	// ExpungeTypeNote indicates that an expunge removes a note
+	ExpungeTypeNote = "note"
+)
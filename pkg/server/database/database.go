@@ -41,6 +41,8 @@ func InitSchema(db *gorm.DB) {
 	if err := db.AutoMigrate(
 		Note{},
 		Book{},
+		BookMember{},
+		Expunge{},
 		User{},
 		Account{},
 		Notification{},
@@ -0,0 +1,10 @@
+-- populate-note-titles.sql fills the titles of existing notes from the first non-empty line
+-- of their bodies, stripping any markdown heading prefix.
+
+-- +migrate Up
+
+UPDATE notes
+SET title = regexp_replace(regexp_replace(substring(body FROM '[^\r\n]*\S[^\r\n]*'), '^\s+|\s+$', '', 'g'), '^#+\s+', '')
+WHERE title = '' AND deleted = false AND encrypted = false;
+
+-- +migrate Down
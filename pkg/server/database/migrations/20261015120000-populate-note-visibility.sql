@@ -0,0 +1,10 @@
+-- populate-note-visibility.sql sets the visibility of the notes shared before it was introduced.
+-- They become unlisted rather than listed on the profile of their owners.
+
+-- +migrate Up
+
+UPDATE notes
+SET visibility = 'unlisted'
+WHERE public = true AND visibility = 'private';
+
+-- +migrate Down
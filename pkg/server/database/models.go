@@ -46,20 +46,51 @@ type Book struct {
 // Note is a model for a note
 type Note struct {
 	Model
-	UUID      string `json:"uuid" gorm:"index;type:uuid;default:uuid_generate_v4()"`
-	Book      Book   `json:"book" gorm:"foreignkey:BookUUID"`
-	User      User   `json:"user"`
-	UserID    int    `json:"user_id" gorm:"index"`
-	BookUUID  string `json:"book_uuid" gorm:"index;type:uuid"`
-	Body      string `json:"content"`
-	AddedOn   int64  `json:"added_on"`
-	EditedOn  int64  `json:"edited_on"`
-	TSV       string `json:"-" gorm:"type:tsvector"`
-	Public    bool   `json:"public" gorm:"default:false"`
-	USN       int    `json:"-" gorm:"index"`
-	Deleted   bool   `json:"-" gorm:"default:false"`
-	Encrypted bool   `json:"-" gorm:"default:false"`
-	Client    string `gorm:"index"`
+	UUID     string `json:"uuid" gorm:"index;type:uuid;default:uuid_generate_v4()"`
+	Book     Book   `json:"book" gorm:"foreignkey:BookUUID"`
+	User     User   `json:"user"`
+	UserID   int    `json:"user_id" gorm:"index"`
+	BookUUID string `json:"book_uuid" gorm:"index;type:uuid"`
+	Title    string `json:"title" gorm:"not null;default:''"`
+	Body     string `json:"content"`
+	AddedOn  int64  `json:"added_on"`
+	EditedOn int64  `json:"edited_on"`
+	TSV      string `json:"-" gorm:"type:tsvector"`
+	Public   bool   `json:"public" gorm:"default:false"`
+	// Visibility is one of NoteVisibilityPrivate, NoteVisibilityUnlisted and NoteVisibilityPublic.
+	// Public is kept in sync with it for the clients that predate it.
+	Visibility string `json:"visibility" gorm:"not null;default:'private'"`
+	USN        int    `json:"-" gorm:"index"`
+	Deleted    bool   `json:"-" gorm:"default:false"`
+	Encrypted  bool   `json:"-" gorm:"default:false"`
+	Client     string `gorm:"index"`
+	// Checksum is the checksum of the body. It is empty for the notes written before it was introduced.
+	Checksum string `json:"-"`
+	// AuthorID is the id of the user who wrote the note. It differs from UserID, which is always
+	// the owner of the book, for the notes written by the members of a team book. It is zero for
+	// the notes written before it was introduced.
+	AuthorID int `json:"-" gorm:"index"`
+	// Metadata is the key-value metadata of the note, encrypted by the client. The server
+	// stores it as it is and cannot read it.
+	Metadata string `json:"-" gorm:"not null;default:''"`
+}
+
+// BookMember is a user other than the owner who can write to a book
+type BookMember struct {
+	Model
+	BookUUID string `gorm:"index;type:uuid"`
+	UserID   int    `gorm:"index"`
+}
+
+// Expunge is a removal of a book or a note that is sent to one user only. It is used when the user
+// loses access to an item that still exists for the other users, such as a book the user was a member of.
+type Expunge struct {
+	Model
+	UserID int `gorm:"index"`
+	// Type is either ExpungeTypeBook or ExpungeTypeNote
+	Type string
+	UUID string `gorm:"index;type:uuid"`
+	USN  int    `gorm:"index"`
 }
 
 // User is a model for a user
@@ -112,4 +143,7 @@ type Session struct {
 	Key        string `gorm:"index"`
 	LastUsedAt time.Time
 	ExpiresAt  time.Time
+	// RefreshToken renews the session after it expires, until RefreshExpiresAt
+	RefreshToken     string `gorm:"index"`
+	RefreshExpiresAt time.Time
 }
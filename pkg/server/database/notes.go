@@ -26,3 +26,21 @@ import (
 func PreloadNote(conn *gorm.DB) *gorm.DB {
 	return conn.Preload("Book").Preload("User")
 }
+
+// memberBooksQuery selects the uuids of the books of which the user is a member
+const memberBooksQuery = "SELECT book_uuid FROM book_members WHERE user_id = ?"
+
+// AccessibleNotes is a scope for the notes that the user with the given id can read and write,
+// which are the notes of the user and the notes in the team books the user is a member of
+func AccessibleNotes(userID int) func(*gorm.DB) *gorm.DB {
+	return func(conn *gorm.DB) *gorm.DB {
+		return conn.Where("notes.user_id = ? OR notes.book_uuid IN ("+memberBooksQuery+")", userID, userID)
+	}
+}
+
+// AccessibleBooks is a scope for the books that the user with the given id can read and write notes in
+func AccessibleBooks(userID int) func(*gorm.DB) *gorm.DB {
+	return func(conn *gorm.DB) *gorm.DB {
+		return conn.Where("books.user_id = ? OR books.uuid IN ("+memberBooksQuery+")", userID, userID)
+	}
+}
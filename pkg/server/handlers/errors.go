@@ -0,0 +1,79 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package handlers
+
+import (
+	"net/http"
+)
+
+// ErrorCodeHeader is the header of an error response carrying the code of the error.
+// The clients branch on the code rather than on the status code or the message, which
+// is for humans and may change.
+const ErrorCodeHeader = "X-Error-Code"
+
+// The error codes. A client that does not know a code should treat the error by its
+// status code.
+const (
+	// ErrorCodeAuthExpired means that the session is missing, expired or revoked, and
+	// the user needs to sign in again
+	ErrorCodeAuthExpired = "auth_expired"
+	// ErrorCodeQuotaExceeded means that the request would exceed a limit on the data
+	// of the user
+	ErrorCodeQuotaExceeded = "quota_exceeded"
+	// ErrorCodeConflict means that the request conflicts with the current state of a
+	// resource, such as a duplicate book
+	ErrorCodeConflict = "conflict"
+	// ErrorCodeValidation means that the payload or the parameters are invalid
+	ErrorCodeValidation = "validation"
+)
+
+// statusErrorCodes are the error codes of the responses with the given status codes,
+// unless the handler sets another one
+var statusErrorCodes = map[int]string{
+	http.StatusUnauthorized:          ErrorCodeAuthExpired,
+	http.StatusRequestEntityTooLarge: ErrorCodeQuotaExceeded,
+	http.StatusInsufficientStorage:   ErrorCodeQuotaExceeded,
+	http.StatusConflict:              ErrorCodeConflict,
+	http.StatusBadRequest:            ErrorCodeValidation,
+	http.StatusUnprocessableEntity:   ErrorCodeValidation,
+}
+
+// errorCodeWriter wraps http.ResponseWriter to set the error code header before the
+// status code is written
+type errorCodeWriter struct {
+	http.ResponseWriter
+}
+
+func (w errorCodeWriter) WriteHeader(code int) {
+	h := w.Header()
+	if h.Get(ErrorCodeHeader) == "" {
+		if errorCode, ok := statusErrorCodes[code]; ok {
+			h.Set(ErrorCodeHeader, errorCode)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// ErrorCode is a middleware setting the error code header on the error responses
+func ErrorCode(inner http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(errorCodeWriter{w}, r)
+	}
+}
@@ -0,0 +1,84 @@
+/* Copyright (C) 2019, 2020 Monomax Software Pty Ltd
+ *
+ * This file is part of Dnote.
+ *
+ * Dnote is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Dnote is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Dnote.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dnote/dnote/pkg/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	testCases := []struct {
+		statusCode int
+		header     string
+		expected   string
+	}{
+		{
+			statusCode: http.StatusUnauthorized,
+			expected:   ErrorCodeAuthExpired,
+		},
+		{
+			statusCode: http.StatusConflict,
+			expected:   ErrorCodeConflict,
+		},
+		{
+			statusCode: http.StatusBadRequest,
+			expected:   ErrorCodeValidation,
+		},
+		{
+			statusCode: http.StatusRequestEntityTooLarge,
+			expected:   ErrorCodeQuotaExceeded,
+		},
+		{
+			statusCode: http.StatusBadRequest,
+			header:     ErrorCodeQuotaExceeded,
+			expected:   ErrorCodeQuotaExceeded,
+		},
+		{
+			statusCode: http.StatusInternalServerError,
+			expected:   "",
+		},
+		{
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("status %d header %s", tc.statusCode, tc.header), func(t *testing.T) {
+			h := ErrorCode(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.header != "" {
+					w.Header().Set(ErrorCodeHeader, tc.header)
+				}
+
+				http.Error(w, "error", tc.statusCode)
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			assert.Equal(t, w.Code, tc.statusCode, "status code mismatch")
+			assert.Equal(t, w.Header().Get(ErrorCodeHeader), tc.expected, "error code mismatch")
+		})
+	}
+}
@@ -37,6 +37,7 @@ func Logging(inner http.Handler) http.HandlerFunc {
 			"method":     r.Method,
 			"duration":   fmt.Sprintf("%dms", time.Since(start)/1000000),
 			"userAgent":  r.Header.Get("User-Agent"),
+			"requestID":  r.Header.Get("X-Request-ID"),
 		}).Info("incoming request")
 	}
 }
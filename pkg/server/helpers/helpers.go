@@ -19,6 +19,10 @@
 package helpers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
@@ -33,6 +37,34 @@ func GenUUID() (string, error) {
 	return id.String(), nil
 }
 
+// Checksum returns the checksum of the given note content, with which the clients verify
+// the content they download
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// InferTitle returns the title inferred from the note content, which is its first non-empty
+// line without the leading marks of a Markdown heading. The clients infer the titles in the
+// same way.
+func InferTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if trimmed := strings.TrimLeft(line, "#"); trimmed != line && strings.HasPrefix(trimmed, " ") {
+			line = strings.TrimSpace(trimmed)
+		}
+
+		return line
+	}
+
+	return ""
+}
+
 // ValidateUUID validates the given uuid
 func ValidateUUID(u string) bool {
 	_, err := uuid.Parse(u)
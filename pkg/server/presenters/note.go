@@ -26,15 +26,17 @@ import (
 
 // Note is a result of PresentNote
 type Note struct {
-	UUID      string    `json:"uuid"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"content"`
-	AddedOn   int64     `json:"added_on"`
-	Public    bool      `json:"public"`
-	USN       int       `json:"usn"`
-	Book      NoteBook  `json:"book"`
-	User      NoteUser  `json:"user"`
+	UUID       string    `json:"uuid"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Title      string    `json:"title"`
+	Body       string    `json:"content"`
+	AddedOn    int64     `json:"added_on"`
+	Public     bool      `json:"public"`
+	Visibility string    `json:"visibility"`
+	USN        int       `json:"usn"`
+	Book       NoteBook  `json:"book"`
+	User       NoteUser  `json:"user"`
 }
 
 // NoteBook is a nested book for PresentNotesResult
@@ -52,13 +54,15 @@ type NoteUser struct {
 // PresentNote presents note
 func PresentNote(note database.Note) Note {
 	ret := Note{
-		UUID:      note.UUID,
-		CreatedAt: FormatTS(note.CreatedAt),
-		UpdatedAt: FormatTS(note.UpdatedAt),
-		Body:      note.Body,
-		AddedOn:   note.AddedOn,
-		Public:    note.Public,
-		USN:       note.USN,
+		UUID:       note.UUID,
+		CreatedAt:  FormatTS(note.CreatedAt),
+		UpdatedAt:  FormatTS(note.UpdatedAt),
+		Title:      note.Title,
+		Body:       note.Body,
+		AddedOn:    note.AddedOn,
+		Public:     note.Public,
+		Visibility: note.Visibility,
+		USN:        note.USN,
 		Book: NoteBook{
 			UUID:  note.Book.UUID,
 			Label: note.Book.Label,
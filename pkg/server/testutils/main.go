@@ -64,6 +64,12 @@ func ClearData(db *gorm.DB) {
 	if err := db.Delete(&database.Note{}).Error; err != nil {
 		panic(errors.Wrap(err, "Failed to clear notes"))
 	}
+	if err := db.Delete(&database.BookMember{}).Error; err != nil {
+		panic(errors.Wrap(err, "Failed to clear book members"))
+	}
+	if err := db.Delete(&database.Expunge{}).Error; err != nil {
+		panic(errors.Wrap(err, "Failed to clear expunges"))
+	}
 	if err := db.Delete(&database.Notification{}).Error; err != nil {
 		panic(errors.Wrap(err, "Failed to clear notifications"))
 	}
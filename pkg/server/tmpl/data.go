@@ -44,6 +44,8 @@ type tmplData struct {
 type noteMetaTagsData struct {
 	Title       string
 	Description string
+	// NoIndex keeps the search engines from indexing the unlisted notes
+	NoIndex bool
 }
 
 type notePage struct {
@@ -106,6 +108,7 @@ func (p notePage) getMetaTags() (template.HTML, error) {
 	data := noteMetaTagsData{
 		Title:       title,
 		Description: desc,
+		NoIndex:     p.Note.Visibility != database.NoteVisibilityPublic,
 	}
 
 	var buf bytes.Buffer
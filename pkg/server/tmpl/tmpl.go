@@ -26,4 +26,5 @@ var noteMetaTags = `
 <meta name="twitter:image" content="https://dnote-asset.s3.amazonaws.com/images/logo-text-vertical.png" />
 <meta name="og:image" content="https://dnote-asset.s3.amazonaws.com/images/logo-text-vertical.png" />
 <meta name="og:title" content="{{ .Title }}" />
-<meta name="og:description" content="{{ .Description }}" />`
+<meta name="og:description" content="{{ .Description }}" />{{ if .NoIndex }}
+<meta name="robots" content="noindex" />{{ end }}`